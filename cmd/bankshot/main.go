@@ -10,17 +10,14 @@ import (
 func main() {
 	// Check if called via symlink for compatibility mode
 	baseName := filepath.Base(os.Args[0])
-	if (baseName == "open" || baseName == "xdg-open") && len(os.Args) >= 2 {
-		// Compatibility mode: bankshot open <url>
-		os.Args = append([]string{"bankshot", "open"}, os.Args[1:]...)
+	if baseName == "open" || baseName == "xdg-open" {
+		// Compatibility mode: open's or xdg-open's arguments and exit codes
+		os.Exit(cli.ExecuteCompat(baseName, os.Args[1:]))
 	}
 	if baseName == "op" {
 		// 1Password proxy mode: bankshot op-proxy -- <args>
 		os.Args = append([]string{"bankshot", "op-proxy", "--"}, os.Args[1:]...)
 	}
 
-	rootCmd := cli.NewRootCmd()
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
-	}
+	os.Exit(cli.Execute())
 }
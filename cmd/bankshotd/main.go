@@ -32,10 +32,10 @@ from remote SSH sessions. It can open URLs in your local browser and
 manage SSH port forwards dynamically.`,
 		Version: version.GetFullVersion(),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Set up logging
-			logLevel := slog.LevelInfo
+			// Set up logging, at info until the config's log level is known
+			logLevel := new(slog.LevelVar)
 			if debug {
-				logLevel = slog.LevelDebug
+				logLevel.Set(slog.LevelDebug)
 			}
 
 			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
@@ -54,6 +54,7 @@ manage SSH port forwards dynamically.`,
 			if err != nil {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
+			cfg.LogWarnings(logger)
 
 			// Override log level if debug flag is set
 			if debug {
@@ -65,8 +66,12 @@ manage SSH port forwards dynamically.`,
 				return fmt.Errorf("invalid configuration: %w", err)
 			}
 
-			// Create and run daemon
+			// Create and run daemon. --debug pins the log level; otherwise
+			// it follows the config's log_level as that changes.
 			d := daemon.New(cfg, logger)
+			if !debug {
+				d.SetLogLevel(logLevel)
+			}
 			return d.Run()
 		},
 	}
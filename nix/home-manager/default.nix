@@ -22,8 +22,23 @@ with lib; let
       portRanges = cfg.monitor.portRanges;
       ignorePorts = cfg.monitor.ignorePorts;
       ignoreProcesses = cfg.monitor.ignoreProcesses;
+      allowProcesses = cfg.monitor.allowProcesses;
+      neverForwardProcesses = cfg.monitor.neverForwardProcesses;
+      source = cfg.monitor.source;
       pollInterval = cfg.monitor.pollInterval;
       gracePeriod = cfg.monitor.gracePeriod;
+      debounce = cfg.monitor.debounce;
+      settleTime = cfg.monitor.settleTime;
+      eventBuffer = cfg.monitor.eventBuffer;
+      udp = cfg.monitor.udp;
+      namespaces = cfg.monitor.namespaces;
+      detectProtocols = cfg.monitor.detectProtocols;
+      eventSocket = cfg.monitor.eventSocket;
+      stateFile = cfg.monitor.stateFile;
+      controlSocket = cfg.monitor.controlSocket;
+      hooks = cfg.monitor.hooks;
+      sockets = cfg.monitor.sockets;
+      kubernetes = cfg.monitor.kubernetes;
     };
   } // lib.optionalAttrs cfg.opProxy.enabled {
     op_proxy = {
@@ -168,6 +183,43 @@ in {
               type = types.int;
               description = "End of port range";
             };
+            healthCheck = mkOption {
+              type = types.nullOr (types.submodule {
+                options = {
+                  type = mkOption {
+                    type = types.enum [ "tcp" "http" ];
+                    description = "Probe new ports with a TCP connect or an HTTP GET";
+                  };
+                  path = mkOption {
+                    type = types.str;
+                    default = "/";
+                    description = "Path requested by http health checks";
+                  };
+                  timeout = mkOption {
+                    type = types.str;
+                    default = "5s";
+                    description = "How long to keep probing a new port before giving up on it";
+                  };
+                };
+              });
+              default = null;
+              description = "Health check a new port in the range must pass before it's forwarded";
+            };
+            gracePeriod = mkOption {
+              type = types.nullOr types.str;
+              default = null;
+              description = "Grace period for the range's forwards, overriding monitor.gracePeriod (\"0s\" removes them as soon as the port closes)";
+            };
+            pollInterval = mkOption {
+              type = types.nullOr types.str;
+              default = null;
+              description = "How often the range's ports are polled, instead of monitor.pollInterval";
+            };
+            autoForward = mkOption {
+              type = types.bool;
+              default = true;
+              description = "Whether the range's ports are auto-forwarded; false excludes them even when another range includes them";
+            };
           };
         });
         default = [];
@@ -187,7 +239,26 @@ in {
       ignoreProcesses = mkOption {
         type = types.listOf types.str;
         default = ["sshd" "systemd" "ssh-agent" "/\\.test$/"];
-        description = "Processes to ignore for port forwarding (applies to bankshot monitor on remote servers)";
+        description = "Processes to ignore for port forwarding; /regex/ entries are regexps, cmdline: entries match the full command line (applies to bankshot monitor on remote servers)";
+      };
+
+      allowProcesses = mkOption {
+        type = types.listOf types.str;
+        default = [];
+        description = "If non-empty, only forward ports of matching processes, in the same syntax as ignoreProcesses (applies to bankshot monitor on remote servers)";
+      };
+
+      neverForwardProcesses = mkOption {
+        type = types.listOf types.str;
+        default = [];
+        example = ["postgres" "redis-server"];
+        description = "Processes whose ports are never forwarded, by the monitor or bankshot wrap, whatever the other rules say; matched against the port's owner only, in the same syntax as ignoreProcesses (applies to remote servers)";
+      };
+
+      source = mkOption {
+        type = types.enum ["auto" "ebpf" "netlink" "poll"];
+        default = "auto";
+        description = "Port event source: eBPF, netlink (sock_diag) polling, /proc polling, or the best available (applies to bankshot monitor on remote servers)";
       };
 
       pollInterval = mkOption {
@@ -201,6 +272,83 @@ in {
         default = "30s";
         description = "Grace period before removing forwards after port close (applies to bankshot monitor on remote servers)";
       };
+
+      debounce = mkOption {
+        type = types.str;
+        default = "100ms";
+        description = "How long a new port must stay open before it's forwarded (applies to bankshot monitor on remote servers)";
+      };
+
+      settleTime = mkOption {
+        type = types.str;
+        default = "2s";
+        description = "How long a flapping port must be quiet before its final state is applied; 0 disables coalescing (applies to bankshot monitor on remote servers)";
+      };
+
+      eventBuffer = mkOption {
+        type = types.int;
+        default = 50;
+        description = "Port events buffered before new ones are dropped (applies to bankshot monitor on remote servers)";
+      };
+
+      udp = mkOption {
+        type = types.bool;
+        default = false;
+        description = "Also report bound UDP ports in logs and status output; they are never forwarded (applies to bankshot monitor on remote servers)";
+      };
+
+      namespaces = mkOption {
+        type = types.bool;
+        default = false;
+        description = "Also forward ports listening inside the network namespaces of your processes, such as rootless containers (applies to bankshot monitor on remote servers)";
+      };
+
+      detectProtocols = mkOption {
+        type = types.bool;
+        default = false;
+        description = "Probe new ports for HTTP, TLS, or HTTP/2 before forwarding them, to show what they are in list and notifications (applies to bankshot monitor on remote servers)";
+      };
+
+      eventSocket = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        example = "~/.bankshot-events.sock";
+        description = "Unix socket on which the monitor streams its forwards as JSON lines, for prompts and status lines (applies to bankshot monitor on remote servers)";
+      };
+
+      hooks = mkOption {
+        type = types.listOf types.str;
+        default = [];
+        example = ["tmux refresh-client -S"];
+        description = "Shell commands run with ACTION, PORT, PROCESS, and PORTS set whenever a forward is created or removed (applies to bankshot monitor on remote servers)";
+      };
+
+      stateFile = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        example = "~/.local/state/bankshot/monitor.json";
+        description = "File in which the monitor saves its forwards, so a restart adopts them instead of forwarding everything again (applies to bankshot monitor on remote servers)";
+      };
+
+      controlSocket = mkOption {
+        type = types.str;
+        default = "~/.bankshot-monitor.sock";
+        description = "Unix socket on which the monitor answers bankshot status --remote; empty disables it (applies to bankshot monitor on remote servers)";
+      };
+
+      kubernetes = mkOption {
+        type = types.attrsOf types.anything;
+        default = { };
+        example = { enabled = true; context = "kind-dev"; };
+        description = "Forward annotated NodePort Services of a local Kubernetes cluster (applies to bankshot monitor on remote servers)";
+      };
+
+      sockets = mkOption {
+        type = types.listOf (types.attrsOf types.anything);
+        default = [ ];
+        example = [{ pattern = "/run/user/*/docker.sock"; localSocket = "~/.bankshot/remote-docker.sock"; }];
+        description = "Unix sockets to auto-forward, each with a path glob and a localSocket or localPort (applies to bankshot monitor on remote servers)";
+      };
     };
 
     settings = mkOption {
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/process"
+	"github.com/spf13/cobra"
+)
+
+func newAttachCmd() *cobra.Command {
+	var (
+		connection   string
+		tree         bool
+		pollInterval int
+		mappings     []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "attach <pid>",
+		Short: "Forward the ports of a process that's already running",
+		Long: `Attach watches a running process and forwards the ports it listens on, now
+and as it opens more, the way wrap does for a command it starts. The forwards
+are removed when the process exits or attach is interrupted, which leaves the
+process running.
+
+Only the process's own ports are forwarded unless --tree adds those of its
+descendants too, as for a dev server that runs its real server as a child:
+
+  bankshot attach 4242
+  bankshot attach --tree $(pgrep -f "npm run dev")
+
+--map forwards a port to another local port, as with wrap.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if pollInterval <= 0 {
+				return fmt.Errorf("--poll-interval must be positive, not %d", pollInterval)
+			}
+			pid, err := strconv.Atoi(args[0])
+			if err != nil || pid <= 0 {
+				return fmt.Errorf("invalid PID: %s", args[0])
+			}
+			proc, ok := process.Find(pid)
+			if !ok {
+				return fmt.Errorf("no process with PID %d", pid)
+			}
+
+			localPorts := make(map[int]int)
+			for _, mapping := range mappings {
+				remote, local, err := parseWrapMapping(mapping)
+				if err != nil {
+					return err
+				}
+				localPorts[remote] = local
+			}
+
+			if connection == "" {
+				if connection, err = defaultConnection(); err != nil {
+					return err
+				}
+			}
+
+			logger := portMonitorLogger()
+			forwarder, err := newPortForwarder(connection, localPorts, logger)
+			if err != nil {
+				return err
+			}
+			forwarder.announce = true
+			if !tree {
+				forwarder.only = pid
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if err := watchPorts(ctx, pid, forwarder, logger); err != nil {
+				return err
+			}
+
+			sigChan := make(chan os.Signal, 1)
+			signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+			defer signal.Stop(sigChan)
+
+			ticker := time.NewTicker(time.Duration(pollInterval) * time.Millisecond)
+			defer ticker.Stop()
+
+			fmt.Fprintf(stdout, "Attached to PID %d, forwarding its ports over %s until it exits (Ctrl-C to detach)\n", pid, connection)
+			for proc.Running() {
+				select {
+				case sig := <-sigChan:
+					if verbose {
+						fmt.Fprintf(stdout, "Received signal: %s\n", sig)
+					}
+					cancel()
+					removeOwnForwards(connection, forwarder.stop())
+					return nil
+				case <-ticker.C:
+				}
+			}
+
+			if verbose {
+				fmt.Fprintf(stdout, "PID %d exited\n", pid)
+			}
+			cancel()
+			removeOwnForwards(connection, forwarder.stop())
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&connection, "connection", "c", "", "SSH connection identifier (default: this SSH session's)")
+	_ = cmd.RegisterFlagCompletionFunc("connection", completeConnections)
+	cmd.Flags().BoolVar(&tree, "tree", false, "Forward the ports of the process's descendants too")
+	cmd.Flags().IntVarP(&pollInterval, "poll-interval", "p", 500, "How often to check whether the process has exited, in milliseconds")
+	cmd.Flags().StringArrayVar(&mappings, "map", nil, "Forward a remote port to another local port, e.g. 8080:local=9090 (repeatable)")
+	return cmd
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAttachPollInterval(t *testing.T) {
+	for _, interval := range []string{"0", "-5"} {
+		t.Run(interval, func(t *testing.T) {
+			cmd := newAttachCmd()
+			cmd.SetArgs([]string{"-p", interval, strconv.Itoa(os.Getpid())})
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+			err := cmd.Execute()
+			if err == nil || !strings.Contains(err.Error(), "--poll-interval must be positive") {
+				t.Errorf("Execute() error = %v, want --poll-interval refused", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+func newCopyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "copy [text]",
+		Short: "Copy text to the local clipboard",
+		Long: `Puts the given text, or standard input when no text is given, on the
+clipboard of the local machine:
+
+  git rev-parse HEAD | bankshot copy`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var text string
+			if len(args) == 1 {
+				text = args[0]
+			} else {
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("failed to read stdin: %w", err)
+				}
+				text = string(data)
+			}
+
+			payload, err := json.Marshal(protocol.ClipboardRequest{Text: text})
+			if err != nil {
+				return fmt.Errorf("failed to marshal request: %w", err)
+			}
+
+			resp, err := sendRequest(&protocol.Request{
+				ID:      uuid.New().String(),
+				Type:    protocol.CommandCopy,
+				Payload: payload,
+			})
+			if err != nil {
+				return err
+			}
+			if !resp.Success {
+				return requestFailed(fmt.Errorf("failed to copy: %s", resp.Error))
+			}
+
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Copied %d bytes\n", len(text))
+			}
+			return nil
+		},
+	}
+}
+
+func newPasteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "paste",
+		Short: "Print the local clipboard",
+		Long: `Writes the text on the clipboard of the local machine to standard output:
+
+  bankshot paste > notes.txt
+
+The daemon's config has to allow it with clipboard.paste.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := sendRequest(&protocol.Request{
+				ID:   uuid.New().String(),
+				Type: protocol.CommandPaste,
+			})
+			if err != nil {
+				return err
+			}
+			if !resp.Success {
+				return requestFailed(fmt.Errorf("failed to paste: %s", resp.Error))
+			}
+
+			var clip protocol.ClipboardResponse
+			if err := json.Unmarshal(resp.Data, &clip); err != nil {
+				return fmt.Errorf("failed to parse response: %w", err)
+			}
+			_, err = io.WriteString(os.Stdout, clip.Text)
+			return err
+		},
+	}
+}
+
+// clipboardShims are the commands programs run to use the clipboard, and the
+// script standing in for each in wrapped commands, with %[1]s the bankshot
+// binary. xclip and xsel copy unless asked to print the clipboard.
+var clipboardShims = map[string]string{
+	"pbcopy":   "exec %[1]s copy\n",
+	"pbpaste":  "exec %[1]s paste\n",
+	"wl-copy":  "exec %[1]s copy\n",
+	"wl-paste": "exec %[1]s paste\n",
+	"xclip": `for arg; do
+	case "$arg" in -o|-out) exec %[1]s paste ;; esac
+done
+exec %[1]s copy
+`,
+	"xsel": `for arg; do
+	case "$arg" in --output|-[!-]*o*) exec %[1]s paste ;; esac
+done
+exec %[1]s copy
+`,
+}
+
+// writeClipboardShims writes the clipboardShims for execPath to a new
+// directory, for the front of a wrapped command's PATH, so it copies and
+// pastes with the laptop's clipboard. The caller removes the directory.
+// There are none on Windows, which has no shell to run them.
+func writeClipboardShims(execPath string) (string, error) {
+	if runtime.GOOS == "windows" {
+		return "", nil
+	}
+	dir, err := os.MkdirTemp("", "bankshot-clipboard-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create clipboard commands: %w", err)
+	}
+	for name, script := range clipboardShims {
+		content := "#!/bin/sh\n" + fmt.Sprintf(script, shellQuote(execPath))
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o755); err != nil {
+			_ = os.RemoveAll(dir)
+			return "", fmt.Errorf("failed to create clipboard commands: %w", err)
+		}
+	}
+	return dir, nil
+}
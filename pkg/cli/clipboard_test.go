@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestClipboardShims(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no clipboard commands on Windows")
+	}
+
+	// Stands in for bankshot, printing the command it was run with
+	fake := filepath.Join(t.TempDir(), "bank shot")
+	if err := os.WriteFile(fake, []byte("#!/bin/sh\necho \"$@\"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := writeClipboardShims(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	tests := []struct {
+		command []string
+		want    string
+	}{
+		{[]string{"pbcopy"}, "copy"},
+		{[]string{"pbpaste"}, "paste"},
+		{[]string{"wl-copy"}, "copy"},
+		{[]string{"wl-paste", "--no-newline"}, "paste"},
+		{[]string{"xclip", "-selection", "clipboard"}, "copy"},
+		{[]string{"xclip", "-selection", "clipboard", "-o"}, "paste"},
+		{[]string{"xsel", "--clipboard", "--input"}, "copy"},
+		{[]string{"xsel", "-bo"}, "paste"},
+		{[]string{"xsel", "--clipboard", "--output"}, "paste"},
+	}
+	for _, tt := range tests {
+		out, err := exec.Command(filepath.Join(dir, tt.command[0]), tt.command[1:]...).Output()
+		if err != nil {
+			t.Errorf("%q: %v", tt.command, err)
+			continue
+		}
+		if got := strings.TrimSpace(string(out)); got != tt.want {
+			t.Errorf("%q ran bankshot %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
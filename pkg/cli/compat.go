@@ -0,0 +1,251 @@
+package cli
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/phinze/bankshot/pkg/opener"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/phinze/bankshot/version"
+	"github.com/spf13/pflag"
+)
+
+// ExecuteCompat runs bankshot as the open or xdg-open it's installed in
+// place of (by a symlink of that name on PATH), taking that command's
+// arguments and returning its exit codes, so scripts calling it keep
+// working. When the daemon can't be reached, the real command further
+// along PATH, if there is one, is run instead; for open, only on macOS.
+func ExecuteCompat(name string, args []string) int {
+	if name == "xdg-open" {
+		return xdgOpen(args)
+	}
+	return macOpen(args)
+}
+
+// Exit codes of xdg-open, which scripts calling it may check
+const (
+	xdgExitSyntax = 1 // Error in the command line
+	xdgExitNoFile = 2 // The file doesn't exist
+	xdgExitNoTool = 3 // A required tool, here the daemon, couldn't be reached
+	xdgExitFailed = 4 // The open failed
+)
+
+const xdgOpenUsage = `Usage: xdg-open { file | URL }
+       xdg-open { --help | --manual | --version }
+
+Opens a file or URL on the local machine, through bankshot.`
+
+// xdgOpen opens its one argument like xdg-open
+func xdgOpen(args []string) int {
+	if len(args) == 1 {
+		switch args[0] {
+		case "--help", "--manual":
+			fmt.Fprintln(stdout, xdgOpenUsage)
+			return ExitOK
+		case "--version":
+			fmt.Fprintf(stdout, "xdg-open (bankshot %s)\n", version.GetVersion())
+			return ExitOK
+		}
+	}
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "xdg-open: expected one file or URL")
+		fmt.Fprintln(os.Stderr, xdgOpenUsage)
+		return xdgExitSyntax
+	}
+
+	err := openCompatTarget(args[0], protocol.OpenRequest{})
+	if err == nil {
+		return ExitOK
+	}
+	if ExitCode(err) == ExitDaemonUnreachable {
+		if code, ok := runFallback("xdg-open", args); ok {
+			return code
+		}
+	}
+	fmt.Fprintf(os.Stderr, "xdg-open: %v\n", err)
+	switch {
+	case errors.Is(err, errNoSuchFile):
+		return xdgExitNoFile
+	case ExitCode(err) == ExitDaemonUnreachable:
+		return xdgExitNoTool
+	}
+	return xdgExitFailed
+}
+
+const macOpenUsage = `Usage: open [-a <application>] [-b <bundle identifier>] [-u <URL>] [-f] [-gnjFWet] [<file or URL> ...] [--args ...]
+
+Opens files and URLs on the local machine, through bankshot. -a and -b pick
+the browser URLs open in; -g, -n, -j, -F, and -W are accepted and have no
+effect, and arguments after --args are ignored.`
+
+// macOpen opens its arguments like macOS's open, which exits 1 if any of
+// them failed
+func macOpen(args []string) int {
+	// What follows --args is for the application, which isn't started here
+	if i := slices.Index(args, "--args"); i >= 0 {
+		args = args[:i]
+	}
+
+	flags := pflag.NewFlagSet("open", pflag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	app := flags.StringP("application", "a", "", "")
+	bundle := flags.StringP("bundle", "b", "", "")
+	openURLFlag := flags.StringP("url", "u", "", "")
+	fromStdin := flags.BoolP("stdin", "f", false, "")
+	reveal := flags.BoolP("reveal", "R", false, "")
+	for _, short := range []string{"g", "n", "j", "F", "W", "e", "t"} {
+		flags.BoolP("ignored-"+short, short, false, "")
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			fmt.Fprintln(stdout, macOpenUsage)
+			return ExitOK
+		}
+		fmt.Fprintf(os.Stderr, "open: %v\n%s\n", err, macOpenUsage)
+		return ExitError
+	}
+	if *reveal {
+		fmt.Fprintln(os.Stderr, "open: -R can't reveal files on the local machine")
+		return ExitError
+	}
+
+	targets := flags.Args()
+	if *openURLFlag != "" {
+		targets = append(targets, *openURLFlag)
+	}
+	if len(targets) == 0 && !*fromStdin {
+		fmt.Fprintln(os.Stderr, macOpenUsage)
+		return ExitError
+	}
+
+	var openReq protocol.OpenRequest
+	if name := cmp.Or(*app, *bundle); name != "" {
+		if browser, ok := opener.BrowserNamed(name); ok {
+			openReq.Browser = browser
+		} else {
+			fmt.Fprintf(os.Stderr, "open: opening with the default application, as %s isn't a browser bankshot knows\n", name)
+		}
+	}
+
+	failed := false
+	if *fromStdin {
+		if err := openStdin(); err != nil {
+			fmt.Fprintf(os.Stderr, "open: %v\n", err)
+			failed = true
+		}
+	}
+	for i, target := range targets {
+		err := openCompatTarget(target, openReq)
+		if err == nil {
+			continue
+		}
+		// Hand everything to the real open, unless some of it was opened.
+		// Elsewhere, an open on PATH is some other command, like Debian's
+		// openvt.
+		if i == 0 && !*fromStdin && ExitCode(err) == ExitDaemonUnreachable && runtime.GOOS == "darwin" {
+			if code, ok := runFallback("open", args); ok {
+				return code
+			}
+		}
+		if errors.Is(err, errNoSuchFile) {
+			fmt.Fprintf(os.Stderr, "The file %s does not exist.\n", target)
+		} else {
+			fmt.Fprintf(os.Stderr, "open: %v\n", err)
+		}
+		failed = true
+	}
+	if failed {
+		return ExitError
+	}
+	return ExitOK
+}
+
+// errNoSuchFile is returned for a target that's neither a URL nor a file
+var errNoSuchFile = errors.New("no such file")
+
+// openCompatTarget opens target the way open and xdg-open tell files and
+// URLs apart: one without a scheme is a file, and must exist
+func openCompatTarget(target string, openReq protocol.OpenRequest) error {
+	if path, ok := localFile(target); ok {
+		return openFile(path, false)
+	}
+	if u, err := url.Parse(target); err == nil && u.Scheme != "" && !strings.EqualFold(u.Scheme, "file") {
+		openReq.URL = target
+		return openURL(openReq)
+	}
+
+	path := target
+	if u, err := url.Parse(target); err == nil && strings.EqualFold(u.Scheme, "file") {
+		path = u.Path
+	}
+	if info, err := os.Stat(path); err == nil && !info.Mode().IsRegular() {
+		return fmt.Errorf("%s isn't a regular file; only files can be opened on the local machine", target)
+	}
+	return fmt.Errorf("%s: %w", target, errNoSuchFile)
+}
+
+// openStdin opens what's on stdin as a text file, like open -f
+func openStdin() error {
+	dir, err := os.MkdirTemp("", "bankshot-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "stdin.txt")
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, os.Stdin); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to read stdin: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return openFile(path, false)
+}
+
+// runFallback runs the command called name further along PATH than
+// bankshot, passing args and stdio through, and returns its exit code;
+// false if there's no such command
+func runFallback(name string, args []string) (int, bool) {
+	self, err := os.Executable()
+	if err == nil {
+		if resolved, err := filepath.EvalSymlinks(self); err == nil {
+			self = resolved
+		}
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		candidate, err := exec.LookPath(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(candidate); err == nil && resolved == self {
+			continue
+		}
+		cmd := exec.Command(candidate, args...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		err = cmd.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), true
+		}
+		if err != nil {
+			continue
+		}
+		return ExitOK, true
+	}
+	return 0, false
+}
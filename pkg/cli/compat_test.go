@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCompatFallback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake commands are shell scripts")
+	}
+	dir := t.TempDir()
+	ran := filepath.Join(dir, "ran")
+	for _, name := range []string{"open", "xdg-open"} {
+		script := "#!/bin/sh\necho " + name + " >> " + ran + "\nexit 7\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+	saved := socketPath
+	socketPath = filepath.Join(dir, "missing.sock")
+	defer func() { socketPath = saved }()
+
+	if code := xdgOpen([]string{"https://example.com"}); code != 7 {
+		t.Errorf("xdgOpen() = %d, want the real xdg-open's 7", code)
+	}
+
+	code := macOpen([]string{"https://example.com"})
+	if runtime.GOOS == "darwin" {
+		if code != 7 {
+			t.Errorf("macOpen() = %d, want the real open's 7", code)
+		}
+	} else if code != ExitError {
+		t.Errorf("macOpen() = %d, want %d without running the open on PATH", code, ExitError)
+	}
+
+	want := "xdg-open\n"
+	if runtime.GOOS == "darwin" {
+		want += "open\n"
+	}
+	if got, _ := os.ReadFile(ran); string(got) != want {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+}
@@ -1,42 +1,48 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/phinze/bankshot/pkg/config"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 func newConfigCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "config",
 		Short: "Display daemon configuration",
-		Long:  `Displays the current daemon configuration including socket path and settings.`,
-		Args:  cobra.NoArgs,
+		Long: `Displays the current daemon configuration including socket path and settings.
+
+The subcommands show, change, and check the config file; settings are named
+by their dotted YAML keys, such as monitor.pollInterval.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := config.Load("")
 			if err != nil {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
-			fmt.Println("Bankshot Configuration:")
-			fmt.Printf("  Network: %s\n", cfg.Network)
-			fmt.Printf("  Address: %s\n", cfg.Address)
-			fmt.Printf("  SSH Command: %s\n", cfg.SSHCommand)
-			fmt.Printf("  Log Level: %s\n", cfg.LogLevel)
+			fmt.Fprintln(stdout, "Bankshot Configuration:")
+			fmt.Fprintf(stdout, "  Network: %s\n", cfg.Network)
+			fmt.Fprintf(stdout, "  Address: %s\n", cfg.Address)
+			fmt.Fprintf(stdout, "  SSH Command: %s\n", cfg.SSHCommand)
+			fmt.Fprintf(stdout, "  Log Level: %s\n", cfg.LogLevel)
 
 			if cfg.Network == "unix" {
 				expanded, err := homedir.Expand(cfg.Address)
 				if err == nil && expanded != cfg.Address {
-					fmt.Printf("  Expanded Path: %s\n", expanded)
+					fmt.Fprintf(stdout, "  Expanded Path: %s\n", expanded)
 				}
 
 				if _, err := os.Stat(expanded); err == nil {
-					fmt.Printf("  Socket Status: Active\n")
+					fmt.Fprintf(stdout, "  Socket Status: Active\n")
 				} else if os.IsNotExist(err) {
-					fmt.Printf("  Socket Status: Not found (daemon may not be running)\n")
+					fmt.Fprintf(stdout, "  Socket Status: Not found (daemon may not be running)\n")
 				}
 			}
 
@@ -45,17 +51,224 @@ func newConfigCmd() *cobra.Command {
 				"/etc/bankshot/config.yaml",
 			}
 
-			fmt.Printf("\nConfig Search Paths:\n")
+			fmt.Fprintf(stdout, "\nConfig Search Paths:\n")
 			for _, path := range configPaths {
 				expanded, _ := homedir.Expand(path)
 				if _, err := os.Stat(expanded); err == nil {
-					fmt.Printf("  %s (found)\n", path)
+					fmt.Fprintf(stdout, "  %s (found)\n", path)
 				} else {
-					fmt.Printf("  %s\n", path)
+					fmt.Fprintf(stdout, "  %s\n", path)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.AddCommand(newConfigViewCmd())
+	cmd.AddCommand(newConfigGetCmd())
+	cmd.AddCommand(newConfigSetCmd())
+	cmd.AddCommand(newConfigValidateCmd())
+	cmd.AddCommand(newConfigMigrateCmd())
+	cmd.AddCommand(newConfigPathCmd())
+
+	return cmd
+}
+
+func newConfigViewCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "view",
+		Short: "Print the effective configuration as YAML",
+		Long: `Prints the configuration bankshot and the daemon run with: the config file's
+settings on top of the defaults.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load("")
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+			printWarnings(cfg)
+			return printYAML(cfg)
+		},
+	}
+}
+
+func newConfigGetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print one setting of the effective configuration",
+		Long: `Prints the setting at key, such as forwarder.port_conflict, as bankshot and
+the daemon see it, defaults included.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load("")
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+			printWarnings(cfg)
+			value, err := cfg.Get(args[0])
+			if err != nil {
+				return err
+			}
+
+			switch reflect.ValueOf(value).Kind() {
+			case reflect.Struct, reflect.Slice, reflect.Map:
+				return printYAML(value)
+			default:
+				fmt.Println(value)
+				return nil
+			}
+		},
+	}
+}
+
+func newConfigSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Change a setting in the config file",
+		Long: `Sets key to value in the config file, creating it if need be, and keeps the
+rest of the file and its comments. The value is checked against the setting's
+type and the whole config is validated before anything is written:
+
+  bankshot config set monitor.pollInterval 2s
+  bankshot config set forwarder.port_conflict next
+
+Lists and maps, such as monitor.portRanges, are changed by editing the file.
+The daemon and monitor apply log_level and their rules as soon as the file
+changes; other settings take a restart of whichever reads them.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := config.DefaultPath()
+			if err != nil {
+				return err
+			}
+			if err := config.SetInFile(path, args[0], args[1]); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "Set %s to %s in %s\n", args[0], args[1], path)
+			return nil
+		},
+	}
+}
+
+func newConfigValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate [file]",
+		Short: "Check a config file without restarting the daemon",
+		Long: `Checks that the config file (the default one, without file) and the files it
+includes parse, have no keys bankshot doesn't know, and together pass the
+checks the daemon makes when it starts.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var path string
+			if len(args) == 1 {
+				path = args[0]
+			} else {
+				var err error
+				if path, err = config.DefaultPath(); err != nil {
+					return err
+				}
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					fmt.Fprintf(stdout, "No config file at %s; the defaults apply\n", path)
+					return nil
+				}
+			}
+
+			if err := config.ValidateFile(path); err != nil {
+				var errs config.Errors
+				if errors.As(err, &errs) {
+					// Each already says where it is
+					return err
 				}
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			fmt.Fprintf(stdout, "%s is valid\n", path)
+			return nil
+		},
+	}
+}
+
+func newConfigMigrateCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate [file]",
+		Short: "Rewrite a config file in the current layout",
+		Long: `Rewrites the config file (the default one, without file) with the keys of
+this version of bankshot, keeping its comments, and sets its version. Files
+in an older layout are still read, but each setting under an old key is
+logged until the file is migrated. Files it includes are migrated on their
+own.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var path string
+			if len(args) == 1 {
+				path = args[0]
+			} else {
+				var err error
+				if path, err = config.DefaultPath(); err != nil {
+					return err
+				}
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					fmt.Fprintf(stdout, "No config file at %s; nothing to migrate\n", path)
+					return nil
+				}
+			}
+
+			out, moved, err := config.MigrateFile(path, dryRun)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Fprint(stdout, string(out))
+				return nil
 			}
+			for _, m := range moved {
+				fmt.Fprintln(stdout, m)
+			}
+			fmt.Fprintf(stdout, "%s is at version %d\n", path, config.CurrentVersion())
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the migrated file instead of writing it")
 
+	return cmd
+}
+
+func newConfigPathCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "path",
+		Short: "Print where the config file is read from",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := config.DefaultPath()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(stdout, path)
 			return nil
 		},
 	}
 }
+
+// printWarnings prints the keys Load ignored or migrated to stderr, so they
+// aren't mistaken for settings in effect
+func printWarnings(cfg *config.Config) {
+	for _, w := range cfg.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s (ignored)\n", w)
+	}
+	for _, m := range cfg.Migrated {
+		fmt.Fprintf(os.Stderr, "Warning: %s; run bankshot config migrate\n", m)
+	}
+}
+
+// printYAML prints v as YAML
+func printYAML(v interface{}) error {
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	return enc.Close()
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+// defaultConnection returns the connection to use without --connection: the
+// one this host's requests reach the daemon through, when the daemon can
+// tell which that is, and otherwise the hostname, which only works while
+// ssh_config calls the host by that name
+func defaultConnection() (string, error) {
+	if conn, ok := callerConnection(); ok {
+		if verbose {
+			fmt.Fprintf(stdout, "Using connection %s, the one the daemon's socket is forwarded over\n", conn)
+		}
+		return conn, nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to get hostname: %w", err)
+	}
+	return hostname, nil
+}
+
+// callerConnection asks the daemon which of its connections this host's
+// requests come through. The daemon tells from the socket's peer, the
+// control master forwarding it here, without scanning its processes.
+func callerConnection() (string, bool) {
+	result, err := connections()
+	if err != nil || result.Caller == nil {
+		return "", false
+	}
+	return result.Caller.ConnectionInfo, result.Caller.ConnectionInfo != ""
+}
+
+// connections asks the daemon for the control masters on the laptop, or,
+// from a remote host, the one its requests come through
+func connections() (*protocol.ConnectionsResponse, error) {
+	resp, err := sendRequest(&protocol.Request{
+		ID:   uuid.New().String(),
+		Type: protocol.CommandConnections,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, requestFailed(fmt.Errorf("failed to list connections: %s", resp.Error))
+	}
+
+	var result protocol.ConnectionsResponse
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &result, nil
+}
+
+// completeConnections completes --connection with the daemon's connections
+func completeConnections(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	result, err := connections()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, conn := range result.Connections {
+		if conn.ConnectionInfo != "" && strings.HasPrefix(conn.ConnectionInfo, toComplete) && !slices.Contains(names, conn.ConnectionInfo) {
+			names = append(names, conn.ConnectionInfo)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,477 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/config"
+	"github.com/phinze/bankshot/pkg/monitor"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+// doctorTimeout bounds each socket probe, so a wedged daemon or monitor is
+// reported rather than hanging the doctor
+const doctorTimeout = 3 * time.Second
+
+// Outcomes of a doctor check
+const (
+	checkOK = iota
+	checkWarn
+	checkFail
+)
+
+// doctorCheck is the outcome of one doctor check
+type doctorCheck struct {
+	name   string
+	result int
+	detail string
+	fix    string // What to do about a warning or failure
+}
+
+// errSocketRefused is returned by probeSocket when nothing listens on a
+// socket file, as when its owner exited without removing it. Only a refused
+// connection means that; a timeout or a permission error says nothing about
+// whether the owner is still around.
+var errSocketRefused = errors.New("nothing is listening on the socket")
+
+func newDoctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor [ssh-host]",
+		Short: "Check bankshot's setup and suggest fixes",
+		Long: `Doctor checks the things bankshot needs and prints a fix for each one that's
+missing. Run it on both ends; it tells them apart by SSH_CONNECTION.
+
+On the laptop it checks that the daemon answers on its socket and that
+ssh_config sets up ControlMaster and the RemoteForward of the daemon's socket
+for ssh-host (or for every host, without one), and whether ssh-host's control
+socket is stale.
+
+On the remote host it checks that the daemon's socket was forwarded and
+reaches the daemon, that the monitor is running, and whether eBPF port
+monitoring is available to it. Socket files left behind by a daemon, ssh, or
+monitor that's gone are reported as stale on either end.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load("")
+			if err == nil {
+				err = cfg.Validate()
+			}
+			if err != nil {
+				printDoctorCheck(doctorCheck{
+					name:   "Config",
+					result: checkFail,
+					detail: err.Error(),
+					fix:    "Fix the config file; `bankshot config` shows where it's read from",
+				})
+				return fmt.Errorf("doctor found 1 problem")
+			}
+
+			var checks []doctorCheck
+			if os.Getenv("SSH_CONNECTION") != "" {
+				checks = append(checks, checkForwardedSocket(cfg))
+				monitorChecks, status := checkMonitor(cfg)
+				checks = append(checks, monitorChecks...)
+				checks = append(checks, checkEBPF(status))
+			} else {
+				host := ""
+				if len(args) == 1 {
+					host = args[0]
+				}
+				checks = append(checks, checkDaemonSocket(cfg))
+				checks = append(checks, checkSSHConfig(cfg, host)...)
+			}
+
+			problems := 0
+			for _, check := range checks {
+				printDoctorCheck(check)
+				if check.result == checkFail {
+					problems++
+				}
+			}
+			if problems > 0 {
+				return fmt.Errorf("doctor found %d problem(s)", problems)
+			}
+			fmt.Fprintln(stdout, "\nNo problems found")
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// printDoctorCheck prints a check's outcome, and its fix when it has one
+func printDoctorCheck(check doctorCheck) {
+	mark := "\033[32m✓\033[0m"
+	switch check.result {
+	case checkWarn:
+		mark = "\033[33m!\033[0m"
+	case checkFail:
+		mark = "\033[31m×\033[0m"
+	}
+	fmt.Fprintf(stdout, "%s %s: %s\n", mark, check.name, check.detail)
+	if check.result != checkOK && check.fix != "" {
+		fmt.Fprintf(stdout, "    fix: %s\n", check.fix)
+	}
+}
+
+// checkDaemonSocket checks, on the laptop, that the daemon answers on its
+// socket
+func checkDaemonSocket(cfg *config.Config) doctorCheck {
+	check := doctorCheck{name: "Daemon socket"}
+	status, err := probeDaemon(cfg.Address)
+	switch {
+	case err == nil:
+		check.detail = fmt.Sprintf("daemon %s answering at %s", status.Version, cfg.Address)
+	case errors.Is(err, os.ErrNotExist):
+		check.result = checkFail
+		check.detail = fmt.Sprintf("%s doesn't exist", cfg.Address)
+		check.fix = "Start the daemon: `bankshotd`, or `brew services start bankshot`"
+	case errors.Is(err, errSocketRefused):
+		check.result = checkFail
+		check.detail = fmt.Sprintf("%s is stale, nothing is listening on it", cfg.Address)
+		check.fix = "Start the daemon, which replaces the stale socket: `bankshotd`, or `brew services restart bankshot`"
+	default:
+		check.result = checkFail
+		check.detail = fmt.Sprintf("%s isn't answering as a bankshot daemon: %v", cfg.Address, err)
+		check.fix = "Restart the daemon: `brew services restart bankshot`, or stop the process holding the socket and run `bankshotd`"
+	}
+	return check
+}
+
+// checkForwardedSocket checks, on the remote host, that ssh forwarded the
+// daemon's socket and that it reaches the daemon
+func checkForwardedSocket(cfg *config.Config) doctorCheck {
+	check := doctorCheck{name: "Forwarded daemon socket"}
+	if cfg.ProxyCommand != "" {
+		check.name = "Daemon through proxy_command"
+		status, err := probeDaemon(protocol.DaemonAddress(cfg.Address, cfg.ProxyCommand))
+		if err != nil {
+			check.result = checkFail
+			check.detail = fmt.Sprintf("%q didn't reach the daemon: %v", cfg.ProxyCommand, err)
+			check.fix = "Check that the command runs `bankshot proxy` on your laptop, e.g. `ssh laptop bankshot proxy`, and that the daemon runs there"
+			return check
+		}
+		check.detail = fmt.Sprintf("daemon %s reached through %q", status.Version, cfg.ProxyCommand)
+		return check
+	}
+
+	status, err := probeDaemon(cfg.Address)
+	switch {
+	case err == nil:
+		check.detail = fmt.Sprintf("daemon %s reached through %s", status.Version, cfg.Address)
+	case errors.Is(err, os.ErrNotExist):
+		check.result = checkFail
+		check.detail = fmt.Sprintf("%s doesn't exist, so ssh isn't forwarding the daemon's socket", cfg.Address)
+		check.fix = "Add `RemoteForward ~/.bankshot.sock ~/.bankshot.sock` for this host to ~/.ssh/config on your laptop, then reconnect"
+	case errors.Is(err, errSocketRefused):
+		check.result = checkFail
+		check.detail = fmt.Sprintf("%s is stale, left by an earlier connection, so ssh couldn't forward over it", cfg.Address)
+		check.fix = fmt.Sprintf("Remove it (`rm %s`) and reconnect; `StreamLocalBindUnlink yes` in this host's sshd_config replaces it on every connection", cfg.Address)
+	default:
+		check.result = checkFail
+		check.detail = fmt.Sprintf("ssh forwards %s, but the daemon on your laptop isn't answering: %v", cfg.Address, err)
+		check.fix = "Start the daemon on your laptop (`bankshotd`, or `brew services start bankshot`); `bankshot doctor` there checks it"
+	}
+	return check
+}
+
+// checkMonitor checks, on the remote host, that the monitor is running, and
+// that neither of its sockets was left behind by one that isn't. It returns
+// the monitor's status too, when it answered.
+func checkMonitor(cfg *config.Config) ([]doctorCheck, *protocol.MonitorStatusResponse) {
+	restart := "Restart the monitor, which replaces it: `systemctl --user restart bankshot-monitor`, or `bankshot monitor run`"
+
+	var checks []doctorCheck
+	var status *protocol.MonitorStatusResponse
+	if path := cfg.Monitor.ControlSocket; path != "" {
+		check := doctorCheck{name: "Monitor"}
+		var err error
+		status, err = probeMonitor(path)
+		switch {
+		case err == nil:
+			check.detail = fmt.Sprintf("running, answering at %s", path)
+		case errors.Is(err, os.ErrNotExist):
+			check.result = checkWarn
+			check.detail = "not running, so ports opened here aren't forwarded automatically"
+			check.fix = "Start it: `systemctl --user start bankshot-monitor`, or `bankshot monitor run`"
+		case errors.Is(err, errSocketRefused):
+			check.result = checkFail
+			check.detail = fmt.Sprintf("%s is stale, nothing is listening on it", path)
+			check.fix = restart
+		default:
+			check.result = checkFail
+			check.detail = fmt.Sprintf("not answering at %s: %v", path, err)
+			check.fix = restart
+		}
+		checks = append(checks, check)
+	}
+
+	if path := cfg.Monitor.EventSocketPath(); path != "" {
+		if err := probeSocket(path); errors.Is(err, errSocketRefused) {
+			checks = append(checks, doctorCheck{
+				name:   "Monitor event socket",
+				result: checkFail,
+				detail: fmt.Sprintf("%s is stale, nothing is listening on it", path),
+				fix:    restart,
+			})
+		}
+	}
+	return checks, status
+}
+
+// checkEBPF checks whether the monitor uses eBPF rather than polling. That
+// comes from the monitor's status when it answered; otherwise the best
+// doctor can do is probe with its own privileges, which a monitor started
+// some other way may not share.
+func checkEBPF(status *protocol.MonitorStatusResponse) doctorCheck {
+	check := doctorCheck{name: "eBPF port monitoring"}
+	var fix string
+	if runtime.GOOS == "linux" {
+		fix = "Give bankshot CAP_BPF and CAP_PERFMON (`sudo setcap cap_bpf,cap_perfmon,cap_dac_read_search=ep $(command -v bankshot)`, or services.bankshot.ebpf.enable on NixOS) and restart the monitor; polling works, but notices ports up to monitor.pollInterval later"
+	}
+
+	if status != nil {
+		if status.Source == monitor.SourceEBPF {
+			check.detail = "in use by the monitor"
+			return check
+		}
+		check.result = checkWarn
+		check.detail = fmt.Sprintf("not in use, the monitor watches ports with %s", status.Source)
+		check.fix = fix
+		return check
+	}
+
+	if err := monitor.ProbeEBPF(); err != nil {
+		check.result = checkWarn
+		check.detail = fmt.Sprintf("not available to bankshot run as you (%v), so a monitor started the same way would poll for ports", err)
+		check.fix = fix
+		return check
+	}
+	check.detail = "available to bankshot run as you; start the monitor to see what it uses"
+	return check
+}
+
+// checkSSHConfig checks, on the laptop, that ssh_config gives host (or every
+// host, when it's empty) the ControlMaster connection bankshot forwards
+// through and the RemoteForward of the daemon's socket, and that host's
+// control socket isn't stale
+func checkSSHConfig(cfg *config.Config, host string) []doctorCheck {
+	// tsh brings its own connections
+	if cfg.Forwarder.Backend == "tsh" {
+		return nil
+	}
+	if _, err := exec.LookPath("ssh"); err != nil {
+		return []doctorCheck{{name: "SSH config", result: checkFail, detail: "ssh not found in PATH", fix: "Install OpenSSH"}}
+	}
+
+	target := host
+	if target == "" {
+		// Names no real host, so only Host * and the like apply
+		target = "bankshot-doctor.invalid"
+	}
+	output, err := exec.Command("ssh", "-G", target).Output()
+	if err != nil {
+		return []doctorCheck{{name: "SSH config", result: checkFail, detail: fmt.Sprintf("ssh -G %s failed: %v", target, err), fix: "Fix the errors `ssh -G` reports in ~/.ssh/config"}}
+	}
+	settings := parseSSHSettings(output)
+
+	scope, section := "every host", "Host *"
+	if host != "" {
+		scope, section = host, "Host "+host
+	}
+
+	control := doctorCheck{name: "ControlMaster"}
+	switch {
+	case settings.controlMaster == "" || settings.controlMaster == "false" || settings.controlMaster == "no":
+		control.result = checkFail
+		control.detail = fmt.Sprintf("off for %s, so the daemon has no connection to add forwards to", scope)
+		control.fix = fmt.Sprintf("Add `ControlMaster auto`, `ControlPath /tmp/ssh-%%r@%%h:%%p`, and `ControlPersist 10m` under `%s` in ~/.ssh/config", section)
+	case settings.controlPath == "":
+		control.result = checkFail
+		control.detail = fmt.Sprintf("ControlMaster is %s for %s, but there's no ControlPath", settings.controlMaster, scope)
+		control.fix = fmt.Sprintf("Add `ControlPath /tmp/ssh-%%r@%%h:%%p` under `%s` in ~/.ssh/config", section)
+	default:
+		control.detail = fmt.Sprintf("%s for %s, control socket %s", settings.controlMaster, scope, settings.controlPath)
+	}
+
+	forward := doctorCheck{name: "RemoteForward"}
+	socket := filepath.Base(cfg.Address)
+	if cfg.Network == "tcp" {
+		socket = cfg.Address
+	}
+	found := false
+	for _, rf := range settings.remoteForwards {
+		if strings.HasSuffix(rf, socket) {
+			found = true
+			forward.detail = fmt.Sprintf("%s for %s", rf, scope)
+		}
+	}
+	if !found {
+		forward.result = checkFail
+		forward.detail = fmt.Sprintf("the daemon's socket isn't forwarded for %s, so bankshot on the remote host can't reach it", scope)
+		forward.fix = fmt.Sprintf("Add `RemoteForward ~/.bankshot.sock %s` under `%s` in ~/.ssh/config", cfg.Address, section)
+	}
+
+	checks := []doctorCheck{control, forward}
+	if host != "" && settings.controlPath != "" {
+		checks = append(checks, checkControlSocket(host, settings.controlPath))
+	}
+	return checks
+}
+
+// checkControlSocket checks whether host's ControlMaster is running, and
+// whether its control socket was left behind by one that isn't
+func checkControlSocket(host, controlPath string) doctorCheck {
+	check := doctorCheck{name: "Control socket"}
+	var out bytes.Buffer
+	cmd := exec.Command("ssh", "-O", "check", host)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	output := strings.TrimSpace(out.String())
+	switch {
+	case err == nil:
+		check.detail = fmt.Sprintf("master running for %s", host)
+	case strings.Contains(output, "No such file"):
+		check.result = checkWarn
+		check.detail = fmt.Sprintf("no master running for %s", host)
+		check.fix = fmt.Sprintf("Connect with `ssh %s`; forwards are added to the connection it opens", host)
+	case strings.Contains(output, "Connection refused"):
+		check.result = checkFail
+		check.detail = fmt.Sprintf("%s is stale, so ssh can't start a new master for %s", controlPath, host)
+		check.fix = fmt.Sprintf("Remove it (`rm %s`) and reconnect with `ssh %s`", controlPath, host)
+	default:
+		check.result = checkWarn
+		check.detail = fmt.Sprintf("ssh -O check %s failed: %s", host, output)
+	}
+	return check
+}
+
+// sshSettings is what checkSSHConfig needs from `ssh -G` output
+type sshSettings struct {
+	controlMaster  string
+	controlPath    string
+	remoteForwards []string
+}
+
+// parseSSHSettings parses `ssh -G` output
+func parseSSHSettings(output []byte) sshSettings {
+	var settings sshSettings
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "controlmaster":
+			settings.controlMaster = value
+		case "controlpath":
+			if value != "none" {
+				settings.controlPath = value
+			}
+		case "remoteforward":
+			settings.remoteForwards = append(settings.remoteForwards, value)
+		}
+	}
+	return settings
+}
+
+// probeDaemon asks the daemon at address for its status. It returns an
+// error wrapping os.ErrNotExist when a Unix socket file is missing, and
+// errSocketRefused when nothing listens on it.
+func probeDaemon(address string) (*protocol.StatusResponse, error) {
+	var status protocol.StatusResponse
+	if err := probeStatus(address, protocol.CommandStatus, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// probeMonitor asks the monitor at its control socket for its status, with
+// probeDaemon's errors
+func probeMonitor(path string) (*protocol.MonitorStatusResponse, error) {
+	var status protocol.MonitorStatusResponse
+	if err := probeStatus(path, protocol.CommandMonitorStatus, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// probeStatus sends a request of type command to address and decodes the
+// response's data into status
+func probeStatus(address string, command protocol.CommandType, status interface{}) error {
+	conn, err := dialSocket(address)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	data, err := protocol.MarshalRequest(&protocol.Request{
+		ID:   uuid.New().String(),
+		Type: command,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	var resp protocol.Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("no response: %w", err)
+	}
+	if !resp.Success {
+		return requestFailed(fmt.Errorf("status request failed: %s", resp.Error))
+	}
+	if err := json.Unmarshal(resp.Data, status); err != nil {
+		return fmt.Errorf("failed to parse status: %w", err)
+	}
+	return nil
+}
+
+// probeSocket checks that something listens on the Unix socket at path,
+// with probeDaemon's errors
+func probeSocket(path string) error {
+	conn, err := dialSocket(path)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// dialSocket connects to address, as protocol.Dial reaches it, with
+// doctorTimeout as the deadline
+func dialSocket(address string) (net.Conn, error) {
+	unixSocket := !strings.HasPrefix(address, protocol.ProxyCommandPrefix) && !strings.Contains(address, ":")
+	if unixSocket {
+		if _, err := os.Stat(address); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := protocol.Dial(address, doctorTimeout)
+	if err != nil {
+		if unixSocket && errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, fmt.Errorf("%w: %v", errSocketRefused, err)
+		}
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(doctorTimeout))
+	return conn, nil
+}
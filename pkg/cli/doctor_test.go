@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/phinze/bankshot/pkg/monitor"
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+func TestParseSSHSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   sshSettings
+	}{
+		{
+			name: "bankshot's settings",
+			output: `host devbox
+user me
+controlmaster auto
+controlpath /home/me/.ssh/cm-%C
+remoteforward /home/me/.bankshot.sock:/tmp/bankshot.sock
+remoteforward 8080:localhost:80
+`,
+			want: sshSettings{
+				controlMaster:  "auto",
+				controlPath:    "/home/me/.ssh/cm-%C",
+				remoteForwards: []string{"/home/me/.bankshot.sock:/tmp/bankshot.sock", "8080:localhost:80"},
+			},
+		},
+		{
+			name:   "no control path",
+			output: "controlmaster false\ncontrolpath none\n",
+			want:   sshSettings{controlMaster: "false"},
+		},
+		{
+			name:   "lines without values",
+			output: "controlmaster\n\nuser me\n",
+			want:   sshSettings{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSSHSettings([]byte(tt.output)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSSHSettings() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckEBPFUsesMonitorStatus(t *testing.T) {
+	check := checkEBPF(&protocol.MonitorStatusResponse{Source: monitor.SourceEBPF})
+	if check.result != checkOK {
+		t.Errorf("checkEBPF() with the monitor on eBPF = %+v, want OK", check)
+	}
+
+	check = checkEBPF(&protocol.MonitorStatusResponse{Source: monitor.SourcePoll})
+	if check.result != checkWarn {
+		t.Errorf("checkEBPF() with the monitor polling = %+v, want a warning", check)
+	}
+}
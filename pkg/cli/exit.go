@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes bankshot returns, so scripts can tell failures apart. They're
+// documented in the README and mustn't change meaning.
+const (
+	ExitOK                = 0
+	ExitError             = 1 // Anything not covered below, including bad usage
+	ExitDaemonUnreachable = 2 // Nothing answered on the daemon's socket
+	ExitRequestFailed     = 3 // The daemon answered but turned the request down
+	ExitTimeout           = 4 // Gave up waiting, as for forward --wait
+)
+
+// exitError is an error that sets bankshot's exit code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// ExitCode returns the exit code for an error a command returned
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return ExitError
+}
+
+// requestFailed marks err as the daemon turning a request down
+func requestFailed(err error) error {
+	return &exitError{code: ExitRequestFailed, err: err}
+}
+
+// daemonUnreachable marks err as failing to reach the daemon
+func daemonUnreachable(err error) error {
+	return &exitError{code: ExitDaemonUnreachable, err: err}
+}
+
+// timedOut marks err as giving up after a timeout
+func timedOut(format string, args ...any) error {
+	return &exitError{code: ExitTimeout, err: fmt.Errorf(format, args...)}
+}
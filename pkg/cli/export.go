@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var exportConnection string
+
+func newExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Print the active forwards as YAML",
+		Long: `Prints the daemon's forwards as a YAML forward set that "bankshot import"
+can apply again later, e.g. after a daemon restart or on another machine:
+
+  bankshot export > forwards.yaml
+  bankshot import forwards.yaml
+
+Port ranges are exported as a single entry. Forwards waiting to be retried
+are included. --connection limits the export to one SSH connection.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			payload, err := json.Marshal(protocol.ExportRequest{ConnectionInfo: exportConnection})
+			if err != nil {
+				return fmt.Errorf("failed to marshal request: %w", err)
+			}
+
+			req := protocol.Request{
+				ID:      uuid.New().String(),
+				Type:    protocol.CommandExport,
+				Payload: payload,
+			}
+
+			resp, err := sendRequest(&req)
+			if err != nil {
+				return err
+			}
+
+			if !resp.Success {
+				return requestFailed(fmt.Errorf("failed to export forwards: %s", resp.Error))
+			}
+
+			var set protocol.ForwardSet
+			if err := json.Unmarshal(resp.Data, &set); err != nil {
+				return fmt.Errorf("failed to parse forwards: %w", err)
+			}
+
+			enc := yaml.NewEncoder(os.Stdout)
+			enc.SetIndent(2)
+			if err := enc.Encode(set); err != nil {
+				return fmt.Errorf("failed to write forwards: %w", err)
+			}
+			return enc.Close()
+		},
+	}
+
+	cmd.Flags().StringVarP(&exportConnection, "connection", "c", "", "Only export forwards of this SSH connection")
+
+	return cmd
+}
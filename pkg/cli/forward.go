@@ -3,7 +3,9 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/phinze/bankshot/pkg/protocol"
@@ -11,38 +13,131 @@ import (
 )
 
 var (
-	forwardHost       string
-	forwardConnection string
+	forwardHost         string
+	forwardConnection   string
+	forwardRemoteSocket string
+	forwardLocalSocket  string
+	forwardControlPath  string
+	forwardBindAddress  string
+	forwardName         string
+	forwardConflict     string
+	forwardDryRun       bool
+	forwardWait         bool
+	forwardWaitTimeout  time.Duration
 )
 
+// forwardWaitPoll is how often --wait asks the daemon whether the new
+// forwards reach their remote ends yet
+const forwardWaitPoll = 500 * time.Millisecond
+
 func newForwardCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "forward <remote-port> [local-port]",
-		Short: "Request a port forward",
+		Use:   "forward <remote-port|start-end>[:local-port] ...",
+		Short: "Request port forwards",
 		Long: `Requests the daemon to forward a port from the remote machine to the local machine.
-If local-port is not specified, it defaults to the same as remote-port.`,
-		Args: cobra.RangeArgs(1, 2),
+If local-port is not specified, it defaults to the same as remote-port.
+
+Several ports can be forwarded at once, each succeeding or failing on its own,
+with a table of the results printed at the end:
+
+  bankshot forward 3000 5173 8080
+  bankshot forward 3000:3001 5173
+
+A range such as 3000-3010 forwards every port in it as a group, which can be
+removed together with "bankshot unforward 3000-3010". local-port is then the
+first local port of the range.
+
+With --remote-socket, a Unix socket on the remote machine is forwarded instead
+and the only argument is the local port to expose it on:
+
+  bankshot forward --remote-socket /var/run/docker.sock 2375
+
+With --local-socket, the forward listens on a local Unix socket instead of a
+port and the only argument is the remote port:
+
+  bankshot forward --local-socket ~/.bankshot/.s.PGSQL.5432 5432
+
+Both flags together forward one socket to the other and take no arguments.
+
+--bind-address makes the forward listen on another local address, such as
+0.0.0.0 to share it with machines on your network. The daemon only allows
+non-loopback addresses when forwarder.allow_lan_bind is set.
+
+When several SSH masters are open to the same host (different users or
+ports), --control-socket picks which one carries the forward.
+
+--name gives the forward a name that unforward and list accept in place of
+its ports:
+
+  bankshot forward 8080 --name webapp
+  bankshot unforward webapp
+
+--conflict overrides the daemon's forwarder.port_conflict policy for a busy
+local port: fail, next (next free port), random (any free port), or steal
+(cancel the forward, from any connection, that holds the port). Port ranges
+always follow the configured policy.
+
+--dry-run prints the ssh commands the daemon would run without running them.
+--output json or yaml prints the daemon's response instead of a summary.
+
+--wait blocks until connections to every new forward reach the server on
+the remote end, failing if that takes longer than --wait-timeout, so scripts can go on to
+use it:
+
+  bankshot forward 5432 --wait && psql -h localhost`,
+		Args: cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var remotePort, localPort int
-			if _, err := fmt.Sscanf(args[0], "%d", &remotePort); err != nil {
-				return fmt.Errorf("invalid remote port: %s", args[0])
+			if forwardWait && forwardDryRun {
+				return fmt.Errorf("--wait cannot be used with --dry-run")
+			}
+			structured, err := structuredOutput()
+			if err != nil {
+				return err
 			}
 
-			if len(args) > 1 {
-				if _, err := fmt.Sscanf(args[1], "%d", &localPort); err != nil {
-					return fmt.Errorf("invalid local port: %s", args[1])
+			var remotePort, remotePortEnd, localPort int
+			switch {
+			case forwardRemoteSocket != "" && forwardLocalSocket != "":
+				if len(args) != 0 {
+					return fmt.Errorf("--remote-socket with --local-socket takes no arguments")
+				}
+			case forwardLocalSocket != "":
+				if len(args) != 1 {
+					return fmt.Errorf("--local-socket takes exactly one argument: <remote-port>")
+				}
+				if _, err := fmt.Sscanf(args[0], "%d", &remotePort); err != nil {
+					return fmt.Errorf("invalid remote port: %s", args[0])
+				}
+			case forwardRemoteSocket != "":
+				if len(args) != 1 {
+					return fmt.Errorf("--remote-socket takes exactly one argument: <local-port>")
+				}
+				if _, err := fmt.Sscanf(args[0], "%d", &localPort); err != nil {
+					return fmt.Errorf("invalid local port: %s", args[0])
+				}
+			default:
+				if len(args) == 0 {
+					return fmt.Errorf("requires a <remote-port> argument")
+				}
+				if len(args) > 1 {
+					return forwardBatch(args, structured)
 				}
-			} else {
-				localPort = remotePort
-			}
 
-			connectionInfo := forwardConnection
-			if connectionInfo == "" {
-				hostname, err := os.Hostname()
+				remotePort, remotePortEnd, localPort, err = parseForwardSpec(args[0])
 				if err != nil {
-					return fmt.Errorf("failed to get hostname: %w", err)
+					return err
+				}
+				if remotePortEnd != 0 && forwardName != "" {
+					return fmt.Errorf("--name cannot be used with a port range")
 				}
-				connectionInfo = hostname
+				if remotePortEnd != 0 && forwardConflict != "" {
+					return fmt.Errorf("--conflict cannot be used with a port range")
+				}
+			}
+
+			connectionInfo, err := forwardConnectionInfo()
+			if err != nil {
+				return err
 			}
 
 			host := forwardHost
@@ -52,9 +147,18 @@ If local-port is not specified, it defaults to the same as remote-port.`,
 
 			forwardReq := protocol.ForwardRequest{
 				RemotePort:     remotePort,
+				RemotePortEnd:  remotePortEnd,
 				LocalPort:      localPort,
 				Host:           host,
+				RemoteSocket:   forwardRemoteSocket,
+				LocalSocket:    forwardLocalSocket,
 				ConnectionInfo: connectionInfo,
+				SocketPath:     forwardControlPath,
+				BindAddress:    forwardBindAddress,
+				Name:           forwardName,
+				Owner:          protocol.OwnerCLI,
+				Conflict:       forwardConflict,
+				DryRun:         forwardDryRun,
 			}
 
 			payload, err := json.Marshal(forwardReq)
@@ -74,18 +178,337 @@ If local-port is not specified, it defaults to the same as remote-port.`,
 			}
 
 			if !resp.Success {
-				return fmt.Errorf("failed to create forward: %s", resp.Error)
+				return requestFailed(fmt.Errorf("failed to create forward: %s", resp.Error))
+			}
+
+			if forwardDryRun {
+				return printDryRun(resp.Data)
+			}
+
+			if structured {
+				var fwdResp protocol.ForwardResponse
+				if err := json.Unmarshal(resp.Data, &fwdResp); err != nil {
+					return fmt.Errorf("failed to parse response: %w", err)
+				}
+				if err := printStructured(stdout, fwdResp); err != nil {
+					return err
+				}
+			} else {
+				printForwardResult(resp.Data, remotePort, remotePortEnd, localPort)
 			}
 
-			if verbose {
-				fmt.Printf("Port forward created: %d -> %d\n", remotePort, localPort)
+			if forwardWait {
+				return waitForForwards([]protocol.ForwardRequest{forwardReq}, forwardWaitTimeout)
 			}
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVarP(&forwardHost, "host", "H", "localhost", "Remote host to forward from")
-	cmd.Flags().StringVarP(&forwardConnection, "connection", "c", "", "SSH connection identifier (e.g., hostname used in ssh command)")
+	cmd.Flags().StringVarP(&forwardConnection, "connection", "c", "", "SSH connection identifier (e.g., hostname used in ssh command; default: this SSH session's)")
+	_ = cmd.RegisterFlagCompletionFunc("connection", completeConnections)
+	cmd.Flags().StringVar(&forwardRemoteSocket, "remote-socket", "", "Forward this remote Unix socket path instead of a port")
+	cmd.Flags().StringVarP(&forwardControlPath, "control-socket", "S", "", "SSH control socket to forward through (default: resolved from the connection)")
+	cmd.Flags().StringVar(&forwardBindAddress, "bind-address", "", "Local address to listen on (e.g. 0.0.0.0 to share on the LAN)")
+	cmd.Flags().StringVar(&forwardLocalSocket, "local-socket", "", "Listen on this local Unix socket path instead of a port")
+	cmd.Flags().BoolVar(&forwardDryRun, "dry-run", false, "Show the ssh commands that would run without running them")
+	cmd.Flags().StringVar(&forwardName, "name", "", "Name the forward so unforward and list can refer to it by name")
+	cmd.Flags().StringVar(&forwardConflict, "conflict", "", "Policy when the local port is busy: "+protocol.ConflictPolicyNames()+" (default: daemon config)")
+	cmd.Flags().BoolVar(&forwardWait, "wait", false, "Wait until the forward reaches the server on the remote end")
+	cmd.Flags().DurationVar(&forwardWaitTimeout, "wait-timeout", 30*time.Second, "How long --wait waits before failing")
 
 	return cmd
 }
+
+// printForwardResult reports how a forward request turned out when it
+// wasn't simply forwarded as asked
+func printForwardResult(data []byte, remotePort, remotePortEnd, localPort int) {
+	var fwdResp protocol.ForwardResponse
+	if err := json.Unmarshal(data, &fwdResp); err == nil {
+		// The daemon retries forwards ssh rejected in the background
+		if fwdResp.Queued {
+			fmt.Fprintln(stdout, fwdResp.Message)
+			return
+		}
+
+		if remotePortEnd != 0 {
+			printRangeResult(remotePort, localPort, fwdResp.LocalPorts)
+			return
+		}
+
+		// Report how a busy local port was handled: the daemon may have
+		// taken it over from another forward or picked an alternate
+		if c := fwdResp.Conflict; c != nil && c.Stolen != "" {
+			fmt.Fprintf(stdout, "Local port %d was held by %s; cancelled it and forwarded %s -> %d\n",
+				c.RequestedPort, c.Stolen, remoteTarget(remotePort, forwardRemoteSocket), c.LocalPort)
+			return
+		}
+		if forwardLocalSocket == "" && fwdResp.LocalPort != 0 && fwdResp.LocalPort != localPort {
+			fmt.Fprintf(stdout, "Local port %d in use, forwarded %s -> %d\n", localPort, remoteTarget(remotePort, forwardRemoteSocket), fwdResp.LocalPort)
+			return
+		}
+	}
+
+	if verbose {
+		local := strconv.Itoa(localPort)
+		if forwardLocalSocket != "" {
+			local = forwardLocalSocket
+		}
+		fmt.Fprintf(stdout, "Port forward created: %s -> %s\n", remoteTarget(remotePort, forwardRemoteSocket), local)
+	}
+}
+
+// forwardConnectionInfo returns the connection to forward through: --connection,
+// or this host's name
+func forwardConnectionInfo() (string, error) {
+	if forwardConnection != "" {
+		return forwardConnection, nil
+	}
+	return defaultConnection()
+}
+
+// parseForwardSpec parses a port or range to forward, optionally followed by
+// the local port to forward it to: "3000", "3000:3001", "3000-3010:4000".
+// local defaults to start.
+func parseForwardSpec(s string) (start, end, local int, err error) {
+	remote, localStr, hasLocal := strings.Cut(s, ":")
+	start, end, err = parsePortRange(remote)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if !hasLocal {
+		return start, end, start, nil
+	}
+	local, err = strconv.Atoi(localStr)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid local port: %s", localStr)
+	}
+	return start, end, local, nil
+}
+
+// forwardBatch forwards each of specs in one request and prints a table of
+// how each port fared
+func forwardBatch(specs []string, structured bool) error {
+	switch {
+	case forwardName != "":
+		return fmt.Errorf("--name cannot be used with several ports")
+	case forwardDryRun:
+		return fmt.Errorf("--dry-run cannot be used with several ports")
+	}
+
+	connectionInfo, err := forwardConnectionInfo()
+	if err != nil {
+		return err
+	}
+	host := forwardHost
+	if host == "" {
+		host = "localhost"
+	}
+
+	batch := protocol.ForwardBatchRequest{}
+	for _, spec := range specs {
+		remotePort, remotePortEnd, localPort, err := parseForwardSpec(spec)
+		if err != nil {
+			return err
+		}
+		if remotePortEnd != 0 && forwardConflict != "" {
+			return fmt.Errorf("--conflict cannot be used with a port range")
+		}
+		batch.Forwards = append(batch.Forwards, protocol.ForwardRequest{
+			RemotePort:     remotePort,
+			RemotePortEnd:  remotePortEnd,
+			LocalPort:      localPort,
+			Host:           host,
+			ConnectionInfo: connectionInfo,
+			SocketPath:     forwardControlPath,
+			BindAddress:    forwardBindAddress,
+			Owner:          protocol.OwnerCLI,
+			Conflict:       forwardConflict,
+		})
+	}
+
+	return sendForwardBatch(batch, structured)
+}
+
+// sendForwardBatch requests the forwards of batch and prints how each port
+// fared, as a table or as --output asks
+func sendForwardBatch(batch protocol.ForwardBatchRequest, structured bool) error {
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := sendRequest(&protocol.Request{
+		ID:      uuid.New().String(),
+		Type:    protocol.CommandForwardBatch,
+		Payload: payload,
+	})
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return requestFailed(fmt.Errorf("failed to create forwards: %s", resp.Error))
+	}
+
+	var result protocol.ForwardBatchResponse
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if structured {
+		if err := printStructured(stdout, result); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(stdout, "%-7s  %-7s  %s\n", "REMOTE", "LOCAL", "RESULT")
+	}
+	failed := 0
+	for i, r := range result.Results {
+		if i >= len(batch.Forwards) {
+			break
+		}
+		if r.Error != "" {
+			failed++
+		}
+		if structured {
+			continue
+		}
+		for _, row := range batchRows(batch.Forwards[i], r) {
+			fmt.Fprintf(stdout, "%-7d  %-7s  %s\n", row.remote, row.local, row.result)
+		}
+	}
+
+	if failed > 0 {
+		return requestFailed(fmt.Errorf("%d of %d forwards failed", failed, len(result.Results)))
+	}
+	if forwardWait {
+		return waitForForwards(batch.Forwards, forwardWaitTimeout)
+	}
+	return nil
+}
+
+// waitForForwards polls the daemon until connections to every forward
+// requested reach the remote end, or fails once timeout has passed. ssh's
+// listener accepts connections before anything is listening on the remote
+// end, so the local end accepting them isn't enough.
+func waitForForwards(requested []protocol.ForwardRequest, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var list protocol.ListResponse
+		err := queryDaemon(protocol.CommandList, protocol.ListRequest{CheckReachable: true}, &list)
+		var pending []string
+		if err == nil {
+			pending = pendingForwards(requested, list.Forwards)
+			if len(pending) == 0 {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("failed to check forwards: %w", err)
+			}
+			return timedOut("%s not reachable after %s", strings.Join(pending, ", "), timeout)
+		}
+		time.Sleep(forwardWaitPoll)
+	}
+}
+
+// pendingForwards describes the remote ends of the requested forwards that
+// have no forward in active reaching them
+func pendingForwards(requested []protocol.ForwardRequest, active []protocol.ForwardInfo) []string {
+	up := func(match func(protocol.ForwardInfo) bool) bool {
+		for _, fw := range active {
+			if match(fw) && fw.Healthy != nil && *fw.Healthy {
+				return true
+			}
+		}
+		return false
+	}
+
+	var pending []string
+	for _, req := range requested {
+		if req.RemoteSocket != "" {
+			if !up(func(fw protocol.ForwardInfo) bool {
+				return fw.ConnectionInfo == req.ConnectionInfo && fw.RemoteSocket == req.RemoteSocket
+			}) {
+				pending = append(pending, req.RemoteSocket)
+			}
+			continue
+		}
+
+		end := max(req.RemotePortEnd, req.RemotePort)
+		for port := req.RemotePort; port <= end; port++ {
+			if !up(func(fw protocol.ForwardInfo) bool {
+				return fw.ConnectionInfo == req.ConnectionInfo && fw.Host == req.Host &&
+					fw.RemoteSocket == "" && fw.RemotePort == port
+			}) {
+				pending = append(pending, strconv.Itoa(port))
+			}
+		}
+	}
+	return pending
+}
+
+// batchRow is one port's line of the forward batch table
+type batchRow struct {
+	remote int
+	local  string
+	result string
+}
+
+// batchRows describes how each port of one forward of a batch fared
+func batchRows(req protocol.ForwardRequest, r protocol.ForwardBatchResult) []batchRow {
+	end := req.RemotePortEnd
+	if end == 0 {
+		end = req.RemotePort
+	}
+
+	var rows []batchRow
+	for port := req.RemotePort; port <= end; port++ {
+		want := req.LocalPort + port - req.RemotePort
+		row := batchRow{remote: port, local: strconv.Itoa(want), result: "forwarded"}
+
+		switch {
+		case r.Error != "":
+			row.local = "-"
+			row.result = "failed: " + r.Error
+		case r.Result == nil:
+		case r.Result.Queued:
+			row.result = "queued for retry"
+		case req.RemotePortEnd != 0:
+			// Each port of a range has its own local port, 0 while the
+			// daemon retries it
+			got := 0
+			if i := port - req.RemotePort; i < len(r.Result.LocalPorts) {
+				got = r.Result.LocalPorts[i]
+			}
+			row.local, row.result = batchResult(want, got, r.Result.Existing)
+		case r.Result.Conflict != nil && r.Result.Conflict.Stolen != "":
+			row.local = strconv.Itoa(r.Result.Conflict.LocalPort)
+			row.result = "taken over from " + r.Result.Conflict.Stolen
+		default:
+			got := r.Result.LocalPort
+			if got == 0 {
+				got = want
+			}
+			row.local, row.result = batchResult(want, got, r.Result.Existing)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// batchResult describes a port forwarded to local port got when want was
+// asked for, returning the local port to show and the result
+func batchResult(want, got int, existing bool) (string, string) {
+	switch {
+	case got == 0:
+		return strconv.Itoa(want), "queued for retry"
+	case existing:
+		return strconv.Itoa(got), "already forwarded"
+	case got != want:
+		return strconv.Itoa(got), fmt.Sprintf("forwarded, local port %d in use", want)
+	}
+	return strconv.Itoa(got), "forwarded"
+}
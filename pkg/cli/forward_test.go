@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+func TestParseForwardSpec(t *testing.T) {
+	tests := []struct {
+		spec              string
+		start, end, local int
+		wantErr           bool
+	}{
+		{spec: "3000", start: 3000, local: 3000},
+		{spec: "3000:3001", start: 3000, local: 3001},
+		{spec: "3000-3010", start: 3000, end: 3010, local: 3000},
+		{spec: "3000-3010:4000", start: 3000, end: 3010, local: 4000},
+		{spec: "3000:web", wantErr: true},
+		{spec: "web", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		start, end, local, err := parseForwardSpec(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseForwardSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if start != tt.start || end != tt.end || local != tt.local {
+			t.Errorf("parseForwardSpec(%q) = %d, %d, %d, want %d, %d, %d", tt.spec, start, end, local, tt.start, tt.end, tt.local)
+		}
+	}
+}
+
+func TestBatchRows(t *testing.T) {
+	single := protocol.ForwardRequest{RemotePort: 3000, LocalPort: 3000}
+	rng := protocol.ForwardRequest{RemotePort: 3000, RemotePortEnd: 3002, LocalPort: 4000}
+
+	tests := []struct {
+		name   string
+		req    protocol.ForwardRequest
+		result protocol.ForwardBatchResult
+		want   []batchRow
+	}{
+		{
+			name:   "forwarded",
+			req:    single,
+			result: protocol.ForwardBatchResult{Result: &protocol.ForwardResponse{LocalPort: 3000}},
+			want:   []batchRow{{3000, "3000", "forwarded"}},
+		},
+		{
+			name:   "already forwarded",
+			req:    single,
+			result: protocol.ForwardBatchResult{Result: &protocol.ForwardResponse{LocalPort: 3000, Existing: true}},
+			want:   []batchRow{{3000, "3000", "already forwarded"}},
+		},
+		{
+			name:   "local port in use",
+			req:    single,
+			result: protocol.ForwardBatchResult{Result: &protocol.ForwardResponse{LocalPort: 3001}},
+			want:   []batchRow{{3000, "3001", "forwarded, local port 3000 in use"}},
+		},
+		{
+			name:   "queued",
+			req:    single,
+			result: protocol.ForwardBatchResult{Result: &protocol.ForwardResponse{LocalPort: 3000, Queued: true}},
+			want:   []batchRow{{3000, "3000", "queued for retry"}},
+		},
+		{
+			name:   "taken over",
+			req:    single,
+			result: protocol.ForwardBatchResult{Result: &protocol.ForwardResponse{LocalPort: 3000, Conflict: &protocol.ConflictDecision{LocalPort: 3000, Stolen: "devbox:8080"}}},
+			want:   []batchRow{{3000, "3000", "taken over from devbox:8080"}},
+		},
+		{
+			name:   "failed",
+			req:    single,
+			result: protocol.ForwardBatchResult{Error: "port in use"},
+			want:   []batchRow{{3000, "-", "failed: port in use"}},
+		},
+		{
+			name:   "range with a queued port",
+			req:    rng,
+			result: protocol.ForwardBatchResult{Result: &protocol.ForwardResponse{LocalPort: 4000, LocalPorts: []int{4000, 0, 4005}}},
+			want: []batchRow{
+				{3000, "4000", "forwarded"},
+				{3001, "4001", "queued for retry"},
+				{3002, "4005", "forwarded, local port 4002 in use"},
+			},
+		},
+		{
+			name:   "range already forwarded",
+			req:    rng,
+			result: protocol.ForwardBatchResult{Result: &protocol.ForwardResponse{LocalPort: 4000, LocalPorts: []int{4000, 4001, 4002}, Existing: true}},
+			want: []batchRow{
+				{3000, "4000", "already forwarded"},
+				{3001, "4001", "already forwarded"},
+				{3002, "4002", "already forwarded"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := batchRows(tt.req, tt.result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batchRows() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
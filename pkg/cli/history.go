@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+func newHistoryCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "history [text]",
+		Short: "Show recent open requests",
+		Long: `Shows URLs recently opened through the daemon, along with the connection
+and process that requested each one and per-connection usage for the last hour.
+Given text, only the URLs containing it are shown.
+
+Each open is numbered, most recent first, for bankshot reopen.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := protocol.Request{
+				ID:   uuid.New().String(),
+				Type: protocol.CommandHistory,
+			}
+
+			resp, err := sendRequest(&req)
+			if err != nil {
+				return err
+			}
+
+			if !resp.Success {
+				return requestFailed(fmt.Errorf("failed to get history: %s", resp.Error))
+			}
+
+			var hist protocol.HistoryResponse
+			if err := json.Unmarshal(resp.Data, &hist); err != nil {
+				return fmt.Errorf("failed to parse history: %w", err)
+			}
+
+			if len(hist.Entries) == 0 {
+				fmt.Fprintln(stdout, "No open requests recorded")
+				return nil
+			}
+
+			var match string
+			if len(args) == 1 {
+				match = args[0]
+			}
+
+			fmt.Fprintln(stdout, "Open History:")
+			for i, e := range hist.Entries {
+				if !strings.Contains(e.URL, match) {
+					continue
+				}
+				number := len(hist.Entries) - i
+				source := e.ConnectionInfo
+				if source == "" {
+					source = "unknown"
+				}
+				if e.ProcessName != "" {
+					source += "/" + e.ProcessName
+				}
+
+				if e.Denied {
+					fmt.Fprintf(stdout, "  %3d  %s  %s  %s (denied: %s)\n", number, e.OpenedAt, source, e.URL, e.Reason)
+				} else {
+					fmt.Fprintf(stdout, "  %3d  %s  %s  %s\n", number, e.OpenedAt, source, e.URL)
+				}
+			}
+
+			if len(hist.HourlyCount) > 0 {
+				fmt.Fprintf(stdout, "\nOpens in the Last Hour:\n")
+				conns := make([]string, 0, len(hist.HourlyCount))
+				for conn := range hist.HourlyCount {
+					conns = append(conns, conn)
+				}
+				sort.Strings(conns)
+				for _, conn := range conns {
+					count := hist.HourlyCount[conn]
+					if conn == "" {
+						conn = "unknown"
+					}
+					if hist.HourlyLimit > 0 {
+						fmt.Fprintf(stdout, "  %s: %d/%d\n", conn, count, hist.HourlyLimit)
+					} else {
+						fmt.Fprintf(stdout, "  %s: %d\n", conn, count)
+					}
+				}
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var importConnection string
+
+func newImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <file|->",
+		Short: "Establish the forwards in a YAML forward set",
+		Long: `Reads a forward set written by "bankshot export" (or by hand) and asks the
+daemon to establish each forward in it. Pass - to read from stdin.
+
+Forwards that already exist are left alone, so importing the same set twice
+is harmless. Each entry succeeds or fails on its own; the command fails if
+any of them did.
+
+--connection applies every forward to the given SSH connection instead of
+the one it was exported from, which helps when moving a set to a new
+machine. Forwards pinned to a control socket of their old connection go
+through the new connection's own socket instead.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var data []byte
+			var err error
+			if args[0] == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read forward set: %w", err)
+			}
+
+			var set protocol.ForwardSet
+			if err := yaml.Unmarshal(data, &set); err != nil {
+				return fmt.Errorf("failed to parse forward set: %w", err)
+			}
+			if len(set.Forwards) == 0 {
+				fmt.Fprintln(stdout, "No forwards to import")
+				return nil
+			}
+
+			payload, err := json.Marshal(protocol.ImportRequest{
+				ForwardSet:     set,
+				ConnectionInfo: importConnection,
+				Owner:          protocol.OwnerCLI,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to marshal request: %w", err)
+			}
+
+			req := protocol.Request{
+				ID:      uuid.New().String(),
+				Type:    protocol.CommandImport,
+				Payload: payload,
+			}
+
+			resp, err := sendRequest(&req)
+			if err != nil {
+				return err
+			}
+
+			if !resp.Success {
+				return requestFailed(fmt.Errorf("failed to import forwards: %s", resp.Error))
+			}
+
+			var result protocol.ImportResponse
+			if err := json.Unmarshal(resp.Data, &result); err != nil {
+				return fmt.Errorf("failed to parse response: %w", err)
+			}
+
+			if failed := printImportResults(result.Results); failed > 0 {
+				return fmt.Errorf("%d of %d forwards failed to import", failed, len(result.Results))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&importConnection, "connection", "c", "", "Apply every forward to this SSH connection")
+
+	return cmd
+}
+
+// printImportResults reports how each forward of an import fared, returning
+// how many failed
+func printImportResults(results []protocol.ImportResult) int {
+	failed := 0
+	for _, r := range results {
+		remote := specTarget(r.Forward)
+		switch {
+		case r.Error != "":
+			failed++
+			fmt.Fprintf(stdout, "%s: %s\n", remote, r.Error)
+		case r.Result != nil:
+			fmt.Fprintf(stdout, "%s: %s\n", remote, r.Result.Message)
+		}
+	}
+	return failed
+}
+
+// specTarget describes the remote end of a saved forward for messages
+func specTarget(spec protocol.ForwardSpec) string {
+	if spec.RemoteSocket != "" {
+		return spec.RemoteSocket
+	}
+	host := spec.Host
+	if host == "" {
+		host = "localhost"
+	}
+	ports := strconv.Itoa(spec.RemotePort)
+	if spec.RemotePortEnd != 0 {
+		ports = fmt.Sprintf("%d-%d", spec.RemotePort, spec.RemotePortEnd)
+	}
+	return net.JoinHostPort(protocol.NormalizeHost(host), ports)
+}
@@ -0,0 +1,470 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/phinze/bankshot/pkg/config"
+	"github.com/phinze/bankshot/pkg/forwarder"
+	"github.com/spf13/cobra"
+)
+
+// Lines bracketing what bankshot install adds to files it doesn't own, so a
+// later install replaces it and uninstall finds it
+const (
+	installBegin = "# >>> bankshot >>>"
+	installEnd   = "# <<< bankshot <<<"
+)
+
+// launchdLabel names the daemon's launchd agent, as in docs/INSTALL.md
+const launchdLabel = "com.github.phinze.bankshot"
+
+// installTarget is a file bankshot install writes
+type installTarget struct {
+	path    string
+	content string      // The whole file, or the block to add to a shared one
+	shared  bool        // The user's own file; only the marked block is bankshot's
+	mode    fs.FileMode // For a file that doesn't exist yet
+}
+
+// installPlan is what bankshot install sets up on this machine
+type installPlan struct {
+	targets []installTarget
+	enable  [][]string // Commands that start the service once its file is written
+	disable [][]string // Commands that stop the service before it's removed
+	notes   []string   // What was left out, and why
+}
+
+func newInstallCmd() *cobra.Command {
+	var dryRun, remote bool
+
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Set up the bankshot service, ssh_config, and shell aliases",
+		Long: `Sets bankshot up on this machine. On the laptop, that's a service running
+bankshotd (a launchd agent on macOS, a systemd user unit on Linux) and a
+Host * block in ~/.ssh/config with ControlMaster and the RemoteForward of the
+daemon's socket. On the remote host, it's a systemd user unit running
+bankshot monitor, and open and xdg-open aliases for bankshot open in your
+shell's startup file.
+
+Running it again brings everything up to date without adding anything twice,
+and --dry-run shows the changes as a diff without making them. bankshot
+uninstall takes them back out.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plan, err := buildInstallPlan(remote, true)
+			if err != nil {
+				return err
+			}
+			for _, note := range plan.notes {
+				fmt.Fprintln(stdout, note)
+			}
+			for _, target := range plan.targets {
+				if err := target.apply(true, dryRun); err != nil {
+					return err
+				}
+			}
+			for _, args := range plan.enable {
+				if err := runInstallCommand(args, dryRun); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	addInstallFlags(cmd, &dryRun, &remote)
+	return cmd
+}
+
+func newUninstallCmd() *cobra.Command {
+	var dryRun, remote bool
+
+	cmd := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove what bankshot install set up",
+		Long: `Stops and removes the service bankshot install set up, and takes its
+blocks back out of ~/.ssh/config and your shell's startup file. The rest of
+those files is left alone.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plan, err := buildInstallPlan(remote, false)
+			if err != nil {
+				return err
+			}
+			for _, args := range plan.disable {
+				if err := runInstallCommand(args, dryRun); err != nil {
+					// Most likely it was never started
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+			}
+			for _, target := range plan.targets {
+				if err := target.apply(false, dryRun); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	addInstallFlags(cmd, &dryRun, &remote)
+	return cmd
+}
+
+func addInstallFlags(cmd *cobra.Command, dryRun, remote *bool) {
+	cmd.Flags().BoolVarP(dryRun, "dry-run", "n", false, "Show the changes as a diff instead of making them")
+	cmd.Flags().BoolVar(remote, "remote", os.Getenv("SSH_CONNECTION") != "", "Set up the remote end instead of the laptop (default: whether this is an SSH session)")
+}
+
+// buildInstallPlan works out the files and commands for the laptop, or the
+// remote host with remote. Without install, the plan is only for taking
+// them out again, so a missing bankshotd or a config that doesn't load
+// doesn't stop it.
+func buildInstallPlan(remote, install bool) (*installPlan, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find home directory: %w", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the bankshot executable: %w", err)
+	}
+
+	plan := &installPlan{}
+	if remote {
+		if runtime.GOOS == "linux" {
+			plan.addSystemdUnit(home, "bankshot-monitor.service", fmt.Sprintf(`[Unit]
+Description=Bankshot monitor - automatic port forwarding
+Documentation=https://github.com/phinze/bankshot
+After=network.target
+
+[Service]
+Type=notify
+ExecStart=%s monitor run --systemd
+Restart=on-failure
+RestartSec=5s
+
+[Install]
+WantedBy=default.target
+`, exe))
+		} else {
+			plan.notes = append(plan.notes, fmt.Sprintf("Skipping the monitor service, which bankshot install only sets up on Linux (this is %s)", runtime.GOOS))
+		}
+
+		open := shellQuote(shellQuote(exe) + " open")
+		plan.targets = append(plan.targets, installTarget{
+			path:    shellStartupFile(home),
+			content: fmt.Sprintf("alias open=%s\nalias xdg-open=%s\n", open, open),
+			shared:  true,
+			mode:    0o644,
+		})
+		return plan, nil
+	}
+
+	cfg, err := config.Load("")
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		if install {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+		cfg = config.DefaultConfig()
+	}
+
+	daemonExe := filepath.Join(filepath.Dir(exe), "bankshotd")
+	if _, err := os.Stat(daemonExe); err != nil {
+		if daemonExe, err = exec.LookPath("bankshotd"); err != nil {
+			if install {
+				return nil, fmt.Errorf("bankshotd not found next to bankshot or in PATH")
+			}
+			daemonExe = "bankshotd"
+		}
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		agents := filepath.Join(home, "Library", "LaunchAgents")
+		if _, err := os.Stat(filepath.Join(agents, "homebrew.mxcl.bankshot.plist")); err == nil {
+			plan.notes = append(plan.notes, "Skipping the launchd agent, `brew services` already runs bankshotd")
+			break
+		}
+		plist := filepath.Join(agents, launchdLabel+".plist")
+		logs := filepath.Join(home, "Library", "Logs")
+		plan.targets = append(plan.targets, installTarget{
+			path: plist,
+			content: fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+    <key>Label</key>
+    <string>%s</string>
+    <key>ProgramArguments</key>
+    <array>
+        <string>%s</string>
+    </array>
+    <key>RunAtLoad</key>
+    <true/>
+    <key>KeepAlive</key>
+    <true/>
+    <key>StandardOutPath</key>
+    <string>%s</string>
+    <key>StandardErrorPath</key>
+    <string>%s</string>
+</dict>
+</plist>
+`, launchdLabel, daemonExe, filepath.Join(logs, "bankshotd.log"), filepath.Join(logs, "bankshotd.error.log")),
+			mode: 0o644,
+		})
+		plan.enable = append(plan.enable, []string{"launchctl", "load", "-w", plist})
+		plan.disable = append(plan.disable, []string{"launchctl", "unload", "-w", plist})
+	case "linux":
+		plan.addSystemdUnit(home, "bankshotd.service", fmt.Sprintf(`[Unit]
+Description=Bankshot daemon - opens URLs and forwards ports from remote SSH sessions
+Documentation=https://github.com/phinze/bankshot
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+RestartSec=5s
+# Leave forwards' tsh processes for the restarted daemon to adopt
+KillMode=process
+
+[Install]
+WantedBy=default.target
+`, daemonExe))
+	default:
+		plan.notes = append(plan.notes, fmt.Sprintf("Skipping the daemon service, which bankshot install doesn't know how to set up on %s", runtime.GOOS))
+	}
+
+	plan.targets = append(plan.targets, installTarget{
+		path: filepath.Join(home, ".ssh", "config"),
+		content: fmt.Sprintf(`Host *
+    ControlMaster auto
+    ControlPath %s
+    ControlPersist 10m
+    RemoteForward ~/.bankshot.sock %s
+`, forwarder.DefaultControlPath, cfg.Address),
+		shared: true,
+		mode:   0o600,
+	})
+
+	return plan, nil
+}
+
+// addSystemdUnit adds a systemd user unit and the commands that start and
+// stop it
+func (p *installPlan) addSystemdUnit(home, name, unit string) {
+	p.targets = append(p.targets, installTarget{
+		path:    filepath.Join(home, ".config", "systemd", "user", name),
+		content: unit,
+		mode:    0o644,
+	})
+	p.enable = append(p.enable,
+		[]string{"systemctl", "--user", "daemon-reload"},
+		[]string{"systemctl", "--user", "enable", "--now", name},
+	)
+	p.disable = append(p.disable, []string{"systemctl", "--user", "disable", "--now", name})
+}
+
+// shellStartupFile picks the startup file of the user's login shell
+func shellStartupFile(home string) string {
+	switch filepath.Base(os.Getenv("SHELL")) {
+	case "zsh":
+		return filepath.Join(home, ".zshrc")
+	case "bash":
+		return filepath.Join(home, ".bashrc")
+	default:
+		return filepath.Join(home, ".profile")
+	}
+}
+
+// apply installs or, without install, removes t, showing the change as a
+// diff instead with dryRun
+func (t installTarget) apply(install, dryRun bool) error {
+	data, err := os.ReadFile(t.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", t.path, err)
+	}
+	exists := err == nil
+	before := string(data)
+
+	after := ""
+	switch {
+	case t.shared:
+		after = removeInstallBlock(before)
+		if install {
+			if after != "" {
+				after = strings.TrimRight(after, "\n") + "\n\n"
+			}
+			after += installBegin + "\n" + t.content + installEnd + "\n"
+		}
+	case install:
+		after = t.content
+	}
+
+	remove := !install && !t.shared
+	changed := after != before
+	if remove {
+		changed = exists
+	}
+	if !changed {
+		if install {
+			fmt.Fprintf(stdout, "%s is up to date\n", t.path)
+		}
+		return nil
+	}
+
+	if dryRun {
+		fmt.Fprint(stdout, fileDiff(t.path, before, after, exists, !remove))
+		return nil
+	}
+
+	if remove {
+		if err := os.Remove(t.path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", t.path, err)
+		}
+		fmt.Fprintf(stdout, "Removed %s\n", t.path)
+		return nil
+	}
+
+	mode := t.mode
+	if info, err := os.Stat(t.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(t.path), err)
+	}
+	if err := replaceFile(t.path, []byte(after), mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", t.path, err)
+	}
+	fmt.Fprintf(stdout, "Updated %s\n", t.path)
+	return nil
+}
+
+// replaceFile writes data to a temporary file next to path and renames it
+// over path, so a failed write leaves the old file whole. A symlink at path,
+// as dotfile managers leave, is followed rather than replaced.
+func replaceFile(path string, data []byte, mode fs.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".new-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeInstallBlock takes the block bankshot install added, and the blank
+// line it put before it, out of contents
+func removeInstallBlock(contents string) string {
+	lines := strings.SplitAfter(contents, "\n")
+	begin, end := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case installBegin:
+			begin = i
+		case installEnd:
+			if begin >= 0 {
+				end = i
+			}
+		}
+		if end >= 0 {
+			break
+		}
+	}
+	if begin < 0 || end < 0 {
+		return contents
+	}
+	if begin > 0 && strings.TrimSpace(lines[begin-1]) == "" {
+		begin--
+	}
+	return strings.Join(append(lines[:begin], lines[end+1:]...), "")
+}
+
+// fileDiff shows the change from before to after as a unified diff with one
+// hunk, which is all install's changes need
+func fileDiff(path, before, after string, existed, exists bool) string {
+	from, to := path, path
+	if !existed {
+		from = "/dev/null"
+	}
+	if !exists {
+		to = "/dev/null"
+	}
+
+	a, b := diffLines(before), diffLines(after)
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	removed, added := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", from, to)
+	fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(prefix, len(removed)), hunkRange(prefix, len(added)))
+	for _, line := range removed {
+		sb.WriteString("-" + line + "\n")
+	}
+	for _, line := range added {
+		sb.WriteString("+" + line + "\n")
+	}
+	return sb.String()
+}
+
+// diffLines splits s into lines without their newlines
+func diffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// hunkRange formats a hunk's range of count lines after the first skip
+func hunkRange(skip, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", skip)
+	}
+	return fmt.Sprintf("%d,%d", skip+1, count)
+}
+
+// runInstallCommand runs args, or just shows it with dryRun
+func runInstallCommand(args []string, dryRun bool) error {
+	if dryRun {
+		fmt.Fprintf(stdout, "$ %s\n", strings.Join(args, " "))
+		return nil
+	}
+	output, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveInstallBlock(t *testing.T) {
+	block := installBegin + "\nHost *\n    ControlMaster auto\n" + installEnd + "\n"
+
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{
+			name:     "no block",
+			contents: "Host devbox\n    User me\n",
+			want:     "Host devbox\n    User me\n",
+		},
+		{
+			name:     "only the block",
+			contents: block,
+			want:     "",
+		},
+		{
+			name:     "block after the user's own lines",
+			contents: "Host devbox\n    User me\n\n" + block,
+			want:     "Host devbox\n    User me\n",
+		},
+		{
+			name:     "block between the user's own lines",
+			contents: "Host devbox\n\n" + block + "Host other\n",
+			want:     "Host devbox\nHost other\n",
+		},
+		{
+			name:     "no end marker",
+			contents: "Host devbox\n" + installBegin + "\nHost *\n",
+			want:     "Host devbox\n" + installBegin + "\nHost *\n",
+		},
+		{
+			name:     "end marker before the begin marker",
+			contents: installEnd + "\nHost devbox\n",
+			want:     installEnd + "\nHost devbox\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := removeInstallBlock(tt.contents); got != tt.want {
+				t.Errorf("removeInstallBlock() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  string
+		after   string
+		existed bool
+		exists  bool
+		want    string
+	}{
+		{
+			name:   "new file",
+			after:  "a\nb\n",
+			exists: true,
+			want:   "--- /dev/null\n+++ f\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:    "removed file",
+			before:  "a\n",
+			existed: true,
+			want:    "--- f\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-a\n",
+		},
+		{
+			name:    "appended lines",
+			before:  "a\nb\n",
+			after:   "a\nb\nc\n",
+			existed: true,
+			exists:  true,
+			want:    "--- f\n+++ f\n@@ -2,0 +3,1 @@\n+c\n",
+		},
+		{
+			name:    "changed line in the middle",
+			before:  "a\nb\nc\n",
+			after:   "a\nB\nc\n",
+			existed: true,
+			exists:  true,
+			want:    "--- f\n+++ f\n@@ -2,1 +2,1 @@\n-b\n+B\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fileDiff("f", tt.before, tt.after, tt.existed, tt.exists); got != tt.want {
+				t.Errorf("fileDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHunkRange(t *testing.T) {
+	tests := []struct {
+		skip, count int
+		want        string
+	}{
+		{0, 0, "0,0"},
+		{3, 0, "3,0"},
+		{0, 2, "1,2"},
+		{4, 1, "5,1"},
+	}
+
+	for _, tt := range tests {
+		if got := hunkRange(tt.skip, tt.count); got != tt.want {
+			t.Errorf("hunkRange(%d, %d) = %q, want %q", tt.skip, tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestInstallTargetApply(t *testing.T) {
+	stdout = io.Discard
+	defer func() {
+		stdout = os.Stdout
+	}()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "dotfiles", "ssh_config")
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("Host devbox\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config")
+	if err := os.Symlink(file, path); err != nil {
+		t.Fatal(err)
+	}
+
+	target := installTarget{path: path, content: "Host *\n", shared: true, mode: 0o600}
+	if err := target.apply(true, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Host devbox\n\n" + installBegin + "\nHost *\n" + installEnd + "\n"
+	if string(data) != want {
+		t.Errorf("after install, file = %q, want %q", data, want)
+	}
+	if info, err := os.Lstat(path); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("install replaced the symlink at %s", path)
+	}
+	if info, err := os.Stat(file); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0o640 {
+		t.Errorf("install changed the file's mode to %v, want 0640", info.Mode().Perm())
+	}
+
+	if err := target.apply(false, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "Host devbox\n" {
+		t.Errorf("after uninstall, file = %q, want the user's lines back", data)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("left %d files next to the config, want only the config", len(entries))
+	}
+}
@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/phinze/bankshot/pkg/config"
+	"github.com/phinze/bankshot/pkg/forwarder"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+func newKillStaleCmd() *cobra.Command {
+	var yes, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "kill-stale",
+		Short: "Clean up forwards and sockets a crashed daemon left behind",
+		Long: `Kill-stale looks for what a daemon or monitor that died without cleaning up
+leaves behind, and offers to remove each one:
+
+  - forwards added to this machine's SSH control masters at runtime (as with
+    ssh -O forward) that the running daemon doesn't track, or all of them when
+    no daemon is running. Forwards ssh_config declares are left alone.
+  - bankshot's sockets (the daemon's, and the monitor's control and event
+    sockets) that nothing listens on anymore. A stale ~/.bankshot.sock on a
+    remote host keeps ssh from forwarding the daemon's socket there again.
+
+Run it on the laptop for forwards, and on either end for sockets. --dry-run
+only lists what it finds, and --yes removes all of it without asking.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if yes && dryRun {
+				return fmt.Errorf("--yes and --dry-run are mutually exclusive")
+			}
+
+			cfg, err := config.Load("")
+			if err == nil {
+				err = cfg.Validate()
+			}
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			level := slog.LevelError
+			if verbose {
+				level = slog.LevelDebug
+			}
+			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+			tracked, daemonRunning, err := trackedForwards()
+			if err != nil {
+				return err
+			}
+			if !daemonRunning {
+				fmt.Fprintln(stdout, "No daemon answered; every runtime forward counts as orphaned")
+			}
+			orphaned, err := forwarder.OrphanedForwards(logger, cfg.SSHCommand, func(fwd forwarder.SSHForward) bool {
+				return tracked[staleForwardKey(fwd.SocketPath, fwd.LocalPort)]
+			})
+			if err != nil {
+				return fmt.Errorf("failed to discover forwards: %w", err)
+			}
+			sockets := staleSockets(cfg)
+
+			if len(orphaned) == 0 && len(sockets) == 0 {
+				fmt.Fprintln(stdout, "Nothing stale found")
+				return nil
+			}
+
+			answers := bufio.NewReader(os.Stdin)
+			ask := func(question string) bool {
+				switch {
+				case dryRun:
+					fmt.Fprintln(stdout, question)
+					return false
+				case yes:
+					return true
+				}
+				return confirm(answers, question)
+			}
+
+			failed := 0
+			for _, fwd := range orphaned {
+				target := net.JoinHostPort(fwd.RemoteHost, strconv.Itoa(fwd.RemotePort))
+				if !ask(fmt.Sprintf("Cancel forward localhost:%d -> %s on %s (%s)?",
+					fwd.LocalPort, target, fwd.ConnectionInfo, fwd.SocketPath)) {
+					continue
+				}
+				if err := forwarder.CancelDiscovered(cfg.SSHCommand, fwd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to cancel forward of port %d: %v\n", fwd.LocalPort, err)
+					failed++
+					continue
+				}
+				fmt.Fprintf(stdout, "Cancelled forward of port %d on %s\n", fwd.LocalPort, fwd.ConnectionInfo)
+			}
+
+			for _, path := range sockets {
+				if !ask(fmt.Sprintf("Remove stale socket %s?", path)) {
+					continue
+				}
+				if err := os.Remove(path); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to remove %s: %v\n", path, err)
+					failed++
+					continue
+				}
+				fmt.Fprintf(stdout, "Removed %s\n", path)
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d could not be cleaned up", failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Remove everything found without asking")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Only list what would be removed")
+	return cmd
+}
+
+// trackedForwards returns the forwards the daemon tracks, by control socket
+// and the port ssh listens on, and whether a daemon is running at all. Only
+// a missing or refused socket means none is; any other failure is an error,
+// as every forward would otherwise look orphaned.
+func trackedForwards() (map[string]bool, bool, error) {
+	var list protocol.ListResponse
+	if err := queryDaemon(protocol.CommandList, nil, &list); err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("can't tell which forwards the daemon tracks: %w", err)
+	}
+	tracked := make(map[string]bool, len(list.Forwards))
+	for _, fw := range list.Forwards {
+		tracked[staleForwardKey(fw.SocketPath, fw.LocalPort)] = true
+		if fw.SSHPort != 0 {
+			// With accounting, ssh listens behind the relay on a port of its own
+			tracked[staleForwardKey(fw.SocketPath, fw.SSHPort)] = true
+		}
+	}
+	return tracked, true, nil
+}
+
+func staleForwardKey(socketPath string, localPort int) string {
+	return socketPath + ":" + strconv.Itoa(localPort)
+}
+
+// staleSockets returns the Unix sockets in cfg that exist but refuse
+// connections, probed as doctor does
+func staleSockets(cfg *config.Config) []string {
+	var paths []string
+	if cfg.Network == "unix" {
+		paths = append(paths, cfg.Address)
+	}
+	paths = append(paths, cfg.Monitor.ControlSocket, cfg.Monitor.EventSocketPath())
+
+	var stale []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		info, err := os.Lstat(path)
+		if err != nil || info.Mode()&os.ModeSocket == 0 {
+			continue
+		}
+		if err := probeSocket(path); errors.Is(err, errSocketRefused) {
+			stale = append(stale, path)
+		}
+	}
+	return stale
+}
+
+// confirm asks question and reports whether the answer was yes; anything
+// else, including no answer at all, is no
+func confirm(answers *bufio.Reader, question string) bool {
+	fmt.Fprintf(stdout, "%s [y/N] ", question)
+	answer, err := answers.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false
+	}
+	if err == io.EOF {
+		fmt.Fprintln(stdout)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -3,19 +3,35 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"strconv"
 
 	"github.com/google/uuid"
 	"github.com/phinze/bankshot/pkg/protocol"
 	"github.com/spf13/cobra"
 )
 
+var listOwner string
+
 func newListCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "list",
+	cmd := &cobra.Command{
+		Use:   "list [name]",
 		Short: "List active port forwards",
-		Long:  `Lists all currently active port forwards managed by the daemon.`,
-		Args:  cobra.NoArgs,
+		Long: `Lists all currently active port forwards managed by the daemon.
+Pass a name to show only the forward created with that --name.
+
+--owner shows only forwards requested by one kind of client ("cli",
+"monitor", or "wrap") or one specific owner such as "wrap:1234".
+
+--output json or --output yaml prints the daemon's list response, after
+filtering, for scripts.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			structured, err := structuredOutput()
+			if err != nil {
+				return err
+			}
+
 			req := protocol.Request{
 				ID:   uuid.New().String(),
 				Type: protocol.CommandList,
@@ -27,7 +43,7 @@ func newListCmd() *cobra.Command {
 			}
 
 			if !resp.Success {
-				return fmt.Errorf("failed to list forwards: %s", resp.Error)
+				return requestFailed(fmt.Errorf("failed to list forwards: %s", resp.Error))
 			}
 
 			var list protocol.ListResponse
@@ -35,26 +51,90 @@ func newListCmd() *cobra.Command {
 				return fmt.Errorf("failed to parse list: %w", err)
 			}
 
+			if len(args) == 1 {
+				var named []protocol.ForwardInfo
+				for _, fw := range list.Forwards {
+					if fw.Name == args[0] {
+						named = append(named, fw)
+					}
+				}
+				if len(named) == 0 {
+					return fmt.Errorf("no forward named %q", args[0])
+				}
+				list.Forwards = named
+			}
+
+			if listOwner != "" {
+				var owned []protocol.ForwardInfo
+				for _, fw := range list.Forwards {
+					if protocol.OwnerMatches(fw.Owner, listOwner) {
+						owned = append(owned, fw)
+					}
+				}
+				list.Forwards = owned
+			}
+
+			if structured {
+				if list.Forwards == nil {
+					list.Forwards = []protocol.ForwardInfo{}
+				}
+				return printStructured(stdout, list)
+			}
+
 			if len(list.Forwards) == 0 {
-				fmt.Println("No active port forwards")
+				fmt.Fprintln(stdout, "No active port forwards")
 				return nil
 			}
 
-			fmt.Println("Active Port Forwards:")
+			fmt.Fprintln(stdout, "Active Port Forwards:")
 			byConnection := make(map[string][]protocol.ForwardInfo)
 			for _, fw := range list.Forwards {
 				byConnection[fw.ConnectionInfo] = append(byConnection[fw.ConnectionInfo], fw)
 			}
 
 			for conn, forwards := range byConnection {
-				fmt.Printf("\n  Connection: %s\n", conn)
+				fmt.Fprintf(stdout, "\n  Connection: %s\n", conn)
+
+				// Only call out control sockets when there's more than one
+				sockets := make(map[string]bool)
 				for _, fw := range forwards {
-					fmt.Printf("    %s:%d -> localhost:%d (created: %s)\n",
-						fw.Host, fw.RemotePort, fw.LocalPort, fw.CreatedAt)
+					sockets[fw.SocketPath] = true
+				}
+
+				for _, fw := range forwards {
+					remote := net.JoinHostPort(fw.Host, strconv.Itoa(fw.RemotePort))
+					if fw.RemoteSocket != "" {
+						remote = fw.RemoteSocket
+					}
+					details := ""
+					if fw.Name != "" {
+						details = fmt.Sprintf(", name: %s", fw.Name)
+					}
+					if fw.Group != "" {
+						details += fmt.Sprintf(", range: %s", fw.Group)
+					}
+					if fw.Owner != "" {
+						details += fmt.Sprintf(", owner: %s", fw.Owner)
+					}
+					if fw.BindAddress != "" && !protocol.IsLoopbackAddress(fw.BindAddress) {
+						details += fmt.Sprintf(", shared on: %s", fw.BindAddress)
+					}
+					if len(sockets) > 1 {
+						details += fmt.Sprintf(", via: %s", fw.SocketPath)
+					}
+					fmt.Fprintf(stdout, "    %s -> %s (created: %s%s)\n",
+						remote, fw.LocalTarget(), fw.CreatedAt, details)
+					if fw.Stats != nil {
+						fmt.Fprintf(stdout, "      %s\n", formatStats(fw.Stats))
+					}
 				}
 			}
 
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVar(&listOwner, "owner", "", "Only list forwards with this owner (cli, monitor, wrap, profile, or e.g. wrap:1234)")
+
+	return cmd
 }
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+var (
+	logsLevel  string
+	logsLines  int
+	logsFollow bool
+)
+
+func newLogsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Show the daemon's recent log records",
+		Long: `Logs prints the daemon's recent log records, the last 1000 of those it writes
+at its log_level.
+
+--follow keeps streaming new records until interrupted, debug ones included
+whatever log_level is, so there's no need to restart the daemon with --debug
+to see what it's doing. --level leaves out records below a level (debug,
+info, warn, or error).
+
+The logs tell of every connection, so only bankshot on the machine the daemon
+runs on is shown them, not remote hosts.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			payload, err := json.Marshal(protocol.LogsRequest{
+				Level:  logsLevel,
+				Lines:  logsLines,
+				Follow: logsFollow,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to marshal request: %w", err)
+			}
+
+			sockPath, err := getSocketPath()
+			if err != nil {
+				return err
+			}
+			conn, decoder, resp, err := openRequest(sockPath, &protocol.Request{
+				ID:      uuid.New().String(),
+				Type:    protocol.CommandLogs,
+				Payload: payload,
+			})
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			if !resp.Success {
+				return requestFailed(fmt.Errorf("failed to get logs: %s", resp.Error))
+			}
+
+			var logs protocol.LogsResponse
+			if err := json.Unmarshal(resp.Data, &logs); err != nil {
+				return fmt.Errorf("failed to parse logs: %w", err)
+			}
+			for _, record := range logs.Records {
+				fmt.Fprintln(stdout, formatLogRecord(record))
+			}
+
+			if !logsFollow {
+				return nil
+			}
+			for {
+				var record protocol.LogRecord
+				if err := decoder.Decode(&record); err != nil {
+					if errors.Is(err, io.EOF) {
+						return fmt.Errorf("daemon closed the log stream")
+					}
+					return fmt.Errorf("failed to read log stream: %w", err)
+				}
+				fmt.Fprintln(stdout, formatLogRecord(record))
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&logsLevel, "level", "l", "", "Least severe level to show: debug, info, warn, or error (default: all)")
+	cmd.Flags().IntVarP(&logsLines, "lines", "n", 100, "Number of recent records to show (0 for all kept)")
+	cmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Keep streaming new records")
+
+	return cmd
+}
+
+// formatLogRecord renders a record as the daemon's text log would
+func formatLogRecord(record protocol.LogRecord) string {
+	var b strings.Builder
+	if t, err := time.Parse(time.RFC3339Nano, record.Time); err == nil {
+		b.WriteString(t.Local().Format("2006-01-02 15:04:05.000"))
+	} else {
+		b.WriteString(record.Time)
+	}
+	fmt.Fprintf(&b, " %-5s %s", record.Level, record.Message)
+	for _, attr := range record.Attrs {
+		value := attr.Value
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", attr.Key, value)
+	}
+	return b.String()
+}
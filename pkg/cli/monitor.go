@@ -1,13 +1,22 @@
 package cli
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/phinze/bankshot/pkg/config"
 	"github.com/phinze/bankshot/pkg/daemon"
+	"github.com/phinze/bankshot/pkg/monitor"
+	"github.com/phinze/bankshot/pkg/protocol"
 	"github.com/spf13/cobra"
 )
 
@@ -34,6 +43,7 @@ For manual control, use systemctl:
 
 	cmd.AddCommand(newMonitorRunCmd())
 	cmd.AddCommand(newMonitorReconcileCmd())
+	cmd.AddCommand(newMonitorStatusCmd())
 
 	return cmd
 }
@@ -47,7 +57,7 @@ func newMonitorRunCmd() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVar(&systemdMode, "systemd", false, "Run in systemd mode with sd_notify support")
-	cmd.Flags().StringVar(&logLevel, "log-level", "info", "Log level (debug, info, warn, error)")
+	cmd.Flags().StringVar(&logLevel, "log-level", "", "Log level (debug, info, warn, error; default: the config's log_level)")
 	cmd.Flags().StringVar(&pidFile, "pid-file", "", "Path to PID file")
 
 	return cmd
@@ -97,6 +107,10 @@ them with ports actually listening on this VM. It then:
 - Requests forwards for VM ports that aren't forwarded
 - Removes forwards for ports that aren't listening on the VM
 
+Requests are sent concurrently and each is reported as it finishes. A summary
+of what was forwarded, unforwarded, and failed follows; --json prints it as a
+JSON reconcile report instead.
+
 This is useful to run after SSH reconnection to restore forwards.
 
 Example SSH config to run on connect:
@@ -106,12 +120,17 @@ Example SSH config to run on connect:
 		RunE: runMonitorReconcile,
 	}
 
-	cmd.Flags().StringVar(&logLevel, "log-level", "info", "Log level (debug, info, warn, error)")
+	cmd.Flags().StringVar(&logLevel, "log-level", "", "Log level (debug, info, warn, error; default: the config's log_level)")
 
 	return cmd
 }
 
 func runMonitorReconcile(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
 	// Create monitor configuration
 	cfg := daemon.Config{
 		LogLevel: logLevel,
@@ -123,11 +142,125 @@ func runMonitorReconcile(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create monitor: %w", err)
 	}
 
-	// Run reconciliation
-	if err := d.Reconcile(); err != nil {
+	// Run reconciliation, reporting each request as it finishes
+	var progress daemon.ReconcileProgress
+	if !structured {
+		progress = func(action protocol.ReconcileAction, done, total int) {
+			fmt.Fprintf(stdout, "[%d/%d] %s\n", done, total, describeReconcileAction(action))
+		}
+	}
+	report, err := d.Reconcile(progress)
+	if err != nil {
 		return fmt.Errorf("reconciliation failed: %w", err)
 	}
 
-	fmt.Println("Reconciliation completed successfully")
+	if structured {
+		return printStructured(stdout, report)
+	}
+
+	fmt.Fprintf(stdout, "Reconciliation complete: %d forwarded, %d unforwarded, %d failed, %d unchanged\n",
+		len(report.Forwarded), len(report.Unforwarded), len(report.Failed), report.Unchanged)
+	for _, action := range report.Failed {
+		fmt.Fprintf(stdout, "  %s\n", describeReconcileAction(action))
+	}
+	return nil
+}
+
+// describeReconcileAction renders one reconcile request's outcome
+func describeReconcileAction(action protocol.ReconcileAction) string {
+	switch {
+	case action.Error != "":
+		return fmt.Sprintf("%s %d failed: %s", action.Action, action.Port, action.Error)
+	case action.Queued:
+		return fmt.Sprintf("%s %d queued for retry", action.Action, action.Port)
+	case action.LocalPort != 0 && action.LocalPort != action.Port:
+		return fmt.Sprintf("%s %d -> localhost:%d", action.Action, action.Port, action.LocalPort)
+	default:
+		return fmt.Sprintf("%s %d", action.Action, action.Port)
+	}
+}
+
+func newMonitorStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show what the running monitor has done with the ports it saw",
+		Long: `Status asks the running monitor, over its event socket (monitor.eventSocket),
+what it has forwarded and how many events it has processed, dropped, filtered,
+and failed to forward, along with what became of the latest ports opened on
+this host. Use it to find out why a port never got forwarded.`,
+		RunE: runMonitorStatus,
+	}
+
+	return cmd
+}
+
+func runMonitorStatus(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load("")
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.Monitor.EventSocket == "" {
+		return fmt.Errorf("monitor.eventSocket is not set; set it and restart the monitor to query its status")
+	}
+
+	conn, err := net.DialTimeout("unix", cfg.Monitor.EventSocketPath(), 5*time.Second)
+	if err != nil {
+		return daemonUnreachable(fmt.Errorf("failed to connect to monitor (is it running?): %w", err))
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// The first line is a snapshot; the rest are events as they happen
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read monitor status: %w", err)
+	}
+	var snapshot monitor.TapEvent
+	if err := json.Unmarshal(line, &snapshot); err != nil {
+		return fmt.Errorf("failed to parse monitor status: %w", err)
+	}
+	if structured {
+		return printStructured(stdout, snapshot)
+	}
+
+	ports := make([]string, len(snapshot.Ports))
+	for i, port := range snapshot.Ports {
+		ports[i] = strconv.Itoa(port)
+	}
+	if snapshot.Source != "" {
+		fmt.Fprintf(stdout, "Source:    %s\n", snapshot.Source)
+	}
+	if len(ports) == 0 {
+		fmt.Fprintln(stdout, "Forwarded: none")
+	} else {
+		fmt.Fprintf(stdout, "Forwarded: %s\n", strings.Join(ports, ", "))
+	}
+
+	m := snapshot.Metrics
+	if m == nil {
+		return nil
+	}
+	fmt.Fprintf(stdout, "Events:    %d processed, %d dropped\n", m.EventsProcessed, m.EventsDropped)
+	fmt.Fprintf(stdout, "Ports:     %d filtered, %d ignored, %d failed health checks\n", m.PortsFiltered, m.PortsIgnored, m.HealthChecksFailed)
+	fmt.Fprintf(stdout, "Forwards:  %d created, %d queued, %d failed, %d removed\n", m.ForwardsCreated, m.ForwardsQueued, m.ForwardsFailed, m.ForwardsRemoved)
+	if m.EventsDropped > 0 {
+		fmt.Fprintln(stdout, "\nEvents were dropped; raising monitor.eventBuffer may help.")
+	}
+
+	if len(m.Recent) > 0 {
+		fmt.Fprintln(stdout, "\nRecent ports:")
+		for _, outcome := range m.Recent {
+			fmt.Fprintf(stdout, "  %s  %-5d  %-9s  %s\n", outcome.Time.Local().Format("15:04:05"), outcome.Port, outcome.Outcome, outcome.Detail)
+		}
+	}
 	return nil
 }
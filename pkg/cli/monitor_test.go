@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+func TestDescribeReconcileAction(t *testing.T) {
+	tests := []struct {
+		name   string
+		action protocol.ReconcileAction
+		want   string
+	}{
+		{"forwarded", protocol.ReconcileAction{Port: 3000, Action: "forward", LocalPort: 3000}, "forward 3000"},
+		{"remapped", protocol.ReconcileAction{Port: 3000, Action: "forward", LocalPort: 3001}, "forward 3000 -> localhost:3001"},
+		{"queued", protocol.ReconcileAction{Port: 3000, Action: "forward", Queued: true}, "forward 3000 queued for retry"},
+		{"failed", protocol.ReconcileAction{Port: 8080, Action: "unforward", Error: "not found"}, "unforward 8080 failed: not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeReconcileAction(tt.action); got != tt.want {
+				t.Errorf("describeReconcileAction() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
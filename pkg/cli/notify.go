@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+func newNotifyCmd() *cobra.Command {
+	var title, url string
+
+	cmd := &cobra.Command{
+		Use:   "notify <message>",
+		Short: "Post a desktop notification on the local machine",
+		Long: `Posts a native desktop notification on the local machine, titled with this
+host's name unless --title is given. With --url, clicking the notification
+opens the URL. Needs notify_command set in the daemon's config.
+
+  make && bankshot notify "build finished"`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			notifyReq := protocol.NotifyRequest{
+				Title: title,
+				Body:  strings.Join(args, " "),
+				URL:   url,
+			}
+			if hostname, err := os.Hostname(); err == nil {
+				notifyReq.ConnectionInfo = hostname
+			}
+
+			payload, err := json.Marshal(notifyReq)
+			if err != nil {
+				return fmt.Errorf("failed to marshal request: %w", err)
+			}
+
+			resp, err := sendRequest(&protocol.Request{
+				ID:      uuid.New().String(),
+				Type:    protocol.CommandNotify,
+				Payload: payload,
+			})
+			if err != nil {
+				return err
+			}
+			if !resp.Success {
+				return requestFailed(fmt.Errorf("failed to notify: %s", resp.Error))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&title, "title", "t", "", "Notification title (default: this host's name)")
+	cmd.Flags().StringVarP(&url, "url", "u", "", "URL to open when the notification is clicked")
+
+	return cmd
+}
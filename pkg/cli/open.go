@@ -3,46 +3,260 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/config"
+	"github.com/phinze/bankshot/pkg/monitor"
+	"github.com/phinze/bankshot/pkg/opener"
 	"github.com/phinze/bankshot/pkg/protocol"
 	"github.com/spf13/cobra"
 )
 
 func newOpenCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "open [url]",
-		Short: "Open a URL in the local browser",
-		Long:  `Opens the specified URL in the default browser on the local machine.`,
-		Args:  cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			url := args[0]
+	var printLocal, incognito, pull bool
+	var browser, profile string
 
-			openReq := protocol.OpenRequest{URL: url}
-			payload, err := json.Marshal(openReq)
-			if err != nil {
-				return fmt.Errorf("failed to marshal request: %w", err)
-			}
+	cmd := &cobra.Command{
+		Use:   "open [url|file]",
+		Short: "Open a URL in the local browser, or a file in its local application",
+		Long: `Opens the specified URL in the default browser on the local machine.
 
-			req := protocol.Request{
-				ID:      uuid.New().String(),
-				Type:    protocol.CommandOpen,
-				Payload: payload,
-			}
+A URL for a port on this host, like http://localhost:3000 or one with this
+host's name, is opened at the local port that port is forwarded to, so it
+still works when the forward landed on another local port; a port nothing
+forwards yet is forwarded first, so OAuth callbacks and the like reach it.
+--print-local prints the rewritten URL instead of opening it, and fails if
+the port isn't forwarded.
 
-			resp, err := sendRequest(&req)
-			if err != nil {
-				return err
-			}
+--browser opens the URL in another browser than the daemon's config picks:
+brave, chrome, chromium, edge, or firefox. --profile opens it in a browser
+profile, by a name the daemon's opener.profiles maps or the browser's own (a
+Chrome profile directory like "Profile 1", or a Firefox profile name), and
+--incognito in a private window. Without --browser, those need
+opener.browser (or a browser rule) in the daemon's config to say which
+browser to launch.
 
-			if !resp.Success {
-				return fmt.Errorf("failed to open URL: %s", resp.Error)
+Given the path of a file on this host instead (or a file:// URL), sends the
+file to the local machine and opens it there with its default application,
+so "bankshot open report.pdf" shows the PDF on your laptop. The daemon's
+config has to allow it with opener.open_files, and only opens the kinds of
+file opener.file_extensions lists. The file is copied to the local temp
+directory, and can be at most opener.max_file_mb (100 MiB by default). With
+--pull, the daemon reads the file over its SSH connection to this host
+instead, which is quicker for large files.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if printLocal {
+				local, forwarded, err := forwardedURL(args[0])
+				if err != nil {
+					return err
+				}
+				if !forwarded {
+					return fmt.Errorf("no forward found for %s", args[0])
+				}
+				fmt.Fprintln(stdout, local)
+				return nil
 			}
-
-			if verbose {
-				fmt.Println("URL opened successfully")
+			if path, ok := localFile(args[0]); ok {
+				if browser != "" || profile != "" || incognito {
+					return fmt.Errorf("--browser, --profile, and --incognito only apply to URLs")
+				}
+				return openFile(path, pull)
 			}
-			return nil
+			if pull {
+				return fmt.Errorf("--pull only applies to files")
+			}
+			openReq := protocol.OpenRequest{URL: args[0], Profile: profile, Incognito: incognito}
+			if browser != "" {
+				name, ok := opener.BrowserNamed(browser)
+				if !ok {
+					return fmt.Errorf("unknown browser %q (must be one of %s)", browser, strings.Join(config.BrowserNames, ", "))
+				}
+				openReq.Browser = name
+			}
+			return openURL(openReq)
 		},
 	}
+
+	cmd.Flags().BoolVar(&printLocal, "print-local", false, "Print the URL with the local port it's forwarded to instead of opening it")
+	cmd.Flags().StringVar(&browser, "browser", "", "Open the URL in this browser instead of the configured one")
+	cmd.Flags().StringVar(&profile, "profile", "", "Open the URL in this browser profile")
+	cmd.Flags().BoolVar(&incognito, "incognito", false, "Open the URL in a private window")
+	cmd.Flags().BoolVar(&pull, "pull", false, "Have the daemon copy the file over SSH instead of sending it")
+	return cmd
+}
+
+// forwardedURL rewrites url, if it's for a port on this host, to the local
+// port the port is forwarded to, reporting whether a forward was found. It's
+// only for --print-local: opening a URL leaves the rewrite to the daemon,
+// which forwards the port first if need be.
+func forwardedURL(url string) (string, bool, error) {
+	connectionInfo, err := defaultConnection()
+	if err != nil {
+		return url, false, err
+	}
+	var list protocol.ListResponse
+	if err := queryDaemon(protocol.CommandList, nil, &list); err != nil {
+		return url, false, err
+	}
+	// The hosts the daemon takes as this one's when it rewrites
+	host := connectionInfo
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	hostname, _ := os.Hostname()
+	local, forwarded := protocol.LocalURL(url, connectionInfo, list.Forwards, host, hostname)
+	return local, forwarded, nil
+}
+
+// openURL asks the daemon to open openReq's URL in the local browser, as
+// its other fields ask. The URL is sent as given; the daemon rewrites URLs
+// for this host's ports to where they're forwarded.
+func openURL(openReq protocol.OpenRequest) error {
+	// Attribute the request to this host and the process that invoked us
+	// (typically whatever tool ran $BROWSER) so the daemon can track and
+	// limit opens per source. The daemon tells which connection to forward
+	// ports over from the request itself, so there's no asking it first.
+	if hostname, err := os.Hostname(); err == nil {
+		openReq.ConnectionInfo = hostname
+		openReq.Hostname = hostname
+	}
+	ppid := os.Getppid()
+	openReq.ProcessName = monitor.ResolveProcessName(ppid)
+	openReq.ProcessCwd = monitor.ResolveProcessCwd(ppid)
+
+	payload, err := json.Marshal(openReq)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req := protocol.Request{
+		ID:      uuid.New().String(),
+		Type:    protocol.CommandOpen,
+		Payload: payload,
+	}
+
+	resp, err := sendRequest(&req)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return requestFailed(fmt.Errorf("failed to open URL: %s", resp.Error))
+	}
+
+	if verbose {
+		fmt.Fprintln(stdout, "URL opened successfully")
+	}
+	return nil
+}
+
+// localFile reports whether arg names a regular file on this host, as a
+// path or a file:// URL, rather than a URL to open in the browser
+func localFile(arg string) (string, bool) {
+	path := arg
+	if strings.HasPrefix(arg, "file://") {
+		u, err := url.Parse(arg)
+		if err != nil {
+			return "", false
+		}
+		path = u.Path
+	} else if strings.Contains(arg, "://") {
+		return "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return path, true
+}
+
+// openFile sends the file at path to the daemon, in chunks after the
+// request, to be opened on the local machine. With pull, the daemon copies
+// the file over the SSH connection itself, and nothing is sent.
+func openFile(path string, pull bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	openReq := protocol.OpenFileRequest{
+		Name: filepath.Base(path),
+		Size: info.Size(),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		openReq.ConnectionInfo = hostname
+	}
+	ppid := os.Getppid()
+	openReq.ProcessName = monitor.ResolveProcessName(ppid)
+	openReq.ProcessCwd = monitor.ResolveProcessCwd(ppid)
+	body := func(w io.Writer) error {
+		return sendFileChunks(w, file)
+	}
+	if pull {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		openReq.Path = filepath.ToSlash(abs)
+		body = nil
+	}
+
+	payload, err := json.Marshal(openReq)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	sockPath, err := getSocketPath()
+	if err != nil {
+		return err
+	}
+	conn, _, resp, err := openRequestWithBody(sockPath, &protocol.Request{
+		ID:      uuid.New().String(),
+		Type:    protocol.CommandOpenFile,
+		Payload: payload,
+	}, body)
+	if err != nil {
+		return err
+	}
+	_ = conn.Close()
+
+	if !resp.Success {
+		return requestFailed(fmt.Errorf("failed to open file: %s", resp.Error))
+	}
+	if verbose {
+		fmt.Fprintln(stdout, "File opened successfully")
+	}
+	return nil
+}
+
+// sendFileChunks writes r to w as FileChunk lines, the last one marked
+func sendFileChunks(w io.Writer, r io.Reader) error {
+	encoder := json.NewEncoder(w)
+	buf := make([]byte, protocol.FileChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		if err := encoder.Encode(protocol.FileChunk{Data: buf[:n], Last: last}); err != nil {
+			return fmt.Errorf("failed to send file: %w", err)
+		}
+		if last {
+			return nil
+		}
+	}
 }
@@ -0,0 +1,300 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/phinze/bankshot/pkg/monitor"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+func newPickCmd() *cobra.Command {
+	var connection string
+
+	cmd := &cobra.Command{
+		Use:   "pick",
+		Short: "Choose listening ports on this host to forward",
+		Long: `Pick lists the TCP ports listening on this host's loopback or wildcard
+addresses, with the processes holding them, and forwards the ones you choose.
+It's handy when you don't know which port a tool grabbed.
+
+Type to filter the list by port, process, or command line; letters only need
+to appear in order, so "nxd" finds "next dev". up/down move, tab marks a port,
+enter forwards the marked ports (or the highlighted one), and esc cancels.
+Ports already forwarded are marked as such.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			structured, err := structuredOutput()
+			if err != nil {
+				return err
+			}
+			if connection == "" {
+				if connection, err = defaultConnection(); err != nil {
+					return err
+				}
+			}
+
+			candidates, err := pickCandidates(connection)
+			if err != nil {
+				return err
+			}
+			if len(candidates) == 0 {
+				fmt.Fprintln(stdout, "No listening ports found")
+				return nil
+			}
+
+			model := newPickModel(candidates)
+			if err := runScreen(model); err != nil {
+				return err
+			}
+			chosen := model.chosen()
+			if len(chosen) == 0 {
+				return nil
+			}
+
+			batch := protocol.ForwardBatchRequest{}
+			for _, c := range chosen {
+				batch.Forwards = append(batch.Forwards, protocol.ForwardRequest{
+					RemotePort:     c.port,
+					LocalPort:      c.port,
+					Host:           "localhost",
+					ConnectionInfo: connection,
+					ProcessName:    c.process,
+					ProcessCwd:     c.cwd,
+					Owner:          protocol.OwnerCLI,
+				})
+			}
+			return sendForwardBatch(batch, structured)
+		},
+	}
+
+	cmd.Flags().StringVarP(&connection, "connection", "c", "", "SSH connection identifier (default: this SSH session's)")
+	_ = cmd.RegisterFlagCompletionFunc("connection", completeConnections)
+	return cmd
+}
+
+// pickCandidate is a listening port pick offers
+type pickCandidate struct {
+	port      int
+	process   string // Name of the process holding it, if readable
+	cmdline   string
+	cwd       string
+	forwarded bool // Already forwarded over the connection
+}
+
+// text is what the filter matches against
+func (c pickCandidate) text() string {
+	return fmt.Sprintf("%d %s %s", c.port, c.process, c.cmdline)
+}
+
+// pickCandidates returns the TCP ports listening where a forward to
+// localhost reaches them, by port, noting those connectionInfo already
+// forwards
+func pickCandidates(connectionInfo string) ([]pickCandidate, error) {
+	var list protocol.ListResponse
+	if err := queryDaemon(protocol.CommandList, nil, &list); err != nil {
+		return nil, err
+	}
+	forwarded := make(map[int]bool)
+	for _, fw := range list.Forwards {
+		if fw.ConnectionInfo == connectionInfo && fw.RemoteSocket == "" {
+			forwarded[fw.RemotePort] = true
+		}
+	}
+
+	ports, err := monitor.GetListeningPorts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list listening ports: %w", err)
+	}
+	owners := monitor.SocketOwners()
+
+	// The same port often listens on both tcp and tcp6
+	byPort := make(map[int]pickCandidate)
+	for _, p := range ports {
+		if !monitor.IsLocalAddr(p.BindAddr) {
+			continue
+		}
+		if c, seen := byPort[p.Port]; seen && c.process != "" {
+			continue
+		}
+		c := pickCandidate{port: p.Port, forwarded: forwarded[p.Port]}
+		if pid := owners[p.Inode]; pid != 0 {
+			c.process = monitor.ResolveProcessName(pid)
+			c.cmdline = monitor.ResolveProcessCmdline(pid)
+			c.cwd = monitor.ResolveProcessCwd(pid)
+		}
+		byPort[p.Port] = c
+	}
+
+	candidates := make([]pickCandidate, 0, len(byPort))
+	for _, c := range byPort {
+		candidates = append(candidates, c)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].port < candidates[j].port })
+	return candidates, nil
+}
+
+// fuzzyMatch reports whether the runes of query appear in text in order,
+// ignoring case
+func fuzzyMatch(query, text string) bool {
+	text = strings.ToLower(text)
+	for _, r := range strings.ToLower(query) {
+		i := strings.IndexRune(text, r)
+		if i < 0 {
+			return false
+		}
+		text = text[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+// pickModel is the picker's state
+type pickModel struct {
+	candidates []pickCandidate
+	query      string
+	shown      []int        // Indexes into candidates matching query
+	cursor     int          // Index into shown
+	marked     map[int]bool // Indexes into candidates
+	done       bool         // Enter was pressed, rather than esc
+	height     int          // Terminal rows, or 0 if unknown
+	offset     int          // Index into shown of the first row on screen
+}
+
+// pickChromeRows is how many rows of the screen aren't the list: the
+// query, the blank lines around the list, and the footer
+const pickChromeRows = 4
+
+func newPickModel(candidates []pickCandidate) *pickModel {
+	m := &pickModel{candidates: candidates, marked: make(map[int]bool)}
+	m.filter()
+	return m
+}
+
+func (m *pickModel) start() screenCmd {
+	return nil
+}
+
+func (m *pickModel) update(msg any) screenCmd {
+	defer m.scroll()
+
+	var key screenKey
+	switch msg := msg.(type) {
+	case screenSizeMsg:
+		m.height = msg.height
+		return nil
+	case screenKey:
+		key = msg
+	default:
+		return nil
+	}
+
+	switch key {
+	case "esc", "ctrl+c":
+		return screenQuit
+	case "enter":
+		m.done = true
+		return screenQuit
+	case "up", "ctrl+p":
+		m.cursor = max(0, m.cursor-1)
+	case "down", "ctrl+n":
+		m.cursor = max(0, min(len(m.shown)-1, m.cursor+1))
+	case "tab":
+		if m.cursor < len(m.shown) {
+			i := m.shown[m.cursor]
+			m.marked[i] = !m.marked[i]
+			m.cursor = max(0, min(len(m.shown)-1, m.cursor+1))
+		}
+	case "backspace":
+		if m.query != "" {
+			_, size := utf8.DecodeLastRuneInString(m.query)
+			m.query = m.query[:len(m.query)-size]
+			m.filter()
+		}
+	default:
+		if text, typed := key.typed(); typed {
+			m.query += text
+			m.filter()
+		}
+	}
+	return nil
+}
+
+// filter narrows the list to the candidates matching the query
+func (m *pickModel) filter() {
+	m.shown = m.shown[:0]
+	for i, c := range m.candidates {
+		if fuzzyMatch(m.query, c.text()) {
+			m.shown = append(m.shown, i)
+		}
+	}
+	m.cursor = max(0, min(len(m.shown)-1, m.cursor))
+}
+
+// rows returns how many candidates fit on the screen at once
+func (m *pickModel) rows() int {
+	if m.height == 0 {
+		return len(m.shown)
+	}
+	return max(1, m.height-pickChromeRows)
+}
+
+// scroll moves the list just far enough to keep the cursor on screen,
+// without leaving empty rows below it
+func (m *pickModel) scroll() {
+	rows := m.rows()
+	m.offset = min(m.offset, m.cursor)
+	m.offset = max(m.offset, m.cursor-rows+1)
+	m.offset = max(0, min(m.offset, len(m.shown)-rows))
+}
+
+// chosen returns the marked candidates, or the highlighted one if none
+// are, once enter was pressed
+func (m *pickModel) chosen() []pickCandidate {
+	if !m.done {
+		return nil
+	}
+	var chosen []pickCandidate
+	for i, c := range m.candidates {
+		if m.marked[i] {
+			chosen = append(chosen, c)
+		}
+	}
+	if len(chosen) == 0 && m.cursor < len(m.shown) {
+		chosen = append(chosen, m.candidates[m.shown[m.cursor]])
+	}
+	return chosen
+}
+
+func (m *pickModel) view() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "> %s\n\n", m.query)
+
+	if len(m.shown) == 0 {
+		b.WriteString("  no matching ports\n")
+	}
+	end := min(len(m.shown), m.offset+m.rows())
+	for row := m.offset; row < end; row++ {
+		i := m.shown[row]
+		c := m.candidates[i]
+		mark := " "
+		if m.marked[i] {
+			mark = "*"
+		}
+		line := fmt.Sprintf("%s %-5d  %-15s %s", mark, c.port, c.process, c.cmdline)
+		if c.forwarded {
+			line += "  (forwarded)"
+		}
+		if row == m.cursor {
+			fmt.Fprintf(&b, "\033[7m>%s\033[0m\n", line)
+		} else {
+			fmt.Fprintf(&b, " %s\n", line)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n\033[90m%d/%d · type to filter · ↑/↓ move · tab mark · enter forward · esc cancel\033[0m\n",
+		len(m.shown), len(m.candidates))
+	return b.String()
+}
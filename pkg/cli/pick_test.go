@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPickScroll(t *testing.T) {
+	var candidates []pickCandidate
+	for port := 3000; port < 3010; port++ {
+		candidates = append(candidates, pickCandidate{port: port})
+	}
+	m := newPickModel(candidates)
+	visible := func() []string {
+		var ports []string
+		for _, c := range candidates {
+			if strings.Contains(m.view(), fmt.Sprintf("%d", c.port)) {
+				ports = append(ports, fmt.Sprintf("%d", c.port))
+			}
+		}
+		return ports
+	}
+
+	if got := visible(); len(got) != len(candidates) {
+		t.Errorf("showing %v before the size is known, want every port", got)
+	}
+
+	// Room for three rows
+	m.update(screenSizeMsg{width: 80, height: 3 + pickChromeRows})
+	if got := strings.Join(visible(), " "); got != "3000 3001 3002" {
+		t.Errorf("showing %s, want the first three", got)
+	}
+	if lines := strings.Count(m.view(), "\n"); lines != 3+pickChromeRows {
+		t.Errorf("view has %d lines, want %d", lines, 3+pickChromeRows)
+	}
+
+	for range 4 {
+		m.update(screenKey("down"))
+	}
+	if got := strings.Join(visible(), " "); got != "3002 3003 3004" {
+		t.Errorf("showing %s with 3004 highlighted, want it on the last row", got)
+	}
+
+	m.update(screenKey("up"))
+	m.update(screenKey("up"))
+	m.update(screenKey("up"))
+	if got := strings.Join(visible(), " "); got != "3001 3002 3003" {
+		t.Errorf("showing %s with 3001 highlighted, want it on the first row", got)
+	}
+
+	// Filtering to fewer ports than fit shows them all
+	m.update(screenKey("9"))
+	if got := strings.Join(visible(), " "); got != "3009" {
+		t.Errorf("showing %s after filtering, want 3009", got)
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+func newProxyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "proxy",
+		Short: "Bridge stdin and stdout to the daemon's socket",
+		Long: `Proxy connects to the daemon's socket and copies stdin to it and what it
+sends back to stdout, for reaching the daemon through ssh without the
+RemoteForward of ~/.bankshot.sock, where that's blocked or a hassle.
+
+Run it on the laptop from the remote host's CLI by setting proxy_command in
+the remote host's config (or --socket "exec:<command>" for one call):
+
+  proxy_command: ssh laptop bankshot proxy
+
+Each request then runs the command, so an SSH ControlMaster to the laptop
+keeps that quick.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sockPath, err := getSocketPath()
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(sockPath, protocol.ProxyCommandPrefix) {
+				return fmt.Errorf("proxy needs the daemon's socket, but proxy_command is set")
+			}
+
+			conn, err := dialDaemon(sockPath)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			// The daemon answers once the request is in and then closes the
+			// connection, which ends the proxy
+			go func() {
+				_, _ = io.Copy(conn, os.Stdin)
+				if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+					_ = cw.CloseWrite()
+				}
+			}()
+			if _, err := io.Copy(os.Stdout, conn); err != nil {
+				return fmt.Errorf("failed to read from daemon: %w", err)
+			}
+			return nil
+		},
+	}
+}
+
+// dialDaemon connects to the daemon at sockPath, as protocol.Dial does
+func dialDaemon(sockPath string) (net.Conn, error) {
+	conn, err := protocol.Dial(sockPath, 0)
+	if err != nil {
+		return nil, daemonUnreachable(fmt.Errorf("failed to connect to daemon: %w", err))
+	}
+	return conn, nil
+}
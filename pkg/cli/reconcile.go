@@ -33,7 +33,7 @@ for the periodic reconciliation cycle.`,
 			}
 
 			if !resp.Success {
-				return fmt.Errorf("reconciliation failed: %s", resp.Error)
+				return requestFailed(fmt.Errorf("reconciliation failed: %s", resp.Error))
 			}
 
 			var result map[string]interface{}
@@ -42,7 +42,7 @@ for the periodic reconciliation cycle.`,
 			}
 
 			if msg, ok := result["message"].(string); ok {
-				fmt.Println(msg)
+				fmt.Fprintln(stdout, msg)
 			}
 
 			return nil
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+func newReopenCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reopen [number|text]",
+		Short: "Open a URL from the open history again",
+		Long: `Opens a URL the daemon opened before again: the most recent one, the one
+bankshot history shows with that number, or the most recent one containing
+the text, such as the OAuth link that flashed by:
+
+  bankshot reopen 3
+  bankshot reopen github.com/phinze/bankshot/pull
+
+Localhost URLs are forwarded again if their forward has gone. Set
+opener.history_file in the daemon's config to reach back past restarts.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var reopenReq protocol.ReopenRequest
+			if len(args) == 1 {
+				if n, err := strconv.Atoi(args[0]); err == nil && n > 0 {
+					reopenReq.Index = n
+				} else {
+					reopenReq.Match = args[0]
+				}
+			}
+
+			var result map[string]string
+			if err := queryDaemon(protocol.CommandReopen, reopenReq, &result); err != nil {
+				return fmt.Errorf("failed to reopen: %w", err)
+			}
+			fmt.Fprintln(stdout, result["message"])
+			return nil
+		},
+	}
+}
@@ -1,15 +1,29 @@
 package cli
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
 	"github.com/phinze/bankshot/version"
 	"github.com/spf13/cobra"
 )
 
 var (
-	socketPath string
-	verbose    bool
+	socketPath   string
+	verbose      bool
+	outputFormat string
+	jsonOutput   bool
+	quiet        bool
 )
 
+// stdout is where commands report what they did; --quiet discards it.
+// What a command is run to get, like pasted text, exported forwards, a
+// config value, or the output of the command wrap runs, goes straight to
+// os.Stdout instead.
+var stdout io.Writer = os.Stdout
+
 func NewRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "bankshot",
@@ -20,10 +34,28 @@ func NewRootCmd() *cobra.Command {
 - Check daemon status`,
 		Version:      version.GetFullVersion(),
 		SilenceUsage: true,
+		// Execute reports errors, as JSON with --json
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if jsonOutput {
+				if cmd.Flags().Changed("output") && outputFormat != outputJSON {
+					return fmt.Errorf("--json cannot be used with --output %s", outputFormat)
+				}
+				outputFormat = outputJSON
+			}
+			if quiet {
+				stdout = io.Discard
+			}
+			return nil
+		},
 	}
 
 	rootCmd.PersistentFlags().StringVarP(&socketPath, "socket", "s", "", "Path to bankshot socket")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, "Output format of list, status, and forward: table, json, or yaml")
+	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "Print results and errors as JSON (same as --output json)")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Print nothing but errors; check the exit code")
+	rootCmd.MarkFlagsMutuallyExclusive("json", "quiet")
 
 	rootCmd.AddCommand(newOpenCmd())
 	rootCmd.AddCommand(newForwardCmd())
@@ -35,6 +67,49 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(newWrapCmd())
 	rootCmd.AddCommand(newMonitorCmd())
 	rootCmd.AddCommand(newOpProxyCmd())
+	rootCmd.AddCommand(newHistoryCmd())
+	rootCmd.AddCommand(newReopenCmd())
+	rootCmd.AddCommand(newExportCmd())
+	rootCmd.AddCommand(newImportCmd())
+	rootCmd.AddCommand(newDoctorCmd())
+	rootCmd.AddCommand(newTUICmd())
+	rootCmd.AddCommand(newLogsCmd())
+	rootCmd.AddCommand(newCopyCmd())
+	rootCmd.AddCommand(newPasteCmd())
+	rootCmd.AddCommand(newNotifyCmd())
+	rootCmd.AddCommand(newUpCmd())
+	rootCmd.AddCommand(newDownCmd())
+	rootCmd.AddCommand(newSSHCmd())
+	rootCmd.AddCommand(newInstallCmd())
+	rootCmd.AddCommand(newUninstallCmd())
+	rootCmd.AddCommand(newVersionCmd())
+	rootCmd.AddCommand(newSelfUpdateCmd())
+	rootCmd.AddCommand(newDocsCmd())
+	rootCmd.AddCommand(newPickCmd())
+	rootCmd.AddCommand(newAttachCmd())
+	rootCmd.AddCommand(newProxyCmd())
+	rootCmd.AddCommand(newKillStaleCmd())
 
 	return rootCmd
 }
+
+// Execute runs the bankshot command line and returns its exit code. With
+// --json, a failure is reported on stderr as {"error": ..., "exit_code": ...}.
+func Execute() int {
+	rootCmd := NewRootCmd()
+	cmd, err := rootCmd.ExecuteC()
+	code := ExitCode(err)
+	switch {
+	case err == nil:
+	case jsonOutput:
+		data, _ := json.Marshal(struct {
+			Error    string `json:"error"`
+			ExitCode int    `json:"exit_code"`
+		}{err.Error(), code})
+		fmt.Fprintln(os.Stderr, string(data))
+	case cmd == rootCmd || !cmd.SilenceErrors:
+		// Commands like op-proxy report their own errors
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+	return code
+}
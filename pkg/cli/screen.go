@@ -0,0 +1,212 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// screenCmd does work away from the screen's loop, such as asking the
+// daemon something, and returns a message for the model, or nil for none
+type screenCmd func() any
+
+// screenModel is a full-screen view: what it shows, and how it reacts to
+// key presses and to the messages of the commands it starts
+type screenModel interface {
+	start() screenCmd
+	update(msg any) screenCmd
+	view() string
+}
+
+// screenKey is a key press, named like "up", "enter", or "ctrl+c", or the
+// text typed
+type screenKey string
+
+// typed returns the text the key typed, unless it's one of the named keys
+func (k screenKey) typed() (string, bool) {
+	for _, named := range screenKeys {
+		if k == named {
+			return "", false
+		}
+	}
+	return string(k), true
+}
+
+// screenQuitMsg ends the screen's loop
+type screenQuitMsg struct{}
+
+// screenSizeMsg is the terminal's size, sent when the screen starts and
+// whenever the terminal is resized
+type screenSizeMsg struct {
+	width, height int
+}
+
+// screenQuit is the command a model returns to quit
+func screenQuit() any {
+	return screenQuitMsg{}
+}
+
+// runScreen shows m on the terminal's alternate screen, redrawing it after
+// each key press and message, until m quits or stdin closes
+func runScreen(m screenModel) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("stdin is not a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to set up the terminal: %w", err)
+	}
+	defer func() {
+		_ = term.Restore(fd, state)
+	}()
+
+	// Alternate screen, with the cursor hidden until we leave it
+	fmt.Fprint(os.Stdout, "\033[?1049h\033[?25l")
+	defer fmt.Fprint(os.Stdout, "\033[?25h\033[?1049l")
+
+	// The read blocks until the next key even after we're done, but it's only
+	// ever left behind by a command that's about to exit
+	keys := make(chan screenKey)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 256)
+		for {
+			n, err := os.Stdin.Read(buf)
+			for _, key := range parseKeys(buf[:n]) {
+				keys <- key
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	msgs := make(chan any)
+	run := func(cmd screenCmd) {
+		if cmd == nil {
+			return
+		}
+		go func() {
+			msg := cmd()
+			if msg == nil {
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-done:
+			}
+		}()
+	}
+
+	resized, stopResize := notifyResize()
+	defer stopResize()
+	sendSize := func() {
+		if width, height, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			run(m.update(screenSizeMsg{width: width, height: height}))
+		}
+	}
+
+	sendSize()
+	run(m.start())
+	for {
+		drawScreen(os.Stdout, m.view())
+
+		var msg any
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			msg = key
+		case msg = <-msgs:
+		case <-resized:
+			sendSize()
+			continue
+		}
+		if _, quit := msg.(screenQuitMsg); quit {
+			return nil
+		}
+		run(m.update(msg))
+	}
+}
+
+// drawScreen replaces what's on the screen with view, clearing what's left
+// of each line and everything below it
+func drawScreen(w io.Writer, view string) {
+	var b strings.Builder
+	b.WriteString("\033[H")
+	for line := range strings.Lines(view) {
+		// The terminal's raw, so newlines don't return the carriage
+		b.WriteString(strings.TrimSuffix(line, "\n"))
+		b.WriteString("\033[K\r\n")
+	}
+	b.WriteString("\033[J")
+	_, _ = io.WriteString(w, b.String())
+}
+
+// screenKeys names the control characters and escape sequences of the keys
+// screens handle
+var screenKeys = map[string]screenKey{
+	"\x1b[A":  "up",
+	"\x1bOA":  "up",
+	"\x1b[B":  "down",
+	"\x1bOB":  "down",
+	"\x1b[C":  "right",
+	"\x1bOC":  "right",
+	"\x1b[D":  "left",
+	"\x1bOD":  "left",
+	"\x1b[3~": "delete",
+	"\x1b":    "esc",
+	"\r":      "enter",
+	"\n":      "enter",
+	"\t":      "tab",
+	"\x7f":    "backspace",
+	"\b":      "backspace",
+	"\x03":    "ctrl+c",
+	"\x0e":    "ctrl+n",
+	"\x10":    "ctrl+p",
+}
+
+// parseKeys splits what was read from the terminal into key presses;
+// unknown escape sequences and control characters are dropped
+func parseKeys(b []byte) []screenKey {
+	var keys []screenKey
+	for len(b) > 0 {
+		n := 1
+		if b[0] == '\x1b' && len(b) > 1 {
+			n = escapeLen(b)
+		} else if b[0] >= utf8.RuneSelf {
+			_, n = utf8.DecodeRune(b)
+		}
+
+		seq := string(b[:n])
+		if key, ok := screenKeys[seq]; ok {
+			keys = append(keys, key)
+		} else if n > 1 && b[0] != '\x1b' || n == 1 && b[0] >= ' ' {
+			keys = append(keys, screenKey(seq))
+		}
+		b = b[n:]
+	}
+	return keys
+}
+
+// escapeLen returns the length of the escape sequence b starts with: ESC [
+// or ESC O, then parameters up to a final letter or ~
+func escapeLen(b []byte) int {
+	if b[1] != '[' && b[1] != 'O' {
+		return 1
+	}
+	for i := 2; i < len(b); i++ {
+		if c := b[i]; c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '~' {
+			return i + 1
+		}
+	}
+	return len(b)
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []screenKey
+	}{
+		{"arrows", "\x1b[A\x1b[B\x1bOA", []screenKey{"up", "down", "up"}},
+		{"typed text", "nx d", []screenKey{"n", "x", " ", "d"}},
+		{"multibyte rune", "é", []screenKey{"é"}},
+		{"control keys", "\r\t\x7f\x03", []screenKey{"enter", "tab", "backspace", "ctrl+c"}},
+		{"lone escape", "\x1b", []screenKey{"esc"}},
+		{"escape then a letter", "\x1bq", []screenKey{"esc", "q"}},
+		{"unknown sequence", "\x1b[15~a", []screenKey{"a"}},
+		{"unknown control character", "\x01a", []screenKey{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseKeys([]byte(tt.input)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseKeys(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScreenKeyTyped(t *testing.T) {
+	if text, typed := screenKey("q").typed(); !typed || text != "q" {
+		t.Errorf(`typed() = %q, %v for "q", want it typed`, text, typed)
+	}
+	if _, typed := screenKey("up").typed(); typed {
+		t.Error(`typed() for "up" reports text`)
+	}
+}
+
+func TestDrawScreen(t *testing.T) {
+	var b strings.Builder
+	drawScreen(&b, "one\ntwo\n")
+	if got, want := b.String(), "\033[Hone\033[K\r\ntwo\033[K\r\n\033[J"; got != want {
+		t.Errorf("drawScreen() wrote %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package cli
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyResize returns a channel that receives when the terminal is
+// resized, and a func to stop it
+func notifyResize() (<-chan os.Signal, func()) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	return winch, func() { signal.Stop(winch) }
+}
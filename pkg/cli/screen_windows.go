@@ -0,0 +1,9 @@
+package cli
+
+import "os"
+
+// notifyResize returns a nil channel: Windows has no resize signal, so the
+// size is only read when the screen starts
+func notifyResize() (<-chan os.Signal, func()) {
+	return nil, func() {}
+}
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/phinze/bankshot/pkg/config"
+	"github.com/phinze/bankshot/pkg/forwarder"
+	"github.com/spf13/cobra"
+)
+
+// remoteSocketPath is where bankshot on the remote host looks for the
+// daemon's socket by default
+const remoteSocketPath = "~/.bankshot.sock"
+
+func newSSHCmd() *cobra.Command {
+	var reconcile, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "ssh [flags] <host> [ssh args...]",
+		Short: "Connect to a host with the SSH options bankshot needs",
+		Long: `Runs ssh to host with whatever ssh_config doesn't already set up for it:
+ControlMaster, a ControlPath, and the RemoteForward of the daemon's socket to
+~/.bankshot.sock. Anything after host is passed on to ssh, so a new host can
+be used with bankshot without editing ~/.ssh/config first:
+
+  bankshot ssh devbox
+  bankshot ssh --reconcile devbox -A tmux attach
+
+Hosts without a ControlPath get ` + forwarder.DefaultControlPath + `, which
+the daemon also looks for. With --reconcile, ssh runs ` + "`bankshot reconcile`" + `
+once it has connected, so forwards from an earlier connection come back
+without waiting for the daemon's next pass.
+
+` + "`bankshot doctor <host>`" + ` shows what to add to ~/.ssh/config to get the same
+from plain ssh.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load("")
+			if err == nil {
+				err = cfg.Validate()
+			}
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			sshArgs, err := sshBootstrapArgs(cfg, args[0], reconcile)
+			if err != nil {
+				return err
+			}
+			sshArgs = append(sshArgs, args...)
+
+			if dryRun {
+				fmt.Println(shellCommandLine(cfg.SSHCommand, sshArgs))
+				return nil
+			}
+
+			sshCmd := exec.Command(cfg.SSHCommand, sshArgs...)
+			sshCmd.Stdin = os.Stdin
+			sshCmd.Stdout = os.Stdout
+			sshCmd.Stderr = os.Stderr
+
+			// ssh handles ^C itself; bankshot just waits for it to exit
+			signal.Notify(make(chan os.Signal, 1), os.Interrupt)
+
+			err = sshCmd.Run()
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				os.Exit(exitErr.ExitCode())
+			}
+			if err != nil {
+				return fmt.Errorf("failed to run ssh: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().BoolVar(&reconcile, "reconcile", false, "Run `bankshot reconcile` once connected")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Print the ssh command instead of running it")
+
+	return cmd
+}
+
+// sshBootstrapArgs returns the -o options ssh needs for host on top of what
+// ssh_config already sets
+func sshBootstrapArgs(cfg *config.Config, host string, reconcile bool) ([]string, error) {
+	output, err := exec.Command(cfg.SSHCommand, "-G", host).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ssh -G %s failed: %w", host, err)
+	}
+	settings := parseSSHSettings(output)
+
+	var args []string
+	option := func(name, value string) {
+		args = append(args, "-o", name+"="+value)
+	}
+
+	switch settings.controlMaster {
+	case "", "false", "no":
+		option("ControlMaster", "auto")
+		option("ControlPersist", "10m")
+	}
+	if settings.controlPath == "" {
+		option("ControlPath", forwarder.DefaultControlPath)
+	}
+
+	socket := filepath.Base(cfg.Address)
+	if cfg.Network == "tcp" {
+		socket = cfg.Address
+	}
+	forwarded := false
+	for _, rf := range settings.remoteForwards {
+		if strings.HasSuffix(rf, socket) {
+			forwarded = true
+		}
+	}
+	if !forwarded {
+		option("RemoteForward", remoteSocketPath+" "+cfg.Address)
+	}
+
+	if reconcile {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the bankshot executable: %w", err)
+		}
+		// LocalCommand expands % tokens
+		exe = strings.ReplaceAll(exe, "%", "%%")
+		option("PermitLocalCommand", "yes")
+		option("LocalCommand", shellQuote(exe)+" reconcile")
+	}
+
+	return args, nil
+}
+
+// shellCommandLine returns name and args as a POSIX shell would run them
+func shellCommandLine(name string, args []string) string {
+	words := []string{shellQuote(name)}
+	for _, arg := range args {
+		words = append(words, shellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// shellQuote quotes s for a POSIX shell when it needs it
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`;&|<>()*?[]#~!{}") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,12 @@
+package cli
+
+import "testing"
+
+func TestShellCommandLine(t *testing.T) {
+	args := []string{"-o", "ControlPath=~/.ssh/bankshot-%r@%h:%p", "-o", "RemoteForward=/run/b.sock /tmp/it's.sock", "devbox", ""}
+	got := shellCommandLine("/opt/my ssh/ssh", args)
+	want := `'/opt/my ssh/ssh' -o 'ControlPath=~/.ssh/bankshot-%r@%h:%p' -o 'RemoteForward=/run/b.sock /tmp/it'\''s.sock' devbox ''`
+	if got != want {
+		t.Errorf("shellCommandLine() = %s, want %s", got, want)
+	}
+}
@@ -4,33 +4,66 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/config"
+	"github.com/phinze/bankshot/pkg/monitor"
 	"github.com/phinze/bankshot/pkg/protocol"
 	"github.com/spf13/cobra"
 )
 
 func newStatusCmd() *cobra.Command {
+	var remote bool
+
 	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Get daemon status",
-		Long:  `Retrieves the current status of the bankshot daemon and monitor if available.`,
-		Args:  cobra.NoArgs,
+		Long: `Retrieves the current status of the bankshot daemon and monitor if available.
+
+With -v, it adds the daemon's PID, memory and goroutine use, the config file
+and socket it uses, the ssh it runs, and the ControlMaster sockets it found,
+which is worth including in bug reports.
+
+--output json or --output yaml prints the daemon's status response alone (or
+with --remote, the monitor's), for scripts.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			structured, err := structuredOutput()
+			if err != nil {
+				return err
+			}
+
+			if remote {
+				return showRemoteMonitorStatus(structured)
+			}
+
 			// Always check monitor status first (if systemctl is available)
-			if err := showMonitorStatus(); err != nil {
-				// Don't fail if monitor isn't available, just note it
-				if verbose {
-					fmt.Fprintf(os.Stderr, "Monitor: %v\n", err)
+			if !structured {
+				if err := showMonitorStatus(); err != nil {
+					// Don't fail if monitor isn't available, just note it
+					if verbose {
+						fmt.Fprintf(os.Stderr, "Monitor: %v\n", err)
+					}
 				}
+				showUDPListeners()
 			}
 
+			// Only -v shows the environment, which takes the daemon a scan
+			// for control sockets
+			payload, err := json.Marshal(protocol.StatusRequest{Environment: verbose})
+			if err != nil {
+				return err
+			}
 			req := protocol.Request{
-				ID:   uuid.New().String(),
-				Type: protocol.CommandStatus,
+				ID:      uuid.New().String(),
+				Type:    protocol.CommandStatus,
+				Payload: payload,
 			}
 
 			resp, err := sendRequest(&req)
@@ -39,7 +72,7 @@ func newStatusCmd() *cobra.Command {
 			}
 
 			if !resp.Success {
-				return fmt.Errorf("failed to get status: %s", resp.Error)
+				return requestFailed(fmt.Errorf("failed to get status: %s", resp.Error))
 			}
 
 			var status protocol.StatusResponse
@@ -47,26 +80,181 @@ func newStatusCmd() *cobra.Command {
 				return fmt.Errorf("failed to parse status: %w", err)
 			}
 
-			fmt.Printf("Daemon Status:\n")
-			fmt.Printf("  Version: %s\n", status.Version)
-			fmt.Printf("  Uptime: %s\n", status.Uptime)
-			fmt.Printf("  Active Forwards: %d\n", status.ActiveForwards)
+			if structured {
+				return printStructured(stdout, status)
+			}
+
+			fmt.Fprintf(stdout, "Daemon Status:\n")
+			fmt.Fprintf(stdout, "  Version: %s\n", status.Version)
+			fmt.Fprintf(stdout, "  Uptime: %s\n", status.Uptime)
+			fmt.Fprintf(stdout, "  Active Forwards: %d\n", status.ActiveForwards)
 
 			if len(status.Connections) > 0 {
-				fmt.Printf("\nActive Connections:\n")
+				fmt.Fprintf(stdout, "\nActive Connections:\n")
 				for _, conn := range status.Connections {
-					fmt.Printf("  %s: %d forwards (last activity: %s)\n",
+					fmt.Fprintf(stdout, "  %s: %d forwards (last activity: %s)\n",
 						conn.ConnectionInfo, conn.ForwardCount, conn.LastActivity)
+					if conn.Stats != nil {
+						fmt.Fprintf(stdout, "    %s\n", formatStats(conn.Stats))
+					}
+				}
+			}
+
+			if len(status.NamedForwards) > 0 {
+				fmt.Fprintf(stdout, "\nNamed Forwards:\n")
+				for _, fw := range status.NamedForwards {
+					remote := net.JoinHostPort(fw.Host, strconv.Itoa(fw.RemotePort))
+					if fw.RemoteSocket != "" {
+						remote = fw.RemoteSocket
+					}
+					fmt.Fprintf(stdout, "  %s: %s %s -> %s\n",
+						fw.Name, fw.ConnectionInfo, remote, fw.LocalTarget())
 				}
 			}
 
+			if len(status.Groups) > 0 {
+				fmt.Fprintf(stdout, "\nPort Ranges:\n")
+				for _, g := range status.Groups {
+					fmt.Fprintf(stdout, "  %s: %s (%d/%d active, %d pending)\n",
+						g.ConnectionInfo, g.Group, g.Active, g.Ports, g.Pending)
+				}
+			}
+
+			if len(status.PendingRetries) > 0 {
+				fmt.Fprintf(stdout, "\nPending Retries:\n")
+				for _, r := range status.PendingRetries {
+					remote := net.JoinHostPort(r.Host, strconv.Itoa(r.RemotePort))
+					if r.RemoteSocket != "" {
+						remote = r.RemoteSocket
+					}
+					fmt.Fprintf(stdout, "  %s: %s -> %s (attempts: %d, next: %s)\n",
+						r.ConnectionInfo, remote, localTarget(r.LocalPort, r.LocalSocket), r.Attempts, r.NextAttempt)
+					fmt.Fprintf(stdout, "    last error: %s\n", r.LastError)
+				}
+			}
+
+			if verbose && status.Environment != nil {
+				printDaemonEnvironment(status.Environment)
+			}
+
 			return nil
 		},
 	}
 
+	cmd.Flags().BoolVar(&remote, "remote", false, "Report the monitor running on this host instead of the daemon")
+
 	return cmd
 }
 
+// printDaemonEnvironment shows what status -v adds about the daemon process
+// and its setup, the details a bug report needs
+func printDaemonEnvironment(env *protocol.DaemonEnvironment) {
+	configPath := env.ConfigPath
+	if configPath == "" {
+		configPath = "none (defaults)"
+	}
+	sshCommand := env.SSHCommand
+	if env.SSHCommandPath == "" {
+		sshCommand += " (not found on PATH)"
+	} else if env.SSHCommandPath != env.SSHCommand {
+		sshCommand += " (" + env.SSHCommandPath + ")"
+	}
+
+	fmt.Fprintf(stdout, "\nEnvironment:\n")
+	fmt.Fprintf(stdout, "  PID: %d\n", env.PID)
+	fmt.Fprintf(stdout, "  Platform: %s, %s\n", env.Platform, env.GoVersion)
+	fmt.Fprintf(stdout, "  Memory: %s (heap %s)\n", formatBytes(env.MemoryBytes), formatBytes(env.HeapBytes))
+	fmt.Fprintf(stdout, "  Goroutines: %d\n", env.Goroutines)
+	fmt.Fprintf(stdout, "  Config: %s\n", configPath)
+	fmt.Fprintf(stdout, "  Socket: %s (%s)\n", env.Address, env.Network)
+	fmt.Fprintf(stdout, "  SSH Command: %s\n", sshCommand)
+
+	if len(env.ControlSockets) == 0 {
+		fmt.Fprintf(stdout, "  ControlMaster Sockets: none found\n")
+		return
+	}
+	fmt.Fprintf(stdout, "  ControlMaster Sockets:\n")
+	for _, conn := range env.ControlSockets {
+		name := conn.ConnectionInfo
+		if name == "" {
+			name = "(unknown host)"
+		}
+		fmt.Fprintf(stdout, "    %s: %s\n", name, conn.SocketPath)
+	}
+}
+
+// showRemoteMonitorStatus asks the monitor on this host, over its control
+// socket, what it's forwarding
+func showRemoteMonitorStatus(structured bool) error {
+	cfg, err := config.Load("")
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.Monitor.ControlSocket == "" {
+		return fmt.Errorf("monitor.controlSocket is not configured")
+	}
+
+	resp, err := sendRequestTo(cfg.Monitor.ControlSocket, &protocol.Request{
+		ID:   uuid.New().String(),
+		Type: protocol.CommandMonitorStatus,
+	})
+	if err != nil {
+		return fmt.Errorf("%w (is bankshot monitor running?)", err)
+	}
+	if !resp.Success {
+		return requestFailed(fmt.Errorf("failed to get monitor status: %s", resp.Error))
+	}
+
+	var status protocol.MonitorStatusResponse
+	if err := json.Unmarshal(resp.Data, &status); err != nil {
+		return fmt.Errorf("failed to parse monitor status: %w", err)
+	}
+
+	if structured {
+		return printStructured(stdout, status)
+	}
+
+	fmt.Fprintf(stdout, "Monitor Status:\n")
+	fmt.Fprintf(stdout, "  Session: %s\n", status.SessionID)
+	fmt.Fprintf(stdout, "  Port Source: %s\n", status.Source)
+	fmt.Fprintf(stdout, "  Uptime: %s\n", status.Uptime)
+	switch {
+	case status.LastReconcile == "":
+		fmt.Fprintf(stdout, "  Last Reconcile: never\n")
+	case status.LastReconcileError != "":
+		fmt.Fprintf(stdout, "  Last Reconcile: %s (failed: %s)\n", status.LastReconcile, status.LastReconcileError)
+	default:
+		fmt.Fprintf(stdout, "  Last Reconcile: %s\n", status.LastReconcile)
+	}
+	fmt.Fprintf(stdout, "  Active Forwards: %d\n", len(status.Forwards))
+	fmt.Fprintf(stdout, "  Pending Removals: %d\n", status.PendingRemovals)
+	if status.SettlingPorts > 0 || status.ProbingPorts > 0 {
+		fmt.Fprintf(stdout, "  Settling Ports: %d, Probing Ports: %d\n", status.SettlingPorts, status.ProbingPorts)
+	}
+	if status.UDPListeners > 0 {
+		fmt.Fprintf(stdout, "  UDP Listeners (not forwarded): %d\n", status.UDPListeners)
+	}
+
+	if len(status.Forwards) > 0 {
+		fmt.Fprintf(stdout, "\nForwards:\n")
+		for _, fw := range status.Forwards {
+			line := fmt.Sprintf("  %s -> %s", remoteTarget(fw.RemotePort, fw.RemoteSocket), localTarget(fw.LocalPort, fw.LocalSocket))
+			if fw.ProcessName != "" {
+				line += fmt.Sprintf(" (%s, pid %d)", fw.ProcessName, fw.PID)
+			}
+			if fw.RemovalPending != "" {
+				line += fmt.Sprintf(" [closed since %s, removal pending]", fw.RemovalPending)
+			}
+			fmt.Fprintln(stdout, line)
+		}
+	}
+
+	return nil
+}
+
 // showMonitorStatus displays the status of the bankshot-monitor systemd service
 func showMonitorStatus() error {
 	// Check if systemctl exists
@@ -93,7 +281,7 @@ func showMonitorStatus() error {
 	statusOutput := out.String()
 
 	// Parse the output to get key information
-	var uptime, memory, cpu string
+	var uptime, memory, cpu, source string
 	lines := strings.Split(statusOutput, "\n")
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -117,28 +305,37 @@ func showMonitorStatus() error {
 			if len(parts) >= 2 {
 				cpu = parts[1]
 			}
+		} else if strings.HasPrefix(line, "Status:") {
+			// The monitor reports its port event source in its sd_notify
+			// status: Status: "Monitor monitoring ports (source: ebpf)"
+			if idx := strings.Index(line, "(source: "); idx > 0 {
+				source = strings.TrimSuffix(strings.TrimSuffix(line[idx+len("(source: "):], "\""), ")")
+			}
 		}
 	}
 
 	// Display monitor status
-	fmt.Printf("Monitor Status:\n")
+	fmt.Fprintf(stdout, "Monitor Status:\n")
 	if isActive && status == "active" {
-		fmt.Printf("  State: \033[32m●\033[0m Running\n")
+		fmt.Fprintf(stdout, "  State: \033[32m●\033[0m Running\n")
 		if uptime != "" {
-			fmt.Printf("  Since: %s\n", uptime)
+			fmt.Fprintf(stdout, "  Since: %s\n", uptime)
 		}
 		if memory != "" {
-			fmt.Printf("  Memory: %s\n", memory)
+			fmt.Fprintf(stdout, "  Memory: %s\n", memory)
 		}
 		if cpu != "" {
-			fmt.Printf("  CPU: %s\n", cpu)
+			fmt.Fprintf(stdout, "  CPU: %s\n", cpu)
+		}
+		if source != "" {
+			fmt.Fprintf(stdout, "  Port Source: %s\n", source)
 		}
 	} else if status == "inactive" || status == "dead" {
-		fmt.Printf("  State: \033[90m○\033[0m Not running\n")
+		fmt.Fprintf(stdout, "  State: \033[90m○\033[0m Not running\n")
 	} else if status == "failed" {
-		fmt.Printf("  State: \033[31m×\033[0m Failed\n")
+		fmt.Fprintf(stdout, "  State: \033[31m×\033[0m Failed\n")
 	} else {
-		fmt.Printf("  State: \033[33m?\033[0m %s\n", status)
+		fmt.Fprintf(stdout, "  State: \033[33m?\033[0m %s\n", status)
 	}
 
 	// Check for any active monitor sessions
@@ -156,11 +353,57 @@ func showMonitorStatus() error {
 				}
 			}
 			if activeMonitors > 0 {
-				fmt.Printf("  Active Monitors: %d\n", activeMonitors)
+				fmt.Fprintf(stdout, "  Active Monitors: %d\n", activeMonitors)
 			}
 		}
 	}
 
-	fmt.Println() // Empty line separator
+	fmt.Fprintln(stdout) // Empty line separator
 	return nil
 }
+
+// showUDPListeners lists this host's bound UDP ports when monitor.udp is
+// enabled, using the monitor's port filters. ssh can't forward UDP, so this
+// is the only place they show up.
+func showUDPListeners() {
+	cfg, err := config.Load("")
+	if err != nil || !cfg.Monitor.UDP {
+		return
+	}
+
+	var portRanges []monitor.PortRange
+	for _, pr := range cfg.Monitor.PortRanges {
+		portRanges = append(portRanges, monitor.PortRange{
+			Start:         pr.Start,
+			End:           pr.End,
+			NoAutoForward: pr.AutoForward != nil && !*pr.AutoForward,
+		})
+	}
+	ignorePorts := make(map[int]bool, len(cfg.Monitor.IgnorePorts))
+	for _, p := range cfg.Monitor.IgnorePorts {
+		ignorePorts[p] = true
+	}
+
+	ports, _ := monitor.GetUDPPorts()
+	var listeners []monitor.Port
+	for _, p := range ports {
+		if monitor.ShouldForwardPort(p.Port, p.BindAddr, portRanges, ignorePorts) {
+			listeners = append(listeners, p)
+		}
+	}
+	if len(listeners) == 0 {
+		return
+	}
+	sort.Slice(listeners, func(i, j int) bool {
+		if listeners[i].Port != listeners[j].Port {
+			return listeners[i].Port < listeners[j].Port
+		}
+		return listeners[i].Protocol < listeners[j].Protocol
+	})
+
+	fmt.Fprintf(stdout, "UDP Listeners (not forwarded):\n")
+	for _, p := range listeners {
+		fmt.Fprintf(stdout, "  %s (%s)\n", net.JoinHostPort(p.BindAddr, strconv.Itoa(p.Port)), p.Protocol)
+	}
+	fmt.Fprintln(stdout)
+}
@@ -0,0 +1,602 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+// tuiRefresh is how often the dashboard asks the daemon for its state
+const tuiRefresh = time.Second
+
+// tuiHealthInterval is how often --health has the daemon probe every
+// forward's local end; the refreshes in between show the last results
+const tuiHealthInterval = 10 * time.Second
+
+// tuiEvents is how many recent events the dashboard shows
+const tuiEvents = 10
+
+// Orders the dashboard can list forwards in
+const (
+	tuiSortConnection = "connection"
+	tuiSortAge        = "age"
+	tuiSortTraffic    = "traffic"
+)
+
+func newTUICmd() *cobra.Command {
+	var opts tuiOptions
+
+	cmd := &cobra.Command{
+		Use:     "tui",
+		Aliases: []string{"watch"},
+		Short:   "Show a live dashboard of forwards and connections",
+		Long: `TUI shows the daemon's forwards and connections, refreshed every second,
+along with recent events: forwards as they come and go, and URLs opened.
+
+Keys: up/down (or k/j) select a forward, enter or o opens it in the browser,
+u or d removes it, r refreshes, and q quits.
+
+--connection and --name show only the matching forwards. --sort orders them
+by connection (the default), age (newest first), or traffic (busiest first,
+when the daemon's accounting is on). --health marks forwards whose local end
+isn't accepting connections, checked every 10 seconds.
+
+--compact prints a single summary line instead, again whenever it changes,
+for a tmux status line:
+
+  set -g status-right '#(bankshot watch --compact --health)'`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch opts.sortBy {
+			case tuiSortConnection, tuiSortAge, tuiSortTraffic:
+			default:
+				return fmt.Errorf("invalid --sort %q: must be connection, age, or traffic", opts.sortBy)
+			}
+			if opts.compact {
+				return runCompactWatch(cmd.Context(), opts)
+			}
+			return runScreen(newTUIModel(opts))
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.connection, "connection", "c", "", "Only show forwards of this SSH connection")
+	cmd.Flags().StringVar(&opts.name, "name", "", "Only show forwards with this name")
+	cmd.Flags().StringVar(&opts.sortBy, "sort", tuiSortConnection, "Order forwards by connection, age, or traffic")
+	cmd.Flags().BoolVar(&opts.health, "health", false, "Check that each forward's local end accepts connections")
+	cmd.Flags().BoolVar(&opts.compact, "compact", false, "Print one summary line per change instead of the dashboard")
+	_ = cmd.RegisterFlagCompletionFunc("connection", completeConnections)
+	return cmd
+}
+
+// tuiOptions choose which forwards the dashboard shows and how
+type tuiOptions struct {
+	connection string
+	name       string
+	sortBy     string
+	health     bool
+	compact    bool
+}
+
+// arrange filters forwards down to those opts shows and sorts them
+func (opts tuiOptions) arrange(forwards []protocol.ForwardInfo) []protocol.ForwardInfo {
+	shown := make([]protocol.ForwardInfo, 0, len(forwards))
+	for _, fw := range forwards {
+		if opts.connection != "" && fw.ConnectionInfo != opts.connection {
+			continue
+		}
+		if opts.name != "" && fw.Name != opts.name {
+			continue
+		}
+		shown = append(shown, fw)
+	}
+
+	sort.SliceStable(shown, func(i, j int) bool {
+		a, b := shown[i], shown[j]
+		switch opts.sortBy {
+		case tuiSortAge:
+			if ta, tb := forwardCreatedAt(a), forwardCreatedAt(b); !ta.Equal(tb) {
+				return ta.After(tb)
+			}
+		case tuiSortTraffic:
+			if ta, tb := forwardTraffic(a), forwardTraffic(b); ta != tb {
+				return ta > tb
+			}
+		}
+		if a.ConnectionInfo != b.ConnectionInfo {
+			return a.ConnectionInfo < b.ConnectionInfo
+		}
+		if a.RemotePort != b.RemotePort {
+			return a.RemotePort < b.RemotePort
+		}
+		return a.RemoteSocket < b.RemoteSocket
+	})
+	return shown
+}
+
+// forwardCreatedAt is when a forward was made, or the zero time if the
+// daemon didn't say
+func forwardCreatedAt(fw protocol.ForwardInfo) time.Time {
+	created, err := time.Parse(time.RFC3339, fw.CreatedAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return created
+}
+
+// forwardTraffic is the bytes a forward has carried both ways, or 0 without
+// accounting
+func forwardTraffic(fw protocol.ForwardInfo) uint64 {
+	if fw.Stats == nil {
+		return 0
+	}
+	return fw.Stats.BytesSent + fw.Stats.BytesReceived
+}
+
+// runCompactWatch prints a one-line summary of the forwards opts shows each
+// time it changes, until ctx is done
+func runCompactWatch(ctx context.Context, opts tuiOptions) error {
+	last := ""
+	var health healthCache
+	for {
+		line := "bankshot: "
+		var list protocol.ListResponse
+		checkHealth := opts.health && health.due(time.Now())
+		if err := queryDaemon(protocol.CommandList, protocol.ListRequest{CheckHealth: checkHealth}, &list); err != nil {
+			line += "daemon unreachable"
+		} else {
+			if opts.health {
+				health.apply(list.Forwards, checkHealth)
+			}
+			line += compactSummary(opts.arrange(list.Forwards))
+		}
+		if line != last {
+			fmt.Println(line)
+			last = line
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(tuiRefresh):
+		}
+	}
+}
+
+// healthCache spaces out --health's probes, which dial every forward,
+// carrying each forward's last result over the refreshes that don't probe
+type healthCache struct {
+	checkedAt time.Time
+	healthy   map[string]bool // by tuiKey
+}
+
+// due reports whether the next refresh should probe, counting it as probed
+func (c *healthCache) due(now time.Time) bool {
+	if now.Sub(c.checkedAt) < tuiHealthInterval {
+		return false
+	}
+	c.checkedAt = now
+	return true
+}
+
+// apply remembers the results of a refresh that probed, or fills in the
+// last ones for a refresh that didn't
+func (c *healthCache) apply(forwards []protocol.ForwardInfo, checked bool) {
+	if checked {
+		c.healthy = make(map[string]bool, len(forwards))
+		for _, fw := range forwards {
+			if fw.Healthy != nil {
+				c.healthy[tuiKey(fw)] = *fw.Healthy
+			}
+		}
+		return
+	}
+	for i := range forwards {
+		if healthy, ok := c.healthy[tuiKey(forwards[i])]; ok {
+			forwards[i].Healthy = &healthy
+		}
+	}
+}
+
+// compactSummary lists forwards by name or remote port, marking those
+// whose local end is down
+func compactSummary(forwards []protocol.ForwardInfo) string {
+	if len(forwards) == 0 {
+		return "no forwards"
+	}
+	parts := make([]string, 0, len(forwards))
+	for _, fw := range forwards {
+		part := fw.Name
+		if part == "" {
+			part = remoteTarget(fw.RemotePort, fw.RemoteSocket)
+		}
+		if fw.Healthy != nil && !*fw.Healthy {
+			part += "✗"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// tuiEvent is one line of the dashboard's recent events
+type tuiEvent struct {
+	at   time.Time
+	text string
+}
+
+// tuiModel is the dashboard's state
+type tuiModel struct {
+	opts     tuiOptions
+	forwards []protocol.ForwardInfo
+	status   *protocol.StatusResponse
+	events   []tuiEvent
+	selected string // tuiKey of the selected forward
+	health   healthCache
+
+	// known holds the forwards of the last refresh by tuiKey, to report
+	// those that came and went since; nil before the first refresh
+	known map[string]protocol.ForwardInfo
+	// lastOpen is the newest open seen in the daemon's history
+	lastOpen *protocol.HistoryEntry
+
+	message string // Outcome of the last action, or why the last refresh failed
+}
+
+// Messages the dashboard's commands send back
+type (
+	tuiTickMsg    struct{}
+	tuiRefreshMsg struct {
+		list    protocol.ListResponse
+		checked bool // Whether list's forwards were probed for --health
+		status  protocol.StatusResponse
+		history *protocol.HistoryResponse // nil if the daemon couldn't say
+		err     error
+	}
+	tuiActionMsg struct {
+		text string
+		err  error
+	}
+)
+
+func newTUIModel(opts tuiOptions) *tuiModel {
+	return &tuiModel{opts: opts}
+}
+
+func (m *tuiModel) start() screenCmd {
+	return m.fetch()
+}
+
+func (m *tuiModel) update(msg any) screenCmd {
+	switch msg := msg.(type) {
+	case screenKey:
+		return m.handleKey(msg)
+
+	case tuiTickMsg:
+		return m.fetch()
+
+	case tuiRefreshMsg:
+		if msg.err != nil {
+			m.message = fmt.Sprintf("refresh failed: %v", msg.err)
+			return tuiTick
+		}
+		if strings.HasPrefix(m.message, "refresh failed") {
+			m.message = ""
+		}
+		m.applyRefresh(msg)
+		return tuiTick
+
+	case tuiActionMsg:
+		if msg.err != nil {
+			m.message = msg.err.Error()
+		} else {
+			m.message = msg.text
+		}
+		return m.fetch()
+	}
+	return nil
+}
+
+// fetch asks the daemon for its state, probing the forwards when --health
+// is due to
+func (m *tuiModel) fetch() screenCmd {
+	return tuiFetch(m.opts.health && m.health.due(time.Now()))
+}
+
+// handleKey acts on a key press
+func (m *tuiModel) handleKey(key screenKey) screenCmd {
+	switch key {
+	case "q", "esc", "ctrl+c":
+		return screenQuit
+	case "up", "k":
+		m.moveSelection(-1)
+	case "down", "j":
+		m.moveSelection(1)
+	case "r":
+		return m.fetch()
+	case "enter", "o":
+		if fw, ok := m.selectedForward(); ok {
+			return tuiOpen(fw)
+		}
+	case "u", "d", "delete":
+		if fw, ok := m.selectedForward(); ok {
+			m.message = fmt.Sprintf("removing %s...", remoteTarget(fw.RemotePort, fw.RemoteSocket))
+			return tuiUnforward(fw)
+		}
+	}
+	return nil
+}
+
+// applyRefresh takes in the daemon's latest state, noting the forwards that
+// came and went and the URLs opened since the last refresh
+func (m *tuiModel) applyRefresh(msg tuiRefreshMsg) {
+	now := time.Now()
+	if m.opts.health {
+		m.health.apply(msg.list.Forwards, msg.checked)
+	}
+	forwards := m.opts.arrange(msg.list.Forwards)
+
+	current := make(map[string]protocol.ForwardInfo, len(forwards))
+	for _, fw := range forwards {
+		key := tuiKey(fw)
+		current[key] = fw
+		if _, seen := m.known[key]; m.known != nil && !seen {
+			m.addEvent(now, fmt.Sprintf("forwarded %s -> %s (%s)",
+				remoteTarget(fw.RemotePort, fw.RemoteSocket), fw.LocalTarget(), fw.ConnectionInfo))
+		}
+	}
+	for key, fw := range m.known {
+		if _, still := current[key]; !still {
+			m.addEvent(now, fmt.Sprintf("removed %s (%s)",
+				remoteTarget(fw.RemotePort, fw.RemoteSocket), fw.ConnectionInfo))
+		}
+	}
+	m.known = current
+	m.forwards = forwards
+	m.status = &msg.status
+
+	if msg.history != nil {
+		m.applyHistory(msg.history.Entries)
+	}
+
+	if _, ok := current[m.selected]; !ok {
+		m.selected = ""
+		if len(forwards) > 0 {
+			m.selected = tuiKey(forwards[0])
+		}
+	}
+}
+
+// applyHistory adds the opens newer than the last one seen to the events.
+// Entries are oldest first.
+func (m *tuiModel) applyHistory(entries []protocol.HistoryEntry) {
+	start := 0
+	if m.lastOpen != nil {
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i] == *m.lastOpen {
+				start = i + 1
+				break
+			}
+		}
+	}
+	for _, e := range entries[start:] {
+		if m.opts.connection != "" && e.ConnectionInfo != m.opts.connection {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, e.OpenedAt)
+		if err != nil {
+			at = time.Now()
+		}
+		source := e.ConnectionInfo
+		if e.ProcessName != "" {
+			source += "/" + e.ProcessName
+		}
+		text := fmt.Sprintf("opened %s (%s)", e.URL, source)
+		if e.Denied {
+			text = fmt.Sprintf("denied opening %s (%s): %s", e.URL, source, e.Reason)
+		}
+		m.addEvent(at, text)
+	}
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		m.lastOpen = &last
+	}
+}
+
+// addEvent records an event, keeping the latest tuiEvents in time order
+func (m *tuiModel) addEvent(at time.Time, text string) {
+	m.events = append(m.events, tuiEvent{at: at, text: text})
+	sort.SliceStable(m.events, func(i, j int) bool { return m.events[i].at.Before(m.events[j].at) })
+	if len(m.events) > tuiEvents {
+		m.events = m.events[len(m.events)-tuiEvents:]
+	}
+}
+
+// moveSelection moves the selection by delta forwards, stopping at either
+// end
+func (m *tuiModel) moveSelection(delta int) {
+	if len(m.forwards) == 0 {
+		return
+	}
+	i := 0
+	for j, fw := range m.forwards {
+		if tuiKey(fw) == m.selected {
+			i = j
+		}
+	}
+	i = max(0, min(len(m.forwards)-1, i+delta))
+	m.selected = tuiKey(m.forwards[i])
+}
+
+// selectedForward returns the selected forward, if there is one
+func (m *tuiModel) selectedForward() (protocol.ForwardInfo, bool) {
+	fw, ok := m.known[m.selected]
+	return fw, ok
+}
+
+func (m *tuiModel) view() string {
+	var b strings.Builder
+
+	if m.status == nil {
+		b.WriteString("Connecting to the daemon...\n")
+	} else {
+		fmt.Fprintf(&b, "bankshot daemon %s, up %s, %d forwards over %d connections\n",
+			m.status.Version, m.status.Uptime, len(m.forwards), len(m.status.Connections))
+	}
+
+	b.WriteString("\nForwards\n")
+	if len(m.forwards) == 0 {
+		b.WriteString("  none\n")
+	}
+	for _, fw := range m.forwards {
+		line := fmt.Sprintf("%s  %s -> %s", fw.ConnectionInfo, remoteTarget(fw.RemotePort, fw.RemoteSocket), fw.LocalTarget())
+		if fw.Name != "" {
+			line += "  [" + fw.Name + "]"
+		}
+		if fw.Owner != "" {
+			line += "  " + fw.Owner
+		}
+		if fw.Stats != nil {
+			line += "  " + formatStats(fw.Stats)
+		}
+		if fw.Healthy != nil && !*fw.Healthy {
+			line += "  \033[31mnot accepting connections\033[0m"
+		}
+		if tuiKey(fw) == m.selected {
+			fmt.Fprintf(&b, "\033[7m> %s\033[0m\n", line)
+		} else {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+
+	if m.status != nil && len(m.status.Connections) > 0 {
+		b.WriteString("\nConnections\n")
+		for _, conn := range m.status.Connections {
+			if m.opts.connection != "" && conn.ConnectionInfo != m.opts.connection {
+				continue
+			}
+			fmt.Fprintf(&b, "  %s: %d forwards (last activity: %s)\n",
+				conn.ConnectionInfo, conn.ForwardCount, conn.LastActivity)
+		}
+	}
+
+	b.WriteString("\nRecent Events\n")
+	if len(m.events) == 0 {
+		b.WriteString("  none yet\n")
+	}
+	for _, e := range m.events {
+		fmt.Fprintf(&b, "  %s  %s\n", e.at.Local().Format("15:04:05"), e.text)
+	}
+
+	b.WriteString("\n\033[90m↑/↓ select · enter open · u unforward · r refresh · q quit\033[0m\n")
+	if m.message != "" {
+		b.WriteString(m.message + "\n")
+	}
+	return b.String()
+}
+
+// tuiKey identifies a forward across refreshes
+func tuiKey(fw protocol.ForwardInfo) string {
+	return fmt.Sprintf("%s|%s|%s|%d|%s", fw.ConnectionInfo, fw.SocketPath, fw.Host, fw.RemotePort, fw.RemoteSocket)
+}
+
+// tuiTick waits until the next refresh is due
+func tuiTick() any {
+	time.Sleep(tuiRefresh)
+	return tuiTickMsg{}
+}
+
+// tuiFetch asks the daemon for its forwards, checking their health if asked,
+// status, and open history
+func tuiFetch(health bool) screenCmd {
+	return func() any {
+		msg := tuiRefreshMsg{checked: health}
+		if err := queryDaemon(protocol.CommandList, protocol.ListRequest{CheckHealth: health}, &msg.list); err != nil {
+			msg.err = err
+			return msg
+		}
+		if err := queryDaemon(protocol.CommandStatus, nil, &msg.status); err != nil {
+			msg.err = err
+			return msg
+		}
+		var history protocol.HistoryResponse
+		if err := queryDaemon(protocol.CommandHistory, nil, &history); err == nil {
+			msg.history = &history
+		}
+		return msg
+	}
+}
+
+// queryDaemon sends the daemon a request with payload, if not nil, and
+// decodes its response's data into out
+func queryDaemon(command protocol.CommandType, payload, out any) error {
+	req := &protocol.Request{
+		ID:   uuid.New().String(),
+		Type: command,
+	}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		req.Payload = data
+	}
+	resp, err := sendRequest(req)
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return requestFailed(errors.New(resp.Error))
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+// tuiUnforward removes a forward
+func tuiUnforward(fw protocol.ForwardInfo) screenCmd {
+	return func() any {
+		target := remoteTarget(fw.RemotePort, fw.RemoteSocket)
+		if err := unforwardInfo(fw); err != nil {
+			return tuiActionMsg{err: fmt.Errorf("failed to remove %s: %w", target, err)}
+		}
+		return tuiActionMsg{text: fmt.Sprintf("removed %s", target)}
+	}
+}
+
+// tuiOpen opens a forward's local end in the browser, through the daemon
+// so it works on either end of the connection
+func tuiOpen(fw protocol.ForwardInfo) screenCmd {
+	return func() any {
+		if fw.LocalSocket != "" {
+			return tuiActionMsg{err: fmt.Errorf("%s is a Unix socket, which a browser can't open", fw.LocalSocket)}
+		}
+		url := fw.LocalURL()
+
+		openReq := protocol.OpenRequest{URL: url, ProcessName: "bankshot"}
+		if hostname, err := os.Hostname(); err == nil {
+			openReq.ConnectionInfo = hostname
+		}
+		payload, err := json.Marshal(openReq)
+		if err != nil {
+			return tuiActionMsg{err: err}
+		}
+		resp, err := sendRequest(&protocol.Request{
+			ID:      uuid.New().String(),
+			Type:    protocol.CommandOpen,
+			Payload: payload,
+		})
+		if err != nil {
+			return tuiActionMsg{err: err}
+		}
+		if !resp.Success {
+			return tuiActionMsg{err: fmt.Errorf("failed to open %s: %s", url, resp.Error)}
+		}
+		return tuiActionMsg{text: fmt.Sprintf("opened %s", url)}
+	}
+}
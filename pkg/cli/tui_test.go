@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+func TestTUIArrange(t *testing.T) {
+	forwards := []protocol.ForwardInfo{
+		{ConnectionInfo: "b", RemotePort: 3000, CreatedAt: "2026-10-16T10:00:00Z"},
+		// Later as a string, but earlier than 3000's
+		{ConnectionInfo: "a", RemotePort: 8080, CreatedAt: "2026-10-16T11:00:00+02:00", Name: "api"},
+		{ConnectionInfo: "a", RemotePort: 5173, CreatedAt: "2026-10-16T11:00:00Z"},
+	}
+	ports := func(forwards []protocol.ForwardInfo) []int {
+		var ports []int
+		for _, fw := range forwards {
+			ports = append(ports, fw.RemotePort)
+		}
+		return ports
+	}
+
+	tests := []struct {
+		name string
+		opts tuiOptions
+		want []int
+	}{
+		{"by connection", tuiOptions{sortBy: tuiSortConnection}, []int{5173, 8080, 3000}},
+		{"by age", tuiOptions{sortBy: tuiSortAge}, []int{5173, 3000, 8080}},
+		{"one connection", tuiOptions{sortBy: tuiSortConnection, connection: "b"}, []int{3000}},
+		{"by name", tuiOptions{sortBy: tuiSortConnection, name: "api"}, []int{8080}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ports(tt.opts.arrange(forwards)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("arrange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthCache(t *testing.T) {
+	var c healthCache
+	now := time.Now()
+	if !c.due(now) {
+		t.Fatal("due() = false before any probe")
+	}
+	if c.due(now.Add(time.Second)) {
+		t.Error("due() = true a second after the last probe")
+	}
+	if !c.due(now.Add(tuiHealthInterval)) {
+		t.Error("due() = false once the interval passed")
+	}
+
+	down := false
+	c.apply([]protocol.ForwardInfo{{RemotePort: 3000, Healthy: &down}}, true)
+	forwards := []protocol.ForwardInfo{{RemotePort: 3000}, {RemotePort: 8080}}
+	c.apply(forwards, false)
+	if forwards[0].Healthy == nil || *forwards[0].Healthy {
+		t.Errorf("3000 healthy = %v, want the last probe's false", forwards[0].Healthy)
+	}
+	if forwards[1].Healthy != nil {
+		t.Errorf("8080 healthy = %v, want unknown until probed", *forwards[1].Healthy)
+	}
+}
+
+func TestTUIRefreshEvents(t *testing.T) {
+	m := newTUIModel(tuiOptions{sortBy: tuiSortConnection})
+	web := protocol.ForwardInfo{ConnectionInfo: "devbox", RemotePort: 3000, LocalPort: 3000}
+	api := protocol.ForwardInfo{ConnectionInfo: "devbox", RemotePort: 8080, LocalPort: 8080}
+
+	m.update(tuiRefreshMsg{list: protocol.ListResponse{Forwards: []protocol.ForwardInfo{web}}})
+	if len(m.events) != 0 {
+		t.Errorf("events after the first refresh = %+v, want none", m.events)
+	}
+	if m.selected != tuiKey(web) {
+		t.Errorf("selected %q, want the only forward", m.selected)
+	}
+
+	m.update(tuiRefreshMsg{list: protocol.ListResponse{Forwards: []protocol.ForwardInfo{api}}})
+	var texts []string
+	for _, e := range m.events {
+		texts = append(texts, e.text)
+	}
+	want := []string{"forwarded 8080 -> localhost:8080 (devbox)", "removed 3000 (devbox)"}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("events = %q, want %q", texts, want)
+	}
+	if m.selected != tuiKey(api) {
+		t.Errorf("selected %q after its forward went, want the remaining one", m.selected)
+	}
+
+	m.update(screenKey("down"))
+	if fw, ok := m.selectedForward(); !ok || fw.RemotePort != 8080 {
+		t.Errorf("selectedForward() = %+v, %v past the end, want the last forward", fw, ok)
+	}
+}
+
+func TestTUIApplyHistory(t *testing.T) {
+	m := newTUIModel(tuiOptions{})
+	first := protocol.HistoryEntry{URL: "http://localhost:3000", ConnectionInfo: "devbox", OpenedAt: time.Now().Format(time.RFC3339)}
+	second := protocol.HistoryEntry{URL: "http://localhost:8080", ConnectionInfo: "devbox", OpenedAt: time.Now().Format(time.RFC3339)}
+
+	m.applyHistory([]protocol.HistoryEntry{first})
+	m.applyHistory([]protocol.HistoryEntry{first, second})
+	if len(m.events) != 2 || !strings.Contains(m.events[1].text, "8080") {
+		t.Errorf("events = %+v, want each open once", m.events)
+	}
+}
+
+func TestCompactSummary(t *testing.T) {
+	down := false
+	forwards := []protocol.ForwardInfo{
+		{RemotePort: 3000, Name: "web"},
+		{RemotePort: 8080, Healthy: &down},
+	}
+	if got, want := compactSummary(forwards), "web 8080✗"; got != want {
+		t.Errorf("compactSummary() = %q, want %q", got, want)
+	}
+	if got, want := compactSummary(nil), "no forwards"; got != want {
+		t.Errorf("compactSummary(nil) = %q, want %q", got, want)
+	}
+}
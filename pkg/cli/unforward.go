@@ -3,7 +3,6 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 
 	"github.com/google/uuid"
 	"github.com/phinze/bankshot/pkg/protocol"
@@ -11,29 +10,59 @@ import (
 )
 
 var (
-	unforwardHost       string
-	unforwardConnection string
+	unforwardHost         string
+	unforwardConnection   string
+	unforwardRemoteSocket string
+	unforwardControlPath  string
+	unforwardName         string
+	unforwardDryRun       bool
 )
 
 func newUnforwardCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "unforward <remote-port>",
+		Use:   "unforward <remote-port|start-end|name>",
 		Short: "Remove a port forward",
-		Long:  `Removes an existing port forward managed by the daemon.`,
-		Args:  cobra.ExactArgs(1),
+		Long: `Removes an existing port forward managed by the daemon.
+Pass a range such as 3000-3010 to remove a port range forwarded as a group.
+Use --remote-socket (with no port argument) to remove a socket forward.
+A forward created with --name can be removed by passing its name instead.
+
+Removing a forward cancels it and then re-establishes the connection's other
+forwards, since OpenSSH drops them along with it. --dry-run prints that whole
+sequence of ssh commands without running it.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var remotePort int
-			if _, err := fmt.Sscanf(args[0], "%d", &remotePort); err != nil {
-				return fmt.Errorf("invalid port: %s", args[0])
+			var remotePort, remotePortEnd int
+			name := unforwardName
+			if name == "" && len(args) == 1 && isForwardName(args[0]) {
+				name = args[0]
+			}
+			switch {
+			case name != "":
+				if unforwardName != "" && len(args) != 0 {
+					return fmt.Errorf("--name does not take a port argument")
+				}
+			case unforwardRemoteSocket != "":
+				if len(args) != 0 {
+					return fmt.Errorf("--remote-socket does not take a port argument")
+				}
+			default:
+				if len(args) != 1 {
+					return fmt.Errorf("requires a remote port argument")
+				}
+				var err error
+				remotePort, remotePortEnd, err = parsePortRange(args[0])
+				if err != nil {
+					return err
+				}
 			}
 
 			connectionInfo := unforwardConnection
 			if connectionInfo == "" {
-				hostname, err := os.Hostname()
-				if err != nil {
-					return fmt.Errorf("failed to get hostname: %w", err)
+				var err error
+				if connectionInfo, err = defaultConnection(); err != nil {
+					return err
 				}
-				connectionInfo = hostname
 			}
 
 			host := unforwardHost
@@ -43,8 +72,13 @@ func newUnforwardCmd() *cobra.Command {
 
 			unforwardReq := protocol.UnforwardRequest{
 				RemotePort:     remotePort,
+				RemotePortEnd:  remotePortEnd,
 				Host:           host,
+				RemoteSocket:   unforwardRemoteSocket,
 				ConnectionInfo: connectionInfo,
+				SocketPath:     unforwardControlPath,
+				Name:           name,
+				DryRun:         unforwardDryRun,
 			}
 
 			payload, err := json.Marshal(unforwardReq)
@@ -64,18 +98,34 @@ func newUnforwardCmd() *cobra.Command {
 			}
 
 			if !resp.Success {
-				return fmt.Errorf("failed to remove forward: %s", resp.Error)
+				return requestFailed(fmt.Errorf("failed to remove forward: %s", resp.Error))
+			}
+
+			if unforwardDryRun {
+				return printDryRun(resp.Data)
 			}
 
 			if verbose {
-				fmt.Printf("Port forward removed: %d\n", remotePort)
+				removed := remoteTarget(remotePort, unforwardRemoteSocket)
+				switch {
+				case name != "":
+					removed = name
+				case remotePortEnd != 0:
+					removed = fmt.Sprintf("%d-%d", remotePort, remotePortEnd)
+				}
+				fmt.Fprintf(stdout, "Port forward removed: %s\n", removed)
 			}
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVarP(&unforwardHost, "host", "H", "localhost", "Remote host")
-	cmd.Flags().StringVarP(&unforwardConnection, "connection", "c", "", "SSH connection identifier")
+	cmd.Flags().StringVarP(&unforwardConnection, "connection", "c", "", "SSH connection identifier (default: this SSH session's)")
+	_ = cmd.RegisterFlagCompletionFunc("connection", completeConnections)
+	cmd.Flags().StringVarP(&unforwardControlPath, "control-socket", "S", "", "SSH control socket of the forward, if the connection has several")
+	cmd.Flags().StringVar(&unforwardRemoteSocket, "remote-socket", "", "Remote Unix socket path of a socket forward")
+	cmd.Flags().StringVar(&unforwardName, "name", "", "Name of the forward to remove")
+	cmd.Flags().BoolVar(&unforwardDryRun, "dry-run", false, "Show the ssh commands that would run without running them")
 
 	return cmd
 }
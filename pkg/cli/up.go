@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/config"
+	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+func newUpCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "up [profile]",
+		Short: "Bring up the forwards of a project profile",
+		Long: `Reads the .bankshot.yaml in this directory or the nearest parent that has
+one, establishes the forwards of the given profile, then opens its URLs:
+
+  profiles:
+    default:
+      forwards:
+        - remote_port: 3000
+          name: web
+        - remote_port: 5432
+          local_port: 15432
+      open:
+        - http://localhost:3000
+
+Forwards are written as in "bankshot export" output, and go through this
+host's connection unless they give a connection_info. Without a profile
+name, the project's only profile is used, or else the one named default.
+"bankshot down" removes the forwards again.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			project, profile, name, err := loadProfile(args)
+			if err != nil {
+				return err
+			}
+			if len(profile.Forwards) == 0 && len(profile.Open) == 0 {
+				fmt.Fprintf(stdout, "Profile %s is empty\n", name)
+				return nil
+			}
+
+			failed := 0
+			if len(profile.Forwards) > 0 {
+				connectionInfo, err := defaultConnection()
+				if err != nil {
+					return err
+				}
+				set := protocol.ForwardSet{}
+				for _, spec := range profile.Forwards {
+					if spec.ConnectionInfo == "" {
+						spec.ConnectionInfo = connectionInfo
+					}
+					set.Forwards = append(set.Forwards, spec)
+				}
+
+				payload, err := json.Marshal(protocol.ImportRequest{
+					ForwardSet: set,
+					Owner:      project.Owner(connectionInfo, name),
+				})
+				if err != nil {
+					return fmt.Errorf("failed to marshal request: %w", err)
+				}
+
+				resp, err := sendRequest(&protocol.Request{
+					ID:      uuid.New().String(),
+					Type:    protocol.CommandImport,
+					Payload: payload,
+				})
+				if err != nil {
+					return err
+				}
+				if !resp.Success {
+					return requestFailed(fmt.Errorf("failed to bring up profile %s: %s", name, resp.Error))
+				}
+
+				var result protocol.ImportResponse
+				if err := json.Unmarshal(resp.Data, &result); err != nil {
+					return fmt.Errorf("failed to parse response: %w", err)
+				}
+				failed = printImportResults(result.Results)
+			}
+
+			for _, url := range profile.Open {
+				if err := openURL(protocol.OpenRequest{URL: url}); err != nil {
+					fmt.Fprintf(stdout, "%s: %v\n", url, err)
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d forwards of profile %s failed", failed, len(profile.Forwards), name)
+			}
+			return nil
+		},
+	}
+}
+
+func newDownCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "down [profile]",
+		Short: "Remove the forwards of a project profile",
+		Long: `Removes the forwards "bankshot up" established for a profile of the
+.bankshot.yaml in this directory or the nearest parent that has one. Forwards
+are found by the profile and host they were brought up for, so ones since
+removed from the file are removed too, while another host's forwards of the
+same project are left alone.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			project, _, name, err := loadProfile(args)
+			if err != nil {
+				return err
+			}
+			connectionInfo, err := defaultConnection()
+			if err != nil {
+				return err
+			}
+			owner := project.Owner(connectionInfo, name)
+
+			resp, err := sendRequest(&protocol.Request{
+				ID:   uuid.New().String(),
+				Type: protocol.CommandList,
+			})
+			if err != nil {
+				return err
+			}
+			if !resp.Success {
+				return requestFailed(fmt.Errorf("failed to list forwards: %s", resp.Error))
+			}
+			var list protocol.ListResponse
+			if err := json.Unmarshal(resp.Data, &list); err != nil {
+				return fmt.Errorf("failed to parse response: %w", err)
+			}
+
+			removed, failed := 0, 0
+			for _, fw := range list.Forwards {
+				if fw.Owner != owner {
+					continue
+				}
+				target := remoteTarget(fw.RemotePort, fw.RemoteSocket)
+				if err := unforwardInfo(fw); err != nil {
+					failed++
+					fmt.Fprintf(stdout, "%s: %v\n", target, err)
+					continue
+				}
+				removed++
+				if verbose {
+					fmt.Fprintf(stdout, "Unforwarded %s\n", target)
+				}
+			}
+
+			switch {
+			case failed > 0:
+				return fmt.Errorf("%d of %d forwards of profile %s failed to unforward", failed, removed+failed, name)
+			case removed == 0:
+				fmt.Fprintf(stdout, "Profile %s has no forwards up\n", name)
+			default:
+				fmt.Fprintf(stdout, "Removed %d forward(s) of profile %s\n", removed, name)
+			}
+			return nil
+		},
+	}
+}
+
+// loadProfile reads the profile named by args, if any, from the project
+// file found from the working directory
+func loadProfile(args []string) (*config.Project, config.Profile, string, error) {
+	project, err := config.FindProject(".")
+	if err != nil {
+		return nil, config.Profile{}, "", err
+	}
+	var name string
+	if len(args) > 0 {
+		name = args[0]
+	}
+	profile, name, err := project.Profile(name)
+	if err != nil {
+		return nil, config.Profile{}, "", err
+	}
+	return project, profile, name, nil
+}
@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/config"
+	"github.com/phinze/bankshot/pkg/update"
+	"github.com/phinze/bankshot/version"
+	"github.com/spf13/cobra"
+)
+
+// releaseCheckTimeout bounds looking up the latest release for version --check
+const releaseCheckTimeout = 15 * time.Second
+
+func newVersionCmd() *cobra.Command {
+	var check bool
+
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Show the bankshot version",
+		Long: `Prints the version of this bankshot binary. With --check, it also looks up
+the latest release on GitHub and says whether ` + "`bankshot self-update`" + ` has a newer
+one to install.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Fprintf(stdout, "bankshot %s\n", version.GetFullVersion())
+			if !check {
+				return nil
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), releaseCheckTimeout)
+			defer cancel()
+			rel, err := update.New().Latest(ctx)
+			if err != nil {
+				return err
+			}
+
+			switch current := version.GetVersion(); {
+			case update.Newer(rel.Version, current):
+				fmt.Fprintf(stdout, "bankshot %s is available: %s\n", rel.Version, rel.URL)
+				fmt.Fprintln(stdout, "Run `bankshot self-update` to install it")
+			case !update.IsRelease(current):
+				fmt.Fprintf(stdout, "The latest release is %s\n", rel.Version)
+			default:
+				fmt.Fprintln(stdout, "This is the latest release")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&check, "check", false, "Check GitHub for a newer release")
+	return cmd
+}
+
+func newSelfUpdateCmd() *cobra.Command {
+	var (
+		remote string
+		force  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "self-update",
+		Short: "Replace bankshot with the latest release",
+		Long: `Downloads the latest release from GitHub, checks it against the release's
+checksums, and replaces this bankshot binary with it, along with the bankshotd
+next to it. The daemon keeps running the old version until it's restarted.
+
+With --remote, the release for host's platform is downloaded here and copied
+over the SSH connection onto the bankshot found in host's PATH, so the remote
+host doesn't need to reach GitHub itself:
+
+  bankshot self-update --remote devbox
+
+Binaries installed by a package manager (Homebrew, Nix) should be updated
+with it instead.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := update.New()
+			rel, err := client.Latest(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			if remote != "" {
+				return remoteSelfUpdate(cmd.Context(), client, rel, remote, force)
+			}
+
+			current := version.GetVersion()
+			if !force && !update.IsRelease(current) {
+				return fmt.Errorf("this is a development build (%s); use --force to replace it with %s", current, rel.Version)
+			}
+			if !force && !update.Newer(rel.Version, current) {
+				fmt.Fprintf(stdout, "bankshot %s is the latest release\n", current)
+				return nil
+			}
+
+			binaries, err := client.Download(cmd.Context(), rel, runtime.GOOS, runtime.GOARCH)
+			if err != nil {
+				return err
+			}
+
+			exe, err := os.Executable()
+			if err == nil {
+				// Replace the binary itself, not an xdg-open or op symlink to it
+				exe, err = filepath.EvalSymlinks(exe)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to find the bankshot executable: %w", err)
+			}
+			if err := update.Replace(exe, binaries["bankshot"]); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "Updated %s to %s\n", exe, rel.Version)
+
+			daemonExe := filepath.Join(filepath.Dir(exe), "bankshotd")
+			if data, ok := binaries["bankshotd"]; ok {
+				if _, err := os.Stat(daemonExe); err == nil {
+					if err := update.Replace(daemonExe, data); err != nil {
+						return err
+					}
+					fmt.Fprintf(stdout, "Updated %s to %s; restart the daemon to run it\n", daemonExe, rel.Version)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&remote, "remote", "", "Update bankshot on this SSH host instead")
+	cmd.Flags().BoolVar(&force, "force", false, "Install the latest release even if it isn't newer")
+	return cmd
+}
+
+// remoteSelfUpdate copies the release's bankshot for host's platform over
+// the bankshot in host's PATH
+func remoteSelfUpdate(ctx context.Context, client *update.Client, rel *update.Release, host string, force bool) error {
+	cfg, err := config.Load("")
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// One line each: OS, architecture, path of bankshot, its --version
+	probe := `uname -s; uname -m; p=$(command -v bankshot) && echo "$p" && "$p" --version`
+	output, err := exec.CommandContext(ctx, cfg.SSHCommand, host, probe).Output()
+	if err != nil {
+		return fmt.Errorf("failed to find bankshot on %s: %w", host, err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) < 3 {
+		return fmt.Errorf("bankshot not found in PATH on %s", host)
+	}
+	goos := strings.ToLower(strings.TrimSpace(lines[0]))
+	goarch := strings.TrimSpace(lines[1])
+	switch goarch {
+	case "x86_64":
+		goarch = "amd64"
+	case "aarch64":
+		goarch = "arm64"
+	}
+	path := strings.TrimSpace(lines[2])
+
+	current := ""
+	if len(lines) > 3 {
+		// "bankshot version 1.2.0 (commit: ...)"
+		if fields := strings.Fields(lines[3]); len(fields) >= 3 {
+			current = fields[2]
+		}
+	}
+	if !force && update.IsRelease(current) && !update.Newer(rel.Version, current) {
+		fmt.Fprintf(stdout, "bankshot %s on %s is the latest release\n", current, host)
+		return nil
+	}
+
+	binaries, err := client.Download(ctx, rel, goos, goarch)
+	if err != nil {
+		return err
+	}
+
+	// Written next to the binary and renamed over it, so it's replaced atomically
+	install := fmt.Sprintf(`p=%s; cat > "$p.new" && chmod 755 "$p.new" && mv -f "$p.new" "$p"`, shellQuote(path))
+	copyCmd := exec.CommandContext(ctx, cfg.SSHCommand, host, install)
+	copyCmd.Stdin = bytes.NewReader(binaries["bankshot"])
+	if output, err := copyCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to install bankshot on %s: %w: %s", host, err, strings.TrimSpace(string(output)))
+	}
+
+	fmt.Fprintf(stdout, "Updated %s on %s to %s\n", path, host, rel.Version)
+	return nil
+}
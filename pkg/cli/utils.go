@@ -3,14 +3,75 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/mitchellh/go-homedir"
 	"github.com/phinze/bankshot/pkg/config"
 	"github.com/phinze/bankshot/pkg/protocol"
+	"gopkg.in/yaml.v3"
 )
 
+// Values of --output
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// structuredOutput reports whether --output asks for JSON or YAML rather
+// than the human-readable table
+func structuredOutput() (bool, error) {
+	switch outputFormat {
+	case outputTable:
+		return false, nil
+	case outputJSON, outputYAML:
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid --output %q: must be table, json, or yaml", outputFormat)
+	}
+}
+
+// printStructured prints v, a protocol structure, as --output asks. YAML
+// keeps the JSON field names and order, so scripts can switch between the
+// two.
+func printStructured(w io.Writer, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %w", err)
+	}
+	if outputFormat == outputJSON {
+		_, err := fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	// JSON is YAML, so decoding it gives a document with the fields in
+	// order; only its flow style and quoting need undoing
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to convert output to YAML: %w", err)
+	}
+	clearStyle(&doc)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return enc.Close()
+}
+
+// clearStyle resets a YAML document to block style with plain scalars,
+// which the encoder still quotes where needed
+func clearStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearStyle(child)
+	}
+}
+
 func getSocketPath() (string, error) {
 	if socketPath != "" {
 		expanded, err := homedir.Expand(socketPath)
@@ -29,11 +90,7 @@ func getSocketPath() (string, error) {
 		return "", fmt.Errorf("invalid config: %w", err)
 	}
 
-	if cfg.Network == "tcp" {
-		return cfg.Address, nil
-	}
-
-	return cfg.Address, nil
+	return protocol.DaemonAddress(cfg.Address, cfg.ProxyCommand), nil
 }
 
 func sendRequest(req *protocol.Request) (*protocol.Response, error) {
@@ -41,45 +98,194 @@ func sendRequest(req *protocol.Request) (*protocol.Response, error) {
 	if err != nil {
 		return nil, err
 	}
+	return sendRequestTo(sockPath, req)
+}
 
-	network := "unix"
-	if strings.Contains(sockPath, ":") {
-		network = "tcp"
+// sendRequestTo sends req to the socket at sockPath, as dialDaemon reaches
+// it, and reads its response
+func sendRequestTo(sockPath string, req *protocol.Request) (*protocol.Response, error) {
+	conn, _, resp, err := openRequest(sockPath, req)
+	if err != nil {
+		return nil, err
 	}
+	_ = conn.Close()
+	return resp, nil
+}
 
-	conn, err := net.Dial(network, sockPath)
+// openRequest sends req to the socket at sockPath, as dialDaemon reaches it,
+// and reads its response, leaving the connection open for commands that send
+// more after it. The caller closes conn and reads the rest through decoder.
+func openRequest(sockPath string, req *protocol.Request) (net.Conn, *json.Decoder, *protocol.Response, error) {
+	return openRequestWithBody(sockPath, req, nil)
+}
+
+// openRequestWithBody is openRequest for commands whose request is followed
+// by more, which body writes before the response is read
+func openRequestWithBody(sockPath string, req *protocol.Request, body func(io.Writer) error) (net.Conn, *json.Decoder, *protocol.Response, error) {
+	conn, err := dialDaemon(sockPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to daemon: %w", err)
+		return nil, nil, nil, err
 	}
-	defer func() {
-		_ = conn.Close()
-	}()
 
 	reqData, err := json.Marshal(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		_ = conn.Close()
+		return nil, nil, nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	if verbose {
-		fmt.Printf("Sending request: %s\n", string(reqData))
+		fmt.Fprintf(stdout, "Sending request: %s\n", string(reqData))
 	}
 
 	reqData = append(reqData, '\n')
 
 	if _, err := conn.Write(reqData); err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		_ = conn.Close()
+		return nil, nil, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	var bodyErr error
+	if body != nil {
+		bodyErr = body(conn)
 	}
 
+	// A daemon that turns the request down answers without reading the
+	// body, so its answer says more than the failed write does
 	decoder := json.NewDecoder(conn)
 	var resp protocol.Response
 	if err := decoder.Decode(&resp); err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		_ = conn.Close()
+		if bodyErr != nil {
+			return nil, nil, nil, bodyErr
+		}
+		return nil, nil, nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	if verbose {
 		respData, _ := json.Marshal(resp)
-		fmt.Printf("Received response: %s\n", string(respData))
+		fmt.Fprintf(stdout, "Received response: %s\n", string(respData))
+	}
+
+	return conn, decoder, &resp, nil
+}
+
+// formatStats renders forward traffic counters for display
+func formatStats(s *protocol.ForwardStats) string {
+	return fmt.Sprintf("sent %s, received %s, %d connections (%d active)",
+		formatBytes(s.BytesSent), formatBytes(s.BytesReceived), s.Connections, s.ActiveConnections)
+}
+
+// formatBytes renders a byte count with a binary unit suffix
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// remoteTarget describes the remote end of a forward for display
+func remoteTarget(remotePort int, remoteSocket string) string {
+	if remoteSocket != "" {
+		return remoteSocket
+	}
+	return fmt.Sprintf("%d", remotePort)
+}
+
+// parsePortRange parses a port ("3000") or an inclusive port range
+// ("3000-3010"). end is 0 for a single port.
+func parsePortRange(s string) (start, end int, err error) {
+	startStr, endStr, isRange := strings.Cut(s, "-")
+	start, err = strconv.Atoi(startStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port: %s", s)
+	}
+	if !isRange {
+		return start, 0, nil
+	}
+	end, err = strconv.Atoi(endStr)
+	if err != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid port range: %s", s)
+	}
+	return start, end, nil
+}
+
+// printRangeResult reports the local ports a range forward ended up on,
+// calling out any that differ from the requested ones
+func printRangeResult(remoteStart, localStart int, localPorts []int) {
+	for i, got := range localPorts {
+		want := localStart + i
+		switch {
+		case got == 0:
+			fmt.Fprintf(stdout, "%d -> %d queued for retry\n", remoteStart+i, want)
+		case got != want:
+			fmt.Fprintf(stdout, "Local port %d in use, forwarded %d -> %d\n", want, remoteStart+i, got)
+		case verbose:
+			fmt.Fprintf(stdout, "Port forward created: %d -> %d\n", remoteStart+i, got)
+		}
+	}
+}
+
+// localTarget describes the local end of a forward: localhost:port or a Unix
+// socket path
+func localTarget(localPort int, localSocket string) string {
+	if localSocket != "" {
+		return localSocket
+	}
+	return fmt.Sprintf("localhost:%d", localPort)
+}
+
+// isForwardName reports whether a positional argument names a forward rather
+// than a port; names always start with a letter
+func isForwardName(arg string) bool {
+	if arg == "" {
+		return false
+	}
+	c := arg[0]
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// printDryRun prints the ssh commands reported by a dry-run request
+func printDryRun(data json.RawMessage) error {
+	var dryRun protocol.DryRunResponse
+	if err := json.Unmarshal(data, &dryRun); err != nil {
+		return fmt.Errorf("failed to parse dry run: %w", err)
 	}
 
-	return &resp, nil
+	fmt.Fprintln(stdout, dryRun.Message)
+	for _, command := range dryRun.Commands {
+		fmt.Fprintf(stdout, "  %s\n", command)
+	}
+	return nil
+}
+
+// unforwardInfo removes the listed forward fw
+func unforwardInfo(fw protocol.ForwardInfo) error {
+	payload, err := json.Marshal(protocol.UnforwardRequest{
+		RemotePort:     fw.RemotePort,
+		Host:           fw.Host,
+		RemoteSocket:   fw.RemoteSocket,
+		ConnectionInfo: fw.ConnectionInfo,
+		SocketPath:     fw.SocketPath,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	resp, err := sendRequest(&protocol.Request{
+		ID:      uuid.New().String(),
+		Type:    protocol.CommandUnforward,
+		Payload: payload,
+	})
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return requestFailed(fmt.Errorf("%s", resp.Error))
+	}
+	return nil
 }
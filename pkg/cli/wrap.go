@@ -3,16 +3,20 @@ package cli
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/config"
 	"github.com/phinze/bankshot/pkg/monitor"
 	"github.com/phinze/bankshot/pkg/process"
 	"github.com/phinze/bankshot/pkg/protocol"
@@ -22,6 +26,9 @@ import (
 var (
 	wrapConnection      string
 	wrapMonitorInterval int
+	wrapMappings        []string
+	wrapTTY             bool
+	wrapNoForward       bool
 )
 
 func newWrapCmd() *cobra.Command {
@@ -29,8 +36,29 @@ func newWrapCmd() *cobra.Command {
 		Use:   "wrap [flags] -- <command> [args...]",
 		Short: "Wrap a command and auto-forward its ports",
 		Long: `Wraps a command and automatically forwards any ports it binds via SSH.
-The wrapped process will be monitored for port bindings, and those ports
-will be automatically forwarded through the bankshot daemon.
+The wrapped process and its descendants will be monitored for port bindings,
+and those ports will be automatically forwarded through the bankshot daemon
+and removed when the whole tree has exited. On Linux, descendants outliving
+their parent stay in the tree, so a server a package manager launched keeps
+its forwards (and wrap keeps running) until the server exits too.
+
+Ports are forwarded to the same local port unless --map says otherwise, e.g.
+to keep clear of a service already running on the laptop. It can be given
+more than once:
+
+  bankshot wrap --map 8080:local=9090 -- ./myapp
+
+With --tty, the command runs on a pseudo-terminal of its own, sized and
+resized like yours, so dev servers that check for a terminal keep their
+colors and interactive keys (Vite's "press h for help", for instance) as
+when run directly. Not available on Windows.
+
+The command gets BROWSER pointed at "bankshot open", and pbcopy, pbpaste,
+wl-copy, wl-paste, xclip and xsel on its PATH run "bankshot copy" and
+"bankshot paste", so the URLs it opens and the text it copies reach the
+laptop. With --no-forward (or --browser-only), that's all it gets and
+nothing is forwarded, for when the system-wide monitor already forwards its
+ports.
 
 Examples:
   bankshot wrap -- npm run dev
@@ -38,17 +66,28 @@ Examples:
   bankshot wrap -c myserver -- ./myapp --port 3000`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if wrapNoForward && len(wrapMappings) > 0 {
+				return fmt.Errorf("--map cannot be used with --no-forward")
+			}
+			localPorts := make(map[int]int)
+			for _, mapping := range wrapMappings {
+				remote, local, err := parseWrapMapping(mapping)
+				if err != nil {
+					return err
+				}
+				localPorts[remote] = local
+			}
+
 			if verbose {
-				fmt.Printf("Starting wrapped process: %s\n", strings.Join(args, " "))
+				fmt.Fprintf(stdout, "Starting wrapped process: %s\n", strings.Join(args, " "))
 			}
 
 			connectionInfo := wrapConnection
 			if connectionInfo == "" {
-				hostname, err := os.Hostname()
-				if err != nil {
-					return fmt.Errorf("failed to get hostname: %w", err)
+				var err error
+				if connectionInfo, err = defaultConnection(); err != nil {
+					return err
 				}
-				connectionInfo = hostname
 			}
 
 			execPath, err := os.Executable()
@@ -66,85 +105,50 @@ Examples:
 				"DISPLAY": "1",
 			}
 
+			// Clipboard commands the command runs reach the laptop's
+			// clipboard through bankshot copy and paste
+			shims, err := writeClipboardShims(execPath)
+			if err != nil {
+				return err
+			}
+			if shims != "" {
+				defer func() {
+					_ = os.RemoveAll(shims)
+				}()
+				extraEnv["PATH"] = shims + string(os.PathListSeparator) + os.Getenv("PATH")
+			}
+
 			pm := process.New(args[0], args[1:], extraEnv)
+			if wrapTTY {
+				pm.WithTTY()
+			}
 			if err := pm.Start(); err != nil {
 				return fmt.Errorf("failed to start process: %w", err)
 			}
+			// Stops the process and restores the terminal if wrap fails
+			// before the process exits
+			defer pm.Close()
 
 			if verbose {
-				fmt.Printf("Process started with PID: %d\n", pm.PID())
+				fmt.Fprintf(stdout, "Process started with PID: %d\n", pm.PID())
 			}
 
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
-			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-				Level: slog.LevelError,
-			}))
-			if verbose {
-				logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-					Level: slog.LevelDebug,
-				}))
-			}
-
-			portMon := monitor.NewPortEventSource(pm.PID(), logger)
-			if err := portMon.Start(ctx); err != nil {
-				return fmt.Errorf("failed to start port monitor: %w", err)
-			}
-
-			// Get existing forwards before we start
-			existingPorts := make(map[int]bool)
-			listReq := protocol.Request{
-				ID:   uuid.New().String(),
-				Type: protocol.CommandList,
-			}
-			if resp, err := sendRequest(&listReq); err == nil && resp.Success {
-				var list protocol.ListResponse
-				if err := json.Unmarshal(resp.Data, &list); err == nil {
-					for _, fw := range list.Forwards {
-						if fw.ConnectionInfo == connectionInfo {
-							existingPorts[fw.RemotePort] = true
-						}
-					}
+			// Watch from this process rather than the wrapped one, which
+			// may exit before descendants it leaves to us
+			var forwarder *portForwarder
+			if !wrapNoForward {
+				logger := portMonitorLogger()
+				forwarder, err = newPortForwarder(connectionInfo, localPorts, logger)
+				if err != nil {
+					return err
 				}
-			}
-
-			ourForwardedPorts := make(map[int]bool)
-
-			go func() {
-				for event := range portMon.Events() {
-					switch event.Type {
-					case monitor.PortOpened:
-						// Skip if port was already forwarded before wrap started
-						if existingPorts[event.Port] {
-							if verbose {
-								fmt.Printf("Port %d already forwarded, skipping\n", event.Port)
-							}
-							continue
-						}
-
-						// Skip if we already forwarded this port
-						if ourForwardedPorts[event.Port] {
-							continue
-						}
-
-						req := createForwardRequest(event.Port, event.Port, connectionInfo)
-						resp, err := sendRequest(&req)
-						if err != nil {
-							if verbose {
-								fmt.Fprintf(os.Stderr, "Failed to forward port %d: %v\n", event.Port, err)
-							}
-						} else if resp.Success {
-							ourForwardedPorts[event.Port] = true
-							if verbose {
-								fmt.Printf("Auto-forwarded port %d\n", event.Port)
-							}
-						}
-					case monitor.PortClosed:
-						// We don't need to track port closes, we'll clean up at the end
-					}
+				if err := watchPorts(ctx, os.Getpid(), forwarder, logger); err != nil {
+					return err
 				}
-			}()
+			}
 
 			sigChan := make(chan os.Signal, 1)
 			signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
@@ -163,11 +167,11 @@ Examples:
 			case <-done:
 			case sig := <-sigChan:
 				if verbose {
-					fmt.Printf("Received signal: %s\n", sig)
+					fmt.Fprintf(stdout, "Received signal: %s\n", sig)
 				}
 				if err := pm.Signal(sig); err != nil {
 					if verbose {
-						fmt.Printf("Failed to signal process: %v\n", err)
+						fmt.Fprintf(stdout, "Failed to signal process: %v\n", err)
 					}
 				}
 
@@ -176,7 +180,7 @@ Examples:
 				case <-time.After(5 * time.Second):
 					if err := pm.Stop(context.Background()); err != nil {
 						if verbose {
-							fmt.Printf("Failed to stop process: %v\n", err)
+							fmt.Fprintf(stdout, "Failed to stop process: %v\n", err)
 						}
 					}
 					<-done
@@ -186,54 +190,321 @@ Examples:
 			cancel()
 
 			if verbose {
-				fmt.Printf("Process exited with code: %d\n", exitCode)
+				fmt.Fprintf(stdout, "Process exited with code: %d\n", exitCode)
 			}
 
 			// Unforward only the ports we created
-			for port := range ourForwardedPorts {
-				unforwardReq := protocol.UnforwardRequest{
-					RemotePort:     port,
-					Host:           "localhost",
-					ConnectionInfo: connectionInfo,
-				}
-
-				payload, _ := json.Marshal(unforwardReq)
-				req := protocol.Request{
-					ID:      uuid.New().String(),
-					Type:    protocol.CommandUnforward,
-					Payload: payload,
-				}
-
-				if resp, err := sendRequest(&req); err == nil && resp.Success {
-					if verbose {
-						fmt.Printf("Unforwarded port %d\n", port)
-					}
-				} else if verbose {
-					if err != nil {
-						fmt.Printf("Failed to unforward port %d: %v\n", port, err)
-					} else {
-						fmt.Printf("Failed to unforward port %d: %s\n", port, resp.Error)
-					}
-				}
+			if forwarder != nil {
+				removeOwnForwards(connectionInfo, forwarder.stop())
 			}
 
+			if shims != "" {
+				_ = os.RemoveAll(shims)
+			}
 			os.Exit(exitCode)
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&wrapConnection, "connection", "c", "", "SSH connection identifier")
+	cmd.Flags().StringVarP(&wrapConnection, "connection", "c", "", "SSH connection identifier (default: this SSH session's)")
+	_ = cmd.RegisterFlagCompletionFunc("connection", completeConnections)
 	cmd.Flags().IntVarP(&wrapMonitorInterval, "poll-interval", "p", 500, "Port monitoring interval in milliseconds")
+	cmd.Flags().BoolVarP(&wrapTTY, "tty", "t", false, "Run the command on a pseudo-terminal, for interactive or colored output")
+	cmd.Flags().BoolVar(&wrapNoForward, "no-forward", false, "Only set up BROWSER for the command, leaving its ports to the monitor")
+	cmd.Flags().BoolVar(&wrapNoForward, "browser-only", false, "Same as --no-forward")
+	cmd.Flags().StringArrayVar(&wrapMappings, "map", nil, "Forward a remote port to another local port, e.g. 8080:local=9090 (repeatable)")
 
 	return cmd
 }
 
+// forwardRetryInterval is how often a port whose forward failed is tried
+// again while it's still open
+const forwardRetryInterval = 5 * time.Second
+
+// portForwarder forwards the ports a process tree opens, as wrap and attach
+// do, keeping track of the forwards it made so they can be removed
+type portForwarder struct {
+	connectionInfo string
+	localPorts     map[int]int            // Local ports for remote ports --map moved
+	filter         *monitor.ProcessFilter // monitor.neverForwardProcesses; nil forwards any
+	only           int                    // When set, only this process's own ports are forwarded
+	announce       bool                   // Whether to print each forward, not just with --verbose
+	send           func(*protocol.Request) (*protocol.Response, error)
+
+	existing map[int]bool // Ports forwarded before it started, left alone
+
+	mu      sync.Mutex
+	ours    map[int]bool              // Ports it forwarded
+	failed  map[int]monitor.PortEvent // Open ports whose forward failed, to retry
+	stopped bool                      // Set once stop returned ours
+}
+
+// newPortForwarder returns a portForwarder for ports forwarded over
+// connectionInfo, leaving alone those already forwarded there
+func newPortForwarder(connectionInfo string, localPorts map[int]int, logger *slog.Logger) (*portForwarder, error) {
+	filter, err := neverForwardFilter("", logger)
+	if err != nil {
+		return nil, err
+	}
+	f := &portForwarder{
+		connectionInfo: connectionInfo,
+		localPorts:     localPorts,
+		send:           sendRequest,
+		existing:       make(map[int]bool),
+		ours:           make(map[int]bool),
+		failed:         make(map[int]monitor.PortEvent),
+		filter:         filter,
+	}
+
+	var list protocol.ListResponse
+	if err := queryDaemon(protocol.CommandList, nil, &list); err == nil {
+		for _, fw := range list.Forwards {
+			if fw.ConnectionInfo == connectionInfo && fw.RemoteSocket == "" {
+				f.existing[fw.RemotePort] = true
+			}
+		}
+	}
+	return f, nil
+}
+
+// neverForwardFilter returns a filter for the config file's
+// monitor.neverForwardProcesses, which applies to wrapped commands too, or
+// nil if it has none. A config that doesn't load is an error rather than
+// forwarding ports it may have ruled out.
+func neverForwardFilter(path string, logger *slog.Logger) (*monitor.ProcessFilter, error) {
+	cfg, err := config.Load(path)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if len(cfg.Monitor.NeverForwardProcesses) == 0 {
+		return nil, nil
+	}
+	return monitor.NewProcessFilter(nil, nil, logger).WithNeverForward(cfg.Monitor.NeverForwardProcesses), nil
+}
+
+// watch forwards the ports in initial, then those events reports as they
+// open, until events is closed. Forwards that fail are retried every
+// forwardRetryInterval while their port stays open.
+func (f *portForwarder) watch(initial []monitor.PortEvent, events <-chan monitor.PortEvent) {
+	for _, event := range initial {
+		f.handle(event)
+	}
+
+	ticker := time.NewTicker(forwardRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			f.handle(event)
+		case <-ticker.C:
+			f.retry()
+		}
+	}
+}
+
+// retry tries the forwards that failed again
+func (f *portForwarder) retry() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopped {
+		return
+	}
+	for _, event := range f.failed {
+		f.forward(event)
+	}
+}
+
+// stop stops forwarding, once any forward underway is done, and returns
+// the ports it forwarded
+func (f *portForwarder) stop() map[int]bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = true
+	return f.ours
+}
+
+// handle acts on a port of the tree opening or closing
+func (f *portForwarder) handle(event monitor.PortEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopped {
+		return
+	}
+
+	switch event.Type {
+	case monitor.PortOpened:
+		f.forward(event)
+	case monitor.PortClosed:
+		// Forwards are removed at the end; only stop retrying
+		delete(f.failed, event.Port)
+	}
+}
+
+// forward forwards an opened port, unless it's forwarded already or isn't
+// one to forward. Must be called with f.mu held.
+func (f *portForwarder) forward(event monitor.PortEvent) {
+	// Skip if port was already forwarded before we started, or by us
+	if f.existing[event.Port] || f.ours[event.Port] {
+		if verbose && f.existing[event.Port] {
+			fmt.Fprintf(stdout, "Port %d already forwarded, skipping\n", event.Port)
+		}
+		return
+	}
+
+	if f.only != 0 && event.PID != 0 && event.PID != f.only {
+		return
+	}
+
+	// Ports bound to a LAN or tailnet address aren't reachable through the
+	// forward, which connects to localhost; the monitor skips them the same
+	// way
+	if !monitor.IsLocalAddr(event.BindAddr) {
+		if verbose {
+			fmt.Fprintf(stdout, "Port %d bound to %s, not forwarding\n", event.Port, event.BindAddr)
+		}
+		return
+	}
+
+	if f.filter != nil && !f.filter.Allows(event.PID) {
+		if verbose {
+			fmt.Fprintf(stdout, "Port %d owned by a process in neverForwardProcesses, not forwarding\n", event.Port)
+		}
+		return
+	}
+
+	localPort, mapped := f.localPorts[event.Port]
+	if !mapped {
+		localPort = event.Port
+	}
+	req := createForwardRequest(event.Port, localPort, f.connectionInfo)
+	resp, err := f.send(&req)
+	if err == nil && !resp.Success {
+		err = errors.New(resp.Error)
+	}
+	if err != nil {
+		// Reported once, not on every retry
+		if _, retrying := f.failed[event.Port]; !retrying {
+			fmt.Fprintf(os.Stderr, "bankshot: failed to forward port %d, will retry: %v\n", event.Port, err)
+		}
+		f.failed[event.Port] = event
+		return
+	}
+	delete(f.failed, event.Port)
+	f.ours[event.Port] = true
+
+	var fwdResp protocol.ForwardResponse
+	if err := json.Unmarshal(resp.Data, &fwdResp); err == nil && fwdResp.LocalPort != 0 && fwdResp.LocalPort != localPort {
+		fmt.Fprintf(os.Stderr, "bankshot: forwarded port %d to local port %d (requested port %d in use)\n", event.Port, fwdResp.LocalPort, localPort)
+	} else if f.announce || verbose {
+		fmt.Fprintf(stdout, "Forwarded port %d -> localhost:%d\n", event.Port, localPort)
+	}
+}
+
+// watchPorts starts watching the process tree rooted at pid for ports
+// opening, forwarding them with f until ctx is done. Ports the tree already
+// listens on are forwarded too.
+func watchPorts(ctx context.Context, pid int, f *portForwarder, logger *slog.Logger) error {
+	portMon := monitor.NewPortEventSource(pid, logger)
+	if err := portMon.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start port monitor: %w", err)
+	}
+
+	// Listed after the source started, so none opens unseen in between;
+	// any it reports again are skipped as forwarded
+	var initial []monitor.PortEvent
+	ports, err := monitor.GetProcessListeningPorts(pid)
+	if err != nil && verbose {
+		fmt.Fprintf(stdout, "Failed to list ports of PID %d: %v\n", pid, err)
+	}
+	owners := monitor.SocketOwners()
+	for _, p := range ports {
+		initial = append(initial, monitor.PortEvent{
+			Type:      monitor.PortOpened,
+			PID:       owners[p.Inode],
+			Port:      p.Port,
+			Protocol:  p.Protocol,
+			BindAddr:  p.BindAddr,
+			Timestamp: time.Now(),
+		})
+	}
+
+	go f.watch(initial, portMon.Events())
+	return nil
+}
+
+// portMonitorLogger returns the logger for port monitoring in the CLI,
+// quiet unless --verbose
+func portMonitorLogger() *slog.Logger {
+	level := slog.LevelError
+	if verbose {
+		level = slog.LevelDebug
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// removeOwnForwards removes the forwards of ports that this process made
+// over connectionInfo
+func removeOwnForwards(connectionInfo string, ports map[int]bool) {
+	for port := range ports {
+		unforwardReq := protocol.UnforwardRequest{
+			RemotePort:     port,
+			Host:           "localhost",
+			ConnectionInfo: connectionInfo,
+		}
+
+		payload, _ := json.Marshal(unforwardReq)
+		req := protocol.Request{
+			ID:      uuid.New().String(),
+			Type:    protocol.CommandUnforward,
+			Payload: payload,
+		}
+
+		if resp, err := sendRequest(&req); err == nil && resp.Success {
+			if verbose {
+				fmt.Fprintf(stdout, "Unforwarded port %d\n", port)
+			}
+		} else if verbose {
+			if err != nil {
+				fmt.Fprintf(stdout, "Failed to unforward port %d: %v\n", port, err)
+			} else {
+				fmt.Fprintf(stdout, "Failed to unforward port %d: %s\n", port, resp.Error)
+			}
+		}
+	}
+}
+
+// parseWrapMapping parses a --map value, "8080:local=9090" or just
+// "8080:9090"
+func parseWrapMapping(s string) (remote, local int, err error) {
+	remoteStr, localStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid --map %q, want <remote-port>:local=<local-port>", s)
+	}
+	localStr = strings.TrimPrefix(localStr, "local=")
+	remote, err = strconv.Atoi(remoteStr)
+	if err != nil || remote <= 0 || remote > 65535 {
+		return 0, 0, fmt.Errorf("invalid remote port in --map %q", s)
+	}
+	local, err = strconv.Atoi(localStr)
+	if err != nil || local <= 0 || local > 65535 {
+		return 0, 0, fmt.Errorf("invalid local port in --map %q", s)
+	}
+	return remote, local, nil
+}
+
 func createForwardRequest(remotePort, localPort int, connectionInfo string) protocol.Request {
 	forwardReq := protocol.ForwardRequest{
 		RemotePort:     remotePort,
 		LocalPort:      localPort,
 		Host:           "localhost",
 		ConnectionInfo: connectionInfo,
+		Owner:          protocol.WrapOwner(os.Getpid()),
 	}
 
 	payload, _ := json.Marshal(forwardReq)
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/phinze/bankshot/pkg/monitor"
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+func newTestPortForwarder(send func(*protocol.Request) (*protocol.Response, error)) *portForwarder {
+	return &portForwarder{
+		connectionInfo: "devbox",
+		localPorts:     map[int]int{8080: 9090},
+		send:           send,
+		existing:       map[int]bool{5000: true},
+		ours:           make(map[int]bool),
+		failed:         make(map[int]monitor.PortEvent),
+	}
+}
+
+func TestPortForwarderRetries(t *testing.T) {
+	stdout = io.Discard
+	defer func() {
+		stdout = os.Stdout
+	}()
+
+	var requests []protocol.ForwardRequest
+	fail := true
+	f := newTestPortForwarder(func(req *protocol.Request) (*protocol.Response, error) {
+		var fwd protocol.ForwardRequest
+		if err := json.Unmarshal(req.Payload, &fwd); err != nil {
+			t.Fatal(err)
+		}
+		requests = append(requests, fwd)
+		if fail {
+			return nil, errors.New("daemon not running")
+		}
+		return protocol.NewSuccessResponse(req.ID, protocol.ForwardResponse{LocalPort: fwd.LocalPort})
+	})
+
+	opened := monitor.PortEvent{Type: monitor.PortOpened, Port: 8080, BindAddr: "127.0.0.1"}
+	f.handle(opened)
+	if _, retrying := f.failed[8080]; !retrying || f.ours[8080] {
+		t.Fatalf("after a failed forward, failed = %v, ours = %v, want it retried", f.failed, f.ours)
+	}
+
+	fail = false
+	f.retry()
+	if !f.ours[8080] || len(f.failed) != 0 {
+		t.Errorf("after the retry, failed = %v, ours = %v, want it forwarded", f.failed, f.ours)
+	}
+	if len(requests) != 2 || requests[1].LocalPort != 9090 {
+		t.Errorf("requests = %+v, want two for local port 9090", requests)
+	}
+
+	// Forwarded once only
+	f.handle(opened)
+	if len(requests) != 2 {
+		t.Errorf("requests = %d after the port opened again, want 2", len(requests))
+	}
+}
+
+func TestPortForwarderClosedStopsRetrying(t *testing.T) {
+	f := newTestPortForwarder(func(req *protocol.Request) (*protocol.Response, error) {
+		return protocol.NewErrorResponse(req.ID, errors.New("port in use")), nil
+	})
+
+	f.handle(monitor.PortEvent{Type: monitor.PortOpened, Port: 3000, BindAddr: "127.0.0.1"})
+	f.handle(monitor.PortEvent{Type: monitor.PortClosed, Port: 3000})
+	if len(f.failed) != 0 {
+		t.Errorf("failed = %v after the port closed, want none", f.failed)
+	}
+}
+
+func TestPortForwarderSkips(t *testing.T) {
+	sent := 0
+	f := newTestPortForwarder(func(req *protocol.Request) (*protocol.Response, error) {
+		sent++
+		return protocol.NewSuccessResponse(req.ID, protocol.ForwardResponse{})
+	})
+	f.only = 100
+
+	tests := []struct {
+		name  string
+		event monitor.PortEvent
+	}{
+		{"forwarded before it started", monitor.PortEvent{Type: monitor.PortOpened, Port: 5000, PID: 100, BindAddr: "127.0.0.1"}},
+		{"bound to a LAN address", monitor.PortEvent{Type: monitor.PortOpened, Port: 3000, PID: 100, BindAddr: "192.168.1.5"}},
+		{"a descendant's", monitor.PortEvent{Type: monitor.PortOpened, Port: 3001, PID: 200, BindAddr: "127.0.0.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.handle(tt.event)
+			if sent != 0 || len(f.ours) != 0 {
+				t.Errorf("port %d was forwarded", tt.event.Port)
+			}
+		})
+	}
+}
+
+func TestPortForwarderStop(t *testing.T) {
+	f := newTestPortForwarder(func(req *protocol.Request) (*protocol.Response, error) {
+		return protocol.NewSuccessResponse(req.ID, protocol.ForwardResponse{})
+	})
+
+	f.handle(monitor.PortEvent{Type: monitor.PortOpened, Port: 3000, BindAddr: "127.0.0.1"})
+	ours := f.stop()
+	f.handle(monitor.PortEvent{Type: monitor.PortOpened, Port: 3001, BindAddr: "127.0.0.1"})
+	if len(ours) != 1 || !ours[3000] {
+		t.Errorf("stop() = %v, want only the port forwarded before it", ours)
+	}
+}
+
+func TestNeverForwardFilter(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	filter, err := neverForwardFilter(write("monitor:\n  neverForwardProcesses: [node]\n"), logger)
+	if err != nil || filter == nil {
+		t.Fatalf("neverForwardFilter() = %v, %v, want a filter", filter, err)
+	}
+	if filter, err := neverForwardFilter(write("log_level: info\n"), logger); err != nil || filter != nil {
+		t.Errorf("neverForwardFilter() = %v, %v without neverForwardProcesses, want none", filter, err)
+	}
+	// An invalid config may rule out ports it can't be trusted to
+	if _, err := neverForwardFilter(write("log_level: loud\nmonitor:\n  neverForwardProcesses: [node]\n"), logger); err == nil {
+		t.Error("neverForwardFilter() accepted an invalid config")
+	}
+}
@@ -0,0 +1,113 @@
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoTool is returned when none of the platform's clipboard commands are
+// installed
+var ErrNoTool = errors.New("no clipboard command found")
+
+// commandTimeout is how long a clipboard command may take
+const commandTimeout = 5 * time.Second
+
+// pipeWait is how long to wait, once a clipboard command exits, for the
+// child it may leave serving the clipboard to let go of its output
+const pipeWait = 100 * time.Millisecond
+
+// tool is a pair of commands that copy stdin to the clipboard and paste the
+// clipboard to stdout
+type tool struct {
+	copy  []string
+	paste []string
+}
+
+// Clipboard reads and writes the local clipboard through the platform's
+// clipboard commands
+type Clipboard struct {
+	logger *slog.Logger
+	mu     sync.Mutex
+}
+
+// New creates a new Clipboard
+func New(logger *slog.Logger) *Clipboard {
+	return &Clipboard{
+		logger: logger,
+	}
+}
+
+// Copy puts text on the clipboard
+func (c *Clipboard) Copy(text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, err := findTool(os.Getenv, exec.LookPath)
+	if err != nil {
+		return err
+	}
+	c.logger.Debug("Copying to clipboard", "command", t.copy[0], "bytes", len(text))
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	// xclip and wl-copy fork a child that keeps serving the clipboard, and
+	// keeps their stderr open, so waiting for it to close would never end
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.copy[0], t.copy[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = pipeWait
+	if err := cmd.Run(); err != nil && !errors.Is(err, exec.ErrWaitDelay) {
+		return fmt.Errorf("%s failed: %w: %s", t.copy[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Paste returns the text on the clipboard
+func (c *Clipboard) Paste() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, err := findTool(os.Getenv, exec.LookPath)
+	if err != nil {
+		return "", err
+	}
+	c.logger.Debug("Pasting from clipboard", "command", t.paste[0])
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.paste[0], t.paste[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w: %s", t.paste[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// findTool returns the first of the platform's clipboard tools that's
+// installed
+func findTool(getenv func(string) string, lookPath func(string) (string, error)) (tool, error) {
+	candidates := tools(getenv)
+	for _, t := range candidates {
+		if _, err := lookPath(t.copy[0]); err == nil {
+			return t, nil
+		}
+	}
+	names := make([]string, 0, len(candidates))
+	for _, t := range candidates {
+		names = append(names, t.copy[0])
+	}
+	return tool{}, fmt.Errorf("%w (tried %s)", ErrNoTool, strings.Join(names, ", "))
+}
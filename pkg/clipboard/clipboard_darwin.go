@@ -0,0 +1,10 @@
+//go:build darwin
+
+package clipboard
+
+// tools returns the clipboard tools to try, in order
+func tools(getenv func(string) string) []tool {
+	return []tool{
+		{copy: []string{"pbcopy"}, paste: []string{"pbpaste"}},
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !darwin
+
+package clipboard
+
+// tools returns the clipboard tools to try, in order: wl-clipboard first
+// in a Wayland session, then the X11 tools
+func tools(getenv func(string) string) []tool {
+	var candidates []tool
+	if getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append(candidates, tool{
+			copy:  []string{"wl-copy"},
+			paste: []string{"wl-paste", "--no-newline"},
+		})
+	}
+	return append(candidates,
+		tool{
+			copy:  []string{"xclip", "-selection", "clipboard"},
+			paste: []string{"xclip", "-selection", "clipboard", "-o"},
+		},
+		tool{
+			copy:  []string{"xsel", "--clipboard", "--input"},
+			paste: []string{"xsel", "--clipboard", "--output"},
+		},
+	)
+}
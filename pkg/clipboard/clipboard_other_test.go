@@ -0,0 +1,50 @@
+//go:build !darwin
+
+package clipboard
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestToolsPrefersWaylandInWaylandSession(t *testing.T) {
+	wayland := func(key string) string {
+		if key == "WAYLAND_DISPLAY" {
+			return "wayland-0"
+		}
+		return ""
+	}
+
+	if got := tools(wayland)[0].copy[0]; got != "wl-copy" {
+		t.Errorf("first tool in a Wayland session = %s, want wl-copy", got)
+	}
+	for _, tl := range tools(func(string) string { return "" }) {
+		if tl.copy[0] == "wl-copy" {
+			t.Error("wl-copy offered outside a Wayland session")
+		}
+	}
+}
+
+func TestCopyDoesNotWaitForForkedChild(t *testing.T) {
+	// Like xclip, the copy command leaves a child behind holding its output
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncat > /dev/null\nsleep 5 &\nexit 0\n"
+	if err := os.WriteFile(filepath.Join(dir, "xclip"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("WAYLAND_DISPLAY", "")
+
+	c := New(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	start := time.Now()
+	if err := c.Copy("hello"); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Copy() took %s, waiting on the forked child", elapsed)
+	}
+}
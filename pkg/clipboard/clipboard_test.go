@@ -0,0 +1,54 @@
+package clipboard
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestFindTool(t *testing.T) {
+	getenv := func(string) string { return "" }
+
+	installed := func(names ...string) func(string) (string, error) {
+		return func(file string) (string, error) {
+			for _, name := range names {
+				if file == name {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", exec.ErrNotFound
+		}
+	}
+
+	candidates := tools(getenv)
+	if len(candidates) == 0 {
+		t.Fatal("expected at least one clipboard tool")
+	}
+
+	// The last candidate is used when it's the only one installed
+	last := candidates[len(candidates)-1]
+	got, err := findTool(getenv, installed(last.copy[0]))
+	if err != nil {
+		t.Fatalf("findTool() error = %v", err)
+	}
+	if got.copy[0] != last.copy[0] {
+		t.Errorf("findTool() = %s, want %s", got.copy[0], last.copy[0])
+	}
+
+	// The first candidate wins when everything is installed
+	all := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		all = append(all, c.copy[0])
+	}
+	got, err = findTool(getenv, installed(all...))
+	if err != nil {
+		t.Fatalf("findTool() error = %v", err)
+	}
+	if got.copy[0] != candidates[0].copy[0] {
+		t.Errorf("findTool() = %s, want %s", got.copy[0], candidates[0].copy[0])
+	}
+
+	if _, err := findTool(getenv, installed()); !errors.Is(err, ErrNoTool) {
+		t.Errorf("findTool() with nothing installed error = %v, want ErrNoTool", err)
+	}
+}
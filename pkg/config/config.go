@@ -2,15 +2,26 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
-	"gopkg.in/yaml.v3"
+	"github.com/phinze/bankshot/pkg/protocol"
 )
 
 // Config represents the daemon configuration
 type Config struct {
+	// Version is the layout of the config file, CurrentVersion() once Load
+	// has migrated it; see migrations
+	Version int `yaml:"version,omitempty"`
+
 	// Network type: "unix" or "tcp"
 	Network string `yaml:"network"`
 
@@ -26,29 +37,129 @@ type Config struct {
 	SSHCommand string `yaml:"ssh_command"`
 
 	// NotifyCommand is the path to the notification helper binary.
-	// When set, desktop notifications are posted for new port forwards.
+	// When set, desktop notifications are posted for new port forwards and
+	// for bankshot notify.
 	NotifyCommand string `yaml:"notify_command,omitempty"`
 
+	// ProxyCommand, when set, is how the CLI and the monitor reach the
+	// daemon instead of Address: the command runs through the shell and they
+	// speak to the daemon over its stdin and stdout, e.g. "ssh laptop
+	// bankshot proxy".
+	ProxyCommand string `yaml:"proxy_command,omitempty"`
+
 	// Monitor configuration (for bankshot monitor on remote servers)
 	Monitor MonitorConfig `yaml:"monitor,omitempty"`
 
 	// OpProxy configuration (for proxying 1Password CLI requests)
 	OpProxy OpProxyConfig `yaml:"op_proxy,omitempty"`
+
+	// Opener configuration (for URL open requests from remote sessions)
+	Opener OpenerConfig `yaml:"opener,omitempty"`
+
+	// Clipboard configuration (for bankshot copy and paste)
+	Clipboard ClipboardConfig `yaml:"clipboard,omitempty"`
+
+	// Forwarder configuration (for port forwards created by the daemon)
+	Forwarder ForwarderConfig `yaml:"forwarder,omitempty"`
+
+	// VHost configuration (for routing *.localhost hostnames to forwards)
+	VHost VHostConfig `yaml:"vhost,omitempty"`
+
+	// Strict makes keys bankshot doesn't know an error, rather than a
+	// warning, so a misspelled setting can't quietly leave its default
+	Strict bool `yaml:"strict,omitempty"`
+
+	// Include lists config files whose settings this file builds on, merged
+	// in order before its own; see loadFile. Paths are relative to the file
+	// and may be globs, such as "conf.d/*.yaml".
+	Include []string `yaml:"include,omitempty"`
+
+	// Path is the file Load read, empty when it found none and used the
+	// defaults
+	Path string `yaml:"-"`
+
+	// Warnings are the keys Load found that bankshot doesn't know, which
+	// it otherwise ignores; with Strict they fail the load instead
+	Warnings Errors `yaml:"-"`
+
+	// Migrated are the settings Load moved from the keys of an older
+	// layout, which bankshot config migrate rewrites the file to use
+	Migrated Errors `yaml:"-"`
+
+	// sources are the files Load read, for where settings were set
+	sources *configSources
 }
 
 // MonitorConfig represents the configuration for bankshot monitor
 type MonitorConfig struct {
-	PortRanges      []PortRange `yaml:"portRanges,omitempty"`
-	IgnorePorts     []int       `yaml:"ignorePorts,omitempty"`
-	IgnoreProcesses []string    `yaml:"ignoreProcesses,omitempty"`
-	PollInterval    string      `yaml:"pollInterval,omitempty"`
-	GracePeriod     string      `yaml:"gracePeriod,omitempty"`
+	PortRanges            []PortRange  `yaml:"portRanges,omitempty"`
+	IgnorePorts           []int        `yaml:"ignorePorts,omitempty"`
+	IgnoreProcesses       []string     `yaml:"ignoreProcesses,omitempty"`
+	AllowProcesses        []string     `yaml:"allowProcesses,omitempty"`
+	NeverForwardProcesses []string     `yaml:"neverForwardProcesses,omitempty"`
+	Source                string       `yaml:"source,omitempty"` // auto, ebpf, netlink, or poll
+	PollInterval          string       `yaml:"pollInterval,omitempty"`
+	GracePeriod           string       `yaml:"gracePeriod,omitempty"`
+	Debounce              string       `yaml:"debounce,omitempty"`
+	SettleTime            string       `yaml:"settleTime,omitempty"`
+	EventBuffer           int          `yaml:"eventBuffer,omitempty"`
+	UDP                   bool         `yaml:"udp,omitempty"`
+	Namespaces            bool         `yaml:"namespaces,omitempty"`
+	DetectProtocols       bool         `yaml:"detectProtocols,omitempty"`
+	Sockets               []SocketRule `yaml:"sockets,omitempty"`
+	Kubernetes            KubeConfig   `yaml:"kubernetes,omitempty"`
+	EventSocket           string       `yaml:"eventSocket,omitempty"`   // Unix socket streaming forward events as JSON lines (default: none)
+	StateFile             string       `yaml:"stateFile,omitempty"`     // Where forwards are saved between restarts (default: none)
+	Hooks                 []string     `yaml:"hooks,omitempty"`         // Shell commands run when a forward is created or removed
+	ControlSocket         string       `yaml:"controlSocket,omitempty"` // Unix socket answering bankshot status --remote ("" = none)
+}
+
+// EventSocketPath is where the event tap listens, with eventSocket's ~
+// expanded ("" = none)
+func (m MonitorConfig) EventSocketPath() string {
+	if path, err := homedir.Expand(m.EventSocket); err == nil {
+		return path
+	}
+	return m.EventSocket
+}
+
+// KubeConfig configures forwarding a local development cluster's annotated
+// NodePort Services
+type KubeConfig struct {
+	Enabled      bool   `yaml:"enabled,omitempty"`
+	Kubectl      string `yaml:"kubectl,omitempty"`      // kubectl binary (default: "kubectl")
+	Context      string `yaml:"context,omitempty"`      // kubeconfig context (default: current)
+	Annotation   string `yaml:"annotation,omitempty"`   // default: bankshot.dev/forward
+	PollInterval string `yaml:"pollInterval,omitempty"` // default: 10s
+}
+
+// SocketRule auto-forwards the remote Unix sockets whose path matches
+// Pattern (a filepath.Match glob) to LocalSocket or LocalPort. "{name}" in
+// LocalSocket is replaced with the remote socket's file name.
+type SocketRule struct {
+	Pattern     string `yaml:"pattern"`
+	LocalSocket string `yaml:"localSocket,omitempty"`
+	LocalPort   int    `yaml:"localPort,omitempty"`
 }
 
 // PortRange defines a range of ports
 type PortRange struct {
-	Start int `yaml:"start"`
-	End   int `yaml:"end"`
+	Start       int          `yaml:"start"`
+	End         int          `yaml:"end"`
+	HealthCheck *HealthCheck `yaml:"healthCheck,omitempty"` // must pass before a new port in the range is forwarded
+
+	// Overrides of the monitor-wide settings for ports in the range
+	GracePeriod  string `yaml:"gracePeriod,omitempty"`  // how long forwards outlive their port (0s = remove immediately)
+	PollInterval string `yaml:"pollInterval,omitempty"` // how often to scan the range's ports (the shortest of any range holding a port wins)
+	AutoForward  *bool  `yaml:"autoForward,omitempty"`  // false keeps the range's ports from being forwarded (default: true)
+}
+
+// HealthCheck probes a new port before it's forwarded, so servers that
+// crash while starting up aren't
+type HealthCheck struct {
+	Type    string `yaml:"type"`              // tcp or http
+	Path    string `yaml:"path,omitempty"`    // path requested by http checks (default: /)
+	Timeout string `yaml:"timeout,omitempty"` // how long to keep probing (default: 5s)
 }
 
 // OpProxyConfig represents the configuration for proxying 1Password CLI requests
@@ -60,13 +171,245 @@ type OpProxyConfig struct {
 	AllowedSubcommands []string `yaml:"allowed_subcommands,omitempty"`
 }
 
+// ClipboardConfig represents the configuration for bankshot copy and paste
+type ClipboardConfig struct {
+	// Paste lets `bankshot paste` on remote hosts read the local clipboard.
+	// It's off by default, since every host the socket is forwarded to
+	// could read whatever was copied, passwords included.
+	Paste bool `yaml:"paste,omitempty"`
+
+	// NotifyPaste posts a desktop notification, through notify_command,
+	// each time a remote host reads the clipboard
+	NotifyPaste bool `yaml:"notify_paste,omitempty"`
+}
+
+// OpenerConfig represents the configuration for handling open requests
+type OpenerConfig struct {
+	// MaxOpensPerHour caps how many URLs a single connection may open in a
+	// rolling hour. Zero disables the limit.
+	MaxOpensPerHour int `yaml:"max_opens_per_hour,omitempty"`
+
+	// MaxOpensPerMinute caps how many URLs are opened in a rolling minute,
+	// from all connections together, so a runaway script can't bury the
+	// laptop in tabs. Zero disables the cap.
+	MaxOpensPerMinute int `yaml:"max_opens_per_minute,omitempty"`
+
+	// DuplicateWindow is how long after a URL is opened that the same URL
+	// is ignored, for tools that run $BROWSER more than once (default: 2s;
+	// "0s" disables)
+	DuplicateWindow string `yaml:"duplicate_window,omitempty"`
+
+	// ForwardWait is how long opening a URL for a port on the remote host
+	// that wasn't forwarded yet waits, once it's forwarded, for the server
+	// there to take connections, so the browser doesn't load a refused
+	// connection (default: 10s; "0s" opens it at once)
+	ForwardWait string `yaml:"forward_wait,omitempty"`
+
+	// ForwardIdleTimeout is how long a forward made to open a URL may go
+	// without traffic before it's removed, whatever forwarder.idle_timeout
+	// says (default: 30m; "0s" keeps them like any other forward)
+	ForwardIdleTimeout string `yaml:"forward_idle_timeout,omitempty"`
+
+	// HistoryFile is where the open history is saved, so `bankshot history`
+	// and `bankshot reopen` reach back past daemon restarts (default: none,
+	// as the URLs may carry tokens)
+	HistoryFile string `yaml:"history_file,omitempty"`
+
+	// ConfirmNewDomains asks on the desktop before opening a URL on a host
+	// no URL was opened on before, as a guard against phishing links from
+	// shared remote hosts. The answers are remembered in DomainsFile.
+	ConfirmNewDomains bool `yaml:"confirm_new_domains,omitempty"`
+
+	// DomainsFile is where the hosts allowed and denied are remembered, as
+	// JSON that can be edited by hand
+	DomainsFile string `yaml:"domains_file,omitempty"`
+
+	// ConfirmCommand asks instead of the platform's dialog (osascript on
+	// macOS, zenity or kdialog on Linux). It's run with "{url}" and "{host}"
+	// in its arguments filled in, and exits 0 to open the URL, 1 to refuse
+	// the host for good, or otherwise to refuse it this once.
+	ConfirmCommand []string `yaml:"confirm_command,omitempty"`
+
+	// OpenFiles lets `bankshot open` on a remote host send files to be
+	// opened with their default application here. It's off by default, since
+	// what opens a file may run what's in it.
+	OpenFiles bool `yaml:"open_files,omitempty"`
+
+	// FileExtensions are the kinds of file OpenFiles opens, by extension
+	// without the dot (default: DefaultFileExtensions)
+	FileExtensions []string `yaml:"file_extensions,omitempty"`
+
+	// MaxFileMB is the largest file, in MiB, `bankshot open` may send to be
+	// opened locally. Zero means DefaultMaxFileMB.
+	MaxFileMB int `yaml:"max_file_mb,omitempty"`
+
+	// AllowedSchemes are the URL schemes opened besides http and https, such
+	// as "vscode" or "zoommtg". Anything else is refused, so a compromised
+	// remote host can't have file:, javascript:, or app URLs opened.
+	AllowedSchemes []string `yaml:"allowed_schemes,omitempty"`
+
+	// EditorLinks handles links into editors, like vscode://file/... from
+	// coverage tools: "open" allows the schemes of the editors bankshot
+	// knows, and "remote" also rewrites VS Code-style links to files to
+	// open them on the remote host over the editor's Remote-SSH. Empty
+	// leaves editor schemes to AllowedSchemes like any other.
+	EditorLinks string `yaml:"editor_links,omitempty"`
+
+	// Browsers picks the browser, or browser profile, URLs open in by their
+	// host. The first rule matching a URL's host runs its command; URLs no
+	// rule matches open in Browser, or the system's default browser.
+	Browsers []BrowserRule `yaml:"browsers,omitempty"`
+
+	// Browser is the browser URLs no rule picks one for open in, one of
+	// BrowserNames. It's needed for `bankshot open --profile` and
+	// --incognito, since the system's default browser takes neither.
+	Browser string `yaml:"browser,omitempty"`
+
+	// Profiles maps the names `bankshot open --profile` is given to the
+	// browser's own: a Chrome profile directory such as "Profile 1", or a
+	// Firefox profile name. Names not listed are passed on as they are.
+	Profiles map[string]string `yaml:"profiles,omitempty"`
+}
+
+// BrowserRule opens the URLs whose host matches Match with Command, or in
+// Browser
+type BrowserRule struct {
+	// Match is a glob for the host, e.g. "*.corp.example.com" or "*"
+	Match string `yaml:"match"`
+
+	// Command is the program and arguments to run, with "{url}" replaced by
+	// the URL, or the URL appended when no argument has it, e.g.
+	// ["open", "-na", "Google Chrome", "--args", "--profile-directory=Profile 1"]
+	Command []string `yaml:"command,omitempty"`
+
+	// Browser and Profile are an alternative to Command: the browser, one of
+	// BrowserNames, and optionally the profile in it to open URLs in.
+	// Unlike a command, they let `bankshot open --profile` and --incognito
+	// still apply.
+	Browser string `yaml:"browser,omitempty"`
+	Profile string `yaml:"profile,omitempty"`
+}
+
+// BrowserNames are the browsers opener.browser and opener.browsers may name
+var BrowserNames = []string{"brave", "chrome", "chromium", "edge", "firefox"}
+
+// DefaultFileExtensions are the files opened when opener.file_extensions
+// isn't set: documents and images that open in a viewer, nothing that runs
+var DefaultFileExtensions = []string{"csv", "gif", "htm", "html", "jpeg", "jpg", "json", "log", "md", "pdf", "png", "svg", "txt", "webp"}
+
+// DefaultMaxFileMB is the largest file `bankshot open` may send when
+// opener.max_file_mb isn't set
+const DefaultMaxFileMB = 100
+
+// ForwarderConfig represents the configuration for managing port forwards
+type ForwarderConfig struct {
+	// PortConflict selects what happens when the requested local port is
+	// already in use: "fail" (default), "next" (next free port above it),
+	// "random" (any free port), or "steal" (cancel the forward, from any
+	// connection, holding it). Forward requests may override it.
+	PortConflict string `yaml:"port_conflict,omitempty"`
+
+	// Backend selects how forwards are carried out: "openssh" (default)
+	// drives OpenSSH ControlMaster connections with ssh -O, and "tsh" runs a
+	// `tsh ssh -N -L` process per forward for hosts behind Teleport.
+	Backend string `yaml:"backend,omitempty"`
+
+	// TshCommand is the tsh binary the tsh backend runs (default: "tsh")
+	TshCommand string `yaml:"tsh_command,omitempty"`
+
+	// TeleportProxy is the Teleport proxy the tsh backend logs in through
+	// (default: the current tsh profile's)
+	TeleportProxy string `yaml:"teleport_proxy,omitempty"`
+
+	// ReconcileInterval controls how often the daemon checks that tracked
+	// forwards are still listening, re-establishing or dropping stale ones
+	// (default: "10m").
+	ReconcileInterval string `yaml:"reconcile_interval,omitempty"`
+
+	// LivenessInterval controls how often the daemon runs `ssh -O check`
+	// against each connection with forwards, taking down the forwards of
+	// connections that went away and re-establishing them if the connection
+	// returns (default: "30s"). Empty disables.
+	LivenessInterval string `yaml:"liveness_interval,omitempty"`
+
+	// IdleTimeout removes forwards that carry no traffic for this long (e.g.
+	// "2h"). Activity is exact with accounting enabled and sampled from the
+	// connection table otherwise (on Linux and macOS; elsewhere only
+	// accounted forwards expire). Empty disables.
+	IdleTimeout string `yaml:"idle_timeout,omitempty"`
+
+	// AuditInterval enables a periodic self-audit that checks every forward's
+	// local listener is only reachable on loopback (e.g. "5m"). Empty disables.
+	AuditInterval string `yaml:"audit_interval,omitempty"`
+
+	// AuditFix re-binds forwards found listening beyond loopback
+	AuditFix bool `yaml:"audit_fix,omitempty"`
+
+	// Accounting fronts each forward with a local relay that counts bytes
+	// and connections, shown by `bankshot list` and `bankshot status`
+	Accounting bool `yaml:"accounting,omitempty"`
+
+	// RetryMaxAttempts is how many times a forward that ssh rejected is
+	// retried with exponential backoff before giving up (default: 5, 0
+	// disables retries)
+	RetryMaxAttempts int `yaml:"retry_max_attempts,omitempty"`
+
+	// Workers bounds how many SSH connections reconcile, audit, and retry
+	// passes operate on concurrently (default: 4)
+	Workers int `yaml:"workers,omitempty"`
+
+	// BindAddress is the local address forwards listen on unless a request
+	// names one (default: ssh's choice, normally loopback)
+	BindAddress string `yaml:"bind_address,omitempty"`
+
+	// AllowLANBind permits bind addresses beyond loopback, such as 0.0.0.0,
+	// so other machines on the network can reach a forward. The SSH master
+	// also needs GatewayPorts enabled for ssh to honor them.
+	AllowLANBind bool `yaml:"allow_lan_bind,omitempty"`
+}
+
+// VHostConfig represents the configuration for the hostname-routing proxy,
+// which lets several forwarded dev servers share one local port
+type VHostConfig struct {
+	// Listen lists the local addresses the proxy accepts connections on,
+	// such as 127.0.0.1:80 and 127.0.0.1:443. Empty disables the proxy.
+	Listen []string `yaml:"listen,omitempty"`
+
+	// Domain is the hostname suffix the proxy serves. The label just before
+	// it names the forward to route to, so with "vm.localhost",
+	// myapp.vm.localhost reaches the forward named myapp (default:
+	// "localhost").
+	Domain string `yaml:"domain,omitempty"`
+
+	// Routes maps full hostnames to local ports, for forwards without a name
+	Routes map[string]int `yaml:"routes,omitempty"`
+}
+
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
+		Version:    CurrentVersion(),
 		Network:    "unix",
 		Address:    "~/.bankshot.sock",
 		LogLevel:   "info",
 		SSHCommand: "ssh",
+		Opener: OpenerConfig{
+			DuplicateWindow:    "2s",
+			ForwardWait:        "10s",
+			ForwardIdleTimeout: "30m",
+			DomainsFile:        "~/.local/state/bankshot/domains.json",
+		},
+		Forwarder: ForwarderConfig{
+			ReconcileInterval: "10m",
+			LivenessInterval:  "30s",
+			RetryMaxAttempts:  5,
+		},
+		VHost: VHostConfig{
+			Domain: "localhost",
+		},
+		Monitor: MonitorConfig{
+			ControlSocket: "~/.bankshot-monitor.sock",
+		},
 		OpProxy: OpProxyConfig{
 			Enabled:  false,
 			OpPath:   "op",
@@ -75,60 +418,112 @@ func DefaultConfig() *Config {
 	}
 }
 
-// Load loads configuration from file
+// Load loads configuration from file, along with the files it includes.
+// Problems with particular settings are reported as Errors, at the file
+// and line that set them.
 func Load(path string) (*Config, error) {
-	cfg := DefaultConfig()
-
 	// If no path specified, try default locations
 	if path == "" {
-		home, err := homedir.Dir()
+		// Try ~/.config/bankshot/config.yaml first
+		var err error
+		path, err = DefaultPath()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
+			return nil, err
 		}
+	}
 
-		// Try ~/.config/bankshot/config.yaml first
-		path = filepath.Join(home, ".config", "bankshot", "config.yaml")
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			// If not found, return default config
-			return cfg, nil
-		}
+	cfg, _, err := loadPath(path)
+	if err != nil {
+		return nil, err
 	}
+	return cfg, nil
+}
 
-	// Read config file
-	data, err := os.ReadFile(path)
+// loadPath loads the config at path, or the defaults if there's no file
+// there, with the environment's overrides applied, along with the files it
+// came from, nil when it couldn't tell
+func loadPath(path string) (*Config, *configSources, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		cfg := DefaultConfig()
+		cfg.applyEnv()
+		return cfg, nil, nil
+	}
+	cfg, sources, err := load(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			// File doesn't exist, use defaults
-			return cfg, nil
+		return nil, sources, err
+	}
+	if err := cfg.strictErr(); err != nil {
+		return nil, sources, err
+	}
+	cfg.applyEnv()
+	return cfg, sources, nil
+}
+
+// applyEnv applies the environment's overrides of the config:
+// BANKSHOT_SOCKET for Address, and BANKSHOT_DEBUG, set to anything but a
+// false value, for debug logging
+func (c *Config) applyEnv() {
+	if socket := os.Getenv("BANKSHOT_SOCKET"); socket != "" {
+		c.Address = socket
+	}
+	if debug := os.Getenv("BANKSHOT_DEBUG"); debug != "" {
+		if on, err := strconv.ParseBool(debug); err != nil || on {
+			c.LogLevel = "debug"
 		}
-		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
+}
 
-	// Parse YAML
-	if err := yaml.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+// strictErr returns the keys bankshot doesn't know as an error when Strict
+// is set
+func (c *Config) strictErr() error {
+	if !c.Strict {
+		return nil
 	}
+	return c.Warnings.err()
+}
 
-	return cfg, nil
+// LogWarnings logs the Warnings Load found, for a process that carries on
+// without the settings they're about, and the settings it Migrated
+func (c *Config) LogWarnings(logger *slog.Logger) {
+	for _, w := range c.Warnings {
+		logger.Warn("Ignoring unknown config key", "key", w.Key, "file", w.File, "line", w.Line, "error", w.Err)
+	}
+	for _, m := range c.Migrated {
+		logger.Warn("Config key renamed, run bankshot config migrate", "key", m.Key, "file", m.File, "line", m.Line, "change", m.Err)
+	}
+}
+
+// Level returns LogLevel as a slog level, info if it isn't one
+func (c *Config) Level() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
 }
 
-// Validate validates the configuration
+// Validate validates the configuration, reporting each problem it finds as
+// Errors, with where the config file set the setting when Load read it from
+// one
 func (c *Config) Validate() error {
+	var errs Errors
+
 	// Validate network type
 	switch c.Network {
 	case "unix", "tcp":
 		// Valid
 	default:
-		return fmt.Errorf("invalid network type: %s (must be 'unix' or 'tcp')", c.Network)
+		errs.add("network", "invalid network type: %s (must be 'unix' or 'tcp')", c.Network)
 	}
 
 	// Expand home directory in address if unix socket
 	if c.Network == "unix" {
 		expanded, err := homedir.Expand(c.Address)
 		if err != nil {
-			return fmt.Errorf("failed to expand address: %w", err)
+			errs.add("address", "failed to expand address: %w", err)
+		} else {
+			c.Address = expanded
 		}
-		c.Address = expanded
 	}
 
 	// Validate log level
@@ -136,8 +531,272 @@ func (c *Config) Validate() error {
 	case "debug", "info", "warn", "error":
 		// Valid
 	default:
-		return fmt.Errorf("invalid log level: %s", c.LogLevel)
+		errs.add("log_level", "invalid log level: %s", c.LogLevel)
+	}
+
+	// Validate port conflict strategy
+	if !protocol.ValidConflictPolicy(c.Forwarder.PortConflict) {
+		errs.add("forwarder.port_conflict", "invalid forwarder.port_conflict: %s (must be %s)", c.Forwarder.PortConflict, protocol.ConflictPolicyNames())
+	}
+
+	switch c.Forwarder.Backend {
+	case "", "openssh", "tsh":
+		// Valid
+	default:
+		errs.add("forwarder.backend", "invalid forwarder.backend: %s (must be 'openssh' or 'tsh')", c.Forwarder.Backend)
 	}
 
-	return nil
+	if c.Forwarder.ReconcileInterval != "" {
+		if d, err := time.ParseDuration(c.Forwarder.ReconcileInterval); err != nil || d <= 0 {
+			errs.add("forwarder.reconcile_interval", "invalid forwarder.reconcile_interval: %s", c.Forwarder.ReconcileInterval)
+		}
+	}
+
+	if c.Forwarder.LivenessInterval != "" {
+		if d, err := time.ParseDuration(c.Forwarder.LivenessInterval); err != nil || d <= 0 {
+			errs.add("forwarder.liveness_interval", "invalid forwarder.liveness_interval: %s", c.Forwarder.LivenessInterval)
+		}
+	}
+
+	if c.Forwarder.IdleTimeout != "" {
+		if d, err := time.ParseDuration(c.Forwarder.IdleTimeout); err != nil || d <= 0 {
+			errs.add("forwarder.idle_timeout", "invalid forwarder.idle_timeout: %s", c.Forwarder.IdleTimeout)
+		}
+	}
+
+	if c.Forwarder.AuditInterval != "" {
+		if d, err := time.ParseDuration(c.Forwarder.AuditInterval); err != nil || d <= 0 {
+			errs.add("forwarder.audit_interval", "invalid forwarder.audit_interval: %s", c.Forwarder.AuditInterval)
+		}
+	}
+
+	if c.Forwarder.RetryMaxAttempts < 0 {
+		errs.add("forwarder.retry_max_attempts", "invalid forwarder.retry_max_attempts: %d (must be >= 0)", c.Forwarder.RetryMaxAttempts)
+	}
+
+	if c.Forwarder.Workers < 0 {
+		errs.add("forwarder.workers", "invalid forwarder.workers: %d (must be >= 0)", c.Forwarder.Workers)
+	}
+
+	if c.Forwarder.BindAddress != "" && !protocol.IsLoopbackAddress(c.Forwarder.BindAddress) && !c.Forwarder.AllowLANBind {
+		errs.add("forwarder.bind_address", "invalid forwarder.bind_address: %s (requires forwarder.allow_lan_bind)", c.Forwarder.BindAddress)
+	}
+
+	switch c.Monitor.Source {
+	case "", "auto", "ebpf", "netlink", "poll":
+	default:
+		errs.add("monitor.source", "invalid monitor.source: %s (must be auto, ebpf, netlink, or poll)", c.Monitor.Source)
+	}
+
+	if c.Monitor.Debounce != "" {
+		if d, err := time.ParseDuration(c.Monitor.Debounce); err != nil || d < 0 {
+			errs.add("monitor.debounce", "invalid monitor.debounce: %s", c.Monitor.Debounce)
+		}
+	}
+
+	if c.Monitor.SettleTime != "" {
+		if d, err := time.ParseDuration(c.Monitor.SettleTime); err != nil || d < 0 {
+			errs.add("monitor.settleTime", "invalid monitor.settleTime: %s", c.Monitor.SettleTime)
+		}
+	}
+
+	for i, pr := range c.Monitor.PortRanges {
+		key := fmt.Sprintf("monitor.portRanges[%d]", i)
+		if pr.GracePeriod != "" {
+			if d, err := time.ParseDuration(pr.GracePeriod); err != nil || d < 0 {
+				errs.add(key+".gracePeriod", "invalid monitor.portRanges gracePeriod for %d-%d: %s", pr.Start, pr.End, pr.GracePeriod)
+			}
+		}
+		if pr.PollInterval != "" {
+			if d, err := time.ParseDuration(pr.PollInterval); err != nil || d <= 0 {
+				errs.add(key+".pollInterval", "invalid monitor.portRanges pollInterval for %d-%d: %s", pr.Start, pr.End, pr.PollInterval)
+			}
+		}
+		if pr.HealthCheck == nil {
+			continue
+		}
+		switch pr.HealthCheck.Type {
+		case "tcp", "http":
+		default:
+			errs.add(key+".healthCheck.type", "invalid monitor.portRanges healthCheck type for %d-%d: %s (must be tcp or http)", pr.Start, pr.End, pr.HealthCheck.Type)
+		}
+		if pr.HealthCheck.Path != "" && !strings.HasPrefix(pr.HealthCheck.Path, "/") {
+			errs.add(key+".healthCheck.path", "invalid monitor.portRanges healthCheck path for %d-%d: %s (must start with /)", pr.Start, pr.End, pr.HealthCheck.Path)
+		}
+		if pr.HealthCheck.Timeout != "" {
+			if d, err := time.ParseDuration(pr.HealthCheck.Timeout); err != nil || d <= 0 {
+				errs.add(key+".healthCheck.timeout", "invalid monitor.portRanges healthCheck timeout for %d-%d: %s", pr.Start, pr.End, pr.HealthCheck.Timeout)
+			}
+		}
+	}
+
+	if c.Monitor.EventBuffer < 0 {
+		errs.add("monitor.eventBuffer", "invalid monitor.eventBuffer: %d (must be >= 0)", c.Monitor.EventBuffer)
+	}
+
+	for i, rule := range c.Monitor.Sockets {
+		key := fmt.Sprintf("monitor.sockets[%d]", i)
+		if _, err := filepath.Match(rule.Pattern, ""); err != nil || !filepath.IsAbs(rule.Pattern) {
+			errs.add(key+".pattern", "invalid monitor.sockets pattern: %q (must be an absolute path glob)", rule.Pattern)
+		}
+		if (rule.LocalSocket == "") == (rule.LocalPort == 0) {
+			errs.add(key, "invalid monitor.sockets entry for %s: set exactly one of localSocket or localPort", rule.Pattern)
+		}
+		if rule.LocalPort < 0 || rule.LocalPort > 65535 {
+			errs.add(key+".localPort", "invalid monitor.sockets localPort for %s: %d", rule.Pattern, rule.LocalPort)
+		}
+	}
+
+	if _, err := homedir.Expand(c.Monitor.EventSocket); err != nil {
+		errs.add("monitor.eventSocket", "failed to expand monitor.eventSocket: %w", err)
+	}
+
+	for i, hook := range c.Monitor.Hooks {
+		if strings.TrimSpace(hook) == "" {
+			errs.add(fmt.Sprintf("monitor.hooks[%d]", i), "invalid monitor.hooks entry: empty command")
+		}
+	}
+
+	if c.Monitor.ControlSocket != "" {
+		expanded, err := homedir.Expand(c.Monitor.ControlSocket)
+		if err != nil {
+			errs.add("monitor.controlSocket", "failed to expand monitor.controlSocket: %w", err)
+		} else {
+			c.Monitor.ControlSocket = expanded
+		}
+	}
+
+	if c.Monitor.StateFile != "" {
+		expanded, err := homedir.Expand(c.Monitor.StateFile)
+		if err != nil {
+			errs.add("monitor.stateFile", "failed to expand monitor.stateFile: %w", err)
+		} else {
+			c.Monitor.StateFile = expanded
+		}
+	}
+
+	if c.Opener.HistoryFile != "" {
+		expanded, err := homedir.Expand(c.Opener.HistoryFile)
+		if err != nil {
+			errs.add("opener.history_file", "failed to expand opener.history_file: %w", err)
+		} else {
+			c.Opener.HistoryFile = expanded
+		}
+	}
+
+	if c.Opener.DomainsFile != "" {
+		expanded, err := homedir.Expand(c.Opener.DomainsFile)
+		if err != nil {
+			errs.add("opener.domains_file", "failed to expand opener.domains_file: %w", err)
+		} else {
+			c.Opener.DomainsFile = expanded
+		}
+	}
+	if c.Opener.ConfirmNewDomains && c.Opener.DomainsFile == "" {
+		errs.add("opener.confirm_new_domains", "invalid opener.confirm_new_domains: needs opener.domains_file")
+	}
+	if len(c.Opener.ConfirmCommand) > 0 && c.Opener.ConfirmCommand[0] == "" {
+		errs.add("opener.confirm_command", "invalid opener.confirm_command: program is empty")
+	}
+
+	if c.Monitor.Kubernetes.PollInterval != "" {
+		if d, err := time.ParseDuration(c.Monitor.Kubernetes.PollInterval); err != nil || d <= 0 {
+			errs.add("monitor.kubernetes.pollInterval", "invalid monitor.kubernetes.pollInterval: %s", c.Monitor.Kubernetes.PollInterval)
+		}
+	}
+
+	for i, addr := range c.VHost.Listen {
+		key := fmt.Sprintf("vhost.listen[%d]", i)
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			errs.add(key, "invalid vhost.listen address: %s", addr)
+		}
+		if !protocol.IsLoopbackAddress(host) && !c.Forwarder.AllowLANBind {
+			errs.add(key, "invalid vhost.listen address: %s (requires forwarder.allow_lan_bind)", addr)
+		}
+	}
+
+	for host, port := range c.VHost.Routes {
+		if port < 1 || port > 65535 {
+			errs.add("vhost.routes", "invalid vhost.routes port for %s: %d", host, port)
+		}
+	}
+
+	if c.Opener.MaxOpensPerHour < 0 {
+		errs.add("opener.max_opens_per_hour", "invalid opener.max_opens_per_hour: %d (must be >= 0)", c.Opener.MaxOpensPerHour)
+	}
+	if c.Opener.MaxOpensPerMinute < 0 {
+		errs.add("opener.max_opens_per_minute", "invalid opener.max_opens_per_minute: %d (must be >= 0)", c.Opener.MaxOpensPerMinute)
+	}
+	if c.Opener.DuplicateWindow != "" {
+		if d, err := time.ParseDuration(c.Opener.DuplicateWindow); err != nil || d < 0 {
+			errs.add("opener.duplicate_window", "invalid opener.duplicate_window: %s", c.Opener.DuplicateWindow)
+		}
+	}
+	if c.Opener.ForwardWait != "" {
+		if d, err := time.ParseDuration(c.Opener.ForwardWait); err != nil || d < 0 {
+			errs.add("opener.forward_wait", "invalid opener.forward_wait: %s", c.Opener.ForwardWait)
+		}
+	}
+	if c.Opener.ForwardIdleTimeout != "" {
+		if d, err := time.ParseDuration(c.Opener.ForwardIdleTimeout); err != nil || d < 0 {
+			errs.add("opener.forward_idle_timeout", "invalid opener.forward_idle_timeout: %s", c.Opener.ForwardIdleTimeout)
+		}
+	}
+	if c.Opener.MaxFileMB < 0 {
+		errs.add("opener.max_file_mb", "invalid opener.max_file_mb: %d (must be >= 0)", c.Opener.MaxFileMB)
+	}
+	for i, ext := range c.Opener.FileExtensions {
+		if ext == "" || strings.ContainsAny(ext, "./\\") {
+			errs.add(fmt.Sprintf("opener.file_extensions[%d]", i), "invalid opener.file_extensions entry: %q (want an extension like \"pdf\", without \".\")", ext)
+		}
+	}
+	for i, rule := range c.Opener.Browsers {
+		key := fmt.Sprintf("opener.browsers[%d]", i)
+		if _, err := path.Match(rule.Match, ""); rule.Match == "" || err != nil {
+			errs.add(key+".match", "invalid opener.browsers[%d].match: %q", i, rule.Match)
+		}
+		hasCommand := len(rule.Command) > 0
+		if hasCommand && rule.Command[0] == "" {
+			errs.add(key+".command", "invalid opener.browsers[%d].command: program is empty", i)
+		}
+		if hasCommand == (rule.Browser != "") {
+			errs.add(key, "invalid opener.browsers[%d]: exactly one of command or browser is required", i)
+		}
+		if rule.Browser != "" && !slices.Contains(BrowserNames, rule.Browser) {
+			errs.add(key+".browser", "invalid opener.browsers[%d].browser: %q (must be one of %s)", i, rule.Browser, strings.Join(BrowserNames, ", "))
+		}
+		if rule.Profile != "" && rule.Browser == "" {
+			errs.add(key+".profile", "invalid opener.browsers[%d].profile: needs browser, not command", i)
+		}
+	}
+	switch c.Opener.EditorLinks {
+	case "", "open", "remote":
+	default:
+		errs.add("opener.editor_links", "invalid opener.editor_links: %q (must be open or remote)", c.Opener.EditorLinks)
+	}
+	if c.Opener.Browser != "" && !slices.Contains(BrowserNames, c.Opener.Browser) {
+		errs.add("opener.browser", "invalid opener.browser: %q (must be one of %s)", c.Opener.Browser, strings.Join(BrowserNames, ", "))
+	}
+	for i, scheme := range c.Opener.AllowedSchemes {
+		if !isURLScheme(scheme) {
+			errs.add(fmt.Sprintf("opener.allowed_schemes[%d]", i), "invalid opener.allowed_schemes entry: %q (want a scheme like \"vscode\", without \":\")", scheme)
+		}
+	}
+
+	return c.sources.locate(errs).err()
+}
+
+// isURLScheme reports whether s is a URL scheme as RFC 3986 defines one: a
+// letter followed by letters, digits, "+", "-", or "."
+func isURLScheme(s string) bool {
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return s != ""
 }
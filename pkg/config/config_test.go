@@ -1,9 +1,12 @@
 package config
 
 import (
+	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/mitchellh/go-homedir"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -97,6 +100,14 @@ log_level: warn`,
 				if got.SSHCommand != tt.want.SSHCommand {
 					t.Errorf("Load() SSHCommand = %v, want %v", got.SSHCommand, tt.want.SSHCommand)
 				}
+				// Without content no file is written, leaving the defaults
+				wantPath := ""
+				if tt.content != "" {
+					wantPath = tmpFile
+				}
+				if got.Path != wantPath {
+					t.Errorf("Load() Path = %q, want %q", got.Path, wantPath)
+				}
 			}
 		})
 	}
@@ -110,6 +121,8 @@ func TestLoadNonExistentFile(t *testing.T) {
 	}
 	if cfg == nil {
 		t.Errorf("Load() with non-existent file should return default config, got nil")
+	} else if cfg.Path != "" {
+		t.Errorf("Load() with non-existent file Path = %q, want empty", cfg.Path)
 	}
 
 	// Test with empty path (default locations)
@@ -122,6 +135,49 @@ func TestLoadNonExistentFile(t *testing.T) {
 	}
 }
 
+func TestLoadRetryMaxAttemptsZero(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("forwarder:\n  retry_max_attempts: 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	// Omitted when it's 0, but still read, so 0 turns retries off
+	if cfg.Forwarder.RetryMaxAttempts != 0 {
+		t.Errorf("RetryMaxAttempts = %d, want the file's 0 over the default", cfg.Forwarder.RetryMaxAttempts)
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("address: /tmp/file.sock\nlog_level: warn\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("BANKSHOT_SOCKET", "/tmp/env.sock")
+	t.Setenv("BANKSHOT_DEBUG", "1")
+	for _, p := range []string{path, "/non/existent/path/config.yaml"} {
+		cfg, err := Load(p)
+		if err != nil {
+			t.Fatalf("Load(%s) error = %v", p, err)
+		}
+		if cfg.Address != "/tmp/env.sock" || cfg.LogLevel != "debug" {
+			t.Errorf("Load(%s) address = %q, log_level = %q, want the environment's", p, cfg.Address, cfg.LogLevel)
+		}
+	}
+
+	t.Setenv("BANKSHOT_DEBUG", "false")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.LogLevel != "warn" {
+		t.Errorf("Load() with BANKSHOT_DEBUG=false log_level = %q, want the file's", cfg.LogLevel)
+	}
+}
+
 func TestValidate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -171,6 +227,386 @@ func TestValidate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "invalid log level: verbose",
 		},
+		{
+			name: "negative retry attempts",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Forwarder:  ForwarderConfig{RetryMaxAttempts: -1},
+			},
+			wantErr: true,
+			errMsg:  "invalid forwarder.retry_max_attempts",
+		},
+		{
+			name: "invalid liveness interval",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Forwarder:  ForwarderConfig{LivenessInterval: "soon"},
+			},
+			wantErr: true,
+			errMsg:  "invalid forwarder.liveness_interval",
+		},
+		{
+			name: "invalid idle timeout",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Forwarder:  ForwarderConfig{IdleTimeout: "-1h"},
+			},
+			wantErr: true,
+			errMsg:  "invalid forwarder.idle_timeout",
+		},
+		{
+			name: "lan bind address without gate",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Forwarder:  ForwarderConfig{BindAddress: "0.0.0.0"},
+			},
+			wantErr: true,
+			errMsg:  "invalid forwarder.bind_address",
+		},
+		{
+			name: "lan bind address with gate",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Forwarder:  ForwarderConfig{BindAddress: "0.0.0.0", AllowLANBind: true},
+			},
+			wantErr: false,
+		},
+		{
+			name: "vhost listen beyond loopback without gate",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				VHost:      VHostConfig{Listen: []string{"127.0.0.1:8080", ":443"}},
+			},
+			wantErr: true,
+			errMsg:  "invalid vhost.listen address: :443",
+		},
+		{
+			name: "invalid vhost route port",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				VHost:      VHostConfig{Routes: map[string]int{"app.localhost": 70000}},
+			},
+			wantErr: true,
+			errMsg:  "invalid vhost.routes port",
+		},
+		{
+			name: "monitor socket rule without local target",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Monitor:    MonitorConfig{Sockets: []SocketRule{{Pattern: "/run/user/*/docker.sock"}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid monitor.sockets entry",
+		},
+		{
+			name: "invalid monitor source",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Monitor:    MonitorConfig{Source: "kprobe"},
+			},
+			wantErr: true,
+			errMsg:  "invalid monitor.source",
+		},
+		{
+			name: "invalid monitor debounce",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Monitor:    MonitorConfig{Debounce: "soon"},
+			},
+			wantErr: true,
+			errMsg:  "invalid monitor.debounce",
+		},
+		{
+			name: "negative monitor event buffer",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Monitor:    MonitorConfig{EventBuffer: -1},
+			},
+			wantErr: true,
+			errMsg:  "invalid monitor.eventBuffer",
+		},
+		{
+			name: "monitor port range health check",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Monitor: MonitorConfig{PortRanges: []PortRange{
+					{Start: 3000, End: 3999, HealthCheck: &HealthCheck{Type: "http", Path: "/healthz", Timeout: "10s"}},
+				}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "monitor port range health check with unknown type",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Monitor: MonitorConfig{PortRanges: []PortRange{
+					{Start: 3000, End: 3999, HealthCheck: &HealthCheck{Type: "grpc"}},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "invalid monitor.portRanges healthCheck type",
+		},
+		{
+			name: "monitor port range health check with invalid timeout",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Monitor: MonitorConfig{PortRanges: []PortRange{
+					{Start: 3000, End: 3999, HealthCheck: &HealthCheck{Type: "tcp", Timeout: "0s"}},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "invalid monitor.portRanges healthCheck timeout",
+		},
+		{
+			name: "monitor port range overrides",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Monitor: MonitorConfig{PortRanges: []PortRange{
+					{Start: 30000, End: 65535, GracePeriod: "0s", PollInterval: "500ms"},
+					{Start: 5432, End: 5432, AutoForward: new(bool)},
+				}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "monitor port range with negative grace period",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Monitor:    MonitorConfig{PortRanges: []PortRange{{Start: 3000, End: 3999, GracePeriod: "-1s"}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid monitor.portRanges gracePeriod",
+		},
+		{
+			name: "monitor port range with zero poll interval",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Monitor:    MonitorConfig{PortRanges: []PortRange{{Start: 3000, End: 3999, PollInterval: "0s"}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid monitor.portRanges pollInterval",
+		},
+		{
+			name: "monitor hook with empty command",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Monitor:    MonitorConfig{Hooks: []string{"tmux refresh-client -S", " "}},
+			},
+			wantErr: true,
+			errMsg:  "invalid monitor.hooks entry",
+		},
+		{
+			name: "monitor socket rule with relative pattern",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Monitor:    MonitorConfig{Sockets: []SocketRule{{Pattern: "*.sock", LocalPort: 2375}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid monitor.sockets pattern",
+		},
+		{
+			name: "negative opener max file size",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Opener:     OpenerConfig{MaxFileMB: -1},
+			},
+			wantErr: true,
+			errMsg:  "invalid opener.max_file_mb",
+		},
+		{
+			name: "opener allowed schemes",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Opener:     OpenerConfig{AllowedSchemes: []string{"vscode", "x-github-client", "web+mastodon"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "opener browser without command",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Opener:     OpenerConfig{Browsers: []BrowserRule{{Match: "*.corp.example.com"}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid opener.browsers[0]: exactly one of command or browser is required",
+		},
+		{
+			name: "opener browser by name",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Opener: OpenerConfig{
+					Browser:  "firefox",
+					Profiles: map[string]string{"work": "Profile 1"},
+					Browsers: []BrowserRule{{Match: "*.corp.example.com", Browser: "chrome", Profile: "Profile 1"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "opener browser with command and browser",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Opener:     OpenerConfig{Browsers: []BrowserRule{{Match: "*", Command: []string{"firefox"}, Browser: "firefox"}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid opener.browsers[0]: exactly one of command or browser is required",
+		},
+		{
+			name: "opener browser rule unknown browser",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Opener:     OpenerConfig{Browsers: []BrowserRule{{Match: "*", Browser: "netscape"}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid opener.browsers[0].browser",
+		},
+		{
+			name: "opener unknown browser",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Opener:     OpenerConfig{Browser: "safari"},
+			},
+			wantErr: true,
+			errMsg:  "invalid opener.browser",
+		},
+		{
+			name: "opener editor links",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Opener:     OpenerConfig{EditorLinks: "translate"},
+			},
+			wantErr: true,
+			errMsg:  "invalid opener.editor_links",
+		},
+		{
+			name: "opener confirm without domains file",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Opener:     OpenerConfig{ConfirmNewDomains: true},
+			},
+			wantErr: true,
+			errMsg:  "invalid opener.confirm_new_domains",
+		},
+		{
+			name: "opener confirm command without program",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Opener:     OpenerConfig{ConfirmNewDomains: true, DomainsFile: "/tmp/domains.json", ConfirmCommand: []string{""}},
+			},
+			wantErr: true,
+			errMsg:  "invalid opener.confirm_command",
+		},
+		{
+			name: "opener browser with bad pattern",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Opener:     OpenerConfig{Browsers: []BrowserRule{{Match: "[corp", Command: []string{"firefox"}}}},
+			},
+			wantErr: true,
+			errMsg:  "invalid opener.browsers[0].match",
+		},
+		{
+			name: "opener allowed scheme with colon",
+			config: &Config{
+				Network:    "unix",
+				Address:    "~/.bankshot.sock",
+				LogLevel:   "info",
+				SSHCommand: "ssh",
+				Opener:     OpenerConfig{AllowedSchemes: []string{"vscode:"}},
+			},
+			wantErr: true,
+			errMsg:  "invalid opener.allowed_schemes",
+		},
 		{
 			name: "all log levels",
 			config: &Config{
@@ -215,6 +651,40 @@ func TestValidateLogLevels(t *testing.T) {
 	}
 }
 
+func TestEventSocketPath(t *testing.T) {
+	home, err := homedir.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Monitor.EventSocket = "~/.bankshot-events.sock"
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Monitor.EventSocket != "~/.bankshot-events.sock" {
+		t.Errorf("Validate() changed monitor.eventSocket to %q", cfg.Monitor.EventSocket)
+	}
+	if got, want := cfg.Monitor.EventSocketPath(), filepath.Join(home, ".bankshot-events.sock"); got != want {
+		t.Errorf("EventSocketPath() = %q, want %q", got, want)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	tests := map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"info":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+		"":      slog.LevelInfo,
+	}
+	for logLevel, want := range tests {
+		cfg := &Config{LogLevel: logLevel}
+		if got := cfg.Level(); got != want {
+			t.Errorf("Level() with log level %q = %v, want %v", logLevel, got, want)
+		}
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && s[:len(substr)] == substr
 }
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Change is a setting that differs between two configs, by its path in the
+// config file, like "monitor.ignorePorts", with both values as YAML
+type Change struct {
+	Path string
+	Old  string
+	New  string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+}
+
+// Diff lists the settings that differ between old and new, in the order
+// the Config declares them. Sections are compared setting by setting, and
+// lists and maps as a whole. Include isn't compared, as the settings the
+// included files bring are.
+func Diff(old, new *Config) []Change {
+	return diffStruct("", reflect.ValueOf(*old), reflect.ValueOf(*new))
+}
+
+func diffStruct(prefix string, old, new reflect.Value) []Change {
+	var changes []Change
+	for i := 0; i < old.NumField(); i++ {
+		name, _, _ := strings.Cut(old.Type().Field(i).Tag.Get("yaml"), ",")
+		if name == "-" || name == "" || name == "include" {
+			continue
+		}
+		oldField, newField := old.Field(i), new.Field(i)
+		if oldField.Kind() == reflect.Struct {
+			changes = append(changes, diffStruct(prefix+name+".", oldField, newField)...)
+			continue
+		}
+		if reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			continue
+		}
+		changes = append(changes, Change{
+			Path: prefix + name,
+			Old:  flowYAML(oldField.Interface()),
+			New:  flowYAML(newField.Interface()),
+		})
+	}
+	return changes
+}
+
+// flowYAML renders v as YAML on one line
+func flowYAML(v any) string {
+	var node yaml.Node
+	if err := node.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	setFlowStyle(&node)
+	out, err := yaml.Marshal(&node)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func setFlowStyle(node *yaml.Node) {
+	node.Style |= yaml.FlowStyle
+	for _, child := range node.Content {
+		setFlowStyle(child)
+	}
+}
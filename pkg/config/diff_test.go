@@ -0,0 +1,34 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := DefaultConfig()
+	if changes := Diff(old, DefaultConfig()); len(changes) != 0 {
+		t.Errorf("Diff() of equal configs = %v, want none", changes)
+	}
+
+	new := DefaultConfig()
+	new.LogLevel = "debug"
+	new.Monitor.IgnorePorts = []int{22, 5432}
+	new.Monitor.PortRanges = []PortRange{{Start: 3000, End: 3999, HealthCheck: &HealthCheck{Type: "tcp"}}}
+	new.Opener.AllowedSchemes = []string{"vscode"}
+	new.Path = "/elsewhere/config.yaml"
+
+	want := []string{
+		"log_level: info -> debug",
+		"monitor.portRanges: [] -> [{start: 3000, end: 3999, healthCheck: {type: tcp}}]",
+		"monitor.ignorePorts: [] -> [22, 5432]",
+		"opener.allowed_schemes: [] -> [vscode]",
+	}
+	var got []string
+	for _, change := range Diff(old, new) {
+		got = append(got, change.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath returns the config file Load reads when given no path
+func DefaultPath() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "bankshot", "config.yaml"), nil
+}
+
+// Get returns the setting at key, a dotted path of YAML keys such as
+// "monitor.pollInterval"
+func (c *Config) Get(key string) (interface{}, error) {
+	v, err := settingValue(reflect.ValueOf(c).Elem(), key)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// settingValue finds the field of v named by key
+func settingValue(v reflect.Value, key string) (reflect.Value, error) {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("%s has no settings below it", strings.Join(parts[:i], "."))
+		}
+		field, ok := fieldByYAMLName(v.Type(), part)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown setting: %s", strings.Join(parts[:i+1], "."))
+		}
+		v = v.FieldByIndex(field.Index)
+	}
+	return v, nil
+}
+
+// fieldByYAMLName finds the field of struct type t that YAML key name maps to
+func fieldByYAMLName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if tag == "" {
+			tag = strings.ToLower(field.Name)
+		}
+		if tag == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// SetInFile sets key to value in the config file at path, creating the file
+// if need be. The rest of the file, comments included, is kept. Only strings,
+// numbers, and booleans can be set this way, and the file must still load
+// and validate afterwards.
+func SetInFile(path, key, value string) error {
+	field, err := settingValue(reflect.ValueOf(DefaultConfig()).Elem(), key)
+	if err != nil {
+		return err
+	}
+	var tag string
+	switch field.Kind() {
+	case reflect.String:
+		tag = "!!str"
+	case reflect.Int:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("%s must be a number", key)
+		}
+		tag = "!!int"
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", key)
+		}
+		tag, value = "!!bool", strconv.FormatBool(b)
+	default:
+		return fmt.Errorf("%s isn't a single value; edit %s to change it", key, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("failed to parse config file: not a mapping of settings")
+	}
+
+	node := doc.Content[0]
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		last := i == len(parts)-1
+		child := mappingValue(node, part)
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: part}, child)
+		}
+		if last {
+			// Keeps the comments around the old value
+			child.Kind, child.Tag, child.Value, child.Style, child.Content = yaml.ScalarNode, tag, value, 0, nil
+		} else if child.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s in %s isn't a mapping of settings", strings.Join(parts[:i+1], "."), path)
+		}
+		node = child
+	}
+
+	out, err := encodeConfig(&doc)
+	if err != nil {
+		return err
+	}
+
+	cfg := DefaultConfig()
+	if err := yaml.Unmarshal(out, cfg); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	return writeConfigFile(path, out)
+}
+
+// encodeConfig renders a config file's document as YAML
+func encodeConfig(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeConfigFile replaces the config file at path with data, keeping its
+// mode and creating its directory as need be. The new contents go to a temp
+// file renamed over the old one, so the daemon watching the file never reads
+// half of it. A symlinked config, as from a dotfiles repo, is replaced where
+// the link points.
+func writeConfigFile(path string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".new-*")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// ValidateFile checks that the config file at path and the files it
+// includes load, without keys bankshot doesn't know, and validate. Every
+// problem found is reported, as Errors when they're with particular
+// settings.
+func ValidateFile(path string) error {
+	cfg, _, err := load(path)
+	if err != nil {
+		return err
+	}
+	errs := slices.Clone(cfg.Warnings)
+	var invalid Errors
+	if err := cfg.Validate(); errors.As(err, &invalid) {
+		errs = append(errs, invalid...)
+	} else if err != nil {
+		return err
+	}
+	return errs.err()
+}
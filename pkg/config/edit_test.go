@@ -0,0 +1,171 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Monitor.PollInterval = "2s"
+
+	tests := []struct {
+		key  string
+		want interface{}
+	}{
+		{"network", "unix"},
+		{"monitor.pollInterval", "2s"},
+		{"forwarder.retry_max_attempts", 5},
+		{"op_proxy.read_only", true},
+	}
+	for _, tt := range tests {
+		got, err := cfg.Get(tt.key)
+		if err != nil {
+			t.Errorf("Get(%q) error = %v", tt.key, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Get(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+
+	for _, key := range []string{"nope", "monitor.nope", "network.deeper"} {
+		if _, err := cfg.Get(key); err == nil {
+			t.Errorf("Get(%q) succeeded, want an error", key)
+		}
+	}
+}
+
+func TestSetInFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	original := `# My bankshot config
+log_level: info # chatty enough
+monitor:
+  ignorePorts: [22]
+`
+	if err := os.WriteFile(path, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetInFile(path, "log_level", "debug"); err != nil {
+		t.Fatalf("SetInFile(log_level) error = %v", err)
+	}
+	if err := SetInFile(path, "monitor.pollInterval", "5s"); err != nil {
+		t.Fatalf("SetInFile(monitor.pollInterval) error = %v", err)
+	}
+	if err := SetInFile(path, "forwarder.accounting", "yes"); err == nil {
+		t.Error("SetInFile(forwarder.accounting, yes) succeeded, want an error")
+	}
+	if err := SetInFile(path, "forwarder.accounting", "true"); err != nil {
+		t.Fatalf("SetInFile(forwarder.accounting) error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# My bankshot config", "log_level: debug # chatty enough", "pollInterval: 5s"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("config file is missing %q:\n%s", want, data)
+		}
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.LogLevel != "debug" || cfg.Monitor.PollInterval != "5s" || !cfg.Forwarder.Accounting {
+		t.Errorf("Load() = %+v", cfg)
+	}
+	if len(cfg.Monitor.IgnorePorts) != 1 {
+		t.Errorf("IgnorePorts = %v, want the original [22]", cfg.Monitor.IgnorePorts)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("config file mode changed: %v, %v", info.Mode(), err)
+	}
+
+	// Values that don't validate, and settings that aren't scalars, are refused
+	if err := SetInFile(path, "network", "udp"); err == nil {
+		t.Error("SetInFile(network, udp) succeeded, want an error")
+	}
+	if err := SetInFile(path, "monitor.ignorePorts", "80"); err == nil {
+		t.Error("SetInFile(monitor.ignorePorts) succeeded, want an error")
+	}
+}
+
+func TestSetInFileCreates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bankshot", "config.yaml")
+	if err := SetInFile(path, "forwarder.port_conflict", "next"); err != nil {
+		t.Fatalf("SetInFile() error = %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Forwarder.PortConflict != "next" {
+		t.Errorf("PortConflict = %q, want next", cfg.Forwarder.PortConflict)
+	}
+}
+
+func TestSetInFileSymlink(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "dotfiles", "bankshot.yaml")
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("log_level: info\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.Symlink(file, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetInFile(path, "log_level", "warn"); err != nil {
+		t.Fatalf("SetInFile() error = %v", err)
+	}
+	if info, err := os.Lstat(path); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("SetInFile() replaced the symlink at %s", path)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "log_level: warn\n" {
+		t.Errorf("linked file = %q, want log_level: warn", data)
+	}
+	entries, err := os.ReadDir(filepath.Dir(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("left %d files next to the config, want only the config", len(entries))
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	if err := ValidateFile(write("good.yaml", "log_level: debug\n")); err != nil {
+		t.Errorf("ValidateFile(good) error = %v", err)
+	}
+	if err := ValidateFile(write("empty.yaml", "")); err != nil {
+		t.Errorf("ValidateFile(empty) error = %v", err)
+	}
+	if err := ValidateFile(write("typo.yaml", "log_levle: debug\n")); err == nil {
+		t.Error("ValidateFile(typo) succeeded, want an unknown key error")
+	}
+	if err := ValidateFile(write("invalid.yaml", "network: udp\n")); err == nil {
+		t.Error("ValidateFile(invalid) succeeded, want a validation error")
+	}
+}
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FieldError is a problem with one setting, by its key, like
+// "monitor.portRanges[0].gracePeriod", and the file and line that set it,
+// when known
+type FieldError struct {
+	Key  string
+	File string
+	Line int
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	switch {
+	case e.File == "":
+		return e.Err.Error()
+	case e.Line == 0:
+		return fmt.Sprintf("%s: %s", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Errors are the problems found in a config, one per line, in the order
+// they were found
+type Errors []*FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+func (e *Errors) add(key, format string, args ...any) {
+	*e = append(*e, &FieldError{Key: key, Err: fmt.Errorf(format, args...)})
+}
+
+// err returns e as an error, nil when there are none
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// sourceDoc is a config file as parsed, for finding where it sets things
+type sourceDoc struct {
+	path string
+	root *yaml.Node
+}
+
+// locate fills in where each error's setting was set: the line in the last
+// file to set it, in the order the files were merged, or else the nearest
+// setting above it that a file sets
+func (s *configSources) locate(errs Errors) Errors {
+	if s == nil {
+		return errs
+	}
+	for _, e := range errs {
+		for key := e.Key; key != "" && e.File == ""; key = parentKey(key) {
+			for i := len(s.docs) - 1; i >= 0; i-- {
+				if node := lookupKey(s.docs[i].root, key); node != nil {
+					e.File, e.Line = s.docs[i].path, node.Line
+					break
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// parentKey returns the key above key: "monitor" for "monitor.hooks" and
+// "monitor.hooks" for "monitor.hooks[0]"
+func parentKey(key string) string {
+	i := strings.LastIndexAny(key, ".[")
+	if i < 0 {
+		return ""
+	}
+	return key[:i]
+}
+
+// lookupKey returns the node in a parsed config file where key is set, the
+// key itself for a mapping entry and the element for a list entry, or nil
+// if the file doesn't set it
+func lookupKey(root *yaml.Node, key string) *yaml.Node {
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil
+	}
+	node := root.Content[0]
+	var at *yaml.Node
+	for _, part := range strings.Split(key, ".") {
+		name, indexes, _ := strings.Cut(part, "[")
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		at = nil
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == name {
+				at, node = node.Content[i], node.Content[i+1]
+				break
+			}
+		}
+		if at == nil {
+			return nil
+		}
+		for indexes != "" {
+			num, rest, _ := strings.Cut(indexes, "]")
+			index, err := strconv.Atoi(num)
+			if err != nil || node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+				return nil
+			}
+			node, at = node.Content[index], node.Content[index]
+			indexes = strings.TrimPrefix(rest, "[")
+		}
+	}
+	return at
+}
+
+// unknownKeys returns an error for each key in node, as decoded into a t,
+// that bankshot doesn't know, with the setting it likely meant. prefix is
+// the key of node itself.
+func unknownKeys(path string, node *yaml.Node, t reflect.Type, prefix string) Errors {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var errs Errors
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name := node.Content[i].Value
+			if name == "<<" {
+				continue
+			}
+			field, ok := fieldByYAMLName(t, name)
+			if !ok {
+				msg := "unknown key " + prefix + name
+				if known := closestYAMLName(t, name); known != "" {
+					msg += " (did you mean " + prefix + known + "?)"
+				}
+				errs = append(errs, &FieldError{Key: prefix + name, File: path, Line: node.Content[i].Line, Err: errors.New(msg)})
+				continue
+			}
+			errs = append(errs, unknownKeys(path, node.Content[i+1], field.Type, prefix+name+".")...)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			errs = append(errs, unknownKeys(path, node.Content[i+1], t.Elem(), prefix+node.Content[i].Value+".")...)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, elem := range node.Content {
+			errs = append(errs, unknownKeys(path, elem, t.Elem(), strings.TrimSuffix(prefix, ".")+"["+strconv.Itoa(i)+"].")...)
+		}
+	}
+	return errs
+}
+
+// closestYAMLName returns the YAML key of struct type t that name is most
+// likely a misspelling of, or "" if none is close
+func closestYAMLName(t reflect.Type, name string) string {
+	best, bestDistance := "", 3
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+		if strings.EqualFold(tag, name) {
+			return tag
+		}
+		if d := editDistance(strings.ToLower(tag), strings.ToLower(name)); d < bestDistance {
+			best, bestDistance = tag, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// typeErrors returns the errors in err, from decoding the config file at
+// path, each at its line
+func typeErrors(path string, err *yaml.TypeError) Errors {
+	errs := make(Errors, 0, len(err.Errors))
+	for _, msg := range err.Errors {
+		e := &FieldError{File: path, Err: errors.New(msg)}
+		if rest, ok := strings.CutPrefix(msg, "line "); ok {
+			if num, text, ok := strings.Cut(rest, ": "); ok {
+				if line, convErr := strconv.Atoi(num); convErr == nil {
+					e.Line, e.Err = line, errors.New(text)
+				}
+			}
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadUnknownKeys(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `log_level: debug
+monitor:
+  pollIntervall: 2s
+  portRanges:
+    - start: 3000
+      end: 3999
+      gracePeriood: 5s
+sshcommand: ssh
+`,
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.LogLevel != "debug" {
+		t.Errorf("LogLevel = %q, want debug", cfg.LogLevel)
+	}
+
+	want := []string{
+		"config.yaml:3: unknown key monitor.pollIntervall (did you mean monitor.pollInterval?)",
+		"config.yaml:7: unknown key monitor.portRanges[0].gracePeriood (did you mean monitor.portRanges[0].gracePeriod?)",
+		"config.yaml:8: unknown key sshcommand (did you mean ssh_command?)",
+	}
+	if len(cfg.Warnings) != len(want) {
+		t.Fatalf("Warnings = %v, want %d", cfg.Warnings, len(want))
+	}
+	for i, w := range cfg.Warnings {
+		if got := strings.TrimPrefix(w.Error(), dir+string(filepath.Separator)); got != want[i] {
+			t.Errorf("Warnings[%d] = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestLoadStrict(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": "include: [base.yaml]\nlog_levle: debug\n",
+		"base.yaml":   "strict: true\n",
+		"good.yaml":   "strict: true\nlog_level: debug\n",
+	})
+
+	_, err := Load(filepath.Join(dir, "config.yaml"))
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Key != "log_levle" || errs[0].Line != 2 {
+		t.Errorf("Load() error = %v, want the unknown key log_levle on line 2", err)
+	}
+
+	if _, err := Load(filepath.Join(dir, "good.yaml")); err != nil {
+		t.Errorf("Load(good) error = %v", err)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `include: [base.yaml]
+log_level: loud
+opener:
+  browsers:
+    - match: "*.example.com"
+      browser: netscape
+`,
+		"base.yaml": `forwarder:
+  port_conflict: wait
+monitor:
+  debounce: soon
+`,
+	})
+	path := filepath.Join(dir, "config.yaml")
+	base := filepath.Join(dir, "base.yaml")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	err = cfg.Validate()
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Validate() error = %v, want Errors", err)
+	}
+
+	// Every problem is reported, where the file that won set it
+	want := []struct {
+		key  string
+		file string
+		line int
+	}{
+		{"log_level", path, 2},
+		{"forwarder.port_conflict", base, 2},
+		{"monitor.debounce", base, 4},
+		{"opener.browsers[0].browser", path, 6},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Validate() = %v, want %d errors", err, len(want))
+	}
+	for i, w := range want {
+		if errs[i].Key != w.key || errs[i].File != w.file || errs[i].Line != w.line {
+			t.Errorf("error %d = %s at %s:%d, want %s at %s:%d", i, errs[i].Key, errs[i].File, errs[i].Line, w.key, w.file, w.line)
+		}
+	}
+	if !strings.HasPrefix(errs[0].Error(), path+":2: invalid log level: loud") {
+		t.Errorf("error 0 = %q", errs[0].Error())
+	}
+}
+
+func TestValidateErrorsWithoutFile(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LogLevel = "loud"
+	cfg.Network = "udp"
+
+	var errs Errors
+	if err := cfg.Validate(); !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Validate() error = %v, want 2 errors", err)
+	}
+	if errs[0].File != "" || errs[0].Error() != "invalid network type: udp (must be 'unix' or 'tcp')" {
+		t.Errorf("error 0 = %q, want it without a position", errs[0].Error())
+	}
+}
+
+func TestLoadTypeErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": "monitor:\n  ignorePorts: [http]\n  eventBuffer: lots\n",
+	})
+	path := filepath.Join(dir, "config.yaml")
+
+	_, err := Load(path)
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Load() error = %v, want 2 errors", err)
+	}
+	if errs[0].File != path || errs[0].Line != 2 || errs[1].Line != 3 {
+		t.Errorf("Load() errors at %s:%d and line %d, want %s:2 and line 3", errs[0].File, errs[0].Line, errs[1].Line, path)
+	}
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"gopkg.in/yaml.v3"
+)
+
+// configSources are the files a config was read from, and the include
+// patterns that named them, so Watch knows which changes concern it, and
+// the files as parsed in the order they were merged, for where settings
+// were set
+type configSources struct {
+	files    []string
+	patterns []string
+	docs     []sourceDoc
+}
+
+// load reads the config file at path and the files it includes over the
+// defaults. The sources are returned even when loading fails, as far as it
+// got.
+func load(path string) (*Config, *configSources, error) {
+	cfg := DefaultConfig()
+	sources := &configSources{}
+	if err := loadFile(cfg, path, nil, sources); err != nil {
+		return nil, sources, err
+	}
+	cfg.Path = path
+	cfg.sources = sources
+	return cfg, sources, nil
+}
+
+// loadFile merges the config file at path into cfg: first the files it
+// includes, in the order it lists them, then its own settings, so a file's
+// settings win over those it includes. Sections merge setting by setting
+// and maps key by key; a list replaces the one before it, and a key with no
+// value changes nothing. A file in an older layout is migrated first, its
+// moved settings added to cfg.Migrated, and keys bankshot doesn't know are
+// added to cfg.Warnings. included is the chain of files that led to this
+// one.
+func loadFile(cfg *Config, path string, included []string, sources *configSources) error {
+	if slices.Contains(included, path) {
+		return fmt.Errorf("config file includes itself: %s -> %s", strings.Join(included, " -> "), path)
+	}
+	sources.files = append(sources.files, path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(root.Content) == 0 {
+		// Empty, or only comments
+		return nil
+	}
+	version, err := fileVersion(path, &root)
+	if err != nil {
+		return err
+	}
+	cfg.Migrated = append(cfg.Migrated, migrate(path, &root, version)...)
+
+	var header struct {
+		Include []string `yaml:"include"`
+	}
+	if err := root.Decode(&header); err != nil {
+		return decodeError(path, err)
+	}
+	for _, pattern := range header.Include {
+		files, pattern, err := resolveInclude(filepath.Dir(path), pattern)
+		if err != nil {
+			return err
+		}
+		sources.patterns = append(sources.patterns, pattern)
+		for _, file := range files {
+			if err := loadFile(cfg, file, append(included, path), sources); err != nil {
+				var errs Errors
+				if errors.As(err, &errs) {
+					return err
+				}
+				return fmt.Errorf("include %s: %w", file, err)
+			}
+		}
+	}
+
+	cfg.Warnings = append(cfg.Warnings, unknownKeys(path, root.Content[0], reflect.TypeOf(*cfg), "")...)
+	// Leave Include as this file lists it, not as the last included one did
+	cfg.Include = nil
+	dropNulls(root.Content[0])
+	if err := root.Decode(cfg); err != nil {
+		return decodeError(path, err)
+	}
+	sources.docs = append(sources.docs, sourceDoc{path: path, root: &root})
+	return nil
+}
+
+// dropNulls removes the keys with no value from a mapping and those in it,
+// which decoding would otherwise take as clearing what's set before them
+func dropNulls(mapping *yaml.Node) {
+	if mapping.Kind != yaml.MappingNode {
+		return
+	}
+	content := mapping.Content[:0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if value.Kind == yaml.ScalarNode && value.ShortTag() == "!!null" {
+			continue
+		}
+		dropNulls(value)
+		content = append(content, key, value)
+	}
+	mapping.Content = content
+}
+
+// decodeError returns err, from decoding the config file at path, as Errors
+// when it's about particular settings
+func decodeError(path string, err error) error {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		return typeErrors(path, typeErr)
+	}
+	return fmt.Errorf("failed to parse config file: %w", err)
+}
+
+// resolveInclude returns the files an include names, relative to dir, along
+// with the resolved pattern. A glob names the files matching it in lexical
+// order, none if nothing does; anything else names one file, which has to
+// exist.
+func resolveInclude(dir, pattern string) ([]string, string, error) {
+	expanded, err := homedir.Expand(pattern)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid include %q: %w", pattern, err)
+	}
+	if !filepath.IsAbs(expanded) {
+		expanded = filepath.Join(dir, expanded)
+	}
+	expanded = filepath.Clean(expanded)
+
+	if !strings.ContainsAny(expanded, "*?[") {
+		return []string{expanded}, expanded, nil
+	}
+	matches, err := filepath.Glob(expanded)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid include %q: %w", pattern, err)
+	}
+	files := matches[:0]
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && !info.IsDir() {
+			files = append(files, match)
+		}
+	}
+	return files, expanded, nil
+}
+
+// concerns reports whether a change to the file at path could change the
+// config loaded from these sources
+func (s *configSources) concerns(path string) bool {
+	if slices.Contains(s.files, path) {
+		return true
+	}
+	for _, pattern := range s.patterns {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dirs returns the directories holding these sources, which Watch watches
+func (s *configSources) dirs() []string {
+	var dirs []string
+	for _, path := range slices.Concat(s.files, s.patterns) {
+		if dir := filepath.Dir(path); !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
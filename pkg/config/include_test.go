@@ -0,0 +1,184 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadInclude(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `include:
+  - base.yaml
+  - conf.d/*.yaml
+log_level: warn
+`,
+		"base.yaml": `log_level: debug
+ssh_command: /usr/bin/ssh
+monitor:
+  ignorePorts: [3000, 3001]
+  pollInterval: 2s
+vhost:
+  routes:
+    api.localhost: 8080
+`,
+		"conf.d/10-ports.yaml": `monitor:
+  ignorePorts: [5432]
+vhost:
+  routes:
+    web.localhost: 3000
+`,
+		"conf.d/20-ssh.yaml": `include: [../nested.yaml]
+ssh_command: /opt/ssh
+`,
+		"nested.yaml": `ssh_command: /nested/ssh
+notify_command: notify
+`,
+		"conf.d/notes.txt": "not: yaml: at all",
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// The including file's own settings win over those it includes
+	if cfg.LogLevel != "warn" {
+		t.Errorf("LogLevel = %q, want warn", cfg.LogLevel)
+	}
+	// Later includes win over earlier ones, and a file over its includes
+	if cfg.SSHCommand != "/opt/ssh" {
+		t.Errorf("SSHCommand = %q, want /opt/ssh", cfg.SSHCommand)
+	}
+	if cfg.NotifyCommand != "notify" {
+		t.Errorf("NotifyCommand = %q, want notify", cfg.NotifyCommand)
+	}
+	// Sections merge setting by setting, and lists replace
+	if cfg.Monitor.PollInterval != "2s" {
+		t.Errorf("Monitor.PollInterval = %q, want 2s", cfg.Monitor.PollInterval)
+	}
+	if want := []int{5432}; !reflect.DeepEqual(cfg.Monitor.IgnorePorts, want) {
+		t.Errorf("Monitor.IgnorePorts = %v, want %v", cfg.Monitor.IgnorePorts, want)
+	}
+	// Maps merge key by key
+	if want := map[string]int{"api.localhost": 8080, "web.localhost": 3000}; !reflect.DeepEqual(cfg.VHost.Routes, want) {
+		t.Errorf("VHost.Routes = %v, want %v", cfg.VHost.Routes, want)
+	}
+	if want := []string{"base.yaml", "conf.d/*.yaml"}; !reflect.DeepEqual(cfg.Include, want) {
+		t.Errorf("Include = %v, want %v", cfg.Include, want)
+	}
+}
+
+func TestLoadIncludeNull(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `include: [base.yaml]
+ssh_command:
+vhost:
+  routes:
+monitor:
+  pollInterval: ~
+`,
+		"base.yaml": `ssh_command: /opt/ssh
+monitor:
+  pollInterval: 2s
+vhost:
+  routes:
+    api.localhost: 8080
+`,
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	// A key with no value leaves what the included file set
+	if cfg.SSHCommand != "/opt/ssh" || cfg.Monitor.PollInterval != "2s" {
+		t.Errorf("SSHCommand = %q, PollInterval = %q, want base.yaml's", cfg.SSHCommand, cfg.Monitor.PollInterval)
+	}
+	if want := map[string]int{"api.localhost": 8080}; !reflect.DeepEqual(cfg.VHost.Routes, want) {
+		t.Errorf("VHost.Routes = %v, want %v", cfg.VHost.Routes, want)
+	}
+}
+
+func TestLoadIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:  "glob matching nothing",
+			files: map[string]string{"config.yaml": "include: [conf.d/*.yaml]\n"},
+		},
+		{
+			name:    "missing file",
+			files:   map[string]string{"config.yaml": "include: [base.yaml]\n"},
+			wantErr: "include",
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml]\n",
+				"a.yaml":      "include: [config.yaml]\n",
+			},
+			wantErr: "includes itself",
+		},
+		{
+			name: "invalid included yaml",
+			files: map[string]string{
+				"config.yaml": "include: [a.yaml]\n",
+				"a.yaml":      "network: [invalid yaml",
+			},
+			wantErr: "a.yaml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeConfigFiles(t, tt.files)
+			_, err := Load(filepath.Join(dir, "config.yaml"))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Load() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFileInclude(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": "include: [typo.yaml]\n",
+		"typo.yaml":   "log_levle: debug\n",
+		"good.yaml":   "include: [base.yaml]\n",
+		"base.yaml":   "log_level: debug\n",
+	})
+
+	if err := ValidateFile(filepath.Join(dir, "good.yaml")); err != nil {
+		t.Errorf("ValidateFile(good) error = %v", err)
+	}
+	if err := ValidateFile(filepath.Join(dir, "config.yaml")); err == nil {
+		t.Error("ValidateFile(typo) succeeded, want an unknown key error from the included file")
+	}
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion returns the config file layout this bankshot reads and
+// writes, the one the last migration moves to. A file without a version is
+// in layout 1, the one from before versions.
+func CurrentVersion() int {
+	if len(migrations) == 0 {
+		return 1
+	}
+	return migrations[len(migrations)-1].version
+}
+
+// migration moves a config file from the layout before version to version
+type migration struct {
+	version int
+	renames []keyRename
+}
+
+// keyRename is a setting moved from one dotted key to another, like
+// "monitor.pollInterval" to "monitor.poll_interval"
+type keyRename struct {
+	from, to string
+}
+
+// migrations are the changes from each layout to the next, oldest first.
+// Renaming or moving a setting means a migration to a new version here,
+// so files in the layout before keep working.
+var migrations []migration
+
+// fileVersion returns the layout version of a parsed config file
+func fileVersion(path string, doc *yaml.Node) (int, error) {
+	version := 1
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return version, nil
+	}
+	node := mappingValue(doc.Content[0], "version")
+	if node == nil {
+		return version, nil
+	}
+	v, err := strconv.Atoi(node.Value)
+	if err != nil || v < 1 {
+		return 0, Errors{{Key: "version", File: path, Line: node.Line, Err: fmt.Errorf("invalid version: %s", node.Value)}}
+	}
+	if v > CurrentVersion() {
+		return 0, Errors{{Key: "version", File: path, Line: node.Line,
+			Err: fmt.Errorf("config file version %d is newer than this bankshot reads (%d); upgrade bankshot", v, CurrentVersion())}}
+	}
+	return v, nil
+}
+
+// migrate moves a parsed config file from layout version to the current one
+// in place, keeping comments, and returns each setting it moved, at the
+// line the file had it on. A setting whose new key the file also sets is
+// left where it was, for Load to report as unknown.
+func migrate(path string, doc *yaml.Node, version int) Errors {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	root := doc.Content[0]
+
+	var moved Errors
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		for _, r := range m.renames {
+			if lookupKey(doc, r.to) != nil {
+				continue
+			}
+			key, value := detachKey(root, r.from)
+			if key == nil {
+				continue
+			}
+			if !attachKey(root, r.to, key, value) {
+				attachKey(root, r.from, key, value)
+				continue
+			}
+			moved = append(moved, &FieldError{Key: r.from, File: path, Line: key.Line,
+				Err: fmt.Errorf("%s is now %s (version %d)", r.from, r.to, m.version)})
+		}
+	}
+	setVersion(root, CurrentVersion())
+	return moved
+}
+
+// detachKey removes the setting at dotted key from a mapping, returning its
+// key and value nodes, or nils if it isn't set
+func detachKey(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	parent, name := mapping, key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		name = key[i+1:]
+		for _, part := range strings.Split(key[:i], ".") {
+			if parent = mappingValue(parent, part); parent == nil || parent.Kind != yaml.MappingNode {
+				return nil, nil
+			}
+		}
+	}
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == name {
+			k, v := parent.Content[i], parent.Content[i+1]
+			parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+			return k, v
+		}
+	}
+	return nil, nil
+}
+
+// attachKey sets dotted key in a mapping to value, reusing key's node so its
+// comments come along, and creating the mappings above it as need be. It
+// reports false, changing nothing, if the key is already set or what's
+// above it isn't a mapping.
+func attachKey(mapping *yaml.Node, key string, keyNode, value *yaml.Node) bool {
+	parts := strings.Split(key, ".")
+	parent := mapping
+	for _, part := range parts[:len(parts)-1] {
+		child := mappingValue(parent, part)
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: part}, child)
+		}
+		if child.Kind != yaml.MappingNode {
+			return false
+		}
+		parent = child
+	}
+	name := parts[len(parts)-1]
+	if mappingValue(parent, name) != nil {
+		return false
+	}
+	keyNode.Value = name
+	parent.Content = append(parent.Content, keyNode, value)
+	return true
+}
+
+// setVersion sets the version in a config file's mapping, first in the file
+// when it isn't there yet
+func setVersion(mapping *yaml.Node, version int) {
+	value := strconv.Itoa(version)
+	if node := mappingValue(mapping, "version"); node != nil {
+		node.Kind, node.Tag, node.Value, node.Style = yaml.ScalarNode, "!!int", value, 0
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+	if len(mapping.Content) > 0 {
+		// A comment at the top of the file stays there
+		key.HeadComment, mapping.Content[0].HeadComment = mapping.Content[0].HeadComment, ""
+	}
+	mapping.Content = append([]*yaml.Node{key, {Kind: yaml.ScalarNode, Tag: "!!int", Value: value}}, mapping.Content...)
+}
+
+// MigrateFile rewrites the config file at path in the current layout,
+// keeping its comments, and returns it along with the settings it moved.
+// A file already in the current layout is returned as is and left alone,
+// as it is with dryRun. Files it includes are migrated on their own.
+func MigrateFile(path string, dryRun bool) ([]byte, Errors, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, errors.New("failed to parse config file: not a mapping of settings")
+	}
+
+	version, err := fileVersion(path, &doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version == CurrentVersion() {
+		return data, nil, nil
+	}
+	moved := migrate(path, &doc, version)
+	out, err := encodeConfig(&doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := yaml.Unmarshal(out, DefaultConfig()); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse migrated config file: %w", err)
+	}
+	if dryRun {
+		return out, moved, nil
+	}
+	return out, moved, writeConfigFile(path, out)
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withMigrations has Load and MigrateFile use ms for the length of the test
+func withMigrations(t *testing.T, ms []migration) {
+	t.Helper()
+	saved := migrations
+	migrations = ms
+	t.Cleanup(func() { migrations = saved })
+}
+
+func TestLoadMigrates(t *testing.T) {
+	withMigrations(t, []migration{{
+		version: 2,
+		renames: []keyRename{
+			{from: "monitor.interval", to: "monitor.pollInterval"},
+			{from: "monitor.skip", to: "monitor.ignorePorts"},
+			{from: "notify", to: "notify_command"},
+		},
+	}})
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `monitor:
+  interval: 2s
+  skip: [22]
+  ignorePorts: [5432]
+notify: notify-send
+`,
+	})
+
+	cfg, err := Load(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Monitor.PollInterval != "2s" || cfg.NotifyCommand != "notify-send" {
+		t.Errorf("Load() PollInterval = %q, NotifyCommand = %q, want the old keys' values", cfg.Monitor.PollInterval, cfg.NotifyCommand)
+	}
+	if len(cfg.Monitor.IgnorePorts) != 1 || cfg.Monitor.IgnorePorts[0] != 5432 {
+		t.Errorf("Load() IgnorePorts = %v, want the new key's value", cfg.Monitor.IgnorePorts)
+	}
+	if cfg.Version != 2 {
+		t.Errorf("Load() Version = %d, want the last migration's 2", cfg.Version)
+	}
+
+	var moved []string
+	for _, m := range cfg.Migrated {
+		moved = append(moved, m.Key)
+	}
+	if got := strings.Join(moved, ","); got != "monitor.interval,notify" {
+		t.Errorf("Migrated = %s, want monitor.interval,notify", got)
+	}
+	if cfg.Migrated[0].Line != 2 {
+		t.Errorf("Migrated[0] at line %d, want 2", cfg.Migrated[0].Line)
+	}
+	// An old key whose new one is also set is left, as unknown
+	if len(cfg.Warnings) != 1 || cfg.Warnings[0].Key != "monitor.skip" {
+		t.Errorf("Warnings = %v, want monitor.skip", cfg.Warnings)
+	}
+}
+
+func TestLoadNewerVersion(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": "version: 99\nlog_level: debug\n",
+	})
+
+	_, err := Load(filepath.Join(dir, "config.yaml"))
+	var errs Errors
+	if !errors.As(err, &errs) || errs[0].Key != "version" || !strings.Contains(err.Error(), "upgrade bankshot") {
+		t.Errorf("Load() error = %v, want one saying to upgrade", err)
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	withMigrations(t, []migration{{
+		version: 2,
+		renames: []keyRename{{from: "monitor.interval", to: "monitor.pollInterval"}},
+	}})
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `# Laptop settings
+log_level: debug
+monitor:
+  # Check often
+  interval: 2s
+`,
+	})
+	path := filepath.Join(dir, "config.yaml")
+
+	out, moved, err := MigrateFile(path, true)
+	if err != nil {
+		t.Fatalf("MigrateFile(dry run) error = %v", err)
+	}
+	if len(moved) != 1 || moved[0].Key != "monitor.interval" {
+		t.Errorf("MigrateFile() moved = %v, want monitor.interval", moved)
+	}
+	want := `# Laptop settings
+version: 2
+log_level: debug
+monitor:
+  # Check often
+  pollInterval: 2s
+`
+	if string(out) != want {
+		t.Errorf("MigrateFile() =\n%s\nwant\n%s", out, want)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "pollInterval") {
+		t.Error("MigrateFile(dry run) wrote the file")
+	}
+
+	if _, _, err := MigrateFile(path, false); err != nil {
+		t.Fatalf("MigrateFile() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != want {
+		t.Errorf("migrated file =\n%s\nwant\n%s", data, want)
+	}
+
+	// Migrating again changes nothing
+	out, moved, err = MigrateFile(path, true)
+	if err != nil || len(moved) != 0 || string(out) != want {
+		t.Errorf("MigrateFile(again) = %q, %v, %v, want it unchanged", out, moved, err)
+	}
+}
+
+func TestMigrateFileCurrent(t *testing.T) {
+	// Formatted as encodeConfig wouldn't, to show it isn't rewritten
+	const current = "log_level:   debug   # no version, so 1\n"
+	dir := writeConfigFiles(t, map[string]string{"config.yaml": current})
+	path := filepath.Join(dir, "config.yaml")
+
+	out, moved, err := MigrateFile(path, false)
+	if err != nil || len(moved) != 0 || string(out) != current {
+		t.Errorf("MigrateFile() = %q, %v, %v, want the file as is", out, moved, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != current {
+		t.Errorf("MigrateFile() wrote %q, want the file left alone", data)
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFileName is the file bankshot up reads a project's profiles from
+const ProjectFileName = ".bankshot.yaml"
+
+// DefaultProfile is the profile used when none is named and a project has
+// more than one
+const DefaultProfile = "default"
+
+// Project is a project's .bankshot.yaml: named profiles of the forwards it
+// needs
+type Project struct {
+	Profiles map[string]Profile `yaml:"profiles"`
+
+	// Path is the file the project was read from
+	Path string `yaml:"-"`
+}
+
+// Profile is a set of forwards brought up and down together, and the URLs to
+// open once they are up
+type Profile struct {
+	Forwards []protocol.ForwardSpec `yaml:"forwards"`
+	Open     []string               `yaml:"open,omitempty"`
+}
+
+// FindProject reads the .bankshot.yaml in dir or the nearest of its parents
+func FindProject(dir string) (*Project, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		path := filepath.Join(dir, ProjectFileName)
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return parseProject(path, data)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, fmt.Errorf("no %s found in this directory or its parents", ProjectFileName)
+		}
+		dir = parent
+	}
+}
+
+// parseProject parses and checks the project file read from path
+func parseProject(path string, data []byte) (*Project, error) {
+	project := &Project{Path: path}
+	if err := yaml.Unmarshal(data, project); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(project.Profiles) == 0 {
+		return nil, fmt.Errorf("%s declares no profiles", path)
+	}
+	for name, profile := range project.Profiles {
+		for i, fwd := range profile.Forwards {
+			if fwd.RemotePort == 0 && fwd.RemoteSocket == "" {
+				return nil, fmt.Errorf("%s: forward %d of profile %s needs a remote_port or remote_socket", path, i+1, name)
+			}
+		}
+	}
+	return project, nil
+}
+
+// Profile returns the profile called name, or with no name the project's
+// only profile or else its default one, along with the name it goes by
+func (p *Project) Profile(name string) (Profile, string, error) {
+	if name == "" {
+		if len(p.Profiles) == 1 {
+			for only := range p.Profiles {
+				name = only
+			}
+		} else {
+			name = DefaultProfile
+		}
+	}
+	profile, ok := p.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(p.Profiles))
+		for n := range p.Profiles {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return Profile{}, "", fmt.Errorf("no profile %q in %s (have %s)", name, p.Path, strings.Join(names, ", "))
+	}
+	return profile, name, nil
+}
+
+// Owner returns the owner recorded on the forwards of the named profile
+// brought up from the host with the given connection info, so bankshot down
+// there can find them again
+func (p *Project) Owner(connectionInfo, name string) string {
+	return protocol.ProfileOwner(connectionInfo, filepath.Dir(p.Path), name)
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindProject(t *testing.T) {
+	root := t.TempDir()
+	content := `profiles:
+  default:
+    forwards:
+      - remote_port: 3000
+        name: web
+      - remote_port: 5432
+        local_port: 15432
+    open:
+      - http://localhost:3000
+  docs:
+    forwards:
+      - remote_port: 8000
+`
+	if err := os.WriteFile(filepath.Join(root, ProjectFileName), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write project file: %v", err)
+	}
+	nested := filepath.Join(root, "src", "app")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	project, err := FindProject(nested)
+	if err != nil {
+		t.Fatalf("FindProject() error = %v", err)
+	}
+	if project.Path != filepath.Join(root, ProjectFileName) {
+		t.Errorf("FindProject() Path = %v, want the file in %v", project.Path, root)
+	}
+
+	profile, name, err := project.Profile("")
+	if err != nil {
+		t.Fatalf("Profile(\"\") error = %v", err)
+	}
+	if name != DefaultProfile {
+		t.Errorf("Profile(\"\") name = %v, want %v", name, DefaultProfile)
+	}
+	if len(profile.Forwards) != 2 || profile.Forwards[1].LocalPort != 15432 || profile.Forwards[0].Name != "web" {
+		t.Errorf("Profile(\"\") Forwards = %+v", profile.Forwards)
+	}
+	if len(profile.Open) != 1 || profile.Open[0] != "http://localhost:3000" {
+		t.Errorf("Profile(\"\") Open = %v", profile.Open)
+	}
+
+	if _, _, err := project.Profile("docs"); err != nil {
+		t.Errorf("Profile(\"docs\") error = %v", err)
+	}
+	if _, _, err := project.Profile("missing"); err == nil || !strings.Contains(err.Error(), "default, docs") {
+		t.Errorf("Profile(\"missing\") error = %v, want one listing the profiles", err)
+	}
+
+	if project.Owner("devbox", "docs") == project.Owner("devbox", DefaultProfile) {
+		t.Error("Owner() should differ between profiles")
+	}
+	if project.Owner("devbox", "docs") == project.Owner("buildbox", "docs") {
+		t.Error("Owner() should differ between hosts")
+	}
+}
+
+func TestProjectOnlyProfile(t *testing.T) {
+	project, err := parseProject(ProjectFileName, []byte(`profiles:
+  dev:
+    forwards:
+      - remote_port: 3000
+`))
+	if err != nil {
+		t.Fatalf("parseProject() error = %v", err)
+	}
+	if _, name, err := project.Profile(""); err != nil || name != "dev" {
+		t.Errorf("Profile(\"\") = (%v, %v), want the only profile, dev", name, err)
+	}
+}
+
+func TestParseProjectErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{
+			name:    "no profiles",
+			content: "profiles: {}\n",
+			errMsg:  "declares no profiles",
+		},
+		{
+			name: "forward without a remote end",
+			content: `profiles:
+  default:
+    forwards:
+      - local_port: 3000
+`,
+			errMsg: "needs a remote_port or remote_socket",
+		},
+		{
+			name:    "invalid yaml",
+			content: "profiles: [",
+			errMsg:  "failed to parse",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseProject(ProjectFileName, []byte(tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("parseProject() error = %v, want one containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestFindProjectMissing(t *testing.T) {
+	if _, err := FindProject(t.TempDir()); err == nil {
+		t.Error("FindProject() should fail without a project file")
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSettle is how long the config file has to be quiet before it's
+// reloaded, since editors save in several writes, or a rename after a write
+const watchSettle = 200 * time.Millisecond
+
+// Watch reloads the config file at path each time it or a file it includes
+// is written, created, replaced, or removed, calling apply with the config
+// once it loads and validates, until ctx is done. A removed file means the
+// defaults, as it does for Load. One that doesn't load or validate is
+// logged and skipped, leaving the config in effect as it was. Directories
+// are watched rather than files, so saves that rename a new file over one
+// are seen, and so are new files matching an include glob; path's directory
+// has to exist when Watch starts, and an included one by the time it's
+// included.
+func Watch(ctx context.Context, path string, logger *slog.Logger, apply func(*Config)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch config: %w", err)
+	}
+	path = filepath.Clean(path)
+	dir := filepath.Dir(path)
+	if err := watcher.Add(dir); err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("failed to watch config directory %s: %w", dir, err)
+	}
+	watched := map[string]bool{dir: true}
+
+	// watchSources watches the directories of the files the config was last
+	// read from, so changes to newly included ones are seen
+	sources := &configSources{files: []string{path}}
+	watchSources := func(next *configSources) {
+		if next != nil {
+			sources = next
+		}
+		for _, dir := range sources.dirs() {
+			if watched[dir] {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				logger.Debug("Not watching included config directory", "path", dir, "error", err)
+				continue
+			}
+			watched[dir] = true
+		}
+	}
+	_, initial, _ := loadPath(path)
+	watchSources(initial)
+
+	go func() {
+		defer func() {
+			_ = watcher.Close()
+		}()
+
+		settle := time.NewTimer(watchSettle)
+		settle.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod || !sources.concerns(filepath.Clean(event.Name)) {
+					continue
+				}
+				settle.Reset(watchSettle)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("Error watching config file", "path", path, "error", err)
+			case <-settle.C:
+				cfg, next, err := loadPath(path)
+				watchSources(next)
+				if err == nil {
+					err = cfg.Validate()
+				}
+				if err != nil {
+					logger.Warn("Not applying changed config file", "path", path, "error", err)
+					continue
+				}
+				cfg.LogWarnings(logger)
+				apply(cfg)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("log_level: info\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	applied := make(chan *Config, 10)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := Watch(ctx, path, logger, func(cfg *Config) { applied <- cfg }); err != nil {
+		t.Fatalf("Watch() error: %v", err)
+	}
+
+	next := func() *Config {
+		t.Helper()
+		select {
+		case cfg := <-applied:
+			return cfg
+		case <-time.After(5 * time.Second):
+			t.Fatal("config change wasn't applied")
+			return nil
+		}
+	}
+
+	// Written in place
+	if err := os.WriteFile(path, []byte("log_level: debug\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := next(); cfg.LogLevel != "debug" {
+		t.Errorf("applied log level = %q, want debug", cfg.LogLevel)
+	}
+
+	// Saved by renaming a new file over it, as editors do
+	tmp := filepath.Join(dir, "config.yaml.tmp")
+	if err := os.WriteFile(tmp, []byte("log_level: warn\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := next(); cfg.LogLevel != "warn" {
+		t.Errorf("applied log level = %q, want warn", cfg.LogLevel)
+	}
+
+	// An invalid config is skipped
+	if err := os.WriteFile(path, []byte("log_level: loud\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * watchSettle)
+	select {
+	case cfg := <-applied:
+		t.Errorf("invalid config was applied, with log level %q", cfg.LogLevel)
+	default:
+	}
+	if err := os.WriteFile(path, []byte("log_level: error\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := next(); cfg.LogLevel != "error" {
+		t.Errorf("applied log level = %q, want error after the invalid config was skipped", cfg.LogLevel)
+	}
+}
+
+func TestWatchInclude(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("include: [conf.d/*.yaml]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	applied := make(chan *Config, 10)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := Watch(ctx, path, logger, func(cfg *Config) { applied <- cfg }); err != nil {
+		t.Fatalf("Watch() error: %v", err)
+	}
+
+	// A new file matching the include glob
+	included := filepath.Join(dir, "conf.d", "local.yaml")
+	if err := os.WriteFile(included, []byte("log_level: debug\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cfg := <-applied:
+		if cfg.LogLevel != "debug" {
+			t.Errorf("applied log level = %q, want debug", cfg.LogLevel)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("new included file wasn't applied")
+	}
+
+	// A file in the directory the glob doesn't match
+	if err := os.WriteFile(filepath.Join(dir, "conf.d", "notes.txt"), []byte("notes\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * watchSettle)
+	select {
+	case <-applied:
+		t.Error("config was reloaded for a file it doesn't include")
+	default:
+	}
+}
+
+func TestWatchEnv(t *testing.T) {
+	t.Setenv("BANKSHOT_DEBUG", "1")
+	t.Setenv("BANKSHOT_SOCKET", "/tmp/bankshot-test.sock")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("log_level: info\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	applied := make(chan *Config, 10)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := Watch(ctx, path, logger, func(cfg *Config) { applied <- cfg }); err != nil {
+		t.Fatalf("Watch() error: %v", err)
+	}
+
+	check := func(change string) {
+		t.Helper()
+		select {
+		case cfg := <-applied:
+			if cfg.LogLevel != "debug" || cfg.Address != "/tmp/bankshot-test.sock" {
+				t.Errorf("%s: applied log level %q, address %q, want BANKSHOT_DEBUG's and BANKSHOT_SOCKET's",
+					change, cfg.LogLevel, cfg.Address)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: config change wasn't applied", change)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("log_level: warn\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	check("written")
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	check("removed")
+}
@@ -0,0 +1,116 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+// serveControl answers requests on the monitor's control socket until ctx is
+// done, then closes the listener
+func (d *Monitor) serveControl(ctx context.Context, listener net.Listener) {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				d.logger.Error("Control socket stopped accepting connections", "error", err)
+			}
+			return
+		}
+		go d.handleControlConnection(conn)
+	}
+}
+
+// handleControlConnection answers the one request a control connection
+// sends, framed as on the daemon's socket
+func (d *Monitor) handleControlConnection(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return
+	}
+
+	var resp *protocol.Response
+	req, err := protocol.ParseRequest(line)
+	switch {
+	case err != nil:
+		resp = protocol.NewErrorResponse("", fmt.Errorf("invalid request format"))
+	case req.Type == protocol.CommandMonitorStatus:
+		resp = d.handleMonitorStatusCommand(req)
+	default:
+		resp = protocol.NewErrorResponse(req.ID, fmt.Errorf("unknown command type for the monitor: %s", req.Type))
+	}
+
+	data, err := protocol.MarshalResponse(resp)
+	if err != nil {
+		d.logger.Error("Failed to marshal response", "error", err)
+		return
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		d.logger.Debug("Failed to send response", "error", err)
+	}
+}
+
+// handleMonitorStatusCommand reports what the session monitor is doing
+func (d *Monitor) handleMonitorStatusCommand(req *protocol.Request) *protocol.Response {
+	if d.sessionMonitor == nil {
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("monitor is not running"))
+	}
+
+	status := protocol.MonitorStatusResponse{
+		SessionID: d.sessionID,
+		Source:    d.sourceKind,
+		Uptime:    time.Since(d.startTime).Round(time.Second).String(),
+		Forwards:  []protocol.MonitorForwardStatus{},
+	}
+	metrics := d.sessionMonitor.Metrics()
+	status.SettlingPorts = metrics.SettlingPorts
+	status.ProbingPorts = metrics.ProbingPorts
+	status.UDPListeners = metrics.UDPListeners
+
+	for _, fwd := range d.sessionMonitor.Forwards() {
+		fs := protocol.MonitorForwardStatus{
+			RemotePort:   fwd.Port,
+			LocalPort:    fwd.LocalPort,
+			RemoteSocket: fwd.RemoteSocket,
+			LocalSocket:  fwd.LocalSocket,
+			PID:          fwd.PID,
+			ProcessName:  fwd.ProcessName,
+			AppProtocol:  fwd.AppProtocol,
+			CreatedAt:    fwd.CreatedAt.Format(time.RFC3339),
+		}
+		if !fwd.PendingSince.IsZero() {
+			fs.RemovalPending = fwd.PendingSince.Format(time.RFC3339)
+			status.PendingRemovals++
+		}
+		status.Forwards = append(status.Forwards, fs)
+	}
+
+	d.reconcileMu.Lock()
+	if !d.lastReconcile.IsZero() {
+		status.LastReconcile = d.lastReconcile.Format(time.RFC3339)
+		if d.lastReconcileError != nil {
+			status.LastReconcileError = d.lastReconcileError.Error()
+		}
+	}
+	d.reconcileMu.Unlock()
+
+	resp, err := protocol.NewSuccessResponse(req.ID, status)
+	if err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	return resp
+}
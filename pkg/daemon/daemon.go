@@ -4,26 +4,43 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/phinze/bankshot/pkg/clipboard"
 	"github.com/phinze/bankshot/pkg/config"
 	"github.com/phinze/bankshot/pkg/forwarder"
+	"github.com/phinze/bankshot/pkg/history"
 	"github.com/phinze/bankshot/pkg/notify"
 	"github.com/phinze/bankshot/pkg/opener"
 	"github.com/phinze/bankshot/pkg/opproxy"
 	"github.com/phinze/bankshot/pkg/protocol"
+	"github.com/phinze/bankshot/pkg/vhost"
 	"github.com/phinze/bankshot/version"
 )
 
+// maxHistoryEntries is the number of open requests retained for `bankshot history`
+const maxHistoryEntries = 200
+
+// copyFileTimeout bounds how long copying a file to open may take, so a
+// stalled connection doesn't hold the request forever
+const copyFileTimeout = 10 * time.Minute
+
 // Daemon represents the bankshot daemon
 type Daemon struct {
 	config      *config.Config
@@ -33,28 +50,83 @@ type Daemon struct {
 	ctx         context.Context
 	cancel      context.CancelFunc
 	opener      *opener.Opener
+	clipboard   *clipboard.Clipboard
 	forwarder   *forwarder.Forwarder
 	notifier    *notify.Notifier
 	opProxy     *opproxy.OpProxy
+	history     *history.History
+	logs        *logBuffer
+	files       *opener.Files // Files sent to be opened, until they're removed
+	vhost       *vhost.Proxy
 	startTime   time.Time
-	systemdMode bool   // Running under systemd
-	pidFile     string // PID file path
+	systemdMode bool           // Running under systemd
+	pidFile     string         // PID file path
+	logLevel    *slog.LevelVar // Level the logger writes at, set from log_level; nil when pinned
+
+	// configMu guards what applyConfig replaces as the config file
+	// changes: config.Opener, config.OpProxy, and opProxy
+	configMu sync.RWMutex
+
+	// The control sockets status -v last found, and when
+	controlSocketsMu    sync.Mutex
+	controlSocketsFound []protocol.SSHConnection
+	controlSocketsAt    time.Time
 }
 
 // New creates a new daemon instance
 func New(cfg *config.Config, logger *slog.Logger) *Daemon {
+	// Keep the records logger writes for bankshot logs, and produce those
+	// below its level while bankshot logs --follow asks for them
+	logs := newLogBuffer(logger.Handler())
+	logger = slog.New(logs)
+
+	// A copy, since applyConfig replaces cfg.OpProxy while the proxy may
+	// be reading it
+	opProxyConfig := cfg.OpProxy
+
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Daemon{
+	d := &Daemon{
 		config:    cfg,
 		logger:    logger,
 		ctx:       ctx,
 		cancel:    cancel,
-		opener:    opener.New(logger),
-		forwarder: forwarder.New(logger, cfg.SSHCommand),
+		opener:    opener.New(&cfg.Opener, logger),
+		clipboard: clipboard.New(logger),
 		notifier:  notify.New(logger, cfg.NotifyCommand),
-		opProxy:   opproxy.New(&cfg.OpProxy, logger),
+		opProxy:   opproxy.New(&opProxyConfig, logger),
+		history:   history.New(maxHistoryEntries),
+		logs:      logs,
+		files:     opener.NewFiles(""),
 		startTime: time.Now(),
 	}
+	if path := cfg.Opener.HistoryFile; path != "" {
+		if err := d.history.Load(path); err != nil {
+			logger.Warn("Failed to load open history", "path", path, "error", err)
+		}
+	}
+	backend, err := forwarder.NewBackend(cfg.Forwarder.Backend, forwarder.BackendConfig{
+		SSHCommand:    cfg.SSHCommand,
+		TshCommand:    cfg.Forwarder.TshCommand,
+		TeleportProxy: cfg.Forwarder.TeleportProxy,
+	})
+	if err != nil {
+		// Config validation only admits known backends
+		logger.Error("Falling back to the OpenSSH backend", "error", err)
+		backend = forwarder.NewOpenSSHBackend(cfg.SSHCommand)
+	}
+	d.forwarder = forwarder.NewWithOptions(logger, cfg.SSHCommand, forwarder.Options{
+		PortConflict:     forwarder.PortConflictStrategy(cfg.Forwarder.PortConflict),
+		Backend:          backend,
+		OnEvent:          d.handleForwarderEvent,
+		Accounting:       cfg.Forwarder.Accounting,
+		RetryMaxAttempts: cfg.Forwarder.RetryMaxAttempts,
+		Workers:          cfg.Forwarder.Workers,
+		BindAddress:      cfg.Forwarder.BindAddress,
+		AllowLANBind:     cfg.Forwarder.AllowLANBind,
+		IdleTimeout:      idleTimeout(cfg.Forwarder.IdleTimeout),
+	})
+	d.vhost = vhost.New(&cfg.VHost, logger, d.lookupNamedForward)
+	return d
 }
 
 // Run starts the daemon
@@ -80,8 +152,8 @@ func (d *Daemon) Run() error {
 		}
 
 		// Set umask for socket permissions (user-only access)
-		oldUmask := syscall.Umask(0077)
-		defer syscall.Umask(oldUmask)
+		oldUmask := umask(0077)
+		defer umask(oldUmask)
 
 		// Remove existing socket
 		if err := os.RemoveAll(d.config.Address); err != nil {
@@ -117,15 +189,55 @@ func (d *Daemon) Run() error {
 		"address", d.config.Address,
 	)
 
+	// Remove files opened before a restart that weren't cleaned up
+	d.files.Clean()
+
 	// Auto-discover existing SSH port forwards
 	if err := d.autoDiscoverForwards(); err != nil {
 		d.logger.Warn("Failed to auto-discover forwards", "error", err)
 	}
+	if adopted, err := d.forwarder.AdoptProcesses(); err != nil {
+		d.logger.Warn("Failed to adopt forwards left running", "error", err)
+	} else if adopted > 0 {
+		d.logger.Info("Adopted forwards left running", "count", adopted)
+	}
 
 	// Start periodic reconciliation to detect stale forwards
 	d.wg.Add(1)
 	go d.reconcileLoop()
 
+	// Start retrying forwards that ssh rejected
+	d.wg.Add(1)
+	go d.retryLoop()
+
+	// Start watching SSH connections for liveness if configured
+	if d.config.Forwarder.LivenessInterval != "" {
+		d.wg.Add(1)
+		go d.livenessLoop()
+	}
+
+	// Start removing forwards nobody uses. Forwards made to open URLs
+	// expire on their own even without an idle timeout for the rest.
+	d.wg.Add(1)
+	go d.idleLoop()
+
+	// Start periodic loopback audit if configured
+	if d.config.Forwarder.AuditInterval != "" {
+		d.wg.Add(1)
+		go d.auditLoop()
+	}
+
+	// Start routing *.localhost hostnames to forwards if configured
+	if len(d.config.VHost.Listen) > 0 {
+		if err := d.vhost.Start(); err != nil {
+			d.logger.Warn("Failed to start vhost proxy", "error", err)
+		}
+	}
+
+	// Apply changes to the opener's and 1Password proxy's rules, and the
+	// log level, as the config file is edited
+	watchConfig(d.ctx, d.config, d.logger, d.applyConfig)
+
 	// Start accepting connections
 	d.wg.Add(1)
 	go d.acceptConnections()
@@ -186,23 +298,9 @@ func (d *Daemon) handleConnection(conn net.Conn) {
 	remoteAddr := conn.RemoteAddr().String()
 	d.logger.Debug("New connection", "remote", remoteAddr)
 
-	// For Unix sockets, verify connection is from same user
-	if d.config.Network == "unix" {
-		if unixConn, ok := conn.(*net.UnixConn); ok {
-			// Get connection credentials if supported by platform
-			rawConn, err := unixConn.SyscallConn()
-			if err == nil {
-				err = rawConn.Control(func(fd uintptr) {
-					// This is platform-specific and may not work on all systems
-					// On Linux, we could use SO_PEERCRED
-					// For now, we rely on socket file permissions
-				})
-				if err != nil {
-					d.logger.Debug("Could not verify peer credentials", "error", err)
-				}
-			}
-		}
-	}
+	// Only this user can reach the socket, by its permissions, but that
+	// includes the remote hosts it's forwarded to
+	peer := d.identifyPeer(conn)
 
 	// Read request from connection
 	reader := bufio.NewReader(conn)
@@ -224,10 +322,26 @@ func (d *Daemon) handleConnection(conn net.Conn) {
 		return
 	}
 
-	d.logger.Info("Received command", "type", req.Type, "id", req.ID, "remote", remoteAddr)
+	d.logger.Info("Received command", "type", req.Type, "id", req.ID, "remote", remoteAddr,
+		"peer", peer.PID, "fromRemote", peer.Remote, "connectionInfo", peer.Connection.ConnectionInfo)
 
-	// Handle command
-	resp := d.handleCommand(req)
+	// Following the log keeps the connection open past the response, and a
+	// file to open follows its request
+	var resp *protocol.Response
+	switch req.Type {
+	case protocol.CommandLogs:
+		if peer.Remote {
+			// They tell of every connection, and what each host opened
+			d.sendResponse(conn, protocol.NewErrorResponse(req.ID, errors.New("the daemon's logs are only shown to bankshot on the machine it runs on")))
+			return
+		}
+		d.handleLogsCommand(conn, req)
+		return
+	case protocol.CommandOpenFile:
+		resp = d.handleOpenFileCommand(reader, req, peer)
+	default:
+		resp = d.handleCommand(req, peer)
+	}
 
 	// Send response
 	d.sendResponse(conn, resp)
@@ -235,13 +349,27 @@ func (d *Daemon) handleConnection(conn net.Conn) {
 	d.logger.Debug("Connection closed", "remote", remoteAddr)
 }
 
-// handleCommand processes a command and returns a response
-func (d *Daemon) handleCommand(req *protocol.Request) *protocol.Response {
+// identifyPeer tells where a request on conn came from. One whose peer
+// can't be found, as over TCP, counts as remote.
+func (d *Daemon) identifyPeer(conn net.Conn) forwarder.Peer {
+	pid, err := peerPID(conn)
+	if err == nil {
+		var peer forwarder.Peer
+		if peer, err = d.forwarder.LookupPeer(pid); err == nil {
+			return peer
+		}
+	}
+	d.logger.Debug("Could not identify peer, treating it as remote", "error", err)
+	return forwarder.Peer{Remote: true}
+}
+
+// handleCommand processes a command from peer and returns a response
+func (d *Daemon) handleCommand(req *protocol.Request, peer forwarder.Peer) *protocol.Response {
 	switch req.Type {
 	case protocol.CommandOpen:
-		return d.handleOpenCommand(req)
+		return d.handleOpenCommand(req, peer)
 	case protocol.CommandStatus:
-		return d.handleStatusCommand(req)
+		return d.handleStatusCommand(req, peer)
 	case protocol.CommandList:
 		return d.handleListCommand(req)
 	case protocol.CommandForward:
@@ -252,33 +380,378 @@ func (d *Daemon) handleCommand(req *protocol.Request) *protocol.Response {
 		return d.handleReconcileCommand(req)
 	case protocol.CommandOpProxy:
 		return d.handleOpProxyCommand(req)
+	case protocol.CommandHistory:
+		return d.handleHistoryCommand(req)
+	case protocol.CommandReopen:
+		return d.handleReopenCommand(req, peer)
+	case protocol.CommandExport:
+		return d.handleExportCommand(req)
+	case protocol.CommandImport:
+		return d.handleImportCommand(req)
+	case protocol.CommandForwardBatch:
+		return d.handleForwardBatchCommand(req)
+	case protocol.CommandCopy:
+		return d.handleCopyCommand(req)
+	case protocol.CommandPaste:
+		return d.handlePasteCommand(req)
+	case protocol.CommandNotify:
+		return d.handleNotifyCommand(req)
+	case protocol.CommandConnections:
+		return d.handleConnectionsCommand(req, peer)
 	default:
 		return protocol.NewErrorResponse(req.ID, fmt.Errorf("unknown command type: %s", req.Type))
 	}
 }
 
 // handleOpenCommand handles the open URL command
-func (d *Daemon) handleOpenCommand(req *protocol.Request) *protocol.Response {
+func (d *Daemon) handleOpenCommand(req *protocol.Request, peer forwarder.Peer) *protocol.Response {
 	// Parse payload
 	var openReq protocol.OpenRequest
 	if err := json.Unmarshal(req.Payload, &openReq); err != nil {
 		return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid payload: %w", err))
 	}
+	if openReq.Browser != "" && !slices.Contains(config.BrowserNames, openReq.Browser) {
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("unknown browser %q (must be one of %s)",
+			openReq.Browser, strings.Join(config.BrowserNames, ", ")))
+	}
+
+	entry := history.Entry{
+		URL:            openReq.URL,
+		ConnectionInfo: openSource(openReq.ConnectionInfo, peer),
+		ProcessName:    openReq.ProcessName,
+		ProcessCwd:     openReq.ProcessCwd,
+		OpenedAt:       time.Now(),
+	}
 
-	// Open URL
-	if err := d.opener.OpenURL(openReq.URL); err != nil {
+	urlOpener, openerConfig := d.currentOpener()
+	if err := urlOpener.CheckURL(openReq.URL); err != nil {
+		return protocol.NewErrorResponse(req.ID, d.denyOpen(entry, err.Error()))
+	}
+	withdraw, err := d.admitOpen(entry)
+	if err != nil {
 		return protocol.NewErrorResponse(req.ID, err)
 	}
+	opened := false
+	defer func() {
+		if !opened {
+			withdraw()
+		}
+	}()
+
+	// Open URL, at the local end of the forward when it's for a remote
+	// port, once the opener has let it through
+	url := openReq.URL
+	resolve := func() string {
+		url = d.localURL(req.ID, &openReq, peer)
+		if openerConfig.EditorLinks == "remote" && peer.Remote {
+			// The file is on the host the request came from, which the
+			// editor reaches by the name the daemon knows its connection
+			// by, whatever host the request claims to be from
+			if remote, ok := opener.RemoteEditorURL(url, peer.Connection.ConnectionInfo); ok {
+				d.logger.Info("Opening editor link over Remote-SSH", "url", openReq.URL, "remoteURL", remote)
+				url = remote
+			}
+		}
+		return url
+	}
+	launch := opener.LaunchOptions{Browser: openReq.Browser, Profile: openReq.Profile, Incognito: openReq.Incognito}
+	err = urlOpener.OpenURLVia(openReq.URL, resolve, launch)
+	switch {
+	case errors.Is(err, opener.ErrDuplicate):
+		resp, _ := protocol.NewSuccessResponse(req.ID, map[string]string{
+			"message": fmt.Sprintf("Already opened URL: %s", url),
+		})
+		return resp
+	case errors.Is(err, opener.ErrRateLimited), errors.Is(err, opener.ErrNotConfirmed):
+		return protocol.NewErrorResponse(req.ID, d.denyOpen(entry, err.Error()))
+	case err != nil:
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	opened = true
+	d.recordOpen(entry)
 
 	// Return success
 	resp, _ := protocol.NewSuccessResponse(req.ID, map[string]string{
-		"message": fmt.Sprintf("Opened URL: %s", openReq.URL),
+		"message": fmt.Sprintf("Opened URL: %s", url),
 	})
 	return resp
 }
 
+// localURL rewrites a URL for a port on the requester's host, by loopback
+// address or the host's name, to the local port the requester's connection
+// forwards it to. That's the connection the request came through, or else
+// the one named after the host it says it's from. A port not forwarded yet
+// is forwarded first, to the next free local port if its own is taken, so
+// an OAuth redirect to a server on the remote host reaches it, and waited
+// on for up to opener.forward_wait until the server there takes
+// connections. Other URLs, and any whose port can't be forwarded, are left
+// as they are.
+func (d *Daemon) localURL(id string, openReq *protocol.OpenRequest, peer forwarder.Peer) string {
+	connectionInfo := peer.Connection.ConnectionInfo
+	if connectionInfo == "" {
+		connectionInfo = openReq.ConnectionInfo
+	}
+	if connectionInfo == "" {
+		return openReq.URL
+	}
+	host := connectionInfo
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	remoteHosts := []string{host, openReq.Hostname}
+
+	remotePort, ok := protocol.RemoteURLPort(openReq.URL, remoteHosts...)
+	if !ok {
+		return openReq.URL
+	}
+
+	var forwards []protocol.ForwardInfo
+	for _, fwd := range d.forwarder.ListConnectionForwards(connectionInfo) {
+		forwards = append(forwards, forwardInfo(fwd))
+	}
+	if local, found := protocol.LocalURL(openReq.URL, connectionInfo, forwards, remoteHosts...); found {
+		return local
+	}
+
+	resp := d.forward(id, &protocol.ForwardRequest{
+		RemotePort:     remotePort,
+		LocalPort:      remotePort,
+		Host:           "localhost",
+		ConnectionInfo: connectionInfo,
+		ProcessName:    openReq.ProcessName,
+		ProcessCwd:     openReq.ProcessCwd,
+		Owner:          protocol.OwnerOpen,
+		Conflict:       string(forwarder.PortConflictNext),
+	})
+	var fwdResp protocol.ForwardResponse
+	if !resp.Success || json.Unmarshal(resp.Data, &fwdResp) != nil || fwdResp.Queued {
+		d.logger.Warn("Failed to forward port of URL to open",
+			"url", openReq.URL,
+			"connectionInfo", connectionInfo,
+			"error", resp.Error)
+		return openReq.URL
+	}
+	d.logger.Info("Forwarded port of URL to open",
+		"url", openReq.URL,
+		"remotePort", remotePort,
+		"localPort", fwdResp.LocalPort)
+
+	// Validated with the rest of the config; empty means no wait
+	_, openerConfig := d.currentOpener()
+	wait, _ := time.ParseDuration(openerConfig.ForwardWait)
+	want := forwarder.Forward{RemotePort: remotePort, Host: "localhost", ConnectionInfo: connectionInfo}
+	if wait > 0 && !d.forwarder.WaitReachable(want, wait) {
+		d.logger.Warn("Opening URL before the server behind its forward took connections",
+			"url", openReq.URL,
+			"remotePort", remotePort,
+			"waited", wait)
+	}
+
+	forwards = []protocol.ForwardInfo{{
+		RemotePort:     remotePort,
+		LocalPort:      fwdResp.LocalPort,
+		Host:           "localhost",
+		ConnectionInfo: connectionInfo,
+	}}
+	local, _ := protocol.LocalURL(openReq.URL, connectionInfo, forwards, remoteHosts...)
+	return local
+}
+
+// openSource returns the connection an open is counted and recorded
+// against: the one a remote request came through, whatever it claims, so
+// a remote host can't dodge its quota by naming another, or the one a
+// request from this machine names
+func openSource(claimed string, peer forwarder.Peer) string {
+	if peer.Remote {
+		return peer.Connection.ConnectionInfo
+	}
+	return claimed
+}
+
+// admitOpen counts entry against the per-connection open quota, recording
+// it as denied if the connection is over it. The returned withdraw uncounts
+// it again, for opens that don't go ahead after all.
+func (d *Daemon) admitOpen(entry history.Entry) (withdraw func(), err error) {
+	_, openerConfig := d.currentOpener()
+	limit := openerConfig.MaxOpensPerHour
+	count, withdraw, ok := d.history.Admit(entry.ConnectionInfo, entry.OpenedAt, limit)
+	if !ok {
+		return nil, d.denyOpen(entry, fmt.Sprintf("hourly open limit reached (%d/%d)", count, limit))
+	}
+	return withdraw, nil
+}
+
+// denyOpen records entry as denied for reason and returns the error to
+// answer with
+func (d *Daemon) denyOpen(entry history.Entry, reason string) error {
+	entry.Denied = true
+	entry.Reason = reason
+	d.recordOpen(entry)
+	d.logger.Warn("Open request denied",
+		"url", entry.URL,
+		"connectionInfo", entry.ConnectionInfo,
+		"process", entry.ProcessName,
+		"reason", entry.Reason)
+	return fmt.Errorf("open request denied: %s", entry.Reason)
+}
+
+// handleOpenFileCommand receives a file sent in chunks after the request,
+// or copies it over the requester's SSH connection, writes it to a
+// directory of its own under the temp directory, keeping its name for the
+// application that opens it, and opens it, if the opener allows files of
+// its kind. The file is removed an hour later, by when the application has
+// read it. A remote host can only have files copied from itself.
+func (d *Daemon) handleOpenFileCommand(reader *bufio.Reader, req *protocol.Request, peer forwarder.Peer) *protocol.Response {
+	var openReq protocol.OpenFileRequest
+	if err := json.Unmarshal(req.Payload, &openReq); err != nil {
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid payload: %w", err))
+	}
+
+	name := filepath.Base(openReq.Name)
+	if name == "." || name == ".." || name == string(filepath.Separator) || name != openReq.Name {
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid file name: %q", openReq.Name))
+	}
+	if openReq.Path != "" && (!path.IsAbs(openReq.Path) || path.Base(openReq.Path) != name) {
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid file path: %q", openReq.Path))
+	}
+	copyFrom := openSource(openReq.ConnectionInfo, peer)
+	if openReq.Path != "" && copyFrom == "" {
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("copying %s needs the connection it's on, which the daemon can't tell", name))
+	}
+	// Denied files are recorded by the name or path they were sent with
+	remoteFile := name
+	if openReq.Path != "" {
+		remoteFile = openReq.Path
+	}
+	entry := history.Entry{
+		URL:            remoteFile,
+		ConnectionInfo: copyFrom,
+		ProcessName:    openReq.ProcessName,
+		ProcessCwd:     openReq.ProcessCwd,
+		OpenedAt:       time.Now(),
+	}
+	urlOpener, openerConfig := d.currentOpener()
+	if err := urlOpener.CheckFile(name); err != nil {
+		return protocol.NewErrorResponse(req.ID, d.denyOpen(entry, err.Error()))
+	}
+	maxMB := openerConfig.MaxFileMB
+	if maxMB == 0 {
+		maxMB = config.DefaultMaxFileMB
+	}
+	if openReq.Size < 0 || openReq.Size > int64(maxMB)<<20 {
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("%s is larger than opener.max_file_mb (%d MiB)", name, maxMB))
+	}
+	withdraw, err := d.admitOpen(entry)
+	if err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	opened := false
+	defer func() {
+		if !opened {
+			withdraw()
+		}
+	}()
+
+	localPath, err := d.files.Create(name)
+	if err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	if openReq.Path != "" {
+		err = d.copyFile(copyFrom, openReq.Path, localPath, int64(maxMB)<<20)
+	} else {
+		err = receiveFile(reader, localPath, openReq.Size)
+	}
+	if err != nil {
+		d.files.Remove(localPath)
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("failed to receive %s: %w", name, err))
+	}
+
+	if err := urlOpener.OpenFile(localPath); err != nil {
+		d.files.Remove(localPath)
+		if errors.Is(err, opener.ErrRateLimited) {
+			return protocol.NewErrorResponse(req.ID, d.denyOpen(entry, err.Error()))
+		}
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	d.files.Opened(localPath)
+	opened = true
+	entry.URL = "file://" + filepath.ToSlash(localPath)
+	d.recordOpen(entry)
+
+	resp, _ := protocol.NewSuccessResponse(req.ID, map[string]string{
+		"message": fmt.Sprintf("Opened file: %s", localPath),
+	})
+	return resp
+}
+
+// copyFile copies remotePath on connectionInfo's host to a new file at
+// localPath over the forwarding backend's connection, so it needs no new
+// login. It gives up on files over maxBytes, and after copyFileTimeout.
+func (d *Daemon) copyFile(connectionInfo, remotePath, localPath string, maxBytes int64) error {
+	file, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(d.ctx, copyFileTimeout)
+	defer cancel()
+	err = d.forwarder.CopyFile(ctx, connectionInfo, remotePath, file, maxBytes)
+	if errors.Is(err, forwarder.ErrFileTooLarge) {
+		return fmt.Errorf("it's larger than opener.max_file_mb")
+	}
+	return err
+}
+
+// receiveFile writes the chunks read from reader to a new file at path,
+// checking they add up to size
+func receiveFile(reader *bufio.Reader, path string, size int64) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var received int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return fmt.Errorf("connection ended after %d of %d bytes", received, size)
+		}
+		var chunk protocol.FileChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("invalid chunk: %w", err)
+		}
+		received += int64(len(chunk.Data))
+		if received > size {
+			return fmt.Errorf("sent more than the %d bytes announced", size)
+		}
+		if _, err := file.Write(chunk.Data); err != nil {
+			return err
+		}
+		if chunk.Last {
+			break
+		}
+	}
+	if received != size {
+		return fmt.Errorf("sent %d of the %d bytes announced", received, size)
+	}
+	return file.Close()
+}
+
 // handleStatusCommand handles the status command
-func (d *Daemon) handleStatusCommand(req *protocol.Request) *protocol.Response {
+func (d *Daemon) handleStatusCommand(req *protocol.Request, peer forwarder.Peer) *protocol.Response {
+	var statusReq protocol.StatusRequest
+	if len(req.Payload) > 0 {
+		if err := json.Unmarshal(req.Payload, &statusReq); err != nil {
+			return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid status request format: %w", err))
+		}
+	}
+
 	// Reconcile before status to ensure we show accurate state
 	if err := d.forwarder.Reconcile(); err != nil {
 		d.logger.Warn("Failed to reconcile forwards before status", "error", err)
@@ -289,8 +762,12 @@ func (d *Daemon) handleStatusCommand(req *protocol.Request) *protocol.Response {
 	// Get all forwards and group by connection
 	forwards := d.forwarder.ListForwards()
 	connectionMap := make(map[string]*protocol.ConnectionStatus)
+	var named []protocol.ForwardInfo
 
 	for _, fwd := range forwards {
+		if fwd.Name != "" {
+			named = append(named, forwardInfo(fwd))
+		}
 		if _, exists := connectionMap[fwd.ConnectionInfo]; !exists {
 			connectionMap[fwd.ConnectionInfo] = &protocol.ConnectionStatus{
 				ConnectionInfo: fwd.ConnectionInfo,
@@ -299,6 +776,16 @@ func (d *Daemon) handleStatusCommand(req *protocol.Request) *protocol.Response {
 			}
 		}
 		connectionMap[fwd.ConnectionInfo].ForwardCount++
+		if stats, ok := fwd.Stats(); ok {
+			conn := connectionMap[fwd.ConnectionInfo]
+			if conn.Stats == nil {
+				conn.Stats = &protocol.ForwardStats{}
+			}
+			conn.Stats.BytesSent += stats.BytesSent
+			conn.Stats.BytesReceived += stats.BytesReceived
+			conn.Stats.Connections += stats.Connections
+			conn.Stats.ActiveConnections += stats.ActiveConnections
+		}
 		// Update last activity if this forward is newer
 		if fwd.CreatedAt.After(time.Time{}) {
 			lastActivity, _ := time.Parse(time.RFC3339, connectionMap[fwd.ConnectionInfo].LastActivity)
@@ -314,11 +801,44 @@ func (d *Daemon) handleStatusCommand(req *protocol.Request) *protocol.Response {
 		connections = append(connections, *conn)
 	}
 
+	var pendingRetries []protocol.PendingRetryInfo
+	for _, r := range d.forwarder.PendingRetries() {
+		pendingRetries = append(pendingRetries, protocol.PendingRetryInfo{
+			RemotePort:     r.RemotePort,
+			LocalPort:      r.LocalPort,
+			Host:           r.Host,
+			RemoteSocket:   r.RemoteSocket,
+			LocalSocket:    r.LocalSocket,
+			Name:           r.Name,
+			ConnectionInfo: r.ConnectionInfo,
+			Attempts:       r.Attempts,
+			NextAttempt:    r.NextAttempt.Format(time.RFC3339),
+			LastError:      r.LastError,
+		})
+	}
+
+	var groups []protocol.ForwardGroupInfo
+	for _, g := range d.forwarder.Groups() {
+		groups = append(groups, protocol.ForwardGroupInfo{
+			Group:          g.Group,
+			ConnectionInfo: g.ConnectionInfo,
+			Ports:          g.Ports,
+			Active:         g.Active,
+			Pending:        g.Pending,
+		})
+	}
+
 	status := protocol.StatusResponse{
 		Version:        version.GetVersion(),
 		Uptime:         uptime,
 		ActiveForwards: len(forwards),
 		Connections:    connections,
+		PendingRetries: pendingRetries,
+		Groups:         groups,
+		NamedForwards:  named,
+	}
+	if statusReq.Environment {
+		status.Environment = d.environment(peer)
 	}
 
 	resp, err := protocol.NewSuccessResponse(req.ID, status)
@@ -328,8 +848,79 @@ func (d *Daemon) handleStatusCommand(req *protocol.Request) *protocol.Response {
 	return resp
 }
 
+// environment describes the daemon process and its setup for status -v. A
+// remote host is only told of its own control socket.
+func (d *Daemon) environment(peer forwarder.Peer) *protocol.DaemonEnvironment {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	env := &protocol.DaemonEnvironment{
+		PID:         os.Getpid(),
+		Platform:    runtime.GOOS + "/" + runtime.GOARCH,
+		GoVersion:   runtime.Version(),
+		MemoryBytes: mem.Sys,
+		HeapBytes:   mem.HeapAlloc,
+		Goroutines:  runtime.NumGoroutine(),
+		ConfigPath:  d.config.Path,
+		Network:     d.config.Network,
+		Address:     d.config.Address,
+		SSHCommand:  d.config.SSHCommand,
+	}
+	if path, err := exec.LookPath(d.config.SSHCommand); err == nil {
+		env.SSHCommandPath = path
+	}
+
+	if peer.Remote {
+		if peer.Connection.SocketPath != "" {
+			env.ControlSockets = []protocol.SSHConnection{{
+				ConnectionInfo: peer.Connection.ConnectionInfo,
+				SocketPath:     peer.Connection.SocketPath,
+			}}
+		}
+		return env
+	}
+	env.ControlSockets = d.controlSockets()
+	return env
+}
+
+// controlSocketsTTL is how long the control sockets found for status are
+// reused, as finding them scans every process
+const controlSocketsTTL = 10 * time.Second
+
+// controlSockets returns this machine's SSH control masters for status,
+// found again once controlSocketsTTL has passed
+func (d *Daemon) controlSockets() []protocol.SSHConnection {
+	d.controlSocketsMu.Lock()
+	defer d.controlSocketsMu.Unlock()
+	if !d.controlSocketsAt.IsZero() && time.Since(d.controlSocketsAt) < controlSocketsTTL {
+		return d.controlSocketsFound
+	}
+
+	connections, err := d.forwarder.Connections()
+	if err != nil {
+		d.logger.Debug("Failed to list SSH connections for status", "error", err)
+	}
+	found := make([]protocol.SSHConnection, 0, len(connections))
+	for _, conn := range connections {
+		found = append(found, protocol.SSHConnection{
+			ConnectionInfo: conn.ConnectionInfo,
+			SocketPath:     conn.SocketPath,
+			LocalPorts:     conn.LocalPorts,
+		})
+	}
+	d.controlSocketsFound, d.controlSocketsAt = found, time.Now()
+	return found
+}
+
 // handleListCommand handles the list forwards command
 func (d *Daemon) handleListCommand(req *protocol.Request) *protocol.Response {
+	var listReq protocol.ListRequest
+	if len(req.Payload) > 0 {
+		if err := json.Unmarshal(req.Payload, &listReq); err != nil {
+			return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid list request format: %w", err))
+		}
+	}
+
 	// Reconcile before listing to ensure we show accurate state
 	if err := d.forwarder.Reconcile(); err != nil {
 		d.logger.Warn("Failed to reconcile forwards before listing", "error", err)
@@ -339,13 +930,16 @@ func (d *Daemon) handleListCommand(req *protocol.Request) *protocol.Response {
 
 	forwardInfos := make([]protocol.ForwardInfo, 0, len(forwards))
 	for _, fwd := range forwards {
-		forwardInfos = append(forwardInfos, protocol.ForwardInfo{
-			RemotePort:     fwd.RemotePort,
-			LocalPort:      fwd.LocalPort,
-			Host:           fwd.Host,
-			ConnectionInfo: fwd.ConnectionInfo,
-			CreatedAt:      fwd.CreatedAt.Format(time.RFC3339),
-		})
+		info := forwardInfo(fwd)
+		switch {
+		case listReq.CheckReachable:
+			healthy := d.forwarder.Reachable(fwd)
+			info.Healthy = &healthy
+		case listReq.CheckHealth:
+			healthy := d.forwarder.LocalEndListening(fwd)
+			info.Healthy = &healthy
+		}
+		forwardInfos = append(forwardInfos, info)
 	}
 
 	list := protocol.ListResponse{
@@ -359,6 +953,36 @@ func (d *Daemon) handleListCommand(req *protocol.Request) *protocol.Response {
 	return resp
 }
 
+// forwardInfo converts a tracked forward for the wire
+func forwardInfo(fwd *forwarder.Forward) protocol.ForwardInfo {
+	info := protocol.ForwardInfo{
+		Name:           fwd.Name,
+		RemotePort:     fwd.RemotePort,
+		LocalPort:      fwd.LocalPort,
+		SSHPort:        fwd.SSHPort,
+		Host:           fwd.Host,
+		RemoteSocket:   fwd.RemoteSocket,
+		LocalSocket:    fwd.LocalSocket,
+		Group:          fwd.Group,
+		ConnectionInfo: fwd.ConnectionInfo,
+		SocketPath:     fwd.SocketPath,
+		BindAddress:    fwd.LocalBindAddress(),
+		Owner:          fwd.Owner,
+		AppProtocol:    fwd.AppProtocol,
+		Server:         fwd.Server,
+		CreatedAt:      fwd.CreatedAt.Format(time.RFC3339),
+	}
+	if stats, ok := fwd.Stats(); ok {
+		info.Stats = &protocol.ForwardStats{
+			BytesSent:         stats.BytesSent,
+			BytesReceived:     stats.BytesReceived,
+			Connections:       stats.Connections,
+			ActiveConnections: stats.ActiveConnections,
+		}
+	}
+	return info
+}
+
 // handleForwardCommand handles the port forward command
 func (d *Daemon) handleForwardCommand(req *protocol.Request) *protocol.Response {
 	// Parse payload
@@ -369,47 +993,182 @@ func (d *Daemon) handleForwardCommand(req *protocol.Request) *protocol.Response
 			"payload", string(req.Payload))
 		return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid forward request format: %w", err))
 	}
+	return d.forward(req.ID, &forwardReq)
+}
+
+// forward establishes the forward described by forwardReq and builds the
+// response to the request with the given ID
+func (d *Daemon) forward(id string, forwardReq *protocol.ForwardRequest) *protocol.Response {
+	if err := forwardReq.Validate(); err != nil {
+		return protocol.NewErrorResponse(id, err)
+	}
 
-	// Find socket path if not provided
+	// Find socket path if not provided. An explicit one pins the forward to
+	// that master, so several masters for one host can be told apart.
 	socketPath := forwardReq.SocketPath
+	pinned := socketPath != ""
 	if socketPath == "" {
 		var err error
-		socketPath, err = forwarder.FindControlSocket(forwardReq.ConnectionInfo)
+		socketPath, err = d.forwarder.FindControlSocket(forwardReq.ConnectionInfo)
 		if err != nil {
-			return protocol.NewErrorResponse(req.ID, fmt.Errorf("failed to find SSH socket: %w", err))
+			return protocol.NewErrorResponse(id, fmt.Errorf("failed to find SSH socket: %w", err))
 		}
 	}
 
-	// Add forward
-	created, err := d.forwarder.AddForward(socketPath, forwardReq.ConnectionInfo, forwardReq.RemotePort, forwardReq.LocalPort, forwardReq.Host)
-	if err != nil {
-		return protocol.NewErrorResponse(req.ID, err)
-	}
-
 	// Default values
-	host := forwardReq.Host
+	host := protocol.NormalizeHost(forwardReq.Host)
 	if host == "" {
 		host = "localhost"
 	}
-	localPort := forwardReq.LocalPort
-	if localPort == 0 {
-		localPort = forwardReq.RemotePort
+	remote := net.JoinHostPort(host, strconv.Itoa(forwardReq.RemotePort))
+	if forwardReq.RemoteSocket != "" {
+		remote = forwardReq.RemoteSocket
+	}
+
+	if forwardReq.RemotePortEnd != 0 {
+		if forwardReq.Name != "" {
+			return protocol.NewErrorResponse(id, fmt.Errorf("a port range cannot be named"))
+		}
+		if forwardReq.Conflict != "" {
+			return protocol.NewErrorResponse(id, fmt.Errorf("port ranges follow the configured conflict policy and can't override it"))
+		}
+		return d.forwardRange(id, forwardReq, socketPath, host)
+	}
+
+	want := forwarder.Forward{
+		RemotePort:     forwardReq.RemotePort,
+		LocalPort:      forwardReq.LocalPort,
+		Host:           host,
+		RemoteSocket:   forwardReq.RemoteSocket,
+		LocalSocket:    forwardReq.LocalSocket,
+		SocketPath:     socketPath,
+		Pinned:         pinned,
+		BindAddress:    forwardReq.BindAddress,
+		Name:           forwardReq.Name,
+		Owner:          forwardReq.Owner,
+		AppProtocol:    forwardReq.AppProtocol,
+		Server:         forwardReq.Server,
+		Conflict:       forwarder.PortConflictStrategy(forwardReq.Conflict),
+		ConnectionInfo: forwardReq.ConnectionInfo,
+	}
+	if forwardReq.Owner == protocol.OwnerOpen {
+		// Nobody asked for these by hand to take down again
+		_, openerConfig := d.currentOpener()
+		want.IdleTimeout = idleTimeout(openerConfig.ForwardIdleTimeout)
+	}
+	if forwardReq.DryRun {
+		commands, err := d.forwarder.PlanAdd(want)
+		return dryRunResponse(id, "Forward of "+remote, commands, err)
+	}
+
+	// Add forward
+	localPort, created, err := d.forwarder.Add(want)
+	local := fmt.Sprintf("localhost:%d", localPort)
+	if forwardReq.LocalSocket != "" {
+		local = forwardReq.LocalSocket
+	}
+
+	// A forward ssh rejected is retried in the background; report it as
+	// accepted so the caller keeps tracking it
+	if errors.Is(err, forwarder.ErrRetryQueued) {
+		requestedPort := forwardReq.LocalPort
+		if requestedPort == 0 && forwardReq.LocalSocket == "" {
+			requestedPort = forwardReq.RemotePort
+		}
+		resp, _ := protocol.NewSuccessResponse(id, protocol.ForwardResponse{
+			Message:     fmt.Sprintf("Forward of %s queued for retry: %v", remote, err),
+			SocketPath:  socketPath,
+			LocalPort:   requestedPort,
+			LocalSocket: forwardReq.LocalSocket,
+			Queued:      true,
+		})
+		return resp
+	}
+	if err != nil {
+		return protocol.NewErrorResponse(id, err)
 	}
 
 	// Notify on new forwards (not duplicates from reconciliation)
 	if created {
-		d.notifier.NotifyForward(forwardReq.RemotePort, localPort, host, forwardReq.ProcessName, forwardReq.ProcessCwd)
+		if forwardReq.RemoteSocket != "" || forwardReq.LocalSocket != "" {
+			d.notifier.NotifyMessage("Socket forwarded",
+				fmt.Sprintf("%s → %s", remote, local))
+		} else {
+			tracked := want
+			if fwd, ok := d.forwarder.Find(want); ok {
+				tracked = fwd
+			}
+			info := forwardInfo(&tracked)
+			info.LocalPort = localPort
+			d.notifier.NotifyForward(notify.Forward{
+				ForwardInfo: info,
+				ProcessName: forwardReq.ProcessName,
+				ProcessCwd:  forwardReq.ProcessCwd,
+			})
+		}
 	}
 
-	// Return success
-	resp, _ := protocol.NewSuccessResponse(req.ID, map[string]interface{}{
-		"message": fmt.Sprintf("Forwarded %s:%d to localhost:%d",
-			host, forwardReq.RemotePort, localPort),
-		"socket_path": socketPath,
+	// Return success, with how a busy local port was handled
+	var decision *protocol.ConflictDecision
+	if fwd, ok := d.forwarder.Find(want); created && ok && fwd.Resolution != nil {
+		decision = &protocol.ConflictDecision{
+			Policy:        string(fwd.Resolution.Strategy),
+			RequestedPort: fwd.Resolution.RequestedPort,
+			LocalPort:     localPort,
+			Stolen:        fwd.Resolution.Stolen,
+		}
+	}
+	resp, _ := protocol.NewSuccessResponse(id, protocol.ForwardResponse{
+		Message:     fmt.Sprintf("Forwarded %s to %s", remote, local),
+		SocketPath:  socketPath,
+		LocalPort:   localPort,
+		LocalSocket: forwardReq.LocalSocket,
+		Existing:    !created,
+		Conflict:    decision,
+	})
+	return resp
+}
+
+// forwardRange adds a port range forward as a group
+func (d *Daemon) forwardRange(id string, forwardReq *protocol.ForwardRequest, socketPath, host string) *protocol.Response {
+	if forwardReq.RemoteSocket != "" || forwardReq.LocalSocket != "" {
+		return protocol.NewErrorResponse(id, fmt.Errorf("port ranges can't be combined with socket forwards"))
+	}
+
+	if forwardReq.DryRun {
+		commands, err := d.forwarder.PlanAddRange(socketPath, forwardReq.ConnectionInfo,
+			forwardReq.RemotePort, forwardReq.RemotePortEnd, forwardReq.LocalPort, host)
+		return dryRunResponse(id, "Forward of "+portRangeLabel(host, forwardReq.RemotePort, forwardReq.RemotePortEnd), commands, err)
+	}
+
+	localPorts, created, err := d.forwarder.AddRange(socketPath, forwardReq.ConnectionInfo,
+		forwardReq.RemotePort, forwardReq.RemotePortEnd, forwardReq.LocalPort, host, forwardReq.Owner)
+	if err != nil {
+		return protocol.NewErrorResponse(id, err)
+	}
+
+	remote := portRangeLabel(host, forwardReq.RemotePort, forwardReq.RemotePortEnd)
+	if created {
+		d.notifier.NotifyMessage("Ports forwarded",
+			fmt.Sprintf("%s → localhost:%d-%d", remote, localPorts[0], localPorts[len(localPorts)-1]))
+	}
+
+	resp, _ := protocol.NewSuccessResponse(id, protocol.ForwardResponse{
+		Message:    fmt.Sprintf("Forwarded %s (%d ports)", remote, len(localPorts)),
+		SocketPath: socketPath,
+		LocalPort:  localPorts[0],
+		LocalPorts: localPorts,
+		Existing:   !created && !slices.Contains(localPorts, 0),
 	})
 	return resp
 }
 
+// portRangeLabel describes a remote port range for messages, e.g.
+// "localhost:3000-3010" or "[::1]:3000-3010"
+func portRangeLabel(host string, start, end int) string {
+	return net.JoinHostPort(host, fmt.Sprintf("%d-%d", start, end))
+}
+
 // handleUnforwardCommand handles the port unforward command
 func (d *Daemon) handleUnforwardCommand(req *protocol.Request) *protocol.Response {
 	// Parse payload
@@ -417,22 +1176,186 @@ func (d *Daemon) handleUnforwardCommand(req *protocol.Request) *protocol.Respons
 	if err := json.Unmarshal(req.Payload, &unforwardReq); err != nil {
 		return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid unforward request format: %w", err))
 	}
+	if err := unforwardReq.Validate(); err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
 
 	// Default values
-	host := unforwardReq.Host
+	host := protocol.NormalizeHost(unforwardReq.Host)
 	if host == "" {
 		host = "localhost"
 	}
 
-	// Remove forward
-	if err := d.forwarder.RemoveForward(unforwardReq.ConnectionInfo, unforwardReq.RemotePort, host); err != nil {
+	// Remove forward, or with a dry run only plan its removal
+	remote := net.JoinHostPort(host, strconv.Itoa(unforwardReq.RemotePort))
+	var commands []string
+	var err error
+	switch {
+	case unforwardReq.Name != "":
+		remote = unforwardReq.Name
+		if unforwardReq.DryRun {
+			commands, err = d.forwarder.PlanRemoveByName(unforwardReq.Name)
+		} else {
+			err = d.forwarder.RemoveByName(unforwardReq.Name)
+		}
+	case unforwardReq.RemotePortEnd != 0:
+		remote = portRangeLabel(host, unforwardReq.RemotePort, unforwardReq.RemotePortEnd)
+		if unforwardReq.DryRun {
+			commands, err = d.forwarder.PlanRemoveRange(unforwardReq.ConnectionInfo, unforwardReq.RemotePort, unforwardReq.RemotePortEnd, host)
+		} else {
+			err = d.forwarder.RemoveRange(unforwardReq.ConnectionInfo, unforwardReq.RemotePort, unforwardReq.RemotePortEnd, host)
+		}
+	default:
+		if unforwardReq.RemoteSocket != "" {
+			remote = unforwardReq.RemoteSocket
+		}
+		want := forwarder.Forward{
+			RemotePort:     unforwardReq.RemotePort,
+			Host:           host,
+			RemoteSocket:   unforwardReq.RemoteSocket,
+			SocketPath:     unforwardReq.SocketPath,
+			ConnectionInfo: unforwardReq.ConnectionInfo,
+		}
+		if unforwardReq.DryRun {
+			commands, err = d.forwarder.PlanRemove(want)
+		} else {
+			err = d.forwarder.Remove(want)
+		}
+	}
+	if unforwardReq.DryRun {
+		return dryRunResponse(req.ID, "Removal of "+remote, commands, err)
+	}
+	if err != nil {
 		return protocol.NewErrorResponse(req.ID, err)
 	}
 
 	// Return success
 	resp, _ := protocol.NewSuccessResponse(req.ID, map[string]interface{}{
-		"message": fmt.Sprintf("Removed forward for %s:%d",
-			host, unforwardReq.RemotePort),
+		"message": fmt.Sprintf("Removed forward for %s", remote),
+	})
+	return resp
+}
+
+// handleExportCommand handles the export command
+func (d *Daemon) handleExportCommand(req *protocol.Request) *protocol.Response {
+	var exportReq protocol.ExportRequest
+	if len(req.Payload) > 0 {
+		if err := json.Unmarshal(req.Payload, &exportReq); err != nil {
+			return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid export request format: %w", err))
+		}
+	}
+
+	set := protocol.ForwardSet{Forwards: []protocol.ForwardSpec{}}
+	for _, spec := range d.forwarder.Specs(exportReq.ConnectionInfo) {
+		set.Forwards = append(set.Forwards, protocol.ForwardSpec{
+			Name:           spec.Name,
+			RemotePort:     spec.RemotePort,
+			RemotePortEnd:  spec.RemotePortEnd,
+			LocalPort:      spec.LocalPort,
+			Host:           spec.Host,
+			RemoteSocket:   spec.RemoteSocket,
+			LocalSocket:    spec.LocalSocket,
+			BindAddress:    spec.BindAddress,
+			ConnectionInfo: spec.ConnectionInfo,
+			SocketPath:     spec.SocketPath,
+		})
+	}
+
+	resp, err := protocol.NewSuccessResponse(req.ID, set)
+	if err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	return resp
+}
+
+// handleImportCommand handles the import command. Each forward is added as
+// if it had been requested on its own; one failing doesn't stop the rest.
+func (d *Daemon) handleImportCommand(req *protocol.Request) *protocol.Response {
+	var importReq protocol.ImportRequest
+	if err := json.Unmarshal(req.Payload, &importReq); err != nil {
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid import request format: %w", err))
+	}
+
+	results := make([]protocol.ImportResult, 0, len(importReq.Forwards))
+	for _, spec := range importReq.Forwards {
+		if importReq.ConnectionInfo != "" && importReq.ConnectionInfo != spec.ConnectionInfo {
+			// A saved control socket belongs to the saved connection; the
+			// new one's is found as for any forward
+			spec.ConnectionInfo = importReq.ConnectionInfo
+			spec.SocketPath = ""
+		}
+		result := protocol.ImportResult{Forward: spec}
+		if spec.ConnectionInfo == "" {
+			result.Error = "no connection to forward through"
+			results = append(results, result)
+			continue
+		}
+
+		forwardReq := spec.ForwardRequest()
+		forwardReq.Owner = importReq.Owner
+		result.ForwardBatchResult = d.forwardResult(req.ID, &forwardReq)
+		results = append(results, result)
+	}
+
+	d.logger.Info("Imported forwards", "count", len(results))
+
+	resp, err := protocol.NewSuccessResponse(req.ID, protocol.ImportResponse{Results: results})
+	if err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	return resp
+}
+
+// handleForwardBatchCommand establishes each forward of a batch in turn
+func (d *Daemon) handleForwardBatchCommand(req *protocol.Request) *protocol.Response {
+	var batchReq protocol.ForwardBatchRequest
+	if err := json.Unmarshal(req.Payload, &batchReq); err != nil {
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid forward batch format: %w", err))
+	}
+
+	results := make([]protocol.ForwardBatchResult, 0, len(batchReq.Forwards))
+	for i := range batchReq.Forwards {
+		forwardReq := &batchReq.Forwards[i]
+		if forwardReq.DryRun {
+			results = append(results, protocol.ForwardBatchResult{Error: "dry runs can't be batched"})
+			continue
+		}
+		results = append(results, d.forwardResult(req.ID, forwardReq))
+	}
+
+	resp, err := protocol.NewSuccessResponse(req.ID, protocol.ForwardBatchResponse{Results: results})
+	if err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	return resp
+}
+
+// forwardResult adds forwardReq as if it had been requested on its own, for
+// requests made of several forwards that each succeed or fail alone
+func (d *Daemon) forwardResult(id string, forwardReq *protocol.ForwardRequest) protocol.ForwardBatchResult {
+	resp := d.forward(id, forwardReq)
+	if !resp.Success {
+		return protocol.ForwardBatchResult{Error: resp.Error}
+	}
+	var fwdResp protocol.ForwardResponse
+	if err := json.Unmarshal(resp.Data, &fwdResp); err != nil {
+		return protocol.ForwardBatchResult{}
+	}
+	return protocol.ForwardBatchResult{Result: &fwdResp}
+}
+
+// dryRunResponse reports the ssh commands an operation on what would run
+func dryRunResponse(id, what string, commands []string, err error) *protocol.Response {
+	if err != nil {
+		return protocol.NewErrorResponse(id, err)
+	}
+	message := fmt.Sprintf("%s would run %d ssh command(s)", what, len(commands))
+	if len(commands) == 0 {
+		message = fmt.Sprintf("%s needs no ssh commands", what)
+	}
+	resp, _ := protocol.NewSuccessResponse(id, protocol.DryRunResponse{
+		Message:  message,
+		Commands: commands,
 	})
 	return resp
 }
@@ -444,7 +1367,7 @@ func (d *Daemon) handleOpProxyCommand(req *protocol.Request) *protocol.Response
 		return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid op-proxy request format: %w", err))
 	}
 
-	opResp, err := d.opProxy.Execute(opReq)
+	opResp, err := d.currentOpProxy().Execute(opReq)
 	if err != nil {
 		return protocol.NewErrorResponse(req.ID, err)
 	}
@@ -458,6 +1381,325 @@ func (d *Daemon) handleOpProxyCommand(req *protocol.Request) *protocol.Response
 	return resp
 }
 
+// handleCopyCommand puts the request's text on the local clipboard
+func (d *Daemon) handleCopyCommand(req *protocol.Request) *protocol.Response {
+	var copyReq protocol.ClipboardRequest
+	if err := json.Unmarshal(req.Payload, &copyReq); err != nil {
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid payload: %w", err))
+	}
+
+	if err := d.clipboard.Copy(copyReq.Text); err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+
+	resp, _ := protocol.NewSuccessResponse(req.ID, map[string]string{
+		"message": fmt.Sprintf("Copied %d bytes", len(copyReq.Text)),
+	})
+	return resp
+}
+
+// handlePasteCommand returns the text on the local clipboard
+func (d *Daemon) handlePasteCommand(req *protocol.Request) *protocol.Response {
+	settings := d.currentClipboard()
+	if !settings.Paste {
+		d.logger.Warn("Clipboard read refused, clipboard.paste is off")
+		return protocol.NewErrorResponse(req.ID, errors.New("reading the clipboard isn't enabled (set clipboard.paste in the daemon's config)"))
+	}
+	text, err := d.clipboard.Paste()
+	if err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	d.logger.Info("Clipboard read", "bytes", len(text))
+	if settings.NotifyPaste {
+		d.notifier.NotifyMessage("Clipboard read", fmt.Sprintf("bankshot paste read %d bytes from the clipboard", len(text)))
+	}
+
+	resp, err := protocol.NewSuccessResponse(req.ID, protocol.ClipboardResponse{Text: text})
+	if err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	return resp
+}
+
+// handleNotifyCommand posts a desktop notification through the notify helper
+func (d *Daemon) handleNotifyCommand(req *protocol.Request) *protocol.Response {
+	var notifyReq protocol.NotifyRequest
+	if err := json.Unmarshal(req.Payload, &notifyReq); err != nil {
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid payload: %w", err))
+	}
+	if !d.notifier.Enabled() {
+		return protocol.NewErrorResponse(req.ID, fmt.Errorf("desktop notifications are disabled, set notify_command in the daemon's config"))
+	}
+	// Clicking the notification opens its URL, outside the opener, so it's
+	// checked and confirmed as one the opener opens would be
+	if notifyReq.URL != "" {
+		urlOpener, _ := d.currentOpener()
+		if err := urlOpener.ConfirmURL(notifyReq.URL); err != nil {
+			return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid notification URL: %w", err))
+		}
+	}
+
+	title := notifyReq.Title
+	if title == "" {
+		title = notifyReq.ConnectionInfo
+	}
+	if title == "" {
+		title = "Bankshot"
+	}
+	if err := d.notifier.NotifyRemote(notifyReq.ConnectionInfo, title, notifyReq.Body, notifyReq.URL); err != nil {
+		d.logger.Warn("Notification denied", "title", title, "connectionInfo", notifyReq.ConnectionInfo, "error", err)
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	d.logger.Info("Posted notification", "title", title, "connectionInfo", notifyReq.ConnectionInfo)
+
+	resp, _ := protocol.NewSuccessResponse(req.ID, map[string]string{
+		"message": "Notification posted",
+	})
+	return resp
+}
+
+// handleConnectionsCommand lists the SSH control masters on this machine
+// for bankshot run here. A remote host is told only of the one its request
+// came through, which takes no scan of every process, and tells it nothing
+// of the laptop's other hosts.
+func (d *Daemon) handleConnectionsCommand(req *protocol.Request, peer forwarder.Peer) *protocol.Response {
+	result := protocol.ConnectionsResponse{Connections: []protocol.SSHConnection{}}
+	if peer.Remote {
+		if peer.Connection.SocketPath != "" {
+			own := protocol.SSHConnection{
+				ConnectionInfo: peer.Connection.ConnectionInfo,
+				SocketPath:     peer.Connection.SocketPath,
+			}
+			result.Connections = append(result.Connections, own)
+			result.Caller = &own
+		}
+	} else {
+		connections, err := d.forwarder.Connections()
+		if err != nil {
+			return protocol.NewErrorResponse(req.ID, fmt.Errorf("failed to list SSH connections: %w", err))
+		}
+		for _, conn := range connections {
+			result.Connections = append(result.Connections, protocol.SSHConnection{
+				ConnectionInfo: conn.ConnectionInfo,
+				SocketPath:     conn.SocketPath,
+				LocalPorts:     conn.LocalPorts,
+			})
+		}
+	}
+
+	resp, err := protocol.NewSuccessResponse(req.ID, result)
+	if err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	return resp
+}
+
+// handleHistoryCommand handles the history command
+func (d *Daemon) handleHistoryCommand(req *protocol.Request) *protocol.Response {
+	entries := d.history.Entries()
+
+	historyEntries := make([]protocol.HistoryEntry, 0, len(entries))
+	for _, e := range entries {
+		historyEntries = append(historyEntries, protocol.HistoryEntry{
+			URL:            e.URL,
+			ConnectionInfo: e.ConnectionInfo,
+			ProcessName:    e.ProcessName,
+			ProcessCwd:     e.ProcessCwd,
+			OpenedAt:       e.OpenedAt.Format(time.RFC3339),
+			Denied:         e.Denied,
+			Reason:         e.Reason,
+		})
+	}
+
+	_, openerConfig := d.currentOpener()
+	hist := protocol.HistoryResponse{
+		Entries:     historyEntries,
+		HourlyCount: d.history.CountsSince(time.Now().Add(-time.Hour)),
+		HourlyLimit: openerConfig.MaxOpensPerHour,
+	}
+
+	resp, err := protocol.NewSuccessResponse(req.ID, hist)
+	if err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	return resp
+}
+
+// handleReopenCommand opens an entry from the open history again. A URL
+// goes through the same checks, quota, and port forwarding as any other
+// open; a file is opened from where it was saved, if it's still there,
+// counting against the quota too. A remote host can only reopen what it
+// opened itself.
+func (d *Daemon) handleReopenCommand(req *protocol.Request, peer forwarder.Peer) *protocol.Response {
+	var reopenReq protocol.ReopenRequest
+	if len(req.Payload) > 0 {
+		if err := json.Unmarshal(req.Payload, &reopenReq); err != nil {
+			return protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid payload: %w", err))
+		}
+	}
+	mine := func(e history.Entry) bool {
+		return !peer.Remote || e.ConnectionInfo == peer.Connection.ConnectionInfo
+	}
+	entry, err := reopenEntry(d.history.Entries(), reopenReq, mine)
+	if err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+
+	if rest, ok := strings.CutPrefix(entry.URL, "file://"); ok {
+		localPath := filepath.FromSlash(rest)
+		if _, err := os.Stat(localPath); err != nil {
+			return protocol.NewErrorResponse(req.ID, fmt.Errorf("%s is gone: %w", localPath, err))
+		}
+		entry.ProcessName, entry.ProcessCwd, entry.OpenedAt = reopenProcessName, "", time.Now()
+		withdraw, err := d.admitOpen(entry)
+		if err != nil {
+			return protocol.NewErrorResponse(req.ID, err)
+		}
+		urlOpener, _ := d.currentOpener()
+		if err := urlOpener.OpenFile(localPath); err != nil {
+			withdraw()
+			return protocol.NewErrorResponse(req.ID, err)
+		}
+		d.recordOpen(entry)
+		resp, _ := protocol.NewSuccessResponse(req.ID, map[string]string{
+			"message": fmt.Sprintf("Opened file: %s", localPath),
+		})
+		return resp
+	}
+
+	payload, err := json.Marshal(protocol.OpenRequest{
+		URL:            entry.URL,
+		ConnectionInfo: entry.ConnectionInfo,
+		ProcessName:    reopenProcessName,
+	})
+	if err != nil {
+		return protocol.NewErrorResponse(req.ID, err)
+	}
+	return d.handleOpenCommand(&protocol.Request{ID: req.ID, Type: protocol.CommandOpen, Payload: payload}, peer)
+}
+
+// reopenProcessName stands in for the process that asked for an open in
+// the history entries of reopens
+const reopenProcessName = "bankshot reopen"
+
+// reopenEntry returns the history entry req picks, of those mine allows.
+// Denied opens are never reopened, since that would get around whatever
+// denied them.
+func reopenEntry(entries []history.Entry, req protocol.ReopenRequest, mine func(history.Entry) bool) (history.Entry, error) {
+	if req.Index > 0 {
+		if req.Index > len(entries) {
+			return history.Entry{}, fmt.Errorf("no open #%d; the history has %d", req.Index, len(entries))
+		}
+		entry := entries[len(entries)-req.Index]
+		if !mine(entry) {
+			return history.Entry{}, fmt.Errorf("open #%d was from another connection", req.Index)
+		}
+		if entry.Denied {
+			return history.Entry{}, fmt.Errorf("open #%d was denied: %s", req.Index, entry.Reason)
+		}
+		return entry, nil
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if mine(entries[i]) && !entries[i].Denied && strings.Contains(entries[i].URL, req.Match) {
+			return entries[i], nil
+		}
+	}
+	if req.Match != "" {
+		return history.Entry{}, fmt.Errorf("no opened URL contains %q", req.Match)
+	}
+	return history.Entry{}, errors.New("no opens recorded")
+}
+
+// recordOpen adds entry to the open history, saving the history to
+// opener.history_file when that's set
+func (d *Daemon) recordOpen(entry history.Entry) {
+	d.history.Record(entry)
+	_, openerConfig := d.currentOpener()
+	if path := openerConfig.HistoryFile; path != "" {
+		if err := d.history.Save(path); err != nil {
+			d.logger.Warn("Failed to save open history", "path", path, "error", err)
+		}
+	}
+}
+
+// handleLogsCommand sends the log records kept at or above the requested
+// level and, when following, streams new ones as JSON lines until the
+// client disconnects or the daemon stops
+func (d *Daemon) handleLogsCommand(conn net.Conn, req *protocol.Request) {
+	var logsReq protocol.LogsRequest
+	if len(req.Payload) > 0 {
+		if err := json.Unmarshal(req.Payload, &logsReq); err != nil {
+			d.sendResponse(conn, protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid logs request: %w", err)))
+			return
+		}
+	}
+	minLevel := slog.LevelDebug
+	if logsReq.Level != "" {
+		if err := minLevel.UnmarshalText([]byte(logsReq.Level)); err != nil {
+			d.sendResponse(conn, protocol.NewErrorResponse(req.ID, fmt.Errorf("invalid log level: %s", logsReq.Level)))
+			return
+		}
+	}
+	include := func(record protocol.LogRecord) bool {
+		var level slog.Level
+		return level.UnmarshalText([]byte(record.Level)) != nil || level >= minLevel
+	}
+
+	var recent []protocol.LogRecord
+	var records <-chan protocol.LogRecord
+	if logsReq.Follow {
+		var cancel func()
+		recent, records, cancel = d.logs.subscribe(minLevel)
+		defer cancel()
+	} else {
+		recent = d.logs.recent()
+	}
+
+	selected := make([]protocol.LogRecord, 0, len(recent))
+	for _, record := range recent {
+		if include(record) {
+			selected = append(selected, record)
+		}
+	}
+	if logsReq.Lines > 0 && len(selected) > logsReq.Lines {
+		selected = selected[len(selected)-logsReq.Lines:]
+	}
+
+	resp, err := protocol.NewSuccessResponse(req.ID, protocol.LogsResponse{Records: selected})
+	if err != nil {
+		resp = protocol.NewErrorResponse(req.ID, err)
+	}
+	d.sendResponse(conn, resp)
+	if !logsReq.Follow {
+		return
+	}
+
+	// The client sends nothing more, so a read returns once it disconnects
+	gone := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		close(gone)
+	}()
+
+	encoder := json.NewEncoder(conn)
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-gone:
+			return
+		case record := <-records:
+			if !include(record) {
+				continue
+			}
+			if err := encoder.Encode(record); err != nil {
+				return
+			}
+		}
+	}
+}
+
 // handleReconcileCommand handles the reconcile command
 func (d *Daemon) handleReconcileCommand(req *protocol.Request) *protocol.Response {
 	d.logger.Info("Reconciliation requested via API")
@@ -513,6 +1755,13 @@ func (d *Daemon) shutdown() error {
 	// Wait for all connections to finish
 	d.wg.Wait()
 
+	// Stop the vhost proxy and accounting relays
+	d.vhost.Close()
+	d.forwarder.Close()
+
+	// Remove the files sent to be opened
+	d.files.Close()
+
 	// Clean up socket file if unix
 	if d.config.Network == "unix" {
 		if err := os.RemoveAll(d.config.Address); err != nil {
@@ -601,7 +1850,7 @@ func (d *Daemon) autoDiscoverForwards() error {
 	d.logger.Info("Auto-discovering existing SSH port forwards")
 
 	// Discover active forwards
-	forwards, err := forwarder.DiscoverActiveForwards(d.logger)
+	forwards, err := d.forwarder.DiscoverActiveForwards()
 	if err != nil {
 		return fmt.Errorf("failed to discover forwards: %w", err)
 	}
@@ -619,8 +1868,6 @@ func (d *Daemon) autoDiscoverForwards() error {
 		}
 
 		// Register the forward in our forwarder (without executing SSH command)
-		// Note: We're assuming the remote port is the same as local port
-		// This might not always be accurate, but it's a reasonable default
 		err := d.forwarder.RegisterExistingForward(
 			fwd.SocketPath,
 			fwd.ConnectionInfo,
@@ -650,7 +1897,14 @@ func (d *Daemon) autoDiscoverForwards() error {
 func (d *Daemon) reconcileLoop() {
 	defer d.wg.Done()
 
-	ticker := time.NewTicker(10 * time.Minute)
+	interval := 10 * time.Minute
+	if d.config.Forwarder.ReconcileInterval != "" {
+		if parsed, err := time.ParseDuration(d.config.Forwarder.ReconcileInterval); err == nil && parsed > 0 {
+			interval = parsed
+		}
+	}
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
@@ -665,3 +1919,184 @@ func (d *Daemon) reconcileLoop() {
 		}
 	}
 }
+
+// lookupNamedForward gives the vhost proxy the local port of a named TCP
+// forward
+func (d *Daemon) lookupNamedForward(name string) (int, bool) {
+	fwd, ok := d.forwarder.FindByName(name)
+	if !ok || fwd.LocalSocket != "" {
+		return 0, false
+	}
+	return fwd.LocalPort, true
+}
+
+// handleForwarderEvent reports forward health changes detected by
+// reconciliation, liveness checks, and retries
+func (d *Daemon) handleForwarderEvent(event forwarder.Event) {
+	fwd := event.Forward
+	d.logger.Info("Forward health changed",
+		"event", event.Type,
+		"connectionInfo", fwd.ConnectionInfo,
+		"remotePort", fwd.RemotePort,
+		"localPort", fwd.LocalPort,
+		"reason", event.Reason)
+
+	// Socket forwards have no remote port; name them by their local end
+	title := fmt.Sprintf("Port %d", fwd.RemotePort)
+	if fwd.RemoteSocket != "" && fwd.LocalSocket != "" {
+		title = fmt.Sprintf("Socket %s", fwd.LocalSocket)
+	} else if fwd.RemoteSocket != "" {
+		title = fmt.Sprintf("Port %d", fwd.LocalPort)
+	}
+	local := fmt.Sprintf("localhost:%d", fwd.LocalPort)
+	if fwd.LocalSocket != "" {
+		local = fwd.LocalSocket
+	}
+
+	switch event.Type {
+	case forwarder.EventReestablished:
+		d.notifier.NotifyMessage(title+" restored",
+			fmt.Sprintf("%s → %s re-established", fwd.RemoteTarget(), local))
+	case forwarder.EventDropped:
+		d.notifier.NotifyMessage(title+" dropped",
+			fmt.Sprintf("SSH connection to %s is gone", fwd.ConnectionInfo))
+	case forwarder.EventConnectionLost:
+		d.notifier.NotifyMessage(title+" disconnected",
+			fmt.Sprintf("SSH connection to %s was lost; will restore if it returns", fwd.ConnectionInfo))
+	case forwarder.EventConnectionRestored:
+		d.notifier.NotifyMessage(title+" restored",
+			fmt.Sprintf("%s → %s re-established after reconnect", fwd.RemoteTarget(), local))
+	case forwarder.EventIdleRemoved:
+		d.notifier.NotifyMessage(title+" unforwarded",
+			fmt.Sprintf("%s → %s removed after %s", fwd.RemoteTarget(), local, event.Reason))
+	case forwarder.EventRetryExhausted:
+		d.notifier.NotifyMessage(title+" not forwarded",
+			fmt.Sprintf("Gave up forwarding %s from %s", fwd.RemoteTarget(), fwd.ConnectionInfo))
+	}
+}
+
+// livenessLoop periodically checks that each connection's control master is
+// still running
+func (d *Daemon) livenessLoop() {
+	defer d.wg.Done()
+
+	interval, err := time.ParseDuration(d.config.Forwarder.LivenessInterval)
+	if err != nil || interval <= 0 {
+		d.logger.Warn("Invalid liveness interval, liveness checks disabled",
+			"interval", d.config.Forwarder.LivenessInterval)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			d.logger.Debug("Checking SSH connection liveness")
+			d.forwarder.CheckConnections()
+		}
+	}
+}
+
+// idleTimeout parses the configured idle timeout; empty or invalid disables
+func idleTimeout(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// idleLoop periodically removes forwards that have carried no traffic for
+// their idle timeout. It samples often enough to catch most connections
+// without relays: a tenth of the shortest timeout, between 10s and a minute.
+func (d *Daemon) idleLoop() {
+	defer d.wg.Done()
+
+	_, openerConfig := d.currentOpener()
+	timeout := 10 * time.Minute
+	for _, t := range []time.Duration{
+		idleTimeout(d.config.Forwarder.IdleTimeout),
+		idleTimeout(openerConfig.ForwardIdleTimeout),
+	} {
+		if t > 0 {
+			timeout = min(timeout, t)
+		}
+	}
+	interval := min(max(timeout/10, 10*time.Second), time.Minute)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			if removed := d.forwarder.RemoveIdle(); removed > 0 {
+				d.logger.Info("Removed idle forwards", "count", removed)
+			}
+		}
+	}
+}
+
+// retryLoop periodically retries forwards that ssh rejected
+func (d *Daemon) retryLoop() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			d.forwarder.ProcessRetries()
+		}
+	}
+}
+
+// auditLoop periodically verifies that forward listeners are loopback-only,
+// or shared only as forwarder.allow_lan_bind permits
+func (d *Daemon) auditLoop() {
+	defer d.wg.Done()
+
+	interval, err := time.ParseDuration(d.config.Forwarder.AuditInterval)
+	if err != nil || interval <= 0 {
+		d.logger.Warn("Invalid audit interval, audit disabled",
+			"interval", d.config.Forwarder.AuditInterval)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			d.logger.Debug("Running forward audit")
+			violations := d.forwarder.Audit(d.config.Forwarder.AuditFix)
+			for _, v := range violations {
+				body := fmt.Sprintf("localhost:%d (%s:%d) is reachable on %s",
+					v.LocalPort, v.Host, v.RemotePort, v.ExposedAddr)
+				if v.Policy {
+					body = fmt.Sprintf("localhost:%d (%s:%d) is bound to %s, but forwarder.allow_lan_bind is off",
+						v.LocalPort, v.Host, v.RemotePort, v.ExposedAddr)
+				}
+				if v.Corrected {
+					body += "\nRe-bound to loopback"
+				}
+				d.notifier.NotifyMessage("Bankshot audit", body)
+			}
+		}
+	}
+}
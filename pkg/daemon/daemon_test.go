@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/config"
+	"github.com/phinze/bankshot/pkg/forwarder"
+	"github.com/phinze/bankshot/pkg/history"
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+func TestHandleOpenUnknownBrowser(t *testing.T) {
+	payload, err := json.Marshal(protocol.OpenRequest{URL: "https://example.com", Browser: "netscape"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Refused before anything of the daemon's is touched
+	d := &Daemon{}
+	resp := d.handleOpenCommand(&protocol.Request{ID: "1", Type: protocol.CommandOpen, Payload: payload}, forwarder.Peer{})
+	if resp.Success || !strings.Contains(resp.Error, `unknown browser "netscape"`) {
+		t.Errorf("response = %+v, want the unknown browser refused", resp)
+	}
+}
+
+func TestHandleOpenRemoteQuota(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Opener.MaxOpensPerHour = 1
+	d := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	d.history.Admit("devbox", time.Now(), 0)
+
+	// Whatever connection the request names, it's the one it came through
+	// that's over its quota
+	peer := forwarder.Peer{Remote: true, Connection: forwarder.Connection{ConnectionInfo: "devbox"}}
+	for _, claimed := range []string{"devbox", "other", "another"} {
+		payload, err := json.Marshal(protocol.OpenRequest{URL: "https://example.com", ConnectionInfo: claimed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := d.handleOpenCommand(&protocol.Request{ID: claimed, Type: protocol.CommandOpen, Payload: payload}, peer)
+		if resp.Success || !strings.Contains(resp.Error, "hourly open limit") {
+			t.Errorf("response claiming %q = %+v, want the quota refusing it", claimed, resp)
+		}
+	}
+	entries := d.history.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("recorded %d opens, want the 3 denied", len(entries))
+	}
+	for _, e := range entries {
+		if e.ConnectionInfo != "devbox" {
+			t.Errorf("denied open recorded for %q, want devbox", e.ConnectionInfo)
+		}
+	}
+}
+
+func TestHandleReopenRemote(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Opener.MaxOpensPerHour = 1
+	d := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	file := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(file, []byte("%PDF"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fileURL := "file://" + filepath.ToSlash(file)
+	now := time.Now()
+	d.history.Record(history.Entry{URL: fileURL, ConnectionInfo: "devbox", OpenedAt: now})
+	d.history.Record(history.Entry{URL: fileURL, ConnectionInfo: "other", OpenedAt: now})
+	d.history.Admit("devbox", now, 0)
+
+	peer := forwarder.Peer{Remote: true, Connection: forwarder.Connection{ConnectionInfo: "devbox"}}
+	reopen := func(reopenReq protocol.ReopenRequest) *protocol.Response {
+		payload, err := json.Marshal(reopenReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d.handleReopenCommand(&protocol.Request{ID: "1", Type: protocol.CommandReopen, Payload: payload}, peer)
+	}
+
+	tests := []struct {
+		name string
+		req  protocol.ReopenRequest
+		want string
+	}{
+		{"another connection's by number", protocol.ReopenRequest{Index: 1}, "from another connection"},
+		{"its own, over the quota", protocol.ReopenRequest{Index: 2}, "hourly open limit"},
+		{"by match", protocol.ReopenRequest{Match: "report"}, "hourly open limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := reopen(tt.req); resp.Success || !strings.Contains(resp.Error, tt.want) {
+				t.Errorf("response = %+v, want an error containing %q", resp, tt.want)
+			}
+		})
+	}
+}
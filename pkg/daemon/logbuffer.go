@@ -0,0 +1,177 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+// logBufferSize is how many log records the daemon keeps for bankshot logs
+const logBufferSize = 1000
+
+// logSubscriberBuffer is how many records a following client can fall
+// behind by before further ones are dropped for it
+const logSubscriberBuffer = 256
+
+// logBuffer is an slog.Handler that keeps the daemon's latest log records,
+// those the handler it wraps writes, for bankshot logs, and passes them on.
+// While bankshot logs --follow asks for records below that handler's level,
+// such as debug ones, they're produced too, and go only to the clients
+// following, so there's no need to restart the daemon with --debug.
+type logBuffer struct {
+	next  slog.Handler
+	ring  *logRing
+	attrs []protocol.LogAttr // From WithAttrs
+	group string             // Prefix of keys added from here on, e.g. "conn."
+}
+
+// logRing holds the records shared by a logBuffer and the handlers derived
+// from it, and the clients following them
+type logRing struct {
+	mu          sync.Mutex
+	records     []protocol.LogRecord
+	subscribers map[chan protocol.LogRecord]slog.Level // Least severe level each wants
+
+	// followLevel is the least severe level any subscriber wants, or
+	// noFollowers, read without the lock by Enabled
+	followLevel atomic.Int64
+}
+
+// noFollowers is followLevel when nobody follows the log
+const noFollowers = math.MaxInt64
+
+// newLogBuffer wraps next in a logBuffer
+func newLogBuffer(next slog.Handler) *logBuffer {
+	ring := &logRing{subscribers: make(map[chan protocol.LogRecord]slog.Level)}
+	ring.followLevel.Store(noFollowers)
+	return &logBuffer{next: next, ring: ring}
+}
+
+// Enabled reports whether next writes records at level, or a client
+// following the log wants them
+func (h *logBuffer) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level) || int64(level) >= h.ring.followLevel.Load()
+}
+
+func (h *logBuffer) Handle(ctx context.Context, r slog.Record) error {
+	record := protocol.LogRecord{
+		Time:    r.Time.Format(time.RFC3339Nano),
+		Level:   r.Level.String(),
+		Message: r.Message,
+		Attrs:   slices.Clone(h.attrs),
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		record.Attrs = appendLogAttr(record.Attrs, h.group, a)
+		return true
+	})
+
+	written := h.next.Enabled(ctx, r.Level)
+	h.ring.add(record, r.Level, written)
+	if written {
+		return h.next.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *logBuffer) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derived := *h
+	derived.next = h.next.WithAttrs(attrs)
+	derived.attrs = slices.Clone(h.attrs)
+	for _, a := range attrs {
+		derived.attrs = appendLogAttr(derived.attrs, h.group, a)
+	}
+	return &derived
+}
+
+func (h *logBuffer) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	derived := *h
+	derived.next = h.next.WithGroup(name)
+	derived.group = h.group + name + "."
+	return &derived
+}
+
+// appendLogAttr appends a, with its key prefixed, flattening groups
+func appendLogAttr(attrs []protocol.LogAttr, prefix string, a slog.Attr) []protocol.LogAttr {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return attrs
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, member := range a.Value.Group() {
+			attrs = appendLogAttr(attrs, prefix, member)
+		}
+		return attrs
+	}
+	return append(attrs, protocol.LogAttr{Key: prefix + a.Key, Value: a.Value.String()})
+}
+
+// add hands record, at level, to the clients following the log that want
+// it, and keeps it if it's written, dropping the oldest beyond
+// logBufferSize
+func (r *logRing) add(record protocol.LogRecord, level slog.Level, written bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if written {
+		r.records = append(r.records, record)
+		if len(r.records) > logBufferSize {
+			r.records = slices.Delete(r.records, 0, len(r.records)-logBufferSize)
+		}
+	}
+	for ch, least := range r.subscribers {
+		if level < least {
+			continue
+		}
+		select {
+		case ch <- record:
+		default:
+		}
+	}
+}
+
+// updateFollowLevel sets followLevel from the subscribers; r.mu is held
+func (r *logRing) updateFollowLevel() {
+	least := int64(noFollowers)
+	for _, level := range r.subscribers {
+		least = min(least, int64(level))
+	}
+	r.followLevel.Store(least)
+}
+
+// recent returns the records kept, oldest first
+func (h *logBuffer) recent() []protocol.LogRecord {
+	h.ring.mu.Lock()
+	defer h.ring.mu.Unlock()
+	return slices.Clone(h.ring.records)
+}
+
+// subscribe returns the records kept and a channel of those at level or
+// above that follow, with none lost or repeated in between. cancel stops
+// the channel.
+func (h *logBuffer) subscribe(level slog.Level) (recent []protocol.LogRecord, records <-chan protocol.LogRecord, cancel func()) {
+	h.ring.mu.Lock()
+	defer h.ring.mu.Unlock()
+
+	ch := make(chan protocol.LogRecord, logSubscriberBuffer)
+	h.ring.subscribers[ch] = level
+	h.ring.updateFollowLevel()
+	cancel = func() {
+		h.ring.mu.Lock()
+		defer h.ring.mu.Unlock()
+		delete(h.ring.subscribers, ch)
+		h.ring.updateFollowLevel()
+	}
+	return slices.Clone(h.ring.records), ch, cancel
+}
@@ -0,0 +1,134 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+func newTestLogBuffer(level slog.Level) (*logBuffer, *slog.Logger) {
+	logs := newLogBuffer(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: level}))
+	return logs, slog.New(logs)
+}
+
+func TestLogBufferKeepsWrittenRecords(t *testing.T) {
+	logs, logger := newTestLogBuffer(slog.LevelInfo)
+
+	if logs.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("Enabled(debug) = true at info level with nobody following")
+	}
+	logger.Debug("hidden")
+	logger.With("conn", "devbox").WithGroup("fwd").Info("kept", "port", 3000)
+
+	recent := logs.recent()
+	if len(recent) != 1 || recent[0].Message != "kept" {
+		t.Fatalf("recent() = %+v, want only the info record", recent)
+	}
+	attrs := fmt.Sprint(recent[0].Attrs)
+	if attrs != "[{conn devbox} {fwd.port 3000}]" {
+		t.Errorf("attrs = %s, want conn and fwd.port", attrs)
+	}
+
+	for i := range logBufferSize + 5 {
+		logger.Info("record", "i", i)
+	}
+	recent = logs.recent()
+	if len(recent) != logBufferSize {
+		t.Fatalf("recent() has %d records, want %d", len(recent), logBufferSize)
+	}
+	if first := recent[0].Attrs[0].Value; first != "5" {
+		t.Errorf("oldest record kept is i=%s, want i=5", first)
+	}
+}
+
+func TestLogBufferFollow(t *testing.T) {
+	logs, logger := newTestLogBuffer(slog.LevelInfo)
+	logger.Info("before")
+
+	recent, records, cancel := logs.subscribe(slog.LevelDebug)
+	if len(recent) != 1 || recent[0].Message != "before" {
+		t.Errorf("subscribe() recent = %+v, want the record before", recent)
+	}
+	if !logs.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("Enabled(debug) = false while a client follows at debug")
+	}
+
+	logger.Debug("followed")
+	select {
+	case record := <-records:
+		if record.Message != "followed" || record.Level != "DEBUG" {
+			t.Errorf("followed record = %+v, want the debug one", record)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("debug record wasn't sent to the follower")
+	}
+	// Followers get records below the level the daemon writes at, but
+	// they aren't kept
+	if n := len(logs.recent()); n != 1 {
+		t.Errorf("recent() has %d records, want the debug one left out", n)
+	}
+
+	cancel()
+	if logs.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("Enabled(debug) = true once the follower left")
+	}
+}
+
+func TestHandleLogsCommandFollow(t *testing.T) {
+	logs, logger := newTestLogBuffer(slog.LevelInfo)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := &Daemon{ctx: ctx, logs: logs, logger: logger}
+	logger.Info("before")
+
+	payload, _ := json.Marshal(protocol.LogsRequest{Level: "debug", Follow: true})
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.handleLogsCommand(server, &protocol.Request{ID: "1", Type: protocol.CommandLogs, Payload: payload})
+	}()
+
+	reader := bufio.NewReader(client)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	resp, err := protocol.ParseResponse(line)
+	if err != nil || !resp.Success {
+		t.Fatalf("response = %s, %v", line, err)
+	}
+	var logsResp protocol.LogsResponse
+	if err := json.Unmarshal(resp.Data, &logsResp); err != nil || len(logsResp.Records) != 1 {
+		t.Fatalf("response records = %+v, %v, want the record before", logsResp.Records, err)
+	}
+
+	logger.Debug("after")
+	line, err = reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("reading followed record: %v", err)
+	}
+	var record protocol.LogRecord
+	if err := json.Unmarshal(line, &record); err != nil || record.Message != "after" {
+		t.Errorf("followed record = %s, %v, want the debug record after", line, err)
+	}
+
+	// Disconnecting stops following
+	_ = client.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handleLogsCommand kept following after the client left")
+	}
+	if logs.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("Enabled(debug) = true after the follower left")
+	}
+}
@@ -7,13 +7,45 @@ import (
 	"log/slog"
 	"net"
 	"os"
+	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/phinze/bankshot/pkg/config"
 	"github.com/phinze/bankshot/pkg/monitor"
+	"github.com/phinze/bankshot/pkg/process"
 	"github.com/phinze/bankshot/pkg/protocol"
 )
 
+// orphanCleanupInterval is how often the monitor checks for forwards left
+// behind by wrap processes that exited without unforwarding
+const orphanCleanupInterval = 30 * time.Second
+
+// wakeCheckInterval is how often the monitor checks whether the host slept,
+// and wakeThreshold how much lost time counts as having slept
+const (
+	wakeCheckInterval = 5 * time.Second
+	wakeThreshold     = 30 * time.Second
+)
+
+// kubePollInterval is how often Kubernetes Services are listed by default
+const kubePollInterval = 10 * time.Second
+
+// reconcileWorkers bounds how many forward and unforward requests a
+// reconciliation has in flight at once
+const reconcileWorkers = 8
+
+// Actions a reconciliation takes, as reported in protocol.ReconcileAction
+const (
+	reconcileForward   = "forward"
+	reconcileUnforward = "unforward"
+)
+
+// ReconcileProgress is called as each request of a reconciliation finishes,
+// with how many of the total are done
+type ReconcileProgress func(action protocol.ReconcileAction, done, total int)
+
 // Monitor is the remote-side service that monitors ports and requests forwards
 type Monitor struct {
 	logger          *slog.Logger
@@ -23,29 +55,28 @@ type Monitor struct {
 	sessionMonitor  *monitor.SessionMonitor
 	config          *config.Config
 	socketReachable bool
+	eventTap        *monitor.EventTap // nil unless monitor.eventSocket or monitor.hooks is set
+	startTime       time.Time
+	sourceKind      string         // Port event source in use
+	sessionID       string         // This host's name, which the daemon knows its forwards by
+	logLevel        *slog.LevelVar // Level the logger writes at, set from log_level; nil when --log-level pins it
+
+	// configMu guards the port and process rules in config.Monitor, which
+	// applyConfig replaces as the config file changes
+	configMu sync.RWMutex
+
+	// wrapProcesses are the wrap processes seen owning forwards, as first
+	// seen, so one whose PID is reused still counts as exited
+	wrapProcessesMu sync.Mutex
+	wrapProcesses   map[int]process.Handle
+
+	reconcileMu        sync.Mutex
+	lastReconcile      time.Time // When Reconcile last finished (zero = never)
+	lastReconcileError error
 }
 
 // NewMonitor creates a new monitor instance
 func NewMonitor(cfg Config) (*Monitor, error) {
-	// Set up logger
-	var logLevel slog.Level
-	switch cfg.LogLevel {
-	case "debug":
-		logLevel = slog.LevelDebug
-	case "info":
-		logLevel = slog.LevelInfo
-	case "warn":
-		logLevel = slog.LevelWarn
-	case "error":
-		logLevel = slog.LevelError
-	default:
-		logLevel = slog.LevelInfo
-	}
-
-	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-		Level: logLevel,
-	}))
-
 	// Load bankshot config for monitor settings
 	bankshotConfig, err := config.Load("")
 	if err != nil {
@@ -57,17 +88,60 @@ func NewMonitor(cfg Config) (*Monitor, error) {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
-	return &Monitor{
+	// Set up logger, at the config's log level unless one was given, in
+	// which case config changes leave it be
+	logLevel := new(slog.LevelVar)
+	liveLevel := logLevel
+	switch cfg.LogLevel {
+	case "":
+		logLevel.Set(bankshotConfig.Level())
+	case "debug":
+		logLevel.Set(slog.LevelDebug)
+	case "warn":
+		logLevel.Set(slog.LevelWarn)
+	case "error":
+		logLevel.Set(slog.LevelError)
+	}
+	if cfg.LogLevel != "" {
+		liveLevel = nil
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: logLevel,
+	}))
+	bankshotConfig.LogWarnings(logger)
+
+	d := &Monitor{
 		logger:      logger,
 		systemdMode: cfg.SystemdMode,
 		pidFile:     cfg.PIDFile,
 		config:      bankshotConfig,
-	}, nil
+		logLevel:    liveLevel,
+	}
+	// Set up before anything sends requests, so every one of them is seen
+	if bankshotConfig.Monitor.EventSocket != "" || len(bankshotConfig.Monitor.Hooks) > 0 {
+		d.eventTap = monitor.NewEventTap(logger)
+	}
+	return d, nil
+}
+
+// daemonClient returns a client for the laptop daemon, which reports the
+// forwards it makes and removes to the event tap when the monitor runs one
+func (d *Monitor) daemonClient() monitor.DaemonClient {
+	var client monitor.DaemonClient = &localDaemonClient{
+		address: protocol.DaemonAddress(d.config.Address, d.config.ProxyCommand),
+		logger:  d.logger,
+	}
+	if d.eventTap != nil {
+		client = d.eventTap.Wrap(client)
+	}
+	return client
 }
 
 // Start runs the monitor with port monitoring
 func (d *Monitor) Start(ctx context.Context) error {
 	d.ctx = ctx
+	d.startTime = time.Now()
 	d.logger.Info("Starting monitor with port monitoring")
 
 	// Write PID file if requested
@@ -79,9 +153,26 @@ func (d *Monitor) Start(ctx context.Context) error {
 	}
 
 	// Create daemon client for sending forward requests
-	daemonClient := &localDaemonClient{
-		socketPath: d.config.Address,
-		logger:     d.logger,
+	daemonClient := d.daemonClient()
+
+	// Stream the forwards the monitor makes to tooling on this host, and
+	// run hooks as they change
+	if path := d.config.Monitor.EventSocketPath(); path != "" {
+		listener, err := listenUnixSocket(path)
+		if err != nil {
+			return fmt.Errorf("failed to listen on event socket: %w", err)
+		}
+		defer func() {
+			_ = os.RemoveAll(path)
+		}()
+		go d.eventTap.Serve(ctx, listener)
+		d.logger.Info("Event tap listening", "path", path)
+	}
+	if len(d.config.Monitor.Hooks) > 0 {
+		hooks := monitor.NewHooks(d.config.Monitor.Hooks, d.logger)
+		d.eventTap.OnChange(hooks.Notify)
+		go hooks.Run(ctx)
+		d.logger.Info("Running hooks on forward changes", "count", len(d.config.Monitor.Hooks))
 	}
 
 	// Generate session ID based on hostname (for SSH connection matching)
@@ -90,24 +181,15 @@ func (d *Monitor) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to get hostname: %w", err)
 	}
 	sessionID := hostname
+	d.sessionID = sessionID
 
 	// Parse monitor config from main config
-	var portRanges []monitor.PortRange // nil = forward all non-privileged ports (>= 1024)
-	ignorePorts := d.config.Monitor.IgnorePorts
-	ignoreProcesses := []string{"sshd", "systemd", "ssh-agent", "/\\.test$/"}
+	filters := d.filters()
 	pollInterval := 5 * time.Second // Default to 5s for reasonable CPU usage
 	gracePeriod := 30 * time.Second
+	settleTime := 2 * time.Second
 
 	// Override with config if present
-	if len(d.config.Monitor.PortRanges) > 0 {
-		portRanges = make([]monitor.PortRange, len(d.config.Monitor.PortRanges))
-		for i, pr := range d.config.Monitor.PortRanges {
-			portRanges[i] = monitor.PortRange{Start: pr.Start, End: pr.End}
-		}
-	}
-	if len(d.config.Monitor.IgnoreProcesses) > 0 {
-		ignoreProcesses = d.config.Monitor.IgnoreProcesses
-	}
 	if d.config.Monitor.PollInterval != "" {
 		if duration, err := time.ParseDuration(d.config.Monitor.PollInterval); err == nil {
 			pollInterval = duration
@@ -118,30 +200,91 @@ func (d *Monitor) Start(ctx context.Context) error {
 			gracePeriod = duration
 		}
 	}
+	if d.config.Monitor.SettleTime != "" {
+		if duration, err := time.ParseDuration(d.config.Monitor.SettleTime); err == nil {
+			settleTime = duration
+		}
+	}
 
-	// Create port event source (eBPF on Linux if available, else polling)
-	portSource := monitor.NewSystemPortEventSource(d.logger, pollInterval)
+	// Create port event source (eBPF on Linux if available, else polling,
+	// unless monitor.source picks one)
+	sourceOpts := monitor.SourceOptions{
+		Source:      d.config.Monitor.Source,
+		UDP:         d.config.Monitor.UDP,
+		Namespaces:  d.config.Monitor.Namespaces,
+		EventBuffer: d.config.Monitor.EventBuffer,
+	}
+	if d.config.Monitor.Debounce != "" {
+		if duration, err := time.ParseDuration(d.config.Monitor.Debounce); err == nil {
+			sourceOpts.Debounce = duration
+		}
+	}
+	portSource, sourceKind, err := monitor.NewSystemPortEventSource(d.logger, pollInterval, sourceOpts)
+	if err != nil {
+		return fmt.Errorf("failed to create port event source: %w", err)
+	}
+	d.logger.Info("Port event source selected", "source", sourceKind)
+	d.sourceKind = sourceKind
+
+	// Watch for Unix sockets to forward, when any are configured
+	var socketRules []monitor.SocketRule
+	var socketSource monitor.SocketEventSource
+	for _, rule := range d.config.Monitor.Sockets {
+		socketRules = append(socketRules, monitor.SocketRule{
+			Pattern:     rule.Pattern,
+			LocalSocket: rule.LocalSocket,
+			LocalPort:   rule.LocalPort,
+		})
+	}
+	if len(socketRules) > 0 {
+		socketSource = monitor.NewSocketMonitor(d.logger, pollInterval, socketRules)
+	}
 
 	// Create and start session monitor
 	sessionMonitor, err := monitor.NewSessionMonitor(monitor.SessionConfig{
-		SessionID:       sessionID,
-		DaemonClient:    daemonClient,
-		PortRanges:      portRanges,
-		IgnorePorts:     ignorePorts,
-		IgnoreProcesses: ignoreProcesses,
-		GracePeriod:     gracePeriod,
-		Logger:          d.logger,
-		PortEventSource: portSource,
+		SessionID:             sessionID,
+		DaemonClient:          daemonClient,
+		PortRanges:            filters.PortRanges,
+		IgnorePorts:           filters.IgnorePorts,
+		IgnoreProcesses:       filters.IgnoreProcesses,
+		AllowProcesses:        filters.AllowProcesses,
+		NeverForwardProcesses: filters.NeverForwardProcesses,
+		GracePeriod:           gracePeriod,
+		SettleTime:            settleTime,
+		DetectProtocols:       d.config.Monitor.DetectProtocols,
+		Logger:                d.logger,
+		PortEventSource:       portSource,
+		SocketRules:           socketRules,
+		SocketEventSource:     socketSource,
+		StateFile:             d.config.Monitor.StateFile,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create session monitor: %w", err)
 	}
 	d.sessionMonitor = sessionMonitor
+	if d.eventTap != nil {
+		d.eventTap.WithMetrics(sessionMonitor.Metrics).WithSource(d.sourceKind)
+	}
+
+	// Answer bankshot status --remote; the monitor works without it
+	if path := d.config.Monitor.ControlSocket; path != "" {
+		listener, err := listenUnixSocket(path)
+		if err != nil {
+			d.logger.Warn("Failed to listen on control socket", "path", path, "error", err)
+		} else {
+			defer func() {
+				_ = os.RemoveAll(path)
+			}()
+			go d.serveControl(ctx, listener)
+			d.logger.Info("Control socket listening", "path", path)
+		}
+	}
 
 	// Notify systemd we're ready
 	if d.systemdMode {
 		d.notifySystemd("READY=1")
-		d.notifySystemd("STATUS=Monitor monitoring ports")
+		// bankshot status reads the source back from the unit's status
+		d.notifySystemd(fmt.Sprintf("STATUS=Monitor monitoring ports (source: %s)", sourceKind))
 
 		// Start watchdog if configured
 		go d.watchdogLoop()
@@ -157,8 +300,34 @@ func (d *Monitor) Start(ctx context.Context) error {
 		}
 	}()
 
+	// Apply changes to the port and process rules, and the log level, as
+	// the config file is edited
+	watchConfig(monitorCtx, d.config, d.logger, d.applyConfig)
+
+	// Forward annotated Services of a local development cluster
+	if kube := d.config.Monitor.Kubernetes; kube.Enabled {
+		interval := kubePollInterval
+		if duration, err := time.ParseDuration(kube.PollInterval); err == nil {
+			interval = duration
+		}
+		watcher := monitor.NewKubeWatcher(monitor.KubeConfig{
+			SessionID:    sessionID,
+			DaemonClient: daemonClient,
+			Kubectl:      kube.Kubectl,
+			Context:      kube.Context,
+			Annotation:   kube.Annotation,
+			PollInterval: interval,
+			Logger:       d.logger,
+		})
+		go watcher.Run(monitorCtx)
+	}
+
 	// Start socket connectivity monitor for sleep/wake recovery
 	go d.socketConnectivityLoop(monitorCtx, daemonClient)
+	go d.wakeDetectionLoop(monitorCtx)
+
+	// Clean up after wrap processes that exited without unforwarding
+	go d.orphanCleanupLoop(monitorCtx, daemonClient, sessionID)
 
 	// Wait for shutdown signal
 	<-ctx.Done()
@@ -173,15 +342,29 @@ func (d *Monitor) Start(ctx context.Context) error {
 	return nil
 }
 
+// listenUnixSocket listens on a Unix socket at path, replacing any left
+// behind, with access limited to the user
+func listenUnixSocket(path string) (net.Listener, error) {
+	oldUmask := umask(0077)
+	defer umask(oldUmask)
+
+	if err := os.RemoveAll(path); err != nil {
+		return nil, fmt.Errorf("failed to remove existing socket: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	return net.Listen("unix", path)
+}
+
 // localDaemonClient implements DaemonClient for sending requests to local daemon
 type localDaemonClient struct {
-	socketPath string
-	logger     *slog.Logger
+	address string // As protocol.Dial takes it, so proxy_command is honored
+	logger  *slog.Logger
 }
 
 func (c *localDaemonClient) SendRequest(req *protocol.Request) (*protocol.Response, error) {
-	// Connect to daemon socket
-	conn, err := net.Dial("unix", c.socketPath)
+	conn, err := protocol.Dial(c.address, 0)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to daemon: %w", err)
 	}
@@ -259,7 +442,7 @@ func (d *Monitor) watchdogLoop() {
 // socketConnectivityLoop periodically probes the daemon socket to detect
 // SSH reconnection after sleep/wake. On unreachable → reachable transition,
 // it triggers reconciliation to re-establish port forwards.
-func (d *Monitor) socketConnectivityLoop(ctx context.Context, client *localDaemonClient) {
+func (d *Monitor) socketConnectivityLoop(ctx context.Context, client monitor.DaemonClient) {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
@@ -278,7 +461,7 @@ func (d *Monitor) socketConnectivityLoop(ctx context.Context, client *localDaemo
 
 			if reachable && !d.socketReachable {
 				d.logger.Info("Daemon socket became reachable, triggering reconciliation")
-				if err := d.Reconcile(); err != nil {
+				if _, err := d.Reconcile(nil); err != nil {
 					d.logger.Error("Reconciliation after reconnect failed", "error", err)
 				}
 			} else if !reachable && d.socketReachable {
@@ -290,6 +473,162 @@ func (d *Monitor) socketConnectivityLoop(ctx context.Context, client *localDaemo
 	}
 }
 
+// wakeDetectionLoop watches for the host waking from sleep, when ports may
+// have opened or closed unseen and the laptop daemon may have lost its
+// forwards, and rescans listening ports and reconciles right away rather than
+// waiting on socketConnectivityLoop to notice the SSH connection came back
+func (d *Monitor) wakeDetectionLoop(ctx context.Context) {
+	ticker := time.NewTicker(wakeCheckInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			gap, slept := sleptBetween(last, now, wakeCheckInterval)
+			last = now
+			if !slept {
+				continue
+			}
+
+			d.logger.Info("Detected wake from sleep, resyncing ports and forwards", "gap", gap.Round(time.Second))
+			d.sessionMonitor.Rescan()
+			if _, err := d.Reconcile(nil); err != nil {
+				d.logger.Error("Reconciliation after wake failed", "error", err)
+			}
+		}
+	}
+}
+
+// sleptBetween reports whether the host likely slept between two checks
+// interval apart, and for how long. The monotonic clock stops during suspend
+// on Linux but not on macOS, so the wall clock running ahead of it counts as
+// lost time as well as the monotonic clock running late.
+func sleptBetween(last, now time.Time, interval time.Duration) (time.Duration, bool) {
+	mono := now.Sub(last)
+	wall := now.Round(0).Sub(last.Round(0))
+	gap := max(mono-interval, wall-mono)
+	return gap, gap > wakeThreshold
+}
+
+// orphanCleanupLoop periodically removes forwards whose owning wrap process
+// on this host has exited, and catches the event tap up on forwards made
+// and removed around the monitor
+func (d *Monitor) orphanCleanupLoop(ctx context.Context, client monitor.DaemonClient, sessionID string) {
+	ticker := time.NewTicker(orphanCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			listedAt := time.Now()
+			resp, err := client.SendRequest(&protocol.Request{
+				ID:   "orphan-check-" + fmt.Sprintf("%d", time.Now().Unix()),
+				Type: protocol.CommandList,
+			})
+			if err != nil || !resp.Success {
+				continue
+			}
+			var list protocol.ListResponse
+			if err := json.Unmarshal(resp.Data, &list); err != nil {
+				continue
+			}
+			if d.eventTap != nil {
+				d.eventTap.Sync(sessionID, list.Forwards, listedAt)
+			}
+			d.cleanupOrphans(client, sessionID, list.Forwards)
+		}
+	}
+}
+
+// cleanupOrphans unforwards this session's forwards owned by wrap processes
+// that are no longer running, e.g. because they crashed before unforwarding.
+// Returns the remote ports it removed.
+func (d *Monitor) cleanupOrphans(client monitor.DaemonClient, sessionID string, forwards []protocol.ForwardInfo) map[int]bool {
+	running := d.runningWrapProcesses(sessionID, forwards)
+
+	removed := make(map[int]bool)
+	for _, fwd := range forwards {
+		if fwd.ConnectionInfo != sessionID {
+			continue
+		}
+		pid, ok := protocol.ParseWrapOwner(fwd.Owner)
+		if !ok || running[pid] {
+			continue
+		}
+
+		d.logger.Info("Removing forward of exited wrap process",
+			"port", fwd.RemotePort,
+			"remoteSocket", fwd.RemoteSocket,
+			"owner", fwd.Owner)
+
+		payload, err := json.Marshal(protocol.UnforwardRequest{
+			RemotePort:     fwd.RemotePort,
+			Host:           fwd.Host,
+			RemoteSocket:   fwd.RemoteSocket,
+			ConnectionInfo: fwd.ConnectionInfo,
+			SocketPath:     fwd.SocketPath,
+		})
+		if err != nil {
+			continue
+		}
+		resp, err := client.SendRequest(&protocol.Request{
+			ID:      "orphan-unfwd-" + fmt.Sprintf("%d-%d", fwd.RemotePort, time.Now().Unix()),
+			Type:    protocol.CommandUnforward,
+			Payload: payload,
+		})
+		if err != nil {
+			d.logger.Warn("Failed to request unforward", "port", fwd.RemotePort, "error", err)
+			continue
+		}
+		if !resp.Success {
+			d.logger.Warn("Unforward request failed", "port", fwd.RemotePort, "error", resp.Error)
+			continue
+		}
+		if fwd.RemoteSocket == "" {
+			removed[fwd.RemotePort] = true
+		}
+	}
+	return removed
+}
+
+// runningWrapProcesses reports which of the wrap processes owning this
+// session's forwards are still running. Each is followed from when it was
+// first seen, so a process that later takes over the PID of one that exited
+// doesn't keep its forwards alive.
+func (d *Monitor) runningWrapProcesses(sessionID string, forwards []protocol.ForwardInfo) map[int]bool {
+	d.wrapProcessesMu.Lock()
+	defer d.wrapProcessesMu.Unlock()
+
+	seen := make(map[int]process.Handle)
+	running := make(map[int]bool)
+	for _, fwd := range forwards {
+		pid, ok := protocol.ParseWrapOwner(fwd.Owner)
+		if !ok || fwd.ConnectionInfo != sessionID {
+			continue
+		}
+		if _, checked := seen[pid]; checked {
+			continue
+		}
+		proc, known := d.wrapProcesses[pid]
+		if !known {
+			// The zero Handle, for one already gone, is never running
+			proc, _ = process.Find(pid)
+		}
+		seen[pid] = proc
+		running[pid] = proc.Running()
+	}
+
+	// Forget processes whose forwards are gone
+	d.wrapProcesses = seen
+	return running
+}
+
 // writePIDFile writes the current process ID to a file
 func (d *Monitor) writePIDFile() error {
 	if d.pidFile == "" {
@@ -318,22 +657,65 @@ func (d *Monitor) removePIDFile() {
 	}
 }
 
+// defaultIgnoreProcesses are ignored when the config doesn't list any
+var defaultIgnoreProcesses = []string{"sshd", "systemd", "ssh-agent", "/\\.test$/"}
+
+// ignoreProcesses returns the configured process ignore rules, or the
+// defaults
+func (d *Monitor) ignoreProcesses() []string {
+	if len(d.config.Monitor.IgnoreProcesses) > 0 {
+		return d.config.Monitor.IgnoreProcesses
+	}
+	return defaultIgnoreProcesses
+}
+
+// monitorPortRanges converts configured port ranges, with their health
+// checks and overrides, for the session monitor
+func monitorPortRanges(ranges []config.PortRange) []monitor.PortRange {
+	portRanges := make([]monitor.PortRange, len(ranges))
+	for i, pr := range ranges {
+		portRanges[i] = monitor.PortRange{
+			Start:         pr.Start,
+			End:           pr.End,
+			NoAutoForward: pr.AutoForward != nil && !*pr.AutoForward,
+		}
+		if d, err := time.ParseDuration(pr.GracePeriod); err == nil {
+			portRanges[i].GracePeriod = &d
+		}
+		if d, err := time.ParseDuration(pr.PollInterval); err == nil {
+			portRanges[i].PollInterval = d
+		}
+		if pr.HealthCheck != nil {
+			check := &monitor.HealthCheck{Type: pr.HealthCheck.Type, Path: pr.HealthCheck.Path}
+			if d, err := time.ParseDuration(pr.HealthCheck.Timeout); err == nil {
+				check.Timeout = d
+			}
+			portRanges[i].HealthCheck = check
+		}
+	}
+	return portRanges
+}
+
 // Reconcile performs VM-side reconciliation of port forwards
 // It queries the laptop daemon for existing forwards and compares with actual
 // listening ports on the VM, then sends forward/unforward requests to converge.
-func (d *Monitor) Reconcile() error {
+// The requests run concurrently; progress, if set, is called as each one
+// finishes. Returns a report of what was forwarded, unforwarded, and failed.
+func (d *Monitor) Reconcile(progress ReconcileProgress) (report *protocol.ReconcileReport, err error) {
 	d.logger.Info("Starting VM-side reconciliation")
+	defer func() {
+		d.reconcileMu.Lock()
+		defer d.reconcileMu.Unlock()
+		d.lastReconcile = time.Now()
+		d.lastReconcileError = err
+	}()
 
-	// Create daemon client
-	daemonClient := &localDaemonClient{
-		socketPath: d.config.Address,
-		logger:     d.logger,
-	}
+	daemonClient := d.daemonClient()
 
 	// Get hostname for connection matching
 	hostname, err := os.Hostname()
 	if err != nil {
-		return fmt.Errorf("failed to get hostname: %w", err)
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
 	}
 	sessionID := hostname
 
@@ -343,27 +725,45 @@ func (d *Monitor) Reconcile() error {
 		Type: protocol.CommandList,
 	}
 
+	listedAt := time.Now()
 	listResp, err := daemonClient.SendRequest(listReq)
 	if err != nil {
-		return fmt.Errorf("failed to query daemon forwards: %w", err)
+		return nil, fmt.Errorf("failed to query daemon forwards: %w", err)
 	}
 
 	if !listResp.Success {
-		return fmt.Errorf("daemon returned error: %s", listResp.Error)
+		return nil, fmt.Errorf("daemon returned error: %s", listResp.Error)
 	}
 
 	// Parse forwards list
 	var listData protocol.ListResponse
 	if err := json.Unmarshal(listResp.Data, &listData); err != nil {
-		return fmt.Errorf("failed to parse forwards list: %w", err)
+		return nil, fmt.Errorf("failed to parse forwards list: %w", err)
 	}
 
 	d.logger.Debug("Retrieved forwards from daemon", "count", len(listData.Forwards))
+	if d.eventTap != nil {
+		d.eventTap.Sync(sessionID, listData.Forwards, listedAt)
+	}
 
-	// Filter to forwards matching our session/hostname
+	// Drop forwards left behind by wrap processes that are gone; ports
+	// still listening are picked up again below
+	orphaned := d.cleanupOrphans(daemonClient, sessionID, listData.Forwards)
+
+	// Filter to forwards matching our session/hostname. Only ports on
+	// this host's loopback are reconciled; socket forwards and forwards to
+	// other hosts (like Kubernetes nodes) aren't backed by a listener here.
 	daemonForwards := make(map[int]bool) // port -> exists
 	for _, fwd := range listData.Forwards {
-		if fwd.ConnectionInfo == sessionID {
+		if fwd.RemoteSocket != "" {
+			continue
+		}
+		switch protocol.NormalizeHost(fwd.Host) {
+		case "", "localhost", "127.0.0.1", "::1":
+		default:
+			continue
+		}
+		if fwd.ConnectionInfo == sessionID && !orphaned[fwd.RemotePort] {
 			daemonForwards[fwd.RemotePort] = true
 		}
 	}
@@ -373,19 +773,13 @@ func (d *Monitor) Reconcile() error {
 	// Get listening ports on VM
 	vmPorts, err := monitor.GetListeningPorts()
 	if err != nil {
-		return fmt.Errorf("failed to get VM listening ports: %w", err)
+		return nil, fmt.Errorf("failed to get VM listening ports: %w", err)
 	}
 
 	// Parse port ranges and ignore ports from config
-	var portRanges []monitor.PortRange
-	if len(d.config.Monitor.PortRanges) > 0 {
-		portRanges = make([]monitor.PortRange, len(d.config.Monitor.PortRanges))
-		for i, pr := range d.config.Monitor.PortRanges {
-			portRanges[i] = monitor.PortRange{Start: pr.Start, End: pr.End}
-		}
-	}
-	ignorePortsMap := make(map[int]bool, len(d.config.Monitor.IgnorePorts))
-	for _, p := range d.config.Monitor.IgnorePorts {
+	filters := d.filters()
+	ignorePortsMap := make(map[int]bool, len(filters.IgnorePorts))
+	for _, p := range filters.IgnorePorts {
 		ignorePortsMap[p] = true
 	}
 
@@ -395,12 +789,23 @@ func (d *Monitor) Reconcile() error {
 		allVMListening[port.Port] = true
 	}
 
+	// Process rules apply as they do for the session monitor, so an
+	// allowlist isn't undone by reconciling everything that's listening
+	filter := monitor.NewProcessFilter(filters.IgnoreProcesses, filters.AllowProcesses, d.logger).
+		WithNeverForward(filters.NeverForwardProcesses)
+	owners := monitor.SocketOwners()
+
 	// Build set of VM ports that should be auto-forwarded
 	vmListeningInRange := make(map[int]bool)
 	for _, port := range vmPorts {
-		if monitor.ShouldForwardPort(port.Port, port.BindAddr, portRanges, ignorePortsMap) {
-			vmListeningInRange[port.Port] = true
+		if !monitor.ShouldForwardPort(port.Port, port.BindAddr, filters.PortRanges, ignorePortsMap) {
+			continue
 		}
+		if !filter.Allows(owners[port.Inode]) {
+			d.logger.Debug("Port excluded by process rules", "port", port.Port)
+			continue
+		}
+		vmListeningInRange[port.Port] = true
 	}
 
 	d.logger.Debug("VM ports listening",
@@ -431,74 +836,129 @@ func (d *Monitor) Reconcile() error {
 		"toUnforward", len(toUnforward),
 		"unchanged", len(vmListeningInRange)-len(toForward))
 
-	// Execute forwards
+	// Send the requests concurrently; the daemon serializes the ssh work
+	// per connection, but busy VMs no longer wait on each round trip
+	tasks := make([]protocol.ReconcileAction, 0, len(toForward)+len(toUnforward))
 	for _, port := range toForward {
-		d.logger.Info("Requesting forward for VM port", "port", port)
-		fwdReq := &protocol.Request{
-			ID:   "reconcile-fwd-" + fmt.Sprintf("%d-%d", port, time.Now().Unix()),
-			Type: protocol.CommandForward,
+		tasks = append(tasks, protocol.ReconcileAction{Port: port, Action: reconcileForward})
+	}
+	for _, port := range toUnforward {
+		tasks = append(tasks, protocol.ReconcileAction{Port: port, Action: reconcileUnforward})
+	}
+
+	report = d.sendReconcileRequests(daemonClient, sessionID, tasks, progress)
+	report.Unchanged = len(vmListeningInRange) - len(toForward)
+
+	d.logger.Info("VM-side reconciliation complete",
+		"forwarded", len(report.Forwarded),
+		"unforwarded", len(report.Unforwarded),
+		"failed", len(report.Failed))
+
+	return report, nil
+}
+
+// sendReconcileRequests sends the requests for tasks, up to
+// reconcileWorkers at a time, calling progress as each finishes, and
+// returns their outcomes by port
+func (d *Monitor) sendReconcileRequests(client monitor.DaemonClient, sessionID string, tasks []protocol.ReconcileAction, progress ReconcileProgress) *protocol.ReconcileReport {
+	results := make([]protocol.ReconcileAction, len(tasks))
+	sem := make(chan struct{}, reconcileWorkers)
+	var wg sync.WaitGroup
+	var progressMu sync.Mutex
+	done := 0
+	for i, task := range tasks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = d.reconcilePort(client, sessionID, task)
+
+			progressMu.Lock()
+			done++
+			if progress != nil {
+				progress(results[i], done, len(tasks))
+			}
+			progressMu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	report := &protocol.ReconcileReport{
+		Forwarded:   []protocol.ReconcileAction{},
+		Unforwarded: []protocol.ReconcileAction{},
+		Failed:      []protocol.ReconcileAction{},
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Port < results[j].Port })
+	for _, result := range results {
+		switch {
+		case result.Error != "":
+			report.Failed = append(report.Failed, result)
+		case result.Action == reconcileForward:
+			report.Forwarded = append(report.Forwarded, result)
+		default:
+			report.Unforwarded = append(report.Unforwarded, result)
 		}
+	}
+	return report
+}
+
+// reconcilePort sends the forward or unforward request for one port of a
+// reconciliation and records the outcome on the returned action
+func (d *Monitor) reconcilePort(client monitor.DaemonClient, sessionID string, action protocol.ReconcileAction) protocol.ReconcileAction {
+	port := action.Port
+	req := &protocol.Request{
+		ID: fmt.Sprintf("reconcile-%s-%d-%d", action.Action, port, time.Now().Unix()),
+	}
 
-		payload, err := json.Marshal(protocol.ForwardRequest{
+	var payload []byte
+	var err error
+	if action.Action == reconcileForward {
+		d.logger.Info("Requesting forward for VM port", "port", port)
+		req.Type = protocol.CommandForward
+		payload, err = json.Marshal(protocol.ForwardRequest{
 			RemotePort:     port,
 			LocalPort:      port,
 			Host:           "localhost",
 			ConnectionInfo: sessionID,
+			Owner:          protocol.OwnerMonitor,
 		})
-		if err != nil {
-			d.logger.Warn("Failed to marshal forward request", "port", port, "error", err)
-			continue
-		}
-		fwdReq.Payload = payload
-
-		fwdResp, err := daemonClient.SendRequest(fwdReq)
-		if err != nil {
-			d.logger.Warn("Failed to request forward", "port", port, "error", err)
-			continue
-		}
-
-		if !fwdResp.Success {
-			d.logger.Warn("Forward request failed", "port", port, "error", fwdResp.Error)
-		} else {
-			d.logger.Info("Successfully requested forward", "port", port)
-		}
-	}
-
-	// Execute unforwards
-	for _, port := range toUnforward {
+	} else {
 		d.logger.Info("Requesting unforward for port", "port", port)
-		unfwdReq := &protocol.Request{
-			ID:   "reconcile-unfwd-" + fmt.Sprintf("%d-%d", port, time.Now().Unix()),
-			Type: protocol.CommandUnforward,
-		}
-
-		payload, err := json.Marshal(protocol.UnforwardRequest{
+		req.Type = protocol.CommandUnforward
+		payload, err = json.Marshal(protocol.UnforwardRequest{
 			RemotePort:     port,
 			Host:           "localhost",
 			ConnectionInfo: sessionID,
 		})
-		if err != nil {
-			d.logger.Warn("Failed to marshal unforward request", "port", port, "error", err)
-			continue
-		}
-		unfwdReq.Payload = payload
+	}
+	if err != nil {
+		d.logger.Warn("Failed to marshal request", "action", action.Action, "port", port, "error", err)
+		action.Error = err.Error()
+		return action
+	}
+	req.Payload = payload
 
-		unfwdResp, err := daemonClient.SendRequest(unfwdReq)
-		if err != nil {
-			d.logger.Warn("Failed to request unforward", "port", port, "error", err)
-			continue
-		}
+	resp, err := client.SendRequest(req)
+	if err != nil {
+		d.logger.Warn("Failed to send request", "action", action.Action, "port", port, "error", err)
+		action.Error = err.Error()
+		return action
+	}
+	if !resp.Success {
+		d.logger.Warn("Request failed", "action", action.Action, "port", port, "error", resp.Error)
+		action.Error = resp.Error
+		return action
+	}
 
-		if !unfwdResp.Success {
-			d.logger.Warn("Unforward request failed", "port", port, "error", unfwdResp.Error)
-		} else {
-			d.logger.Info("Successfully requested unforward", "port", port)
+	if action.Action == reconcileForward {
+		var fwdResp protocol.ForwardResponse
+		if err := json.Unmarshal(resp.Data, &fwdResp); err == nil {
+			action.LocalPort = fwdResp.LocalPort
+			action.Queued = fwdResp.Queued
 		}
 	}
-
-	d.logger.Info("VM-side reconciliation complete",
-		"forwarded", len(toForward),
-		"unforwarded", len(toUnforward))
-
-	return nil
+	d.logger.Info("Successfully requested "+action.Action, "port", port)
+	return action
 }
@@ -0,0 +1,182 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/process"
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+// fakeDaemon answers every request on a Unix socket with success, and
+// records the unforward requests it gets
+type fakeDaemon struct {
+	mu         sync.Mutex
+	unforwards []protocol.UnforwardRequest
+}
+
+func startFakeDaemon(t *testing.T) (*fakeDaemon, *localDaemonClient) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bankshot.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	d := &fakeDaemon{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			var req protocol.Request
+			if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err == nil {
+				if req.Type == protocol.CommandUnforward {
+					var unfwd protocol.UnforwardRequest
+					_ = json.Unmarshal(req.Payload, &unfwd)
+					d.mu.Lock()
+					d.unforwards = append(d.unforwards, unfwd)
+					d.mu.Unlock()
+				}
+				_ = json.NewEncoder(conn).Encode(protocol.Response{ID: req.ID, Success: true})
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return d, &localDaemonClient{address: path, logger: logger}
+}
+
+// exitedPID returns the PID of a process that has already exited
+func exitedPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("failed to run child: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestCleanupOrphans(t *testing.T) {
+	fake, client := startFakeDaemon(t)
+	d := &Monitor{logger: client.logger}
+
+	self := os.Getpid()
+	gone := exitedPID(t)
+	forwards := []protocol.ForwardInfo{
+		{RemotePort: 3000, ConnectionInfo: "devbox", Owner: protocol.WrapOwner(self)},
+		{RemotePort: 3001, ConnectionInfo: "devbox", Owner: protocol.WrapOwner(gone)},
+		{RemoteSocket: "/tmp/app.sock", ConnectionInfo: "devbox", Owner: protocol.WrapOwner(gone)},
+		{RemotePort: 3002, ConnectionInfo: "other", Owner: protocol.WrapOwner(gone)},
+		{RemotePort: 3003, ConnectionInfo: "devbox", Owner: protocol.OwnerCLI},
+	}
+
+	removed := d.cleanupOrphans(client, "devbox", forwards)
+	if len(removed) != 1 || !removed[3001] {
+		t.Errorf("cleanupOrphans() removed ports %v, want only 3001", removed)
+	}
+	fake.mu.Lock()
+	if len(fake.unforwards) != 2 {
+		t.Errorf("unforward requests = %+v, want 3001 and /tmp/app.sock", fake.unforwards)
+	}
+	fake.unforwards = nil
+	fake.mu.Unlock()
+
+	// A process that has since taken over the PID of the one first seen
+	// owning a forward doesn't keep it alive
+	proc, ok := process.Find(self)
+	if !ok || proc.Start == 0 {
+		t.Skip("process start times aren't known here")
+	}
+	d.wrapProcesses = map[int]process.Handle{self: {PID: self, Start: proc.Start + 1}}
+	removed = d.cleanupOrphans(client, "devbox", forwards[:1])
+	if !removed[3000] {
+		t.Errorf("cleanupOrphans() removed ports %v, want 3000 whose PID was reused", removed)
+	}
+}
+
+// concurrentClient answers requests after a short wait, failing forwards of
+// port 3001 and answering forwards with a local port one above, and records
+// how many requests it had in flight at most
+type concurrentClient struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (c *concurrentClient) SendRequest(req *protocol.Request) (*protocol.Response, error) {
+	c.mu.Lock()
+	c.inFlight++
+	c.peak = max(c.peak, c.inFlight)
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	if req.Type != protocol.CommandForward {
+		return &protocol.Response{ID: req.ID, Success: true}, nil
+	}
+	var fwd protocol.ForwardRequest
+	if err := json.Unmarshal(req.Payload, &fwd); err != nil {
+		return nil, err
+	}
+	if fwd.RemotePort == 3001 {
+		return &protocol.Response{ID: req.ID, Error: "port in use"}, nil
+	}
+	data, _ := json.Marshal(protocol.ForwardResponse{LocalPort: fwd.RemotePort + 1})
+	return &protocol.Response{ID: req.ID, Success: true, Data: data}, nil
+}
+
+func TestSendReconcileRequests(t *testing.T) {
+	client := &concurrentClient{}
+	d := &Monitor{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	var tasks []protocol.ReconcileAction
+	for port := 3019; port >= 3000; port-- {
+		tasks = append(tasks, protocol.ReconcileAction{Port: port, Action: reconcileForward})
+	}
+	tasks = append(tasks, protocol.ReconcileAction{Port: 4000, Action: reconcileUnforward})
+
+	var dones []int
+	report := d.sendReconcileRequests(client, "devbox", tasks, func(action protocol.ReconcileAction, done, total int) {
+		if total != len(tasks) {
+			t.Errorf("progress total = %d, want %d", total, len(tasks))
+		}
+		dones = append(dones, done)
+	})
+
+	if len(dones) != len(tasks) || dones[0] != 1 || dones[len(dones)-1] != len(tasks) {
+		t.Errorf("progress done counts = %v, want 1 through %d", dones, len(tasks))
+	}
+	if client.peak < 2 || client.peak > reconcileWorkers {
+		t.Errorf("requests in flight peaked at %d, want between 2 and %d", client.peak, reconcileWorkers)
+	}
+
+	if len(report.Failed) != 1 || report.Failed[0].Port != 3001 || report.Failed[0].Error != "port in use" {
+		t.Errorf("Failed = %+v, want 3001's forward", report.Failed)
+	}
+	if len(report.Forwarded) != 19 || report.Forwarded[0].Port != 3000 || report.Forwarded[1].Port != 3002 {
+		t.Errorf("Forwarded = %+v, want the other 19 forwards by port", report.Forwarded)
+	}
+	if report.Forwarded[0].LocalPort != 3001 {
+		t.Errorf("Forwarded[0].LocalPort = %d, want the daemon's 3001", report.Forwarded[0].LocalPort)
+	}
+	if len(report.Unforwarded) != 1 || report.Unforwarded[0].Port != 4000 {
+		t.Errorf("Unforwarded = %+v, want 4000", report.Unforwarded)
+	}
+}
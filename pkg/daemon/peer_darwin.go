@@ -0,0 +1,31 @@
+//go:build darwin
+
+package daemon
+
+import (
+	"errors"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerPID returns the process on the other end of a unix socket
+// connection, from LOCAL_PEERPID
+func peerPID(conn net.Conn) (int, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, errors.New("not a unix socket")
+	}
+	rawConn, err := unixConn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var pid int
+	var pidErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		pid, pidErr = unix.GetsockoptInt(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERPID)
+	}); err != nil {
+		return 0, err
+	}
+	return pid, pidErr
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// peerPID is not supported on this platform
+func peerPID(conn net.Conn) (int, error) {
+	return 0, fmt.Errorf("finding a socket's peer is not supported on %s", runtime.GOOS)
+}
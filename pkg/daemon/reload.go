@@ -0,0 +1,179 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/phinze/bankshot/pkg/config"
+	"github.com/phinze/bankshot/pkg/monitor"
+	"github.com/phinze/bankshot/pkg/opener"
+	"github.com/phinze/bankshot/pkg/opproxy"
+)
+
+// monitorFilterSettings are the monitor settings applied as the config file
+// changes; the monitor's other settings take a restart
+var monitorFilterSettings = []string{
+	"monitor.portRanges",
+	"monitor.ignorePorts",
+	"monitor.ignoreProcesses",
+	"monitor.allowProcesses",
+	"monitor.neverForwardProcesses",
+}
+
+// watchConfig applies changes to the config file cfg was loaded from, or
+// the default one, until ctx is done
+func watchConfig(ctx context.Context, cfg *config.Config, logger *slog.Logger, apply func(*config.Config)) {
+	path := cfg.Path
+	if path == "" {
+		var err error
+		if path, err = config.DefaultPath(); err != nil {
+			logger.Warn("Not watching config file", "error", err)
+			return
+		}
+	}
+	if err := config.Watch(ctx, path, logger, apply); err != nil {
+		logger.Warn("Not watching config file, changes take a restart", "path", path, "error", err)
+		return
+	}
+	logger.Debug("Watching config file", "path", path)
+}
+
+// logConfigChanges logs each change that concerns this process, by whether
+// live says it's applied now or takes a restart
+func logConfigChanges(logger *slog.Logger, changes []config.Change, concerns, live func(path string) bool) {
+	for _, change := range changes {
+		switch {
+		case !concerns(change.Path):
+		case live(change.Path):
+			logger.Info("Config changed", "setting", change.Path, "old", change.Old, "new", change.New)
+		default:
+			logger.Warn("Config changed, takes effect after a restart", "setting", change.Path, "old", change.Old, "new", change.New)
+		}
+	}
+}
+
+// SetLogLevel has the daemon set level, which its logger's handler writes
+// at, from log_level, now and as the config file changes. Without it the
+// level is left to the caller, as when --debug pins it.
+func (d *Daemon) SetLogLevel(level *slog.LevelVar) {
+	d.configMu.Lock()
+	defer d.configMu.Unlock()
+	d.logLevel = level
+	level.Set(d.config.Level())
+}
+
+// currentOpener returns the opener and its config, as last applied
+func (d *Daemon) currentOpener() (*opener.Opener, config.OpenerConfig) {
+	d.configMu.RLock()
+	defer d.configMu.RUnlock()
+	return d.opener, d.config.Opener
+}
+
+// currentClipboard returns the clipboard settings, as last applied
+func (d *Daemon) currentClipboard() config.ClipboardConfig {
+	d.configMu.RLock()
+	defer d.configMu.RUnlock()
+	return d.config.Clipboard
+}
+
+// currentOpProxy returns the 1Password proxy, as last applied
+func (d *Daemon) currentOpProxy() *opproxy.OpProxy {
+	d.configMu.RLock()
+	defer d.configMu.RUnlock()
+	return d.opProxy
+}
+
+// applyConfig applies the changes in next that the daemon can take while it
+// runs: the opener's and the 1Password proxy's rules, which URLs and vaults
+// are allowed, whether the clipboard may be read, and the log level. The
+// opener takes its new rules in place, so opens already made still count
+// toward its duplicate window and per-minute cap.
+func (d *Daemon) applyConfig(next *config.Config) {
+	d.configMu.Lock()
+	defer d.configMu.Unlock()
+
+	if d.logLevel == nil {
+		next.LogLevel = d.config.LogLevel
+	}
+	logConfigChanges(d.logger, config.Diff(d.config, next),
+		func(path string) bool { return !strings.HasPrefix(path, "monitor.") },
+		func(path string) bool {
+			return path == "log_level" || strings.HasPrefix(path, "opener.") || strings.HasPrefix(path, "op_proxy.") ||
+				strings.HasPrefix(path, "clipboard.")
+		})
+
+	if d.logLevel != nil && next.LogLevel != d.config.LogLevel {
+		d.config.LogLevel = next.LogLevel
+		d.logLevel.Set(next.Level())
+	}
+	if !reflect.DeepEqual(d.config.Opener, next.Opener) {
+		d.config.Opener = next.Opener
+		d.opener.Configure(&next.Opener)
+	}
+	d.config.Clipboard = next.Clipboard
+	if !reflect.DeepEqual(d.config.OpProxy, next.OpProxy) {
+		d.config.OpProxy = next.OpProxy
+		opProxyConfig := next.OpProxy
+		d.opProxy = opproxy.New(&opProxyConfig, d.logger)
+	}
+}
+
+// filters returns the monitor's port and process rules, as last applied
+func (d *Monitor) filters() monitor.Filters {
+	d.configMu.RLock()
+	defer d.configMu.RUnlock()
+
+	var portRanges []monitor.PortRange // nil = forward all non-privileged ports (>= 1024)
+	if len(d.config.Monitor.PortRanges) > 0 {
+		portRanges = monitorPortRanges(d.config.Monitor.PortRanges)
+	}
+	return monitor.Filters{
+		PortRanges:            portRanges,
+		IgnorePorts:           d.config.Monitor.IgnorePorts,
+		IgnoreProcesses:       d.ignoreProcesses(),
+		AllowProcesses:        d.config.Monitor.AllowProcesses,
+		NeverForwardProcesses: d.config.Monitor.NeverForwardProcesses,
+	}
+}
+
+// applyConfig applies the changes in next that the monitor can take while
+// it runs: its port and process rules, and the log level. Ports already
+// listening that the new rules forward are forwarded by a reconciliation;
+// forwards the new rules exclude are kept until their port closes.
+func (d *Monitor) applyConfig(next *config.Config) {
+	d.configMu.Lock()
+	if d.logLevel == nil {
+		next.LogLevel = d.config.LogLevel
+	}
+	logConfigChanges(d.logger, config.Diff(d.config, next),
+		func(path string) bool {
+			return path == "log_level" || path == "network" || path == "address" || strings.HasPrefix(path, "monitor.")
+		},
+		func(path string) bool {
+			return path == "log_level" || slices.Contains(monitorFilterSettings, path)
+		})
+
+	if d.logLevel != nil && next.LogLevel != d.config.LogLevel {
+		d.config.LogLevel = next.LogLevel
+		d.logLevel.Set(next.Level())
+	}
+	previous := d.config.Monitor
+	d.config.Monitor.PortRanges = next.Monitor.PortRanges
+	d.config.Monitor.IgnorePorts = next.Monitor.IgnorePorts
+	d.config.Monitor.IgnoreProcesses = next.Monitor.IgnoreProcesses
+	d.config.Monitor.AllowProcesses = next.Monitor.AllowProcesses
+	d.config.Monitor.NeverForwardProcesses = next.Monitor.NeverForwardProcesses
+	filtersChanged := !reflect.DeepEqual(previous, d.config.Monitor)
+	d.configMu.Unlock()
+
+	if !filtersChanged || d.sessionMonitor == nil {
+		return
+	}
+	d.sessionMonitor.SetFilters(d.filters())
+	if _, err := d.Reconcile(nil); err != nil {
+		d.logger.Error("Reconciliation after config change failed", "error", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package daemon
+
+import "syscall"
+
+// umask sets the process's file mode creation mask, returning the old one
+func umask(mask int) int {
+	return syscall.Umask(mask)
+}
@@ -0,0 +1,7 @@
+package daemon
+
+// umask is a no-op: Windows has no creation mask, and the socket gets the
+// ACL of the directory it's created in
+func umask(mask int) int {
+	return 0
+}
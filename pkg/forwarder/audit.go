@@ -0,0 +1,184 @@
+package forwarder
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+// auditBindAddress is the address every forward's local listener must be
+// restricted to
+const auditBindAddress = "127.0.0.1"
+
+// isSharedBindAddress reports whether an explicit bind address makes a
+// forward reachable beyond loopback. An empty address leaves the choice to
+// ssh's GatewayPorts setting, which the audit polices.
+func isSharedBindAddress(addr string) bool {
+	return addr != "" && !protocol.IsLoopbackAddress(addr)
+}
+
+// AuditViolation describes a forward whose local listener is reachable
+// beyond loopback, or bound beyond it against policy
+type AuditViolation struct {
+	ConnectionInfo string
+	RemotePort     int
+	LocalPort      int
+	Host           string
+	ExposedAddr    string // Non-loopback address the listener answered on, or is bound to
+	Policy         bool   // True when the forward is bound beyond loopback without allow_lan_bind
+	Corrected      bool   // True when the forward was re-bound to loopback
+	Error          string // Why correction failed, if it was attempted
+}
+
+// Audit verifies that every tracked forward's local listener only accepts
+// connections on loopback, unless it was deliberately shared with a bind
+// address beyond loopback while allow_lan_bind permits that. Shared forwards
+// the policy doesn't permit, like those adopted from ssh or restored from a
+// state saved under another config, are violations too. When fix is true,
+// violating forwards are cancelled and re-created bound explicitly to
+// 127.0.0.1, which also overrides an ssh GatewayPorts setting that would
+// otherwise listen on all interfaces.
+func (f *Forwarder) Audit(fix bool) []AuditViolation {
+	f.mu.RLock()
+	forwards := make([]Forward, 0, len(f.forwards))
+	for _, fwd := range f.forwards {
+		forwards = append(forwards, *fwd)
+	}
+	f.mu.RUnlock()
+
+	var violations []AuditViolation
+	var violationsMu sync.Mutex
+
+	forEachConnection(f.workers, forwards, func(fwd Forward) string {
+		return fwd.ConnectionInfo
+	}, func(_ string, group []Forward) {
+		for _, fwd := range group {
+			// Unix sockets aren't reachable over the network
+			if fwd.LocalSocket != "" {
+				continue
+			}
+
+			v := AuditViolation{
+				ConnectionInfo: fwd.ConnectionInfo,
+				RemotePort:     fwd.RemotePort,
+				LocalPort:      fwd.LocalPort,
+				Host:           fwd.Host,
+			}
+			if isSharedBindAddress(fwd.BindAddress) {
+				// Shared forwards are meant to be reachable, where allowed
+				if f.allowLANBind {
+					continue
+				}
+				v.ExposedAddr = fwd.BindAddress
+				v.Policy = true
+				f.logger.Warn("Forward bound beyond loopback without allow_lan_bind",
+					"connectionInfo", fwd.ConnectionInfo,
+					"remotePort", fwd.RemotePort,
+					"localPort", fwd.LocalPort,
+					"bindAddress", fwd.BindAddress,
+				)
+			} else {
+				v.ExposedAddr = f.findExposedAddr(fwd.sshLocalPort())
+				if v.ExposedAddr == "" {
+					continue
+				}
+				f.logger.Warn("Forward listener reachable beyond loopback",
+					"connectionInfo", fwd.ConnectionInfo,
+					"remotePort", fwd.RemotePort,
+					"localPort", fwd.LocalPort,
+					"exposedAddr", v.ExposedAddr,
+				)
+			}
+
+			if fix {
+				if err := f.rebind(fwd, auditBindAddress); err != nil {
+					v.Error = err.Error()
+					f.logger.Error("Failed to re-bind forward to loopback",
+						"connectionInfo", fwd.ConnectionInfo,
+						"localPort", fwd.LocalPort,
+						"error", err,
+					)
+				} else {
+					v.Corrected = true
+				}
+			}
+
+			violationsMu.Lock()
+			violations = append(violations, v)
+			violationsMu.Unlock()
+		}
+	})
+
+	return violations
+}
+
+// rebind cancels a forward and re-creates it on the given bind address, then
+// restores the connection's other forwards (see RemoveForward).
+func (f *Forwarder) rebind(fwd Forward, bindAddress string) error {
+	key := fwd.key()
+
+	unlock := f.lockConnection(fwd.ConnectionInfo)
+	defer unlock()
+
+	snapshot := f.snapshotConnection(fwd.ConnectionInfo, fwd.SocketPath, key)
+
+	f.logger.Info("Re-binding forward",
+		"remote", fwd.RemoteTarget(),
+		"bindAddress", bindAddress,
+	)
+
+	if output, err := f.runCancel(&fwd); err != nil {
+		return fmt.Errorf("failed to cancel forward: %w (output: %s)", err, string(output))
+	}
+
+	rebound := fwd
+	rebound.BindAddress = bindAddress
+	forwardOutput, forwardErr := f.runForward(&rebound, f.forwardCommand(&rebound))
+
+	// The cancel also dropped the connection's other forwards; bring them back
+	// whether or not the re-bind itself succeeded
+	f.restoreConnection(fwd.SocketPath, fwd.ConnectionInfo, snapshot)
+
+	if forwardErr != nil {
+		return fmt.Errorf("failed to re-create forward: %w (output: %s)", forwardErr, string(forwardOutput))
+	}
+
+	f.mu.Lock()
+	if existing, ok := f.forwards[key]; ok {
+		existing.BindAddress = bindAddress
+		existing.proc = rebound.proc
+	}
+	f.mu.Unlock()
+
+	return nil
+}
+
+// exposedAddr returns the first non-loopback interface address on which the
+// local port accepts connections, or "" if it is only reachable on loopback.
+func exposedAddr(port int) string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+
+		target := net.JoinHostPort(ipNet.IP.String(), strconv.Itoa(port))
+		conn, err := net.DialTimeout("tcp", target, 250*time.Millisecond)
+		if err != nil {
+			continue
+		}
+		_ = conn.Close()
+		return ipNet.IP.String()
+	}
+
+	return ""
+}
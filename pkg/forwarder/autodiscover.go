@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"log/slog"
+	"net"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -17,10 +18,12 @@ type SSHForward struct {
 	RemoteHost     string
 	ConnectionInfo string
 	SocketPath     string
+	Configured     bool // Declared by a LocalForward in ssh_config, not added at runtime
 }
 
-// DiscoverActiveForwards finds all active SSH port forwards on the system
-func DiscoverActiveForwards(logger *slog.Logger) ([]SSHForward, error) {
+// DiscoverActiveForwards finds all active SSH port forwards on the system,
+// running sshCmd to learn where they lead
+func DiscoverActiveForwards(logger *slog.Logger, sshCmd string) ([]SSHForward, error) {
 	var forwards []SSHForward
 
 	// Find all SSH processes with control master sockets
@@ -31,7 +34,7 @@ func DiscoverActiveForwards(logger *slog.Logger) ([]SSHForward, error) {
 
 	// For each SSH process, find its listening ports
 	for _, proc := range sshProcesses {
-		processForwards, err := discoverProcessForwards(logger, proc)
+		processForwards, err := discoverProcessForwards(logger, sshCmd, proc)
 		if err != nil {
 			logger.Warn("Failed to discover forwards for process",
 				"pid", proc.PID,
@@ -44,6 +47,17 @@ func DiscoverActiveForwards(logger *slog.Logger) ([]SSHForward, error) {
 	return forwards, nil
 }
 
+// DiscoverActiveForwards finds the forwards on this machine's control
+// masters with the forwarder's backend. Only OpenSSH's connections can be
+// inspected, so other backends find none.
+func (f *Forwarder) DiscoverActiveForwards() ([]SSHForward, error) {
+	backend, ok := f.backend.(*OpenSSHBackend)
+	if !ok {
+		return nil, nil
+	}
+	return DiscoverActiveForwards(f.logger, backend.sshCmd)
+}
+
 type sshProcess struct {
 	PID            int
 	Command        string
@@ -53,63 +67,59 @@ type sshProcess struct {
 
 // findSSHControlMasterProcesses finds all SSH processes that are control masters
 func findSSHControlMasterProcesses(logger *slog.Logger) ([]sshProcess, error) {
-	var processes []sshProcess
-
-	// Use ps to find SSH processes with [mux] in their command
-	cmd := exec.Command("ps", "aux")
-	output, err := cmd.Output()
+	processes, err := listProcesses()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list processes: %w", err)
+		return nil, err
 	}
 
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Look for SSH mux processes
-		if strings.Contains(line, "ssh:") && strings.Contains(line, "[mux]") {
-			fields := strings.Fields(line)
-			if len(fields) < 11 {
-				continue
-			}
-
-			pid, err := strconv.Atoi(fields[1])
-			if err != nil {
-				continue
-			}
-
-			// Extract connection info from the command
-			// Format is typically: ssh: /path/to/socket_host_port_user [mux]
-			command := strings.Join(fields[10:], " ")
-
-			// Parse socket path from command
-			socketPath := ""
-			if idx := strings.Index(command, "ssh: "); idx >= 0 {
-				start := idx + 5
-				end := strings.Index(command[start:], " ")
-				if end > 0 {
-					socketPath = command[start : start+end]
-				}
-			}
-
-			// Try to extract connection info from socket path
-			connectionInfo := extractConnectionInfo(socketPath)
-
-			processes = append(processes, sshProcess{
-				PID:            pid,
-				Command:        command,
-				ConnectionInfo: connectionInfo,
-				SocketPath:     socketPath,
-			})
-
-			logger.Debug("Found SSH control master process",
-				"pid", pid,
-				"socketPath", socketPath,
-				"connectionInfo", connectionInfo)
+	// Masters reached through ProxyJump are attributed to their final
+	// destination rather than whatever their socket filename suggests
+	jumpDestinations := make(map[int]string)
+	for _, m := range parseJumpedMasters(processes) {
+		jumpDestinations[m.PID] = m.Destination
+	}
+
+	masters := controlMasters(processes)
+	for i := range masters {
+		if destination, ok := jumpDestinations[masters[i].PID]; ok {
+			masters[i].ConnectionInfo = destination
 		}
+
+		logger.Debug("Found SSH control master process",
+			"pid", masters[i].PID,
+			"socketPath", masters[i].SocketPath,
+			"connectionInfo", masters[i].ConnectionInfo)
 	}
 
-	return processes, nil
+	return masters, nil
+}
+
+// controlMasters picks the SSH control masters out of a process list. A
+// master sets its title to "ssh: <socket> [mux]".
+func controlMasters(processes []processInfo) []sshProcess {
+	var masters []sshProcess
+	for _, proc := range processes {
+		socketPath, ok := muxSocket(proc.Args)
+		if !ok {
+			continue
+		}
+		masters = append(masters, sshProcess{
+			PID:            proc.PID,
+			Command:        strings.Join(proc.Args, " "),
+			ConnectionInfo: extractConnectionInfo(socketPath),
+			SocketPath:     socketPath,
+		})
+	}
+	return masters
+}
+
+// muxSocket returns the control socket of a master from its title
+// arguments, and false if they aren't a master's
+func muxSocket(args []string) (string, bool) {
+	if len(args) < 3 || args[0] != "ssh:" || args[len(args)-1] != "[mux]" {
+		return "", false
+	}
+	return strings.Join(args[1:len(args)-1], " "), true
 }
 
 // extractConnectionInfo tries to extract connection info from socket path
@@ -144,66 +154,158 @@ func extractConnectionInfo(socketPath string) string {
 	return filename
 }
 
-// discoverProcessForwards discovers port forwards for a specific SSH process
-func discoverProcessForwards(logger *slog.Logger, proc sshProcess) ([]SSHForward, error) {
-	var forwards []SSHForward
-
-	// Use lsof to find listening ports for this process
-	cmd := exec.Command("lsof", "-p", strconv.Itoa(proc.PID), "-n", "-P")
-	output, err := cmd.Output()
+// discoverProcessForwards discovers port forwards for a specific SSH process.
+// A listening port only tells us the local end, so each one is matched to its
+// remote target; ports whose target can't be determined are skipped rather
+// than registered with a guess.
+func discoverProcessForwards(logger *slog.Logger, sshCmd string, proc sshProcess) ([]SSHForward, error) {
+	localPorts, err := listeningPorts(proc.PID)
 	if err != nil {
-		// Process might have exited
-		return nil, fmt.Errorf("failed to run lsof: %w", err)
+		return nil, err
+	}
+	if len(localPorts) == 0 {
+		return nil, nil
 	}
 
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Look for LISTEN lines on localhost
-		if !strings.Contains(line, "LISTEN") || !strings.Contains(line, "127.0.0.1") {
-			continue
-		}
-
-		fields := strings.Fields(line)
-		if len(fields) < 9 {
-			continue
-		}
-
-		// Parse the address field (e.g., "127.0.0.1:8080")
-		addrField := fields[8]
-		if !strings.HasPrefix(addrField, "127.0.0.1:") {
-			continue
-		}
+	targets := newRemoteTargetResolver(logger, sshCmd, proc)
 
-		portStr := strings.TrimPrefix(addrField, "127.0.0.1:")
-		localPort, err := strconv.Atoi(portStr)
-		if err != nil {
+	var forwards []SSHForward
+	for _, localPort := range localPorts {
+		remoteHost, remotePort, configured, ok := targets.resolve(localPort)
+		if !ok {
+			logger.Info("Skipping discovered forward with unknown remote target",
+				"pid", proc.PID,
+				"localPort", localPort,
+				"connectionInfo", proc.ConnectionInfo)
 			continue
 		}
 
-		// For discovered forwards, we don't know the remote port initially
-		// We'll need to query the SSH connection or make educated guesses
-		forward := SSHForward{
+		forwards = append(forwards, SSHForward{
 			PID:            proc.PID,
 			LocalPort:      localPort,
-			RemotePort:     localPort, // Assume same port for now
-			RemoteHost:     "localhost",
+			RemotePort:     remotePort,
+			RemoteHost:     remoteHost,
 			ConnectionInfo: proc.ConnectionInfo,
 			SocketPath:     proc.SocketPath,
-		}
-
-		forwards = append(forwards, forward)
+			Configured:     configured,
+		})
 
 		logger.Debug("Found port forward",
 			"pid", proc.PID,
 			"localPort", localPort,
+			"remote", net.JoinHostPort(remoteHost, strconv.Itoa(remotePort)),
 			"connectionInfo", proc.ConnectionInfo)
 	}
 
 	return forwards, nil
 }
 
+// remoteTargetResolver works out where a control master's local forwards
+// lead. The mux protocol has no way to list forwards, so it combines the
+// LocalForward directives ssh_config declares for the host with the ports
+// actually listening on the remote side, each fetched at most once.
+type remoteTargetResolver struct {
+	logger *slog.Logger
+	sshCmd string
+	proc   sshProcess
+
+	configured     []configuredForward
+	configLoaded   bool
+	listeners      map[int]bool
+	listenersTried bool
+}
+
+func newRemoteTargetResolver(logger *slog.Logger, sshCmd string, proc sshProcess) *remoteTargetResolver {
+	return &remoteTargetResolver{logger: logger, sshCmd: sshCmd, proc: proc}
+}
+
+// resolve returns the remote host and port a local port forwards to, and
+// whether ssh_config declares that forward
+func (r *remoteTargetResolver) resolve(localPort int) (string, int, bool, bool) {
+	// Forwards declared in ssh_config say exactly where they go
+	if !r.configLoaded {
+		r.configLoaded = true
+		if cfg, err := resolveSSHConfig(r.sshCmd, r.proc.ConnectionInfo); err == nil {
+			r.configured = cfg.LocalForwards
+		} else {
+			r.logger.Debug("Could not read ssh_config forwards",
+				"connectionInfo", r.proc.ConnectionInfo,
+				"error", err)
+		}
+	}
+	for _, fwd := range r.configured {
+		if fwd.LocalPort == localPort {
+			return fwd.RemoteHost, fwd.RemotePort, true, true
+		}
+	}
+
+	// Forwards added at runtime (bankshot's own, or `ssh -O forward`) are
+	// nearly always same-port; only trust that when the remote side really
+	// is listening on it
+	if !r.listenersTried {
+		r.listenersTried = true
+		listeners, err := queryRemoteListeners(r.sshCmd, r.proc.SocketPath, r.proc.ConnectionInfo)
+		if err != nil {
+			r.logger.Debug("Could not list remote listening ports",
+				"connectionInfo", r.proc.ConnectionInfo,
+				"error", err)
+		}
+		r.listeners = listeners
+	}
+	if r.listeners[localPort] {
+		return "localhost", localPort, false, true
+	}
+
+	return "", 0, false, false
+}
+
+// queryRemoteListeners lists the TCP ports listening on the remote host by
+// running ss (or netstat, where ss is missing) in a session multiplexed over
+// the existing control master
+func queryRemoteListeners(sshCmd, socketPath, connectionInfo string) (map[int]bool, error) {
+	cmd := exec.Command(sshCmd,
+		"-S", socketPath,
+		"-o", "ControlMaster=no",
+		"-o", "BatchMode=yes",
+		connectionInfo,
+		"ss -Htln 2>/dev/null || netstat -tln 2>/dev/null")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query remote listeners: %w", err)
+	}
+	return parseRemoteListeners(string(output)), nil
+}
+
+// parseRemoteListeners parses `ss -Htln` or `netstat -tln` output. Both put
+// the local address in the fourth column.
+func parseRemoteListeners(output string) map[int]bool {
+	ports := make(map[int]bool)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		isSS := fields[0] == "LISTEN"
+		isNetstat := strings.HasPrefix(fields[0], "tcp") && len(fields) >= 6 && fields[5] == "LISTEN"
+		if !isSS && !isNetstat {
+			continue
+		}
+
+		addr := fields[3]
+		colon := strings.LastIndex(addr, ":")
+		if colon < 0 {
+			continue
+		}
+		if port, err := strconv.Atoi(addr[colon+1:]); err == nil {
+			ports[port] = true
+		}
+	}
+
+	return ports
+}
+
 // QuerySSHForwards uses SSH control commands to query active forwards
 func QuerySSHForwards(logger *slog.Logger, connectionInfo string) ([]SSHForward, error) {
 	// First check if the connection is active
@@ -0,0 +1,372 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/process"
+)
+
+// Backend carries out forwards for a Forwarder. The forwarder keeps track of
+// forwards, conflicts, retries, and restores; the backend only knows how to
+// talk to the tool that owns the connection. Commands are returned unstarted
+// so dry runs can show them instead of running them.
+//
+// A connection is named by connectionInfo (an ssh destination, say) and
+// reached through a handle the backend resolves for it, which the forwarder
+// stores as the forward's SocketPath. For OpenSSH the handle is the
+// ControlMaster socket.
+type Backend interface {
+	// Name identifies the backend in config and logs
+	Name() string
+
+	// Resolve finds the handle for connectionInfo, failing when there is no
+	// live connection to forward through
+	Resolve(connectionInfo string) (string, error)
+
+	// ForwardCommand establishes fwd, listening on fwd.BindAddress
+	ForwardCommand(fwd *Forward) *exec.Cmd
+
+	// CancelCommand tears fwd down
+	CancelCommand(fwd *Forward) *exec.Cmd
+
+	// RestoreCommand re-applies the forwards the connection declares in its
+	// own configuration, for backends whose cancel drops more than the
+	// cancelled forward. Returns nil when there is nothing to re-apply.
+	RestoreCommand(socketPath, connectionInfo string) *exec.Cmd
+
+	// CheckCommand exits successfully while the connection is alive
+	CheckCommand(socketPath, connectionInfo string) *exec.Cmd
+
+	// ReadCommand writes the file at remotePath on the connection's host
+	// to its stdout
+	ReadCommand(socketPath, connectionInfo, remotePath string) *exec.Cmd
+}
+
+// ProcessBackend is implemented by backends whose forwards each run in a
+// process of their own, such as `tsh ssh -N -L`, instead of being added to a
+// shared connection. The forwarder keeps ForwardCommand running in the
+// background and stops it to cancel the forward, so CancelCommand and
+// RestoreCommand aren't used and cancelling a forward leaves the
+// connection's others alone. The processes run in sessions of their own, so
+// they outlive the daemon as an ssh forward does, and a backend that can
+// recognize them lets the next daemon adopt them.
+type ProcessBackend interface {
+	Backend
+
+	// ReadyTimeout is how long a forward's process may take to start
+	// accepting connections before it is given up on
+	ReadyTimeout() time.Duration
+}
+
+// forwardReadyPoll is how often a ProcessBackend forward is checked for
+// accepting connections while it starts
+const forwardReadyPoll = 100 * time.Millisecond
+
+// processAdopter is implemented by ProcessBackends that can recognize the
+// processes of forwards an earlier daemon left running
+type processAdopter interface {
+	// forwardFromArgs returns the forward a process with args carries, and
+	// false if it isn't one of the backend's
+	forwardFromArgs(args []string) (Forward, bool)
+}
+
+// forwardProcess is the background process carrying a ProcessBackend
+// forward: one the forwarder started, or one adopted from an earlier daemon
+type forwardProcess struct {
+	cmd     *exec.Cmd
+	done    chan struct{}  // closed once cmd has exited
+	adopted process.Handle // instead of cmd, for an adopted process
+}
+
+// pid returns the process's ID
+func (p *forwardProcess) pid() int {
+	if p.cmd == nil {
+		return p.adopted.PID
+	}
+	return p.cmd.Process.Pid
+}
+
+// stop kills the process, if it is still running, and waits for it to exit.
+// An adopted process isn't this one's child to wait for, so it is only
+// killed.
+func (p *forwardProcess) stop() {
+	if p.cmd == nil {
+		if p.adopted.Running() {
+			if proc, err := os.FindProcess(p.adopted.PID); err == nil {
+				_ = proc.Kill()
+			}
+		}
+		return
+	}
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	_ = p.cmd.Process.Kill()
+	<-p.done
+}
+
+// isProcessBackend reports whether the forwarder's forwards run as
+// processes of their own
+func (f *Forwarder) isProcessBackend() bool {
+	_, ok := f.backend.(ProcessBackend)
+	return ok
+}
+
+// runForward runs cmd, built by forwardCommand, to establish fwd and returns
+// its output. For a ProcessBackend the command keeps running, attached to
+// fwd, once the forward accepts connections; a process fwd already had is
+// stopped first.
+func (f *Forwarder) runForward(fwd *Forward, cmd *exec.Cmd) ([]byte, error) {
+	pb, ok := f.backend.(ProcessBackend)
+	if !ok {
+		return f.runCommand(cmd)
+	}
+
+	if fwd.proc != nil {
+		fwd.proc.stop()
+		fwd.proc = nil
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	detach(cmd)
+	if f.ctx.Err() != nil {
+		return nil, errForwarderClosed
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	proc := &forwardProcess{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		_ = cmd.Wait()
+		close(proc.done)
+	}()
+
+	timeout := time.NewTimer(pb.ReadyTimeout())
+	defer timeout.Stop()
+	ticker := time.NewTicker(forwardReadyPoll)
+	defer ticker.Stop()
+	for {
+		if f.LocalEndListening(fwd) {
+			fwd.proc = proc
+			return nil, nil
+		}
+		select {
+		case <-proc.done:
+			return output.Bytes(), fmt.Errorf("%s exited before the forward was ready: %s", pb.Name(), cmd.ProcessState)
+		case <-timeout.C:
+			proc.stop()
+			return output.Bytes(), fmt.Errorf("forward was not accepting connections after %s", pb.ReadyTimeout())
+		case <-f.ctx.Done():
+			proc.stop()
+			return output.Bytes(), errForwarderClosed
+		case <-ticker.C:
+		}
+	}
+}
+
+// errForwarderClosed is returned for backend commands Close stopped
+var errForwarderClosed = errors.New("forwarder closed")
+
+// runCommand runs a backend command to completion and returns its combined
+// output. Close kills it, so one stuck on an unresponsive connection doesn't
+// outlive the forwarder.
+func (f *Forwarder) runCommand(cmd *exec.Cmd) ([]byte, error) {
+	if f.ctx.Err() != nil {
+		return nil, errForwarderClosed
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(f.ctx, func() {
+		_ = cmd.Process.Kill()
+	})
+	defer stop()
+	err := cmd.Wait()
+	return output.Bytes(), err
+}
+
+// runCancel tears fwd down and returns the output of the command doing it.
+// For a ProcessBackend that means stopping the forward's process; otherwise
+// the backend's CancelCommand is run.
+func (f *Forwarder) runCancel(fwd *Forward) ([]byte, error) {
+	if f.isProcessBackend() {
+		if fwd.proc != nil {
+			fwd.proc.stop()
+		}
+		return nil, nil
+	}
+	return f.runCommand(f.cancelCommand(fwd))
+}
+
+// AdoptProcesses takes over the forwards whose processes an earlier daemon
+// left running, for a backend that can recognize them, and returns how many
+// it adopted. Only session leaders are considered, as runForward starts
+// them: a `tsh ssh -L` run from a shell is the user's own.
+func (f *Forwarder) AdoptProcesses() (int, error) {
+	adopter, ok := f.backend.(processAdopter)
+	if !ok {
+		return 0, nil
+	}
+	processes, err := listProcesses()
+	if err != nil {
+		return 0, err
+	}
+
+	adopted := 0
+	for _, p := range processes {
+		if !sessionLeader(p.PID) {
+			continue
+		}
+		fwd, ok := adopter.forwardFromArgs(p.Args)
+		if !ok {
+			continue
+		}
+		handle, ok := process.Find(p.PID)
+		if !ok {
+			continue
+		}
+		fwd.proc = &forwardProcess{adopted: handle}
+		fwd.CreatedAt = time.Now()
+
+		key := fwd.key()
+		f.mu.Lock()
+		if _, exists := f.forwards[key]; !exists {
+			f.forwards[key] = &fwd
+			adopted++
+		}
+		f.mu.Unlock()
+		f.logger.Info("Adopted forward left running by an earlier daemon",
+			"pid", p.PID,
+			"connectionInfo", fwd.ConnectionInfo,
+			"remote", fwd.RemoteTarget(),
+			"local", fwd.LocalTarget(),
+		)
+	}
+	return adopted, nil
+}
+
+// BackendOpenSSH names the default backend, which drives OpenSSH
+// ControlMaster connections with `ssh -O`
+const BackendOpenSSH = "openssh"
+
+// BackendConfig holds the settings backends are constructed from
+type BackendConfig struct {
+	SSHCommand    string // ssh binary, for openssh
+	TshCommand    string // tsh binary, for tsh (default: "tsh")
+	TeleportProxy string // Teleport proxy address for tsh ("" = the current tsh profile's)
+}
+
+// backends maps backend names to constructors
+var backends = map[string]func(cfg BackendConfig) Backend{
+	BackendOpenSSH:  func(cfg BackendConfig) Backend { return NewOpenSSHBackend(cfg.SSHCommand) },
+	BackendTeleport: func(cfg BackendConfig) Backend { return NewTeleportBackend(cfg.TshCommand, cfg.TeleportProxy) },
+}
+
+// NewBackend returns the backend registered under name ("" = openssh)
+func NewBackend(name string, cfg BackendConfig) (Backend, error) {
+	if name == "" {
+		name = BackendOpenSSH
+	}
+	newBackend, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown forwarding backend %q (available: %s)", name, strings.Join(BackendNames(), ", "))
+	}
+	return newBackend(cfg), nil
+}
+
+// BackendNames lists the registered backends, sorted
+func BackendNames() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenSSHBackend forwards through OpenSSH ControlMaster connections with
+// `ssh -O forward` and `ssh -O cancel`
+type OpenSSHBackend struct {
+	sshCmd string
+}
+
+// NewOpenSSHBackend creates a backend that runs sshCmd (normally "ssh")
+func NewOpenSSHBackend(sshCmd string) *OpenSSHBackend {
+	return &OpenSSHBackend{sshCmd: sshCmd}
+}
+
+// Name implements Backend
+func (b *OpenSSHBackend) Name() string {
+	return BackendOpenSSH
+}
+
+// Resolve implements Backend by finding the connection's control socket
+func (b *OpenSSHBackend) Resolve(connectionInfo string) (string, error) {
+	return findControlSocket(b.sshCmd, connectionInfo)
+}
+
+// ForwardCommand implements Backend
+func (b *OpenSSHBackend) ForwardCommand(fwd *Forward) *exec.Cmd {
+	return b.controlCommand(fwd.SocketPath, fwd.ConnectionInfo,
+		"-O", "forward",
+		"-L", fwd.forwardSpec(fwd.BindAddress),
+	)
+}
+
+// CancelCommand implements Backend
+func (b *OpenSSHBackend) CancelCommand(fwd *Forward) *exec.Cmd {
+	return b.controlCommand(fwd.SocketPath, fwd.ConnectionInfo,
+		"-O", "cancel",
+		"-L", fwd.forwardSpec(fwd.BindAddress),
+	)
+}
+
+// RestoreCommand implements Backend. OpenSSH drops every socket forward on
+// the master when any forward is cancelled, so the forwards ssh_config
+// declares (like ~/.bankshot.sock) are re-applied with a bare -O forward.
+func (b *OpenSSHBackend) RestoreCommand(socketPath, connectionInfo string) *exec.Cmd {
+	return b.controlCommand(socketPath, connectionInfo, "-O", "forward")
+}
+
+// CheckCommand implements Backend
+func (b *OpenSSHBackend) CheckCommand(socketPath, connectionInfo string) *exec.Cmd {
+	return b.controlCommand(socketPath, connectionInfo, "-O", "check")
+}
+
+// ReadCommand implements Backend by running cat on the host, through the
+// control master so there's no new login
+func (b *OpenSSHBackend) ReadCommand(socketPath, connectionInfo, remotePath string) *exec.Cmd {
+	args := []string{"-o", "BatchMode=yes", "-o", "ControlMaster=no"}
+	if socketPath != "" {
+		args = append(args, "-S", socketPath)
+	}
+	args = append(args, connectionInfo, remoteReadCommand(remotePath))
+	return exec.Command(b.sshCmd, args...)
+}
+
+// controlCommand builds an ssh control command (-O ...) for a connection.
+// When the control socket is known it is passed explicitly, so the command
+// reaches the right master even when connectionInfo alone would resolve to a
+// different ControlPath (e.g. a host reached through a ProxyJump alias).
+func (b *OpenSSHBackend) controlCommand(socketPath, connectionInfo string, args ...string) *exec.Cmd {
+	if socketPath != "" {
+		args = append(args, "-S", socketPath)
+	}
+	args = append(args, connectionInfo)
+	return exec.Command(b.sshCmd, args...)
+}
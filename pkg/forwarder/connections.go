@@ -0,0 +1,142 @@
+package forwarder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Connection is an SSH control master running on this machine
+type Connection struct {
+	ConnectionInfo string
+	SocketPath     string
+	PID            int
+
+	// LocalPorts are the local ports of the master's TCP connections, one of
+	// which the remote end sees as the client port in SSH_CONNECTION
+	LocalPorts []int
+}
+
+// Connections lists the control masters running on this machine. Each is
+// named as the forwards through it are, or else by the first of the hosts
+// its socket's file name suggests, and the name discovery gave it, that
+// resolves to its socket. Masters without such a name have none.
+func (f *Forwarder) Connections() ([]Connection, error) {
+	masters, err := findSSHControlMasterProcesses(f.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	named := f.namedSockets()
+	connections := make([]Connection, 0, len(masters))
+	for _, m := range masters {
+		conn := f.masterConnection(m, named)
+		conn.LocalPorts, err = connectedPorts(m.PID)
+		if err != nil {
+			f.logger.Debug("Failed to list control master's connections", "pid", m.PID, "error", err)
+		}
+		connections = append(connections, conn)
+	}
+	return connections, nil
+}
+
+// namedSockets maps the control sockets of forwards to the connections
+// they're for
+func (f *Forwarder) namedSockets() map[string]string {
+	named := make(map[string]string)
+	for _, fwd := range f.ListForwards() {
+		if fwd.SocketPath != "" {
+			named[fwd.SocketPath] = fwd.ConnectionInfo
+		}
+	}
+	return named
+}
+
+// masterConnection returns the Connection for master m, named as
+// Connections names them, without its LocalPorts
+func (f *Forwarder) masterConnection(m sshProcess, named map[string]string) Connection {
+	conn := Connection{
+		ConnectionInfo: named[m.SocketPath],
+		SocketPath:     m.SocketPath,
+		PID:            m.PID,
+	}
+	if conn.ConnectionInfo == "" {
+		for _, candidate := range append(socketHosts(m.SocketPath), m.ConnectionInfo) {
+			if socketPath, err := f.FindControlSocket(candidate); err == nil && socketPath == m.SocketPath {
+				conn.ConnectionInfo = candidate
+				break
+			}
+		}
+	}
+	return conn
+}
+
+// Peer is the process on the other end of a connection to the daemon's
+// socket, as far as it tells where the request came from
+type Peer struct {
+	PID int
+
+	// Remote is set unless the peer is bankshot itself, run on this
+	// machine. Requests from remote hosts arrive through the ssh or tsh
+	// process forwarding the socket to them, or bankshot proxy.
+	Remote bool
+
+	// Connection is the control master a remote request came through, if
+	// it came through one, without its LocalPorts. Its ConnectionInfo is
+	// empty when the master's host can't be named.
+	Connection Connection
+}
+
+// LookupPeer tells where a request from the process pid came from. Only
+// that process is read, and control sockets are resolved from a cache, so
+// it's cheap enough to do for every request, unlike Connections.
+func (f *Forwarder) LookupPeer(pid int) (Peer, error) {
+	args, err := processArgs(pid)
+	if err != nil {
+		return Peer{}, fmt.Errorf("failed to read process %d: %w", pid, err)
+	}
+	peer := Peer{PID: pid, Remote: !localBankshot(args)}
+	if masters := controlMasters([]processInfo{{PID: pid, Args: args}}); len(masters) == 1 {
+		peer.Connection = f.masterConnection(masters[0], f.namedSockets())
+	}
+	return peer, nil
+}
+
+// localBankshot reports whether args are those of bankshot run on this
+// machine, as opposed to bankshot proxy relaying a remote host's requests
+func localBankshot(args []string) bool {
+	if len(args) == 0 || !strings.HasPrefix(filepath.Base(args[0]), "bankshot") {
+		return false
+	}
+	for _, arg := range args[1:] {
+		if !strings.HasPrefix(arg, "-") {
+			return arg != "proxy"
+		}
+	}
+	return true
+}
+
+// socketHosts guesses the destinations a control socket named after the
+// usual %r@%h:%p tokens, such as "ssh-alice@devbox:22", was made for:
+// "alice@devbox" and "devbox"
+func socketHosts(socketPath string) []string {
+	name := filepath.Base(socketPath)
+	at := strings.LastIndex(name, "@")
+	if at < 0 {
+		return nil
+	}
+
+	host, _, _ := strings.Cut(name[at+1:], ":")
+	if host == "" {
+		return nil
+	}
+	user := name[:at]
+	if i := strings.LastIndexAny(user, "-_"); i >= 0 {
+		user = user[i+1:]
+	}
+
+	if user == "" {
+		return []string{host}
+	}
+	return []string{user + "@" + host, host}
+}
@@ -0,0 +1,171 @@
+package forwarder
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// The Plan methods report the ssh commands the matching operation would run,
+// in order, without running them or changing any state. A plan can only
+// reflect the current state: the port conflict strategy may pick a different
+// local port by the time the real operation runs, and with accounting the
+// private port ssh listens on is allocated afresh.
+
+// PlanAdd reports the ssh commands Add would run for want. It returns no
+// commands when the forward already exists.
+func (f *Forwarder) PlanAdd(want Forward) ([]string, error) {
+	fwd, err := f.normalize(want)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fwd.key()
+	f.mu.RLock()
+	_, exists := f.forwards[key]
+	f.mu.RUnlock()
+
+	if err := f.checkNameAvailable(fwd.Name, key); err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, nil
+	}
+
+	var commands []string
+	if fwd.LocalSocket == "" {
+		// Stealing cancels the holder first; plan as though that freed
+		// the port
+		strategy := f.conflictStrategy(fwd)
+		holderKey, holder, held := f.portHolder(fwd.LocalPort, key)
+		if strategy == PortConflictSteal && held && !isLocalPortFree(fwd.LocalPort) {
+			commands = f.planRemoveForwards(holder.ConnectionInfo, []string{holderKey})
+		} else {
+			localPort, err := f.resolveLocalPort(fwd.LocalPort, strategy, key)
+			if err != nil {
+				return nil, err
+			}
+			fwd.LocalPort = localPort
+		}
+
+		if f.accounting {
+			sshPort, err := allocateLoopbackPort()
+			if err != nil {
+				return nil, err
+			}
+			fwd.SSHPort = sshPort
+			fwd.ListenAddress = fwd.BindAddress
+			fwd.BindAddress = auditBindAddress
+		}
+	}
+
+	return append(commands, commandLine(f.forwardCommand(&fwd))), nil
+}
+
+// PlanAddRange reports the ssh commands AddRange would run
+func (f *Forwarder) PlanAddRange(socketPath, connectionInfo string, start, end, localStart int, host string) ([]string, error) {
+	localStart, host, err := normalizeRange(start, end, localStart, host)
+	if err != nil {
+		return nil, err
+	}
+	group := rangeGroup(host, start, end)
+
+	var commands []string
+	for port := start; port <= end; port++ {
+		planned, err := f.PlanAdd(Forward{
+			RemotePort:     port,
+			LocalPort:      localStart + (port - start),
+			Host:           host,
+			Group:          group,
+			SocketPath:     socketPath,
+			ConnectionInfo: connectionInfo,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to forward port %d of range %d-%d: %w", port, start, end, err)
+		}
+		commands = append(commands, planned...)
+	}
+	return commands, nil
+}
+
+// PlanRemove reports the ssh commands Remove would run for want, including
+// the cancel-and-restore of the other forwards on the same control socket
+func (f *Forwarder) PlanRemove(want Forward) ([]string, error) {
+	key, err := f.removalKey(want)
+	if err != nil {
+		return nil, err
+	}
+	return f.planRemoveForwards(want.ConnectionInfo, []string{key}), nil
+}
+
+// PlanRemoveRange reports the ssh commands RemoveRange would run
+func (f *Forwarder) PlanRemoveRange(connectionInfo string, start, end int, host string) ([]string, error) {
+	keys, err := f.rangeKeys(connectionInfo, start, end, host)
+	if err != nil {
+		return nil, err
+	}
+	return f.planRemoveForwards(connectionInfo, keys), nil
+}
+
+// PlanRemoveByName reports the ssh commands RemoveByName would run
+func (f *Forwarder) PlanRemoveByName(name string) ([]string, error) {
+	key, connectionInfo, ok := f.nameOwner(name)
+	if !ok {
+		return nil, fmt.Errorf("no forward named %q", name)
+	}
+	return f.planRemoveForwards(connectionInfo, []string{key}), nil
+}
+
+// planRemoveForwards mirrors removeForwards: for each control socket, the
+// cancels, then re-applying ssh_config's forwards, then re-adding every
+// other tracked forward. Pending retries and lost forwards need no commands.
+func (f *Forwarder) planRemoveForwards(connectionInfo string, keys []string) []string {
+	// A ProcessBackend cancel stops the forward's process and leaves the
+	// others alone
+	if f.isProcessBackend() {
+		var commands []string
+		f.mu.RLock()
+		for _, key := range keys {
+			if existing, ok := f.forwards[key]; ok {
+				if cmd := f.cancelCommand(existing); cmd != nil {
+					commands = append(commands, commandLine(cmd))
+				}
+			}
+		}
+		f.mu.RUnlock()
+		return commands
+	}
+
+	var toCancel []Forward
+	f.mu.RLock()
+	for _, key := range keys {
+		if existing, ok := f.forwards[key]; ok {
+			toCancel = append(toCancel, *existing)
+		}
+	}
+	f.mu.RUnlock()
+
+	var commands []string
+	socketOrder, bySocket := groupBySocket(toCancel)
+	for _, socketPath := range socketOrder {
+		snapshot := f.snapshotConnection(connectionInfo, socketPath, keys...)
+		sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].key() < snapshot[j].key() })
+
+		for _, fwd := range bySocket[socketPath] {
+			commands = append(commands, commandLine(f.cancelCommand(&fwd)))
+		}
+		if configCmd := f.configForwardCommand(socketPath, connectionInfo); configCmd != nil {
+			commands = append(commands, commandLine(configCmd))
+		}
+		for _, fwd := range snapshot {
+			commands = append(commands, commandLine(f.forwardCommand(&fwd)))
+		}
+	}
+	return commands
+}
+
+// commandLine renders a command for display
+func commandLine(cmd *exec.Cmd) string {
+	return strings.Join(cmd.Args, " ")
+}
@@ -0,0 +1,38 @@
+package forwarder
+
+// EventType identifies a change in a forward's health
+type EventType string
+
+const (
+	// EventReestablished fires when reconciliation restores a stale forward
+	EventReestablished EventType = "reestablished"
+	// EventDropped fires when reconciliation removes a forward whose SSH
+	// connection is gone
+	EventDropped EventType = "dropped"
+	// EventRetryExhausted fires when a queued forward fails its last retry
+	EventRetryExhausted EventType = "retry_exhausted"
+	// EventConnectionLost fires for each forward taken down because its SSH
+	// control master stopped answering
+	EventConnectionLost EventType = "connection_lost"
+	// EventConnectionRestored fires for each forward re-established after
+	// its SSH connection came back
+	EventConnectionRestored EventType = "connection_restored"
+	// EventIdleRemoved fires for each forward removed after carrying no
+	// traffic for the idle timeout
+	EventIdleRemoved EventType = "idle_removed"
+)
+
+// Event describes a forward health change observed by the forwarder
+type Event struct {
+	Type    EventType
+	Forward Forward
+	Reason  string
+}
+
+// emit delivers an event to the configured handler, if any
+func (f *Forwarder) emit(eventType EventType, fwd Forward, reason string) {
+	if f.onEvent == nil {
+		return
+	}
+	f.onEvent(Event{Type: eventType, Forward: fwd, Reason: reason})
+}
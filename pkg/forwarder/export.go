@@ -0,0 +1,103 @@
+package forwarder
+
+import "sort"
+
+// Spec describes a forward to establish again later: a single forward, or,
+// when RemotePortEnd is set, a port range forwarded as a group starting at
+// RemotePort. Only the fields a request would set are filled in.
+type Spec struct {
+	Forward
+	RemotePortEnd int
+}
+
+// Specs returns what it would take to re-create the forwards of
+// connectionInfo (every connection when empty), including those waiting to
+// be retried. Each port range is collapsed into a single spec. Control
+// sockets are only kept for pinned forwards, since others are resolved
+// again when added.
+func (f *Forwarder) Specs(connectionInfo string) []Spec {
+	var templates []Forward
+	f.mu.RLock()
+	for _, fwd := range f.forwards {
+		template := *fwd
+		template.BindAddress = fwd.LocalBindAddress()
+		templates = append(templates, template)
+	}
+	f.mu.RUnlock()
+
+	for _, r := range f.PendingRetries() {
+		templates = append(templates, Forward{
+			RemotePort:     r.RemotePort,
+			LocalPort:      r.LocalPort,
+			Host:           r.Host,
+			RemoteSocket:   r.RemoteSocket,
+			LocalSocket:    r.LocalSocket,
+			Group:          r.Group,
+			SocketPath:     r.SocketPath,
+			Pinned:         r.Pinned,
+			BindAddress:    r.BindAddress,
+			Name:           r.Name,
+			ConnectionInfo: r.ConnectionInfo,
+		})
+	}
+
+	type groupKey struct{ connectionInfo, group string }
+	groups := make(map[groupKey]int) // index into specs
+	lowest := make(map[groupKey]int) // lowest remote port seen per group
+	var specs []Spec
+	for _, fwd := range templates {
+		if connectionInfo != "" && fwd.ConnectionInfo != connectionInfo {
+			continue
+		}
+
+		spec := Spec{Forward: Forward{
+			Name:           fwd.Name,
+			RemotePort:     fwd.RemotePort,
+			LocalPort:      fwd.LocalPort,
+			Host:           fwd.Host,
+			RemoteSocket:   fwd.RemoteSocket,
+			LocalSocket:    fwd.LocalSocket,
+			BindAddress:    fwd.BindAddress,
+			ConnectionInfo: fwd.ConnectionInfo,
+		}}
+		if fwd.Pinned {
+			spec.SocketPath = fwd.SocketPath
+			spec.Pinned = true
+		}
+
+		start, end, ok := parseRangeGroup(fwd.Group)
+		if fwd.Group == "" || !ok {
+			specs = append(specs, spec)
+			continue
+		}
+
+		// The range's local ports follow its first one, unless the port
+		// conflict strategy moved some; go by the lowest port seen
+		spec.LocalPort = fwd.LocalPort - (fwd.RemotePort - start)
+		spec.RemotePort = start
+		spec.RemotePortEnd = end
+		k := groupKey{fwd.ConnectionInfo, fwd.Group}
+		i, seen := groups[k]
+		if !seen {
+			groups[k] = len(specs)
+			lowest[k] = fwd.RemotePort
+			specs = append(specs, spec)
+			continue
+		}
+		if fwd.RemotePort < lowest[k] {
+			lowest[k] = fwd.RemotePort
+			specs[i].LocalPort = spec.LocalPort
+		}
+	}
+
+	sort.Slice(specs, func(i, j int) bool {
+		if specs[i].ConnectionInfo != specs[j].ConnectionInfo {
+			return specs[i].ConnectionInfo < specs[j].ConnectionInfo
+		}
+		if specs[i].RemoteTarget() != specs[j].RemoteTarget() {
+			return specs[i].RemoteTarget() < specs[j].RemoteTarget()
+		}
+		return specs[i].SocketPath < specs[j].SocketPath
+	})
+	return specs
+}
@@ -0,0 +1,71 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrFileTooLarge is returned by CopyFile for a file over its size limit
+var ErrFileTooLarge = errors.New("file is larger than allowed")
+
+// CopyFile writes the file at remotePath on connectionInfo's host to w,
+// through the connection the backend has to it. The copy is stopped once
+// more than maxBytes arrive, with ErrFileTooLarge, or when ctx is done.
+func (f *Forwarder) CopyFile(ctx context.Context, connectionInfo, remotePath string, w io.Writer, maxBytes int64) error {
+	socketPath, err := f.FindControlSocket(connectionInfo)
+	if err != nil {
+		return fmt.Errorf("no connection to copy it over: %w", err)
+	}
+
+	cmd := f.backend.ReadCommand(socketPath, connectionInfo, remotePath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	f.logger.Debug("Copying file from remote host",
+		"connectionInfo", connectionInfo,
+		"path", remotePath,
+		"command", strings.Join(cmd.Args, " "))
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = cmd.Process.Kill()
+	})
+	defer stop()
+	stopOnClose := context.AfterFunc(f.ctx, func() {
+		_ = cmd.Process.Kill()
+	})
+	defer stopOnClose()
+
+	copied, copyErr := io.Copy(w, io.LimitReader(stdout, maxBytes+1))
+	if copied > maxBytes {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("%w (%d bytes)", ErrFileTooLarge, maxBytes)
+	}
+	waitErr := cmd.Wait()
+	switch {
+	case ctx.Err() != nil:
+		return fmt.Errorf("copy stopped: %w", ctx.Err())
+	case f.ctx.Err() != nil:
+		return fmt.Errorf("copy stopped: %w", errForwarderClosed)
+	case copyErr != nil:
+		return copyErr
+	case waitErr != nil:
+		return fmt.Errorf("%s failed: %w: %s", f.backend.Name(), waitErr, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// remoteReadCommand is the command printing remotePath on the remote host,
+// whose shell runs it
+func remoteReadCommand(remotePath string) string {
+	return "cat -- '" + strings.ReplaceAll(remotePath, "'", `'\''`) + "'"
+}
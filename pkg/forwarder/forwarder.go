@@ -1,110 +1,589 @@
 package forwarder
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/mitchellh/go-homedir"
 	"github.com/phinze/bankshot/pkg/monitor"
+	"github.com/phinze/bankshot/pkg/protocol"
 )
 
 // Forward represents an active port forward
 type Forward struct {
+	Name           string // Optional alias for referring to the forward
 	RemotePort     int
 	LocalPort      int
 	Host           string
+	RemoteSocket   string // Remote Unix socket path; when set, RemotePort and Host are unused
+	LocalSocket    string // Local Unix socket path; when set, LocalPort is unused
+	Group          string // Port range this forward was added as part of, if any
 	SocketPath     string
-	ConnectionInfo string // SSH connection target (e.g., hostname)
+	Pinned         bool                 // SocketPath was chosen by the caller; it is part of the forward's identity and never re-resolved
+	ConnectionInfo string               // SSH connection target (e.g., hostname)
+	BindAddress    string               // Explicit local bind address ("" = ssh default)
+	ListenAddress  string               // Address the accounting relay listens on ("" = loopback)
+	SSHPort        int                  // Port ssh listens on when a relay fronts LocalPort (0 = LocalPort)
+	Owner          string               // Who requested the forward (e.g. "cli", "wrap:1234"), if known
+	AppProtocol    string               // What the remote port speaks (e.g. "http"), if detected
+	Server         string               // What the remote HTTP server calls itself (e.g. "Next.js"), if detected
+	Conflict       PortConflictStrategy // Overrides the forwarder's port conflict strategy for this forward ("" = default)
+	IdleTimeout    time.Duration        // Overrides the forwarder's idle timeout for this forward (0 = default)
+	Resolution     *ConflictResolution  // How a busy local port was handled when the forward was added (nil = it was free)
 	CreatedAt      time.Time
+
+	relay      *relay          // Accounting relay, if enabled
+	proc       *forwardProcess // Process carrying the forward, for a ProcessBackend
+	lastActive time.Time       // Last time the forward was seen carrying traffic, guarded by Forwarder.mu
+}
+
+// forwardKey identifies a forward within the forwarder. Connection info is
+// included to support multiple SSH sessions.
+func forwardKey(connectionInfo, host string, remotePort int, remoteSocket string) string {
+	if remoteSocket != "" {
+		return fmt.Sprintf("%s:%s", connectionInfo, remoteSocket)
+	}
+	return fmt.Sprintf("%s:%s:%d", connectionInfo, host, remotePort)
+}
+
+// key returns the forward's key in the forwarder. Pinned forwards include
+// their control socket, so the same port can be forwarded through several
+// masters for one host (e.g. different users or ports).
+func (fwd *Forward) key() string {
+	key := forwardKey(fwd.ConnectionInfo, fwd.Host, fwd.RemotePort, fwd.RemoteSocket)
+	if fwd.Pinned {
+		key += "@" + fwd.SocketPath
+	}
+	return key
+}
+
+// RemoteTarget describes the remote end of the forward: "host:port" or a
+// Unix socket path
+func (fwd *Forward) RemoteTarget() string {
+	if fwd.RemoteSocket != "" {
+		return fwd.RemoteSocket
+	}
+	return net.JoinHostPort(fwd.Host, strconv.Itoa(fwd.RemotePort))
+}
+
+// bracketHost wraps an IPv6 literal in the brackets ssh's forward specs
+// need to tell its colons from the separators, e.g. "::1" -> "[::1]"
+func bracketHost(host string) string {
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// LocalBindAddress is the address the forward's local port is reachable on,
+// as requested when it was added ("" = loopback or ssh's default)
+func (fwd *Forward) LocalBindAddress() string {
+	if fwd.relay != nil || fwd.SSHPort != 0 {
+		return fwd.ListenAddress
+	}
+	return fwd.BindAddress
+}
+
+// LocalTarget describes the local end of the forward: a port number or a
+// Unix socket path
+func (fwd *Forward) LocalTarget() string {
+	if fwd.LocalSocket != "" {
+		return fwd.LocalSocket
+	}
+	return strconv.Itoa(fwd.LocalPort)
+}
+
+// forwardSpec builds the argument for ssh -L. When bindAddress is empty ssh
+// decides where to listen based on its GatewayPorts setting. Bind addresses
+// don't apply to local Unix sockets.
+func (fwd *Forward) forwardSpec(bindAddress string) string {
+	if fwd.LocalSocket != "" {
+		return fwd.LocalSocket + ":" + fwd.RemoteTarget()
+	}
+	local := strconv.Itoa(fwd.sshLocalPort())
+	if bindAddress != "" {
+		local = bracketHost(bindAddress) + ":" + local
+	}
+	return local + ":" + fwd.RemoteTarget()
+}
+
+// sshLocalPort returns the local port ssh itself listens on for this forward
+func (fwd *Forward) sshLocalPort() int {
+	if fwd.SSHPort != 0 {
+		return fwd.SSHPort
+	}
+	return fwd.LocalPort
+}
+
+// Stats returns the forward's traffic counters. The second return value is
+// false when the forward has no accounting relay.
+func (fwd *Forward) Stats() (Stats, bool) {
+	if fwd.relay == nil {
+		return Stats{}, false
+	}
+	return fwd.relay.stats(), true
 }
 
 // Forwarder manages SSH port forwards
 type Forwarder struct {
-	logger   *slog.Logger
-	sshCmd   string
-	forwards map[string]*Forward // key: "host:remotePort"
-	mu       sync.RWMutex
+	logger           *slog.Logger
+	backend          Backend
+	portConflict     PortConflictStrategy
+	accounting       bool
+	workers          int
+	bindAddress      string
+	allowLANBind     bool
+	findExposedAddr  func(port int) string                   // defaults to exposedAddr
+	checkListening   func(bindAddress string, port int) bool // defaults to isListening
+	checkReachable   func(bindAddress string, port int) bool // defaults to isReachable
+	onEvent          func(Event)
+	forwards         map[string]*Forward // key: "host:remotePort"
+	mu               sync.RWMutex
+	connLocks        map[string]*sync.Mutex // key: connectionInfo
+	connLocksMu      sync.Mutex
+	retryMaxAttempts int
+	retries          map[string]*PendingRetry // key: same as forwards
+	retryMu          sync.Mutex
+	controlSockets   *controlSocketCache
+	checkConnection  func(socketPath, connectionInfo string) error // defaults to checkControlConnection
+	lost             map[string]*lostConnection                    // key: connectionInfo
+	lostMu           sync.Mutex
+	reservedNames    map[string]string // name -> key of the forward being set up with it
+	namesMu          sync.Mutex
+	ctx              context.Context // Done once Close is called
+	cancel           context.CancelFunc
+	idleTimeout      time.Duration
+	establishedPorts func() (map[int]bool, error) // defaults to establishedLocalPorts
+}
+
+// Options holds optional Forwarder behavior
+type Options struct {
+	// PortConflict selects how busy local ports are handled (default: fail)
+	PortConflict PortConflictStrategy
+
+	// Backend carries out forwards (default: OpenSSH control masters driven
+	// with the forwarder's ssh command)
+	Backend Backend
+
+	// OnEvent, if set, is called when reconciliation re-establishes or drops
+	// a forward. It may be called concurrently from worker goroutines and
+	// must not block.
+	OnEvent func(Event)
+
+	// Accounting fronts each new forward's local port with a TCP relay that
+	// counts bytes and connections. ssh listens on a private loopback port
+	// behind it.
+	Accounting bool
+
+	// RetryMaxAttempts is how many times a forward that ssh rejected is
+	// retried in the background, with exponential backoff, before giving up.
+	// Zero disables retries.
+	RetryMaxAttempts int
+
+	// Workers bounds how many connections bulk operations (reconcile,
+	// audit, retries) work on concurrently (default: 4). Operations on the
+	// same connection always run one at a time.
+	Workers int
+
+	// BindAddress is the local address forwards listen on when a request
+	// doesn't name one ("" = ssh's default, normally loopback)
+	BindAddress string
+
+	// AllowLANBind permits bind addresses beyond loopback (e.g. 0.0.0.0),
+	// making forwards reachable from other machines. Off by default.
+	AllowLANBind bool
+
+	// IdleTimeout is how long a forward may go without traffic before
+	// RemoveIdle takes it down, unless the forward has its own. Zero
+	// disables idle removal of the rest.
+	IdleTimeout time.Duration
 }
 
 // New creates a new Forwarder
 func New(logger *slog.Logger, sshCmd string) *Forwarder {
-	return &Forwarder{
-		logger:   logger,
-		sshCmd:   sshCmd,
-		forwards: make(map[string]*Forward),
+	return NewWithOptions(logger, sshCmd, Options{})
+}
+
+// NewWithOptions creates a new Forwarder with the given options
+func NewWithOptions(logger *slog.Logger, sshCmd string, opts Options) *Forwarder {
+	portConflict := opts.PortConflict
+	if portConflict == "" {
+		portConflict = PortConflictFail
 	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	backend := opts.Backend
+	if backend == nil {
+		backend = NewOpenSSHBackend(sshCmd)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Forwarder{
+		logger:           logger,
+		backend:          backend,
+		portConflict:     portConflict,
+		accounting:       opts.Accounting,
+		workers:          workers,
+		bindAddress:      opts.BindAddress,
+		allowLANBind:     opts.AllowLANBind,
+		findExposedAddr:  exposedAddr,
+		checkListening:   isListening,
+		checkReachable:   isReachable,
+		onEvent:          opts.OnEvent,
+		forwards:         make(map[string]*Forward),
+		connLocks:        make(map[string]*sync.Mutex),
+		retryMaxAttempts: opts.RetryMaxAttempts,
+		retries:          make(map[string]*PendingRetry),
+		controlSockets:   newControlSocketCache(controlSocketCacheTTL, backend.Resolve),
+		lost:             make(map[string]*lostConnection),
+		reservedNames:    make(map[string]string),
+		ctx:              ctx,
+		cancel:           cancel,
+		idleTimeout:      opts.IdleTimeout,
+		establishedPorts: establishedLocalPorts,
+	}
+	f.checkConnection = f.checkControlConnection
+	if _, ok := backend.(ProcessBackend); ok {
+		// Its handles name connections, not socket files
+		f.controlSockets.verify = func(string) error { return nil }
+	}
+	return f
 }
 
 // AddForward creates a new port forward.
-// Returns (true, nil) when a new forward is established, (false, nil) when the
-// port was already forwarded, or (false, err) on failure.
-func (f *Forwarder) AddForward(socketPath string, connectionInfo string, remotePort, localPort int, host string) (bool, error) {
-	if host == "" {
-		host = "localhost"
+// Returns (localPort, true, nil) when a new forward is established,
+// (localPort, false, nil) when the port was already forwarded, or
+// (0, false, err) on failure. The returned local port may differ from the
+// requested one when the forwarder's port conflict strategy picked an
+// alternate.
+//
+// If ssh rejects the forward and retries are enabled, the forward is queued
+// for background retry and the returned error wraps ErrRetryQueued.
+func (f *Forwarder) AddForward(socketPath string, connectionInfo string, remotePort, localPort int, host string) (int, bool, error) {
+	return f.Add(Forward{
+		RemotePort:     remotePort,
+		LocalPort:      localPort,
+		Host:           host,
+		SocketPath:     socketPath,
+		ConnectionInfo: connectionInfo,
+	})
+}
+
+// AddSocketForward forwards a Unix socket on the remote machine (e.g.
+// /var/run/docker.sock) to a local TCP port. It otherwise behaves like
+// AddForward.
+func (f *Forwarder) AddSocketForward(socketPath string, connectionInfo string, remoteSocket string, localPort int) (int, bool, error) {
+	return f.Add(Forward{
+		LocalPort:      localPort,
+		RemoteSocket:   remoteSocket,
+		SocketPath:     socketPath,
+		ConnectionInfo: connectionInfo,
+	})
+}
+
+// Add establishes the forward described by want, which names the connection
+// (ConnectionInfo, optionally SocketPath), the remote end (Host and
+// RemotePort, or RemoteSocket), and the local end (LocalPort, or
+// LocalSocket). Host defaults to localhost and LocalPort to RemotePort. A
+// leading ~ in LocalSocket is expanded. It otherwise behaves like AddForward;
+// the returned local port is 0 for local socket forwards.
+func (f *Forwarder) Add(want Forward) (int, bool, error) {
+	fwd, err := f.normalize(want)
+	if err != nil {
+		return 0, false, err
 	}
-	if localPort == 0 {
-		localPort = remotePort
+	return f.addWithRetry(fwd)
+}
+
+// normalize validates a requested forward and fills in its defaults as
+// described on Add
+func (f *Forwarder) normalize(want Forward) (Forward, error) {
+	fwd := Forward{
+		RemotePort:     want.RemotePort,
+		LocalPort:      want.LocalPort,
+		Host:           want.Host,
+		RemoteSocket:   want.RemoteSocket,
+		LocalSocket:    want.LocalSocket,
+		Group:          want.Group,
+		SocketPath:     want.SocketPath,
+		Pinned:         want.Pinned,
+		BindAddress:    want.BindAddress,
+		Name:           want.Name,
+		Owner:          want.Owner,
+		AppProtocol:    want.AppProtocol,
+		Server:         want.Server,
+		Conflict:       want.Conflict,
+		IdleTimeout:    want.IdleTimeout,
+		ConnectionInfo: want.ConnectionInfo,
 	}
 
-	// Include connection info in key to support multiple SSH sessions
-	key := fmt.Sprintf("%s:%s:%d", connectionInfo, host, remotePort)
+	if fwd.Conflict != "" && !validPortConflictStrategy(fwd.Conflict) {
+		return Forward{}, fmt.Errorf("invalid port conflict policy %q (must be %s)", fwd.Conflict, protocol.ConflictPolicyNames())
+	}
+
+	if fwd.Name != "" {
+		if err := validateName(fwd.Name); err != nil {
+			return Forward{}, err
+		}
+	}
+
+	if fwd.Pinned && fwd.SocketPath == "" {
+		return Forward{}, fmt.Errorf("a pinned forward requires a control socket path")
+	}
+
+	if fwd.LocalSocket != "" {
+		fwd.BindAddress = ""
+	} else {
+		if fwd.BindAddress == "" {
+			fwd.BindAddress = f.bindAddress
+		}
+		if isSharedBindAddress(fwd.BindAddress) && !f.allowLANBind {
+			return Forward{}, fmt.Errorf("binding forwards to %s is not allowed; enable forwarder.allow_lan_bind to share forwards beyond loopback", fwd.BindAddress)
+		}
+	}
+
+	if fwd.RemoteSocket != "" {
+		if !strings.HasPrefix(fwd.RemoteSocket, "/") {
+			return Forward{}, fmt.Errorf("remote socket must be an absolute path: %q", fwd.RemoteSocket)
+		}
+		fwd.RemotePort = 0
+		fwd.Host = ""
+	} else {
+		// Hosts are stored bare and bracketed only when formatted
+		fwd.Host = protocol.NormalizeHost(fwd.Host)
+		if fwd.Host == "" {
+			fwd.Host = "localhost"
+		}
+	}
+
+	if fwd.LocalSocket != "" {
+		expanded, err := homedir.Expand(fwd.LocalSocket)
+		if err != nil {
+			return Forward{}, fmt.Errorf("failed to expand local socket path: %w", err)
+		}
+		if !filepath.IsAbs(expanded) {
+			return Forward{}, fmt.Errorf("local socket must be an absolute path: %q", fwd.LocalSocket)
+		}
+		fwd.LocalSocket = expanded
+		fwd.LocalPort = 0
+	} else if fwd.LocalPort == 0 {
+		if fwd.RemoteSocket != "" {
+			return Forward{}, fmt.Errorf("a local port or socket is required to forward remote socket %s", fwd.RemoteSocket)
+		}
+		fwd.LocalPort = fwd.RemotePort
+	}
+
+	return fwd, nil
+}
+
+// addWithRetry attempts a forward and queues it for retry if ssh rejects it
+func (f *Forwarder) addWithRetry(want Forward) (int, bool, error) {
+	port, created, err := f.addForward(want)
+	key := want.key()
+	if err == nil {
+		f.cancelRetry(key)
+		return port, created, nil
+	}
+
+	var sshErr *sshForwardError
+	if f.retryMaxAttempts == 0 || !errors.As(err, &sshErr) {
+		return 0, false, err
+	}
+
+	queued := f.enqueueRetry(key, PendingRetry{
+		SocketPath:     want.SocketPath,
+		ConnectionInfo: want.ConnectionInfo,
+		RemotePort:     want.RemotePort,
+		LocalPort:      want.LocalPort,
+		Host:           want.Host,
+		RemoteSocket:   want.RemoteSocket,
+		LocalSocket:    want.LocalSocket,
+		Group:          want.Group,
+		Pinned:         want.Pinned,
+		BindAddress:    want.BindAddress,
+		Name:           want.Name,
+		Owner:          want.Owner,
+		AppProtocol:    want.AppProtocol,
+		Server:         want.Server,
+		Conflict:       want.Conflict,
+		IdleTimeout:    want.IdleTimeout,
+	}, err)
+	if !queued {
+		return 0, false, err
+	}
+
+	f.logger.Warn("Forward failed, queued for retry",
+		"remote", want.RemoteTarget(),
+		"connectionInfo", want.ConnectionInfo,
+		"error", err,
+	)
+	return 0, false, fmt.Errorf("%w: %v", ErrRetryQueued, err)
+}
+
+// addForward performs a single attempt at establishing a forward described
+// by want. LocalPort is the requested port and may be replaced according to
+// the port conflict strategy. want must already be normalized by Add.
+func (f *Forwarder) addForward(want Forward) (int, bool, error) {
+	// Stealing removes a forward, possibly on this same connection, so it
+	// happens before taking the connection lock
+	stolen, err := f.stealLocalPort(want)
+	if err != nil {
+		return 0, false, err
+	}
+
+	localPort, created, err := f.establishForward(want, stolen)
+	if err != nil && stolen != nil {
+		f.giveBack(*stolen)
+	}
+	return localPort, created, err
+}
+
+// establishForward sets up want, once any forward holding its local port
+// has been stolen
+func (f *Forwarder) establishForward(want Forward, stolen *Forward) (int, bool, error) {
+	key := want.key()
+	connectionInfo := want.ConnectionInfo
+	var err error
+
+	// Don't interleave with a cancel/restore on the same connection
+	unlock := f.lockConnection(connectionInfo)
+	defer unlock()
 
 	// Check if already forwarded
 	f.mu.RLock()
 	if existing, ok := f.forwards[key]; ok {
+		localPort, name := existing.LocalPort, existing.Name
 		f.mu.RUnlock()
 		f.logger.Info("Port already forwarded",
-			"remote", fmt.Sprintf("%s:%d", host, remotePort),
-			"local", existing.LocalPort,
+			"remote", want.RemoteTarget(),
+			"local", existing.LocalTarget(),
 		)
-		return false, nil
+
+		// Naming an existing forward gives it the name
+		if want.Name != "" && want.Name != name {
+			release, err := f.reserveName(want.Name, key)
+			if err != nil {
+				return 0, false, err
+			}
+			defer release()
+			f.mu.Lock()
+			if existing, ok := f.forwards[key]; ok {
+				existing.Name = want.Name
+			}
+			f.mu.Unlock()
+		}
+		return localPort, false, nil
 	}
 	f.mu.RUnlock()
 
+	// Held until the forward is stored, so a forward on another connection
+	// can't take the name meanwhile
+	release, err := f.reserveName(want.Name, key)
+	if err != nil {
+		return 0, false, err
+	}
+	defer release()
+
+	forward := want
+	localPort := want.LocalPort
+
+	if forward.LocalSocket != "" {
+		// ssh refuses to bind over an existing socket file
+		if err := prepareLocalSocket(forward.LocalSocket); err != nil {
+			return 0, false, err
+		}
+	} else {
+		// Make sure the local port is available before asking SSH to bind it
+		strategy := f.conflictStrategy(want)
+		localPort, err = f.resolveLocalPort(want.LocalPort, strategy, key)
+		if err != nil {
+			return 0, false, err
+		}
+		if localPort != want.LocalPort {
+			f.logger.Info("Local port in use, using alternate",
+				"requested", want.LocalPort,
+				"local", localPort,
+				"strategy", strategy,
+			)
+		}
+		if localPort != want.LocalPort || stolen != nil {
+			forward.Resolution = &ConflictResolution{
+				Strategy:      strategy,
+				RequestedPort: want.LocalPort,
+			}
+			if stolen != nil {
+				forward.Resolution.Stolen = stolenName(*stolen)
+			}
+		}
+		forward.LocalPort = localPort
+	}
+
+	// With accounting, the relay claims the local port and ssh listens on a
+	// private loopback port behind it. Local sockets aren't relayed.
+	if f.accounting && forward.LocalSocket == "" {
+		sshPort, err := allocateLoopbackPort()
+		if err != nil {
+			return 0, false, err
+		}
+		r, err := startRelay(f.logger, forward.BindAddress, localPort, sshPort)
+		if err != nil {
+			return 0, false, err
+		}
+		forward.SSHPort = sshPort
+		forward.ListenAddress = forward.BindAddress
+		forward.BindAddress = auditBindAddress
+		forward.relay = r
+	}
+
 	// Execute SSH forward command
-	cmd := exec.Command(f.sshCmd,
-		"-O", "forward",
-		"-L", fmt.Sprintf("%d:%s:%d", localPort, host, remotePort),
-		connectionInfo,
-	)
+	cmd := f.forwardCommand(&forward)
 
 	f.logger.Info("Executing port forward",
 		"command", strings.Join(cmd.Args, " "),
-		"remote", fmt.Sprintf("%s:%d", host, remotePort),
-		"local", localPort,
-		"socketPath", socketPath,
+		"remote", forward.RemoteTarget(),
+		"local", forward.LocalTarget(),
+		"socketPath", forward.SocketPath,
 		"connectionInfo", connectionInfo,
 	)
 
-	output, err := cmd.CombinedOutput()
+	output, err := f.runForward(&forward, cmd)
 	if err != nil {
-		return false, fmt.Errorf("failed to forward port: %w (output: %s)", err, string(output))
+		if forward.relay != nil {
+			forward.relay.close()
+		}
+		// The master may be gone; don't hand out its socket again
+		f.controlSockets.invalidate(connectionInfo)
+		return 0, false, &sshForwardError{err: err, output: string(output)}
 	}
 
 	// Store forward info
-	forward := &Forward{
-		RemotePort:     remotePort,
-		LocalPort:      localPort,
-		Host:           host,
-		SocketPath:     socketPath,
-		ConnectionInfo: connectionInfo,
-		CreatedAt:      time.Now(),
-	}
+	forward.CreatedAt = time.Now()
 
 	f.mu.Lock()
-	f.forwards[key] = forward
+	f.forwards[key] = &forward
 	f.mu.Unlock()
 
 	f.logger.Info("Port forward established",
-		"remote", fmt.Sprintf("%s:%d", host, remotePort),
-		"local", localPort,
+		"remote", forward.RemoteTarget(),
+		"local", forward.LocalTarget(),
 	)
 
-	return true, nil
+	return localPort, true, nil
 }
 
 // RegisterExistingForward registers a forward that already exists (e.g., discovered on startup)
@@ -124,7 +603,7 @@ func (f *Forwarder) RegisterExistingForward(socketPath string, connectionInfo st
 	if existing, ok := f.forwards[key]; ok {
 		f.mu.RUnlock()
 		f.logger.Debug("Forward already registered",
-			"remote", fmt.Sprintf("%s:%d", host, remotePort),
+			"remote", existing.RemoteTarget(),
 			"local", existing.LocalPort,
 		)
 		return nil
@@ -146,7 +625,7 @@ func (f *Forwarder) RegisterExistingForward(socketPath string, connectionInfo st
 	f.mu.Unlock()
 
 	f.logger.Info("Registered existing forward",
-		"remote", fmt.Sprintf("%s:%d", host, remotePort),
+		"remote", forward.RemoteTarget(),
 		"local", localPort,
 		"connectionInfo", connectionInfo,
 	)
@@ -156,78 +635,221 @@ func (f *Forwarder) RegisterExistingForward(socketPath string, connectionInfo st
 
 // RemoveForward removes a port forward
 func (f *Forwarder) RemoveForward(connectionInfo string, remotePort int, host string) error {
-	if host == "" {
-		host = "localhost"
+	return f.Remove(Forward{ConnectionInfo: connectionInfo, RemotePort: remotePort, Host: host})
+}
+
+// RemoveSocketForward removes a forward of a remote Unix socket
+func (f *Forwarder) RemoveSocketForward(connectionInfo string, remoteSocket string) error {
+	return f.Remove(Forward{ConnectionInfo: connectionInfo, RemoteSocket: remoteSocket})
+}
+
+// Remove removes the forward of want's remote end (Host and RemotePort, or
+// RemoteSocket) on want.ConnectionInfo. When want.SocketPath is set only a
+// forward through that control socket matches; otherwise it is an error for
+// the connection to forward the same remote end through several sockets.
+func (f *Forwarder) Remove(want Forward) error {
+	key, err := f.removalKey(want)
+	if err != nil {
+		return err
 	}
+	return f.removeForward(want.ConnectionInfo, key)
+}
 
-	// Include connection info in key to support multiple SSH sessions
-	key := fmt.Sprintf("%s:%s:%d", connectionInfo, host, remotePort)
+// removalKey finds the key of the forward, pending retry, or lost forward
+// Remove would remove for want
+func (f *Forwarder) removalKey(want Forward) (string, error) {
+	want.Host = protocol.NormalizeHost(want.Host)
+	if want.RemoteSocket == "" && want.Host == "" {
+		want.Host = "localhost"
+	}
+	target := want.RemoteTarget()
+
+	sockets := make(map[string]string) // key -> control socket
+	match := func(key string, fwd Forward) {
+		if fwd.ConnectionInfo != want.ConnectionInfo || fwd.RemoteTarget() != target {
+			return
+		}
+		if want.SocketPath != "" && fwd.SocketPath != want.SocketPath {
+			return
+		}
+		sockets[key] = fwd.SocketPath
+	}
 
-	// Get forward info
 	f.mu.RLock()
-	forward, ok := f.forwards[key]
-	if !ok {
-		f.mu.RUnlock()
-		return fmt.Errorf("forward not found: %s", key)
+	for key, fwd := range f.forwards {
+		match(key, *fwd)
 	}
-	localPort := forward.LocalPort
 	f.mu.RUnlock()
 
-	// Execute SSH cancel command
-	// WARNING: OpenSSH has a limitation where -O cancel will cancel ALL remote
-	// socket forwards on the control socket, not just the specified one. This
-	// includes any Unix socket forwards (like .bankshot.sock). See below for our
-	// workaround to address this.
-	cmd := exec.Command(f.sshCmd,
-		"-O", "cancel",
-		"-L", fmt.Sprintf("%d:%s:%d", localPort, host, remotePort),
-		connectionInfo,
-	)
+	f.retryMu.Lock()
+	for key, r := range f.retries {
+		match(key, Forward{
+			ConnectionInfo: r.ConnectionInfo,
+			Host:           r.Host,
+			RemotePort:     r.RemotePort,
+			RemoteSocket:   r.RemoteSocket,
+			SocketPath:     r.SocketPath,
+		})
+	}
+	f.retryMu.Unlock()
 
-	f.logger.Info("Canceling port forward",
-		"command", strings.Join(cmd.Args, " "),
-		"remote", fmt.Sprintf("%s:%d", host, remotePort),
-		"local", localPort,
-	)
+	f.lostMu.Lock()
+	if entry, ok := f.lost[want.ConnectionInfo]; ok {
+		for _, fwd := range entry.forwards {
+			match(fwd.key(), fwd)
+		}
+	}
+	f.lostMu.Unlock()
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// Log but don't fail - forward might already be gone
-		f.logger.Warn("Failed to cancel port forward",
-			"error", err,
-			"output", string(output),
-		)
+	switch len(sockets) {
+	case 0:
+		return "", fmt.Errorf("forward not found: %s:%s", want.ConnectionInfo, target)
+	case 1:
+		for key := range sockets {
+			return key, nil
+		}
 	}
 
-	// Remove from map
-	f.mu.Lock()
-	delete(f.forwards, key)
-	f.mu.Unlock()
+	paths := make([]string, 0, len(sockets))
+	for _, path := range sockets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return "", fmt.Errorf("%s is forwarded from %s through several control sockets (%s); specify which one",
+		target, want.ConnectionInfo, strings.Join(paths, ", "))
+}
 
-	// Re-establish all configured forwards (including Unix socket forwards)
-	// This is necessary because SSH -O cancel removes ALL socket remote forwards
-	reestablishCmd := exec.Command(f.sshCmd, "-O", "forward", connectionInfo)
+// removeForward cancels the forward stored under key and restores the rest
+// of the connection's forwards
+func (f *Forwarder) removeForward(connectionInfo, key string) error {
+	return f.removeForwards(connectionInfo, []string{key})
+}
 
-	f.logger.Info("Re-establishing configured forwards after cancel",
-		"command", strings.Join(reestablishCmd.Args, " "),
-	)
+// removeForwards cancels the forwards stored under keys, all on one
+// connection, and then restores the rest of the connection's forwards once
+func (f *Forwarder) removeForwards(connectionInfo string, keys []string) error {
+	// Hold the connection lock across cancel and restore so no other
+	// operation on this control socket sees the intermediate state
+	unlock := f.lockConnection(connectionInfo)
+	defer unlock()
 
-	reestablishOutput, reestablishErr := reestablishCmd.CombinedOutput()
-	if reestablishErr != nil {
-		f.logger.Error("Failed to re-establish forwards",
-			"error", reestablishErr,
-			"output", string(reestablishOutput),
-		)
-		// Don't fail the operation - the forward was still removed
-	} else {
-		f.logger.Info("Successfully re-established configured forwards",
-			"output", string(reestablishOutput),
-		)
+	// Get forward info
+	var toCancel []Forward
+	var notFound []string
+	f.mu.RLock()
+	for _, key := range keys {
+		if existing, ok := f.forwards[key]; ok {
+			toCancel = append(toCancel, *existing)
+			continue
+		}
+		notFound = append(notFound, key)
+	}
+	f.mu.RUnlock()
+
+	// A forward still waiting to be retried, or held for a lost connection,
+	// has nothing to cancel. Keys that are gone altogether are reported once
+	// the rest are removed.
+	var missing []string
+	for _, key := range notFound {
+		if f.cancelRetry(key) {
+			f.logger.Info("Cancelled pending forward retry", "key", key)
+			continue
+		}
+		if f.forgetLost(connectionInfo, key) {
+			f.logger.Info("Forgot forward of lost connection", "key", key)
+			continue
+		}
+		missing = append(missing, key)
 	}
 
+	// OpenSSH only drops the forwards of the master a cancel is sent to, so
+	// cancel and restore per control socket
+	socketOrder, bySocket := groupBySocket(toCancel)
+	for _, socketPath := range socketOrder {
+		f.cancelForwards(connectionInfo, socketPath, bySocket[socketPath], keys)
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("forward not found: %s", strings.Join(missing, ", "))
+	}
 	return nil
 }
 
+// groupBySocket groups forwards by control socket, returning the sockets in
+// the order they first appear
+func groupBySocket(forwards []Forward) ([]string, map[string][]Forward) {
+	var order []string
+	bySocket := make(map[string][]Forward)
+	for _, fwd := range forwards {
+		if _, ok := bySocket[fwd.SocketPath]; !ok {
+			order = append(order, fwd.SocketPath)
+		}
+		bySocket[fwd.SocketPath] = append(bySocket[fwd.SocketPath], fwd)
+	}
+	return order, bySocket
+}
+
+// cancelForwards cancels forwards that all go through socketPath, then
+// restores the socket's remaining forwards. Callers must hold the connection
+// lock.
+func (f *Forwarder) cancelForwards(connectionInfo, socketPath string, toCancel []Forward, skipKeys []string) {
+	// Snapshot everything else this socket forwards before cancelling
+	snapshot := f.snapshotConnection(connectionInfo, socketPath, skipKeys...)
+
+	for _, forward := range toCancel {
+		// Execute SSH cancel command
+		// WARNING: OpenSSH has a limitation where -O cancel will cancel ALL remote
+		// socket forwards on the control socket, not just the specified one. This
+		// includes any Unix socket forwards (like .bankshot.sock). We restore them
+		// below from ssh_config and our snapshot.
+		f.logger.Info("Canceling port forward",
+			"backend", f.backend.Name(),
+			"remote", forward.RemoteTarget(),
+			"local", forward.LocalTarget(),
+		)
+
+		output, err := f.runCancel(&forward)
+		if err != nil {
+			// Log but don't fail - forward might already be gone
+			f.logger.Warn("Failed to cancel port forward",
+				"error", err,
+				"output", string(output),
+			)
+		}
+
+		// Remove from map
+		f.mu.Lock()
+		delete(f.forwards, forward.key())
+		f.mu.Unlock()
+
+		if forward.relay != nil {
+			forward.relay.close()
+		}
+
+		// ssh leaves the socket file behind when a local socket forward is cancelled
+		if forward.LocalSocket != "" {
+			if err := os.Remove(forward.LocalSocket); err != nil && !os.IsNotExist(err) {
+				f.logger.Warn("Failed to remove local socket", "path", forward.LocalSocket, "error", err)
+			}
+		}
+	}
+
+	// Restore configured and remaining tracked forwards. Failures are logged
+	// but don't fail the operation - the forward was still removed, and
+	// reconciliation will retry anything left broken.
+	f.restoreConnection(socketPath, connectionInfo, snapshot)
+}
+
+// forwardCommand builds the backend command that establishes fwd
+func (f *Forwarder) forwardCommand(fwd *Forward) *exec.Cmd {
+	return f.backend.ForwardCommand(fwd)
+}
+
+// cancelCommand builds the backend command that cancels fwd
+func (f *Forwarder) cancelCommand(fwd *Forward) *exec.Cmd {
+	return f.backend.CancelCommand(fwd)
+}
+
 // ListForwards returns all active forwards
 func (f *Forwarder) ListForwards() []*Forward {
 	f.mu.RLock()
@@ -240,55 +862,203 @@ func (f *Forwarder) ListForwards() []*Forward {
 	return forwards
 }
 
-// FindControlSocket finds the SSH ControlMaster socket for a given connection
+// Find returns a copy of the active forward Add would report for want
+func (f *Forwarder) Find(want Forward) (Forward, bool) {
+	fwd, err := f.normalize(want)
+	if err != nil {
+		return Forward{}, false
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if existing, ok := f.forwards[fwd.key()]; ok {
+		return *existing, true
+	}
+	return Forward{}, false
+}
+
+// Close shuts down any accounting relays and kills the backend commands
+// still running. The forwards themselves are left in place, SSH ones on
+// their control masters and a ProcessBackend's in their processes, for the
+// next daemon to find. Processes the next daemon couldn't adopt are stopped
+// instead.
+func (f *Forwarder) Close() {
+	f.cancel()
+
+	_, adoptable := f.backend.(processAdopter)
+	adoptable = adoptable && processesAdoptable
+
+	f.mu.Lock()
+	var relays []*relay
+	var procs []*forwardProcess
+	for _, fwd := range f.forwards {
+		if fwd.relay != nil {
+			relays = append(relays, fwd.relay)
+			fwd.relay = nil
+		}
+		if fwd.proc != nil && !adoptable {
+			procs = append(procs, fwd.proc)
+			fwd.proc = nil
+		}
+	}
+	f.mu.Unlock()
+
+	for _, r := range relays {
+		r.close()
+	}
+	for _, p := range procs {
+		p.stop()
+	}
+}
+
+// FindControlSocket finds the SSH ControlMaster socket for a given connection.
+// connectionInfo is normally an ssh destination, but remote sessions report
+// their own hostname, which may not match the alias used to reach a host
+// through a ProxyJump bastion. When the direct lookup fails, running control
+// masters are matched by the destination behind their jump hosts instead.
 func FindControlSocket(connectionInfo string) (string, error) {
-	// First, verify the connection is active
-	checkCmd := exec.Command("ssh", "-O", "check", connectionInfo)
+	return findControlSocket("ssh", connectionInfo)
+}
+
+// findControlSocket is FindControlSocket, asking sshCmd for the host's
+// ssh_config and whether its master is alive
+func findControlSocket(sshCmd, connectionInfo string) (string, error) {
+	controlPath, err := findDirectControlSocket(sshCmd, connectionInfo)
+	if err == nil {
+		return controlPath, nil
+	}
+
+	if controlPath, ok := findJumpedControlSocket(sshCmd, connectionInfo); ok {
+		return controlPath, nil
+	}
+
+	return "", err
+}
+
+// FindControlSocket is like the package-level FindControlSocket, but reuses
+// recent results for the same connection
+func (f *Forwarder) FindControlSocket(connectionInfo string) (string, error) {
+	return f.controlSockets.lookup(connectionInfo)
+}
+
+// controlSocketFor returns the control socket to use for fwd: its own for a
+// pinned forward, as long as that master still answers, otherwise the socket
+// its connection currently resolves to
+func (f *Forwarder) controlSocketFor(fwd *Forward) (string, error) {
+	if !fwd.Pinned {
+		return f.FindControlSocket(fwd.ConnectionInfo)
+	}
+	// A ProcessBackend's handle names the connection, not a socket file
+	if !f.isProcessBackend() {
+		if err := verifyControlSocket(fwd.SocketPath); err != nil {
+			return "", err
+		}
+	}
+	if err := f.checkConnection(fwd.SocketPath, fwd.ConnectionInfo); err != nil {
+		return "", err
+	}
+	return fwd.SocketPath, nil
+}
+
+// findDirectControlSocket resolves the control socket ssh itself would use
+// for connectionInfo
+func findDirectControlSocket(sshCmd, connectionInfo string) (string, error) {
+	// Use ssh -G to get the actual configuration
+	cfg, err := resolveSSHConfig(sshCmd, connectionInfo)
+	if err != nil {
+		return "", err
+	}
+
+	controlPath := cfg.ControlPath
+	if controlPath == "" {
+		// `bankshot ssh` starts masters for hosts ssh_config leaves without one
+		controlPath, err = cfg.defaultControlPath()
+		if err != nil || verifyControlSocket(controlPath) != nil {
+			return "", fmt.Errorf("no ControlPath configured for %s", connectionInfo)
+		}
+	}
+
+	// Verify the connection is active
+	checkCmd := exec.Command(sshCmd, "-O", "check", "-S", controlPath, connectionInfo)
 	if err := checkCmd.Run(); err != nil {
 		return "", fmt.Errorf("no active SSH connection to %s", connectionInfo)
 	}
 
-	// Use ssh -G to get the actual configuration
-	cmd := exec.Command("ssh", "-G", connectionInfo)
-	output, err := cmd.Output()
+	if err := verifyControlSocket(controlPath); err != nil {
+		return "", err
+	}
+
+	return controlPath, nil
+}
+
+// findJumpedControlSocket looks for a running control master whose
+// destination (reached through one or more jump hosts) matches
+// connectionInfo. Masters for the jump hosts themselves are never matched,
+// so forwards don't end up on the bastion's socket.
+func findJumpedControlSocket(sshCmd, connectionInfo string) (string, bool) {
+	masters, err := findJumpedMasters()
 	if err != nil {
-		return "", fmt.Errorf("failed to get SSH config for %s: %w", connectionInfo, err)
+		return "", false
 	}
+	// Without ssh_config for the host, masters are matched by name alone
+	cfg, _ := resolveSSHConfig(sshCmd, connectionInfo)
 
-	// Parse the output to find ControlPath
-	var controlPath string
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		parts := strings.Fields(line)
-		if len(parts) >= 2 && parts[0] == "controlpath" {
-			controlPath = strings.Join(parts[1:], " ")
-			break
+	for _, socket := range jumpedSockets(masters, connectionInfo, cfg) {
+		if err := verifyControlSocket(socket); err != nil {
+			continue
 		}
+		return socket, true
 	}
 
-	if controlPath == "" {
-		return "", fmt.Errorf("no ControlPath configured for %s", connectionInfo)
+	return "", false
+}
+
+// jumpedSockets returns the sockets of the masters whose destination is
+// connectionInfo, or the HostName ssh_config gives it. Those going through
+// the last jump host of its ProxyJump chain come first, so a host reached
+// through another bastion too is forwarded over the one its config names.
+func jumpedSockets(masters []jumpedMaster, connectionInfo string, cfg sshHostConfig) []string {
+	var lastHop string
+	if len(cfg.ProxyJump) > 0 {
+		lastHop = cfg.ProxyJump[len(cfg.ProxyJump)-1]
 	}
 
+	var viaChain, others []string
+	for _, m := range masters {
+		if !hostMatches(m.Destination, connectionInfo) && !hostMatches(m.Destination, cfg.Hostname) {
+			continue
+		}
+		if lastHop != "" && hostMatches(m.JumpHost, lastHop) {
+			viaChain = append(viaChain, m.SocketPath)
+		} else {
+			others = append(others, m.SocketPath)
+		}
+	}
+	// Masters are listed in no particular order
+	sort.Strings(viaChain)
+	sort.Strings(others)
+	return append(viaChain, others...)
+}
+
+// verifyControlSocket checks that path exists and is a socket
+func verifyControlSocket(controlPath string) error {
 	// The control path might contain % tokens that need to be expanded
 	// ssh -G should have already expanded them, but let's verify the socket exists
-	if _, err := os.Stat(controlPath); err != nil {
+	info, err := os.Stat(controlPath)
+	if err != nil {
 		if os.IsNotExist(err) {
-			return "", fmt.Errorf("control socket does not exist at %s", controlPath)
+			return fmt.Errorf("control socket does not exist at %s", controlPath)
 		}
-		return "", fmt.Errorf("failed to stat control socket: %w", err)
+		return fmt.Errorf("failed to stat control socket: %w", err)
 	}
 
 	// Verify it's actually a socket
-	info, err := os.Stat(controlPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to stat control socket: %w", err)
-	}
 	if info.Mode()&os.ModeSocket == 0 {
-		return "", fmt.Errorf("path %s exists but is not a socket", controlPath)
+		return fmt.Errorf("path %s exists but is not a socket", controlPath)
 	}
 
-	return controlPath, nil
+	return nil
 }
 
 // CleanupForSocket removes all forwards for a specific socket
@@ -297,53 +1067,38 @@ func (f *Forwarder) CleanupForSocket(socketPath string) {
 	var toRemove []struct {
 		key            string
 		connectionInfo string
-		host           string
-		port           int
 	}
 	for key, forward := range f.forwards {
 		if forward.SocketPath == socketPath {
 			toRemove = append(toRemove, struct {
 				key            string
 				connectionInfo string
-				host           string
-				port           int
 			}{
 				key:            key,
 				connectionInfo: forward.ConnectionInfo,
-				host:           forward.Host,
-				port:           forward.RemotePort,
 			})
 		}
 	}
 	f.mu.RUnlock()
 
 	for _, item := range toRemove {
-		_ = f.RemoveForward(item.connectionInfo, item.port, item.host)
+		_ = f.removeForward(item.connectionInfo, item.key)
 	}
 }
 
 // CleanupForConnection removes all forwards for a specific connection
 func (f *Forwarder) CleanupForConnection(connectionInfo string) {
 	f.mu.RLock()
-	var toRemove []struct {
-		host string
-		port int
-	}
-	for _, forward := range f.forwards {
+	var toRemove []string
+	for key, forward := range f.forwards {
 		if forward.ConnectionInfo == connectionInfo {
-			toRemove = append(toRemove, struct {
-				host string
-				port int
-			}{
-				host: forward.Host,
-				port: forward.RemotePort,
-			})
+			toRemove = append(toRemove, key)
 		}
 	}
 	f.mu.RUnlock()
 
-	for _, item := range toRemove {
-		_ = f.RemoveForward(connectionInfo, item.port, item.host)
+	for _, key := range toRemove {
+		_ = f.removeForward(connectionInfo, key)
 	}
 }
 
@@ -382,7 +1137,11 @@ func (f *Forwarder) Reconcile() error {
 	f.mu.RLock()
 	var staleForwards []*Forward
 	for _, fwd := range f.forwards {
-		if !portSet[fwd.LocalPort] {
+		stale := !portSet[fwd.sshLocalPort()]
+		if fwd.LocalSocket != "" {
+			stale = !isSocketListening(fwd.LocalSocket)
+		}
+		if stale {
 			// Make a copy to avoid holding the lock during SSH operations
 			fwdCopy := *fwd
 			staleForwards = append(staleForwards, &fwdCopy)
@@ -394,85 +1153,114 @@ func (f *Forwarder) Reconcile() error {
 		return nil
 	}
 
-	// Process each stale forward
+	// Process stale forwards concurrently across connections, serially
+	// within each one
 	var reestablished, removed int
 	var toRemove []string
+	var resultsMu sync.Mutex
 
-	for _, fwd := range staleForwards {
-		f.logger.Debug("Detected stale forward (port not listening)",
-			"connectionInfo", fwd.ConnectionInfo,
-			"remotePort", fwd.RemotePort,
-			"localPort", fwd.LocalPort,
-			"host", fwd.Host,
-		)
+	forEachConnection(f.workers, staleForwards, func(fwd *Forward) string {
+		return fwd.ConnectionInfo
+	}, func(connectionInfo string, group []*Forward) {
+		unlock := f.lockConnection(connectionInfo)
+		defer unlock()
 
-		// Check if SSH connection is still alive
-		socketPath, err := FindControlSocket(fwd.ConnectionInfo)
-		if err != nil {
-			// Connection is dead, mark for removal
-			f.logger.Info("Removing stale forward (SSH connection dead)",
+		for _, fwd := range group {
+			// Check if SSH connection is still alive
+			socketPath, connErr := f.controlSocketFor(fwd)
+
+			f.logger.Debug("Detected stale forward (port not listening)",
 				"connectionInfo", fwd.ConnectionInfo,
 				"remotePort", fwd.RemotePort,
 				"localPort", fwd.LocalPort,
-				"error", err,
+				"host", fwd.Host,
 			)
-			key := fmt.Sprintf("%s:%s:%d", fwd.ConnectionInfo, fwd.Host, fwd.RemotePort)
-			toRemove = append(toRemove, key)
-			removed++
-			continue
-		}
 
-		// SSH connection is alive, try to re-establish the forward
-		f.logger.Info("Re-establishing forward (SSH connection alive)",
-			"connectionInfo", fwd.ConnectionInfo,
-			"remotePort", fwd.RemotePort,
-			"localPort", fwd.LocalPort,
-			"host", fwd.Host,
-		)
+			key := fwd.key()
 
-		// Execute SSH forward command
-		cmd := exec.Command(f.sshCmd,
-			"-O", "forward",
-			"-L", fmt.Sprintf("%d:%s:%d", fwd.LocalPort, fwd.Host, fwd.RemotePort),
-			fwd.ConnectionInfo,
-		)
+			if connErr != nil {
+				// Connection is dead, mark for removal
+				f.logger.Info("Removing stale forward (SSH connection dead)",
+					"connectionInfo", fwd.ConnectionInfo,
+					"remotePort", fwd.RemotePort,
+					"localPort", fwd.LocalPort,
+					"error", connErr,
+				)
+				resultsMu.Lock()
+				toRemove = append(toRemove, key)
+				removed++
+				resultsMu.Unlock()
+				f.emit(EventDropped, *fwd, connErr.Error())
+				continue
+			}
 
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			f.logger.Warn("Failed to re-establish forward",
+			// SSH connection is alive, try to re-establish the forward
+			f.logger.Info("Re-establishing forward (SSH connection alive)",
 				"connectionInfo", fwd.ConnectionInfo,
 				"remotePort", fwd.RemotePort,
-				"error", err,
-				"output", string(output),
+				"localPort", fwd.LocalPort,
+				"host", fwd.Host,
 			)
-			// Don't remove it yet - maybe it will work next time
-			continue
-		}
 
-		// Update the forward with current info
-		f.mu.Lock()
-		key := fmt.Sprintf("%s:%s:%d", fwd.ConnectionInfo, fwd.Host, fwd.RemotePort)
-		if existing, ok := f.forwards[key]; ok {
-			existing.SocketPath = socketPath
-			existing.CreatedAt = time.Now()
-		}
-		f.mu.Unlock()
+			// Execute SSH forward command
+			current := *fwd
+			current.SocketPath = socketPath
+			output, err := f.runForward(&current, f.forwardCommand(&current))
+			if err != nil {
+				f.logger.Warn("Failed to re-establish forward",
+					"connectionInfo", fwd.ConnectionInfo,
+					"remotePort", fwd.RemotePort,
+					"error", err,
+					"output", string(output),
+				)
+				// Don't remove it yet - maybe it will work next time
+				continue
+			}
 
-		reestablished++
-		f.logger.Info("Successfully re-established forward",
-			"connectionInfo", fwd.ConnectionInfo,
-			"remotePort", fwd.RemotePort,
-			"localPort", fwd.LocalPort,
-		)
-	}
+			// Update the forward with current info. Only unpinned forwards
+			// can move sockets, and their key doesn't depend on it.
+			f.mu.Lock()
+			if existing, ok := f.forwards[key]; ok {
+				existing.SocketPath = socketPath
+				existing.CreatedAt = time.Now()
+				existing.proc = current.proc
+			}
+			f.mu.Unlock()
+
+			resultsMu.Lock()
+			reestablished++
+			resultsMu.Unlock()
+			f.emit(EventReestablished, *fwd, "local port was not listening")
+			f.logger.Info("Successfully re-established forward",
+				"connectionInfo", fwd.ConnectionInfo,
+				"remotePort", fwd.RemotePort,
+				"localPort", fwd.LocalPort,
+			)
+		}
+	})
 
 	// Remove forwards for dead connections
 	if len(toRemove) > 0 {
+		var relays []*relay
+		var procs []*forwardProcess
 		f.mu.Lock()
 		for _, key := range toRemove {
+			if fwd, ok := f.forwards[key]; ok && fwd.relay != nil {
+				relays = append(relays, fwd.relay)
+			}
+			if fwd, ok := f.forwards[key]; ok && fwd.proc != nil {
+				procs = append(procs, fwd.proc)
+			}
 			delete(f.forwards, key)
 		}
 		f.mu.Unlock()
+
+		for _, r := range relays {
+			r.close()
+		}
+		for _, p := range procs {
+			p.stop()
+		}
 	}
 
 	if reestablished > 0 || removed > 0 {
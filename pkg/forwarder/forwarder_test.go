@@ -1,12 +1,25 @@
 package forwarder
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/phinze/bankshot/pkg/process"
 )
 
 func TestNew(t *testing.T) {
@@ -19,14 +32,304 @@ func TestNew(t *testing.T) {
 	if f.logger == nil {
 		t.Error("New() created Forwarder with nil logger")
 	}
-	if f.sshCmd != "ssh" {
-		t.Errorf("New() sshCmd = %v, want %v", f.sshCmd, "ssh")
+	if b, ok := f.backend.(*OpenSSHBackend); !ok || b.sshCmd != "ssh" {
+		t.Errorf("New() backend = %#v, want OpenSSH running %v", f.backend, "ssh")
 	}
 	if f.forwards == nil {
 		t.Error("New() created Forwarder with nil forwards map")
 	}
 }
 
+// fakeBackend echoes the commands a forwarder asks it for
+type fakeBackend struct{}
+
+func (fakeBackend) Name() string {
+	return "fake"
+}
+
+func (fakeBackend) Resolve(string) (string, error) {
+	return "/tmp/fake.sock", nil
+}
+
+func (fakeBackend) ForwardCommand(fwd *Forward) *exec.Cmd {
+	return exec.Command("fake", "open", fwd.LocalTarget())
+}
+
+func (fakeBackend) CancelCommand(fwd *Forward) *exec.Cmd {
+	return exec.Command("fake", "close", fwd.LocalTarget())
+}
+
+func (fakeBackend) RestoreCommand(string, string) *exec.Cmd {
+	return nil
+}
+
+func (fakeBackend) CheckCommand(string, string) *exec.Cmd {
+	return exec.Command("true")
+}
+
+func (fakeBackend) ReadCommand(_, _, remotePath string) *exec.Cmd {
+	return exec.Command("cat", remotePath)
+}
+
+func TestBackend(t *testing.T) {
+	if b, err := NewBackend("", BackendConfig{SSHCommand: "ssh"}); err != nil || b.Name() != BackendOpenSSH {
+		t.Errorf("NewBackend(\"\") = %v, %v; want the OpenSSH backend", b, err)
+	}
+	if _, err := NewBackend("carrier-pigeon", BackendConfig{}); err == nil {
+		t.Error("NewBackend() with unknown name should error")
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	f := NewWithOptions(logger, "ssh", Options{Backend: fakeBackend{}})
+	if socket, err := f.FindControlSocket("devbox"); err != nil || socket != "/tmp/fake.sock" {
+		t.Errorf("FindControlSocket() = %q, %v; want the backend's handle", socket, err)
+	}
+
+	f.forwards["devbox:localhost:8080"] = &Forward{
+		RemotePort: 8080, LocalPort: 8080, Host: "localhost",
+		SocketPath: "/tmp/fake.sock", ConnectionInfo: "devbox",
+	}
+	f.forwards["devbox:localhost:3000"] = &Forward{
+		RemotePort: 3000, LocalPort: 3000, Host: "localhost",
+		SocketPath: "/tmp/fake.sock", ConnectionInfo: "devbox",
+	}
+	commands, err := f.PlanRemove(Forward{RemotePort: 8080, ConnectionInfo: "devbox"})
+	if err != nil {
+		t.Fatalf("PlanRemove() error: %v", err)
+	}
+	// No restore command, so just the cancel and the re-add of the other forward
+	want := []string{"fake close 8080", "fake open 3000"}
+	if strings.Join(commands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("PlanRemove() = %q, want %q", commands, want)
+	}
+}
+
+// sleepBackend runs each forward as a sleep process, like tsh would run it
+type sleepBackend struct {
+	fakeBackend
+	command string
+}
+
+func (b sleepBackend) ForwardCommand(*Forward) *exec.Cmd {
+	return exec.Command(b.command, "30")
+}
+
+func (sleepBackend) ReadyTimeout() time.Duration {
+	return time.Second
+}
+
+func TestProcessBackend(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep command not found")
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	port := freePortRange(t, 1)
+
+	f := NewWithOptions(logger, "ssh", Options{Backend: sleepBackend{command: "sleep"}})
+	f.checkListening = func(string, int) bool { return true }
+
+	if _, created, err := f.AddForward("", "devbox", port, port, ""); err != nil || !created {
+		t.Fatalf("AddForward() = %v, %v; want a new forward", created, err)
+	}
+	fwds := f.ListConnectionForwards("devbox")
+	if len(fwds) != 1 || fwds[0].proc == nil {
+		t.Fatalf("AddForward() should keep the forward's process, got %+v", fwds)
+	}
+	proc := fwds[0].proc
+
+	if err := f.RemoveForward("devbox", port, ""); err != nil {
+		t.Fatalf("RemoveForward() error: %v", err)
+	}
+	select {
+	case <-proc.done:
+	default:
+		t.Error("RemoveForward() should stop the forward's process")
+	}
+
+	// A process that exits before listening fails the forward
+	f = NewWithOptions(logger, "ssh", Options{Backend: sleepBackend{command: "false"}})
+	f.checkListening = func(string, int) bool { return false }
+	if _, _, err := f.AddForward("", "devbox", port, port, ""); err == nil {
+		t.Error("AddForward() should fail when the process exits early")
+	}
+}
+
+// adoptingBackend recognizes the sleep processes a sleepBackend with the
+// same duration starts
+type adoptingBackend struct {
+	sleepBackend
+	duration string
+}
+
+func (b adoptingBackend) ForwardCommand(*Forward) *exec.Cmd {
+	return exec.Command("sleep", b.duration)
+}
+
+func (b adoptingBackend) forwardFromArgs(args []string) (Forward, bool) {
+	if len(args) != 2 || filepath.Base(args[0]) != "sleep" || args[1] != b.duration {
+		return Forward{}, false
+	}
+	return Forward{RemotePort: 8080, LocalPort: 8080, Host: "localhost", ConnectionInfo: "devbox"}, true
+}
+
+func TestAdoptProcesses(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("listing processes' arguments needs /proc")
+	}
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep command not found")
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	backend := adoptingBackend{duration: fmt.Sprintf("%d.5", 60+os.Getpid()%1000)}
+
+	// A forward's process, as an earlier daemon would have left it
+	cmd := backend.ForwardCommand(nil)
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+	defer func() {
+		_ = cmd.Process.Kill()
+	}()
+
+	// One run from a shell, in its session, is the user's own
+	own := backend.ForwardCommand(nil)
+	if err := own.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = own.Process.Kill()
+		_ = own.Wait()
+	}()
+
+	f := NewWithOptions(logger, "ssh", Options{Backend: backend})
+	adopted, err := f.AdoptProcesses()
+	if err != nil || adopted != 1 {
+		t.Fatalf("AdoptProcesses() = %d, %v; want the detached process adopted", adopted, err)
+	}
+	fwds := f.ListConnectionForwards("devbox")
+	if len(fwds) != 1 || fwds[0].proc == nil || fwds[0].proc.pid() != cmd.Process.Pid {
+		t.Fatalf("AdoptProcesses() tracked %+v, want the forward of PID %d", fwds, cmd.Process.Pid)
+	}
+
+	if err := f.RemoveForward("devbox", 8080, ""); err != nil {
+		t.Fatalf("RemoveForward() error: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Error("RemoveForward() should stop the adopted process")
+	}
+}
+
+func TestTeleportBackend(t *testing.T) {
+	b := NewTeleportBackend("", "teleport.example.com:443")
+	fwd := &Forward{RemotePort: 8080, LocalPort: 9090, Host: "localhost", ConnectionInfo: "alice@devbox"}
+
+	want := "tsh --proxy=teleport.example.com:443 ssh -N -L 9090:localhost:8080 alice@devbox"
+	if got := commandLine(b.ForwardCommand(fwd)); got != want {
+		t.Errorf("ForwardCommand() = %q, want %q", got, want)
+	}
+	if got := commandLine(b.CheckCommand("", "alice@devbox")); got != "tsh --proxy=teleport.example.com:443 status" {
+		t.Errorf("CheckCommand() = %q", got)
+	}
+	if b.CancelCommand(fwd) != nil || b.RestoreCommand("", "alice@devbox") != nil {
+		t.Error("a tsh forward without a process has nothing to cancel or restore")
+	}
+	fwd.proc = &forwardProcess{adopted: process.Handle{PID: 4242}}
+	if got := commandLine(b.CancelCommand(fwd)); runtime.GOOS != "windows" && got != "kill -KILL 4242" {
+		t.Errorf("CancelCommand() = %q, want a kill of the forward's process", got)
+	}
+
+	if got := b.handle("alice@devbox"); got != "tsh:teleport.example.com:443/alice@devbox" {
+		t.Errorf("handle() = %q", got)
+	}
+	if got := NewTeleportBackend("", "").handle("devbox"); got != "tsh:devbox" {
+		t.Errorf("handle() without a proxy = %q", got)
+	}
+}
+
+func TestTeleportForwardFromArgs(t *testing.T) {
+	b := NewTeleportBackend("/usr/local/bin/tsh", "teleport.example.com:443")
+	forwards := []*Forward{
+		{RemotePort: 8080, LocalPort: 9090, Host: "localhost", ConnectionInfo: "alice@devbox"},
+		{RemotePort: 5432, LocalPort: 5432, Host: "db.internal", BindAddress: "127.0.0.1", ConnectionInfo: "devbox"},
+		{RemotePort: 3000, LocalPort: 3000, Host: "::1", BindAddress: "::1", ConnectionInfo: "devbox"},
+		{RemoteSocket: "/run/app.sock", LocalSocket: "/tmp/app.sock", ConnectionInfo: "devbox"},
+	}
+	for _, want := range forwards {
+		args := b.ForwardCommand(want).Args
+		args[0] = "tsh"
+		got, ok := b.forwardFromArgs(args)
+		if !ok {
+			t.Errorf("forwardFromArgs(%q) didn't recognize its own command", args)
+			continue
+		}
+		if got.key() != want.key() || got.LocalPort != want.LocalPort || got.BindAddress != want.BindAddress ||
+			got.LocalSocket != want.LocalSocket || got.SocketPath != b.handle(want.ConnectionInfo) {
+			t.Errorf("forwardFromArgs(%q) = %+v, want %+v", args, got, want)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"tsh", "ssh", "-N", "-L", "9090:localhost:8080", "devbox"},                                     // another proxy's
+		{"tsh", "--proxy=teleport.example.com:443", "ssh", "-L", "9090:localhost:8080", "devbox"},       // not -N
+		{"ssh", "--proxy=teleport.example.com:443", "ssh", "-N", "-L", "9090:localhost:8080", "devbox"}, // not tsh
+		{"tsh", "--proxy=teleport.example.com:443", "ssh", "-N", "-L", "localhost:8080", "devbox"},      // no listen port
+	} {
+		if fwd, ok := b.forwardFromArgs(args); ok {
+			t.Errorf("forwardFromArgs(%q) = %+v, want it left alone", args, fwd)
+		}
+	}
+}
+
+func TestReadCommand(t *testing.T) {
+	ssh := NewOpenSSHBackend("ssh")
+	want := "ssh -o BatchMode=yes -o ControlMaster=no -S /tmp/devbox.sock devbox cat -- '/home/me/it'\\''s.pdf'"
+	if got := commandLine(ssh.ReadCommand("/tmp/devbox.sock", "devbox", "/home/me/it's.pdf")); got != want {
+		t.Errorf("OpenSSH ReadCommand() = %q, want %q", got, want)
+	}
+
+	tsh := NewTeleportBackend("", "")
+	if got := commandLine(tsh.ReadCommand("", "alice@devbox", "/tmp/a.pdf")); got != "tsh ssh alice@devbox cat -- '/tmp/a.pdf'" {
+		t.Errorf("tsh ReadCommand() = %q", got)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	f := NewWithOptions(logger, "ssh", Options{Backend: fakeBackend{}})
+	f.controlSockets.resolve = func(string) (string, error) { return "/tmp/fake.sock", nil }
+	f.controlSockets.verify = func(string) error { return nil }
+
+	path := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.7"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := f.CopyFile(context.Background(), "devbox", path, &got, 1024); err != nil {
+		t.Fatalf("CopyFile() error: %v", err)
+	}
+	if got.String() != "%PDF-1.7" {
+		t.Errorf("CopyFile() copied %q", got.String())
+	}
+
+	if err := f.CopyFile(context.Background(), "devbox", "/dev/zero", io.Discard, 1<<20); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("CopyFile() of an endless file error = %v, want ErrFileTooLarge", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := f.CopyFile(ctx, "devbox", "/dev/zero", io.Discard, 1<<50); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CopyFile() past its deadline error = %v, want DeadlineExceeded", err)
+	}
+}
+
 func TestAddForward(t *testing.T) {
 	// Skip if ssh command is not available
 	if _, err := exec.LookPath("ssh"); err != nil {
@@ -76,7 +379,7 @@ func TestAddForward(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := f.AddForward(tt.socketPath, tt.connectionInfo, tt.remotePort, tt.localPort, tt.host)
+			_, _, err := f.AddForward(tt.socketPath, tt.connectionInfo, tt.remotePort, tt.localPort, tt.host)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("AddForward() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -344,3 +647,2011 @@ func TestKeyGeneration(t *testing.T) {
 		t.Errorf("Should support multiple connections to same port, got %v forwards", len(forwards))
 	}
 }
+
+func TestResolveLocalPort(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// Occupy a port so the strategies have a conflict to resolve
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+	busyPort := ln.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name     string
+		strategy PortConflictStrategy
+		wantErr  bool
+	}{
+		{name: "fail", strategy: PortConflictFail, wantErr: true},
+		{name: "next", strategy: PortConflictNext, wantErr: false},
+		{name: "random", strategy: PortConflictRandom, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewWithOptions(logger, "ssh", Options{PortConflict: tt.strategy})
+			got, err := f.resolveLocalPort(busyPort, tt.strategy, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveLocalPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got == busyPort {
+				t.Errorf("resolveLocalPort() = %v, want a port other than %v", got, busyPort)
+			}
+			if tt.strategy == PortConflictNext && !tt.wantErr && got <= busyPort {
+				t.Errorf("resolveLocalPort() = %v, want a port above %v", got, busyPort)
+			}
+		})
+	}
+}
+
+func TestStealLocalPort(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// The listener stands in for the local end of another connection's forward
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+	busyPort := ln.Addr().(*net.TCPAddr).Port
+
+	// "true" stands in for ssh so the cancel succeeds without a real connection
+	f := New(logger, "true")
+	f.checkListening = func(string, int) bool { return true }
+	holder := &Forward{
+		RemotePort:     busyPort,
+		LocalPort:      busyPort,
+		Host:           "localhost",
+		SocketPath:     "/tmp/other.sock",
+		ConnectionInfo: "other",
+	}
+	f.forwards[holder.key()] = holder
+
+	want := Forward{
+		RemotePort:     busyPort,
+		LocalPort:      busyPort,
+		Host:           "localhost",
+		SocketPath:     "/tmp/devbox.sock",
+		ConnectionInfo: "devbox",
+	}
+
+	// The default policy names the holder instead of stealing
+	if _, err := f.resolveLocalPort(busyPort, f.conflictStrategy(want), want.key()); err == nil || !strings.Contains(err.Error(), "other") {
+		t.Errorf("resolveLocalPort() error = %v, want it to name the holding forward", err)
+	}
+	if stolen, err := f.stealLocalPort(want); err != nil || stolen != nil {
+		t.Errorf("stealLocalPort() with fail policy = %+v, %v; want nothing stolen", stolen, err)
+	}
+
+	want.Conflict = PortConflictSteal
+	stolen, err := f.stealLocalPort(want)
+	if err != nil {
+		t.Fatalf("stealLocalPort() error: %v", err)
+	}
+	if wantStolen := fmt.Sprintf("other:localhost:%d", busyPort); stolen == nil || stolenName(*stolen) != wantStolen {
+		t.Errorf("stealLocalPort() = %+v, want %q", stolen, wantStolen)
+	}
+	if len(f.ListConnectionForwards("other")) != 0 {
+		t.Error("stealLocalPort() should remove the holding forward")
+	}
+
+	// With no tracked holder left there is nothing to steal
+	if stolen, err := f.stealLocalPort(want); err != nil || stolen != nil {
+		t.Errorf("stealLocalPort() with untracked holder = %+v, %v; want nothing stolen", stolen, err)
+	}
+
+	if _, err := f.normalize(Forward{RemotePort: 8080, ConnectionInfo: "devbox", Conflict: "borrow"}); err == nil {
+		t.Error("normalize() with unknown conflict policy should error")
+	}
+}
+
+// stealBackend fails devbox's forwards, and frees the port the test holds
+// in ssh's place when a forward is cancelled
+type stealBackend struct {
+	fakeBackend
+	release func()
+}
+
+func (stealBackend) ForwardCommand(fwd *Forward) *exec.Cmd {
+	if fwd.ConnectionInfo == "devbox" {
+		return exec.Command("false")
+	}
+	return exec.Command("true")
+}
+
+func (b stealBackend) CancelCommand(*Forward) *exec.Cmd {
+	b.release()
+	return exec.Command("true")
+}
+
+func TestStealGivesBackOnFailure(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+	busyPort := ln.Addr().(*net.TCPAddr).Port
+
+	f := NewWithOptions(logger, "ssh", Options{Backend: stealBackend{release: func() { _ = ln.Close() }}})
+	f.checkListening = func(string, int) bool { return true }
+	holder := &Forward{
+		RemotePort:     busyPort,
+		LocalPort:      busyPort,
+		Host:           "localhost",
+		SocketPath:     "/tmp/other.sock",
+		ConnectionInfo: "other",
+		Name:           "api",
+	}
+	f.forwards[holder.key()] = holder
+
+	want := Forward{
+		RemotePort:     busyPort,
+		LocalPort:      busyPort,
+		Host:           "localhost",
+		SocketPath:     "/tmp/devbox.sock",
+		ConnectionInfo: "devbox",
+		Conflict:       PortConflictSteal,
+	}
+	if _, _, err := f.addForward(want); err == nil {
+		t.Fatal("addForward() should fail when ssh rejects the forward")
+	}
+
+	back := f.ListConnectionForwards("other")
+	if len(back) != 1 || back[0].LocalPort != busyPort || back[0].Name != "api" {
+		t.Errorf("after a failed steal, other's forwards = %+v, want its forward of %d back", back, busyPort)
+	}
+	if len(f.ListConnectionForwards("devbox")) != 0 {
+		t.Error("a failed steal shouldn't leave devbox a forward")
+	}
+}
+
+func TestAudit(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// "true" stands in for ssh so re-binding succeeds without a real connection
+	f := New(logger, "true")
+	f.findExposedAddr = func(port int) string {
+		if port == 8081 {
+			return "192.168.1.5"
+		}
+		return ""
+	}
+
+	f.mu.Lock()
+	f.forwards["test-host:localhost:8080"] = &Forward{
+		RemotePort:     8080,
+		LocalPort:      8081,
+		Host:           "localhost",
+		ConnectionInfo: "test-host",
+		CreatedAt:      time.Now(),
+	}
+	f.forwards["test-host:localhost:9090"] = &Forward{
+		RemotePort:     9090,
+		LocalPort:      9091,
+		Host:           "localhost",
+		ConnectionInfo: "test-host",
+		CreatedAt:      time.Now(),
+	}
+	f.mu.Unlock()
+
+	violations := f.Audit(false)
+	if len(violations) != 1 {
+		t.Fatalf("Audit(false) violations = %v, want %v", len(violations), 1)
+	}
+	if violations[0].LocalPort != 8081 || violations[0].Corrected {
+		t.Errorf("Audit(false) violation = %+v, want uncorrected violation on 8081", violations[0])
+	}
+
+	violations = f.Audit(true)
+	if len(violations) != 1 || !violations[0].Corrected {
+		t.Fatalf("Audit(true) violations = %+v, want one corrected violation", violations)
+	}
+
+	f.mu.RLock()
+	bindAddress := f.forwards["test-host:localhost:8080"].BindAddress
+	f.mu.RUnlock()
+	if bindAddress != "127.0.0.1" {
+		t.Errorf("Audit(true) BindAddress = %q, want %q", bindAddress, "127.0.0.1")
+	}
+}
+
+func TestForwardSpec(t *testing.T) {
+	tests := []struct {
+		name        string
+		fwd         Forward
+		bindAddress string
+		want        string
+	}{
+		{
+			name: "tcp",
+			fwd:  Forward{RemotePort: 8080, LocalPort: 8081, Host: "localhost"},
+			want: "8081:localhost:8080",
+		},
+		{
+			name:        "tcp with bind address",
+			fwd:         Forward{RemotePort: 8080, LocalPort: 8081, Host: "localhost"},
+			bindAddress: "127.0.0.1",
+			want:        "127.0.0.1:8081:localhost:8080",
+		},
+		{
+			name: "relay port",
+			fwd:  Forward{RemotePort: 8080, LocalPort: 8081, SSHPort: 40000, Host: "localhost"},
+			want: "40000:localhost:8080",
+		},
+		{
+			name: "remote socket",
+			fwd:  Forward{LocalPort: 2375, RemoteSocket: "/var/run/docker.sock"},
+			want: "2375:/var/run/docker.sock",
+		},
+		{
+			name: "ipv6 host",
+			fwd:  Forward{RemotePort: 8080, LocalPort: 8080, Host: "::1"},
+			want: "8080:[::1]:8080",
+		},
+		{
+			name:        "ipv6 host and bind address",
+			fwd:         Forward{RemotePort: 5432, LocalPort: 15432, Host: "fd00::5"},
+			bindAddress: "::1",
+			want:        "[::1]:15432:[fd00::5]:5432",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fwd.forwardSpec(tt.bindAddress); got != tt.want {
+				t.Errorf("forwardSpec() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddForwardIPv6Host(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls.log")
+	sshPath := filepath.Join(dir, "ssh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$*\" >> %s\n", logPath)
+	if err := os.WriteFile(sshPath, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	port := freePortRange(t, 1)
+	f := New(logger, sshPath)
+
+	// Bracketed and bare literals name the same forward
+	if _, _, err := f.Add(Forward{ConnectionInfo: "devbox", RemotePort: port, Host: "[::1]"}); err != nil {
+		t.Fatalf("Add() error: %v", err)
+	}
+	if _, created, err := f.Add(Forward{ConnectionInfo: "devbox", RemotePort: port, Host: "::1"}); err != nil || created {
+		t.Errorf("Add() of the same forward = created %v, %v, want existing", created, err)
+	}
+
+	forwards := f.ListForwards()
+	if len(forwards) != 1 || forwards[0].RemoteTarget() != fmt.Sprintf("[::1]:%d", port) {
+		t.Fatalf("ListForwards() = %+v, want one forward to [::1]:%d", forwards, port)
+	}
+
+	if err := f.RemoveForward("devbox", port, "[::1]"); err != nil {
+		t.Fatalf("RemoveForward() error: %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read ssh call log: %v", err)
+	}
+	for _, want := range []string{
+		fmt.Sprintf("-O forward -L %d:[::1]:%d devbox", port, port),
+		fmt.Sprintf("-O cancel -L %d:[::1]:%d devbox", port, port),
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("ssh calls = %q, want %q", data, want)
+		}
+	}
+}
+
+func TestReconcileEmitsDroppedEvent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var events []Event
+	f := NewWithOptions(logger, "ssh", Options{
+		OnEvent: func(e Event) { events = append(events, e) },
+	})
+
+	// No SSH connection exists for this host, so the stale forward is dropped
+	f.mu.Lock()
+	f.forwards["bankshot-test-nohost:localhost:8080"] = &Forward{
+		RemotePort:     8080,
+		LocalPort:      1,
+		Host:           "localhost",
+		ConnectionInfo: "bankshot-test-nohost",
+		CreatedAt:      time.Now(),
+	}
+	f.mu.Unlock()
+
+	if err := f.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() unexpected error: %v", err)
+	}
+
+	if len(events) != 1 || events[0].Type != EventDropped {
+		t.Fatalf("Reconcile() events = %+v, want one %q event", events, EventDropped)
+	}
+	if len(f.ListForwards()) != 0 {
+		t.Errorf("Reconcile() should remove dropped forward")
+	}
+}
+
+func TestRemoveForwardRestoresRemaining(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// Fake ssh that records each invocation's arguments
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls.log")
+	sshPath := filepath.Join(dir, "ssh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$*\" >> %s\n", logPath)
+	if err := os.WriteFile(sshPath, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	f := New(logger, sshPath)
+	var verified []int
+	f.checkListening = func(bindAddress string, port int) bool {
+		verified = append(verified, port)
+		return port != 9091
+	}
+
+	f.mu.Lock()
+	for _, fwd := range []*Forward{
+		{RemotePort: 8080, LocalPort: 8080, Host: "localhost", ConnectionInfo: "test-host"},
+		{RemotePort: 9090, LocalPort: 9090, Host: "localhost", ConnectionInfo: "test-host"},
+		{RemotePort: 9091, LocalPort: 9091, Host: "localhost", ConnectionInfo: "test-host"},
+		{RemotePort: 7070, LocalPort: 7070, Host: "localhost", ConnectionInfo: "other-host"},
+	} {
+		f.forwards[fmt.Sprintf("%s:%s:%d", fwd.ConnectionInfo, fwd.Host, fwd.RemotePort)] = fwd
+	}
+	f.mu.Unlock()
+
+	if err := f.RemoveForward("test-host", 8080, "localhost"); err != nil {
+		t.Fatalf("RemoveForward() unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read ssh call log: %v", err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	if len(calls) != 4 {
+		t.Fatalf("ssh called %d times, want 4: %q", len(calls), calls)
+	}
+	if calls[0] != "-O cancel -L 8080:localhost:8080 test-host" {
+		t.Errorf("first call = %q, want cancel of removed forward", calls[0])
+	}
+	if calls[1] != "-O forward test-host" {
+		t.Errorf("second call = %q, want configured forward restore", calls[1])
+	}
+
+	restored := map[string]bool{}
+	for _, call := range calls[2:] {
+		restored[call] = true
+	}
+	for _, want := range []string{
+		"-O forward -L 9090:localhost:9090 test-host",
+		"-O forward -L 9091:localhost:9091 test-host",
+	} {
+		if !restored[want] {
+			t.Errorf("missing restore call %q in %q", want, calls)
+		}
+	}
+
+	if len(verified) != 2 {
+		t.Errorf("verified %d forwards, want 2", len(verified))
+	}
+
+	// Remaining forwards stay tracked even if verification failed, so
+	// reconciliation can retry them
+	if got := len(f.ListConnectionForwards("test-host")); got != 2 {
+		t.Errorf("test-host forwards after remove = %d, want 2", got)
+	}
+	if got := len(f.ListConnectionForwards("other-host")); got != 1 {
+		t.Errorf("other-host forwards after remove = %d, want 1", got)
+	}
+}
+
+func TestPlanRunsNothing(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls.log")
+	sshPath := filepath.Join(dir, "ssh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$*\" >> %s\n", logPath)
+	if err := os.WriteFile(sshPath, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	f := New(logger, sshPath)
+	f.mu.Lock()
+	for _, fwd := range []*Forward{
+		{RemotePort: 8080, LocalPort: 8080, Host: "localhost", SocketPath: "/tmp/sock", ConnectionInfo: "test-host"},
+		{RemotePort: 9090, LocalPort: 9090, Host: "localhost", SocketPath: "/tmp/sock", ConnectionInfo: "test-host"},
+		{RemotePort: 9091, LocalPort: 9091, Host: "localhost", SocketPath: "/tmp/sock", ConnectionInfo: "test-host"},
+	} {
+		f.forwards[fwd.key()] = fwd
+	}
+	f.mu.Unlock()
+
+	commands, err := f.PlanRemove(Forward{ConnectionInfo: "test-host", RemotePort: 8080})
+	if err != nil {
+		t.Fatalf("PlanRemove() error: %v", err)
+	}
+	want := []string{
+		sshPath + " -O cancel -L 8080:localhost:8080 -S /tmp/sock test-host",
+		sshPath + " -O forward -S /tmp/sock test-host",
+		sshPath + " -O forward -L 9090:localhost:9090 -S /tmp/sock test-host",
+		sshPath + " -O forward -L 9091:localhost:9091 -S /tmp/sock test-host",
+	}
+	if fmt.Sprint(commands) != fmt.Sprint(want) {
+		t.Errorf("PlanRemove() = %q, want %q", commands, want)
+	}
+
+	if _, err := f.PlanRemove(Forward{ConnectionInfo: "test-host", RemotePort: 1234}); err == nil {
+		t.Error("PlanRemove() of an unknown forward should error")
+	}
+
+	port := freePortRange(t, 1)
+	commands, err = f.PlanAdd(Forward{ConnectionInfo: "test-host", RemotePort: port, SocketPath: "/tmp/sock"})
+	if err != nil {
+		t.Fatalf("PlanAdd() error: %v", err)
+	}
+	wantAdd := fmt.Sprintf("%s -O forward -L %d:localhost:%d -S /tmp/sock test-host", sshPath, port, port)
+	if len(commands) != 1 || commands[0] != wantAdd {
+		t.Errorf("PlanAdd() = %q, want [%q]", commands, wantAdd)
+	}
+
+	// Planning an existing forward needs nothing
+	commands, err = f.PlanAdd(Forward{ConnectionInfo: "test-host", RemotePort: 9090, SocketPath: "/tmp/sock"})
+	if err != nil || len(commands) != 0 {
+		t.Errorf("PlanAdd() of existing forward = %q, %v, want no commands", commands, err)
+	}
+
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Error("planning ran ssh")
+	}
+	if got := len(f.ListForwards()); got != 3 {
+		t.Errorf("ListForwards() has %d forwards after planning, want 3", got)
+	}
+}
+
+func TestRelayCountsTraffic(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// Echo server standing in for the ssh-forwarded port
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer func() { _ = target.Close() }()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(conn, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	listenPort, err := allocateLoopbackPort()
+	if err != nil {
+		t.Fatalf("allocateLoopbackPort() error: %v", err)
+	}
+	r, err := startRelay(logger, "", listenPort, target.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		t.Fatalf("startRelay() error: %v", err)
+	}
+	defer r.close()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", listenPort))
+	if err != nil {
+		t.Fatalf("failed to dial relay: %v", err)
+	}
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	_ = conn.(*net.TCPConn).CloseWrite()
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	_ = conn.Close()
+	if string(reply) != "hello" {
+		t.Errorf("reply = %q, want %q", reply, "hello")
+	}
+
+	// Counters are updated as each direction finishes
+	deadline := time.Now().Add(2 * time.Second)
+	var stats Stats
+	for time.Now().Before(deadline) {
+		stats = r.stats()
+		if stats.ActiveConnections == 0 && stats.BytesReceived == 5 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	want := Stats{BytesSent: 5, BytesReceived: 5, Connections: 1, ActiveConnections: 0}
+	if stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestAddForwardWithAccounting(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	f := NewWithOptions(logger, "true", Options{Accounting: true})
+	defer f.Close()
+
+	localPort, err := allocateLoopbackPort()
+	if err != nil {
+		t.Fatalf("allocateLoopbackPort() error: %v", err)
+	}
+
+	got, created, err := f.AddForward("/tmp/test.sock", "test-host", 8080, localPort, "localhost")
+	if err != nil {
+		t.Fatalf("AddForward() error: %v", err)
+	}
+	if !created || got != localPort {
+		t.Fatalf("AddForward() = (%d, %v), want (%d, true)", got, created, localPort)
+	}
+
+	fwd := f.ListForwards()[0]
+	if fwd.SSHPort == 0 || fwd.SSHPort == localPort {
+		t.Errorf("SSHPort = %d, want a separate relay target port", fwd.SSHPort)
+	}
+	if fwd.BindAddress != "127.0.0.1" {
+		t.Errorf("BindAddress = %q, want 127.0.0.1", fwd.BindAddress)
+	}
+	if _, ok := fwd.Stats(); !ok {
+		t.Error("Stats() ok = false, want true with accounting enabled")
+	}
+	if isLocalPortFree(localPort) {
+		t.Error("relay is not listening on the local port")
+	}
+
+	if err := f.RemoveForward("test-host", 8080, "localhost"); err != nil {
+		t.Fatalf("RemoveForward() error: %v", err)
+	}
+	if !isLocalPortFree(localPort) {
+		t.Error("relay still listening after RemoveForward()")
+	}
+}
+
+func TestAddForwardQueuesRetry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// Fake ssh that fails until a marker file exists
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ok")
+	sshPath := filepath.Join(dir, "ssh")
+	script := fmt.Sprintf("#!/bin/sh\n[ -e %s ] || { echo 'mux_client_forward: control socket busy' >&2; exit 255; }\n", marker)
+	if err := os.WriteFile(sshPath, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	var events []Event
+	f := NewWithOptions(logger, sshPath, Options{
+		RetryMaxAttempts: 2,
+		OnEvent:          func(e Event) { events = append(events, e) },
+	})
+
+	localPort, err := allocateLoopbackPort()
+	if err != nil {
+		t.Fatalf("allocateLoopbackPort() error: %v", err)
+	}
+
+	_, _, err = f.AddForward("/tmp/test.sock", "test-host", 8080, localPort, "localhost")
+	if !errors.Is(err, ErrRetryQueued) {
+		t.Fatalf("AddForward() error = %v, want ErrRetryQueued", err)
+	}
+
+	pending := f.PendingRetries()
+	if len(pending) != 1 || pending[0].Attempts != 1 {
+		t.Fatalf("PendingRetries() = %+v, want one entry with 1 attempt", pending)
+	}
+
+	// Not yet due: nothing happens
+	f.ProcessRetries()
+	if got := f.PendingRetries()[0].Attempts; got != 1 {
+		t.Errorf("attempts before backoff elapsed = %d, want 1", got)
+	}
+
+	// Due and still failing: re-queued with a longer backoff
+	f.retries["test-host:localhost:8080"].NextAttempt = time.Now()
+	f.ProcessRetries()
+	pending = f.PendingRetries()
+	if len(pending) != 1 || pending[0].Attempts != 2 {
+		t.Fatalf("PendingRetries() after failed retry = %+v, want 2 attempts", pending)
+	}
+	if wait := time.Until(pending[0].NextAttempt); wait <= retryInitialBackoff {
+		t.Errorf("backoff after second failure = %v, want > %v", wait, retryInitialBackoff)
+	}
+
+	// Due and ssh recovered: forward established and dequeued
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		t.Fatalf("failed to write marker: %v", err)
+	}
+	f.retries["test-host:localhost:8080"].NextAttempt = time.Now()
+	f.ProcessRetries()
+	if got := len(f.PendingRetries()); got != 0 {
+		t.Errorf("PendingRetries() after success = %d entries, want 0", got)
+	}
+	if got := len(f.ListForwards()); got != 1 {
+		t.Errorf("ListForwards() after success = %d, want 1", got)
+	}
+	if len(events) != 0 {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var events []Event
+	f := NewWithOptions(logger, "false", Options{
+		RetryMaxAttempts: 1,
+		OnEvent:          func(e Event) { events = append(events, e) },
+	})
+
+	localPort, err := allocateLoopbackPort()
+	if err != nil {
+		t.Fatalf("allocateLoopbackPort() error: %v", err)
+	}
+
+	if _, _, err := f.AddForward("/tmp/test.sock", "test-host", 8080, localPort, "localhost"); !errors.Is(err, ErrRetryQueued) {
+		t.Fatalf("AddForward() error = %v, want ErrRetryQueued", err)
+	}
+
+	f.retries["test-host:localhost:8080"].NextAttempt = time.Now()
+	f.ProcessRetries()
+
+	if got := len(f.PendingRetries()); got != 0 {
+		t.Errorf("PendingRetries() after exhaustion = %d entries, want 0", got)
+	}
+	if len(events) != 1 || events[0].Type != EventRetryExhausted {
+		t.Errorf("events = %+v, want one %s event", events, EventRetryExhausted)
+	}
+}
+
+func TestRemoveForwardCancelsRetry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	f := NewWithOptions(logger, "false", Options{RetryMaxAttempts: 3})
+
+	localPort, err := allocateLoopbackPort()
+	if err != nil {
+		t.Fatalf("allocateLoopbackPort() error: %v", err)
+	}
+
+	if _, _, err := f.AddForward("/tmp/test.sock", "test-host", 8080, localPort, "localhost"); !errors.Is(err, ErrRetryQueued) {
+		t.Fatalf("AddForward() error = %v, want ErrRetryQueued", err)
+	}
+
+	if err := f.RemoveForward("test-host", 8080, "localhost"); err != nil {
+		t.Fatalf("RemoveForward() error: %v", err)
+	}
+	if got := len(f.PendingRetries()); got != 0 {
+		t.Errorf("PendingRetries() after remove = %d entries, want 0", got)
+	}
+}
+
+func TestParseSSHConfig(t *testing.T) {
+	output := `user alice
+hostname devbox.internal.example.com
+port 22
+proxyjump alice@bastion.example.com:2222,[fe80::1]:22
+controlpath /home/alice/.ssh/cm-abc123
+localforward 8080 [localhost]:3000
+localforward [127.0.0.1]:15432 [db.internal]:5432
+localforward /tmp/docker.sock /var/run/docker.sock
+`
+	cfg := parseSSHConfig(output)
+
+	if cfg.Hostname != "devbox.internal.example.com" {
+		t.Errorf("Hostname = %q", cfg.Hostname)
+	}
+	if cfg.User != "alice" || cfg.Port != 22 {
+		t.Errorf("User/Port = %q/%d", cfg.User, cfg.Port)
+	}
+	if cfg.ControlPath != "/home/alice/.ssh/cm-abc123" {
+		t.Errorf("ControlPath = %q", cfg.ControlPath)
+	}
+	wantJump := []string{"bastion.example.com", "fe80::1"}
+	if fmt.Sprint(cfg.ProxyJump) != fmt.Sprint(wantJump) {
+		t.Errorf("ProxyJump = %v, want %v", cfg.ProxyJump, wantJump)
+	}
+
+	wantForwards := []configuredForward{
+		{LocalPort: 8080, RemoteHost: "localhost", RemotePort: 3000},
+		{LocalPort: 15432, RemoteHost: "db.internal", RemotePort: 5432},
+	}
+	if fmt.Sprint(cfg.LocalForwards) != fmt.Sprint(wantForwards) {
+		t.Errorf("LocalForwards = %v, want %v", cfg.LocalForwards, wantForwards)
+	}
+
+	none := parseSSHConfig("controlpath none\nproxyjump none\n")
+	if none.ControlPath != "" || none.ProxyJump != nil {
+		t.Errorf("parseSSHConfig(none) = %+v, want empty ControlPath and ProxyJump", none)
+	}
+}
+
+func TestDefaultControlPath(t *testing.T) {
+	cfg := sshHostConfig{User: "alice", Hostname: "devbox.example.com", Port: 2222}
+
+	got, err := cfg.defaultControlPath()
+	if err != nil {
+		t.Fatalf("defaultControlPath() error = %v", err)
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, ".ssh", "bankshot-alice@devbox.example.com:2222"); got != want {
+		t.Errorf("defaultControlPath() = %q, want %q", got, want)
+	}
+}
+
+func TestSocketHosts(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/tmp/ssh-alice@devbox:22", []string{"alice@devbox", "devbox"}},
+		{"/home/alice/.ssh/bankshot-alice@devbox.example.com:2222", []string{"alice@devbox.example.com", "devbox.example.com"}},
+		{"/tmp/alice@devbox", []string{"alice@devbox", "devbox"}},
+		{"/home/alice/.ssh/cm-3f2a9c", nil},
+		{"/tmp/ssh_mux_devbox_22_alice", nil},
+	}
+
+	for _, tt := range tests {
+		if got := socketHosts(tt.path); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("socketHosts(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseRemoteListeners(t *testing.T) {
+	ss := `LISTEN 0      4096       127.0.0.1:3000       0.0.0.0:*
+LISTEN 0      128           [::1]:5173          [::]:*
+LISTEN 0      128               *:8080             *:*
+`
+	netstat := `Active Internet connections (only servers)
+Proto Recv-Q Send-Q Local Address           Foreign Address         State
+tcp        0      0 127.0.0.1:6379          0.0.0.0:*               LISTEN
+tcp6       0      0 :::9000                 :::*                    LISTEN
+`
+	tests := []struct {
+		name   string
+		output string
+		want   []int
+	}{
+		{"ss", ss, []int{3000, 5173, 8080}},
+		{"netstat", netstat, []int{6379, 9000}},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRemoteListeners(tt.output)
+			if len(got) != len(tt.want) {
+				t.Errorf("parseRemoteListeners() = %v, want %v", got, tt.want)
+			}
+			for _, port := range tt.want {
+				if !got[port] {
+					t.Errorf("parseRemoteListeners() missing port %d", port)
+				}
+			}
+		})
+	}
+}
+
+func TestCloseStopsBackendCommands(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// An ssh stuck on an unresponsive master
+	dir := t.TempDir()
+	sshPath := filepath.Join(dir, "ssh")
+	if err := os.WriteFile(sshPath, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+	f := New(logger, sshPath)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- f.checkControlConnection("/tmp/fake.sock", "devbox")
+	}()
+	time.Sleep(100 * time.Millisecond)
+	f.Close()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("checkControlConnection() = nil after Close killed it")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend command still running after Close")
+	}
+
+	if _, err := f.runCommand(exec.Command(sshPath)); !errors.Is(err, errForwarderClosed) {
+		t.Errorf("runCommand() after Close = %v, want errForwarderClosed", err)
+	}
+}
+
+func TestQueryRemoteListenersSSHCommand(t *testing.T) {
+	dir := t.TempDir()
+	sshPath := filepath.Join(dir, "my-ssh")
+	script := "#!/bin/sh\necho 'LISTEN 0 4096 127.0.0.1:3000 0.0.0.0:*'\n"
+	if err := os.WriteFile(sshPath, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	listeners, err := queryRemoteListeners(sshPath, "/tmp/fake.sock", "devbox")
+	if err != nil || !listeners[3000] {
+		t.Errorf("queryRemoteListeners() = %v, %v, want port 3000 from the configured ssh", listeners, err)
+	}
+
+	// Only OpenSSH's control masters can be inspected
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	f := NewWithOptions(logger, sshPath, Options{Backend: fakeBackend{}})
+	if forwards, err := f.DiscoverActiveForwards(); err != nil || forwards != nil {
+		t.Errorf("DiscoverActiveForwards() = %v, %v with another backend, want none", forwards, err)
+	}
+}
+
+func TestParseJumpedMasters(t *testing.T) {
+	processes := []processInfo{
+		{PID: 101, PPID: 1, Args: []string{"ssh:", "/home/alice/.ssh/cm-devbox", "[mux]"}},
+		{PID: 102, PPID: 101, Args: []string{"ssh", "-W", "[devbox.internal]:22", "bastion"}},
+		{PID: 201, PPID: 1, Args: []string{"ssh:", "/home/alice/.ssh/cm-bastion", "[mux]"}},
+		{PID: 301, PPID: 1, Args: []string{"ssh:", "/home/alice/.ssh/cm-direct", "[mux]"}},
+		{PID: 401, PPID: 400, Args: []string{"/usr/bin/ssh", "-J", "hop1", "-W", "db:5432", "hop2"}},
+	}
+
+	masters := parseJumpedMasters(processes)
+	if len(masters) != 1 {
+		t.Fatalf("parseJumpedMasters() = %+v, want only the jumped master", masters)
+	}
+
+	m := masters[0]
+	if m.PID != 101 || m.SocketPath != "/home/alice/.ssh/cm-devbox" {
+		t.Errorf("master = %+v, want pid 101 on cm-devbox", m)
+	}
+	if m.Destination != "devbox.internal" || m.JumpHost != "bastion" {
+		t.Errorf("destination/jump = %q/%q, want devbox.internal/bastion", m.Destination, m.JumpHost)
+	}
+}
+
+func TestJumpedSockets(t *testing.T) {
+	masters := []jumpedMaster{
+		{SocketPath: "/s/via-other", Destination: "devbox.internal", JumpHost: "other-bastion"},
+		{SocketPath: "/s/via-bastion", Destination: "devbox.internal", JumpHost: "bastion"},
+		{SocketPath: "/s/db", Destination: "db", JumpHost: "bastion"},
+	}
+
+	tests := []struct {
+		name           string
+		connectionInfo string
+		cfg            sshHostConfig
+		want           []string
+	}{
+		{"configured chain first", "devbox", sshHostConfig{Hostname: "devbox.internal", ProxyJump: []string{"edge", "bastion"}},
+			[]string{"/s/via-bastion", "/s/via-other"}},
+		{"by HostName", "dev", sshHostConfig{Hostname: "devbox.internal", ProxyJump: []string{"other-bastion"}},
+			[]string{"/s/via-other", "/s/via-bastion"}},
+		{"no ssh_config", "devbox", sshHostConfig{}, []string{"/s/via-bastion", "/s/via-other"}},
+		{"no match", "web", sshHostConfig{Hostname: "web.internal"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jumpedSockets(masters, tt.connectionInfo, tt.cfg); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("jumpedSockets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestControlMasters(t *testing.T) {
+	processes := []processInfo{
+		// A master's title overwrites argv in place
+		{PID: 101, Args: titleArgs([]string{"ssh: /tmp/ssh_mux_devbox_22_alice [mux]", "", ""})},
+		{PID: 102, Args: titleArgs([]string{"ssh", "-N", "devbox"})},
+		{PID: 103, Args: titleArgs([]string{"/bin/sh", "-c", "ssh: not a master [mux]"})},
+	}
+
+	masters := controlMasters(processes)
+	if len(masters) != 1 {
+		t.Fatalf("controlMasters() = %+v, want one master", masters)
+	}
+	if masters[0].PID != 101 || masters[0].SocketPath != "/tmp/ssh_mux_devbox_22_alice" || masters[0].ConnectionInfo != "devbox" {
+		t.Errorf("master = %+v, want pid 101 for devbox", masters[0])
+	}
+}
+
+func TestListeningPorts(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	ports, err := listeningPorts(os.Getpid())
+	if err != nil {
+		t.Fatalf("listeningPorts() error: %v", err)
+	}
+	found := false
+	for _, p := range ports {
+		found = found || p == port
+	}
+	if !found {
+		t.Errorf("listeningPorts() = %v, want it to include %d", ports, port)
+	}
+}
+
+func TestHostMatches(t *testing.T) {
+	tests := []struct {
+		destination    string
+		connectionInfo string
+		want           bool
+	}{
+		{"devbox", "devbox", true},
+		{"devbox.internal.example.com", "devbox", true},
+		{"DevBox", "devbox.example.com", true},
+		{"bastion", "devbox", false},
+		{"", "devbox", false},
+	}
+
+	for _, tt := range tests {
+		if got := hostMatches(tt.destination, tt.connectionInfo); got != tt.want {
+			t.Errorf("hostMatches(%q, %q) = %v, want %v", tt.destination, tt.connectionInfo, got, tt.want)
+		}
+	}
+}
+
+func TestForEachConnection(t *testing.T) {
+	type item struct {
+		conn string
+		seq  int
+	}
+	var items []item
+	for seq := 0; seq < 5; seq++ {
+		for _, conn := range []string{"a", "b", "c", "d"} {
+			items = append(items, item{conn: conn, seq: seq})
+		}
+	}
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	seen := make(map[string][]int)
+
+	forEachConnection(2, items, func(i item) string { return i.conn }, func(conn string, group []item) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		for _, i := range group {
+			if i.conn != conn {
+				t.Errorf("item for %q handed to group %q", i.conn, conn)
+			}
+			mu.Lock()
+			seen[conn] = append(seen[conn], i.seq)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+		}
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	if maxRunning > 2 {
+		t.Errorf("max concurrent groups = %d, want <= 2", maxRunning)
+	}
+	for _, conn := range []string{"a", "b", "c", "d"} {
+		if fmt.Sprint(seen[conn]) != "[0 1 2 3 4]" {
+			t.Errorf("connection %q processed %v, want items in order", conn, seen[conn])
+		}
+	}
+}
+
+func TestAddSocketForward(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls.log")
+	sshPath := filepath.Join(dir, "ssh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$*\" >> %s\n", logPath)
+	if err := os.WriteFile(sshPath, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	f := New(logger, sshPath)
+
+	if _, _, err := f.AddSocketForward("", "test-host", "var/run/docker.sock", 2375); err == nil {
+		t.Error("AddSocketForward() with relative path should error")
+	}
+	if _, _, err := f.AddSocketForward("", "test-host", "/var/run/docker.sock", 0); err == nil {
+		t.Error("AddSocketForward() without local port should error")
+	}
+
+	localPort, err := allocateLoopbackPort()
+	if err != nil {
+		t.Fatalf("allocateLoopbackPort() error: %v", err)
+	}
+
+	got, created, err := f.AddSocketForward("", "test-host", "/var/run/docker.sock", localPort)
+	if err != nil {
+		t.Fatalf("AddSocketForward() error: %v", err)
+	}
+	if !created || got != localPort {
+		t.Errorf("AddSocketForward() = (%d, %v), want (%d, true)", got, created, localPort)
+	}
+
+	forwards := f.ListConnectionForwards("test-host")
+	if len(forwards) != 1 || forwards[0].RemoteTarget() != "/var/run/docker.sock" {
+		t.Fatalf("ListConnectionForwards() = %+v, want the socket forward", forwards)
+	}
+
+	if err := f.RemoveSocketForward("test-host", "/var/run/docker.sock"); err != nil {
+		t.Fatalf("RemoveSocketForward() error: %v", err)
+	}
+	if got := len(f.ListForwards()); got != 0 {
+		t.Errorf("ListForwards() after remove = %d, want 0", got)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read ssh call log: %v", err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+	wantForward := fmt.Sprintf("-O forward -L %d:/var/run/docker.sock test-host", localPort)
+	wantCancel := fmt.Sprintf("-O cancel -L %d:/var/run/docker.sock test-host", localPort)
+	if len(calls) < 2 || calls[0] != wantForward || calls[1] != wantCancel {
+		t.Errorf("ssh calls = %q, want forward then cancel of the socket spec", calls)
+	}
+}
+
+func TestAddLocalSocketForward(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls.log")
+	sshPath := filepath.Join(dir, "ssh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$*\" >> %s\n", logPath)
+	if err := os.WriteFile(sshPath, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	f := New(logger, sshPath)
+
+	if _, _, err := f.Add(Forward{ConnectionInfo: "test-host", RemotePort: 5432, LocalSocket: "pg.sock"}); err == nil {
+		t.Error("Add() with relative local socket should error")
+	}
+
+	// A socket nothing is listening on is left over from an earlier forward
+	// and gets replaced
+	socketPath := filepath.Join(dir, "sockets", "pg.sock")
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+		t.Fatalf("failed to create socket dir: %v", err)
+	}
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	if err != nil {
+		t.Fatalf("failed to create stale socket: %v", err)
+	}
+	stale.SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	got, created, err := f.Add(Forward{ConnectionInfo: "test-host", RemotePort: 5432, LocalSocket: socketPath})
+	if err != nil {
+		t.Fatalf("Add() error: %v", err)
+	}
+	if !created || got != 0 {
+		t.Errorf("Add() = (%d, %v), want (0, true)", got, created)
+	}
+	if _, err := os.Lstat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("stale socket still present: %v", err)
+	}
+
+	// A socket something is listening on is never clobbered
+	busyPath := filepath.Join(dir, "busy.sock")
+	busy, err := net.Listen("unix", busyPath)
+	if err != nil {
+		t.Fatalf("failed to listen on busy socket: %v", err)
+	}
+	defer func() { _ = busy.Close() }()
+	if _, _, err := f.Add(Forward{ConnectionInfo: "test-host", RemotePort: 6379, LocalSocket: busyPath}); err == nil {
+		t.Error("Add() onto a socket in use should error")
+	}
+
+	if err := f.RemoveForward("test-host", 5432, "localhost"); err != nil {
+		t.Fatalf("RemoveForward() error: %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read ssh call log: %v", err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+	wantForward := fmt.Sprintf("-O forward -L %s:localhost:5432 test-host", socketPath)
+	wantCancel := fmt.Sprintf("-O cancel -L %s:localhost:5432 test-host", socketPath)
+	if len(calls) < 2 || calls[0] != wantForward || calls[1] != wantCancel {
+		t.Errorf("ssh calls = %q, want forward then cancel of the local socket spec", calls)
+	}
+}
+
+func TestControlSocketCache(t *testing.T) {
+	now := time.Unix(1000, 0)
+	var resolves int
+	resolveErr := error(nil)
+	socketGone := false
+
+	c := newControlSocketCache(30*time.Second, FindControlSocket)
+	c.now = func() time.Time { return now }
+	c.resolve = func(connectionInfo string) (string, error) {
+		resolves++
+		if resolveErr != nil {
+			return "", resolveErr
+		}
+		return "/tmp/" + connectionInfo + ".sock", nil
+	}
+	c.verify = func(controlPath string) error {
+		if socketGone {
+			return fmt.Errorf("control socket does not exist at %s", controlPath)
+		}
+		return nil
+	}
+
+	for i := 0; i < 5; i++ {
+		path, err := c.lookup("devbox")
+		if err != nil || path != "/tmp/devbox.sock" {
+			t.Fatalf("lookup() = (%q, %v), want /tmp/devbox.sock", path, err)
+		}
+	}
+	if resolves != 1 {
+		t.Errorf("resolves after repeated lookups = %d, want 1", resolves)
+	}
+
+	// Other connections are cached separately
+	if _, err := c.lookup("other"); err != nil {
+		t.Fatalf("lookup(other) error: %v", err)
+	}
+	if resolves != 2 {
+		t.Errorf("resolves after second connection = %d, want 2", resolves)
+	}
+
+	// Entries expire
+	now = now.Add(31 * time.Second)
+	if _, err := c.lookup("devbox"); err != nil {
+		t.Fatalf("lookup() after expiry error: %v", err)
+	}
+	if resolves != 3 {
+		t.Errorf("resolves after expiry = %d, want 3", resolves)
+	}
+
+	// A cached socket that disappeared is resolved again
+	socketGone = true
+	_, _ = c.lookup("devbox")
+	if resolves != 4 {
+		t.Errorf("resolves after socket vanished = %d, want 4", resolves)
+	}
+	socketGone = false
+
+	// Failures aren't cached
+	c.invalidate("devbox")
+	resolveErr = errors.New("no active SSH connection to devbox")
+	if _, err := c.lookup("devbox"); err == nil {
+		t.Error("lookup() should return the resolve error")
+	}
+	resolveErr = nil
+	if _, err := c.lookup("devbox"); err != nil {
+		t.Errorf("lookup() after failure error: %v", err)
+	}
+	if resolves != 6 {
+		t.Errorf("resolves after failure = %d, want 6", resolves)
+	}
+}
+
+// freePortRange finds n consecutive ports that are free on loopback
+func freePortRange(t *testing.T, n int) int {
+	t.Helper()
+	for base := 40000; base < 60000; base += n {
+		free := true
+		for port := base; port < base+n; port++ {
+			ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+			if err != nil {
+				free = false
+				break
+			}
+			_ = ln.Close()
+		}
+		if free {
+			return base
+		}
+	}
+	t.Fatalf("no %d consecutive free ports found", n)
+	return 0
+}
+
+func TestAddRange(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls.log")
+	sshPath := filepath.Join(dir, "ssh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$*\" >> %s\n", logPath)
+	if err := os.WriteFile(sshPath, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	f := New(logger, sshPath)
+	f.checkListening = func(string, int) bool { return true }
+
+	if _, _, err := f.AddRange("", "test-host", 3010, 3000, 0, "", ""); err == nil {
+		t.Error("AddRange() with end before start should error")
+	}
+	if _, _, err := f.AddRange("", "test-host", 3000, 3000+maxRangeSize, 0, "", ""); err == nil {
+		t.Error("AddRange() larger than maxRangeSize should error")
+	}
+
+	// The fake ssh binds nothing, so reserve a spare port for the single
+	// forward below up front
+	base := freePortRange(t, 4)
+	localPorts, created, err := f.AddRange("", "test-host", base, base+2, 0, "", "")
+	if err != nil {
+		t.Fatalf("AddRange() error: %v", err)
+	}
+	if !created || len(localPorts) != 3 || localPorts[0] != base || localPorts[2] != base+2 {
+		t.Errorf("AddRange() = (%v, %v), want ports %d-%d created", localPorts, created, base, base+2)
+	}
+
+	// A single forward on the same connection isn't part of the group
+	single := base + 3
+	if _, _, err := f.AddForward("", "test-host", single, single, ""); err != nil {
+		t.Fatalf("AddForward() error: %v", err)
+	}
+
+	group := rangeGroup("localhost", base, base+2)
+	groups := f.Groups()
+	if len(groups) != 1 || groups[0].Group != group || groups[0].Ports != 3 || groups[0].Active != 3 {
+		t.Errorf("Groups() = %+v, want %s with 3/3 active", groups, group)
+	}
+
+	if err := os.Remove(logPath); err != nil {
+		t.Fatalf("failed to reset ssh call log: %v", err)
+	}
+	if err := f.RemoveRange("test-host", base, base+2, ""); err != nil {
+		t.Fatalf("RemoveRange() error: %v", err)
+	}
+	if got := f.ListForwards(); len(got) != 1 || got[0].RemotePort != single {
+		t.Errorf("ListForwards() after RemoveRange = %d forwards, want only the single forward", len(got))
+	}
+	if groups := f.Groups(); len(groups) != 0 {
+		t.Errorf("Groups() after RemoveRange = %+v, want none", groups)
+	}
+
+	// All cancels happen before a single restore
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read ssh call log: %v", err)
+	}
+	want := []string{
+		fmt.Sprintf("-O cancel -L %d:localhost:%d test-host", base, base),
+		fmt.Sprintf("-O cancel -L %d:localhost:%d test-host", base+1, base+1),
+		fmt.Sprintf("-O cancel -L %d:localhost:%d test-host", base+2, base+2),
+		"-O forward test-host",
+		fmt.Sprintf("-O forward -L %d:localhost:%d test-host", single, single),
+	}
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+	cancels := append([]string(nil), calls[:3]...)
+	sort.Strings(cancels)
+	if len(calls) != len(want) || strings.Join(cancels, "\n") != strings.Join(want[:3], "\n") ||
+		strings.Join(calls[3:], "\n") != strings.Join(want[3:], "\n") {
+		t.Errorf("ssh calls = %q, want %q", calls, want)
+	}
+
+	if err := f.RemoveRange("test-host", base, base+2, ""); err == nil {
+		t.Error("RemoveRange() of a removed range should error")
+	}
+}
+
+func TestAddRangeRollsBack(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	base := freePortRange(t, 3)
+
+	// ssh rejects the second port of the range
+	dir := t.TempDir()
+	sshPath := filepath.Join(dir, "ssh")
+	script := fmt.Sprintf("#!/bin/sh\ncase \"$*\" in *forward*:localhost:%d*) exit 1;; esac\n", base+1)
+	if err := os.WriteFile(sshPath, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	f := New(logger, sshPath)
+	f.checkListening = func(string, int) bool { return true }
+
+	if _, _, err := f.AddRange("", "test-host", base, base+2, 0, "", ""); err == nil {
+		t.Fatal("AddRange() should fail when a port is rejected")
+	}
+	if got := len(f.ListForwards()); got != 0 {
+		t.Errorf("ListForwards() after failed AddRange = %d, want 0", got)
+	}
+}
+
+func TestRemoveForwardsMissingKey(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	f := New(logger, "true")
+
+	base := freePortRange(t, 2)
+	for _, port := range []int{base, base + 1} {
+		if _, _, err := f.AddForward("", "devbox", port, port, ""); err != nil {
+			t.Fatalf("AddForward(%d) error: %v", port, err)
+		}
+	}
+
+	// A key that's gone doesn't keep the others from being removed
+	keys := []string{"devbox:localhost:1", fmt.Sprintf("devbox:localhost:%d", base)}
+	if err := f.removeForwards("devbox", keys); err == nil || !strings.Contains(err.Error(), "devbox:localhost:1") {
+		t.Errorf("removeForwards() error = %v, want the missing key reported", err)
+	}
+	if got := f.ListForwards(); len(got) != 1 || got[0].RemotePort != base+1 {
+		t.Errorf("ListForwards() = %+v, want only %d left", got, base+1)
+	}
+}
+
+func TestCheckConnections(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var eventsMu sync.Mutex
+	var events []EventType
+	f := NewWithOptions(logger, "true", Options{
+		OnEvent: func(e Event) {
+			eventsMu.Lock()
+			defer eventsMu.Unlock()
+			events = append(events, e.Type)
+		},
+	})
+
+	base := freePortRange(t, 2)
+	for _, port := range []int{base, base + 1} {
+		if _, _, err := f.AddForward("/tmp/old.sock", "devbox", port, port, ""); err != nil {
+			t.Fatalf("AddForward(%d) error: %v", port, err)
+		}
+	}
+
+	// Connection alive: nothing changes
+	f.checkConnection = func(string, string) error { return nil }
+	f.CheckConnections()
+	if got := len(f.ListForwards()); got != 2 {
+		t.Fatalf("ListForwards() with live connection = %d, want 2", got)
+	}
+
+	// Master gone and not yet back
+	f.checkConnection = func(string, string) error { return errors.New("no master") }
+	f.controlSockets.resolve = func(string) (string, error) { return "", errors.New("no master") }
+	f.CheckConnections()
+	if got := len(f.ListForwards()); got != 0 {
+		t.Fatalf("ListForwards() after connection lost = %d, want 0", got)
+	}
+	eventsMu.Lock()
+	if len(events) != 2 || events[0] != EventConnectionLost || events[1] != EventConnectionLost {
+		t.Errorf("events after loss = %v, want two %s", events, EventConnectionLost)
+	}
+	events = nil
+	eventsMu.Unlock()
+
+	// Master is back under a new socket
+	f.controlSockets.resolve = func(string) (string, error) { return "/tmp/new.sock", nil }
+	f.controlSockets.verify = func(string) error { return nil }
+	f.CheckConnections()
+	forwards := f.ListConnectionForwards("devbox")
+	if len(forwards) != 2 {
+		t.Fatalf("ListConnectionForwards() after restore = %d, want 2", len(forwards))
+	}
+	for _, fwd := range forwards {
+		if fwd.SocketPath != "/tmp/new.sock" {
+			t.Errorf("restored forward SocketPath = %q, want /tmp/new.sock", fwd.SocketPath)
+		}
+	}
+	eventsMu.Lock()
+	if len(events) != 2 || events[0] != EventConnectionRestored {
+		t.Errorf("events after restore = %v, want two %s", events, EventConnectionRestored)
+	}
+	eventsMu.Unlock()
+}
+
+func TestRestoredForwardKeepsItsSettings(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	f := New(logger, "true")
+
+	port := freePortRange(t, 1)
+	want := Forward{
+		ConnectionInfo: "devbox",
+		RemotePort:     port,
+		LocalPort:      port,
+		SocketPath:     "/tmp/old.sock",
+		Owner:          "wrap:1234",
+		AppProtocol:    "http",
+		Server:         "Next.js",
+		Conflict:       PortConflictNext,
+	}
+	if _, _, err := f.Add(want); err != nil {
+		t.Fatalf("Add() error: %v", err)
+	}
+
+	f.checkConnection = func(string, string) error { return errors.New("no master") }
+	f.controlSockets.resolve = func(string) (string, error) { return "", errors.New("no master") }
+	f.CheckConnections()
+
+	f.controlSockets.resolve = func(string) (string, error) { return "/tmp/new.sock", nil }
+	f.controlSockets.verify = func(string) error { return nil }
+	f.CheckConnections()
+
+	forwards := f.ListConnectionForwards("devbox")
+	if len(forwards) != 1 {
+		t.Fatalf("ListConnectionForwards() after restore = %d, want 1", len(forwards))
+	}
+	got := forwards[0]
+	if got.Owner != want.Owner || got.AppProtocol != want.AppProtocol || got.Server != want.Server || got.Conflict != want.Conflict {
+		t.Errorf("restored forward = owner %q, app protocol %q, server %q, conflict %q; want %q, %q, %q, %q",
+			got.Owner, got.AppProtocol, got.Server, got.Conflict,
+			want.Owner, want.AppProtocol, want.Server, want.Conflict)
+	}
+}
+
+func TestRemoveForwardOfLostConnection(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	f := New(logger, "true")
+
+	port := freePortRange(t, 1)
+	if _, _, err := f.AddForward("", "devbox", port, port, ""); err != nil {
+		t.Fatalf("AddForward() error: %v", err)
+	}
+
+	f.checkConnection = func(string, string) error { return errors.New("no master") }
+	f.controlSockets.resolve = func(string) (string, error) { return "", errors.New("no master") }
+	f.CheckConnections()
+
+	// The remote side may still ask to unforward a port held for a lost
+	// connection; that must succeed and stop it from being restored
+	if err := f.RemoveForward("devbox", port, ""); err != nil {
+		t.Fatalf("RemoveForward() error: %v", err)
+	}
+
+	f.controlSockets.resolve = func(string) (string, error) { return "/tmp/new.sock", nil }
+	f.controlSockets.verify = func(string) error { return nil }
+	f.CheckConnections()
+	if got := len(f.ListForwards()); got != 0 {
+		t.Errorf("ListForwards() after reconnect = %d, want 0", got)
+	}
+}
+
+func TestPinnedForwardsOnSeveralSockets(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls.log")
+	sshPath := filepath.Join(dir, "ssh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$*\" >> %s\n", logPath)
+	if err := os.WriteFile(sshPath, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	f := New(logger, sshPath)
+	f.checkListening = func(string, int) bool { return true }
+
+	if _, _, err := f.Add(Forward{ConnectionInfo: "devbox", RemotePort: 8080, Pinned: true}); err == nil {
+		t.Error("Add() pinned without a socket path should error")
+	}
+
+	// Same remote port on the same host, through masters for two users
+	base := freePortRange(t, 2)
+	for i, socket := range []string{"/tmp/alice.sock", "/tmp/bob.sock"} {
+		_, created, err := f.Add(Forward{
+			ConnectionInfo: "devbox",
+			RemotePort:     8080,
+			LocalPort:      base + i,
+			SocketPath:     socket,
+			Pinned:         true,
+		})
+		if err != nil || !created {
+			t.Fatalf("Add() through %s = (%v, %v), want created", socket, created, err)
+		}
+	}
+	if got := len(f.ListConnectionForwards("devbox")); got != 2 {
+		t.Fatalf("ListConnectionForwards() = %d, want 2", got)
+	}
+
+	if err := f.RemoveForward("devbox", 8080, ""); err == nil || !strings.Contains(err.Error(), "several control sockets") {
+		t.Errorf("RemoveForward() without a socket = %v, want ambiguity error", err)
+	}
+
+	if err := os.Remove(logPath); err != nil {
+		t.Fatalf("failed to reset ssh call log: %v", err)
+	}
+	if err := f.Remove(Forward{ConnectionInfo: "devbox", RemotePort: 8080, SocketPath: "/tmp/alice.sock"}); err != nil {
+		t.Fatalf("Remove() through alice.sock error: %v", err)
+	}
+
+	forwards := f.ListConnectionForwards("devbox")
+	if len(forwards) != 1 || forwards[0].SocketPath != "/tmp/bob.sock" {
+		t.Fatalf("ListConnectionForwards() after Remove = %+v, want only bob's forward", forwards)
+	}
+
+	// Cancelling on alice's master leaves bob's alone, so nothing of bob's
+	// is re-added
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read ssh call log: %v", err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := []string{
+		fmt.Sprintf("-O cancel -L %d:localhost:8080 -S /tmp/alice.sock devbox", base),
+		"-O forward -S /tmp/alice.sock devbox",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ssh calls = %q, want %q", calls, want)
+	}
+
+	// With a single match left, no socket is needed
+	if err := f.RemoveForward("devbox", 8080, ""); err != nil {
+		t.Errorf("RemoveForward() of the last forward error: %v", err)
+	}
+}
+
+func TestAddForwardBindAddress(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls.log")
+	sshPath := filepath.Join(dir, "ssh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$*\" >> %s\n", logPath)
+	if err := os.WriteFile(sshPath, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	base := freePortRange(t, 2)
+
+	// Without the gate, only loopback binds are accepted
+	f := New(logger, sshPath)
+	if _, _, err := f.Add(Forward{ConnectionInfo: "devbox", RemotePort: base, BindAddress: "0.0.0.0"}); err == nil {
+		t.Error("Add() with 0.0.0.0 and no allow_lan_bind should error")
+	}
+	if _, _, err := f.Add(Forward{ConnectionInfo: "devbox", RemotePort: base, BindAddress: "127.0.0.1"}); err != nil {
+		t.Errorf("Add() with loopback bind error: %v", err)
+	}
+
+	// With the gate, the bind address reaches ssh and the audit leaves the
+	// deliberately shared forward alone
+	f = NewWithOptions(logger, sshPath, Options{AllowLANBind: true})
+	f.findExposedAddr = func(int) string { return "192.168.1.10" }
+	if _, _, err := f.Add(Forward{ConnectionInfo: "devbox", RemotePort: base + 1, BindAddress: "0.0.0.0"}); err != nil {
+		t.Fatalf("Add() with allow_lan_bind error: %v", err)
+	}
+	if violations := f.Audit(false); len(violations) != 0 {
+		t.Errorf("Audit() = %+v, want no violations for a shared forward", violations)
+	}
+
+	// A shared forward the policy no longer allows, like one adopted from
+	// ssh, is a violation however it answers
+	f.allowLANBind = false
+	f.findExposedAddr = func(int) string { return "" }
+	violations := f.Audit(false)
+	if len(violations) != 1 || !violations[0].Policy || violations[0].ExposedAddr != "0.0.0.0" {
+		t.Errorf("Audit() = %+v without allow_lan_bind, want a policy violation for 0.0.0.0", violations)
+	}
+	if violations := f.Audit(true); len(violations) != 1 || !violations[0].Corrected {
+		t.Errorf("Audit(true) = %+v, want the shared forward re-bound", violations)
+	}
+	if fwds := f.ListConnectionForwards("devbox"); len(fwds) != 1 || fwds[0].BindAddress != "127.0.0.1" {
+		t.Errorf("forwards after Audit(true) = %+v, want bound to 127.0.0.1", fwds)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read ssh call log: %v", err)
+	}
+	want := fmt.Sprintf("-O forward -L 0.0.0.0:%d:localhost:%d devbox", base+1, base+1)
+	if !strings.Contains(string(data), want) {
+		t.Errorf("ssh calls = %q, want %q", data, want)
+	}
+}
+
+func TestNamedForwards(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	dir := t.TempDir()
+	sshPath := filepath.Join(dir, "ssh")
+	if err := os.WriteFile(sshPath, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	base := freePortRange(t, 3)
+	f := New(logger, sshPath)
+
+	for _, bad := range []string{"8080", "-web", "web app"} {
+		if _, _, err := f.Add(Forward{ConnectionInfo: "devbox", RemotePort: base, Name: bad}); err == nil {
+			t.Errorf("Add() with name %q should error", bad)
+		}
+	}
+
+	if _, _, err := f.Add(Forward{ConnectionInfo: "devbox", RemotePort: base, Name: "webapp"}); err != nil {
+		t.Fatalf("Add() error: %v", err)
+	}
+	if _, _, err := f.Add(Forward{ConnectionInfo: "devbox", RemotePort: base + 1, Name: "webapp"}); err == nil {
+		t.Error("Add() with a name already in use should error")
+	}
+
+	// An existing unnamed forward picks up the name it's re-requested with
+	if _, _, err := f.Add(Forward{ConnectionInfo: "devbox", RemotePort: base + 2}); err != nil {
+		t.Fatalf("Add() error: %v", err)
+	}
+	if _, _, err := f.Add(Forward{ConnectionInfo: "devbox", RemotePort: base + 2, Name: "api"}); err != nil {
+		t.Fatalf("Add() naming an existing forward error: %v", err)
+	}
+	if fwd, ok := f.FindByName("api"); !ok || fwd.RemotePort != base+2 {
+		t.Errorf("FindByName(api) = %+v, %v, want remote port %d", fwd, ok, base+2)
+	}
+
+	if err := f.RemoveByName("webapp"); err != nil {
+		t.Fatalf("RemoveByName() error: %v", err)
+	}
+	if _, ok := f.FindByName("webapp"); ok {
+		t.Error("FindByName(webapp) found a removed forward")
+	}
+	if err := f.RemoveByName("webapp"); err == nil {
+		t.Error("RemoveByName() of an unknown name should error")
+	}
+	if got := len(f.ListForwards()); got != 1 {
+		t.Errorf("ListForwards() has %d forwards, want 1", got)
+	}
+}
+
+func TestNamedForwardsConcurrent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// Slow enough that both adds are past the name check before either stores
+	dir := t.TempDir()
+	sshPath := filepath.Join(dir, "ssh")
+	if err := os.WriteFile(sshPath, []byte("#!/bin/sh\nsleep 0.2\nexit 0\n"), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh: %v", err)
+	}
+
+	base := freePortRange(t, 2)
+	f := New(logger, sshPath)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, conn := range []string{"devbox", "staging"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, errs[i] = f.Add(Forward{ConnectionInfo: conn, RemotePort: base + i, Name: "webapp"})
+		}()
+	}
+	wg.Wait()
+
+	if (errs[0] == nil) == (errs[1] == nil) {
+		t.Errorf("Add() errors = %v, want exactly one to take the name", errs)
+	}
+	if got := len(f.ListForwards()); got != 1 {
+		t.Errorf("ListForwards() has %d forwards, want 1", got)
+	}
+}
+
+func TestParseNetstatEstablished(t *testing.T) {
+	output := `Active Internet connections (including servers)
+Proto Recv-Q Send-Q  Local Address          Foreign Address        (state)
+tcp4       0      0  127.0.0.1.8080         127.0.0.1.61234        ESTABLISHED
+tcp4       0      0  127.0.0.1.61234        127.0.0.1.8080         ESTABLISHED
+tcp6       0      0  ::1.5432               ::1.61300              ESTABLISHED
+tcp4       0      0  *.3000                 *.*                    LISTEN
+tcp4       0      0  127.0.0.1.9000         127.0.0.1.61400        TIME_WAIT
+udp4       0      0  *.5353                 *.*
+`
+	got := parseNetstatEstablished(output)
+	want := map[int]bool{8080: true, 61234: true, 5432: true}
+	if len(got) != len(want) {
+		t.Errorf("parseNetstatEstablished() = %v, want %v", got, want)
+	}
+	for port := range want {
+		if !got[port] {
+			t.Errorf("parseNetstatEstablished() missed port %d", port)
+		}
+	}
+}
+
+func TestRemoveIdle(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	var events []Event
+	f := NewWithOptions(logger, "true", Options{
+		IdleTimeout: time.Hour,
+		OnEvent:     func(e Event) { events = append(events, e) },
+	})
+
+	base := freePortRange(t, 2)
+	busy, idle := base, base+1
+	for _, port := range []int{busy, idle} {
+		if _, _, err := f.AddForward("", "devbox", port, port, ""); err != nil {
+			t.Fatalf("AddForward(%d) error: %v", port, err)
+		}
+	}
+
+	// Both forwards were last seen long ago; only one has traffic now
+	f.mu.Lock()
+	for _, fwd := range f.forwards {
+		fwd.CreatedAt = time.Now().Add(-2 * time.Hour)
+	}
+	f.mu.Unlock()
+	f.establishedPorts = func() (map[int]bool, error) { return map[int]bool{busy: true}, nil }
+
+	if removed := f.RemoveIdle(); removed != 1 {
+		t.Fatalf("RemoveIdle() = %d, want 1", removed)
+	}
+	forwards := f.ListForwards()
+	if len(forwards) != 1 || forwards[0].LocalPort != busy {
+		t.Errorf("ListForwards() after RemoveIdle = %+v, want only port %d", forwards, busy)
+	}
+	if len(events) != 1 || events[0].Type != EventIdleRemoved || events[0].Forward.LocalPort != idle {
+		t.Errorf("events = %+v, want one %q for port %d", events, EventIdleRemoved, idle)
+	}
+
+	// A failed sample must not be mistaken for idleness
+	f.establishedPorts = func() (map[int]bool, error) { return nil, errors.New("no /proc") }
+	f.mu.Lock()
+	for _, fwd := range f.forwards {
+		fwd.lastActive = time.Now().Add(-2 * time.Hour)
+	}
+	f.mu.Unlock()
+	if removed := f.RemoveIdle(); removed != 0 {
+		t.Errorf("RemoveIdle() without a sample = %d, want 0", removed)
+	}
+}
+
+func TestRemoveIdleForwardTimeout(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	f := New(logger, "true")
+	f.establishedPorts = func() (map[int]bool, error) { return map[int]bool{}, nil }
+
+	// Without a forwarder timeout, only a forward with its own expires
+	base := freePortRange(t, 2)
+	kept, expiring := base, base+1
+	if _, _, err := f.Add(Forward{RemotePort: kept, ConnectionInfo: "devbox"}); err != nil {
+		t.Fatalf("Add(%d) error: %v", kept, err)
+	}
+	if _, _, err := f.Add(Forward{RemotePort: expiring, ConnectionInfo: "devbox", IdleTimeout: time.Minute}); err != nil {
+		t.Fatalf("Add(%d) error: %v", expiring, err)
+	}
+
+	f.mu.Lock()
+	for _, fwd := range f.forwards {
+		fwd.CreatedAt = time.Now().Add(-2 * time.Minute)
+	}
+	f.mu.Unlock()
+
+	if removed := f.RemoveIdle(); removed != 1 {
+		t.Fatalf("RemoveIdle() = %d, want 1", removed)
+	}
+	forwards := f.ListForwards()
+	if len(forwards) != 1 || forwards[0].RemotePort != kept {
+		t.Errorf("ListForwards() after RemoveIdle = %+v, want only port %d", forwards, kept)
+	}
+}
+
+func TestSpecs(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	f := New(logger, "true")
+
+	base := freePortRange(t, 4)
+	if _, _, err := f.AddRange("", "devbox", base, base+2, 0, "", ""); err != nil {
+		t.Fatalf("AddRange() error: %v", err)
+	}
+	if _, _, err := f.Add(Forward{RemotePort: base + 3, Name: "api", ConnectionInfo: "devbox"}); err != nil {
+		t.Fatalf("Add() error: %v", err)
+	}
+	if _, _, err := f.Add(Forward{RemotePort: base + 3, SocketPath: "/tmp/other.sock", ConnectionInfo: "other"}); err != nil {
+		t.Fatalf("Add() error: %v", err)
+	}
+
+	specs := f.Specs("devbox")
+	if len(specs) != 2 {
+		t.Fatalf("Specs(devbox) = %+v, want the range and the named forward", specs)
+	}
+	if specs[0].RemotePort != base || specs[0].RemotePortEnd != base+2 || specs[0].LocalPort != base {
+		t.Errorf("range spec = %+v, want %d-%d from local %d", specs[0], base, base+2, base)
+	}
+	if specs[1].Name != "api" || specs[1].RemotePort != base+3 || specs[1].RemotePortEnd != 0 {
+		t.Errorf("named spec = %+v, want api on %d", specs[1], base+3)
+	}
+
+	all := f.Specs("")
+	if len(all) != 3 {
+		t.Fatalf("Specs() = %+v, want 3", all)
+	}
+	if all[2].ConnectionInfo != "other" || all[2].SocketPath != "" {
+		t.Errorf("unpinned spec = %+v, want no control socket", all[2])
+	}
+}
+
+func TestOrphanedForwards(t *testing.T) {
+	discovered := []SSHForward{
+		{LocalPort: 3000, RemotePort: 3000, SocketPath: "/tmp/a.sock", ConnectionInfo: "devbox"},
+		{LocalPort: 5432, RemotePort: 5432, SocketPath: "/tmp/a.sock", ConnectionInfo: "devbox", Configured: true},
+		{LocalPort: 8080, RemotePort: 8080, SocketPath: "/tmp/a.sock", ConnectionInfo: "devbox"},
+		{LocalPort: 8080, RemotePort: 8080, SocketPath: "/tmp/b.sock", ConnectionInfo: "other"},
+	}
+	tracked := func(fwd SSHForward) bool {
+		return fwd.SocketPath == "/tmp/a.sock" && fwd.LocalPort == 8080
+	}
+
+	orphaned := orphanedForwards(discovered, tracked)
+	if len(orphaned) != 2 {
+		t.Fatalf("orphanedForwards() = %+v, want 2", orphaned)
+	}
+	if orphaned[0].LocalPort != 3000 || orphaned[1].SocketPath != "/tmp/b.sock" {
+		t.Errorf("orphanedForwards() = %+v, want devbox's 3000 and other's 8080", orphaned)
+	}
+
+	if got := orphanedForwards(discovered, func(SSHForward) bool { return false }); len(got) != 3 {
+		t.Errorf("with nothing tracked, orphanedForwards() = %+v, want every runtime forward", got)
+	}
+}
+
+func TestIsReachable(t *testing.T) {
+	// A server that keeps connections open, as one reached through ssh does
+	held, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = held.Close() }()
+	go func() {
+		for {
+			conn, err := held.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+
+	// What ssh does when nothing listens on the remote end
+	refused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = refused.Close() }()
+	go func() {
+		for {
+			conn, err := refused.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	if !isReachable("", held.Addr().(*net.TCPAddr).Port) {
+		t.Error("isReachable() = false for a connection kept open")
+	}
+	if isReachable("", refused.Addr().(*net.TCPAddr).Port) {
+		t.Error("isReachable() = true for a connection closed at once")
+	}
+	if isReachable("", freePortRange(t, 1)) {
+		t.Error("isReachable() = true with nothing listening")
+	}
+}
+
+func TestWaitReachable(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	f := New(logger, "ssh")
+	if err := f.RegisterExistingForward("/tmp/socket", "devbox", 3000, 3001, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := Forward{RemotePort: 3000, ConnectionInfo: "devbox"}
+
+	var probed []int
+	f.checkReachable = func(_ string, port int) bool {
+		probed = append(probed, port)
+		return len(probed) == 3
+	}
+	if !f.WaitReachable(want, 5*time.Second) {
+		t.Error("WaitReachable() = false for a forward that became reachable")
+	}
+	if len(probed) != 3 || probed[0] != 3001 {
+		t.Errorf("WaitReachable() probed %v, want local port 3001 until reachable", probed)
+	}
+
+	f.checkReachable = func(string, int) bool { return false }
+	if f.WaitReachable(want, 600*time.Millisecond) {
+		t.Error("WaitReachable() = true for a forward that never became reachable")
+	}
+	if f.WaitReachable(Forward{RemotePort: 4000, ConnectionInfo: "devbox"}, 0) {
+		t.Error("WaitReachable() = true for a forward that doesn't exist")
+	}
+}
+
+func TestReachable(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	f := New(logger, "ssh")
+	f.checkReachable = func(_ string, port int) bool { return port == 3001 }
+
+	if !f.Reachable(&Forward{RemotePort: 3000, LocalPort: 3001}) {
+		t.Error("Reachable() = false for a port whose probe got through")
+	}
+	if f.Reachable(&Forward{RemotePort: 3000, LocalPort: 3002}) {
+		t.Error("Reachable() = true for a port whose probe didn't get through")
+	}
+
+	socket := filepath.Join(t.TempDir(), "fwd.sock")
+	if f.Reachable(&Forward{RemoteSocket: "/run/app.sock", LocalSocket: socket}) {
+		t.Error("Reachable() = true for a socket nothing listens on")
+	}
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+	if !f.Reachable(&Forward{RemoteSocket: "/run/app.sock", LocalSocket: socket}) {
+		t.Error("Reachable() = false for a socket that accepts connections")
+	}
+}
+
+func TestLocalBankshot(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"bankshot", "list"}, true},
+		{[]string{"/usr/local/bin/bankshot", "--debug", "logs", "-f"}, true},
+		{[]string{"bankshot", "proxy"}, false},
+		{[]string{"/usr/local/bin/bankshot", "--debug", "proxy"}, false},
+		{[]string{"ssh:", "/tmp/ssh-me@devbox:22", "[mux]"}, false},
+		{[]string{"ssh", "-R", "/tmp/b.sock:/home/me/.bankshot.sock", "devbox"}, false},
+		{[]string{"socat", "-", "UNIX-CONNECT:/home/me/.bankshot.sock"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := localBankshot(tt.args); got != tt.want {
+			t.Errorf("localBankshot(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestLookupPeer(t *testing.T) {
+	f := New(slog.New(slog.NewTextHandler(io.Discard, nil)), "ssh")
+
+	// This test binary is neither bankshot nor a master
+	peer, err := f.LookupPeer(os.Getpid())
+	if err != nil {
+		t.Skipf("LookupPeer() error = %v", err)
+	}
+	if !peer.Remote || peer.PID != os.Getpid() || peer.Connection.SocketPath != "" {
+		t.Errorf("LookupPeer() = %+v, want a remote peer without a connection", peer)
+	}
+}
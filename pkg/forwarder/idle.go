@@ -0,0 +1,132 @@
+package forwarder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RemoveIdle removes forwards that have carried no traffic for their idle
+// timeout, or else the forwarder's, so a long-running daemon doesn't
+// accumulate forwards nobody uses.
+// A forward fronted by an accounting relay is active while it has open
+// connections. Other forwards are sampled for established connections on
+// their local port each time this runs (from /proc/net on Linux, netstat on
+// macOS, and not at all elsewhere), which can miss connections that open
+// and close between samples. Local socket forwards can't be sampled and are
+// never removed. Returns the number of forwards removed.
+func (f *Forwarder) RemoveIdle() int {
+	if !f.expiresIdle() {
+		return 0
+	}
+
+	established, err := f.establishedPorts()
+	if err != nil {
+		f.logger.Debug("Could not sample connections for idle tracking", "error", err)
+	}
+
+	now := time.Now()
+	idleKeys := make(map[string][]string) // connectionInfo -> keys
+	idleForwards := make(map[string][]Forward)
+
+	f.mu.Lock()
+	for key, fwd := range f.forwards {
+		if fwd.LocalSocket != "" || fwd.idleTimeout(f.idleTimeout) <= 0 {
+			continue
+		}
+		if fwd.lastActive.IsZero() {
+			fwd.lastActive = fwd.CreatedAt
+		}
+
+		switch {
+		case fwd.relay != nil:
+			if fwd.relay.active.Load() > 0 {
+				fwd.lastActive = now
+			} else if last, ok := fwd.relay.lastActive(); ok && last.After(fwd.lastActive) {
+				fwd.lastActive = last
+			}
+		case err != nil:
+			// Without a sample there's no telling whether it's in use
+			continue
+		case established[fwd.sshLocalPort()]:
+			fwd.lastActive = now
+		}
+
+		if now.Sub(fwd.lastActive) >= fwd.idleTimeout(f.idleTimeout) {
+			idleKeys[fwd.ConnectionInfo] = append(idleKeys[fwd.ConnectionInfo], key)
+			idleForwards[fwd.ConnectionInfo] = append(idleForwards[fwd.ConnectionInfo], *fwd)
+		}
+	}
+	f.mu.Unlock()
+
+	removed := 0
+	for connectionInfo, keys := range idleKeys {
+		if err := f.removeForwards(connectionInfo, keys); err != nil {
+			f.logger.Warn("Failed to remove idle forwards",
+				"connectionInfo", connectionInfo,
+				"error", err,
+			)
+			continue
+		}
+		for _, fwd := range idleForwards[connectionInfo] {
+			f.logger.Info("Removed idle forward",
+				"remote", fwd.RemoteTarget(),
+				"local", fwd.LocalTarget(),
+				"connectionInfo", connectionInfo,
+				"idleFor", now.Sub(fwd.lastActive).Round(time.Second),
+			)
+			f.emit(EventIdleRemoved, fwd, fmt.Sprintf("no traffic for %s", fwd.idleTimeout(f.idleTimeout)))
+		}
+		removed += len(keys)
+	}
+	return removed
+}
+
+// idleTimeout returns how long the forward may go without traffic, given
+// the forwarder's timeout
+func (fwd *Forward) idleTimeout(fallback time.Duration) time.Duration {
+	if fwd.IdleTimeout > 0 {
+		return fwd.IdleTimeout
+	}
+	return fallback
+}
+
+// expiresIdle reports whether any forward is removed when idle, so there's
+// no sampling connections for nothing
+func (f *Forwarder) expiresIdle() bool {
+	if f.idleTimeout > 0 {
+		return true
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, fwd := range f.forwards {
+		if fwd.IdleTimeout > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetstatEstablished picks the local ports of ESTABLISHED connections
+// out of BSD `netstat -an -p tcp` output, whose addresses end in ".port":
+//
+//	tcp4  0  0  127.0.0.1.8080  127.0.0.1.61234  ESTABLISHED
+func parseNetstatEstablished(output string) map[int]bool {
+	ports := make(map[int]bool)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || !strings.HasPrefix(fields[0], "tcp") || fields[5] != "ESTABLISHED" {
+			continue
+		}
+		local := fields[3]
+		dot := strings.LastIndex(local, ".")
+		if dot < 0 {
+			continue
+		}
+		if port, err := strconv.Atoi(local[dot+1:]); err == nil {
+			ports[port] = true
+		}
+	}
+	return ports
+}
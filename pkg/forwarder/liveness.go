@@ -0,0 +1,243 @@
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lostConnectionTTL is how long the forwards of a vanished connection are
+// kept around in case it comes back
+const lostConnectionTTL = 30 * time.Minute
+
+// lostConnection holds the forwards of a connection whose control master
+// went away, so they can be re-established if it returns
+type lostConnection struct {
+	forwards []Forward
+	since    time.Time
+}
+
+// checkControlConnection asks the control master behind socketPath whether
+// it is still running
+func (f *Forwarder) checkControlConnection(socketPath, connectionInfo string) error {
+	output, err := f.runCommand(f.backend.CheckCommand(socketPath, connectionInfo))
+	if err != nil {
+		return fmt.Errorf("control master check failed: %w (output: %s)", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// CheckConnections runs `ssh -O check` against every control socket with
+// forwards. When a master is gone its forwards are taken down and an
+// EventConnectionLost is emitted for each; they are remembered for
+// lostConnectionTTL and re-established, with EventConnectionRestored, once a
+// master is found again (the same socket, for pinned forwards). Forwards
+// whose connection never returns are dropped with EventDropped.
+func (f *Forwarder) CheckConnections() {
+	f.mu.RLock()
+	var tracked []*Forward
+	for _, fwd := range f.forwards {
+		tracked = append(tracked, fwd)
+	}
+	f.mu.RUnlock()
+
+	forEachConnection(f.workers, tracked, func(fwd *Forward) string {
+		return fwd.ConnectionInfo
+	}, func(connectionInfo string, group []*Forward) {
+		unlock := f.lockConnection(connectionInfo)
+		defer unlock()
+
+		checked := make(map[string]bool)
+		for _, fwd := range group {
+			if checked[fwd.SocketPath] {
+				continue
+			}
+			checked[fwd.SocketPath] = true
+
+			if err := f.checkConnection(fwd.SocketPath, connectionInfo); err != nil {
+				f.connectionLost(connectionInfo, fwd.SocketPath, err)
+			}
+		}
+	})
+
+	f.lostMu.Lock()
+	lost := make([]string, 0, len(f.lost))
+	for connectionInfo := range f.lost {
+		lost = append(lost, connectionInfo)
+	}
+	f.lostMu.Unlock()
+	sort.Strings(lost)
+
+	forEachConnection(f.workers, lost, func(connectionInfo string) string {
+		return connectionInfo
+	}, func(connectionInfo string, _ []string) {
+		f.tryRestoreConnection(connectionInfo)
+	})
+}
+
+// connectionLost takes down a connection's forwards through socketPath after
+// its master went away. Callers must hold the connection lock.
+func (f *Forwarder) connectionLost(connectionInfo, socketPath string, cause error) {
+	f.controlSockets.invalidate(connectionInfo)
+
+	var lost []Forward
+	f.mu.Lock()
+	for key, fwd := range f.forwards {
+		if fwd.ConnectionInfo != connectionInfo || fwd.SocketPath != socketPath {
+			continue
+		}
+		delete(f.forwards, key)
+		lost = append(lost, *fwd)
+	}
+	f.mu.Unlock()
+
+	if len(lost) == 0 {
+		return
+	}
+
+	f.logger.Warn("SSH connection lost",
+		"connectionInfo", connectionInfo,
+		"socketPath", socketPath,
+		"forwards", len(lost),
+		"error", cause,
+	)
+
+	// The master took ssh's listeners with it; release what we own locally
+	for i := range lost {
+		if lost[i].relay != nil {
+			lost[i].relay.close()
+			lost[i].relay = nil
+		}
+		if lost[i].proc != nil {
+			lost[i].proc.stop()
+			lost[i].proc = nil
+		}
+		if lost[i].LocalSocket != "" {
+			if err := os.Remove(lost[i].LocalSocket); err != nil && !os.IsNotExist(err) {
+				f.logger.Warn("Failed to remove local socket", "path", lost[i].LocalSocket, "error", err)
+			}
+		}
+	}
+
+	f.lostMu.Lock()
+	if existing, ok := f.lost[connectionInfo]; ok {
+		existing.forwards = append(existing.forwards, lost...)
+	} else {
+		f.lost[connectionInfo] = &lostConnection{forwards: lost, since: time.Now()}
+	}
+	f.lostMu.Unlock()
+
+	for _, fwd := range lost {
+		f.emit(EventConnectionLost, fwd, cause.Error())
+	}
+}
+
+// tryRestoreConnection re-establishes a lost connection's forwards whose
+// control master is running again, or drops them once lostConnectionTTL has
+// passed
+func (f *Forwarder) tryRestoreConnection(connectionInfo string) {
+	f.lostMu.Lock()
+	entry, ok := f.lost[connectionInfo]
+	delete(f.lost, connectionInfo)
+	f.lostMu.Unlock()
+	if !ok {
+		return
+	}
+
+	expired := time.Since(entry.since) >= lostConnectionTTL
+	var waiting []Forward
+	for _, fwd := range entry.forwards {
+		socketPath, err := f.controlSocketFor(&fwd)
+		if err != nil {
+			if !expired {
+				waiting = append(waiting, fwd)
+				continue
+			}
+			f.logger.Info("Dropping forward of SSH connection that never returned",
+				"connectionInfo", connectionInfo,
+				"remote", fwd.RemoteTarget(),
+			)
+			f.emit(EventDropped, fwd, "SSH connection did not return")
+			continue
+		}
+
+		want := restoredForward(fwd, socketPath)
+
+		f.logger.Info("Re-establishing forward after reconnect",
+			"connectionInfo", connectionInfo,
+			"socketPath", socketPath,
+			"remote", want.RemoteTarget(),
+		)
+
+		_, _, err = f.addWithRetry(want)
+		if err == nil {
+			f.emit(EventConnectionRestored, want, "SSH connection restored")
+			continue
+		}
+		if errors.Is(err, ErrRetryQueued) {
+			continue
+		}
+		f.logger.Warn("Failed to re-establish forward after reconnect",
+			"connectionInfo", connectionInfo,
+			"remote", want.RemoteTarget(),
+			"error", err,
+		)
+		f.emit(EventDropped, want, err.Error())
+	}
+
+	if len(waiting) == 0 {
+		return
+	}
+
+	// Keep waiting on the rest, alongside anything lost in the meantime
+	f.lostMu.Lock()
+	if current, ok := f.lost[connectionInfo]; ok {
+		current.forwards = append(waiting, current.forwards...)
+		current.since = entry.since
+	} else {
+		f.lost[connectionInfo] = &lostConnection{forwards: waiting, since: entry.since}
+	}
+	f.lostMu.Unlock()
+}
+
+// restoredForward is the request that re-establishes lost through
+// socketPath: everything the forward was added with, without what its last
+// setup left behind
+func restoredForward(lost Forward, socketPath string) Forward {
+	want := lost
+	want.SocketPath = socketPath
+	want.BindAddress = lost.LocalBindAddress()
+	want.ListenAddress = ""
+	want.SSHPort = 0
+	want.Resolution = nil
+	want.CreatedAt = time.Time{}
+	want.relay = nil
+	want.proc = nil
+	want.lastActive = time.Time{}
+	return want
+}
+
+// forgetLost drops a forward of a lost connection. Returns true if it was
+// being held.
+func (f *Forwarder) forgetLost(connectionInfo, key string) bool {
+	f.lostMu.Lock()
+	defer f.lostMu.Unlock()
+
+	entry, ok := f.lost[connectionInfo]
+	if !ok {
+		return false
+	}
+	for i, fwd := range entry.forwards {
+		if fwd.key() == key {
+			entry.forwards = append(entry.forwards[:i], entry.forwards[i+1:]...)
+			if len(entry.forwards) == 0 {
+				delete(f.lost, connectionInfo)
+			}
+			return true
+		}
+	}
+	return false
+}
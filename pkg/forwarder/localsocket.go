@@ -0,0 +1,48 @@
+package forwarder
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// prepareLocalSocket makes sure ssh can bind a Unix socket at path: its
+// directory exists, and any stale socket left behind by an earlier forward is
+// removed. A socket something is still listening on is left alone.
+func prepareLocalSocket(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory for local socket: %w", err)
+	}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat local socket: %w", err)
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("local socket path %s exists and is not a socket", path)
+	}
+	if isSocketListening(path) {
+		return fmt.Errorf("local socket %s is already in use", path)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale local socket: %w", err)
+	}
+	return nil
+}
+
+// isSocketListening reports whether a Unix socket accepts connections
+func isSocketListening(path string) bool {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
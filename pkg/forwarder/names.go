@@ -0,0 +1,108 @@
+package forwarder
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// namePattern restricts forward names to something easy to type that can't
+// be mistaken for a port number
+var namePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9._-]*$`)
+
+// validateName checks a forward name's format
+func validateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid forward name %q: must start with a letter and contain only letters, digits, '.', '_' or '-'", name)
+	}
+	return nil
+}
+
+// nameOwner returns the key of the forward, pending retry, or lost forward
+// using name, if any
+func (f *Forwarder) nameOwner(name string) (key string, connectionInfo string, ok bool) {
+	f.mu.RLock()
+	for k, fwd := range f.forwards {
+		if fwd.Name == name {
+			f.mu.RUnlock()
+			return k, fwd.ConnectionInfo, true
+		}
+	}
+	f.mu.RUnlock()
+
+	f.retryMu.Lock()
+	for k, r := range f.retries {
+		if r.Name == name {
+			f.retryMu.Unlock()
+			return k, r.ConnectionInfo, true
+		}
+	}
+	f.retryMu.Unlock()
+
+	f.lostMu.Lock()
+	defer f.lostMu.Unlock()
+	for conn, entry := range f.lost {
+		for _, fwd := range entry.forwards {
+			if fwd.Name == name {
+				return fwd.key(), conn, true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// checkNameAvailable fails if name is already used by a forward other than
+// the one stored under key
+func (f *Forwarder) checkNameAvailable(name, key string) error {
+	if name == "" {
+		return nil
+	}
+	if owner, _, ok := f.nameOwner(name); ok && owner != key {
+		return fmt.Errorf("forward name %q is already in use", name)
+	}
+	return nil
+}
+
+// reserveName claims name for the forward stored under key until release
+// is called, failing if another forward uses it or is being set up with it
+func (f *Forwarder) reserveName(name, key string) (release func(), err error) {
+	if name == "" {
+		return func() {}, nil
+	}
+	f.namesMu.Lock()
+	defer f.namesMu.Unlock()
+	if owner, ok := f.reservedNames[name]; ok && owner != key {
+		return nil, fmt.Errorf("forward name %q is already in use", name)
+	}
+	if err := f.checkNameAvailable(name, key); err != nil {
+		return nil, err
+	}
+	f.reservedNames[name] = key
+	return func() {
+		f.namesMu.Lock()
+		defer f.namesMu.Unlock()
+		delete(f.reservedNames, name)
+	}, nil
+}
+
+// RemoveByName removes the forward with the given name
+func (f *Forwarder) RemoveByName(name string) error {
+	key, connectionInfo, ok := f.nameOwner(name)
+	if !ok {
+		return fmt.Errorf("no forward named %q", name)
+	}
+	return f.removeForward(connectionInfo, key)
+}
+
+// FindByName returns a copy of the active forward with the given name
+func (f *Forwarder) FindByName(name string) (Forward, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, fwd := range f.forwards {
+		if fwd.Name == name {
+			return *fwd, true
+		}
+	}
+	return Forward{}, false
+}
@@ -0,0 +1,41 @@
+package forwarder
+
+import "sync"
+
+// defaultWorkers bounds how many connections are operated on at once when
+// no worker count is configured
+const defaultWorkers = 4
+
+// forEachConnection groups items by connection and runs fn once per group
+// on a bounded pool of workers. Groups for different connections run
+// concurrently; items for the same connection are handed to a single call in
+// their original order, so control socket commands for one connection never
+// race each other. Returns once every group has been processed.
+func forEachConnection[T any](workers int, items []T, connectionOf func(T) string, fn func(connectionInfo string, group []T)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var order []string
+	groups := make(map[string][]T)
+	for _, item := range items {
+		conn := connectionOf(item)
+		if _, ok := groups[conn]; !ok {
+			order = append(order, conn)
+		}
+		groups[conn] = append(groups[conn], item)
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, conn := range order {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(conn string, group []T) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(conn, group)
+		}(conn, groups[conn])
+	}
+	wg.Wait()
+}
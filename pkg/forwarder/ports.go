@@ -0,0 +1,168 @@
+package forwarder
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+// PortConflictStrategy controls what happens when a requested local port is
+// already bound by another process
+type PortConflictStrategy string
+
+const (
+	// PortConflictFail rejects the forward (default)
+	PortConflictFail PortConflictStrategy = "fail"
+	// PortConflictNext picks the next free port above the requested one
+	PortConflictNext PortConflictStrategy = "next"
+	// PortConflictRandom lets the OS pick a free ephemeral port
+	PortConflictRandom PortConflictStrategy = "random"
+	// PortConflictSteal cancels the tracked forward holding the port, on
+	// whichever connection, and takes the port over. Ports held by anything
+	// else still fail.
+	PortConflictSteal PortConflictStrategy = "steal"
+)
+
+// validPortConflictStrategy reports whether s names a known strategy
+func validPortConflictStrategy(s PortConflictStrategy) bool {
+	return s != "" && protocol.ValidConflictPolicy(string(s))
+}
+
+// ConflictResolution records how a busy local port was handled when a
+// forward was added
+type ConflictResolution struct {
+	Strategy      PortConflictStrategy // Strategy that applied
+	RequestedPort int                  // Local port that was asked for
+	Stolen        string               // Forward cancelled to free the port ("connection:remote"), for PortConflictSteal
+}
+
+// maxNextPortAttempts bounds how far PortConflictNext searches upward
+const maxNextPortAttempts = 100
+
+// isLocalPortFree reports whether a TCP port can be bound on loopback
+func isLocalPortFree(port int) bool {
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	_ = ln.Close()
+	return true
+}
+
+// conflictStrategy returns the strategy that applies to fwd: its own
+// override, or the forwarder's default
+func (f *Forwarder) conflictStrategy(fwd Forward) PortConflictStrategy {
+	if fwd.Conflict != "" {
+		return fwd.Conflict
+	}
+	return f.portConflict
+}
+
+// portHolder finds the tracked forward, other than the one stored under
+// exceptKey, listening on local port. Returns its key and a copy.
+func (f *Forwarder) portHolder(port int, exceptKey string) (string, Forward, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for key, fwd := range f.forwards {
+		if key != exceptKey && fwd.LocalSocket == "" && fwd.LocalPort == port {
+			return key, *fwd, true
+		}
+	}
+	return "", Forward{}, false
+}
+
+// describeHolder names what holds a busy local port, for error messages
+func (f *Forwarder) describeHolder(port int, exceptKey string) string {
+	if _, holder, ok := f.portHolder(port, exceptKey); ok {
+		return fmt.Sprintf("the forward of %s from %s", holder.RemoteTarget(), holder.ConnectionInfo)
+	}
+	return "another process"
+}
+
+// stealLocalPort frees want's local port for PortConflictSteal by removing
+// the tracked forward holding it, and returns the forward it removed. It
+// does nothing, returning nil, for other strategies, free ports, and ports
+// held by something bankshot doesn't track. It takes the holder's
+// connection lock, so callers must not hold one.
+func (f *Forwarder) stealLocalPort(want Forward) (*Forward, error) {
+	if want.LocalSocket != "" || f.conflictStrategy(want) != PortConflictSteal || isLocalPortFree(want.LocalPort) {
+		return nil, nil
+	}
+	key, holder, ok := f.portHolder(want.LocalPort, want.key())
+	if !ok {
+		return nil, nil
+	}
+
+	f.logger.Info("Cancelling forward to take over its local port",
+		"local", want.LocalPort,
+		"holder", stolenName(holder),
+		"connectionInfo", want.ConnectionInfo,
+	)
+	if err := f.removeForward(holder.ConnectionInfo, key); err != nil {
+		return nil, fmt.Errorf("failed to cancel forward %s holding local port %d: %w", stolenName(holder), want.LocalPort, err)
+	}
+	return &holder, nil
+}
+
+// giveBack re-establishes a forward stealLocalPort cancelled for one that
+// then couldn't be set up, so a failed steal doesn't cost the holder its
+// forward. It takes the holder's connection lock, as stealLocalPort does.
+func (f *Forwarder) giveBack(holder Forward) {
+	want := restoredForward(holder, holder.SocketPath)
+	want.Conflict = PortConflictFail
+	if _, _, err := f.establishForward(want, nil); err != nil {
+		f.logger.Error("Failed to give a stolen local port back to its forward",
+			"local", holder.LocalPort,
+			"holder", stolenName(holder),
+			"error", err,
+		)
+		return
+	}
+	f.logger.Info("Gave a stolen local port back to its forward",
+		"local", holder.LocalPort,
+		"holder", stolenName(holder),
+	)
+}
+
+// stolenName describes a forward cancelled to free its port:
+// "connection:remote"
+func stolenName(holder Forward) string {
+	return holder.ConnectionInfo + ":" + holder.RemoteTarget()
+}
+
+// resolveLocalPort returns the local port a new forward should use. If the
+// requested port is free it is returned unchanged; otherwise strategy
+// decides whether to fail or pick an alternate. Stealing happens before
+// this, in stealLocalPort, so a port still busy under PortConflictSteal is
+// held by something that can't be stolen. key identifies the forward being
+// added, so error messages can name the forward holding the port.
+func (f *Forwarder) resolveLocalPort(port int, strategy PortConflictStrategy, key string) (int, error) {
+	if isLocalPortFree(port) {
+		return port, nil
+	}
+
+	switch strategy {
+	case PortConflictNext:
+		for candidate := port + 1; candidate <= port+maxNextPortAttempts && candidate <= 65535; candidate++ {
+			if isLocalPortFree(candidate) {
+				return candidate, nil
+			}
+		}
+		return 0, fmt.Errorf("local port %d is already in use and no free port found in %d-%d",
+			port, port+1, port+maxNextPortAttempts)
+	case PortConflictRandom:
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return 0, fmt.Errorf("local port %d is already in use and failed to allocate a free port: %w", port, err)
+		}
+		candidate := ln.Addr().(*net.TCPAddr).Port
+		_ = ln.Close()
+		return candidate, nil
+	default:
+		return 0, fmt.Errorf("local port %d is already in use by %s (port conflict policy: %s)",
+			port, f.describeHolder(port, key), strategy)
+	}
+}
@@ -0,0 +1,27 @@
+package forwarder
+
+import "strings"
+
+// processInfo is a running process as seen by autodiscovery
+type processInfo struct {
+	PID  int
+	PPID int
+	Args []string
+}
+
+// titleArgs normalizes a process's argument vector. Processes that set their
+// title (as an ssh control master does, to "ssh: <socket> [mux]") overwrite
+// argv in place, leaving the whole title in the first argument and the rest
+// blank, so a lone argument is split back into words.
+func titleArgs(args []string) []string {
+	var nonEmpty []string
+	for _, arg := range args {
+		if arg != "" {
+			nonEmpty = append(nonEmpty, arg)
+		}
+	}
+	if len(nonEmpty) == 1 {
+		return strings.Fields(nonEmpty[0])
+	}
+	return nonEmpty
+}
@@ -0,0 +1,263 @@
+package forwarder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"slices"
+	"sort"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// proc_info(2) calls, flavors, and constants from <sys/proc_info.h>
+const (
+	procInfoCallPIDInfo   = 2
+	procInfoCallPIDFDInfo = 3
+	procPIDListFDs        = 1
+	procPIDFDSocketInfo   = 3
+	proxFDTypeSocket      = 2
+	sockInfoTCP           = 2
+	tsiStateListen        = 1
+	tsiStateEstablished   = 4
+	iniIPv4               = 0x1
+	iniIPv6               = 0x2
+
+	sizeofProcFDInfo   = 8   // struct proc_fdinfo
+	sizeofSocketFDInfo = 792 // struct socket_fdinfo
+
+	// Offsets into struct socket_fdinfo of the fields a TCP listener is
+	// recognized by
+	offsetSockKind  = 256 // psi.soi_kind
+	offsetLocalPort = 268 // psi.soi_proto.pri_tcp.tcpsi_ini.insi_lport
+	offsetIPVersion = 288 // psi.soi_proto.pri_tcp.tcpsi_ini.insi_vflag
+	offsetLocalAddr = 312 // psi.soi_proto.pri_tcp.tcpsi_ini.insi_laddr
+	offsetTCPState  = 344 // psi.soi_proto.pri_tcp.tcpsi_state
+)
+
+// listProcesses returns the running ssh and tsh processes, read with sysctl.
+// Other processes are left out, since reading every process's arguments is
+// slow and only those matter for discovery.
+func listProcesses() ([]processInfo, error) {
+	procs, err := unix.SysctlKinfoProcSlice("kern.proc.all")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	var processes []processInfo
+	for _, p := range procs {
+		comm := p.Proc.P_comm[:]
+		if i := bytes.IndexByte(comm, 0); i >= 0 {
+			comm = comm[:i]
+		}
+		if string(comm) != "ssh" && string(comm) != "tsh" {
+			continue
+		}
+
+		pid := int(p.Proc.P_pid)
+		args, err := processArgs(pid)
+		if err != nil {
+			// Exited, or not ours
+			continue
+		}
+		processes = append(processes, processInfo{
+			PID:  pid,
+			PPID: int(p.Eproc.Ppid),
+			Args: args,
+		})
+	}
+	return processes, nil
+}
+
+// processArgs returns a process's arguments, read with sysctl, as titleArgs
+// normalizes them
+func processArgs(pid int) ([]string, error) {
+	data, err := unix.SysctlRaw("kern.procargs2", pid)
+	if err != nil {
+		return nil, err
+	}
+	return titleArgs(parseProcArgs(data)), nil
+}
+
+// parseProcArgs parses kern.procargs2 data: argc, the executable path, NUL
+// padding, and then argc NUL-terminated arguments
+func parseProcArgs(data []byte) []string {
+	if len(data) < 4 {
+		return nil
+	}
+	argc := int(binary.LittleEndian.Uint32(data))
+	rest := data[4:]
+
+	end := bytes.IndexByte(rest, 0)
+	if end < 0 {
+		return nil
+	}
+	rest = bytes.TrimLeft(rest[end:], "\x00")
+
+	args := make([]string, 0, argc)
+	for len(args) < argc && len(rest) > 0 {
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			end = len(rest)
+		}
+		args = append(args, string(rest[:end]))
+		if end == len(rest) {
+			break
+		}
+		rest = rest[end+1:]
+	}
+	return args
+}
+
+// procInfo makes a proc_info(2) call into buf and returns the number of bytes
+// it filled in
+func procInfo(call, pid, flavor int, arg uint64, buf []byte) (int, error) {
+	n, _, errno := unix.Syscall6(unix.SYS_PROC_INFO,
+		uintptr(call), uintptr(pid), uintptr(flavor), uintptr(arg),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+// listeningPorts returns the loopback TCP ports a process listens on, by
+// inspecting its socket descriptors with proc_info(2)
+func listeningPorts(pid int) ([]int, error) {
+	sockets, err := tcpSockets(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	var ports []int
+	for _, sock := range sockets {
+		if sock.state != tsiStateListen || !sock.localAddr.IsLoopback() || seen[sock.localPort] {
+			continue
+		}
+		seen[sock.localPort] = true
+		ports = append(ports, sock.localPort)
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// connectedPorts returns the local ports of a process's established TCP
+// connections
+func connectedPorts(pid int) ([]int, error) {
+	sockets, err := tcpSockets(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []int
+	for _, sock := range sockets {
+		if sock.state == tsiStateEstablished {
+			ports = append(ports, sock.localPort)
+		}
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// tcpSocket is the local end of a TCP socket held by a process
+type tcpSocket struct {
+	state     uint32 // tsiState*
+	localAddr net.IP
+	localPort int
+}
+
+// tcpSockets returns the TCP sockets among a process's descriptors
+func tcpSockets(pid int) ([]tcpSocket, error) {
+	// Grow the buffer until the descriptor list fits
+	buf := make([]byte, 256*sizeofProcFDInfo)
+	var n int
+	for {
+		var err error
+		n, err = procInfo(procInfoCallPIDInfo, pid, procPIDListFDs, 0, buf)
+		if err != nil {
+			// Process might have exited
+			return nil, fmt.Errorf("failed to list file descriptors: %w", err)
+		}
+		if n < len(buf) {
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var sockets []tcpSocket
+	info := make([]byte, sizeofSocketFDInfo)
+	for off := 0; off+sizeofProcFDInfo <= n; off += sizeofProcFDInfo {
+		fd := int32(binary.LittleEndian.Uint32(buf[off:]))
+		fdType := binary.LittleEndian.Uint32(buf[off+4:])
+		if fdType != proxFDTypeSocket {
+			continue
+		}
+
+		got, err := procInfo(procInfoCallPIDFDInfo, pid, procPIDFDSocketInfo, uint64(fd), info)
+		if err != nil {
+			if errors.Is(err, unix.EBADF) {
+				// Closed since the list was taken
+				continue
+			}
+			return nil, fmt.Errorf("failed to inspect socket: %w", err)
+		}
+		if got <= offsetTCPState {
+			continue
+		}
+		if binary.LittleEndian.Uint32(info[offsetSockKind:]) != sockInfoTCP {
+			continue
+		}
+
+		// Copied, since info is reused for the next socket
+		var addr net.IP
+		switch vflag := info[offsetIPVersion]; {
+		case vflag&iniIPv4 != 0:
+			addr = slices.Clone(net.IP(info[offsetLocalAddr+12 : offsetLocalAddr+16]))
+		case vflag&iniIPv6 != 0:
+			addr = slices.Clone(net.IP(info[offsetLocalAddr : offsetLocalAddr+16]))
+		default:
+			continue
+		}
+
+		sockets = append(sockets, tcpSocket{
+			state:     binary.LittleEndian.Uint32(info[offsetTCPState:]),
+			localAddr: addr,
+			// The port is kept in network byte order
+			localPort: int(binary.BigEndian.Uint16(info[offsetLocalPort:])),
+		})
+	}
+	return sockets, nil
+}
+
+// processesAdoptable is whether a daemon can find and adopt the processes of
+// an earlier one's forwards here
+const processesAdoptable = true
+
+// sessionLeader reports whether a process leads its own session, as the
+// processes runForward detaches do
+func sessionLeader(pid int) bool {
+	sid, err := unix.Getsid(pid)
+	return err == nil && sid == pid
+}
+
+// detach starts cmd in a session of its own, so it outlives the daemon and
+// isn't sent the signals of the daemon's terminal
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// establishedLocalPorts returns the local ports with an established TCP
+// connection, from netstat, as macOS has no /proc/net to read
+func establishedLocalPorts() (map[int]bool, error) {
+	output, err := exec.Command("netstat", "-an", "-p", "tcp").Output()
+	if err != nil {
+		return nil, fmt.Errorf("netstat failed: %w", err)
+	}
+	return parseNetstatEstablished(string(output)), nil
+}
@@ -0,0 +1,160 @@
+package forwarder
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/phinze/bankshot/pkg/monitor"
+	"golang.org/x/sys/unix"
+)
+
+// listProcesses returns the running processes, read from /proc
+func listProcesses() ([]processInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	var processes []processInfo
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		args, err := processArgs(pid)
+		if err != nil || len(args) == 0 {
+			// Exited, or a kernel thread
+			continue
+		}
+		processes = append(processes, processInfo{
+			PID:  pid,
+			PPID: monitor.ResolveParentPID(pid),
+			Args: args,
+		})
+	}
+	return processes, nil
+}
+
+// processArgs returns a process's arguments, read from /proc, as titleArgs
+// normalizes them
+func processArgs(pid int) ([]string, error) {
+	cmdline, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	return titleArgs(strings.Split(string(cmdline), "\x00")), nil
+}
+
+// listeningPorts returns the loopback TCP ports a process listens on, by
+// matching the socket inodes among its file descriptors against the
+// listeners in /proc/net/tcp{,6}
+func listeningPorts(pid int) ([]int, error) {
+	inodes, err := socketInodes(pid)
+	if err != nil || len(inodes) == 0 {
+		return nil, err
+	}
+
+	listening, err := monitor.GetListeningPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	var ports []int
+	for _, port := range listening {
+		if !inodes[port.Inode] || !isLoopbackAddr(port.BindAddr) || seen[port.Port] {
+			continue
+		}
+		seen[port.Port] = true
+		ports = append(ports, port.Port)
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// connectedPorts returns the local ports of a process's established TCP
+// connections
+func connectedPorts(pid int) ([]int, error) {
+	inodes, err := socketInodes(pid)
+	if err != nil || len(inodes) == 0 {
+		return nil, err
+	}
+
+	established, err := monitor.GetEstablishedSockets()
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []int
+	for _, port := range established {
+		if inodes[port.Inode] {
+			ports = append(ports, port.Port)
+		}
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// socketInodes returns the inodes of the sockets among a process's file
+// descriptors
+func socketInodes(pid int) (map[uint64]bool, error) {
+	fdDir := filepath.Join("/proc", strconv.Itoa(pid), "fd")
+	fds, err := os.ReadDir(fdDir)
+	if err != nil {
+		// Process might have exited
+		return nil, fmt.Errorf("failed to read file descriptors: %w", err)
+	}
+
+	inodes := make(map[uint64]bool)
+	for _, fd := range fds {
+		target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+		if err != nil {
+			continue
+		}
+		// Socket descriptors link to "socket:[<inode>]"
+		if !strings.HasPrefix(target, "socket:[") || !strings.HasSuffix(target, "]") {
+			continue
+		}
+		inode, err := strconv.ParseUint(target[len("socket:["):len(target)-1], 10, 64)
+		if err == nil {
+			inodes[inode] = true
+		}
+	}
+	return inodes, nil
+}
+
+// isLoopbackAddr reports whether addr is a loopback IP address
+func isLoopbackAddr(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
+// processesAdoptable is whether a daemon can find and adopt the processes of
+// an earlier one's forwards here
+const processesAdoptable = true
+
+// sessionLeader reports whether a process leads its own session, as the
+// processes runForward detaches do
+func sessionLeader(pid int) bool {
+	sid, err := unix.Getsid(pid)
+	return err == nil && sid == pid
+}
+
+// detach starts cmd in a session of its own, so it outlives the daemon and
+// isn't sent the signals of the daemon's terminal
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// establishedLocalPorts returns the local ports with an established TCP
+// connection, read from /proc/net
+func establishedLocalPorts() (map[int]bool, error) {
+	return monitor.GetEstablishedPorts()
+}
@@ -0,0 +1,48 @@
+//go:build !linux && !darwin
+
+package forwarder
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// listProcesses is not supported on this platform
+func listProcesses() ([]processInfo, error) {
+	return nil, fmt.Errorf("listing processes is not supported on %s", runtime.GOOS)
+}
+
+// processArgs is not supported on this platform
+func processArgs(pid int) ([]string, error) {
+	return nil, fmt.Errorf("reading process arguments is not supported on %s", runtime.GOOS)
+}
+
+// listeningPorts is not supported on this platform
+func listeningPorts(pid int) ([]int, error) {
+	return nil, fmt.Errorf("listing listening ports is not supported on %s", runtime.GOOS)
+}
+
+// connectedPorts is not supported on this platform
+func connectedPorts(pid int) ([]int, error) {
+	return nil, fmt.Errorf("listing connections is not supported on %s", runtime.GOOS)
+}
+
+// processesAdoptable is whether a daemon can find and adopt the processes of
+// an earlier one's forwards here
+const processesAdoptable = false
+
+// sessionLeader is not supported on this platform, so no process is adopted
+func sessionLeader(pid int) bool {
+	return false
+}
+
+// detach is not supported on this platform; processes stay in the daemon's
+// group
+func detach(cmd *exec.Cmd) {}
+
+// establishedLocalPorts is not supported on this platform, so only forwards
+// behind an accounting relay are removed when idle
+func establishedLocalPorts() (map[int]bool, error) {
+	return nil, fmt.Errorf("listing established connections is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,223 @@
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+// maxRangeSize caps how many ports a single range request may forward
+const maxRangeSize = 100
+
+// GroupStatus summarizes the forwards added by one port range request
+type GroupStatus struct {
+	Group          string
+	ConnectionInfo string
+	Ports          int // Ports in the range
+	Active         int // Ports currently forwarded
+	Pending        int // Ports waiting to be retried
+}
+
+// rangeGroup names the group for a remote port range, e.g.
+// "localhost:3000-3010"
+func rangeGroup(host string, start, end int) string {
+	return fmt.Sprintf("%s:%d-%d", bracketHost(host), start, end)
+}
+
+// parseRangeGroup returns the first and last remote port of a group named
+// by rangeGroup
+func parseRangeGroup(group string) (int, int, bool) {
+	var start, end int
+	ports := group[strings.LastIndex(group, ":")+1:]
+	if _, err := fmt.Sscanf(ports, "%d-%d", &start, &end); err != nil {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// rangeSize returns the number of ports in a group named by rangeGroup
+func rangeSize(group string) int {
+	start, end, ok := parseRangeGroup(group)
+	if !ok {
+		return 0
+	}
+	return end - start + 1
+}
+
+// AddRange forwards the contiguous remote ports start through end as a group
+// that can later be removed with RemoveRange. Local ports start at localStart
+// (0 = same as start) and follow the range, though the port conflict strategy
+// may pick alternates for busy ones. Returns the local port for each remote
+// port, in order, and whether any new forward was created. A port ssh
+// rejected and queued for retry has a local port of 0. Every forward in the
+// group is recorded as requested by owner.
+//
+// If any port fails outright, the forwards this call created are removed
+// again and the error is returned.
+func (f *Forwarder) AddRange(socketPath, connectionInfo string, start, end, localStart int, host, owner string) ([]int, bool, error) {
+	localStart, host, err := normalizeRange(start, end, localStart, host)
+	if err != nil {
+		return nil, false, err
+	}
+	group := rangeGroup(host, start, end)
+
+	localPorts := make([]int, 0, end-start+1)
+	var added []string
+	anyCreated := false
+	for port := start; port <= end; port++ {
+		want := Forward{
+			RemotePort:     port,
+			LocalPort:      localStart + (port - start),
+			Host:           host,
+			Group:          group,
+			SocketPath:     socketPath,
+			Owner:          owner,
+			ConnectionInfo: connectionInfo,
+		}
+
+		localPort, created, err := f.Add(want)
+		if errors.Is(err, ErrRetryQueued) {
+			added = append(added, want.key())
+			localPorts = append(localPorts, 0)
+			continue
+		}
+		if err != nil {
+			if len(added) > 0 {
+				if rollbackErr := f.removeForwards(connectionInfo, added); rollbackErr != nil {
+					f.logger.Warn("Failed to roll back port range",
+						"group", group,
+						"error", rollbackErr,
+					)
+				}
+			}
+			return nil, false, fmt.Errorf("failed to forward port %d of range %d-%d: %w", port, start, end, err)
+		}
+		if created {
+			added = append(added, want.key())
+			anyCreated = true
+		}
+		localPorts = append(localPorts, localPort)
+	}
+
+	f.logger.Info("Port range forwarded",
+		"group", group,
+		"connectionInfo", connectionInfo,
+		"ports", len(localPorts),
+	)
+	return localPorts, anyCreated, nil
+}
+
+// normalizeRange validates a range request and fills in the defaults for
+// its first local port and host
+func normalizeRange(start, end, localStart int, host string) (int, string, error) {
+	if start <= 0 || end < start {
+		return 0, "", fmt.Errorf("invalid port range %d-%d", start, end)
+	}
+	if end-start+1 > maxRangeSize {
+		return 0, "", fmt.Errorf("port range %d-%d is larger than %d ports", start, end, maxRangeSize)
+	}
+	if localStart == 0 {
+		localStart = start
+	}
+	if localStart+(end-start) > 65535 {
+		return 0, "", fmt.Errorf("local port range starting at %d exceeds 65535", localStart)
+	}
+	host = protocol.NormalizeHost(host)
+	if host == "" {
+		host = "localhost"
+	}
+	return localStart, host, nil
+}
+
+// RemoveRange removes every forward, and pending retry, added by the range
+// request for start through end on host
+func (f *Forwarder) RemoveRange(connectionInfo string, start, end int, host string) error {
+	keys, err := f.rangeKeys(connectionInfo, start, end, host)
+	if err != nil {
+		return err
+	}
+	return f.removeForwards(connectionInfo, keys)
+}
+
+// rangeKeys returns the keys of the forwards and pending retries added by the
+// range request for start through end on host
+func (f *Forwarder) rangeKeys(connectionInfo string, start, end int, host string) ([]string, error) {
+	host = protocol.NormalizeHost(host)
+	if host == "" {
+		host = "localhost"
+	}
+	group := rangeGroup(host, start, end)
+
+	var keys []string
+	f.mu.RLock()
+	for key, fwd := range f.forwards {
+		if fwd.ConnectionInfo == connectionInfo && fwd.Group == group {
+			keys = append(keys, key)
+		}
+	}
+	f.mu.RUnlock()
+
+	f.retryMu.Lock()
+	for key, r := range f.retries {
+		if r.ConnectionInfo == connectionInfo && r.Group == group {
+			keys = append(keys, key)
+		}
+	}
+	f.retryMu.Unlock()
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("port range not found: %s", group)
+	}
+	return keys, nil
+}
+
+// Groups reports the state of every port range with active or pending
+// forwards
+func (f *Forwarder) Groups() []GroupStatus {
+	type groupKey struct{ connectionInfo, group string }
+	groups := make(map[groupKey]*GroupStatus)
+	get := func(connectionInfo, group string) *GroupStatus {
+		k := groupKey{connectionInfo, group}
+		g, ok := groups[k]
+		if !ok {
+			g = &GroupStatus{
+				Group:          group,
+				ConnectionInfo: connectionInfo,
+				Ports:          rangeSize(group),
+			}
+			groups[k] = g
+		}
+		return g
+	}
+
+	f.mu.RLock()
+	for _, fwd := range f.forwards {
+		if fwd.Group != "" {
+			get(fwd.ConnectionInfo, fwd.Group).Active++
+		}
+	}
+	f.mu.RUnlock()
+
+	f.retryMu.Lock()
+	for _, r := range f.retries {
+		if r.Group != "" {
+			get(r.ConnectionInfo, r.Group).Pending++
+		}
+	}
+	f.retryMu.Unlock()
+
+	result := make([]GroupStatus, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ConnectionInfo != result[j].ConnectionInfo {
+			return result[i].ConnectionInfo < result[j].ConnectionInfo
+		}
+		return result[i].Group < result[j].Group
+	})
+	return result
+}
@@ -0,0 +1,70 @@
+package forwarder
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// reachablePollInterval is how often WaitReachable probes a forward
+	reachablePollInterval = 250 * time.Millisecond
+
+	// reachableProbeWait is how long a probe connection waits to be closed.
+	// ssh accepts a connection to a forward's local port whether or not
+	// anything listens on the remote end, and closes it as soon as the
+	// remote end refuses it.
+	reachableProbeWait = 300 * time.Millisecond
+)
+
+// WaitReachable waits up to timeout for connections to want's local port to
+// reach something listening on the remote end, and reports whether they
+// did. It's for a URL opened right after its port is forwarded, which would
+// otherwise load before the server on the remote host is up.
+func (f *Forwarder) WaitReachable(want Forward, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		fwd, ok := f.Find(want)
+		if ok && fwd.LocalSocket == "" && f.Reachable(&fwd) {
+			return true
+		}
+		if time.Now().Add(reachablePollInterval).After(deadline) {
+			return false
+		}
+		time.Sleep(reachablePollInterval)
+	}
+}
+
+// Reachable reports whether a connection to fwd's local end reaches
+// something listening on the remote end. A socket forward can't be probed
+// that way, so it's reachable once its local socket accepts connections.
+func (f *Forwarder) Reachable(fwd *Forward) bool {
+	if fwd.LocalSocket != "" {
+		return isSocketListening(fwd.LocalSocket)
+	}
+	return f.checkReachable(fwd.LocalBindAddress(), fwd.LocalPort)
+}
+
+// isReachable reports whether a connection to a forward's local port reaches
+// the remote end: one still open after reachableProbeWait, or that the
+// server has already written to, got through, where one ssh closed didn't
+func isReachable(bindAddress string, port int) bool {
+	host := bindAddress
+	if host == "" || host == "*" || host == "0.0.0.0" {
+		host = "127.0.0.1"
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), time.Second)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_ = conn.SetReadDeadline(time.Now().Add(reachableProbeWait))
+	_, err = conn.Read(make([]byte, 1))
+	var netErr net.Error
+	return err == nil || errors.As(err, &netErr) && netErr.Timeout()
+}
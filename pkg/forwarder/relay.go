@@ -0,0 +1,208 @@
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds traffic counters for a forward fronted by an accounting relay
+type Stats struct {
+	BytesSent         uint64 // Local client -> remote
+	BytesReceived     uint64 // Remote -> local client
+	Connections       uint64 // Total connections accepted
+	ActiveConnections int64  // Connections currently open
+}
+
+// relay is a TCP proxy that listens on a forward's local port and hands each
+// connection off to the port ssh is actually listening on, counting traffic
+// along the way
+type relay struct {
+	logger   *slog.Logger
+	listener net.Listener
+	target   string
+
+	bytesSent     atomic.Uint64
+	bytesReceived atomic.Uint64
+	connections   atomic.Uint64
+	active        atomic.Int64
+	lastActivity  atomic.Int64 // Unix nanoseconds of the last connection open or close
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// startRelay listens on listenHost (loopback when empty) at listenPort and
+// relays connections to loopback at targetPort
+func startRelay(logger *slog.Logger, listenHost string, listenPort, targetPort int) (*relay, error) {
+	if listenHost == "" {
+		listenHost = "127.0.0.1"
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(listenHost, strconv.Itoa(listenPort)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start relay on port %d: %w", listenPort, err)
+	}
+
+	r := &relay{
+		logger:   logger,
+		listener: ln,
+		target:   net.JoinHostPort("127.0.0.1", strconv.Itoa(targetPort)),
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	r.wg.Add(1)
+	go r.serve()
+
+	return r, nil
+}
+
+// allocateLoopbackPort asks the OS for a free loopback port
+func allocateLoopbackPort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate relay target port: %w", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+	return port, nil
+}
+
+func (r *relay) serve() {
+	defer r.wg.Done()
+
+	for {
+		client, err := r.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				r.logger.Error("Relay accept failed", "target", r.target, "error", err)
+			}
+			return
+		}
+
+		r.wg.Add(1)
+		go r.handle(client)
+	}
+}
+
+func (r *relay) handle(client net.Conn) {
+	defer r.wg.Done()
+
+	r.connections.Add(1)
+	r.active.Add(1)
+	r.touch()
+	defer r.touch()
+	defer r.active.Add(-1)
+
+	upstream, err := net.Dial("tcp", r.target)
+	if err != nil {
+		r.logger.Warn("Relay failed to reach forwarded port", "target", r.target, "error", err)
+		_ = client.Close()
+		return
+	}
+
+	if !r.track(client, upstream) {
+		_ = client.Close()
+		_ = upstream.Close()
+		return
+	}
+	defer r.untrack(client, upstream)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		n, _ := io.Copy(upstream, client)
+		r.bytesSent.Add(uint64(n))
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		n, _ := io.Copy(client, upstream)
+		r.bytesReceived.Add(uint64(n))
+		closeWrite(client)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+
+	_ = client.Close()
+	_ = upstream.Close()
+}
+
+// closeWrite half-closes a TCP connection so the peer sees EOF while replies
+// can still flow back
+func closeWrite(conn net.Conn) {
+	if tc, ok := conn.(*net.TCPConn); ok {
+		_ = tc.CloseWrite()
+		return
+	}
+	_ = conn.Close()
+}
+
+// track registers open connections so close can tear them down. Returns
+// false if the relay is already closing.
+func (r *relay) track(conns ...net.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	for _, c := range conns {
+		r.conns[c] = struct{}{}
+	}
+	return true
+}
+
+func (r *relay) untrack(conns ...net.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range conns {
+		delete(r.conns, c)
+	}
+}
+
+// touch records activity on the relay
+func (r *relay) touch() {
+	r.lastActivity.Store(time.Now().UnixNano())
+}
+
+// lastActive returns when a connection last opened or closed on the relay,
+// and false if it has never been used
+func (r *relay) lastActive() (time.Time, bool) {
+	last := r.lastActivity.Load()
+	if last == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, last), true
+}
+
+// stats returns a snapshot of the relay's counters
+func (r *relay) stats() Stats {
+	return Stats{
+		BytesSent:         r.bytesSent.Load(),
+		BytesReceived:     r.bytesReceived.Load(),
+		Connections:       r.connections.Load(),
+		ActiveConnections: r.active.Load(),
+	}
+}
+
+// close stops accepting connections, tears down open ones, and waits for
+// all relay goroutines to exit
+func (r *relay) close() {
+	_ = r.listener.Close()
+
+	r.mu.Lock()
+	r.closed = true
+	for c := range r.conns {
+		_ = c.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+}
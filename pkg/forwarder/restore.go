@@ -0,0 +1,138 @@
+package forwarder
+
+import (
+	"net"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lockConnection serializes control socket operations for a single
+// connection so a cancel and the restore that follows it can't interleave
+// with other changes to the same connection. Returns the unlock function.
+func (f *Forwarder) lockConnection(connectionInfo string) func() {
+	f.connLocksMu.Lock()
+	lock, ok := f.connLocks[connectionInfo]
+	if !ok {
+		lock = &sync.Mutex{}
+		f.connLocks[connectionInfo] = lock
+	}
+	f.connLocksMu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// snapshotConnection returns copies of the tracked forwards a connection has
+// through socketPath, excluding the forwards stored under skipKeys.
+func (f *Forwarder) snapshotConnection(connectionInfo, socketPath string, skipKeys ...string) []Forward {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var snapshot []Forward
+	for key, fwd := range f.forwards {
+		if fwd.ConnectionInfo == connectionInfo && fwd.SocketPath == socketPath && !slices.Contains(skipKeys, key) {
+			snapshot = append(snapshot, *fwd)
+		}
+	}
+	return snapshot
+}
+
+// restoreConnection re-adds everything a connection should still be
+// forwarding after an `ssh -O cancel`. OpenSSH drops every socket forward on
+// the control master when any forward is cancelled, so this first asks ssh to
+// re-apply the forwards declared in ssh_config (including Unix socket
+// forwards like ~/.bankshot.sock), then re-adds each tracked forward from the
+// snapshot and verifies its local port accepts connections. Returns the
+// forwards that could not be restored.
+func (f *Forwarder) restoreConnection(socketPath, connectionInfo string, snapshot []Forward) []Forward {
+	// A ProcessBackend cancel only stops the cancelled forward's process
+	if f.isProcessBackend() {
+		return nil
+	}
+
+	if configCmd := f.configForwardCommand(socketPath, connectionInfo); configCmd != nil {
+		f.logger.Info("Re-establishing configured forwards after cancel",
+			"command", strings.Join(configCmd.Args, " "),
+		)
+
+		if output, err := f.runCommand(configCmd); err != nil {
+			f.logger.Error("Failed to re-establish configured forwards",
+				"error", err,
+				"output", string(output),
+			)
+		}
+	}
+
+	var failed []Forward
+	for _, fwd := range snapshot {
+		output, err := f.runForward(&fwd, f.forwardCommand(&fwd))
+		if err != nil {
+			f.logger.Error("Failed to restore forward after cancel",
+				"remote", fwd.RemoteTarget(),
+				"local", fwd.LocalPort,
+				"error", err,
+				"output", string(output),
+			)
+			failed = append(failed, fwd)
+			continue
+		}
+
+		if !f.LocalEndListening(&fwd) {
+			f.logger.Warn("Restored forward is not accepting connections",
+				"remote", fwd.RemoteTarget(),
+				"local", fwd.LocalPort,
+			)
+			failed = append(failed, fwd)
+			continue
+		}
+
+		f.logger.Debug("Restored forward after cancel",
+			"remote", fwd.RemoteTarget(),
+			"local", fwd.LocalPort,
+		)
+	}
+
+	if len(snapshot) > 0 {
+		f.logger.Info("Restored forwards after cancel",
+			"connectionInfo", connectionInfo,
+			"restored", len(snapshot)-len(failed),
+			"failed", len(failed),
+		)
+	}
+
+	return failed
+}
+
+// configForwardCommand builds the backend command that re-applies the
+// forwards a connection's own config declares, or nil if it has none
+func (f *Forwarder) configForwardCommand(socketPath, connectionInfo string) *exec.Cmd {
+	return f.backend.RestoreCommand(socketPath, connectionInfo)
+}
+
+// LocalEndListening reports whether fwd's local port or socket, as ssh
+// listens on it, accepts connections
+func (f *Forwarder) LocalEndListening(fwd *Forward) bool {
+	if fwd.LocalSocket != "" {
+		return isSocketListening(fwd.LocalSocket)
+	}
+	return f.checkListening(fwd.BindAddress, fwd.sshLocalPort())
+}
+
+// isListening reports whether a local forward's port accepts connections
+func isListening(bindAddress string, port int) bool {
+	host := bindAddress
+	if host == "" || host == "*" || host == "0.0.0.0" {
+		host = "127.0.0.1"
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), time.Second)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
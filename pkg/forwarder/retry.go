@@ -0,0 +1,195 @@
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRetryQueued is returned (wrapped) by AddForward when the SSH forward
+// failed and the request was queued to be retried in the background
+var ErrRetryQueued = errors.New("forward queued for retry")
+
+const (
+	// retryInitialBackoff is the delay before the first retry
+	retryInitialBackoff = 2 * time.Second
+	// retryMaxBackoff caps the delay between retries
+	retryMaxBackoff = 5 * time.Minute
+)
+
+// sshForwardError reports that ssh itself rejected a forward request (control
+// socket busy, transient SSH failure), as opposed to a local problem like a
+// busy port. Only these failures are retried.
+type sshForwardError struct {
+	err    error
+	output string
+}
+
+func (e *sshForwardError) Error() string {
+	return fmt.Sprintf("failed to forward port: %v (output: %s)", e.err, e.output)
+}
+
+func (e *sshForwardError) Unwrap() error {
+	return e.err
+}
+
+// PendingRetry describes a forward waiting to be retried
+type PendingRetry struct {
+	SocketPath     string
+	ConnectionInfo string
+	RemotePort     int
+	LocalPort      int
+	Host           string
+	RemoteSocket   string
+	LocalSocket    string
+	Group          string
+	Pinned         bool
+	BindAddress    string
+	Name           string
+	Owner          string
+	AppProtocol    string
+	Server         string
+	Conflict       PortConflictStrategy
+	IdleTimeout    time.Duration
+	Attempts       int
+	NextAttempt    time.Time
+	LastError      string
+}
+
+// retryBackoff returns the delay before the given attempt number (1-based)
+func retryBackoff(attempt int) time.Duration {
+	backoff := retryInitialBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if backoff >= retryMaxBackoff {
+			return retryMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// enqueueRetry records a failed forward for retry, or gives up if it has
+// exhausted its attempts. Returns false when the forward was abandoned.
+func (f *Forwarder) enqueueRetry(key string, retry PendingRetry, cause error) bool {
+	f.retryMu.Lock()
+	defer f.retryMu.Unlock()
+
+	if existing, ok := f.retries[key]; ok {
+		retry.Attempts = existing.Attempts
+	}
+	retry.Attempts++
+	retry.LastError = cause.Error()
+
+	if retry.Attempts > f.retryMaxAttempts {
+		delete(f.retries, key)
+		return false
+	}
+
+	retry.NextAttempt = time.Now().Add(retryBackoff(retry.Attempts))
+	f.retries[key] = &retry
+	return true
+}
+
+// cancelRetry drops any pending retry for key. Returns true if one existed.
+func (f *Forwarder) cancelRetry(key string) bool {
+	f.retryMu.Lock()
+	defer f.retryMu.Unlock()
+
+	_, ok := f.retries[key]
+	delete(f.retries, key)
+	return ok
+}
+
+// PendingRetries returns the forwards currently waiting to be retried
+func (f *Forwarder) PendingRetries() []PendingRetry {
+	f.retryMu.Lock()
+	defer f.retryMu.Unlock()
+
+	retries := make([]PendingRetry, 0, len(f.retries))
+	for _, r := range f.retries {
+		retries = append(retries, *r)
+	}
+	return retries
+}
+
+// ProcessRetries attempts every queued forward whose backoff has elapsed.
+// Forwards that still fail are re-queued with a longer backoff until they
+// run out of attempts, at which point an EventRetryExhausted is emitted.
+func (f *Forwarder) ProcessRetries() {
+	now := time.Now()
+
+	f.retryMu.Lock()
+	var due []PendingRetry
+	for _, r := range f.retries {
+		if !now.Before(r.NextAttempt) {
+			due = append(due, *r)
+		}
+	}
+	f.retryMu.Unlock()
+
+	forEachConnection(f.workers, due, func(r PendingRetry) string {
+		return r.ConnectionInfo
+	}, func(_ string, group []PendingRetry) {
+		for _, r := range group {
+			want := Forward{
+				RemotePort:     r.RemotePort,
+				LocalPort:      r.LocalPort,
+				Host:           r.Host,
+				RemoteSocket:   r.RemoteSocket,
+				LocalSocket:    r.LocalSocket,
+				Group:          r.Group,
+				SocketPath:     r.SocketPath,
+				Pinned:         r.Pinned,
+				BindAddress:    r.BindAddress,
+				Name:           r.Name,
+				Owner:          r.Owner,
+				AppProtocol:    r.AppProtocol,
+				Server:         r.Server,
+				Conflict:       r.Conflict,
+				IdleTimeout:    r.IdleTimeout,
+				ConnectionInfo: r.ConnectionInfo,
+			}
+			key := want.key()
+
+			f.logger.Info("Retrying forward",
+				"connectionInfo", r.ConnectionInfo,
+				"remote", want.RemoteTarget(),
+				"attempt", r.Attempts+1,
+			)
+
+			localPort, _, err := f.addForward(want)
+			if err == nil {
+				f.cancelRetry(key)
+				f.logger.Info("Forward established after retry",
+					"connectionInfo", r.ConnectionInfo,
+					"remote", want.RemoteTarget(),
+					"localPort", localPort,
+					"attempts", r.Attempts+1,
+				)
+				continue
+			}
+
+			// The retry may have been cancelled while we were attempting it
+			f.retryMu.Lock()
+			_, stillPending := f.retries[key]
+			f.retryMu.Unlock()
+			if !stillPending {
+				continue
+			}
+
+			var sshErr *sshForwardError
+			if errors.As(err, &sshErr) && f.enqueueRetry(key, r, err) {
+				continue
+			}
+
+			f.cancelRetry(key)
+			f.logger.Warn("Giving up on forward",
+				"connectionInfo", r.ConnectionInfo,
+				"remote", want.RemoteTarget(),
+				"attempts", r.Attempts+1,
+				"error", err,
+			)
+			f.emit(EventRetryExhausted, want, fmt.Sprintf("gave up after %d attempts: %v", r.Attempts+1, err))
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package forwarder
+
+import (
+	"sync"
+	"time"
+)
+
+// controlSocketCacheTTL is how long a resolved control socket is reused
+// before ssh is asked again
+const controlSocketCacheTTL = 30 * time.Second
+
+// controlSocketCache remembers FindControlSocket results per connection so a
+// burst of forward requests doesn't shell out to `ssh -O check` and `ssh -G`
+// for each one. Only successful lookups are cached, and a cached socket is
+// still checked to exist before it is handed out.
+type controlSocketCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	resolve func(connectionInfo string) (string, error) // the forwarder backend's Resolve
+	verify  func(controlPath string) error              // defaults to verifyControlSocket
+
+	mu      sync.Mutex
+	entries map[string]cachedControlSocket // key: connectionInfo
+}
+
+type cachedControlSocket struct {
+	path    string
+	expires time.Time
+}
+
+func newControlSocketCache(ttl time.Duration, resolve func(connectionInfo string) (string, error)) *controlSocketCache {
+	return &controlSocketCache{
+		ttl:     ttl,
+		now:     time.Now,
+		resolve: resolve,
+		verify:  verifyControlSocket,
+		entries: make(map[string]cachedControlSocket),
+	}
+}
+
+// lookup returns the control socket for connectionInfo, resolving it with ssh
+// when there is no fresh cached entry
+func (c *controlSocketCache) lookup(connectionInfo string) (string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[connectionInfo]
+	c.mu.Unlock()
+
+	if ok && c.now().Before(entry.expires) && c.verify(entry.path) == nil {
+		return entry.path, nil
+	}
+
+	path, err := c.resolve(connectionInfo)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		delete(c.entries, connectionInfo)
+		return "", err
+	}
+	c.entries[connectionInfo] = cachedControlSocket{
+		path:    path,
+		expires: c.now().Add(c.ttl),
+	}
+	return path, nil
+}
+
+// invalidate forgets the cached socket for connectionInfo
+func (c *controlSocketCache) invalidate(connectionInfo string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, connectionInfo)
+}
@@ -0,0 +1,247 @@
+package forwarder
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// DefaultControlPath is the ControlPath `bankshot ssh` gives hosts whose
+// ssh_config sets none, in ssh_config's token syntax
+const DefaultControlPath = "~/.ssh/bankshot-%r@%h:%p"
+
+// sshHostConfig holds the subset of `ssh -G` output bankshot cares about
+type sshHostConfig struct {
+	Hostname    string
+	User        string
+	Port        int
+	ControlPath string
+	ProxyJump   []string // Jump hosts in order, without user or port
+
+	// LocalForwards are the TCP LocalForward directives that apply to the
+	// host; socket forwards are left out
+	LocalForwards []configuredForward
+}
+
+// configuredForward is a LocalForward directive from ssh_config
+type configuredForward struct {
+	LocalPort  int
+	RemoteHost string
+	RemotePort int
+}
+
+// resolveSSHConfig evaluates the ssh configuration for a host with sshCmd
+func resolveSSHConfig(sshCmd, host string) (sshHostConfig, error) {
+	output, err := exec.Command(sshCmd, "-G", host).Output()
+	if err != nil {
+		return sshHostConfig{}, fmt.Errorf("failed to get SSH config for %s: %w", host, err)
+	}
+	return parseSSHConfig(string(output)), nil
+}
+
+// defaultControlPath expands DefaultControlPath for the host
+func (c sshHostConfig) defaultControlPath() (string, error) {
+	path := strings.NewReplacer(
+		"%%", "%",
+		"%r", c.User,
+		"%h", c.Hostname,
+		"%p", strconv.Itoa(c.Port),
+	).Replace(DefaultControlPath)
+	return homedir.Expand(path)
+}
+
+// parseSSHConfig parses `ssh -G` output
+func parseSSHConfig(output string) sshHostConfig {
+	var cfg sshHostConfig
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 2 {
+			continue
+		}
+		value := strings.Join(parts[1:], " ")
+
+		switch parts[0] {
+		case "hostname":
+			cfg.Hostname = value
+		case "user":
+			cfg.User = value
+		case "port":
+			cfg.Port, _ = strconv.Atoi(value)
+		case "controlpath":
+			if value != "none" {
+				cfg.ControlPath = value
+			}
+		case "localforward":
+			if fwd, ok := parseConfiguredForward(parts[1:]); ok {
+				cfg.LocalForwards = append(cfg.LocalForwards, fwd)
+			}
+		case "proxyjump":
+			if value == "none" {
+				continue
+			}
+			for _, hop := range strings.Split(value, ",") {
+				if host := jumpHostname(hop); host != "" {
+					cfg.ProxyJump = append(cfg.ProxyJump, host)
+				}
+			}
+		}
+	}
+
+	return cfg
+}
+
+// parseConfiguredForward parses the arguments of a `localforward` line as
+// printed by `ssh -G`: "8080 [localhost]:3000" or "[127.0.0.1]:8080
+// [db.internal]:5432"
+func parseConfiguredForward(args []string) (configuredForward, bool) {
+	if len(args) != 2 {
+		return configuredForward{}, false
+	}
+
+	listen := args[0]
+	if _, port, err := net.SplitHostPort(listen); err == nil {
+		listen = port
+	}
+	localPort, err := strconv.Atoi(listen)
+	if err != nil {
+		return configuredForward{}, false
+	}
+
+	host, port, err := net.SplitHostPort(args[1])
+	if err != nil {
+		return configuredForward{}, false
+	}
+	remotePort, err := strconv.Atoi(port)
+	if err != nil {
+		return configuredForward{}, false
+	}
+
+	return configuredForward{LocalPort: localPort, RemoteHost: host, RemotePort: remotePort}, true
+}
+
+// jumpHostname extracts the host from a ProxyJump hop or -W target such as
+// "user@bastion:2222", "[fe80::1]:22", or "ssh://user@bastion"
+func jumpHostname(hop string) string {
+	hop = strings.TrimSpace(hop)
+	hop = strings.TrimPrefix(hop, "ssh://")
+	if at := strings.LastIndex(hop, "@"); at >= 0 {
+		hop = hop[at+1:]
+	}
+
+	if strings.HasPrefix(hop, "[") {
+		if end := strings.Index(hop, "]"); end > 0 {
+			return hop[1:end]
+		}
+	}
+	if colon := strings.LastIndex(hop, ":"); colon >= 0 && strings.Count(hop, ":") == 1 {
+		hop = hop[:colon]
+	}
+	return hop
+}
+
+// hostMatches reports whether an ssh destination refers to the host named by
+// connectionInfo. Remote sessions identify themselves by their short
+// hostname, so "devbox" matches "devbox.internal.example.com".
+func hostMatches(destination, connectionInfo string) bool {
+	destination = strings.ToLower(destination)
+	connectionInfo = strings.ToLower(connectionInfo)
+	if destination == "" || connectionInfo == "" {
+		return false
+	}
+	if destination == connectionInfo {
+		return true
+	}
+	short := func(h string) string {
+		if dot := strings.Index(h, "."); dot > 0 {
+			return h[:dot]
+		}
+		return h
+	}
+	return short(destination) == short(connectionInfo)
+}
+
+// jumpedMaster is an SSH control master whose connection goes through one or
+// more jump hosts
+type jumpedMaster struct {
+	PID         int
+	SocketPath  string
+	Destination string // Final host, from the master's `ssh -W` child
+	JumpHost    string // Last hop the child connects through
+}
+
+// findJumpedMasters lists control masters that reach their destination via
+// ProxyJump. The master rewrites its own command line to "ssh: <socket>
+// [mux]", so the destination is recovered from the `ssh -W host:port jump`
+// helper it spawns for the jump.
+func findJumpedMasters() ([]jumpedMaster, error) {
+	processes, err := listProcesses()
+	if err != nil {
+		return nil, err
+	}
+	return parseJumpedMasters(processes), nil
+}
+
+// parseJumpedMasters pairs control masters in a process list with the jump
+// helpers they spawned
+func parseJumpedMasters(processes []processInfo) []jumpedMaster {
+	type jumpChild struct {
+		destination string
+		jumpHost    string
+	}
+	sockets := make(map[int]string)
+	children := make(map[int]jumpChild) // key: parent PID
+
+	for _, proc := range processes {
+		args := proc.Args
+		if len(args) == 0 {
+			continue
+		}
+
+		// Control master: "ssh: /path/to/socket [mux]"
+		if socket, ok := muxSocket(args); ok {
+			sockets[proc.PID] = socket
+			continue
+		}
+
+		// Jump helper: "ssh [opts] -W [host]:port jumphost"
+		if args[0] != "ssh" && !strings.HasSuffix(args[0], "/ssh") {
+			continue
+		}
+		var target string
+		for i := 1; i < len(args)-1; i++ {
+			if args[i] == "-W" {
+				target = args[i+1]
+				break
+			}
+		}
+		if target == "" {
+			continue
+		}
+		children[proc.PPID] = jumpChild{
+			destination: jumpHostname(target),
+			jumpHost:    jumpHostname(args[len(args)-1]),
+		}
+	}
+
+	var masters []jumpedMaster
+	for pid, socket := range sockets {
+		child, ok := children[pid]
+		if !ok {
+			continue
+		}
+		masters = append(masters, jumpedMaster{
+			PID:         pid,
+			SocketPath:  socket,
+			Destination: child.destination,
+			JumpHost:    child.jumpHost,
+		})
+	}
+	return masters
+}
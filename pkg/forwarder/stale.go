@@ -0,0 +1,54 @@
+package forwarder
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// OrphanedForwards returns the forwards discovery finds on this machine's
+// control masters that were added at runtime, as bankshot adds them, and
+// that tracked doesn't claim. With no daemon left to claim them, as after a
+// crash, that's every one of them. sshCmd is run to learn where they lead.
+func OrphanedForwards(logger *slog.Logger, sshCmd string, tracked func(SSHForward) bool) ([]SSHForward, error) {
+	forwards, err := DiscoverActiveForwards(logger, sshCmd)
+	if err != nil {
+		return nil, err
+	}
+	return orphanedForwards(forwards, tracked), nil
+}
+
+// orphanedForwards picks the runtime forwards tracked doesn't claim out of
+// those discovered
+func orphanedForwards(forwards []SSHForward, tracked func(SSHForward) bool) []SSHForward {
+	var orphaned []SSHForward
+	for _, fwd := range forwards {
+		if fwd.Configured || tracked(fwd) {
+			continue
+		}
+		orphaned = append(orphaned, fwd)
+	}
+	return orphaned
+}
+
+// CancelDiscovered cancels a discovered forward on its control master with
+// sshCmd, then re-applies the forwards ssh_config declares for the host,
+// which OpenSSH drops along with it
+func CancelDiscovered(sshCmd string, discovered SSHForward) error {
+	backend := NewOpenSSHBackend(sshCmd)
+	fwd := &Forward{
+		SocketPath:     discovered.SocketPath,
+		ConnectionInfo: discovered.ConnectionInfo,
+		RemotePort:     discovered.RemotePort,
+		LocalPort:      discovered.LocalPort,
+		Host:           discovered.RemoteHost,
+	}
+
+	if output, err := backend.CancelCommand(fwd).CombinedOutput(); err != nil {
+		return fmt.Errorf("ssh -O cancel failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	if output, err := backend.RestoreCommand(fwd.SocketPath, fwd.ConnectionInfo).CombinedOutput(); err != nil {
+		return fmt.Errorf("cancelled, but restoring ssh_config forwards failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package forwarder
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackendTeleport names the backend that forwards through Teleport's tsh
+const BackendTeleport = "tsh"
+
+// teleportHandlePrefix starts the handles TeleportBackend resolves, which
+// name a node rather than a socket file
+const teleportHandlePrefix = "tsh:"
+
+// teleportReadyTimeout bounds how long `tsh ssh` may take to log in to the
+// node and start listening
+const teleportReadyTimeout = 15 * time.Second
+
+// TeleportBackend forwards through Teleport with `tsh ssh -N -L`, for hosts
+// only reachable through a Teleport proxy. tsh has no control master to add
+// forwards to, so each forward runs its own tsh process. connectionInfo is
+// the node, as passed to `tsh ssh` (e.g. "user@node" or "node"), and its
+// handle is "tsh:[proxy/]node": the tsh login is shared by every node, so
+// there's no socket to point at.
+type TeleportBackend struct {
+	tshCmd string
+	proxy  string
+}
+
+// NewTeleportBackend creates a backend that runs tshCmd ("" = "tsh"),
+// logging in through proxy when set instead of the current tsh profile's
+func NewTeleportBackend(tshCmd, proxy string) *TeleportBackend {
+	if tshCmd == "" {
+		tshCmd = "tsh"
+	}
+	return &TeleportBackend{tshCmd: tshCmd, proxy: proxy}
+}
+
+// Name implements Backend
+func (b *TeleportBackend) Name() string {
+	return BackendTeleport
+}
+
+// Resolve implements Backend by checking there is a valid tsh login, and
+// returns the node's handle
+func (b *TeleportBackend) Resolve(connectionInfo string) (string, error) {
+	if output, err := b.CheckCommand("", connectionInfo).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("no active Teleport login for %s: %w (output: %s)",
+			connectionInfo, err, strings.TrimSpace(string(output)))
+	}
+	return b.handle(connectionInfo), nil
+}
+
+// handle names the node connectionInfo, through the configured proxy
+func (b *TeleportBackend) handle(connectionInfo string) string {
+	if b.proxy != "" {
+		return teleportHandlePrefix + b.proxy + "/" + connectionInfo
+	}
+	return teleportHandlePrefix + connectionInfo
+}
+
+// ForwardCommand implements Backend. The command runs for as long as the
+// forward exists.
+func (b *TeleportBackend) ForwardCommand(fwd *Forward) *exec.Cmd {
+	return b.command("ssh", "-N", "-L", fwd.forwardSpec(fwd.BindAddress), fwd.ConnectionInfo)
+}
+
+// CancelCommand implements Backend with a kill of the forward's tsh
+// process, which is what the forwarder does itself to cancel it. It's nil
+// when fwd has no process left to stop.
+func (b *TeleportBackend) CancelCommand(fwd *Forward) *exec.Cmd {
+	if fwd.proc == nil {
+		return nil
+	}
+	pid := strconv.Itoa(fwd.proc.pid())
+	if runtime.GOOS == "windows" {
+		return exec.Command("taskkill", "/F", "/PID", pid)
+	}
+	return exec.Command("kill", "-KILL", pid)
+}
+
+// RestoreCommand implements Backend. Cancelling a forward leaves the others
+// running, so there is nothing to restore.
+func (b *TeleportBackend) RestoreCommand(string, string) *exec.Cmd {
+	return nil
+}
+
+// CheckCommand implements Backend with `tsh status`, which fails once the
+// login has expired
+func (b *TeleportBackend) CheckCommand(string, string) *exec.Cmd {
+	return b.command("status")
+}
+
+// ReadCommand implements Backend by running cat on the node
+func (b *TeleportBackend) ReadCommand(_, connectionInfo, remotePath string) *exec.Cmd {
+	return b.command("ssh", connectionInfo, remoteReadCommand(remotePath))
+}
+
+// ReadyTimeout implements ProcessBackend
+func (b *TeleportBackend) ReadyTimeout() time.Duration {
+	return teleportReadyTimeout
+}
+
+// forwardFromArgs implements processAdopter for the `tsh ssh -N -L`
+// processes ForwardCommand starts, through the configured proxy
+func (b *TeleportBackend) forwardFromArgs(args []string) (Forward, bool) {
+	prefix := b.command("ssh", "-N", "-L").Args
+	if len(args) != len(prefix)+2 || filepath.Base(args[0]) != filepath.Base(prefix[0]) {
+		return Forward{}, false
+	}
+	for i := 1; i < len(prefix); i++ {
+		if args[i] != prefix[i] {
+			return Forward{}, false
+		}
+	}
+
+	fwd, ok := parseLocalForwardSpec(args[len(prefix)])
+	if !ok {
+		return Forward{}, false
+	}
+	fwd.ConnectionInfo = args[len(prefix)+1]
+	fwd.SocketPath = b.handle(fwd.ConnectionInfo)
+	return fwd, true
+}
+
+// parseLocalForwardSpec parses the -L spec forwardSpec builds:
+// "[bind:]port:host:hostport", with IPv6 addresses in brackets, or
+// "localsocket:remotesocket"
+func parseLocalForwardSpec(spec string) (Forward, bool) {
+	if strings.HasPrefix(spec, "/") {
+		local, remote, ok := strings.Cut(spec, ":")
+		if !ok || !strings.HasPrefix(remote, "/") {
+			return Forward{}, false
+		}
+		return Forward{LocalSocket: local, RemoteSocket: remote}, true
+	}
+
+	// The remote end comes last, as net.JoinHostPort writes it
+	colon := strings.LastIndex(spec, ":")
+	if colon <= 0 {
+		return Forward{}, false
+	}
+	var hostStart int
+	if spec[colon-1] == ']' {
+		hostStart = strings.LastIndex(spec[:colon], "[")
+	} else {
+		hostStart = strings.LastIndex(spec[:colon], ":") + 1
+	}
+	if hostStart <= 0 || spec[hostStart-1] != ':' {
+		return Forward{}, false
+	}
+	host, port, err := net.SplitHostPort(spec[hostStart:])
+	if err != nil {
+		return Forward{}, false
+	}
+	remotePort, err := strconv.Atoi(port)
+	if err != nil {
+		return Forward{}, false
+	}
+
+	listen, bind := spec[:hostStart-1], ""
+	if h, p, err := net.SplitHostPort(listen); err == nil {
+		bind, listen = h, p
+	}
+	localPort, err := strconv.Atoi(listen)
+	if err != nil {
+		return Forward{}, false
+	}
+	return Forward{BindAddress: bind, LocalPort: localPort, Host: host, RemotePort: remotePort}, true
+}
+
+// command builds a tsh command, pointing it at the configured proxy
+func (b *TeleportBackend) command(args ...string) *exec.Cmd {
+	if b.proxy != "" {
+		args = append([]string{"--proxy=" + b.proxy}, args...)
+	}
+	return exec.Command(b.tshCmd, args...)
+}
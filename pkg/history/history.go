@@ -0,0 +1,198 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry records a single open request and where it came from
+type Entry struct {
+	URL            string    `json:"url"`
+	ConnectionInfo string    `json:"connection_info,omitempty"` // SSH connection the request arrived over
+	ProcessName    string    `json:"process_name,omitempty"`    // Process on the remote host that asked for the open
+	ProcessCwd     string    `json:"process_cwd,omitempty"`     // Working directory of that process
+	OpenedAt       time.Time `json:"opened_at"`
+	Denied         bool      `json:"denied,omitempty"` // True when the request was rejected by policy
+	Reason         string    `json:"reason,omitempty"` // Why the request was denied
+}
+
+// History keeps a bounded log of open requests and tracks per-connection
+// request rates for quota enforcement.
+type History struct {
+	maxEntries int
+	entries    []Entry
+	opens      map[string][]time.Time // key: connectionInfo, allowed opens only
+	mu         sync.Mutex
+	saveMu     sync.Mutex // Keeps Saves from writing the file at once
+}
+
+// New creates a History that retains at most maxEntries entries
+func New(maxEntries int) *History {
+	return &History{
+		maxEntries: maxEntries,
+		opens:      make(map[string][]time.Time),
+	}
+}
+
+// Record appends an entry to the log, evicting the oldest entry when full.
+// It doesn't count against the connection's quota; Admit does that.
+func (h *History) Record(e Entry) {
+	if e.OpenedAt.IsZero() {
+		e.OpenedAt = time.Now()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.recordLocked(e)
+}
+
+// recordLocked appends e to the log. Must be called with h.mu held.
+func (h *History) recordLocked(e Entry) {
+	h.entries = append(h.entries, e)
+	if h.maxEntries > 0 && len(h.entries) > h.maxEntries {
+		h.entries = h.entries[len(h.entries)-h.maxEntries:]
+	}
+}
+
+// Admit counts an open by connectionInfo at at against its quota of limit
+// opens in the hour before, unless that's used up (limit 0 = unlimited).
+// It returns how many opens the connection had made in that hour, and a
+// withdraw func that uncounts the open for when it doesn't go ahead after
+// all. Checking and counting at once keeps concurrent requests from all
+// passing the check for the quota's last open.
+func (h *History) Admit(connectionInfo string, at time.Time, limit int) (count int, withdraw func(), ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.pruneLocked(connectionInfo, at.Add(-time.Hour))
+	count = len(h.opens[connectionInfo])
+	if limit > 0 && count >= limit {
+		return count, nil, false
+	}
+	h.opens[connectionInfo] = insertTime(h.opens[connectionInfo], at)
+
+	var once sync.Once
+	return count, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			times := h.opens[connectionInfo]
+			for i := len(times) - 1; i >= 0; i-- {
+				if times[i].Equal(at) {
+					h.opens[connectionInfo] = append(times[:i:i], times[i+1:]...)
+					return
+				}
+			}
+		})
+	}, true
+}
+
+// insertTime adds t to times, which are in order, keeping them in order
+func insertTime(times []time.Time, t time.Time) []time.Time {
+	i := len(times)
+	for i > 0 && times[i-1].After(t) {
+		i--
+	}
+	return append(times[:i:i], append([]time.Time{t}, times[i:]...)...)
+}
+
+// Entries returns a copy of the recorded entries, oldest first
+func (h *History) Entries() []Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := make([]Entry, len(h.entries))
+	copy(entries, h.entries)
+	return entries
+}
+
+// CountSince returns how many allowed opens a connection made at or after since.
+// Timestamps older than since are discarded, so callers should use a fixed window.
+func (h *History) CountSince(connectionInfo string, since time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.pruneLocked(connectionInfo, since)
+	return len(h.opens[connectionInfo])
+}
+
+// CountsSince returns allowed open counts at or after since, keyed by connection
+func (h *History) CountsSince(since time.Time) map[string]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts := make(map[string]int, len(h.opens))
+	for conn := range h.opens {
+		h.pruneLocked(conn, since)
+		if n := len(h.opens[conn]); n > 0 {
+			counts[conn] = n
+		}
+	}
+	return counts
+}
+
+// pruneLocked drops timestamps older than since. Must be called with h.mu held.
+func (h *History) pruneLocked(connectionInfo string, since time.Time) {
+	times := h.opens[connectionInfo]
+	i := 0
+	for i < len(times) && times[i].Before(since) {
+		i++
+	}
+	if i == len(times) {
+		delete(h.opens, connectionInfo)
+		return
+	}
+	h.opens[connectionInfo] = times[i:]
+}
+
+// Save writes the entries to the file at path, replacing it so a crash
+// mid-write leaves the previous file rather than a truncated one. The file
+// is only readable by its owner, as the URLs may carry tokens.
+func (h *History) Save(path string) error {
+	h.saveMu.Lock()
+	defer h.saveMu.Unlock()
+
+	data, err := json.MarshalIndent(h.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load records the entries Save wrote to the file at path, if there is one,
+// as though they had just been recorded and admitted in order, quota counts
+// included
+func (h *History) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("invalid history file %s: %w", path, err)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range entries {
+		h.recordLocked(e)
+		if !e.Denied {
+			h.opens[e.ConnectionInfo] = insertTime(h.opens[e.ConnectionInfo], e.OpenedAt)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordEvictsOldest(t *testing.T) {
+	h := New(2)
+
+	h.Record(Entry{URL: "https://one.example"})
+	h.Record(Entry{URL: "https://two.example"})
+	h.Record(Entry{URL: "https://three.example"})
+
+	entries := h.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("Entries() length = %v, want %v", len(entries), 2)
+	}
+	if entries[0].URL != "https://two.example" {
+		t.Errorf("Entries()[0].URL = %v, want %v", entries[0].URL, "https://two.example")
+	}
+	if entries[1].OpenedAt.IsZero() {
+		t.Error("Record() should default OpenedAt to now")
+	}
+}
+
+func TestCountSince(t *testing.T) {
+	h := New(100)
+	now := time.Now()
+
+	h.Admit("vm1", now.Add(-2*time.Hour), 0)
+	h.Admit("vm1", now, 0)
+	h.Admit("vm1", now.Add(-10*time.Minute), 0)
+	h.Admit("vm2", now, 0)
+	// Recording alone doesn't count
+	h.Record(Entry{URL: "https://d.example", ConnectionInfo: "vm1", OpenedAt: now})
+
+	since := now.Add(-time.Hour)
+	if got := h.CountSince("vm1", since); got != 2 {
+		t.Errorf("CountSince(vm1) = %v, want %v", got, 2)
+	}
+	if got := h.CountSince("vm3", since); got != 0 {
+		t.Errorf("CountSince(vm3) = %v, want %v", got, 0)
+	}
+
+	counts := h.CountsSince(since)
+	if counts["vm1"] != 2 || counts["vm2"] != 1 {
+		t.Errorf("CountsSince() = %v, want vm1=2 vm2=1", counts)
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	h := New(100)
+	now := time.Now()
+
+	// Concurrent requests can't all take the quota's last open
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var withdraws []func()
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, withdraw, ok := h.Admit("vm1", now, 3); ok {
+				mu.Lock()
+				withdraws = append(withdraws, withdraw)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(withdraws) != 3 {
+		t.Fatalf("Admit() let %d of 20 opens through, want the quota's 3", len(withdraws))
+	}
+
+	count, _, ok := h.Admit("vm1", now, 3)
+	if ok || count != 3 {
+		t.Errorf("Admit() = %d, %v over the quota, want 3, false", count, ok)
+	}
+
+	// An open that didn't go ahead frees its place, once
+	withdraws[0]()
+	withdraws[0]()
+	if got := h.CountSince("vm1", now.Add(-time.Hour)); got != 2 {
+		t.Errorf("CountSince() after a withdraw = %d, want 2", got)
+	}
+	if _, _, ok := h.Admit("vm1", now, 3); !ok {
+		t.Error("Admit() after a withdraw was refused")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "history.json")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	h := New(100)
+	if err := h.Load(path); err != nil {
+		t.Fatalf("Load() of a missing file error = %v", err)
+	}
+	h.Record(Entry{URL: "https://a.example", ConnectionInfo: "vm1", OpenedAt: now.Add(-time.Minute)})
+	h.Record(Entry{URL: "https://b.example", ConnectionInfo: "vm1", OpenedAt: now, Denied: true, Reason: "quota"})
+	if err := h.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Save() file = %v, %v, want mode 0600", info, err)
+	}
+
+	restored := New(100)
+	if err := restored.Load(path); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got, want := restored.Entries(), h.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() entries = %+v, want %+v", got, want)
+	}
+	if got := restored.CountSince("vm1", now.Add(-time.Hour)); got != 1 {
+		t.Errorf("CountSince(vm1) after Load() = %v, want 1", got)
+	}
+}
@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// keptCapabilities are the ones the eBPF monitor still uses once its
+// programs are attached, to look up the processes of other users under /proc.
+// Everything else goes, including CAP_SYS_ADMIN: it grants all CAP_BPF and
+// CAP_PERFMON do, and is what root and kernels before 5.8 load programs with.
+var keptCapabilities = []uint{unix.CAP_DAC_READ_SEARCH, unix.CAP_SYS_PTRACE}
+
+// ebpfCapabilities are those that load and attach eBPF programs, which
+// dropEBPFCapabilities checks are gone
+var ebpfCapabilities = []uint{unix.CAP_BPF, unix.CAP_PERFMON, unix.CAP_SYS_ADMIN}
+
+// dropEBPFCapabilities removes all but keptCapabilities from the process's
+// effective, permitted, and inheritable sets, and sets no_new_privs so
+// neither it nor anything it runs can regain them through a setuid or
+// file-capability binary. Both are per-thread, so they're applied to every
+// thread of the runtime, which binaries built with cgo can't do.
+func dropEBPFCapabilities() error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("capget: %w", err)
+	}
+	keepCapabilities(&data, keptCapabilities)
+
+	_, _, errno := syscall.AllThreadsSyscall(unix.SYS_CAPSET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if errno == syscall.ENOTSUP {
+		return fmt.Errorf("capset: not possible in binaries built with cgo")
+	}
+	if errno != 0 {
+		return fmt.Errorf("capset: %w", errno)
+	}
+	if _, _, errno := syscall.AllThreadsSyscall(unix.SYS_PRCTL, unix.PR_SET_NO_NEW_PRIVS, 1, 0); errno != 0 {
+		return fmt.Errorf("set no_new_privs: %w", errno)
+	}
+	for _, c := range ebpfCapabilities {
+		if hasCapability(c) {
+			return fmt.Errorf("capability %d still effective after capset", c)
+		}
+	}
+	return nil
+}
+
+// keepCapabilities clears every capability but keep from data's effective,
+// permitted, and inheritable sets
+func keepCapabilities(data *[2]unix.CapUserData, keep []uint) {
+	var mask [2]uint32
+	for _, c := range keep {
+		mask[c/32] |= 1 << (c % 32)
+	}
+	for i := range data {
+		data[i].Effective &= mask[i]
+		data[i].Permitted &= mask[i]
+		data[i].Inheritable &= mask[i]
+	}
+}
+
+// hasCapability reports whether c is in the process's effective set
+func hasCapability(c uint) bool {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return false
+	}
+	return data[c/32].Effective&(1<<(c%32)) != 0
+}
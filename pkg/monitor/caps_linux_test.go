@@ -0,0 +1,32 @@
+package monitor
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestKeepCapabilities(t *testing.T) {
+	all := unix.CapUserData{Effective: ^uint32(0), Permitted: ^uint32(0), Inheritable: ^uint32(0)}
+	data := [2]unix.CapUserData{all, all}
+	keepCapabilities(&data, keptCapabilities)
+
+	has := func(c uint) bool {
+		bit := uint32(1) << (c % 32)
+		d := data[c/32]
+		return d.Effective&bit != 0 || d.Permitted&bit != 0 || d.Inheritable&bit != 0
+	}
+	for _, c := range ebpfCapabilities {
+		if has(c) {
+			t.Errorf("capability %d kept, want it dropped", c)
+		}
+	}
+	for _, c := range keptCapabilities {
+		if !has(c) {
+			t.Errorf("capability %d dropped, want it kept", c)
+		}
+	}
+	if has(unix.CAP_NET_ADMIN) {
+		t.Error("CAP_NET_ADMIN kept, want everything else dropped")
+	}
+}
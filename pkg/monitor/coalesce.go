@@ -0,0 +1,80 @@
+package monitor
+
+import "time"
+
+// settlingPort is the latest event of a port that changed state again within
+// the settle time of its previous change
+type settlingPort struct {
+	event    PortEvent
+	changed  time.Time // when the port last changed state
+	coalesce int       // events folded into this one, for logging
+}
+
+// settleTick returns how often settling ports are checked: often enough that
+// a port's final state isn't applied much later than the settle time
+func settleTick(settleTime time.Duration) time.Duration {
+	tick := settleTime / 4
+	if tick < 50*time.Millisecond {
+		tick = 50 * time.Millisecond
+	}
+	return tick
+}
+
+// coalesce holds back the event of a port that's flapping, reporting whether
+// it did. The first change after a quiet period is applied right away, so a
+// port that opens once is forwarded without delay; changes following it
+// within the settle time replace each other until the port settles.
+func (m *SessionMonitor) coalesce(key string, event PortEvent) bool {
+	if m.settleTime <= 0 {
+		return false
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	last, seen := m.lastChange[key]
+	m.lastChange[key] = now
+
+	if sp, ok := m.settling[key]; ok {
+		m.settling[key] = settlingPort{event: event, changed: now, coalesce: sp.coalesce + 1}
+		return true
+	}
+	if seen && now.Sub(last) < m.settleTime {
+		m.logger.Info("Port is flapping, waiting for it to settle",
+			"port", event.Port,
+			"settleTime", m.settleTime)
+		m.settling[key] = settlingPort{event: event, changed: now, coalesce: 1}
+		return true
+	}
+	return false
+}
+
+// flushSettled applies the final state of each port that's been quiet for
+// the settle time, and forgets ports that haven't changed recently
+func (m *SessionMonitor) flushSettled() {
+	now := time.Now()
+
+	m.mutex.Lock()
+	settled := make(map[string]settlingPort)
+	for key, sp := range m.settling {
+		if now.Sub(sp.changed) >= m.settleTime {
+			settled[key] = sp
+			delete(m.settling, key)
+		}
+	}
+	for key, changed := range m.lastChange {
+		if _, ok := m.settling[key]; !ok && now.Sub(changed) >= m.settleTime {
+			delete(m.lastChange, key)
+		}
+	}
+	m.mutex.Unlock()
+
+	for key, sp := range settled {
+		m.logger.Info("Port settled",
+			"port", sp.event.Port,
+			"state", sp.event.Type,
+			"coalescedEvents", sp.coalesce)
+		m.applyPortEvent(key, sp.event)
+	}
+}
@@ -0,0 +1,111 @@
+package monitor
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// settleAll backdates every settling port past the settle time and flushes
+func settleAll(sm *SessionMonitor) {
+	sm.mutex.Lock()
+	for key, sp := range sm.settling {
+		sp.changed = sp.changed.Add(-2 * sm.settleTime)
+		sm.settling[key] = sp
+	}
+	for key, changed := range sm.lastChange {
+		sm.lastChange[key] = changed.Add(-2 * sm.settleTime)
+	}
+	sm.mutex.Unlock()
+	sm.flushSettled()
+}
+
+func newCoalescingMonitor(client DaemonClient) *SessionMonitor {
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "test",
+		DaemonClient:    client,
+		Logger:          slog.Default(),
+		GracePeriod:     30 * time.Second,
+		SettleTime:      time.Hour,
+		PortEventSource: &mockPortEventSource{},
+	})
+	sm.resolveProcessName = func(pid int) string { return "" }
+	sm.resolveProcessCwd = func(pid int) string { return "" }
+	sm.resolveParentPID = func(pid int) int { return 0 }
+	return sm
+}
+
+func TestCoalesceFlappingPort(t *testing.T) {
+	client := &mockDaemonClient{}
+	sm := newCoalescingMonitor(client)
+
+	opened := PortEvent{Type: PortOpened, Port: 47613, BindAddr: "127.0.0.1"}
+	closed := PortEvent{Type: PortClosed, Port: 47613, BindAddr: "127.0.0.1"}
+
+	// The first open is forwarded right away
+	sm.handlePortEvent(opened)
+	if client.forwardCount() != 1 {
+		t.Fatalf("forward count = %d, want 1", client.forwardCount())
+	}
+
+	// Restarts in quick succession are held back
+	for i := 0; i < 5; i++ {
+		sm.handlePortEvent(closed)
+		sm.handlePortEvent(opened)
+	}
+	sm.mutex.RLock()
+	_, pending := sm.pendingRemovals["47613"]
+	sm.mutex.RUnlock()
+	if pending {
+		t.Error("flapping port was scheduled for removal")
+	}
+
+	// Once settled open, the existing forward is kept without new requests
+	settleAll(sm)
+	if got := len(client.requests); got != 1 {
+		t.Errorf("daemon requests = %d, want 1", got)
+	}
+	if len(sm.settling) != 0 {
+		t.Errorf("settling ports = %d, want 0", len(sm.settling))
+	}
+}
+
+func TestCoalesceSettlesClosed(t *testing.T) {
+	client := &mockDaemonClient{}
+	sm := newCoalescingMonitor(client)
+
+	opened := PortEvent{Type: PortOpened, Port: 47614, BindAddr: "127.0.0.1"}
+	closed := PortEvent{Type: PortClosed, Port: 47614, BindAddr: "127.0.0.1"}
+
+	sm.handlePortEvent(opened)
+	sm.handlePortEvent(closed)
+	sm.handlePortEvent(opened)
+	sm.handlePortEvent(closed)
+
+	settleAll(sm)
+
+	sm.mutex.RLock()
+	_, pending := sm.pendingRemovals["47614"]
+	sm.mutex.RUnlock()
+	if !pending {
+		t.Error("port that settled closed was not scheduled for removal")
+	}
+}
+
+func TestCoalesceQuietPortNotDelayed(t *testing.T) {
+	client := &mockDaemonClient{}
+	sm := newCoalescingMonitor(client)
+
+	sm.handlePortEvent(PortEvent{Type: PortOpened, Port: 47615, BindAddr: "127.0.0.1"})
+	settleAll(sm)
+
+	// A change after a quiet period is applied right away
+	sm.handlePortEvent(PortEvent{Type: PortClosed, Port: 47615, BindAddr: "127.0.0.1"})
+
+	sm.mutex.RLock()
+	_, pending := sm.pendingRemovals["47615"]
+	sm.mutex.RUnlock()
+	if !pending {
+		t.Error("close after a quiet period was not applied")
+	}
+}
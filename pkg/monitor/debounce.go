@@ -0,0 +1,75 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// debouncer holds back port opens until the port has stayed open for a
+// while, for edge-triggered sources like eBPF that would otherwise report
+// ports open for only a moment, as the polling sources' debounce does
+type debouncer struct {
+	delay time.Duration
+	emit  func(PortEvent) // Called with mu held, so it must not block
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer // Opens held back, by port:protocol
+	stopped bool
+}
+
+// newDebouncer returns a debouncer passing events on to emit
+func newDebouncer(delay time.Duration, emit func(PortEvent)) *debouncer {
+	return &debouncer{
+		delay:   delay,
+		emit:    emit,
+		pending: make(map[string]*time.Timer),
+	}
+}
+
+// add passes on event, opens only once the delay has passed. A close
+// within the delay cancels the open, and neither is reported.
+func (d *debouncer) add(event PortEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+
+	key := fmt.Sprintf("%d:%s", event.Port, event.Protocol)
+	if event.Type != PortOpened {
+		if timer, ok := d.pending[key]; ok {
+			timer.Stop()
+			delete(d.pending, key)
+			return
+		}
+		d.emit(event)
+		return
+	}
+
+	if timer, ok := d.pending[key]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(d.delay, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.stopped || d.pending[key] != timer {
+			return
+		}
+		delete(d.pending, key)
+		d.emit(event)
+	})
+	d.pending[key] = timer
+}
+
+// stop drops the opens still held back. emit isn't called once it returns.
+func (d *debouncer) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+	for _, timer := range d.pending {
+		timer.Stop()
+	}
+	clear(d.pending)
+}
@@ -0,0 +1,59 @@
+package monitor
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDebouncer(t *testing.T) {
+	var mu sync.Mutex
+	var emitted []PortEvent
+	d := newDebouncer(50*time.Millisecond, func(event PortEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		emitted = append(emitted, event)
+	})
+	defer d.stop()
+	events := func() []PortEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]PortEvent(nil), emitted...)
+	}
+
+	// Open only for a moment
+	d.add(PortEvent{Type: PortOpened, Port: 3000, Protocol: "tcp"})
+	d.add(PortEvent{Type: PortClosed, Port: 3000, Protocol: "tcp"})
+	// Stays open
+	d.add(PortEvent{Type: PortOpened, Port: 8080, Protocol: "tcp"})
+	if got := events(); len(got) != 0 {
+		t.Fatalf("emitted %+v before the delay, want nothing", got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	got := events()
+	if len(got) != 1 || got[0].Port != 8080 || got[0].Type != PortOpened {
+		t.Fatalf("emitted %+v after the delay, want only 8080 opening", got)
+	}
+
+	d.add(PortEvent{Type: PortClosed, Port: 8080, Protocol: "tcp"})
+	if got := events(); len(got) != 2 || got[1].Type != PortClosed {
+		t.Errorf("emitted %+v, want 8080's close passed on right away", got)
+	}
+}
+
+func TestDebouncerStop(t *testing.T) {
+	emitted := make(chan PortEvent, 1)
+	d := newDebouncer(20*time.Millisecond, func(event PortEvent) {
+		emitted <- event
+	})
+	d.add(PortEvent{Type: PortOpened, Port: 3000, Protocol: "tcp"})
+	d.stop()
+	d.add(PortEvent{Type: PortClosed, Port: 5000, Protocol: "tcp"})
+
+	select {
+	case event := <-emitted:
+		t.Errorf("emitted %+v after stop", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
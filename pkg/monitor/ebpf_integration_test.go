@@ -26,7 +26,7 @@ func TestEBPFMonitorEvents(t *testing.T) {
 		Level: slog.LevelDebug,
 	}))
 
-	mon := newEBPFMonitor(logger)
+	mon := newEBPFMonitor(logger, DefaultEventBuffer)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
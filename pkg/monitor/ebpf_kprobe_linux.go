@@ -0,0 +1,280 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/features"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/perf"
+)
+
+// tcpClose is TCP_CLOSE, the state a listener comes from and goes back to
+const tcpClose = 7
+
+// kprobeArgOffsets is where the first function argument is saved in the
+// pt_regs a kprobe gets: di on amd64, regs[0] on arm64
+var kprobeArgOffsets = map[string]int16{
+	"amd64": 112,
+	"arm64": 0,
+}
+
+// sockOffsets are the offsets of the struct sock_common fields the kprobe
+// programs read. struct sock starts with its sock_common, so they're offsets
+// into the sock the kprobes are passed as well.
+type sockOffsets struct {
+	rcvSaddr   int16 // skc_rcv_saddr
+	num        int16 // skc_num, the local port in host byte order
+	family     int16 // skc_family
+	v6RcvSaddr int16 // skc_v6_rcv_saddr; only valid if hasV6
+	hasV6      bool
+}
+
+// fallbackSockOffsets is the layout of sock_common's leading fields, which
+// hasn't changed since long before eBPF. Where skc_v6_rcv_saddr lands
+// depends on the kernel's configuration, so it's left unknown.
+var fallbackSockOffsets = sockOffsets{rcvSaddr: 4, num: 14, family: 16}
+
+// kernelSockOffsets reads the sock_common field offsets from the running
+// kernel's BTF, the way a CO-RE loader relocates field accesses, and falls
+// back to the fixed layout on kernels without BTF
+func kernelSockOffsets() sockOffsets {
+	spec, err := btf.LoadKernelSpec()
+	if err != nil {
+		return fallbackSockOffsets
+	}
+	var common *btf.Struct
+	if err := spec.TypeByName("sock_common", &common); err != nil {
+		return fallbackSockOffsets
+	}
+	return sockOffsetsFromBTF(common)
+}
+
+// sockOffsetsFromBTF returns the offsets of the fields in a sock_common,
+// using the fixed layout for any that can't be found
+func sockOffsetsFromBTF(common *btf.Struct) sockOffsets {
+	offsets := fallbackSockOffsets
+	if off, ok := btfMemberOffset(common, "skc_rcv_saddr"); ok {
+		offsets.rcvSaddr = int16(off)
+	}
+	if off, ok := btfMemberOffset(common, "skc_num"); ok {
+		offsets.num = int16(off)
+	}
+	if off, ok := btfMemberOffset(common, "skc_family"); ok {
+		offsets.family = int16(off)
+	}
+	if off, ok := btfMemberOffset(common, "skc_v6_rcv_saddr"); ok {
+		offsets.v6RcvSaddr = int16(off)
+		offsets.hasV6 = true
+	}
+	return offsets
+}
+
+// btfMemberOffset returns the byte offset of a named member of a struct or
+// union, looking inside anonymous members, which sock_common uses for its
+// address and port pairs
+func btfMemberOffset(typ btf.Type, name string) (uint32, bool) {
+	var members []btf.Member
+	switch t := btf.UnderlyingType(typ).(type) {
+	case *btf.Struct:
+		members = t.Members
+	case *btf.Union:
+		members = t.Members
+	default:
+		return 0, false
+	}
+
+	for _, m := range members {
+		if m.Name == name {
+			return m.Offset.Bytes(), true
+		}
+		if m.Name == "" {
+			if off, ok := btfMemberOffset(m.Type, name); ok {
+				return m.Offset.Bytes() + off, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// listenKprobes are the kernel functions hooked when the inet_sock_set_state
+// tracepoint isn't there, and the state transition each one stands for
+var listenKprobes = []struct {
+	symbol   string
+	oldState int32
+	newState int32
+}{
+	{"inet_csk_listen_start", tcpClose, tcpListen},
+	{"inet_csk_listen_stop", tcpListen, tcpClose},
+}
+
+// attachKprobes loads and attaches kprobe programs on inet_csk_listen_start
+// and inet_csk_listen_stop, for kernels older than 4.16 that lack the
+// sock:inet_sock_set_state tracepoint. They emit the same port_event as the
+// tracepoint program, read from the sock with offsets from kernelSockOffsets.
+func attachKprobes() (*portProbe, error) {
+	argOffset, ok := kprobeArgOffsets[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("kprobes not supported on %s", runtime.GOARCH)
+	}
+	offsets := kernelSockOffsets()
+
+	// bpf_probe_read_kernel arrived in 5.5, and plain bpf_probe_read isn't
+	// available on every architecture since
+	readFn := asm.FnProbeReadKernel
+	if features.HaveProgramHelper(ebpf.Kprobe, asm.FnProbeReadKernel) != nil {
+		readFn = asm.FnProbeRead
+	}
+
+	events, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:      "events",
+		Type:      ebpf.PerfEventArray,
+		KeySize:   4,
+		ValueSize: 4,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create perf map: %w", err)
+	}
+
+	p := &portProbe{
+		events:    events,
+		kind:      "kprobe",
+		v6Unknown: !offsets.hasV6,
+		closers:   []io.Closer{events},
+	}
+	for _, hook := range listenKprobes {
+		prog, err := ebpf.NewProgram(listenKprobeSpec(events.FD(), argOffset, offsets, readFn, hook.oldState, hook.newState))
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("load %s program: %w", hook.symbol, err)
+		}
+		p.closers = append(p.closers, prog)
+
+		kp, err := link.Kprobe(hook.symbol, prog, nil)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("attach kprobe %s: %w", hook.symbol, err)
+		}
+		p.closers = append(p.closers, kp)
+	}
+
+	if err := verifyKprobes(p); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// kprobeVerifyTimeout is how long verifyKprobes waits for its listener's event
+const kprobeVerifyTimeout = time.Second
+
+// verifyKprobes opens a listener and waits for the kprobes to report it.
+// Attaching succeeds even where the hooked function is inlined or the sock
+// offsets are wrong, and then no events, or events for the wrong port, come.
+func verifyKprobes(p *portProbe) error {
+	reader, err := perf.NewReader(p.events, os.Getpagesize())
+	if err != nil {
+		return fmt.Errorf("create perf reader: %w", err)
+	}
+	defer reader.Close()
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("open test listener: %w", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+
+	reader.SetDeadline(time.Now().Add(kprobeVerifyTimeout))
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("kprobes attached but didn't report a test listener on port %d", port)
+		}
+		if err != nil {
+			return fmt.Errorf("read perf events: %w", err)
+		}
+		pe, ok := decodePortEvent(record.RawSample)
+		if ok && pe.Type == PortOpened && pe.Port == port && pe.PID == os.Getpid() {
+			return nil
+		}
+	}
+}
+
+// listenKprobeSpec assembles a kprobe program that emits a port_event for
+// the sock in its first argument. The state transition is fixed by the
+// function it's attached to. A listen() without a bind() only gets its port
+// inside inet_csk_listen_start, so events with no port yet are dropped.
+func listenKprobeSpec(eventsFD int, argOffset int16, offsets sockOffsets, readFn asm.BuiltinFunc, oldState, newState int32) *ebpf.ProgramSpec {
+	// The port_event is built on the stack, rounded up to a whole number of
+	// dwords so it can be zeroed with them
+	const evt = -40
+
+	// read copies size bytes at sk+src into the event at dst
+	read := func(dst int16, size int32, src int16) asm.Instructions {
+		return asm.Instructions{
+			asm.Mov.Reg(asm.R1, asm.RFP),
+			asm.Add.Imm(asm.R1, int32(evt+dst)),
+			asm.Mov.Imm(asm.R2, size),
+			asm.Mov.Reg(asm.R3, asm.R7),
+			asm.Add.Imm(asm.R3, int32(src)),
+			readFn.Call(),
+		}
+	}
+
+	insns := asm.Instructions{
+		// r6 = ctx, r7 = sk
+		asm.Mov.Reg(asm.R6, asm.R1),
+		asm.LoadMem(asm.R7, asm.R6, argOffset, asm.DWord),
+
+		asm.Mov.Imm(asm.R0, 0),
+		asm.StoreMem(asm.RFP, evt, asm.R0, asm.DWord),
+		asm.StoreMem(asm.RFP, evt+8, asm.R0, asm.DWord),
+		asm.StoreMem(asm.RFP, evt+16, asm.R0, asm.DWord),
+		asm.StoreMem(asm.RFP, evt+24, asm.R0, asm.DWord),
+		asm.StoreMem(asm.RFP, evt+32, asm.R0, asm.DWord),
+
+		asm.FnGetCurrentPidTgid.Call(),
+		asm.RSh.Imm(asm.R0, 32),
+		asm.StoreMem(asm.RFP, evt, asm.R0, asm.Word),
+		asm.StoreImm(asm.RFP, evt+8, int64(oldState), asm.Word),
+		asm.StoreImm(asm.RFP, evt+12, int64(newState), asm.Word),
+	}
+	insns = append(insns, read(4, 2, offsets.num)...)
+	insns = append(insns, read(6, 2, offsets.family)...)
+	insns = append(insns, read(16, 4, offsets.rcvSaddr)...)
+	if offsets.hasV6 {
+		insns = append(insns, read(20, 16, offsets.v6RcvSaddr)...)
+	}
+	insns = append(insns,
+		asm.LoadMem(asm.R0, asm.RFP, evt+4, asm.Half),
+		asm.JEq.Imm(asm.R0, 0, "exit"),
+
+		// perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &evt, sizeof(evt))
+		asm.Mov.Reg(asm.R1, asm.R6),
+		asm.LoadMapPtr(asm.R2, eventsFD),
+		asm.LoadImm(asm.R3, 0xffffffff, asm.DWord),
+		asm.Mov.Reg(asm.R4, asm.RFP),
+		asm.Add.Imm(asm.R4, evt),
+		asm.Mov.Imm(asm.R5, portEventLen),
+		asm.FnPerfEventOutput.Call(),
+
+		asm.Mov.Imm(asm.R0, 0).WithSymbol("exit"),
+		asm.Return(),
+	)
+
+	return &ebpf.ProgramSpec{
+		Name:         "listen_kprobe",
+		Type:         ebpf.Kprobe,
+		Instructions: insns,
+		License:      "Dual MIT/GPL",
+	}
+}
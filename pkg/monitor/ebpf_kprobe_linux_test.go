@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/rlimit"
+)
+
+func TestSockOffsetsFromBTF(t *testing.T) {
+	u16 := &btf.Int{Name: "__u16", Size: 2}
+	u32 := &btf.Int{Name: "__u32", Size: 4}
+	in6 := &btf.Struct{Name: "in6_addr", Size: 16}
+
+	// A sock_common shaped like the kernel's, with the fields the kprobes
+	// read nested in anonymous unions and structs
+	common := &btf.Struct{
+		Name: "sock_common",
+		Size: 72,
+		Members: []btf.Member{
+			{Type: &btf.Union{Size: 8, Members: []btf.Member{
+				{Name: "skc_addrpair", Type: &btf.Int{Name: "__u64", Size: 8}},
+				{Type: &btf.Struct{Size: 8, Members: []btf.Member{
+					{Name: "skc_daddr", Type: u32},
+					{Name: "skc_rcv_saddr", Type: u32, Offset: 32},
+				}}},
+			}}},
+			{Name: "skc_hash", Type: u32, Offset: 64},
+			{Type: &btf.Union{Size: 4, Members: []btf.Member{
+				{Name: "skc_portpair", Type: u32},
+				{Type: &btf.Struct{Size: 4, Members: []btf.Member{
+					{Name: "skc_dport", Type: u16},
+					{Name: "skc_num", Type: u16, Offset: 16},
+				}}},
+			}}, Offset: 96},
+			{Name: "skc_family", Type: u16, Offset: 128},
+			{Name: "skc_v6_rcv_saddr", Type: in6, Offset: 448},
+		},
+	}
+
+	got := sockOffsetsFromBTF(common)
+	want := sockOffsets{rcvSaddr: 4, num: 14, family: 16, v6RcvSaddr: 56, hasV6: true}
+	if got != want {
+		t.Errorf("sockOffsetsFromBTF() = %+v, want %+v", got, want)
+	}
+
+	// Kernels built without IPv6 have no skc_v6_rcv_saddr
+	common.Members = common.Members[:len(common.Members)-1]
+	if got := sockOffsetsFromBTF(common); got.hasV6 {
+		t.Errorf("sockOffsetsFromBTF() without IPv6 = %+v, want hasV6 false", got)
+	}
+}
+
+func TestKernelSockOffsets(t *testing.T) {
+	if _, err := os.Stat("/sys/kernel/btf/vmlinux"); err != nil {
+		t.Skip("kernel has no BTF")
+	}
+
+	// The leading fields of sock_common are the same everywhere
+	got := kernelSockOffsets()
+	if got.rcvSaddr != 4 || got.num != 14 || got.family != 16 {
+		t.Errorf("kernelSockOffsets() = %+v, want rcvSaddr 4, num 14, family 16", got)
+	}
+	if !got.hasV6 {
+		t.Logf("kernel has no skc_v6_rcv_saddr")
+	}
+}
+
+func TestListenKprobeSpecVerifies(t *testing.T) {
+	if err := rlimit.RemoveMemlock(); err != nil {
+		t.Skipf("remove memlock: %v", err)
+	}
+	events, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.PerfEventArray, KeySize: 4, ValueSize: 4})
+	if err != nil {
+		t.Skipf("can't create eBPF maps: %v", err)
+	}
+	defer events.Close()
+
+	offsets := sockOffsets{rcvSaddr: 4, num: 14, family: 16, v6RcvSaddr: 56, hasV6: true}
+	for _, readFn := range []asm.BuiltinFunc{asm.FnProbeReadKernel, asm.FnProbeRead} {
+		prog, err := ebpf.NewProgram(listenKprobeSpec(events.FD(), 112, offsets, readFn, tcpClose, tcpListen))
+		if errors.Is(err, ebpf.ErrNotSupported) {
+			t.Logf("%s: %v", readFn, err)
+			continue
+		}
+		if err != nil {
+			var verr *ebpf.VerifierError
+			if errors.As(err, &verr) {
+				t.Fatalf("%s: verifier rejected program: %+v", readFn, verr)
+			}
+			t.Skipf("can't load eBPF programs: %v", err)
+		}
+		prog.Close()
+	}
+}
+
+func TestVerifyKprobesWithoutEvents(t *testing.T) {
+	if err := rlimit.RemoveMemlock(); err != nil {
+		t.Skipf("remove memlock: %v", err)
+	}
+	events, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.PerfEventArray, KeySize: 4, ValueSize: 4})
+	if err != nil {
+		t.Skipf("can't create eBPF maps: %v", err)
+	}
+	defer events.Close()
+
+	// Nothing is attached, as when the hooked function is never called
+	if err := verifyKprobes(&portProbe{events: events, kind: "kprobe"}); err == nil {
+		t.Error("verifyKprobes() = nil with nothing emitting events, want an error")
+	}
+}
@@ -2,11 +2,11 @@ package monitor
 
 import (
 	"context"
-	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/cilium/ebpf"
@@ -19,38 +19,96 @@ import (
 const tcpListen = 10
 
 // ebpfMonitor uses eBPF tracepoint/sock/inet_sock_set_state for instant
-// edge-triggered port events. It implements PortEventSource.
+// edge-triggered port events, or kprobes on kernels without the tracepoint.
+// It implements PortEventSource.
 type ebpfMonitor struct {
-	events chan PortEvent
-	logger *slog.Logger
+	events  chan PortEvent
+	logger  *slog.Logger
+	procs   *processCache
+	dropped atomic.Uint64 // Events dropped because the consumer fell behind
+
+	// debounce is how long a new port must stay open before it's reported
+	debounce time.Duration
+
+	// dropCapabilities gives up the capabilities eBPF needed, and any others
+	// it won't use, once the programs are attached, for long-running monitors
+	dropCapabilities bool
 }
 
-// probeEBPF attempts to load and immediately close the eBPF program to test
-// whether the current kernel and process capabilities support it.
-func probeEBPF() error {
-	if err := rlimit.RemoveMemlock(); err != nil {
-		return fmt.Errorf("remove memlock: %w", err)
+// portProbe is a set of attached eBPF programs and the perf map they emit
+// port_event samples to
+type portProbe struct {
+	events  *ebpf.Map
+	kind    string      // "tracepoint" or "kprobe"
+	closers []io.Closer // closed in reverse order
+
+	// v6Unknown is set when the programs can't read IPv6 bind addresses,
+	// which are then looked up when the port opens
+	v6Unknown bool
+}
+
+// Close detaches the programs and releases the map
+func (p *portProbe) Close() {
+	for i := len(p.closers) - 1; i >= 0; i-- {
+		_ = p.closers[i].Close()
+	}
+}
+
+// attachPortProbe attaches the tracepoint program, falling back to kprobes
+// on kernels that lack the tracepoint or can't load the program
+func attachPortProbe() (*portProbe, error) {
+	p, tpErr := attachTracepoint()
+	if tpErr == nil {
+		return p, nil
+	}
+	p, kpErr := attachKprobes()
+	if kpErr != nil {
+		return nil, fmt.Errorf("%v; falling back to kprobes: %w", tpErr, kpErr)
 	}
+	return p, nil
+}
 
-	spec, err := portbpf.LoadPortMonitor()
+// attachTracepoint loads the prebuilt program and attaches it to
+// sock:inet_sock_set_state, which exists since Linux 4.16
+func attachTracepoint() (*portProbe, error) {
+	var objs portbpf.PortMonitorObjects
+	if err := portbpf.LoadPortMonitorObjects(&objs, nil); err != nil {
+		return nil, fmt.Errorf("load eBPF objects: %w", err)
+	}
+
+	tp, err := link.Tracepoint("sock", "inet_sock_set_state", objs.TraceInetSockSetState, nil)
 	if err != nil {
-		return fmt.Errorf("load spec: %w", err)
+		objs.Close()
+		return nil, fmt.Errorf("attach tracepoint: %w", err)
 	}
+	return &portProbe{
+		events:  objs.Events,
+		kind:    "tracepoint",
+		closers: []io.Closer{&objs, tp},
+	}, nil
+}
 
-	var objs struct {
-		Prog *ebpf.Program `ebpf:"trace_inet_sock_set_state"`
+// probeEBPF attempts to attach and immediately detach the eBPF programs to
+// test whether the current kernel and process capabilities support them.
+func probeEBPF() error {
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return fmt.Errorf("remove memlock: %w", err)
 	}
-	if err := spec.LoadAndAssign(&objs, nil); err != nil {
-		return fmt.Errorf("load program: %w", err)
+
+	p, err := attachPortProbe()
+	if err != nil {
+		return err
 	}
-	objs.Prog.Close()
+	p.Close()
 	return nil
 }
 
-func newEBPFMonitor(logger *slog.Logger) *ebpfMonitor {
+func newEBPFMonitor(logger *slog.Logger, eventBuffer int) *ebpfMonitor {
 	return &ebpfMonitor{
-		events: make(chan PortEvent, 50),
-		logger: logger,
+		events:   make(chan PortEvent, eventBuffer),
+		logger:   logger,
+		procs:    newProcessCache(),
+		debounce: DefaultDebounce,
 	}
 }
 
@@ -59,24 +117,26 @@ func (m *ebpfMonitor) Start(ctx context.Context) error {
 		return fmt.Errorf("remove memlock rlimit: %w", err)
 	}
 
-	var objs portbpf.PortMonitorObjects
-	if err := portbpf.LoadPortMonitorObjects(&objs, nil); err != nil {
-		return fmt.Errorf("load eBPF objects: %w", err)
-	}
-
-	tp, err := link.Tracepoint("sock", "inet_sock_set_state", objs.TraceInetSockSetState, nil)
+	probe, err := attachPortProbe()
 	if err != nil {
-		objs.Close()
-		return fmt.Errorf("attach tracepoint: %w", err)
+		return err
 	}
+	m.logger.Debug("attached eBPF port monitor", "via", probe.kind)
 
-	reader, err := perf.NewReader(objs.Events, 4096)
+	reader, err := perf.NewReader(probe.events, 4096)
 	if err != nil {
-		tp.Close()
-		objs.Close()
+		probe.Close()
 		return fmt.Errorf("create perf reader: %w", err)
 	}
 
+	if m.dropCapabilities {
+		if err := dropEBPFCapabilities(); err != nil {
+			m.logger.Warn("Failed to drop capabilities, keeping them", "error", err)
+		} else {
+			m.logger.Info("Dropped capabilities now that the eBPF programs are attached")
+		}
+	}
+
 	// Capture initial listening ports so consumers see the same PortOpened
 	// burst they'd get from the polling monitor on startup.
 	initialPorts, err := GetListeningPorts()
@@ -93,7 +153,7 @@ func (m *ebpfMonitor) Start(ctx context.Context) error {
 		}
 	}
 
-	go m.readLoop(ctx, reader, tp, &objs)
+	go m.readLoop(ctx, reader, probe)
 	return nil
 }
 
@@ -101,11 +161,19 @@ func (m *ebpfMonitor) Events() <-chan PortEvent {
 	return m.events
 }
 
-func (m *ebpfMonitor) readLoop(ctx context.Context, reader *perf.Reader, tp link.Link, objs *portbpf.PortMonitorObjects) {
+// Dropped returns how many events were dropped because the consumer fell
+// behind
+func (m *ebpfMonitor) Dropped() uint64 {
+	return m.dropped.Load()
+}
+
+func (m *ebpfMonitor) readLoop(ctx context.Context, reader *perf.Reader, probe *portProbe) {
 	defer close(m.events)
+	defer probe.Close()
 	defer reader.Close()
-	defer tp.Close()
-	defer objs.Close()
+
+	opens := newDebouncer(m.debounce, m.emit)
+	defer opens.stop()
 
 	go func() {
 		<-ctx.Done()
@@ -127,63 +195,55 @@ func (m *ebpfMonitor) readLoop(ctx context.Context, reader *perf.Reader, tp link
 			continue
 		}
 
-		raw := record.RawSample
-		// port_event: u32 pid, u16 sport, u16 family, s32 old_state, s32 new_state,
-		//             u8 saddr[4], u8 saddr_v6[16] = 36 bytes
-		if len(raw) < 36 {
-			m.logger.Debug("eBPF event too short", "len", len(raw))
+		pe, ok := decodePortEvent(record.RawSample)
+		if !ok {
+			m.logger.Debug("ignoring eBPF event", "len", len(record.RawSample))
 			continue
 		}
 
-		pid := binary.LittleEndian.Uint32(raw[0:4])
-		sport := binary.LittleEndian.Uint16(raw[4:6])
-		family := binary.LittleEndian.Uint16(raw[6:8])
-		oldState := int32(binary.LittleEndian.Uint32(raw[8:12]))
-		newState := int32(binary.LittleEndian.Uint32(raw[12:16]))
-
-		var evtType EventType
-		protocol := "tcp"
-		if family == 10 { // AF_INET6
-			protocol = "tcp6"
+		if probe.v6Unknown && pe.Type == PortOpened && pe.Protocol == "tcp6" {
+			pe.BindAddr = lookupBindAddr(pe.Port, pe.Protocol, pe.BindAddr)
 		}
 
-		switch {
-		case newState == tcpListen:
-			evtType = PortOpened
-		case oldState == tcpListen:
-			evtType = PortClosed
-		default:
-			continue
+		// Resolve the process now, while it's most likely still running,
+		// so consumers see the same fields as from the polling sources
+		if pe.PID != 0 {
+			pe.ProcessName, pe.ProcessCmd = m.procs.lookup(pe.PID)
 		}
 
-		// Extract bind address from saddr/saddr_v6
-		var bindAddr string
-		if family == 10 { // AF_INET6
-			ip := net.IP(raw[20:36])
-			bindAddr = ip.String()
-		} else { // AF_INET
-			ip := net.IPv4(raw[16], raw[17], raw[18], raw[19])
-			bindAddr = ip.String()
-		}
+		opens.add(pe)
+	}
+}
 
-		pe := PortEvent{
-			Type:      evtType,
-			PID:       int(pid),
-			Port:      int(sport),
-			Protocol:  protocol,
-			BindAddr:  bindAddr,
-			Timestamp: time.Now(),
-		}
+// emit passes an event on to the consumer, dropping it if the consumer has
+// fallen behind
+func (m *ebpfMonitor) emit(pe PortEvent) {
+	select {
+	case m.events <- pe:
+		m.logger.Debug("eBPF port event",
+			"type", pe.Type,
+			"port", pe.Port,
+			"pid", pe.PID,
+			"process", pe.ProcessName,
+			"protocol", pe.Protocol,
+			"bindAddr", pe.BindAddr)
+	default:
+		m.logger.Warn("event channel full, dropping eBPF event")
+		m.dropped.Add(1)
+	}
+}
 
-		select {
-		case m.events <- pe:
-			m.logger.Debug("eBPF port event",
-				"type", pe.Type,
-				"port", pe.Port,
-				"pid", pe.PID,
-				"protocol", pe.Protocol)
-		default:
-			m.logger.Warn("event channel full, dropping eBPF event")
+// lookupBindAddr returns the address a listening port is bound to, read from
+// the system's listeners, or fallback if it isn't listed (yet)
+func lookupBindAddr(port int, protocol, fallback string) string {
+	ports, err := GetListeningPorts()
+	if err != nil {
+		return fallback
+	}
+	for _, p := range ports {
+		if p.Port == port && p.Protocol == protocol {
+			return p.BindAddr
 		}
 	}
+	return fallback
 }
@@ -0,0 +1,62 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// portEventLen is the size of the port_event struct bpf/port_monitor.c emits:
+// u32 pid, u16 sport, u16 family, s32 old_state, s32 new_state, u8 saddr[4],
+// u8 saddr_v6[16]
+const portEventLen = 36
+
+// decodePortEvent turns a perf sample from the eBPF program into a
+// PortEvent, reporting false for samples that aren't a listener opening or
+// closing. The bind address is the listener's local address, so events are
+// filtered by ShouldForwardPort the same way as those of the polling sources.
+func decodePortEvent(raw []byte) (PortEvent, bool) {
+	if len(raw) < portEventLen {
+		return PortEvent{}, false
+	}
+
+	pid := binary.LittleEndian.Uint32(raw[0:4])
+	sport := binary.LittleEndian.Uint16(raw[4:6])
+	family := binary.LittleEndian.Uint16(raw[6:8])
+	oldState := int32(binary.LittleEndian.Uint32(raw[8:12]))
+	newState := int32(binary.LittleEndian.Uint32(raw[12:16]))
+
+	var evtType EventType
+	switch {
+	case newState == tcpListen:
+		evtType = PortOpened
+	case oldState == tcpListen:
+		evtType = PortClosed
+	default:
+		return PortEvent{}, false
+	}
+
+	var protocol, bindAddr string
+	switch family {
+	case unix.AF_INET:
+		protocol = "tcp"
+		bindAddr = net.IP(raw[16:20]).String()
+	case unix.AF_INET6:
+		// IPv4-mapped addresses print as IPv4, as they do from /proc
+		protocol = "tcp6"
+		bindAddr = net.IP(raw[20:36]).String()
+	default:
+		return PortEvent{}, false
+	}
+
+	return PortEvent{
+		Type:      evtType,
+		PID:       int(pid),
+		Port:      int(sport),
+		Protocol:  protocol,
+		BindAddr:  bindAddr,
+		Timestamp: time.Now(),
+	}, true
+}
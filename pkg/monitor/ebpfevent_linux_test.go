@@ -0,0 +1,104 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// rawPortEvent encodes a port_event sample as the eBPF program emits it
+func rawPortEvent(pid uint32, port, family uint16, oldState, newState int32, addr net.IP) []byte {
+	raw := make([]byte, portEventLen)
+	binary.LittleEndian.PutUint32(raw[0:4], pid)
+	binary.LittleEndian.PutUint16(raw[4:6], port)
+	binary.LittleEndian.PutUint16(raw[6:8], family)
+	binary.LittleEndian.PutUint32(raw[8:12], uint32(oldState))
+	binary.LittleEndian.PutUint32(raw[12:16], uint32(newState))
+	if family == unix.AF_INET {
+		copy(raw[16:20], addr.To4())
+	} else {
+		copy(raw[20:36], addr.To16())
+	}
+	return raw
+}
+
+func TestDecodePortEvent(t *testing.T) {
+	const tcpClose = 7
+
+	tests := []struct {
+		name         string
+		raw          []byte
+		wantOK       bool
+		wantType     EventType
+		wantProtocol string
+		wantBindAddr string
+		wantForward  bool // by ShouldForwardPort with default ranges
+	}{
+		{
+			name:         "loopback listen",
+			raw:          rawPortEvent(42, 3000, unix.AF_INET, tcpClose, tcpListen, net.ParseIP("127.0.0.1")),
+			wantOK:       true,
+			wantType:     PortOpened,
+			wantProtocol: "tcp",
+			wantBindAddr: "127.0.0.1",
+			wantForward:  true,
+		},
+		{
+			name:         "tailscale address listen",
+			raw:          rawPortEvent(42, 3000, unix.AF_INET, tcpClose, tcpListen, net.ParseIP("100.101.102.103")),
+			wantOK:       true,
+			wantType:     PortOpened,
+			wantProtocol: "tcp",
+			wantBindAddr: "100.101.102.103",
+			wantForward:  false,
+		},
+		{
+			name:         "ipv6 wildcard close",
+			raw:          rawPortEvent(42, 8080, unix.AF_INET6, tcpListen, tcpClose, net.IPv6unspecified),
+			wantOK:       true,
+			wantType:     PortClosed,
+			wantProtocol: "tcp6",
+			wantBindAddr: "::",
+			wantForward:  true,
+		},
+		{
+			name:         "ipv4-mapped LAN address",
+			raw:          rawPortEvent(42, 8080, unix.AF_INET6, tcpClose, tcpListen, net.ParseIP("::ffff:192.168.1.20")),
+			wantOK:       true,
+			wantType:     PortOpened,
+			wantProtocol: "tcp6",
+			wantBindAddr: "192.168.1.20",
+			wantForward:  false,
+		},
+		{
+			name:   "transition not involving LISTEN",
+			raw:    rawPortEvent(42, 3000, unix.AF_INET, 1, tcpClose, net.ParseIP("127.0.0.1")),
+			wantOK: false,
+		},
+		{
+			name:   "short sample",
+			raw:    make([]byte, portEventLen-1),
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pe, ok := decodePortEvent(tt.raw)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if pe.Type != tt.wantType || pe.Protocol != tt.wantProtocol || pe.BindAddr != tt.wantBindAddr || pe.PID != 42 {
+				t.Errorf("event = %+v, want %s %s on %s", pe, tt.wantType, tt.wantProtocol, tt.wantBindAddr)
+			}
+			if got := ShouldForwardPort(pe.Port, pe.BindAddr, nil, nil); got != tt.wantForward {
+				t.Errorf("ShouldForwardPort = %v, want %v", got, tt.wantForward)
+			}
+		})
+	}
+}
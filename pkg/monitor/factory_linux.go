@@ -1,28 +1,115 @@
 package monitor
 
 import (
+	"fmt"
 	"log/slog"
 	"time"
 )
 
-// NewPortEventSource returns a PortEventSource for a specific process.
-// On Linux, it tries eBPF first and falls back to polling.
+// NewPortEventSource returns a PortEventSource for a process and its
+// descendants. On Linux, it tries eBPF first and falls back to polling.
 func NewPortEventSource(pid int, logger *slog.Logger) PortEventSource {
 	if err := probeEBPF(); err != nil {
 		logger.Info("eBPF not available, falling back to polling", "error", err)
 		return New(pid, logger)
 	}
 	logger.Info("using eBPF port monitoring")
-	return newEBPFMonitor(logger)
+	return newProcessTreeSource(pid, newEBPFMonitor(logger, DefaultEventBuffer), logger)
 }
 
-// NewSystemPortEventSource returns a PortEventSource for system-wide monitoring.
-// On Linux, it tries eBPF first and falls back to polling.
-func NewSystemPortEventSource(logger *slog.Logger, pollInterval time.Duration) PortEventSource {
-	if err := probeEBPF(); err != nil {
-		logger.Info("eBPF not available, falling back to polling", "error", err)
-		return NewSystemMonitor(logger, pollInterval)
+// NewSystemPortEventSource returns a PortEventSource for system-wide
+// monitoring, and the kind of source it is. On Linux, SourceAuto tries eBPF
+// first, then polling with sock_diag queries, and falls back to polling
+// /proc/net; forcing a source that isn't available is an error. Bound UDP
+// ports (opts.UDP) are read from /proc/net alongside, since eBPF and sock_diag
+// only see TCP here. eBPF can't tell network namespaces apart, so
+// opts.Namespaces always polls, and it's an error without the capability to
+// enter them.
+func NewSystemPortEventSource(logger *slog.Logger, pollInterval time.Duration, opts SourceOptions) (PortEventSource, string, error) {
+	if opts.Namespaces {
+		if err := CanEnterNetNamespaces(); err != nil {
+			return nil, "", fmt.Errorf("can't forward ports inside network namespaces: %w", err)
+		}
 	}
+	switch opts.Source {
+	case "", SourceAuto:
+		if opts.Namespaces {
+			logger.Info("network namespace scanning enabled, polling instead of eBPF")
+			m, kind := newPollingSystemMonitor(logger, pollInterval)
+			return opts.configure(m.WithNamespaces()), kind, nil
+		}
+		if err := probeEBPF(); err != nil {
+			logger.Info("eBPF not available, falling back to polling", "error", err)
+			m, kind := newPollingSystemMonitor(logger, pollInterval)
+			return opts.configure(m), kind, nil
+		}
+		return newEBPFSource(logger, pollInterval, opts), SourceEBPF, nil
+
+	case SourceEBPF:
+		if opts.Namespaces {
+			return nil, "", fmt.Errorf("eBPF can't tell network namespaces apart, use source %q or %q with namespaces", SourceNetlink, SourcePoll)
+		}
+		if err := probeEBPF(); err != nil {
+			return nil, "", fmt.Errorf("eBPF not available: %w", err)
+		}
+		return newEBPFSource(logger, pollInterval, opts), SourceEBPF, nil
+
+	case SourceNetlink:
+		if err := probeSockDiag(); err != nil {
+			return nil, "", fmt.Errorf("sock_diag not available: %w", err)
+		}
+		logger.Info("using sock_diag port polling")
+		return opts.configure(withNamespaces(NewSockDiagMonitor(logger, pollInterval), opts)), SourceNetlink, nil
+
+	case SourcePoll:
+		logger.Info("polling /proc/net")
+		return opts.configure(withNamespaces(NewSystemMonitor(logger, pollInterval), opts)), SourcePoll, nil
+	}
+	return nil, "", fmt.Errorf("unknown port event source %q", opts.Source)
+}
+
+// ProbeEBPF reports why eBPF port monitoring can't be used here, if it can't
+func ProbeEBPF() error {
+	return probeEBPF()
+}
+
+// newEBPFSource returns the eBPF monitor, merged with a UDP poller when
+// opts.UDP is set. The system-wide monitor runs for as long as the user is
+// logged in, so it drops its eBPF capabilities once attached.
+func newEBPFSource(logger *slog.Logger, pollInterval time.Duration, opts SourceOptions) PortEventSource {
 	logger.Info("using eBPF port monitoring")
-	return newEBPFMonitor(logger)
+	ebpfSource := newEBPFMonitor(logger, opts.eventBuffer())
+	ebpfSource.dropCapabilities = true
+	if opts.Debounce > 0 {
+		ebpfSource.debounce = opts.Debounce
+	}
+	if opts.UDP {
+		udp := NewUDPMonitor(logger, pollInterval)
+		if opts.Debounce > 0 {
+			udp.WithDebounce(opts.Debounce)
+		}
+		return mergeSources(opts.eventBuffer(), ebpfSource, udp)
+	}
+	return ebpfSource
+}
+
+// withNamespaces adds namespace scanning to a polling monitor when
+// opts.Namespaces is set
+func withNamespaces(m *SystemMonitor, opts SourceOptions) *SystemMonitor {
+	if opts.Namespaces {
+		return m.WithNamespaces()
+	}
+	return m
+}
+
+// newPollingSystemMonitor returns a polling monitor using sock_diag queries
+// when the kernel supports them, else parsing /proc/net, and which of the two
+// it is
+func newPollingSystemMonitor(logger *slog.Logger, pollInterval time.Duration) (*SystemMonitor, string) {
+	if err := probeSockDiag(); err != nil {
+		logger.Info("sock_diag not available, polling /proc/net", "error", err)
+		return NewSystemMonitor(logger, pollInterval), SourcePoll
+	}
+	logger.Info("using sock_diag port polling")
+	return NewSockDiagMonitor(logger, pollInterval), SourceNetlink
 }
@@ -3,16 +3,32 @@
 package monitor
 
 import (
+	"fmt"
 	"log/slog"
 	"time"
 )
 
-// NewPortEventSource returns a polling PortEventSource for a specific process.
+// NewPortEventSource returns a polling PortEventSource for a process and its
+// descendants.
 func NewPortEventSource(pid int, logger *slog.Logger) PortEventSource {
 	return New(pid, logger)
 }
 
-// NewSystemPortEventSource returns a polling PortEventSource for system-wide monitoring.
-func NewSystemPortEventSource(logger *slog.Logger, pollInterval time.Duration) PortEventSource {
-	return NewSystemMonitor(logger, pollInterval)
+// NewSystemPortEventSource returns a polling PortEventSource for system-wide
+// monitoring, reporting bound UDP ports too when opts.UDP is set, and the
+// kind of source it is. Polling is the only source here, and there are no
+// network namespaces to scan.
+func NewSystemPortEventSource(logger *slog.Logger, pollInterval time.Duration, opts SourceOptions) (PortEventSource, string, error) {
+	switch opts.Source {
+	case "", SourceAuto, SourcePoll:
+		return opts.configure(NewSystemMonitor(logger, pollInterval)), SourcePoll, nil
+	case SourceEBPF, SourceNetlink:
+		return nil, "", fmt.Errorf("port event source %q is only available on Linux", opts.Source)
+	}
+	return nil, "", fmt.Errorf("unknown port event source %q", opts.Source)
+}
+
+// ProbeEBPF reports why eBPF port monitoring can't be used here
+func ProbeEBPF() error {
+	return fmt.Errorf("eBPF is only available on Linux")
 }
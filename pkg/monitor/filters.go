@@ -0,0 +1,55 @@
+package monitor
+
+import "log/slog"
+
+// Filters are the port and process rules deciding which ports a session
+// monitor forwards, as in SessionConfig. SetFilters replaces them while the
+// monitor runs.
+type Filters struct {
+	PortRanges            []PortRange
+	IgnorePorts           []int
+	IgnoreProcesses       []string
+	AllowProcesses        []string
+	NeverForwardProcesses []string
+}
+
+// portFilters are Filters compiled for matching, never changed once built
+type portFilters struct {
+	portRanges      []PortRange
+	ignorePorts     map[int]bool
+	ignoreProcesses []string         // raw config (for logging)
+	processMatchers []processMatcher // compiled ignoreProcesses
+	allowProcesses  []string         // raw config (for logging)
+	allowMatchers   []processMatcher // compiled allowProcesses; when set, only matching processes are forwarded
+	neverMatchers   []processMatcher // compiled neverForwardProcesses; ports they own are never forwarded
+}
+
+func compileFilters(f Filters, logger *slog.Logger) *portFilters {
+	ignorePorts := make(map[int]bool, len(f.IgnorePorts))
+	for _, p := range f.IgnorePorts {
+		ignorePorts[p] = true
+	}
+	return &portFilters{
+		portRanges:      f.PortRanges,
+		ignorePorts:     ignorePorts,
+		ignoreProcesses: f.IgnoreProcesses,
+		processMatchers: compileProcessMatchers(f.IgnoreProcesses, logger),
+		allowProcesses:  f.AllowProcesses,
+		allowMatchers:   compileProcessMatchers(f.AllowProcesses, logger),
+		neverMatchers:   compileProcessMatchers(f.NeverForwardProcesses, logger),
+	}
+}
+
+// SetFilters replaces the monitor's port and process rules. Ports opened
+// from now on are checked against them, and polled on their ranges'
+// schedules; forwards already made are kept.
+func (m *SessionMonitor) SetFilters(f Filters) {
+	m.filters.Store(compileFilters(f, m.logger))
+	setPollRanges(m.systemMonitor, f.PortRanges)
+	m.logger.Info("Port and process rules changed",
+		"portRanges", f.PortRanges,
+		"ignorePorts", f.IgnorePorts,
+		"ignoreProcesses", f.IgnoreProcesses,
+		"allowProcesses", f.AllowProcesses,
+		"neverForwardProcesses", f.NeverForwardProcesses)
+}
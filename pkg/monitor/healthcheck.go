@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Kinds of HealthCheck
+const (
+	HealthCheckTCP  = "tcp"  // A TCP connection is accepted
+	HealthCheckHTTP = "http" // An HTTP GET gets a response below 500
+)
+
+// DefaultHealthCheckTimeout is how long a new port is probed before it's
+// given up on
+const DefaultHealthCheckTimeout = 5 * time.Second
+
+// healthCheckInterval is how often a new port is probed until it answers
+const healthCheckInterval = 250 * time.Millisecond
+
+// HealthCheck gates forwarding the ports of a range on the port answering,
+// so servers that listen and then crash while starting up aren't forwarded
+type HealthCheck struct {
+	Type    string        `json:"type"`    // HealthCheckTCP or HealthCheckHTTP
+	Path    string        `json:"path"`    // Path requested by HTTP checks (default "/")
+	Timeout time.Duration `json:"timeout"` // How long to keep probing (0 = DefaultHealthCheckTimeout)
+}
+
+// wait probes the port event's listener until it answers, returning the
+// last probe's error once the timeout passes or ctx is cancelled
+func (h HealthCheck) wait(ctx context.Context, event PortEvent) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		err := h.probe(ctx, event)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe checks the port event's listener once
+func (h HealthCheck) probe(ctx context.Context, event PortEvent) error {
+	addr := net.JoinHostPort(namespaceDialAddr(event.BindAddr), strconv.Itoa(event.Port))
+	dial := healthCheckDialer(event)
+
+	if h.Type != HealthCheckHTTP {
+		conn, err := dial(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	path := h.Path
+	if path == "" {
+		path = "/"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+path, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{DialContext: dial, DisableKeepAlives: true},
+		// A redirect is an answer
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return nil
+}
+
+// dialFunc connects to a port
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// healthCheckDialer returns how to connect to the port event's listener:
+// directly for the host's ports, from inside the namespace for others
+func healthCheckDialer(event PortEvent) dialFunc {
+	if event.Netns == 0 {
+		var d net.Dialer
+		return d.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ns, err := openNetNamespace(event.NetnsPID)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = ns.Close()
+		}()
+		return dialInNamespace(ns, addr)
+	}
+}
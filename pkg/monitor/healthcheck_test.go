@@ -0,0 +1,144 @@
+package monitor
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// listenerEvent returns a PortOpened event for a test listener
+func listenerEvent(t *testing.T, addr net.Addr) PortEvent {
+	t.Helper()
+	tcp := addr.(*net.TCPAddr)
+	return PortEvent{Type: PortOpened, Port: tcp.Port, BindAddr: tcp.IP.String(), Timestamp: time.Now()}
+}
+
+// closedPortEvent returns a PortOpened event for a loopback port nothing
+// listens on
+func closedPortEvent(t *testing.T) PortEvent {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := listenerEvent(t, ln.Addr())
+	_ = ln.Close()
+	return event
+}
+
+func TestHealthCheckWaitTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+
+	check := HealthCheck{Type: HealthCheckTCP, Timeout: time.Second}
+	if err := check.wait(context.Background(), listenerEvent(t, ln.Addr())); err != nil {
+		t.Errorf("wait() on listening port = %v, want nil", err)
+	}
+
+	check.Timeout = 300 * time.Millisecond
+	if err := check.wait(context.Background(), closedPortEvent(t)); err == nil {
+		t.Error("wait() on closed port = nil, want error")
+	}
+}
+
+func TestHealthCheckWaitHTTP(t *testing.T) {
+	var ready atomic.Bool
+	var gotPath atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath.Store(r.URL.Path)
+		if !ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	event := listenerEvent(t, server.Listener.Addr())
+
+	check := HealthCheck{Type: HealthCheckHTTP, Path: "/healthz", Timeout: 300 * time.Millisecond}
+	if err := check.wait(context.Background(), event); err == nil {
+		t.Error("wait() while server errors = nil, want error")
+	}
+	if got := gotPath.Load(); got != "/healthz" {
+		t.Errorf("requested path = %v, want /healthz", got)
+	}
+
+	// Any response short of a server error means it's up
+	time.AfterFunc(300*time.Millisecond, func() { ready.Store(true) })
+	check.Timeout = 2 * time.Second
+	if err := check.wait(context.Background(), event); err != nil {
+		t.Errorf("wait() once server answers = %v, want nil", err)
+	}
+}
+
+func TestHandlePortEvent_HealthCheckGatesForward(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+	healthy := listenerEvent(t, ln.Addr())
+	crashed := closedPortEvent(t)
+
+	client := &mockDaemonClient{}
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:    "test",
+		DaemonClient: client,
+		Logger:       slog.Default(),
+		PortRanges: []PortRange{{
+			Start:       1024,
+			End:         65535,
+			HealthCheck: &HealthCheck{Type: HealthCheckTCP, Timeout: 300 * time.Millisecond},
+		}},
+		PortEventSource: &mockPortEventSource{},
+	})
+	sm.resolveProcessName = func(pid int) string { return "" }
+	sm.resolveProcessCwd = func(pid int) string { return "" }
+
+	sm.handlePortEvent(healthy)
+	sm.handlePortEvent(crashed)
+	if got := client.forwardCount(); got != 0 {
+		t.Fatalf("forward count before health checks = %d, want 0", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sm.mutex.RLock()
+		probing := len(sm.probes)
+		sm.mutex.RUnlock()
+		if probing == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("health checks did not finish")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	sm.mutex.RLock()
+	_, healthyForwarded := sm.activeForwards[strconv.Itoa(healthy.Port)]
+	_, crashedForwarded := sm.activeForwards[strconv.Itoa(crashed.Port)]
+	sm.mutex.RUnlock()
+	if !healthyForwarded {
+		t.Error("port that passed its health check was not forwarded")
+	}
+	if crashedForwarded {
+		t.Error("port that failed its health check was forwarded")
+	}
+	if got := client.forwardCount(); got != 1 {
+		t.Errorf("forward count = %d, want 1", got)
+	}
+}
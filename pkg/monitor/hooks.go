@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values of ACTION in a hook's environment
+const (
+	HookActionForward   = "forward"
+	HookActionUnforward = "unforward"
+)
+
+// hookTimeout is how long a hook may run before it's killed
+const hookTimeout = 30 * time.Second
+
+// hookQueue is how many events can wait on hooks still running before
+// further ones are dropped
+const hookQueue = 64
+
+// Hooks runs user commands when the monitor's forwards change, fed by an
+// EventTap's OnChange. Commands run one event at a time, in order, so a
+// hook updating a status line never sees an older state last.
+type Hooks struct {
+	commands []string
+	logger   *slog.Logger
+	events   chan TapEvent
+}
+
+// NewHooks creates hooks running each of commands through the shell
+func NewHooks(commands []string, logger *slog.Logger) *Hooks {
+	return &Hooks{
+		commands: commands,
+		logger:   logger,
+		events:   make(chan TapEvent, hookQueue),
+	}
+}
+
+// Notify queues event for the hooks without blocking
+func (h *Hooks) Notify(event TapEvent) {
+	select {
+	case h.events <- event:
+	default:
+		h.logger.Warn("Hooks fell behind, dropping event", "type", event.Type)
+	}
+}
+
+// Run runs the hooks for each queued event until ctx is done
+func (h *Hooks) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-h.events:
+			env := hookEnv(event)
+			for _, command := range h.commands {
+				h.run(ctx, command, env)
+			}
+		}
+	}
+}
+
+// run runs one hook, logging its output if it fails
+func (h *Hooks) run(ctx context.Context, command string, env []string) {
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	cmd := hookCommand(ctx, command)
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		h.logger.Warn("Hook failed",
+			"command", command,
+			"error", err,
+			"output", strings.TrimSpace(string(output)))
+	}
+}
+
+// hookCommand runs command through the platform's shell
+func hookCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// hookEnv describes event to a hook: ACTION, what was forwarded or
+// unforwarded (PORT, PORT_END, LOCAL_PORT, HOST, SOCKET, NAME, PROCESS,
+// APP_PROTOCOL), and PORTS, every port forwarded after it
+func hookEnv(event TapEvent) []string {
+	action := HookActionForward
+	if event.Type == TapUnforwarded {
+		action = HookActionUnforward
+	}
+	ports := make([]string, len(event.Ports))
+	for i, port := range event.Ports {
+		ports[i] = strconv.Itoa(port)
+	}
+
+	var fwd TapForward
+	if event.Forward != nil {
+		fwd = *event.Forward
+	}
+	itoa := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	return []string{
+		"ACTION=" + action,
+		"PORT=" + itoa(fwd.Port),
+		"PORT_END=" + itoa(fwd.PortEnd),
+		"LOCAL_PORT=" + itoa(fwd.LocalPort),
+		"HOST=" + fwd.Host,
+		"SOCKET=" + fwd.Socket,
+		"NAME=" + fwd.Name,
+		"PROCESS=" + fwd.Process,
+		"APP_PROTOCOL=" + fwd.AppProtocol,
+		"PORTS=" + strings.Join(ports, ","),
+	}
+}
@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook command uses sh syntax")
+	}
+	out := filepath.Join(t.TempDir(), "hook.log")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hooks := NewHooks([]string{`echo "$ACTION $PORT $PROCESS [$PORTS]" >> ` + out}, slog.Default())
+	go hooks.Run(ctx)
+
+	tap := NewEventTap(slog.Default())
+	tap.OnChange(hooks.Notify)
+	tap.add(TapForward{Port: 3000, Process: "node"})
+	tap.add(TapForward{Port: 5173, Process: "vite"})
+	tap.remove(protocol.UnforwardRequest{RemotePort: 3000})
+	// Changes made around the monitor, which Sync catches, run hooks too
+	tap.Sync("devbox", []protocol.ForwardInfo{
+		{ConnectionInfo: "devbox", RemotePort: 8080, LocalPort: 8080, Host: "localhost"},
+	}, time.Now())
+
+	want := "forward 3000 node [3000]\nforward 5173 vite [3000,5173]\nunforward 3000 node [5173]\n" +
+		"unforward 5173 vite []\nforward 8080  [8080]\n"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(out)
+		if string(data) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("hook output = %q, want %q", strings.TrimSpace(string(data)), want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,323 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+// DefaultKubeAnnotation marks the Services KubeWatcher forwards
+const DefaultKubeAnnotation = "bankshot.dev/forward"
+
+// KubeConfig holds configuration for a KubeWatcher
+type KubeConfig struct {
+	SessionID    string
+	DaemonClient DaemonClient
+	Kubectl      string        // kubectl binary (default: "kubectl")
+	Context      string        // kubeconfig context ("" = current)
+	Annotation   string        // annotation set to "true" on Services to forward (default: DefaultKubeAnnotation)
+	PollInterval time.Duration // how often Services are listed
+	Logger       *slog.Logger
+}
+
+// KubeService is one NodePort of an annotated Service, forwarded from the
+// node to the Service's own port locally
+type KubeService struct {
+	Namespace string
+	Name      string
+	Port      int    // Service port, used as the local port
+	NodePort  int    // Port the node exposes the Service on
+	Host      string // Node address the NodePort is reached at
+}
+
+// key identifies the forward for a Service port
+func (s KubeService) key() string {
+	return fmt.Sprintf("%s/%s:%d@%s", s.Namespace, s.Name, s.NodePort, s.Host)
+}
+
+// KubeWatcher forwards the NodePort Services of a local development cluster
+// (kind, minikube, k3s) that carry its annotation, so they don't need a
+// `kubectl port-forward` on the remote host. It polls with kubectl, like
+// the forwarder drives ssh, instead of linking a Kubernetes client.
+type KubeWatcher struct {
+	cfg     KubeConfig
+	active  map[string]KubeService
+	host    string                               // Node address forwards go to, kept while the node is ready
+	kubectl func(args ...string) ([]byte, error) // runs kubectl; replaced in tests
+}
+
+// NewKubeWatcher creates a watcher for the cluster cfg points at
+func NewKubeWatcher(cfg KubeConfig) *KubeWatcher {
+	if cfg.Kubectl == "" {
+		cfg.Kubectl = "kubectl"
+	}
+	if cfg.Annotation == "" {
+		cfg.Annotation = DefaultKubeAnnotation
+	}
+	w := &KubeWatcher{
+		cfg:    cfg,
+		active: make(map[string]KubeService),
+	}
+	w.kubectl = w.runKubectl
+	return w
+}
+
+// Run syncs forwards with the cluster until ctx is cancelled, then removes
+// them
+func (w *KubeWatcher) Run(ctx context.Context) {
+	w.cfg.Logger.Info("Watching Kubernetes Services",
+		"context", w.cfg.Context,
+		"annotation", w.cfg.Annotation)
+
+	w.sync()
+
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			for key, svc := range w.active {
+				w.unforward(svc)
+				delete(w.active, key)
+			}
+			return
+		case <-ticker.C:
+			w.sync()
+		}
+	}
+}
+
+// sync forwards annotated Services that aren't forwarded yet and removes
+// forwards of Services that are gone. While the cluster can't be reached,
+// forwards are left as they are.
+func (w *KubeWatcher) sync() {
+	services, err := w.listServices()
+	if err != nil {
+		w.cfg.Logger.Debug("Failed to list Kubernetes Services", "error", err)
+		return
+	}
+
+	current := make(map[string]KubeService, len(services))
+	for _, svc := range services {
+		current[svc.key()] = svc
+	}
+
+	for _, svc := range services {
+		if _, ok := w.active[svc.key()]; ok {
+			continue
+		}
+		if w.forward(svc) {
+			w.active[svc.key()] = svc
+		}
+	}
+	for key, svc := range w.active {
+		if _, ok := current[key]; !ok {
+			w.unforward(svc)
+			delete(w.active, key)
+		}
+	}
+}
+
+// listServices returns the annotated Services' NodePorts, reached at a
+// ready node: the one used so far while it stays ready, otherwise the first.
+// Any node serves every NodePort, so when one goes down the forwards move
+// to another.
+func (w *KubeWatcher) listServices() ([]KubeService, error) {
+	data, err := w.kubectl("get", "services", "--all-namespaces", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	services, err := parseKubeServices(data, w.cfg.Annotation)
+	if err != nil || len(services) == 0 {
+		return services, err
+	}
+
+	data, err = w.kubectl("get", "nodes", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := parseKubeNodeAddresses(data)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(hosts, w.host) {
+		w.host = hosts[0]
+	}
+	for i := range services {
+		services[i].Host = w.host
+	}
+	return services, nil
+}
+
+// runKubectl runs kubectl against the configured context and returns its
+// output
+func (w *KubeWatcher) runKubectl(args ...string) ([]byte, error) {
+	if w.cfg.Context != "" {
+		args = append([]string{"--context", w.cfg.Context}, args...)
+	}
+	cmd := exec.Command(w.cfg.Kubectl, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kubectl %s: %w (%s)", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// forward asks the daemon to forward a Service port, reporting whether it
+// was accepted
+func (w *KubeWatcher) forward(svc KubeService) bool {
+	payload, _ := json.Marshal(protocol.ForwardRequest{
+		RemotePort:     svc.NodePort,
+		LocalPort:      svc.Port,
+		Host:           svc.Host,
+		ConnectionInfo: w.cfg.SessionID,
+		ProcessName:    fmt.Sprintf("k8s %s/%s", svc.Namespace, svc.Name),
+		Owner:          protocol.OwnerMonitor,
+	})
+	resp, err := w.cfg.DaemonClient.SendRequest(&protocol.Request{
+		ID:      uuid.New().String(),
+		Type:    protocol.CommandForward,
+		Payload: payload,
+	})
+	if err != nil {
+		w.cfg.Logger.Error("Failed to request Service forward", "service", svc.key(), "error", err)
+		return false
+	}
+	if !resp.Success {
+		w.cfg.Logger.Error("Service forward request failed", "service", svc.key(), "error", resp.Error)
+		return false
+	}
+	w.cfg.Logger.Info("Forwarded Kubernetes Service",
+		"namespace", svc.Namespace,
+		"service", svc.Name,
+		"nodePort", svc.NodePort,
+		"localPort", svc.Port)
+	return true
+}
+
+// unforward asks the daemon to remove a Service port's forward
+func (w *KubeWatcher) unforward(svc KubeService) {
+	payload, _ := json.Marshal(protocol.UnforwardRequest{
+		RemotePort:     svc.NodePort,
+		Host:           svc.Host,
+		ConnectionInfo: w.cfg.SessionID,
+	})
+	resp, err := w.cfg.DaemonClient.SendRequest(&protocol.Request{
+		ID:      uuid.New().String(),
+		Type:    protocol.CommandUnforward,
+		Payload: payload,
+	})
+	if err != nil {
+		w.cfg.Logger.Error("Failed to remove Service forward", "service", svc.key(), "error", err)
+		return
+	}
+	if !resp.Success {
+		w.cfg.Logger.Error("Service unforward request failed", "service", svc.key(), "error", resp.Error)
+		return
+	}
+	w.cfg.Logger.Info("Removed Kubernetes Service forward",
+		"namespace", svc.Namespace,
+		"service", svc.Name,
+		"nodePort", svc.NodePort)
+}
+
+// kubeList is the part of `kubectl get services|nodes -o json` output that's
+// used
+type kubeList struct {
+	Items []struct {
+		Metadata struct {
+			Name        string            `json:"name"`
+			Namespace   string            `json:"namespace"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Spec struct {
+			Ports []struct {
+				Port     int `json:"port"`
+				NodePort int `json:"nodePort"`
+			} `json:"ports"`
+		} `json:"spec"`
+		Status struct {
+			Addresses []struct {
+				Type    string `json:"type"`
+				Address string `json:"address"`
+			} `json:"addresses"`
+			Conditions []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			} `json:"conditions"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// parseKubeServices returns the NodePorts of the Services in a
+// `kubectl get services -o json` list whose annotation is "true", sorted
+func parseKubeServices(data []byte, annotation string) ([]KubeService, error) {
+	var list kubeList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse Services: %w", err)
+	}
+
+	var services []KubeService
+	for _, item := range list.Items {
+		if item.Metadata.Annotations[annotation] != "true" {
+			continue
+		}
+		// LoadBalancer Services get NodePorts too
+		for _, port := range item.Spec.Ports {
+			if port.NodePort == 0 {
+				continue
+			}
+			services = append(services, KubeService{
+				Namespace: item.Metadata.Namespace,
+				Name:      item.Metadata.Name,
+				Port:      port.Port,
+				NodePort:  port.NodePort,
+			})
+		}
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].key() < services[j].key() })
+	return services, nil
+}
+
+// parseKubeNodeAddresses returns the InternalIPs of the ready nodes in a
+// `kubectl get nodes -o json` list, in its order. A node without a Ready
+// condition counts as ready.
+func parseKubeNodeAddresses(data []byte) ([]string, error) {
+	var list kubeList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse nodes: %w", err)
+	}
+	var hosts []string
+	for _, item := range list.Items {
+		ready := true
+		for _, cond := range item.Status.Conditions {
+			if cond.Type == "Ready" {
+				ready = cond.Status == "True"
+			}
+		}
+		if !ready {
+			continue
+		}
+		for _, addr := range item.Status.Addresses {
+			if addr.Type == "InternalIP" {
+				hosts = append(hosts, addr.Address)
+				break
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no ready node with an InternalIP address")
+	}
+	return hosts, nil
+}
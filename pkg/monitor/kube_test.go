@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+const kubeServicesJSON = `{"items": [
+  {"metadata": {"name": "web", "namespace": "dev", "annotations": {"bankshot.dev/forward": "true"}},
+   "spec": {"type": "NodePort", "ports": [{"port": 8080, "nodePort": 30080}, {"port": 9090, "nodePort": 30090}]}},
+  {"metadata": {"name": "db", "namespace": "dev"},
+   "spec": {"type": "NodePort", "ports": [{"port": 5432, "nodePort": 30432}]}},
+  {"metadata": {"name": "internal", "namespace": "dev", "annotations": {"bankshot.dev/forward": "true"}},
+   "spec": {"type": "ClusterIP", "ports": [{"port": 80}]}}
+]}`
+
+const kubeNodesJSON = `{"items": [
+  {"metadata": {"name": "kind-control-plane"},
+   "status": {"addresses": [{"type": "Hostname", "address": "kind-control-plane"}, {"type": "InternalIP", "address": "172.18.0.2"}]}}
+]}`
+
+const kubeTwoNodesJSON = `{"items": [
+  {"metadata": {"name": "kind-control-plane"},
+   "status": {"addresses": [{"type": "InternalIP", "address": "172.18.0.2"}], "conditions": [{"type": "Ready", "status": "%s"}]}},
+  {"metadata": {"name": "kind-worker"},
+   "status": {"addresses": [{"type": "InternalIP", "address": "172.18.0.3"}], "conditions": [{"type": "Ready", "status": "True"}]}}
+]}`
+
+func TestParseKubeServices(t *testing.T) {
+	services, err := parseKubeServices([]byte(kubeServicesJSON), DefaultKubeAnnotation)
+	if err != nil {
+		t.Fatalf("parseKubeServices failed: %v", err)
+	}
+
+	// Only the annotated Service's NodePorts; the ClusterIP Service has none
+	want := []KubeService{
+		{Namespace: "dev", Name: "web", Port: 8080, NodePort: 30080},
+		{Namespace: "dev", Name: "web", Port: 9090, NodePort: 30090},
+	}
+	if len(services) != len(want) {
+		t.Fatalf("got %+v, want %+v", services, want)
+	}
+	for i := range want {
+		if services[i] != want[i] {
+			t.Errorf("services[%d] = %+v, want %+v", i, services[i], want[i])
+		}
+	}
+
+	hosts, err := parseKubeNodeAddresses([]byte(kubeNodesJSON))
+	if err != nil || len(hosts) != 1 || hosts[0] != "172.18.0.2" {
+		t.Errorf("parseKubeNodeAddresses = %q, %v; want 172.18.0.2", hosts, err)
+	}
+	hosts, err = parseKubeNodeAddresses([]byte(fmt.Sprintf(kubeTwoNodesJSON, "False")))
+	if err != nil || len(hosts) != 1 || hosts[0] != "172.18.0.3" {
+		t.Errorf("parseKubeNodeAddresses = %q, %v; want only the ready 172.18.0.3", hosts, err)
+	}
+}
+
+func TestKubeWatcherNodeFailover(t *testing.T) {
+	client := &mockDaemonClient{}
+	w := NewKubeWatcher(KubeConfig{
+		SessionID:    "test",
+		DaemonClient: client,
+		Logger:       slog.Default(),
+	})
+	ready := "True"
+	w.kubectl = func(args ...string) ([]byte, error) {
+		if args[1] == "nodes" {
+			return []byte(fmt.Sprintf(kubeTwoNodesJSON, ready)), nil
+		}
+		return []byte(kubeServicesJSON), nil
+	}
+	hosts := func() []string {
+		var hosts []string
+		for _, svc := range w.active {
+			hosts = append(hosts, svc.Host)
+		}
+		return hosts
+	}
+
+	w.sync()
+	for _, host := range hosts() {
+		if host != "172.18.0.2" {
+			t.Fatalf("forwarded to %s, want the first node", host)
+		}
+	}
+
+	// The first node going down moves the forwards to the other
+	ready = "False"
+	w.sync()
+	if got := hosts(); len(got) != 2 || got[0] != "172.18.0.3" || got[1] != "172.18.0.3" {
+		t.Errorf("forwarded to %v after the first node went down, want 172.18.0.3", got)
+	}
+
+	// and they stay there once it's back
+	ready = "True"
+	requests := len(client.requests)
+	w.sync()
+	if len(client.requests) != requests {
+		t.Errorf("sync() sent %d requests once the first node was back, want none", len(client.requests)-requests)
+	}
+}
+
+func TestKubeWatcherSync(t *testing.T) {
+	client := &mockDaemonClient{}
+	w := NewKubeWatcher(KubeConfig{
+		SessionID:    "test",
+		DaemonClient: client,
+		Logger:       slog.Default(),
+	})
+
+	services := kubeServicesJSON
+	var kubectlErr error
+	w.kubectl = func(args ...string) ([]byte, error) {
+		if kubectlErr != nil {
+			return nil, kubectlErr
+		}
+		if args[1] == "nodes" {
+			return []byte(kubeNodesJSON), nil
+		}
+		return []byte(services), nil
+	}
+
+	w.sync()
+	w.sync()
+	if client.forwardCount() != 2 {
+		t.Fatalf("expected 2 forwards, got %d", client.forwardCount())
+	}
+	var req protocol.ForwardRequest
+	if err := json.Unmarshal(client.requests[0].Payload, &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.RemotePort != 30080 || req.LocalPort != 8080 || req.Host != "172.18.0.2" {
+		t.Errorf("forward request = %+v, want 172.18.0.2:30080 -> 8080", req)
+	}
+
+	// An unreachable cluster leaves the forwards alone
+	kubectlErr = errors.New("connection refused")
+	w.sync()
+	if len(client.requests) != 2 || len(w.active) != 2 {
+		t.Fatalf("expected forwards untouched while kubectl fails, got %d requests", len(client.requests))
+	}
+
+	// Dropping the annotation removes the forwards
+	kubectlErr = nil
+	services = `{"items": []}`
+	w.sync()
+	if len(client.requests) != 4 || len(w.active) != 0 {
+		t.Errorf("expected both forwards removed, got %d requests and %d active", len(client.requests), len(w.active))
+	}
+	if last := client.requests[3]; last.Type != protocol.CommandUnforward {
+		t.Errorf("expected an unforward request, got %s", last.Type)
+	}
+}
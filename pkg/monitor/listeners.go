@@ -0,0 +1,109 @@
+//go:build !windows
+
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// GetListeningPorts returns all ports in LISTEN state
+func GetListeningPorts() ([]Port, error) {
+	var allPorts []Port
+
+	// Parse TCP ports
+	tcpPorts, err := parseProcNet("/proc/net/tcp", "tcp")
+	if err == nil {
+		allPorts = append(allPorts, tcpPorts...)
+	}
+
+	// Parse TCP6 ports
+	tcp6Ports, err := parseProcNet("/proc/net/tcp6", "tcp6")
+	if err == nil {
+		allPorts = append(allPorts, tcp6Ports...)
+	}
+
+	return allPorts, nil
+}
+
+// GetProcessListeningPorts returns the listening ports of a process and its
+// descendants, so ports bound by grandchildren (npm run dev → sh → node)
+// count as the process's own. Ports are read from the process's network
+// namespace and kept if a process in the tree holds the socket.
+func GetProcessListeningPorts(pid int) ([]Port, error) {
+	tree, err := processDescendants(pid)
+	if err != nil {
+		return nil, err
+	}
+	return listeningPortsHeldBy(pid, tree), nil
+}
+
+// GetOwnListeningPorts returns the listening ports whose sockets the process
+// itself holds, leaving out those only its descendants hold
+func GetOwnListeningPorts(pid int) ([]Port, error) {
+	return listeningPortsHeldBy(pid, map[int]bool{pid: true}), nil
+}
+
+// listeningPortsHeldBy returns the listening ports in pid's network namespace
+// whose sockets one of members holds
+func listeningPortsHeldBy(pid int, members map[int]bool) []Port {
+	var allPorts []Port
+
+	// Try process-specific network namespace
+	tcpPath := fmt.Sprintf("/proc/%d/net/tcp", pid)
+	tcpPorts, err := parseProcNet(tcpPath, "tcp")
+	if err == nil {
+		allPorts = append(allPorts, tcpPorts...)
+	} else {
+		// Fallback to system-wide if process-specific fails
+		tcpPorts, _ = parseProcNet("/proc/net/tcp", "tcp")
+		allPorts = append(allPorts, tcpPorts...)
+	}
+
+	// Same for TCP6
+	tcp6Path := fmt.Sprintf("/proc/%d/net/tcp6", pid)
+	tcp6Ports, err := parseProcNet(tcp6Path, "tcp6")
+	if err == nil {
+		allPorts = append(allPorts, tcp6Ports...)
+	} else {
+		tcp6Ports, _ = parseProcNet("/proc/net/tcp6", "tcp6")
+		allPorts = append(allPorts, tcp6Ports...)
+	}
+
+	held := make(map[uint64]bool)
+	for member := range members {
+		for _, inode := range socketInodes(member) {
+			held[inode] = true
+		}
+	}
+
+	var ports []Port
+	for _, p := range allPorts {
+		if held[p.Inode] {
+			ports = append(ports, p)
+		}
+	}
+	return ports
+}
+
+// processDescendants returns pid and every process descended from it, found
+// by walking the parent PIDs in /proc
+func processDescendants(pid int) (map[int]bool, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		child, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if parent := ResolveParentPID(child); parent != 0 {
+			children[parent] = append(children[parent], child)
+		}
+	}
+	return descendantsOf(pid, children), nil
+}
@@ -0,0 +1,202 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// GetExtendedTcpTable isn't wrapped by x/sys/windows, so it's called
+// directly from iphlpapi.dll
+var (
+	iphlpapi                = windows.NewLazySystemDLL("iphlpapi.dll")
+	procGetExtendedTcpTable = iphlpapi.NewProc("GetExtendedTcpTable")
+)
+
+// Layouts from iprtrmib.h and tcpmib.h
+const (
+	tcpTableOwnerPIDListener = 3  // TCP_TABLE_OWNER_PID_LISTENER
+	tcpRowOwnerPIDLen        = 24 // MIB_TCPROW_OWNER_PID: state, local addr, local port, remote addr, remote port, pid
+	tcp6RowOwnerPIDLen       = 56 // MIB_TCP6ROW_OWNER_PID: local addr[16], scope, local port, remote addr[16], scope, remote port, state, pid
+)
+
+// listener is a TCP listener and the process that owns it
+type listener struct {
+	Port
+	PID int
+}
+
+// GetListeningPorts returns all ports in LISTEN state
+func GetListeningPorts() ([]Port, error) {
+	listeners, err := getListeners()
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]Port, 0, len(listeners))
+	for _, l := range listeners {
+		ports = append(ports, l.Port)
+	}
+	return ports, nil
+}
+
+// GetProcessListeningPorts returns the ports listened on by a process or any
+// of its descendants. Unlike /proc, the TCP table names each listener's
+// owner, so a wrapped shell's children are found without scanning the whole
+// system's ports.
+func GetProcessListeningPorts(pid int) ([]Port, error) {
+	listeners, err := getListeners()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := processDescendants(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []Port
+	for _, l := range listeners {
+		if tree[l.PID] {
+			ports = append(ports, l.Port)
+		}
+	}
+	return ports, nil
+}
+
+// GetOwnListeningPorts returns the ports listened on by the process itself,
+// leaving out those of its descendants
+func GetOwnListeningPorts(pid int) ([]Port, error) {
+	listeners, err := getListeners()
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []Port
+	for _, l := range listeners {
+		if l.PID == pid {
+			ports = append(ports, l.Port)
+		}
+	}
+	return ports, nil
+}
+
+// getListeners returns the TCP listeners of both address families
+func getListeners() ([]listener, error) {
+	var all []listener
+	for _, family := range []struct {
+		af       uint32
+		protocol string
+	}{
+		{windows.AF_INET, "tcp"},
+		{windows.AF_INET6, "tcp6"},
+	} {
+		table, err := extendedTCPTable(family.af)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s table: %w", family.protocol, err)
+		}
+		listeners, err := parseTCPTable(table, family.protocol)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, listeners...)
+	}
+	return all, nil
+}
+
+// extendedTCPTable returns the raw TCP_TABLE_OWNER_PID_LISTENER table of an
+// address family. The table can grow between sizing the buffer and filling
+// it, so that's retried a few times.
+func extendedTCPTable(af uint32) ([]byte, error) {
+	size := uint32(4096)
+	for attempt := 0; attempt < 4; attempt++ {
+		buf := make([]byte, size)
+		ret, _, _ := procGetExtendedTcpTable.Call(
+			uintptr(unsafe.Pointer(&buf[0])),
+			uintptr(unsafe.Pointer(&size)),
+			0, // unsorted
+			uintptr(af),
+			tcpTableOwnerPIDListener,
+			0,
+		)
+		switch windows.Errno(ret) {
+		case windows.ERROR_SUCCESS:
+			return buf[:size], nil
+		case windows.ERROR_INSUFFICIENT_BUFFER:
+			continue
+		default:
+			return nil, windows.Errno(ret)
+		}
+	}
+	return nil, windows.ERROR_INSUFFICIENT_BUFFER
+}
+
+// parseTCPTable decodes a MIB_TCPTABLE_OWNER_PID or MIB_TCP6TABLE_OWNER_PID:
+// an entry count followed by the rows. Addresses and ports are in network
+// byte order, the rest native.
+func parseTCPTable(b []byte, protocol string) ([]listener, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("%s table too short (%d bytes)", protocol, len(b))
+	}
+	count := int(binary.LittleEndian.Uint32(b[0:4]))
+
+	rowLen := tcpRowOwnerPIDLen
+	if protocol == "tcp6" {
+		rowLen = tcp6RowOwnerPIDLen
+	}
+	rows := b[4:]
+	if count*rowLen > len(rows) {
+		return nil, fmt.Errorf("%s table truncated (%d rows in %d bytes)", protocol, count, len(rows))
+	}
+
+	listeners := make([]listener, 0, count)
+	for i := 0; i < count; i++ {
+		row := rows[i*rowLen : (i+1)*rowLen]
+
+		var bindAddr string
+		var port uint16
+		var pid uint32
+		if protocol == "tcp6" {
+			bindAddr = net.IP(row[0:16]).String()
+			port = binary.BigEndian.Uint16(row[20:22])
+			pid = binary.LittleEndian.Uint32(row[52:56])
+		} else {
+			bindAddr = net.IP(row[4:8]).String()
+			port = binary.BigEndian.Uint16(row[8:10])
+			pid = binary.LittleEndian.Uint32(row[20:24])
+		}
+
+		listeners = append(listeners, listener{
+			Port: Port{
+				Port:     int(port),
+				Protocol: protocol,
+				State:    "LISTEN",
+				BindAddr: bindAddr,
+			},
+			PID: int(pid),
+		})
+	}
+	return listeners, nil
+}
+
+// processDescendants returns the set of pid and every process descended
+// from it
+func processDescendants(pid int) (map[int]bool, error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot processes: %w", err)
+	}
+	defer func() {
+		_ = windows.CloseHandle(snapshot)
+	}()
+
+	children := make(map[int][]int)
+	entry := windows.ProcessEntry32{Size: uint32(unsafe.Sizeof(windows.ProcessEntry32{}))}
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		parent := int(entry.ParentProcessID)
+		children[parent] = append(children[parent], int(entry.ProcessID))
+	}
+
+	return descendantsOf(pid, children), nil
+}
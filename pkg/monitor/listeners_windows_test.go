@@ -0,0 +1,65 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestParseTCPTable(t *testing.T) {
+	// Two MIB_TCPROW_OWNER_PID rows: 127.0.0.1:8080 (pid 1234), 0.0.0.0:3000 (pid 42)
+	table := make([]byte, 4+2*tcpRowOwnerPIDLen)
+	binary.LittleEndian.PutUint32(table[0:4], 2)
+	row := table[4:]
+	copy(row[4:8], net.IPv4(127, 0, 0, 1).To4())
+	binary.BigEndian.PutUint16(row[8:10], 8080)
+	binary.LittleEndian.PutUint32(row[20:24], 1234)
+	row = table[4+tcpRowOwnerPIDLen:]
+	binary.BigEndian.PutUint16(row[8:10], 3000)
+	binary.LittleEndian.PutUint32(row[20:24], 42)
+
+	listeners, err := parseTCPTable(table, "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []listener{
+		{Port: Port{Port: 8080, Protocol: "tcp", State: "LISTEN", BindAddr: "127.0.0.1"}, PID: 1234},
+		{Port: Port{Port: 3000, Protocol: "tcp", State: "LISTEN", BindAddr: "0.0.0.0"}, PID: 42},
+	}
+	if len(listeners) != len(want) {
+		t.Fatalf("got %d listeners, want %d", len(listeners), len(want))
+	}
+	for i := range want {
+		if listeners[i] != want[i] {
+			t.Errorf("listener %d = %+v, want %+v", i, listeners[i], want[i])
+		}
+	}
+}
+
+func TestParseTCPTable6(t *testing.T) {
+	table := make([]byte, 4+tcp6RowOwnerPIDLen)
+	binary.LittleEndian.PutUint32(table[0:4], 1)
+	row := table[4:]
+	copy(row[0:16], net.IPv6loopback)
+	binary.BigEndian.PutUint16(row[20:22], 5173)
+	binary.LittleEndian.PutUint32(row[52:56], 99)
+
+	listeners, err := parseTCPTable(table, "tcp6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 1 {
+		t.Fatalf("got %d listeners, want 1", len(listeners))
+	}
+	if l := listeners[0]; l.Port.Port != 5173 || l.BindAddr != "::1" || l.PID != 99 {
+		t.Errorf("listener = %+v, want [::1]:5173 owned by 99", l)
+	}
+}
+
+func TestParseTCPTableTruncated(t *testing.T) {
+	table := make([]byte, 4+tcpRowOwnerPIDLen)
+	binary.LittleEndian.PutUint32(table[0:4], 2)
+	if _, err := parseTCPTable(table, "tcp"); err == nil {
+		t.Error("expected error for truncated table")
+	}
+}
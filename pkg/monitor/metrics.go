@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"slices"
+	"time"
+)
+
+// recentOutcomes is how many port outcomes a session monitor remembers
+const recentOutcomes = 20
+
+// Outcomes of a newly opened port, as recorded in PortOutcome
+const (
+	OutcomeForwarded = "forwarded"
+	OutcomeQueued    = "queued"    // The daemon will retry the forward
+	OutcomeFailed    = "failed"    // The forward request failed
+	OutcomeFiltered  = "filtered"  // Outside portRanges, in ignorePorts, or bound to a non-local address
+	OutcomeIgnored   = "ignored"   // Its process matched ignoreProcesses or missed allowProcesses
+	OutcomeUnhealthy = "unhealthy" // It failed its range's health check
+)
+
+// PortOutcome records what became of a newly opened port
+type PortOutcome struct {
+	Port    int       `json:"port"`
+	Outcome string    `json:"outcome"`
+	Detail  string    `json:"detail,omitempty"` // Process, matched rule, or error
+	Time    time.Time `json:"time"`
+}
+
+// SessionMetrics counts what a SessionMonitor did with the events it
+// received, to diagnose ports that never got forwarded
+type SessionMetrics struct {
+	EventsProcessed    uint64 `json:"events_processed"` // Port and socket events handled
+	EventsDropped      uint64 `json:"events_dropped"`   // Events sources dropped because the buffer was full
+	PortsFiltered      uint64 `json:"ports_filtered"`
+	PortsIgnored       uint64 `json:"ports_ignored"`
+	HealthChecksFailed uint64 `json:"health_checks_failed"`
+	ForwardsCreated    uint64 `json:"forwards_created"`
+	ForwardsQueued     uint64 `json:"forwards_queued"`
+	ForwardsFailed     uint64 `json:"forwards_failed"`
+	ForwardsRemoved    uint64 `json:"forwards_removed"`
+
+	// What the session monitor is waiting on when the metrics are taken
+	SettlingPorts int `json:"settling_ports"` // Ports waiting for their state to settle
+	ProbingPorts  int `json:"probing_ports"`  // Ports waiting on health checks or protocol detection
+	UDPListeners  int `json:"udp_listeners"`  // Bound UDP ports, which aren't forwarded
+
+	Recent []PortOutcome `json:"recent,omitempty"` // Latest outcomes of opened ports, oldest first
+}
+
+// Metrics returns what the session monitor has done so far
+func (m *SessionMonitor) Metrics() SessionMetrics {
+	m.mutex.RLock()
+	settling, probing, udp := len(m.settling), len(m.probes), len(m.udpListeners)
+	m.mutex.RUnlock()
+
+	m.metricsMu.Lock()
+	defer m.metricsMu.Unlock()
+
+	metrics := m.metrics
+	metrics.SettlingPorts, metrics.ProbingPorts, metrics.UDPListeners = settling, probing, udp
+	metrics.EventsDropped = droppedEvents(m.systemMonitor) + droppedEvents(m.socketSource)
+	metrics.Recent = slices.Clone(m.metrics.Recent)
+	return metrics
+}
+
+// dropCounter is implemented by event sources that drop events when their
+// consumer falls behind and the channel is full
+type dropCounter interface {
+	Dropped() uint64
+}
+
+// droppedEvents returns how many events source has dropped, or 0 for a
+// source that never drops any
+func droppedEvents(source any) uint64 {
+	if c, ok := source.(dropCounter); ok {
+		return c.Dropped()
+	}
+	return 0
+}
+
+// countEvent counts an event the session monitor handled
+func (m *SessionMonitor) countEvent() {
+	m.metricsMu.Lock()
+	defer m.metricsMu.Unlock()
+	m.metrics.EventsProcessed++
+}
+
+// recordOutcome counts what became of a newly opened port and remembers it.
+// Socket forwards, which have no port, are only counted.
+func (m *SessionMonitor) recordOutcome(port int, outcome, detail string) {
+	m.metricsMu.Lock()
+	defer m.metricsMu.Unlock()
+
+	switch outcome {
+	case OutcomeForwarded:
+		m.metrics.ForwardsCreated++
+	case OutcomeQueued:
+		m.metrics.ForwardsQueued++
+	case OutcomeFailed:
+		m.metrics.ForwardsFailed++
+	case OutcomeFiltered:
+		m.metrics.PortsFiltered++
+	case OutcomeIgnored:
+		m.metrics.PortsIgnored++
+	case OutcomeUnhealthy:
+		m.metrics.HealthChecksFailed++
+	}
+	if port == 0 {
+		return
+	}
+
+	m.metrics.Recent = append(m.metrics.Recent, PortOutcome{Port: port, Outcome: outcome, Detail: detail, Time: time.Now()})
+	if len(m.metrics.Recent) > recentOutcomes {
+		m.metrics.Recent = slices.Delete(m.metrics.Recent, 0, len(m.metrics.Recent)-recentOutcomes)
+	}
+}
+
+// countRemoval counts a forward the session monitor removed
+func (m *SessionMonitor) countRemoval() {
+	m.metricsMu.Lock()
+	defer m.metricsMu.Unlock()
+	m.metrics.ForwardsRemoved++
+}
@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+// failingDaemonClient rejects every request
+type failingDaemonClient struct{}
+
+func (failingDaemonClient) SendRequest(req *protocol.Request) (*protocol.Response, error) {
+	return &protocol.Response{Success: false, Error: "no SSH connection"}, nil
+}
+
+func TestSessionMetrics(t *testing.T) {
+	client := &mockDaemonClient{}
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "test",
+		DaemonClient:    client,
+		Logger:          slog.Default(),
+		IgnorePorts:     []int{9229},
+		IgnoreProcesses: []string{"sshd"},
+		PortEventSource: &mockPortEventSource{},
+	})
+	sm.resolveProcessName = func(pid int) string {
+		if pid == 200 {
+			return "sshd"
+		}
+		return "node"
+	}
+	sm.resolveProcessCwd = func(pid int) string { return "" }
+	sm.resolveParentPID = func(pid int) int { return 0 }
+
+	now := time.Now()
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 3000, BindAddr: "127.0.0.1", Timestamp: now})
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 9229, BindAddr: "127.0.0.1", Timestamp: now})
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 8080, BindAddr: "100.99.110.72", Timestamp: now})
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 200, Port: 2222, BindAddr: "127.0.0.1", Timestamp: now})
+	sm.daemonClient = failingDaemonClient{}
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 5173, BindAddr: "127.0.0.1", Timestamp: now})
+
+	m := sm.Metrics()
+	if m.EventsProcessed != 5 || m.ForwardsCreated != 1 || m.ForwardsFailed != 1 || m.PortsFiltered != 2 || m.PortsIgnored != 1 {
+		t.Errorf("metrics = %+v, want 5 processed, 1 created, 1 failed, 2 filtered, 1 ignored", m)
+	}
+
+	want := []struct {
+		port    int
+		outcome string
+		detail  string
+	}{
+		{3000, OutcomeForwarded, "node"},
+		{9229, OutcomeFiltered, "in ignorePorts"},
+		{8080, OutcomeFiltered, "bound to 100.99.110.72"},
+		{2222, OutcomeIgnored, "ignoreProcesses matched sshd"},
+		{5173, OutcomeFailed, "no SSH connection"},
+	}
+	if len(m.Recent) != len(want) {
+		t.Fatalf("recent outcomes = %+v, want %d", m.Recent, len(want))
+	}
+	for i, w := range want {
+		got := m.Recent[i]
+		if got.Port != w.port || got.Outcome != w.outcome || got.Detail != w.detail {
+			t.Errorf("recent[%d] = %d %s %q, want %d %s %q", i, got.Port, got.Outcome, got.Detail, w.port, w.outcome, w.detail)
+		}
+	}
+}
+
+func TestSessionMetricsRecentBounded(t *testing.T) {
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "test",
+		DaemonClient:    &mockDaemonClient{},
+		Logger:          slog.Default(),
+		PortEventSource: &mockPortEventSource{},
+	})
+	for port := 1; port <= recentOutcomes+5; port++ {
+		sm.recordOutcome(port, OutcomeFiltered, "")
+	}
+
+	m := sm.Metrics()
+	if len(m.Recent) != recentOutcomes || m.Recent[0].Port != 6 {
+		t.Errorf("recent outcomes start at port %d with %d kept, want port 6 with %d", m.Recent[0].Port, len(m.Recent), recentOutcomes)
+	}
+	if m.PortsFiltered != recentOutcomes+5 {
+		t.Errorf("ports filtered = %d, want %d", m.PortsFiltered, recentOutcomes+5)
+	}
+}
+
+func TestSessionMetricsDroppedPerSource(t *testing.T) {
+	tcp := NewSystemMonitor(slog.Default(), time.Second)
+	udp := NewUDPMonitor(slog.Default(), time.Second)
+	sockets := NewSocketMonitor(slog.Default(), time.Second, nil)
+	tcp.dropped.Add(2)
+	udp.dropped.Add(1)
+	sockets.dropped.Add(4)
+
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:         "test",
+		DaemonClient:      &mockDaemonClient{},
+		Logger:            slog.Default(),
+		PortEventSource:   mergeSources(1, tcp, udp),
+		SocketEventSource: sockets,
+	})
+	if got := sm.Metrics().EventsDropped; got != 7 {
+		t.Errorf("EventsDropped = %d, want 7 from its own sources", got)
+	}
+
+	// Another session monitor's sources are counted on their own
+	other, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "other",
+		DaemonClient:    &mockDaemonClient{},
+		Logger:          slog.Default(),
+		PortEventSource: NewSystemMonitor(slog.Default(), time.Second),
+	})
+	if got := other.Metrics().EventsDropped; got != 0 {
+		t.Errorf("EventsDropped = %d for a monitor whose source dropped nothing, want 0", got)
+	}
+}
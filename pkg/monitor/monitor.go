@@ -4,6 +4,7 @@ import (
 	"context"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,6 +18,10 @@ type PortEvent struct {
 	ProcessCmd  string
 	ProcessCwd  string
 	BindAddr    string
+	AppProtocol string // What the port speaks (AppProtocolHTTP, ...), when detected
+	Server      string // What an HTTP server calls itself, e.g. "Next.js", when detected
+	Netns       uint64 // Network namespace inode, for ports outside the host's (0 = host)
+	NetnsPID    int    // A process in Netns, to reach the namespace through
 	Timestamp   time.Time
 }
 
@@ -26,6 +31,10 @@ type EventType string
 const (
 	PortOpened EventType = "opened"
 	PortClosed EventType = "closed"
+
+	// ProcessExited reports that the process PID is gone. Only PID and
+	// Timestamp are set; the ports it listened on close with it.
+	ProcessExited EventType = "exited"
 )
 
 // Monitor watches for port changes
@@ -35,6 +44,7 @@ type Monitor struct {
 	debounceTime time.Duration
 	events       chan PortEvent
 	logger       *slog.Logger
+	dropped      atomic.Uint64 // Events dropped because the consumer fell behind
 
 	mu           sync.RWMutex
 	knownPorts   map[int]Port
@@ -52,7 +62,7 @@ func NewWithInterval(pid int, logger *slog.Logger, pollInterval time.Duration) *
 	return &Monitor{
 		pid:          pid,
 		pollInterval: pollInterval,
-		debounceTime: 100 * time.Millisecond,
+		debounceTime: DefaultDebounce,
 		events:       make(chan PortEvent, 10),
 		logger:       logger,
 		knownPorts:   make(map[int]Port),
@@ -92,6 +102,12 @@ func (m *Monitor) Events() <-chan PortEvent {
 	return m.events
 }
 
+// Dropped returns how many events were dropped because the consumer fell
+// behind
+func (m *Monitor) Dropped() uint64 {
+	return m.dropped.Load()
+}
+
 // monitorLoop polls for port changes
 func (m *Monitor) monitorLoop(ctx context.Context) {
 	ticker := time.NewTicker(m.pollInterval)
@@ -160,6 +176,7 @@ func (m *Monitor) checkPorts() {
 				)
 			default:
 				m.logger.Warn("event channel full, dropping closed event")
+				m.dropped.Add(1)
 			}
 		}
 	}
@@ -201,9 +218,16 @@ func (m *Monitor) processPendingPorts() {
 					m.knownPorts[portNum] = port
 					delete(m.pendingPorts, portNum)
 
+					// Report the descendant holding the port, if it can
+					// be found, so rules on the port's owner apply
+					owner := FindSocketOwner(port.Inode)
+					if owner == 0 {
+						owner = m.pid
+					}
+
 					event := PortEvent{
 						Type:      PortOpened,
-						PID:       m.pid,
+						PID:       owner,
 						Port:      port.Port,
 						Protocol:  port.Protocol,
 						BindAddr:  port.BindAddr,
@@ -218,6 +242,7 @@ func (m *Monitor) processPendingPorts() {
 						)
 					default:
 						m.logger.Warn("event channel full, dropping opened event")
+						m.dropped.Add(1)
 					}
 					break
 				}
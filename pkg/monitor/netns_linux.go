@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// NetNamespace is a network namespace other than the host's that one of the
+// user's processes lives in, such as a rootless container's
+type NetNamespace struct {
+	Inode uint64 // Namespace inode, as in /proc/<pid>/ns/net -> net:[<inode>]
+	PID   int    // A process in the namespace, whose /proc/<pid>/net shows its tables
+}
+
+// netNamespaceInode returns the inode of the network namespace pid lives in
+func netNamespaceInode(pid string) (uint64, error) {
+	target, err := os.Readlink(filepath.Join("/proc", pid, "ns", "net"))
+	if err != nil {
+		return 0, err
+	}
+	// Namespace links read "net:[<inode>]"
+	if !strings.HasPrefix(target, "net:[") || !strings.HasSuffix(target, "]") {
+		return 0, fmt.Errorf("unexpected namespace link %q", target)
+	}
+	return strconv.ParseUint(target[len("net:["):len(target)-1], 10, 64)
+}
+
+// UserNetNamespaces returns the network namespaces, other than this
+// process's own, that processes owned by the current user live in
+func UserNetNamespaces() ([]NetNamespace, error) {
+	host, err := netNamespaceInode("self")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read own network namespace: %w", err)
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	uid := uint32(os.Getuid())
+	seen := map[uint64]bool{host: true}
+	var namespaces []NetNamespace
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(filepath.Join("/proc", entry.Name()))
+		if err != nil {
+			continue
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); !ok || stat.Uid != uid {
+			continue
+		}
+		inode, err := netNamespaceInode(entry.Name())
+		if err != nil || seen[inode] {
+			continue
+		}
+		seen[inode] = true
+		namespaces = append(namespaces, NetNamespace{Inode: inode, PID: pid})
+	}
+	return namespaces, nil
+}
+
+// GetNamespaceListeningPorts returns the ports in LISTEN state inside the
+// user's other network namespaces, tagged with the namespace they're in
+func GetNamespaceListeningPorts() ([]Port, error) {
+	namespaces, err := UserNetNamespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var allPorts []Port
+	for _, ns := range namespaces {
+		for _, protocol := range []string{"tcp", "tcp6"} {
+			ports, err := parseProcNet(fmt.Sprintf("/proc/%d/net/%s", ns.PID, protocol), protocol)
+			if err != nil {
+				// The process exited; the namespace is picked up through
+				// another one next time if it's still around
+				continue
+			}
+			for i := range ports {
+				ports[i].Netns = ns.Inode
+				ports[i].NetnsPID = ns.PID
+			}
+			allPorts = append(allPorts, ports...)
+		}
+	}
+	return allPorts, nil
+}
+
+// CanEnterNetNamespaces reports why ports inside other network namespaces
+// can't be relayed, if they can't: entering one takes CAP_SYS_ADMIN, even
+// for a rootless container the user owns
+func CanEnterNetNamespaces() error {
+	if !hasCapability(unix.CAP_SYS_ADMIN) {
+		return errors.New("entering network namespaces needs CAP_SYS_ADMIN (`sudo setcap cap_sys_admin=ep $(command -v bankshot)`)")
+	}
+	return nil
+}
+
+// openNetNamespace opens the network namespace pid lives in. The handle keeps
+// the namespace reachable even after pid exits.
+func openNetNamespace(pid int) (*os.File, error) {
+	return os.Open(fmt.Sprintf("/proc/%d/ns/net", pid))
+}
+
+// dialInNamespace connects to addr from inside the network namespace ns.
+// setns applies to a single thread, so the dial runs on a locked thread of
+// its own that is thrown away afterwards instead of being returned to the
+// scheduler still inside the namespace. The connection stays in the
+// namespace it was created in.
+func dialInNamespace(ns *os.File, addr string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// Deliberately never unlocked: the thread exits with the goroutine
+		runtime.LockOSThread()
+		if err := unix.Setns(int(ns.Fd()), unix.CLONE_NEWNET); err != nil {
+			done <- result{err: fmt.Errorf("failed to enter network namespace: %w", err)}
+			return
+		}
+		conn, err := net.Dial("tcp", addr)
+		done <- result{conn: conn, err: err}
+	}()
+	r := <-done
+	return r.conn, r.err
+}
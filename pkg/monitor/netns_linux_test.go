@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestUserNetNamespacesSkipsHost(t *testing.T) {
+	host, err := netNamespaceInode("self")
+	if err != nil {
+		t.Skipf("can't read own network namespace: %v", err)
+	}
+
+	namespaces, err := UserNetNamespaces()
+	if err != nil {
+		t.Fatalf("UserNetNamespaces failed: %v", err)
+	}
+	for _, ns := range namespaces {
+		if ns.Inode == host {
+			t.Errorf("expected the host namespace to be skipped, got %+v", ns)
+		}
+	}
+}
+
+func TestNamespaceRelay(t *testing.T) {
+	// The "namespace" is our own, with the listener on 127.0.0.2 so it's
+	// told apart from the relay
+	upstream, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("can't listen on 127.0.0.2: %v", err)
+	}
+	defer func() { _ = upstream.Close() }()
+	port := upstream.Addr().(*net.TCPAddr).Port
+
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				_, _ = conn.Write([]byte("echo: " + line))
+			}()
+		}
+	}()
+
+	relay, err := startNamespaceRelay(slog.Default(), PortEvent{
+		Port:     port,
+		BindAddr: "127.0.0.2",
+		Netns:    1,
+		NetnsPID: os.Getpid(),
+	})
+	if err != nil {
+		t.Fatalf("startNamespaceRelay failed: %v", err)
+	}
+	defer relay.stop()
+
+	// Entering a namespace, even our own, needs CAP_SYS_ADMIN
+	probe, err := dialInNamespace(relay.ns, upstream.Addr().String())
+	if errors.Is(err, unix.EPERM) {
+		t.Skipf("can't enter network namespaces: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("dialInNamespace failed: %v", err)
+	}
+	_ = probe.Close()
+
+	if relay.port == port {
+		t.Errorf("relay listens on the namespace's port %d, want one of its own", port)
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(relay.port)))
+	if err != nil {
+		t.Fatalf("failed to connect to relay: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read relayed reply: %v", err)
+	}
+	if reply != "echo: hello\n" {
+		t.Errorf("reply = %q, want %q", reply, "echo: hello\n")
+	}
+}
@@ -0,0 +1,44 @@
+//go:build !linux
+
+package monitor
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// errNoNetNamespaces is returned where network namespaces don't exist
+var errNoNetNamespaces = errors.New("network namespaces are only supported on Linux")
+
+// NetNamespace is a network namespace other than the host's that one of the
+// user's processes lives in, such as a rootless container's
+type NetNamespace struct {
+	Inode uint64
+	PID   int
+}
+
+// UserNetNamespaces returns an error: there are no network namespaces here
+func UserNetNamespaces() ([]NetNamespace, error) {
+	return nil, errNoNetNamespaces
+}
+
+// GetNamespaceListeningPorts returns an error: there are no network
+// namespaces here
+func GetNamespaceListeningPorts() ([]Port, error) {
+	return nil, errNoNetNamespaces
+}
+
+// CanEnterNetNamespaces returns an error: there are no network namespaces
+// here
+func CanEnterNetNamespaces() error {
+	return errNoNetNamespaces
+}
+
+func openNetNamespace(pid int) (*os.File, error) {
+	return nil, errNoNetNamespaces
+}
+
+func dialInNamespace(ns *os.File, addr string) (net.Conn, error) {
+	return nil, errNoNetNamespaces
+}
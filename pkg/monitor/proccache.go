@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+)
+
+// processCacheTTL bounds how long a PID's process info is reused, so a
+// recycled PID is soon looked up again
+const processCacheTTL = 30 * time.Second
+
+// processCacheSize caps how many PIDs are cached at once
+const processCacheSize = 256
+
+// processInfo is what's known about the process behind a port event
+type processInfo struct {
+	name     string
+	cmdline  string
+	cachedAt time.Time
+}
+
+// processCache resolves and remembers process names and command lines by
+// PID. Keeping them briefly lets a port's close event, which often arrives
+// as its process exits, carry the same process info as its open event.
+type processCache struct {
+	mu             sync.Mutex
+	entries        map[int]processInfo
+	now            func() time.Time
+	resolveName    func(pid int) string // defaults to ResolveProcessName
+	resolveCmdline func(pid int) string // defaults to ResolveProcessCmdline
+}
+
+// newProcessCache creates an empty cache resolving from /proc
+func newProcessCache() *processCache {
+	return &processCache{
+		entries:        make(map[int]processInfo),
+		now:            time.Now,
+		resolveName:    ResolveProcessName,
+		resolveCmdline: ResolveProcessCmdline,
+	}
+}
+
+// lookup returns the name and command line of pid, resolving them unless
+// they were cached recently. Processes that can't be resolved aren't cached.
+func (c *processCache) lookup(pid int) (name, cmdline string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if info, ok := c.entries[pid]; ok && now.Sub(info.cachedAt) < processCacheTTL {
+		return info.name, info.cmdline
+	}
+
+	name = c.resolveName(pid)
+	cmdline = c.resolveCmdline(pid)
+	if name == "" {
+		delete(c.entries, pid)
+		return "", ""
+	}
+
+	if len(c.entries) >= processCacheSize {
+		c.prune(now)
+	}
+	c.entries[pid] = processInfo{name: name, cmdline: cmdline, cachedAt: now}
+	return name, cmdline
+}
+
+// prune drops expired entries, or every entry if none had expired, to make
+// room. Must be called with c.mu held.
+func (c *processCache) prune(now time.Time) {
+	for pid, info := range c.entries {
+		if now.Sub(info.cachedAt) >= processCacheTTL {
+			delete(c.entries, pid)
+		}
+	}
+	if len(c.entries) >= processCacheSize {
+		c.entries = make(map[int]processInfo)
+	}
+}
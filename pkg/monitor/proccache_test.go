@@ -0,0 +1,53 @@
+package monitor
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessCache(t *testing.T) {
+	now := time.Unix(1000, 0)
+	lookups := 0
+	names := map[int]string{42: "vite"}
+
+	c := newProcessCache()
+	c.now = func() time.Time { return now }
+	c.resolveName = func(pid int) string {
+		lookups++
+		return names[pid]
+	}
+	c.resolveCmdline = func(pid int) string { return names[pid] + " --port 5173" }
+
+	if name, cmd := c.lookup(42); name != "vite" || cmd != "vite --port 5173" {
+		t.Fatalf("lookup(42) = %q, %q", name, cmd)
+	}
+
+	// The process exits, but its info is still cached for the close event
+	delete(names, 42)
+	if name, _ := c.lookup(42); name != "vite" || lookups != 1 {
+		t.Errorf("expected cached name without a second lookup, got %q after %d lookups", name, lookups)
+	}
+
+	// Once expired, the PID is resolved again (and may have been recycled)
+	now = now.Add(processCacheTTL)
+	names[42] = "node"
+	if name, _ := c.lookup(42); name != "node" {
+		t.Errorf("expected expired entry to be re-resolved, got %q", name)
+	}
+
+	// Unresolvable processes aren't cached
+	if name, _ := c.lookup(7); name != "" || len(c.entries) != 1 {
+		t.Errorf("expected no entry for an unknown PID, got %q with %d entries", name, len(c.entries))
+	}
+}
+
+func TestResolveProcessCmdline(t *testing.T) {
+	if _, err := os.Stat("/proc/self/cmdline"); err != nil {
+		t.Skip("no /proc on this platform")
+	}
+	if cmd := ResolveProcessCmdline(os.Getpid()); !strings.HasPrefix(cmd, os.Args[0]) {
+		t.Errorf("expected this test binary's command line, got %q", cmd)
+	}
+}
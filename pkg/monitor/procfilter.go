@@ -0,0 +1,205 @@
+package monitor
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// cmdlinePrefix marks a process rule that matches the full command line
+// instead of the process name, e.g. "cmdline:/--inspect/"
+const cmdlinePrefix = "cmdline:"
+
+// processMatcher matches a process name, or its full command line for
+// "cmdline:" entries, by either substring or regexp. Entries wrapped in
+// /slashes/ are compiled as regexps; others use case-insensitive substring
+// matching.
+type processMatcher struct {
+	pattern string         // original pattern string (for logging)
+	cmdline bool           // match the command line rather than the name
+	re      *regexp.Regexp // non-nil for /regex/ patterns
+	substr  string         // lowercased substring for plain patterns
+}
+
+func (pm processMatcher) matches(name, cmdline string) bool {
+	target := name
+	if pm.cmdline {
+		target = cmdline
+	}
+	if pm.re != nil {
+		return pm.re.MatchString(target)
+	}
+	return strings.Contains(strings.ToLower(target), pm.substr)
+}
+
+// compileProcessMatchers compiles process rules: /pattern/ entries become
+// case-insensitive regexps, plain strings use substring matching. Empty
+// rules, which would match everything, are skipped.
+func compileProcessMatchers(patterns []string, logger *slog.Logger) []processMatcher {
+	matchers := make([]processMatcher, 0, len(patterns))
+	for _, p := range patterns {
+		pm := processMatcher{pattern: p}
+		expr := p
+		if strings.HasPrefix(expr, cmdlinePrefix) {
+			pm.cmdline = true
+			expr = strings.TrimPrefix(expr, cmdlinePrefix)
+		}
+		if expr == "" {
+			logger.Warn("Ignoring empty process rule", "pattern", p)
+			continue
+		}
+		if strings.HasPrefix(expr, "/") && strings.HasSuffix(expr, "/") && len(expr) > 2 {
+			expr = expr[1 : len(expr)-1]
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				logger.Warn("Invalid process regexp, falling back to substring",
+					"pattern", p, "error", err)
+				pm.substr = strings.ToLower(expr)
+			} else {
+				pm.re = re
+			}
+		} else {
+			pm.substr = strings.ToLower(expr)
+		}
+		matchers = append(matchers, pm)
+	}
+	return matchers
+}
+
+// needsCmdline reports whether any matcher looks at the command line
+func needsCmdline(matchers []processMatcher) bool {
+	for _, pm := range matchers {
+		if pm.cmdline {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny checks if a process matches one of matchers, without looking
+// at its ancestors
+func matchesAny(matchers []processMatcher, name, cmdline string) bool {
+	for _, pm := range matchers {
+		if pm.matches(name, cmdline) {
+			return true
+		}
+	}
+	return false
+}
+
+// processTree resolves process details, and is replaced in tests so they
+// don't touch /proc
+type processTree struct {
+	name    func(pid int) string
+	cmdline func(pid int) string
+	parent  func(pid int) int
+}
+
+// hostProcessTree resolves processes through /proc
+var hostProcessTree = processTree{
+	name:    ResolveProcessName,
+	cmdline: ResolveProcessCmdline,
+	parent:  ResolveParentPID,
+}
+
+// match checks if the process or any of its ancestors match one of
+// matchers. It first checks the given name and command line, then walks the
+// process tree upward, resolving each ancestor's name (and command line, if a
+// matcher needs it). Stops at PID <= 1 or after 16 levels. Returns the name
+// of the matching process.
+func (t processTree) match(matchers []processMatcher, pid int, name, cmdline string) (bool, string) {
+	matchAny := func(name, cmdline string) bool {
+		return matchesAny(matchers, name, cmdline)
+	}
+
+	// Check the process itself first
+	if matchAny(name, cmdline) {
+		return true, name
+	}
+
+	// Walk up the process tree
+	withCmdline := needsCmdline(matchers)
+	currentPID := pid
+	for depth := 0; depth < 16; depth++ {
+		parentPID := t.parent(currentPID)
+		if parentPID <= 1 {
+			break
+		}
+		parentName := t.name(parentPID)
+		if parentName == "" {
+			break
+		}
+		var parentCmd string
+		if withCmdline {
+			parentCmd = t.cmdline(parentPID)
+		}
+		if matchAny(parentName, parentCmd) {
+			return true, parentName
+		}
+		currentPID = parentPID
+	}
+
+	return false, ""
+}
+
+// ProcessFilter applies ignoreProcesses, allowProcesses, and
+// neverForwardProcesses rules to the process owning a port, for callers
+// outside a SessionMonitor such as reconciliation and wrap
+type ProcessFilter struct {
+	ignore []processMatcher
+	allow  []processMatcher
+	never  []processMatcher
+	tree   processTree
+	logger *slog.Logger
+}
+
+// NewProcessFilter compiles ignore and allow rules, in the same syntax as
+// SessionConfig.IgnoreProcesses and AllowProcesses
+func NewProcessFilter(ignoreProcesses, allowProcesses []string, logger *slog.Logger) *ProcessFilter {
+	return &ProcessFilter{
+		ignore: compileProcessMatchers(ignoreProcesses, logger),
+		allow:  compileProcessMatchers(allowProcesses, logger),
+		tree:   hostProcessTree,
+		logger: logger,
+	}
+}
+
+// WithNeverForward also rejects ports owned by processes matching
+// neverForwardProcesses, in the syntax of SessionConfig.NeverForwardProcesses
+func (f *ProcessFilter) WithNeverForward(neverForwardProcesses []string) *ProcessFilter {
+	f.never = compileProcessMatchers(neverForwardProcesses, f.logger)
+	return f
+}
+
+// AllowlistMode reports whether only ports of allowed processes are
+// forwarded
+func (f *ProcessFilter) AllowlistMode() bool {
+	return len(f.allow) > 0
+}
+
+// Allows reports whether ports owned by pid may be forwarded. An unknown
+// owner (pid 0) passes the ignore rules but not an allowlist.
+func (f *ProcessFilter) Allows(pid int) bool {
+	if pid == 0 {
+		return !f.AllowlistMode()
+	}
+
+	name := f.tree.name(pid)
+	var cmdline string
+	if needsCmdline(f.ignore) || needsCmdline(f.allow) || needsCmdline(f.never) {
+		cmdline = f.tree.cmdline(pid)
+	}
+	if matchesAny(f.never, name, cmdline) {
+		return false
+	}
+	if len(f.ignore) > 0 {
+		if ignored, _ := f.tree.match(f.ignore, pid, name, cmdline); ignored {
+			return false
+		}
+	}
+	if f.AllowlistMode() {
+		allowed, _ := f.tree.match(f.allow, pid, name, cmdline)
+		return allowed
+	}
+	return true
+}
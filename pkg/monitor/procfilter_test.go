@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestProcessFilterAllows(t *testing.T) {
+	names := map[int]string{100: "node", 200: "postgres", 300: "tmux"}
+	cmdlines := map[int]string{100: "node server.js", 200: "postgres -D /var/lib/pg", 300: "tmux new -s dev"}
+	parents := map[int]int{100: 300}
+	tree := processTree{
+		name:    func(pid int) string { return names[pid] },
+		cmdline: func(pid int) string { return cmdlines[pid] },
+		parent:  func(pid int) int { return parents[pid] },
+	}
+
+	tests := []struct {
+		name   string
+		ignore []string
+		allow  []string
+		never  []string
+		pid    int
+		want   bool
+	}{
+		{name: "no rules", pid: 200, want: true},
+		{name: "ignored by name", ignore: []string{"postgres"}, pid: 200, want: false},
+		{name: "ignored by cmdline", ignore: []string{"cmdline:/-D /var/"}, pid: 200, want: false},
+		{name: "unknown owner passes ignore rules", ignore: []string{"postgres"}, pid: 0, want: true},
+		{name: "allowed", allow: []string{"node"}, pid: 100, want: true},
+		{name: "allowed through ancestor", allow: []string{"cmdline:tmux new"}, pid: 100, want: true},
+		{name: "not allowed", allow: []string{"node"}, pid: 200, want: false},
+		{name: "unknown owner fails allowlist", allow: []string{"node"}, pid: 0, want: false},
+		{name: "ignore wins over allow", ignore: []string{"node"}, allow: []string{"node"}, pid: 100, want: false},
+		{name: "never forwarded", never: []string{"postgres"}, pid: 200, want: false},
+		{name: "never forwarded wins over allow", allow: []string{"postgres"}, never: []string{"/^postgres$/"}, pid: 200, want: false},
+		{name: "never forwarded only matches the owner", never: []string{"tmux"}, pid: 100, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewProcessFilter(tt.ignore, tt.allow, slog.Default()).WithNeverForward(tt.never)
+			f.tree = tree
+			if got := f.Allows(tt.pid); got != tt.want {
+				t.Errorf("Allows(%d) = %v, want %v", tt.pid, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSocketOwners(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires /proc")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	ports, err := GetListeningPorts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inode uint64
+	for _, p := range ports {
+		if p.Port == port {
+			inode = p.Inode
+		}
+	}
+	if inode == 0 {
+		t.Fatalf("listener on port %d not found", port)
+	}
+
+	if got := FindSocketOwner(inode); got != os.Getpid() {
+		t.Errorf("FindSocketOwner() = %d, want %d", got, os.Getpid())
+	}
+}
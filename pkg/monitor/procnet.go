@@ -14,13 +14,22 @@ import (
 // Port represents a network port binding
 type Port struct {
 	Port     int
-	Protocol string // "tcp" or "tcp6"
+	Protocol string // "tcp", "tcp6", "udp", or "udp6"
 	State    string // Connection state
 	BindAddr string // Bind address (e.g. "0.0.0.0", "127.0.0.1", "::1")
+	Inode    uint64 // Socket inode, for matching the socket to the process holding it
+	Netns    uint64 // Network namespace inode, for ports outside the host's (0 = host)
+	NetnsPID int    // A process in Netns, to reach the namespace through
 }
 
 // parseProcNet parses /proc/net/tcp or /proc/net/tcp6 files
 func parseProcNet(path string, protocol string) ([]Port, error) {
+	return parseProcNetState(path, protocol, "LISTEN")
+}
+
+// parseProcNetState parses /proc/net/{tcp,udp}{,6} files, returning the
+// local ports of sockets in the given state
+func parseProcNetState(path string, protocol string, want string) ([]Port, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -65,13 +74,17 @@ func parseProcNet(path string, protocol string) ([]Port, error) {
 		stateHex := fields[3]
 		state := parseState(stateHex)
 
-		// We're only interested in LISTEN state for port forwarding
-		if state == "LISTEN" {
+		if state == want {
+			var inode uint64
+			if len(fields) > 9 {
+				inode, _ = strconv.ParseUint(fields[9], 10, 64)
+			}
 			ports = append(ports, Port{
 				Port:     int(portNum),
 				Protocol: protocol,
 				State:    state,
 				BindAddr: bindAddr,
+				Inode:    inode,
 			})
 		}
 	}
@@ -101,41 +114,84 @@ func parseState(hexState string) string {
 	return "UNKNOWN"
 }
 
-// GetListeningPorts returns all ports in LISTEN state
-func GetListeningPorts() ([]Port, error) {
+// GetUDPPorts returns the UDP ports bound by unconnected sockets, the UDP
+// equivalent of a listener. The kernel reports these in the CLOSE state;
+// connected sockets (e.g. a resolver's query socket) are ESTABLISHED and are
+// left out.
+func GetUDPPorts() ([]Port, error) {
 	var allPorts []Port
 
-	// Parse TCP ports
-	tcpPorts, err := parseProcNet("/proc/net/tcp", "tcp")
+	udpPorts, err := parseProcNetState("/proc/net/udp", "udp", "CLOSE")
 	if err == nil {
-		allPorts = append(allPorts, tcpPorts...)
+		allPorts = append(allPorts, udpPorts...)
 	}
 
-	// Parse TCP6 ports
-	tcp6Ports, err := parseProcNet("/proc/net/tcp6", "tcp6")
+	udp6Ports, err := parseProcNetState("/proc/net/udp6", "udp6", "CLOSE")
 	if err == nil {
-		allPorts = append(allPorts, tcp6Ports...)
+		allPorts = append(allPorts, udp6Ports...)
 	}
 
 	return allPorts, nil
 }
 
-// parseHexAddr decodes the hex IP address from /proc/net/tcp{,6} format.
-// IPv4 (/proc/net/tcp): 8 hex chars, little-endian 32-bit integer.
-// IPv6 (/proc/net/tcp6): 32 hex chars, four little-endian 32-bit words.
+// IsUDP reports whether protocol is one of the UDP protocols reported by
+// GetUDPPorts. ssh only forwards TCP, so UDP ports are never forwarded.
+func IsUDP(protocol string) bool {
+	return protocol == "udp" || protocol == "udp6"
+}
+
+// GetEstablishedPorts returns the local ports with at least one ESTABLISHED
+// connection, i.e. ports something is actively talking to
+func GetEstablishedPorts() (map[int]bool, error) {
+	established, err := GetEstablishedSockets()
+	if err != nil {
+		return nil, err
+	}
+	ports := make(map[int]bool)
+	for _, port := range established {
+		ports[port.Port] = true
+	}
+	return ports, nil
+}
+
+// GetEstablishedSockets returns the TCP sockets with an ESTABLISHED
+// connection, by their local end
+func GetEstablishedSockets() ([]Port, error) {
+	var sockets []Port
+	found := false
+	for _, source := range []struct{ path, protocol string }{
+		{"/proc/net/tcp", "tcp"},
+		{"/proc/net/tcp6", "tcp6"},
+	} {
+		established, err := parseProcNetState(source.path, source.protocol, "ESTABLISHED")
+		if err != nil {
+			continue
+		}
+		found = true
+		sockets = append(sockets, established...)
+	}
+	if !found {
+		return nil, fmt.Errorf("failed to read connection tables from /proc/net")
+	}
+	return sockets, nil
+}
+
+// parseHexAddr decodes the hex IP address from /proc/net/{tcp,udp}{,6} format.
+// IPv4 (/proc/net/tcp, udp): 8 hex chars, little-endian 32-bit integer.
+// IPv6 (/proc/net/tcp6, udp6): 32 hex chars, four little-endian 32-bit words.
 func parseHexAddr(hexStr string, protocol string) string {
 	b, err := hex.DecodeString(hexStr)
 	if err != nil {
 		return ""
 	}
 
-	if protocol == "tcp" && len(b) == 4 {
+	if (protocol == "tcp" || protocol == "udp") && len(b) == 4 {
 		// IPv4: stored as little-endian 32-bit, so bytes are reversed
 		ip := net.IPv4(b[3], b[2], b[1], b[0])
 		return ip.String()
 	}
 
-	if protocol == "tcp6" && len(b) == 16 {
+	if (protocol == "tcp6" || protocol == "udp6") && len(b) == 16 {
 		// IPv6: four groups of little-endian 32-bit words
 		ip := make(net.IP, 16)
 		for i := 0; i < 4; i++ {
@@ -186,6 +242,17 @@ func ResolveProcessName(pid int) string {
 	return strings.TrimSpace(string(data))
 }
 
+// ResolveProcessCmdline returns the full command line for a given PID, its
+// arguments joined with spaces. Returns empty string if the process is gone,
+// unreadable, or a kernel thread.
+func ResolveProcessCmdline(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(strings.TrimRight(string(data), "\x00"), "\x00", " "))
+}
+
 // ResolveParentPID returns the parent PID for a given PID by reading PPid from
 // /proc/<pid>/status. Returns 0 if the process is gone, unreadable, or at init.
 func ResolveParentPID(pid int) int {
@@ -218,31 +285,57 @@ func ResolveProcessCwd(pid int) string {
 	return cwd
 }
 
-// GetProcessListeningPorts returns ports for a specific process
-func GetProcessListeningPorts(pid int) ([]Port, error) {
-	var allPorts []Port
-
-	// Try process-specific network namespace
-	tcpPath := fmt.Sprintf("/proc/%d/net/tcp", pid)
-	tcpPorts, err := parseProcNet(tcpPath, "tcp")
-	if err == nil {
-		allPorts = append(allPorts, tcpPorts...)
-	} else {
-		// Fallback to system-wide if process-specific fails
-		// This will cause duplicates but they'll be filtered at a higher level
-		tcpPorts, _ = parseProcNet("/proc/net/tcp", "tcp")
-		allPorts = append(allPorts, tcpPorts...)
+// FindSocketOwner returns the PID of a process holding the socket with the
+// given inode, found by scanning /proc/<pid>/fd for "socket:[<inode>]".
+// Returns 0 if no readable process holds it, as for other users' processes.
+func FindSocketOwner(inode uint64) int {
+	if inode == 0 {
+		return 0
 	}
+	return SocketOwners()[inode]
+}
 
-	// Same for TCP6
-	tcp6Path := fmt.Sprintf("/proc/%d/net/tcp6", pid)
-	tcp6Ports, err := parseProcNet(tcp6Path, "tcp6")
-	if err == nil {
-		allPorts = append(allPorts, tcp6Ports...)
-	} else {
-		tcp6Ports, _ = parseProcNet("/proc/net/tcp6", "tcp6")
-		allPorts = append(allPorts, tcp6Ports...)
+// SocketOwners maps the inode of every socket held by a readable process to
+// that process's PID, for looking up the owners of many ports in one scan
+func SocketOwners() map[uint64]int {
+	owners := make(map[uint64]int)
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return owners
 	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		for _, inode := range socketInodes(pid) {
+			if _, seen := owners[inode]; !seen {
+				owners[inode] = pid
+			}
+		}
+	}
+	return owners
+}
 
-	return allPorts, nil
+// socketInodes returns the inodes of the sockets a process holds, found in
+// /proc/<pid>/fd as "socket:[<inode>]" links
+func socketInodes(pid int) []uint64 {
+	fdDir := filepath.Join("/proc", strconv.Itoa(pid), "fd")
+	fds, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil
+	}
+	var inodes []uint64
+	for _, fd := range fds {
+		link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+		if err != nil || !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+			continue
+		}
+		inode, err := strconv.ParseUint(link[len("socket:["):len(link)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+		inodes = append(inodes, inode)
+	}
+	return inodes
 }
@@ -42,6 +42,9 @@ func TestParseProcNet(t *testing.T) {
 		if port.Protocol != "tcp" {
 			t.Errorf("Expected tcp protocol, got %s", port.Protocol)
 		}
+		if port.Port == 8080 && port.Inode != 12346 {
+			t.Errorf("Expected inode 12346 for port 8080, got %d", port.Inode)
+		}
 		if _, ok := expectedPorts[port.Port]; ok {
 			expectedPorts[port.Port] = true
 		} else {
@@ -57,6 +60,30 @@ func TestParseProcNet(t *testing.T) {
 	}
 }
 
+func TestParseProcNetEstablished(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "tcp")
+
+	// A listener on 8080 with one accepted connection (local 8080) and the
+	// client end of it (local 9000)
+	testData := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 12346 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 0100007F:2328 01 00000000:00000000 00:00000000 00000000  1000        0 12347 1 0000000000000000 100 0 0 10 0
+   2: 0100007F:2328 0100007F:1F90 01 00000000:00000000 00:00000000 00000000  1000        0 12348 1 0000000000000000 100 0 0 10 0`
+
+	if err := os.WriteFile(testFile, []byte(testData), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ports, err := parseProcNetState(testFile, "tcp", "ESTABLISHED")
+	if err != nil {
+		t.Fatalf("parseProcNetState failed: %v", err)
+	}
+	if len(ports) != 2 || ports[0].Port != 8080 || ports[1].Port != 9000 {
+		t.Errorf("parseProcNetState() = %+v, want established ports 8080 and 9000", ports)
+	}
+}
+
 func TestParseState(t *testing.T) {
 	tests := []struct {
 		hexState string
@@ -75,3 +102,33 @@ func TestParseState(t *testing.T) {
 		}
 	}
 }
+
+func TestParseProcNetUDP(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "udp")
+
+	// A bound socket on 5353 (state 07, unconnected) and a resolver's
+	// connected query socket (state 01)
+	testData := `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  100: 00000000:14E9 00000000:0000 07 00000000:00000000 00:00000000 00000000  1000        0 22345 2 0000000000000000 0
+  101: 0100007F:C350 0100007F:0035 01 00000000:00000000 00:00000000 00000000  1000        0 22346 2 0000000000000000 0`
+
+	if err := os.WriteFile(testFile, []byte(testData), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ports, err := parseProcNetState(testFile, "udp", "CLOSE")
+	if err != nil {
+		t.Fatalf("parseProcNetState failed: %v", err)
+	}
+
+	if len(ports) != 1 {
+		t.Fatalf("Expected 1 bound port, got %d: %+v", len(ports), ports)
+	}
+	if ports[0].Port != 5353 || ports[0].Protocol != "udp" || ports[0].BindAddr != "0.0.0.0" {
+		t.Errorf("Expected udp 0.0.0.0:5353, got %+v", ports[0])
+	}
+	if ports[0].Inode != 22345 {
+		t.Errorf("Expected inode 22345, got %d", ports[0].Inode)
+	}
+}
@@ -0,0 +1,19 @@
+package monitor
+
+// descendantsOf walks a parent -> children map from pid. PIDs are reused and
+// a parent can outlive its ID, so cycles are guarded against.
+func descendantsOf(pid int, children map[int][]int) map[int]bool {
+	tree := map[int]bool{pid: true}
+	queue := []int{pid}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, child := range children[current] {
+			if !tree[child] {
+				tree[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+	return tree
+}
@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// processTreeSource passes on the events of a system-wide source, like the
+// eBPF monitor, that belong to a process and its descendants
+type processTreeSource struct {
+	pid    int
+	source PortEventSource
+	events chan PortEvent
+	logger *slog.Logger
+}
+
+// newProcessTreeSource scopes source to the process tree rooted at pid
+func newProcessTreeSource(pid int, source PortEventSource, logger *slog.Logger) *processTreeSource {
+	return &processTreeSource{
+		pid:    pid,
+		source: source,
+		events: make(chan PortEvent, DefaultEventBuffer),
+		logger: logger,
+	}
+}
+
+// Start starts the underlying source, filtering its events as they arrive
+func (s *processTreeSource) Start(ctx context.Context) error {
+	// Filter before starting, since sources may emit their initial ports
+	// from Start
+	go s.filter()
+	return s.source.Start(ctx)
+}
+
+// Events returns the channel of the tree's port events
+func (s *processTreeSource) Events() <-chan PortEvent {
+	return s.events
+}
+
+// SetPollRanges passes ranges on to the underlying source
+func (s *processTreeSource) SetPollRanges(ranges []PortRange) {
+	setPollRanges(s.source, ranges)
+}
+
+// Dropped returns how many events the underlying source dropped
+func (s *processTreeSource) Dropped() uint64 {
+	return droppedEvents(s.source)
+}
+
+// filter passes on opens of the tree's ports and the closes that follow
+func (s *processTreeSource) filter() {
+	defer close(s.events)
+
+	open := make(map[string]bool)
+	for event := range s.source.Events() {
+		key := fmt.Sprintf("%d:%s", event.Port, event.Protocol)
+		switch event.Type {
+		case PortOpened:
+			if !s.owns(event) {
+				s.logger.Debug("ignoring port outside process tree",
+					"port", event.Port,
+					"pid", event.PID,
+					"root", s.pid)
+				continue
+			}
+			open[key] = true
+		case PortClosed:
+			if !open[key] {
+				continue
+			}
+			delete(open, key)
+		default:
+			continue
+		}
+		s.events <- event
+	}
+}
+
+// owns reports whether a newly opened port belongs to the tree: by the PID
+// that opened it when the source knows it, else by the sockets the tree's
+// processes hold, as for ports already open when the source started
+func (s *processTreeSource) owns(event PortEvent) bool {
+	if event.PID != 0 {
+		tree, err := processDescendants(s.pid)
+		return err == nil && tree[event.PID]
+	}
+	ports, err := GetProcessListeningPorts(s.pid)
+	if err != nil {
+		return false
+	}
+	for _, p := range ports {
+		if p.Port == event.Port && p.Protocol == event.Protocol {
+			return true
+		}
+	}
+	return false
+}
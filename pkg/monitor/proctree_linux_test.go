@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetProcessListeningPortsTree(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	child := exec.Command("sleep", "30")
+	if err := child.Start(); err != nil {
+		t.Skipf("can't start child process: %v", err)
+	}
+	defer func() {
+		_ = child.Process.Kill()
+		_ = child.Wait()
+	}()
+
+	hasPort := func(pid int) bool {
+		ports, err := GetProcessListeningPorts(pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return slices.ContainsFunc(ports, func(p Port) bool { return p.Port == port })
+	}
+
+	// Our port belongs to us and to every process we descend from, like
+	// a dev server's port to the npm run dev that started it
+	if !hasPort(os.Getpid()) {
+		t.Errorf("port %d not among this process's ports", port)
+	}
+	if !hasPort(os.Getppid()) {
+		t.Errorf("port %d not among the parent process's ports", port)
+	}
+	if hasPort(child.Process.Pid) {
+		t.Errorf("port %d among the ports of a child that doesn't hold it", port)
+	}
+
+	tree, err := processDescendants(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tree[child.Process.Pid] {
+		t.Errorf("child %d missing from process tree", child.Process.Pid)
+	}
+}
+
+// stubPortEventSource emits a fixed list of events
+type stubPortEventSource struct {
+	events chan PortEvent
+}
+
+func (s *stubPortEventSource) Start(ctx context.Context) error { return nil }
+func (s *stubPortEventSource) Events() <-chan PortEvent        { return s.events }
+
+func TestProcessTreeSource(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	now := time.Now()
+	events := []PortEvent{
+		{Type: PortOpened, PID: os.Getpid(), Port: 3000, Protocol: "tcp", Timestamp: now},
+		{Type: PortOpened, PID: 1, Port: 5432, Protocol: "tcp", Timestamp: now},
+		{Type: PortOpened, Port: port, Protocol: "tcp", Timestamp: now}, // already open at start, owner unknown
+		{Type: PortClosed, Port: 5432, Protocol: "tcp", Timestamp: now},
+		{Type: PortClosed, Port: 3000, Protocol: "tcp", Timestamp: now},
+	}
+	stub := &stubPortEventSource{events: make(chan PortEvent, len(events))}
+	for _, event := range events {
+		stub.events <- event
+	}
+	close(stub.events)
+
+	source := newProcessTreeSource(os.Getpid(), stub, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := source.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []PortEvent
+	for event := range source.Events() {
+		got = append(got, event)
+	}
+	want := []struct {
+		eventType EventType
+		port      int
+	}{
+		{PortOpened, 3000},
+		{PortOpened, port},
+		{PortClosed, 3000},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("events = %+v, want %d", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Type != w.eventType || got[i].Port != w.port {
+			t.Errorf("event %d = %s %d, want %s %d", i, got[i].Type, got[i].Port, w.eventType, w.port)
+		}
+	}
+}
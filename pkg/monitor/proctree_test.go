@@ -0,0 +1,23 @@
+package monitor
+
+import "testing"
+
+func TestDescendantsOf(t *testing.T) {
+	children := map[int][]int{
+		10: {11, 12},
+		11: {13},
+		20: {21},
+		13: {10}, // reused PID pointing back up the tree
+	}
+	tree := descendantsOf(10, children)
+	for _, pid := range []int{10, 11, 12, 13} {
+		if !tree[pid] {
+			t.Errorf("pid %d missing from tree", pid)
+		}
+	}
+	for _, pid := range []int{20, 21} {
+		if tree[pid] {
+			t.Errorf("pid %d unexpectedly in tree", pid)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// namespaceRelay makes a port listening inside another network namespace
+// reachable on the host's loopback, where ssh forwards connect to. Each
+// connection accepted on the host is dialed through to the port from inside
+// the namespace.
+type namespaceRelay struct {
+	listener net.Listener
+	port     int    // Host port the relay listens on
+	target   string // address dialed inside the namespace
+	logger   *slog.Logger
+
+	mu sync.RWMutex // held for reading while dialing through ns
+	ns *os.File     // nil once stopped
+}
+
+// startNamespaceRelay starts relaying a free port on the host's 127.0.0.1
+// to the port event's listener inside its namespace. The host port is one
+// of the relay's own, as the same port may be listening in other
+// namespaces, or on the host, too.
+func startNamespaceRelay(logger *slog.Logger, event PortEvent) (*namespaceRelay, error) {
+	ns, err := openNetNamespace(event.NetnsPID)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		_ = ns.Close()
+		return nil, err
+	}
+
+	r := &namespaceRelay{
+		listener: listener,
+		port:     listener.Addr().(*net.TCPAddr).Port,
+		ns:       ns,
+		target:   net.JoinHostPort(namespaceDialAddr(event.BindAddr), strconv.Itoa(event.Port)),
+		logger:   logger,
+	}
+	go r.serve()
+	return r, nil
+}
+
+// namespaceDialAddr returns the address to reach a listener bound to
+// bindAddr from inside its own namespace
+func namespaceDialAddr(bindAddr string) string {
+	switch bindAddr {
+	case "0.0.0.0", "":
+		return "127.0.0.1"
+	case "::":
+		return "::1"
+	}
+	return bindAddr
+}
+
+// serve accepts host connections until the relay is stopped
+func (r *namespaceRelay) serve() {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+		go r.proxy(conn)
+	}
+}
+
+// proxy copies between a host connection and a new one to the target
+func (r *namespaceRelay) proxy(client net.Conn) {
+	defer func() {
+		_ = client.Close()
+	}()
+
+	upstream, err := r.dial()
+	if err != nil {
+		r.logger.Warn("Failed to reach port inside network namespace",
+			"target", r.target,
+			"error", err)
+		return
+	}
+	defer func() {
+		_ = upstream.Close()
+	}()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(upstream, client)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// dial connects to the target from inside the namespace, unless the relay
+// has been stopped
+func (r *namespaceRelay) dial() (net.Conn, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.ns == nil {
+		return nil, net.ErrClosed
+	}
+	return dialInNamespace(r.ns, r.target)
+}
+
+// stop closes the relay's host listener. Connections already relayed carry
+// on until either end closes them.
+func (r *namespaceRelay) stop() {
+	_ = r.listener.Close()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ns != nil {
+		_ = r.ns.Close()
+		r.ns = nil
+	}
+}
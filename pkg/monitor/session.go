@@ -5,63 +5,91 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
-	"regexp"
-	"strings"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/phinze/bankshot/pkg/process"
 	"github.com/phinze/bankshot/pkg/protocol"
 )
 
-// processMatcher matches a process name by either substring or regexp.
-// Entries wrapped in /slashes/ are compiled as regexps; others use
-// case-insensitive substring matching.
-type processMatcher struct {
-	pattern string         // original pattern string (for logging)
-	re      *regexp.Regexp // non-nil for /regex/ patterns
-	substr  string         // lowercased substring for plain patterns
-}
-
-func (pm processMatcher) matches(name string) bool {
-	if pm.re != nil {
-		return pm.re.MatchString(name)
-	}
-	return strings.Contains(strings.ToLower(name), pm.substr)
-}
-
 // SessionMonitor manages port forwarding for an SSH session
 type SessionMonitor struct {
 	sessionID          string
 	systemMonitor      PortEventSource
+	socketSource       SocketEventSource // nil when no socket rules are configured
+	socketRules        []SocketRule
 	daemonClient       DaemonClient
 	logger             *slog.Logger
-	portRanges         []PortRange
-	ignorePorts        map[int]bool
-	ignoreProcesses    []string          // raw config (for logging)
-	processMatchers    []processMatcher  // compiled matchers
+	filters            atomic.Pointer[portFilters] // replaced whole by SetFilters
 	resolveProcessName func(pid int) string // defaults to ResolveProcessName
+	resolveProcessCmd  func(pid int) string // defaults to ResolveProcessCmdline
 	resolveProcessCwd  func(pid int) string // defaults to ResolveProcessCwd
 	resolveParentPID   func(pid int) int    // defaults to ResolveParentPID
+	processRunning     func(process.Handle) bool // defaults to process.Handle.Running
+	findProcess        func(pid int) (process.Handle, bool) // defaults to process.Find
 	gracePeriod        time.Duration
-	activeForwards     map[string]ForwardInfo // key: "port" (PID not needed)
+	settleTime         time.Duration
+	lastChange         map[string]time.Time    // when each port last changed state, to spot flapping
+	settling           map[string]settlingPort // coalesced events waiting for their port to settle
+	activeForwards     map[string]ForwardInfo // key: "port" (PID not needed), or "unix:path" for sockets
 	pendingRemovals    map[string]time.Time   // forwards pending removal
+	udpListeners       map[string]PortEvent   // key: "port:protocol"; seen, never forwarded
+	relays             map[string]*namespaceRelay // key: as activeForwards, for ports inside other network namespaces
+	detectProtocols    bool
+	probes             map[string]context.CancelFunc // health checks and protocol detection of ports waiting to be forwarded, by key
+	stateFile          string                        // where activeForwards is saved between runs ("" = not saved)
 	mutex              sync.RWMutex
+
+	metrics   SessionMetrics
+	metricsMu sync.Mutex
 }
 
 // PortRange defines a range of ports to auto-forward
 type PortRange struct {
 	Start int `json:"start"`
 	End   int `json:"end"`
+
+	// HealthCheck, when set, must pass before a new port in the range is
+	// forwarded
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+
+	// GracePeriod, when set, replaces the session's grace period for the
+	// range's forwards; 0 removes them as soon as their port closes
+	GracePeriod *time.Duration `json:"gracePeriod,omitempty"`
+
+	// PollInterval, when set, is how often polling sources check the
+	// range's ports, instead of their own interval
+	PollInterval time.Duration `json:"pollInterval,omitempty"`
+
+	// NoAutoForward keeps the range's ports from being auto-forwarded, even
+	// when another range includes them
+	NoAutoForward bool `json:"noAutoForward,omitempty"`
+}
+
+// contains reports whether port is in the range
+func (r PortRange) contains(port int) bool {
+	return port >= r.Start && port <= r.End
 }
 
 // ForwardInfo tracks an active forward
 type ForwardInfo struct {
-	PID         int
-	Port        int
-	ProcessName string
-	RequestID   string
-	CreatedAt   time.Time
+	PID         int       `json:"pid,omitempty"`
+	PIDStart    uint64    `json:"pid_start,omitempty"` // When PID started, to tell it from a later process reusing it (0 = unknown)
+	Port        int       `json:"port,omitempty"`
+	LocalPort   int       `json:"local_port,omitempty"` // Local port chosen by the daemon (may differ from Port)
+	ProcessName string    `json:"process_name,omitempty"`
+	AppProtocol string    `json:"app_protocol,omitempty"` // What the port speaks, if detected
+	Server      string    `json:"server,omitempty"`       // What the port's HTTP server calls itself, if detected
+	RequestID   string    `json:"request_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Netns       uint64    `json:"netns,omitempty"`      // Network namespace the port is in (0 = host)
+	RelayPort   int       `json:"relay_port,omitempty"` // Host port relaying a namespace's port, forwarded in its place
+
+	RemoteSocket string `json:"remote_socket,omitempty"` // Remote Unix socket path, for socket forwards (Port is then 0)
+	LocalSocket  string `json:"local_socket,omitempty"`  // Local Unix socket path, when the socket isn't forwarded to a port
 }
 
 // DaemonClient interface for communicating with the daemon
@@ -76,61 +104,87 @@ type SessionConfig struct {
 	PortRanges      []PortRange
 	IgnorePorts     []int
 	IgnoreProcesses []string
+	AllowProcesses  []string // when set, only ports of matching processes are forwarded
+
+	// NeverForwardProcesses are processes whose ports are never forwarded,
+	// whatever the other rules say. Unlike IgnoreProcesses, they match the
+	// port's owner only, not its ancestors.
+	NeverForwardProcesses []string
+
 	GracePeriod     time.Duration
 	Logger          *slog.Logger
 	PortEventSource PortEventSource
+
+	// SettleTime coalesces the events of a port that keeps changing state,
+	// like a dev server restarted by nodemon or air: once a port changes
+	// again within SettleTime, only its final state is applied after it has
+	// been quiet for that long. 0 disables coalescing.
+	SettleTime time.Duration
+
+	// DetectProtocols probes each new port for HTTP, TLS, or HTTP/2 before
+	// forwarding it, so the forward can say what it is
+	DetectProtocols bool
+
+	// SocketRules auto-forward matching Unix sockets, as reported by
+	// SocketEventSource
+	SocketRules       []SocketRule
+	SocketEventSource SocketEventSource
+
+	// StateFile, when set, is where the monitor saves its forwards as they
+	// change. A restarted monitor adopts those still backed by a listener
+	// rather than forwarding them again, and shutting down leaves them in
+	// place for it.
+	StateFile string
 }
 
 // NewSessionMonitor creates a new session monitor
 func NewSessionMonitor(cfg SessionConfig) (*SessionMonitor, error) {
-	ignoreMap := make(map[int]bool, len(cfg.IgnorePorts))
-	for _, p := range cfg.IgnorePorts {
-		ignoreMap[p] = true
-	}
-
-	// Compile process matchers: /pattern/ entries become regexps,
-	// plain strings use case-insensitive substring matching.
-	matchers := make([]processMatcher, 0, len(cfg.IgnoreProcesses))
-	for _, p := range cfg.IgnoreProcesses {
-		if strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") && len(p) > 2 {
-			expr := p[1 : len(p)-1]
-			re, err := regexp.Compile("(?i)" + expr)
-			if err != nil {
-				cfg.Logger.Warn("Invalid ignore process regexp, falling back to substring",
-					"pattern", p, "error", err)
-				matchers = append(matchers, processMatcher{pattern: p, substr: strings.ToLower(expr)})
-			} else {
-				matchers = append(matchers, processMatcher{pattern: p, re: re})
-			}
-		} else {
-			matchers = append(matchers, processMatcher{pattern: p, substr: strings.ToLower(p)})
-		}
-	}
-
-	return &SessionMonitor{
+	m := &SessionMonitor{
 		sessionID:          cfg.SessionID,
 		systemMonitor:      cfg.PortEventSource,
+		socketSource:       cfg.SocketEventSource,
+		socketRules:        cfg.SocketRules,
 		daemonClient:       cfg.DaemonClient,
 		logger:             cfg.Logger,
-		portRanges:         cfg.PortRanges,
-		ignorePorts:        ignoreMap,
-		ignoreProcesses:    cfg.IgnoreProcesses,
-		processMatchers:    matchers,
 		resolveProcessName: ResolveProcessName,
+		resolveProcessCmd:  ResolveProcessCmdline,
 		resolveProcessCwd:  ResolveProcessCwd,
 		resolveParentPID:   ResolveParentPID,
+		processRunning:     process.Handle.Running,
+		findProcess:        process.Find,
 		gracePeriod:        cfg.GracePeriod,
+		settleTime:         cfg.SettleTime,
+		detectProtocols:    cfg.DetectProtocols,
+		lastChange:         make(map[string]time.Time),
+		settling:           make(map[string]settlingPort),
 		activeForwards:     make(map[string]ForwardInfo),
 		pendingRemovals:    make(map[string]time.Time),
-	}, nil
+		udpListeners:       make(map[string]PortEvent),
+		relays:             make(map[string]*namespaceRelay),
+		probes:             make(map[string]context.CancelFunc),
+		stateFile:          cfg.StateFile,
+	}
+	m.filters.Store(compileFilters(Filters{
+		PortRanges:            cfg.PortRanges,
+		IgnorePorts:           cfg.IgnorePorts,
+		IgnoreProcesses:       cfg.IgnoreProcesses,
+		AllowProcesses:        cfg.AllowProcesses,
+		NeverForwardProcesses: cfg.NeverForwardProcesses,
+	}, cfg.Logger))
+	setPollRanges(m.systemMonitor, cfg.PortRanges)
+	return m, nil
 }
 
 // Start begins monitoring and auto-forwarding
 func (m *SessionMonitor) Start(ctx context.Context) error {
+	filters := m.filters.Load()
 	m.logger.Info("Starting session monitor",
 		"session", m.sessionID,
-		"portRanges", m.portRanges,
-		"ignoreProcesses", m.ignoreProcesses)
+		"portRanges", filters.portRanges,
+		"ignoreProcesses", filters.ignoreProcesses,
+		"allowProcesses", filters.allowProcesses)
+
+	m.restoreState()
 
 	// Start system-wide port monitoring
 	if err := m.systemMonitor.Start(ctx); err != nil {
@@ -140,6 +194,13 @@ func (m *SessionMonitor) Start(ctx context.Context) error {
 	// Handle events
 	go m.handleEvents(ctx)
 
+	if m.socketSource != nil {
+		if err := m.socketSource.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start socket monitor: %w", err)
+		}
+		go m.handleSocketEvents(ctx)
+	}
+
 	// Periodic cleanup
 	go m.cleanupLoop(ctx)
 
@@ -152,6 +213,15 @@ func (m *SessionMonitor) Start(ctx context.Context) error {
 func (m *SessionMonitor) handleEvents(ctx context.Context) {
 	events := m.systemMonitor.Events()
 
+	// Coalesced events are flushed from this goroutine too, so they're
+	// applied in order with new ones
+	var settle <-chan time.Time
+	if m.settleTime > 0 {
+		ticker := time.NewTicker(settleTick(m.settleTime))
+		defer ticker.Stop()
+		settle = ticker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -161,17 +231,151 @@ func (m *SessionMonitor) handleEvents(ctx context.Context) {
 				return
 			}
 			m.handlePortEvent(event)
+		case <-settle:
+			m.flushSettled()
 		}
 	}
 }
 
+// handleSocketEvents processes socket events and manages their forwards
+func (m *SessionMonitor) handleSocketEvents(ctx context.Context) {
+	events := m.socketSource.Events()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			m.handleSocketEvent(event)
+		}
+	}
+}
+
+// handleSocketEvent processes a single socket event. Socket forwards share
+// the grace period and pending removals of port forwards.
+func (m *SessionMonitor) handleSocketEvent(event SocketEvent) {
+	m.countEvent()
+	rule, ok := m.socketRule(event.Path)
+	if !ok {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := "unix:" + event.Path
+	switch event.Type {
+	case PortOpened:
+		if _, wasPending := m.pendingRemovals[key]; wasPending {
+			delete(m.pendingRemovals, key)
+			m.logger.Info("Canceled pending removal for recreated socket", "path", event.Path)
+		} else if _, exists := m.activeForwards[key]; exists {
+			return
+		}
+		m.requestSocketForward(key, event.Path, rule)
+	case PortClosed:
+		if _, exists := m.activeForwards[key]; !exists {
+			return
+		}
+		// The socket may already have been recreated, e.g. by a restart
+		if isUnixSocketListening(event.Path) {
+			return
+		}
+		m.pendingRemovals[key] = time.Now()
+		m.logger.Info("Socket closed, scheduling forward removal",
+			"path", event.Path,
+			"gracePeriod", m.gracePeriod)
+	}
+}
+
+// socketRule returns the first rule matching path
+func (m *SessionMonitor) socketRule(path string) (SocketRule, bool) {
+	for _, rule := range m.socketRules {
+		if rule.matches(path) {
+			return rule, true
+		}
+	}
+	return SocketRule{}, false
+}
+
+// requestSocketForward asks the daemon to forward the remote socket at path
+// to the rule's local target and tracks it locally.
+// Must be called with m.mutex held.
+func (m *SessionMonitor) requestSocketForward(key, path string, rule SocketRule) {
+	payload := protocol.ForwardRequest{
+		RemoteSocket:   path,
+		LocalSocket:    rule.localSocket(path),
+		LocalPort:      rule.LocalPort,
+		ConnectionInfo: m.sessionID,
+		Owner:          protocol.OwnerMonitor,
+	}
+	payloadBytes, _ := json.Marshal(payload)
+	req := &protocol.Request{
+		ID:      uuid.New().String(),
+		Type:    protocol.CommandForward,
+		Payload: payloadBytes,
+	}
+
+	m.logger.Info("Requesting socket auto-forward", "path", path)
+
+	resp, err := m.daemonClient.SendRequest(req)
+	if err != nil {
+		m.logger.Error("Failed to request socket forward", "error", err, "path", path)
+		m.recordOutcome(0, OutcomeFailed, err.Error())
+		return
+	}
+	if !resp.Success {
+		m.logger.Error("Socket forward request failed", "error", resp.Error, "path", path)
+		m.recordOutcome(0, OutcomeFailed, resp.Error)
+		return
+	}
+
+	var fwdResp protocol.ForwardResponse
+	_ = json.Unmarshal(resp.Data, &fwdResp)
+	if fwdResp.Queued {
+		m.logger.Warn("Socket auto-forward queued for retry by daemon",
+			"path", path,
+			"message", fwdResp.Message)
+		m.recordOutcome(0, OutcomeQueued, fwdResp.Message)
+	} else {
+		m.recordOutcome(0, OutcomeForwarded, path)
+	}
+
+	m.activeForwards[key] = ForwardInfo{
+		LocalPort:    fwdResp.LocalPort,
+		RequestID:    req.ID,
+		CreatedAt:    time.Now(),
+		RemoteSocket: path,
+		LocalSocket:  payload.LocalSocket,
+	}
+	m.saveState()
+
+	m.logger.Info("Socket auto-forward created",
+		"path", path,
+		"localSocket", payload.LocalSocket,
+		"localPort", fwdResp.LocalPort)
+}
+
 // handlePortEvent processes a single port event
 func (m *SessionMonitor) handlePortEvent(event PortEvent) {
+	m.countEvent()
+	if event.Type == ProcessExited {
+		m.handleProcessExited(event)
+		return
+	}
+
 	// Check if port should be auto-forwarded
+	filters := m.filters.Load()
 	if !m.shouldForwardPort(event.Port, event.BindAddr) {
 		m.logger.Debug("Port excluded from auto-forwarding",
 			"port", event.Port,
 			"bindAddr", event.BindAddr)
+		if event.Type == PortOpened {
+			m.recordOutcome(event.Port, OutcomeFiltered, m.filterReason(event.Port, event.BindAddr))
+		}
 		return
 	}
 
@@ -183,23 +387,70 @@ func (m *SessionMonitor) handlePortEvent(event PortEvent) {
 		if event.ProcessCwd == "" {
 			event.ProcessCwd = m.resolveProcessCwd(event.PID)
 		}
+		if event.ProcessCmd == "" && (needsCmdline(filters.processMatchers) || needsCmdline(filters.allowMatchers) || needsCmdline(filters.neverMatchers)) {
+			event.ProcessCmd = m.resolveProcessCmd(event.PID)
+		}
+
+		if event.Type == PortOpened && matchesAny(filters.neverMatchers, event.ProcessName, event.ProcessCmd) {
+			m.logger.Info("Not forwarding port of process in neverForwardProcesses",
+				"port", event.Port,
+				"pid", event.PID,
+				"process", event.ProcessName)
+			m.recordOutcome(event.Port, OutcomeIgnored, "neverForwardProcesses matched "+event.ProcessName)
+			return
+		}
 
 		// Check if the process or any ancestor should be ignored
-		if len(m.processMatchers) > 0 {
-			if ignored, matchedName := m.shouldIgnoreProcess(event.PID, event.ProcessName); ignored {
+		if len(filters.processMatchers) > 0 {
+			if ignored, matchedName := m.matchProcessTree(filters.processMatchers, event); ignored {
 				m.logger.Info("Ignoring port event from excluded process",
 					"port", event.Port,
 					"pid", event.PID,
 					"process", event.ProcessName,
 					"matchedAncestor", matchedName)
+				if event.Type == PortOpened {
+					m.recordOutcome(event.Port, OutcomeIgnored, "ignoreProcesses matched "+matchedName)
+				}
 				return
 			}
 		}
 	}
 
+	// With allowProcesses set, only ports whose owner is known and matches
+	// are forwarded. Closes always pass: the owner is usually gone by then,
+	// and removing a forward that was never made is a no-op.
+	if len(filters.allowMatchers) > 0 && event.Type == PortOpened {
+		allowed := false
+		if event.PID != 0 {
+			allowed, _ = m.matchProcessTree(filters.allowMatchers, event)
+		}
+		if !allowed {
+			m.logger.Debug("Port's process not in allowProcesses",
+				"port", event.Port,
+				"pid", event.PID,
+				"process", event.ProcessName)
+			m.recordOutcome(event.Port, OutcomeIgnored, "not in allowProcesses: "+event.ProcessName)
+			return
+		}
+	}
+
+	// ssh can't forward UDP, so UDP ports are only tracked for visibility
+	if IsUDP(event.Protocol) {
+		m.handleUDPEvent(event)
+		return
+	}
+
 	// Use port as key (we don't track by PID anymore since we monitor system-wide)
 	key := fmt.Sprintf("%d", event.Port)
 
+	if m.coalesce(key, event) {
+		return
+	}
+	m.applyPortEvent(key, event)
+}
+
+// applyPortEvent acts on a port opening or closing
+func (m *SessionMonitor) applyPortEvent(key string, event PortEvent) {
 	switch event.Type {
 	case PortOpened:
 		m.handlePortOpened(key, event)
@@ -208,6 +459,35 @@ func (m *SessionMonitor) handlePortEvent(event PortEvent) {
 	}
 }
 
+// handleUDPEvent records a UDP port opening or closing. UDP ports are never
+// forwarded, so there's no grace period or daemon request.
+func (m *SessionMonitor) handleUDPEvent(event PortEvent) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := fmt.Sprintf("%d:%s", event.Port, event.Protocol)
+	switch event.Type {
+	case PortOpened:
+		if _, exists := m.udpListeners[key]; exists {
+			return
+		}
+		m.udpListeners[key] = event
+		m.logger.Info("UDP port bound (not forwarded, ssh only forwards TCP)",
+			"port", event.Port,
+			"protocol", event.Protocol,
+			"bindAddr", event.BindAddr,
+			"process", event.ProcessName)
+	case PortClosed:
+		if _, exists := m.udpListeners[key]; !exists {
+			return
+		}
+		delete(m.udpListeners, key)
+		m.logger.Info("UDP port released",
+			"port", event.Port,
+			"protocol", event.Protocol)
+	}
+}
+
 // handlePortOpened creates a forward for a newly opened port
 func (m *SessionMonitor) handlePortOpened(key string, event PortEvent) {
 	m.mutex.Lock()
@@ -232,25 +512,167 @@ func (m *SessionMonitor) handlePortOpened(key string, event PortEvent) {
 		return
 	}
 
+	if check := m.healthCheck(event.Port); check != nil || m.detectProtocols {
+		m.startProbe(key, event, check)
+		return
+	}
+
 	m.requestForward(key, event)
 }
 
+// healthCheck returns the health check of the first port range port is in,
+// or nil if it has none
+func (m *SessionMonitor) healthCheck(port int) *HealthCheck {
+	for _, r := range m.filters.Load().portRanges {
+		if r.contains(port) && !r.NoAutoForward {
+			return r.HealthCheck
+		}
+	}
+	return nil
+}
+
+// rangeGracePeriod returns the grace period of the first port range port is
+// in that sets one
+func (m *SessionMonitor) rangeGracePeriod(port int) (time.Duration, bool) {
+	for _, r := range m.filters.Load().portRanges {
+		if r.contains(port) && !r.NoAutoForward && r.GracePeriod != nil {
+			return *r.GracePeriod, true
+		}
+	}
+	return 0, false
+}
+
+// gracePeriodFor returns how long the forward of port is kept after the port
+// closes: its range's grace period if it sets one, else the session's
+func (m *SessionMonitor) gracePeriodFor(port int) time.Duration {
+	if grace, ok := m.rangeGracePeriod(port); ok {
+		return grace
+	}
+	return m.gracePeriod
+}
+
+// scheduleRemoval marks the forward for key for removal once its grace
+// period passes. A range that asks for no grace period at all, as for
+// one-shot OAuth callback ports, has the forward removed right away.
+// Must be called with m.mutex held.
+func (m *SessionMonitor) scheduleRemoval(key string, port int) {
+	if grace, ok := m.rangeGracePeriod(port); ok && grace <= 0 {
+		m.dropForward(key)
+		return
+	}
+	m.pendingRemovals[key] = time.Now()
+}
+
+// startProbe probes a new port in the background and forwards it once it
+// passes its health check, if it has one, and its protocol has been
+// detected, if that's enabled. A port that closes meanwhile cancels its
+// probe, and one that fails its health check isn't forwarded.
+// Must be called with m.mutex held.
+func (m *SessionMonitor) startProbe(key string, event PortEvent, check *HealthCheck) {
+	if _, probing := m.probes[key]; probing {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.probes[key] = cancel
+
+	if check != nil {
+		m.logger.Info("Waiting for port to pass health check",
+			"port", event.Port,
+			"check", check.Type,
+			"process", event.ProcessName)
+	}
+
+	go func() {
+		var err error
+		if check != nil {
+			err = check.wait(ctx, event)
+		}
+		if err == nil && m.detectProtocols {
+			event.AppProtocol, event.Server = detectProtocol(ctx, event)
+		}
+
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		// Cancelled because the port closed or the monitor is stopping
+		if ctx.Err() == context.Canceled {
+			return
+		}
+		cancel()
+		delete(m.probes, key)
+
+		if err != nil {
+			m.logger.Warn("Port failed health check, not forwarding",
+				"port", event.Port,
+				"check", check.Type,
+				"error", err)
+			m.recordOutcome(event.Port, OutcomeUnhealthy, err.Error())
+			return
+		}
+		if _, exists := m.activeForwards[key]; exists {
+			return
+		}
+		m.requestForward(key, event)
+	}()
+}
+
+// stopProbe cancels the probe of a port waiting to be forwarded, reporting
+// whether there was one.
+// Must be called with m.mutex held.
+func (m *SessionMonitor) stopProbe(key string) bool {
+	cancel, ok := m.probes[key]
+	if !ok {
+		return false
+	}
+	cancel()
+	delete(m.probes, key)
+	return true
+}
+
 // requestForward sends a forward request to the daemon and tracks it locally.
 // This is idempotent - the daemon returns success if the forward already exists.
 // Must be called with m.mutex held.
 func (m *SessionMonitor) requestForward(key string, event PortEvent) {
+	// A port inside another network namespace is out of ssh's reach, so
+	// it's relayed onto the host's loopback and the relay is forwarded
+	if event.Netns != 0 && m.relays[key] == nil {
+		relay, err := startNamespaceRelay(m.logger, event)
+		if err != nil {
+			m.logger.Error("Failed to relay port from network namespace",
+				"error", err,
+				"port", event.Port,
+				"netns", event.Netns)
+			m.recordOutcome(event.Port, OutcomeFailed, err.Error())
+			return
+		}
+		m.relays[key] = relay
+		m.logger.Info("Relaying port from network namespace",
+			"port", event.Port,
+			"netns", event.Netns)
+	}
+
+	// A relayed port is forwarded from the relay's own port on the host, to
+	// the same port as inside the namespace on the laptop
+	remotePort, relayPort := event.Port, 0
+	if relay := m.relays[key]; relay != nil {
+		remotePort, relayPort = relay.port, relay.port
+	}
+
 	req := &protocol.Request{
 		ID:   uuid.New().String(),
 		Type: protocol.CommandForward,
 	}
 
 	payload := protocol.ForwardRequest{
-		RemotePort:     event.Port,
+		RemotePort:     remotePort,
 		LocalPort:      event.Port,
 		Host:           "localhost",
 		ConnectionInfo: m.sessionID, // sessionID is now the hostname for SSH connection matching
 		ProcessName:    event.ProcessName,
 		ProcessCwd:     event.ProcessCwd,
+		AppProtocol:    event.AppProtocol,
+		Server:         event.Server,
+		Owner:          protocol.OwnerMonitor,
 	}
 
 	payloadBytes, _ := json.Marshal(payload)
@@ -259,6 +681,8 @@ func (m *SessionMonitor) requestForward(key string, event PortEvent) {
 	m.logger.Info("Requesting auto-forward",
 		"port", event.Port,
 		"protocol", event.Protocol,
+		"appProtocol", event.AppProtocol,
+		"server", event.Server,
 		"pid", event.PID,
 		"process", event.ProcessName)
 
@@ -267,6 +691,8 @@ func (m *SessionMonitor) requestForward(key string, event PortEvent) {
 		m.logger.Error("Failed to request forward",
 			"error", err,
 			"port", event.Port)
+		m.recordOutcome(event.Port, OutcomeFailed, err.Error())
+		m.stopRelay(key)
 		return
 	}
 
@@ -274,20 +700,49 @@ func (m *SessionMonitor) requestForward(key string, event PortEvent) {
 		m.logger.Error("Forward request failed",
 			"error", resp.Error,
 			"port", event.Port)
+		m.recordOutcome(event.Port, OutcomeFailed, resp.Error)
+		m.stopRelay(key)
 		return
 	}
 
+	// The daemon may have picked a different local port if ours was taken
+	localPort := event.Port
+	var fwdResp protocol.ForwardResponse
+	if err := json.Unmarshal(resp.Data, &fwdResp); err == nil && fwdResp.LocalPort != 0 {
+		localPort = fwdResp.LocalPort
+	}
+
+	// A queued forward is retried by the daemon; track it so a later close
+	// still cancels it
+	if fwdResp.Queued {
+		m.logger.Warn("Auto-forward queued for retry by daemon",
+			"port", event.Port,
+			"message", fwdResp.Message)
+		m.recordOutcome(event.Port, OutcomeQueued, fwdResp.Message)
+	} else {
+		m.recordOutcome(event.Port, OutcomeForwarded, event.ProcessName)
+	}
+
 	// Track the forward
+	proc, _ := m.findProcess(event.PID)
 	m.activeForwards[key] = ForwardInfo{
 		PID:         event.PID,
+		PIDStart:    proc.Start,
 		Port:        event.Port,
+		LocalPort:   localPort,
 		ProcessName: event.ProcessName,
+		AppProtocol: event.AppProtocol,
+		Server:      event.Server,
 		RequestID:   req.ID,
 		CreatedAt:   time.Now(),
+		Netns:       event.Netns,
+		RelayPort:   relayPort,
 	}
+	m.saveState()
 
 	m.logger.Info("Auto-forward created",
 		"port", event.Port,
+		"localPort", localPort,
 		"protocol", event.Protocol,
 		"pid", event.PID,
 		"process", event.ProcessName)
@@ -296,34 +751,132 @@ func (m *SessionMonitor) requestForward(key string, event PortEvent) {
 // handlePortClosed marks a forward for removal after grace period
 func (m *SessionMonitor) handlePortClosed(key string, event PortEvent) {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	// Check if we have this forward
-	if _, exists := m.activeForwards[key]; !exists {
+	if m.stopProbe(key) {
+		m.mutex.Unlock()
+		m.logger.Info("Port closed before it could be forwarded", "port", event.Port)
+		return
+	}
+	_, exists := m.activeForwards[key]
+	// The removal may already have been scheduled when the process exited
+	_, pending := m.pendingRemovals[key]
+	m.mutex.Unlock()
+	if !exists || pending {
 		return
 	}
 
 	// Verify the port is actually closed — another listener may have already
-	// replaced it (hot-reload race: PortOpened(new) then PortClosed(old))
-	ports, err := GetListeningPorts()
-	if err == nil {
-		for _, p := range ports {
-			if p.Port == event.Port {
-				m.logger.Info("Ignoring stale PortClosed — port still listening",
-					"port", event.Port,
-					"protocol", event.Protocol)
-				return
-			}
-		}
+	// replaced it (hot-reload race: PortOpened(new) then PortClosed(old)).
+	// That scans the listening ports, so it's done without the lock.
+	if portStillListening(event.Port, event.Netns) {
+		m.logger.Info("Ignoring stale PortClosed — port still listening",
+			"port", event.Port,
+			"protocol", event.Protocol)
+		return
 	}
 
-	// Mark for pending removal
-	m.pendingRemovals[key] = time.Now()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.activeForwards[key]; !exists {
+		return
+	}
+	if _, pending := m.pendingRemovals[key]; pending {
+		return
+	}
 
 	m.logger.Info("Port closed, scheduling forward removal",
 		"port", event.Port,
 		"protocol", event.Protocol,
-		"gracePeriod", m.gracePeriod)
+		"gracePeriod", m.gracePeriodFor(event.Port))
+
+	m.scheduleRemoval(key, event.Port)
+}
+
+// handleProcessExited schedules the removal of the forwards of a process
+// that exited, so the grace period starts now rather than once its ports are
+// seen closed. Ports still listening, e.g. inherited by a child that
+// outlived it, keep their forwards.
+func (m *SessionMonitor) handleProcessExited(event PortEvent) {
+	if event.PID == 0 {
+		return
+	}
+
+	m.mutex.RLock()
+	forwards := make(map[string]ForwardInfo)
+	for key, fwd := range m.activeForwards {
+		if _, pending := m.pendingRemovals[key]; fwd.PID == event.PID && !pending {
+			forwards[key] = fwd
+		}
+	}
+	m.mutex.RUnlock()
+
+	// Looking the ports up scans the listening ports, so it's done without
+	// the lock
+	var closed []string
+	for key, fwd := range forwards {
+		if !portStillListening(fwd.Port, fwd.Netns) {
+			closed = append(closed, key)
+		}
+	}
+	if len(closed) == 0 {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, key := range closed {
+		fwd, exists := m.activeForwards[key]
+		if !exists || fwd.PID != event.PID {
+			continue
+		}
+		if _, pending := m.pendingRemovals[key]; pending {
+			continue
+		}
+		m.logger.Info("Process exited, scheduling forward removal",
+			"port", fwd.Port,
+			"pid", event.PID,
+			"process", fwd.ProcessName,
+			"gracePeriod", m.gracePeriodFor(fwd.Port))
+		m.scheduleRemoval(key, fwd.Port)
+	}
+}
+
+// checkExitedProcesses handles the exit of each process with forwards, which
+// the port sources don't report themselves
+func (m *SessionMonitor) checkExitedProcesses() {
+	m.mutex.RLock()
+	procs := make(map[process.Handle]bool)
+	for key, fwd := range m.activeForwards {
+		if _, pending := m.pendingRemovals[key]; fwd.PID != 0 && !pending {
+			procs[process.Handle{PID: fwd.PID, Start: fwd.PIDStart}] = true
+		}
+	}
+	m.mutex.RUnlock()
+
+	for proc := range procs {
+		if !m.processRunning(proc) {
+			m.handleProcessExited(PortEvent{Type: ProcessExited, PID: proc.PID, Timestamp: time.Now()})
+		}
+	}
+}
+
+// portStillListening reports whether port is listening in the network
+// namespace netns. A namespace port's host side is our own relay, so it's
+// looked up inside the namespaces.
+func portStillListening(port int, netns uint64) bool {
+	listPorts := GetListeningPorts
+	if netns != 0 {
+		listPorts = GetNamespaceListeningPorts
+	}
+	ports, err := listPorts()
+	if err != nil {
+		return false
+	}
+	for _, p := range ports {
+		if p.Port == port && p.Netns == netns {
+			return true
+		}
+	}
+	return false
 }
 
 // cleanupLoop periodically removes forwards after grace period
@@ -336,6 +889,7 @@ func (m *SessionMonitor) cleanupLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			m.checkExitedProcesses()
 			m.cleanupPendingRemovals()
 		}
 	}
@@ -348,14 +902,127 @@ func (m *SessionMonitor) cleanupPendingRemovals() {
 
 	now := time.Now()
 	for key, pendingSince := range m.pendingRemovals {
-		if now.Sub(pendingSince) >= m.gracePeriod {
-			// Time to remove the forward
-			if fwd, exists := m.activeForwards[key]; exists {
-				m.removeForward(fwd)
-				delete(m.activeForwards, key)
-			}
-			delete(m.pendingRemovals, key)
+		// A port that's still flapping is decided once it settles
+		if _, settling := m.settling[key]; settling {
+			continue
 		}
+		if now.Sub(pendingSince) >= m.gracePeriodFor(m.activeForwards[key].Port) {
+			m.dropForward(key)
+		}
+	}
+}
+
+// Rescan compares the session's forwards with the ports listening now and
+// applies the difference, for when the port source may have missed changes,
+// as while the host was asleep. Forwards of closed ports get their grace
+// period, and those whose port is listening again are kept; new ports go
+// through the usual filters. Changes are coalesced with the source's events.
+func (m *SessionMonitor) Rescan() {
+	ports, err := GetListeningPorts()
+	if err != nil {
+		m.logger.Warn("Failed to rescan listening ports", "error", err)
+		return
+	}
+	listening := make(map[string]bool, len(ports))
+	for _, p := range ports {
+		listening[fmt.Sprintf("%d", p.Port)] = true
+	}
+
+	m.mutex.RLock()
+	closed := make(map[string]int)
+	for key, fwd := range m.activeForwards {
+		// Socket and namespace forwards aren't among the host's listeners
+		if fwd.RemoteSocket == "" && fwd.Netns == 0 && !listening[key] {
+			closed[key] = fwd.Port
+		}
+	}
+	var opened, reopened []Port
+	seen := make(map[string]bool)
+	for _, p := range ports {
+		// A port listening on both IPv4 and IPv6 is one forward
+		key := fmt.Sprintf("%d", p.Port)
+		if seen[key] {
+			continue
+		}
+		_, forwarded := m.activeForwards[key]
+		_, pending := m.pendingRemovals[key]
+		_, probing := m.probes[key]
+		switch {
+		case forwarded && pending:
+			seen[key] = true
+			reopened = append(reopened, p)
+		case !forwarded && !probing && m.shouldForwardPort(p.Port, p.BindAddr):
+			seen[key] = true
+			opened = append(opened, p)
+		}
+	}
+	m.mutex.RUnlock()
+
+	if len(closed) > 0 || len(opened) > 0 || len(reopened) > 0 {
+		m.logger.Info("Rescanned listening ports",
+			"closed", len(closed),
+			"opened", len(opened),
+			"reopened", len(reopened))
+	}
+	now := time.Now()
+	for key, port := range closed {
+		m.applyRescanned(key, PortEvent{Type: PortClosed, Port: port, Timestamp: now})
+	}
+	// Forwards whose port closed and came back while unobserved keep their
+	// forward, as when the source sees a server restart
+	for _, p := range reopened {
+		m.applyRescanned(fmt.Sprintf("%d", p.Port), PortEvent{
+			Type:      PortOpened,
+			Port:      p.Port,
+			Protocol:  p.Protocol,
+			BindAddr:  p.BindAddr,
+			Timestamp: now,
+		})
+	}
+	if len(opened) == 0 {
+		return
+	}
+	owners := SocketOwners()
+	for _, p := range opened {
+		m.handlePortEvent(PortEvent{
+			Type:      PortOpened,
+			PID:       owners[p.Inode],
+			Port:      p.Port,
+			Protocol:  p.Protocol,
+			BindAddr:  p.BindAddr,
+			Timestamp: now,
+		})
+	}
+}
+
+// applyRescanned applies a change Rescan found to a forward the session
+// already has, holding it back like the source's events if the port is
+// flapping
+func (m *SessionMonitor) applyRescanned(key string, event PortEvent) {
+	if m.coalesce(key, event) {
+		return
+	}
+	m.applyPortEvent(key, event)
+}
+
+// dropForward removes the forward for key and its relay, if any.
+// Must be called with m.mutex held.
+func (m *SessionMonitor) dropForward(key string) {
+	if fwd, exists := m.activeForwards[key]; exists {
+		m.removeForward(fwd)
+		delete(m.activeForwards, key)
+		m.saveState()
+	}
+	m.stopRelay(key)
+	delete(m.pendingRemovals, key)
+}
+
+// stopRelay stops the namespace relay for key, if there is one.
+// Must be called with m.mutex held.
+func (m *SessionMonitor) stopRelay(key string) {
+	if relay, ok := m.relays[key]; ok {
+		relay.stop()
+		delete(m.relays, key)
 	}
 }
 
@@ -366,9 +1033,14 @@ func (m *SessionMonitor) removeForward(fwd ForwardInfo) {
 		Type: protocol.CommandUnforward,
 	}
 
+	remotePort := fwd.Port
+	if fwd.RelayPort != 0 {
+		remotePort = fwd.RelayPort
+	}
 	payload := protocol.UnforwardRequest{
-		RemotePort:     fwd.Port,
+		RemotePort:     remotePort,
 		Host:           "localhost",
+		RemoteSocket:   fwd.RemoteSocket,
 		ConnectionInfo: m.sessionID, // sessionID is now the hostname for SSH connection matching
 	}
 
@@ -376,7 +1048,8 @@ func (m *SessionMonitor) removeForward(fwd ForwardInfo) {
 	req.Payload = payloadBytes
 
 	m.logger.Info("Removing auto-forward",
-		"port", fwd.Port)
+		"port", fwd.Port,
+		"remoteSocket", fwd.RemoteSocket)
 
 	resp, err := m.daemonClient.SendRequest(req)
 	if err != nil {
@@ -390,14 +1063,16 @@ func (m *SessionMonitor) removeForward(fwd ForwardInfo) {
 		m.logger.Error("Unforward request failed",
 			"error", resp.Error,
 			"port", fwd.Port)
+		return
 	}
+	m.countRemoval()
 }
 
 // ShouldForwardPort determines whether a port should be auto-forwarded.
 // Ports bound to non-local addresses (e.g. Tailscale, LAN IPs) are skipped.
-// When portRanges is non-empty, the port must fall within one of the ranges.
-// When portRanges is empty/nil, all non-privileged ports (>= 1024) are forwarded.
-// Ports in ignorePorts are never forwarded regardless of other settings.
+// When portRanges has ranges that auto-forward, the port must fall within one of them.
+// Otherwise all non-privileged ports (>= 1024) are forwarded.
+// Ports in ignorePorts or a NoAutoForward range are never forwarded regardless of other settings.
 func ShouldForwardPort(port int, bindAddr string, portRanges []PortRange, ignorePorts map[int]bool) bool {
 	if !IsLocalAddr(bindAddr) {
 		return false
@@ -405,74 +1080,116 @@ func ShouldForwardPort(port int, bindAddr string, portRanges []PortRange, ignore
 	if ignorePorts[port] {
 		return false
 	}
-	if len(portRanges) > 0 {
-		for _, r := range portRanges {
-			if port >= r.Start && port <= r.End {
-				return true
+	restricted, included := false, false
+	for _, r := range portRanges {
+		if r.NoAutoForward {
+			if r.contains(port) {
+				return false
 			}
+			continue
 		}
-		return false
+		restricted = true
+		if r.contains(port) {
+			included = true
+		}
+	}
+	if restricted {
+		return included
 	}
 	return port >= 1024
 }
 
 // shouldForwardPort checks if a port should be auto-forwarded using this monitor's config
 func (m *SessionMonitor) shouldForwardPort(port int, bindAddr string) bool {
-	return ShouldForwardPort(port, bindAddr, m.portRanges, m.ignorePorts)
+	filters := m.filters.Load()
+	return ShouldForwardPort(port, bindAddr, filters.portRanges, filters.ignorePorts)
 }
 
-// shouldIgnoreProcess checks if the process or any of its ancestors match an
-// ignoreProcesses entry. It first checks the given name, then walks the process
-// tree upward via resolveParentPID, resolving each ancestor's name and checking
-// against the matchers. Stops at PID <= 1 or after 16 levels.
-func (m *SessionMonitor) shouldIgnoreProcess(pid int, name string) (bool, string) {
-	// Check the process itself first
-	for _, pm := range m.processMatchers {
-		if pm.matches(name) {
-			return true, name
-		}
+// filterReason explains why shouldForwardPort rejected a port
+func (m *SessionMonitor) filterReason(port int, bindAddr string) string {
+	filters := m.filters.Load()
+	switch {
+	case !IsLocalAddr(bindAddr):
+		return "bound to " + bindAddr
+	case filters.ignorePorts[port]:
+		return "in ignorePorts"
+	case len(filters.portRanges) == 0:
+		return "privileged port"
+	default:
+		return "not in an auto-forwarded portRange"
 	}
+}
 
-	// Walk up the process tree
-	currentPID := pid
-	for depth := 0; depth < 16; depth++ {
-		parentPID := m.resolveParentPID(currentPID)
-		if parentPID <= 1 {
-			break
-		}
-		parentName := m.resolveProcessName(parentPID)
-		if parentName == "" {
-			break
-		}
-		for _, pm := range m.processMatchers {
-			if pm.matches(parentName) {
-				return true, parentName
-			}
-		}
-		currentPID = parentPID
+// matchProcessTree checks if the event's process or any of its ancestors
+// match one of matchers, returning the name of the matching process
+func (m *SessionMonitor) matchProcessTree(matchers []processMatcher, event PortEvent) (bool, string) {
+	tree := processTree{
+		name:    m.resolveProcessName,
+		cmdline: m.resolveProcessCmd,
+		parent:  m.resolveParentPID,
 	}
-
-	return false, ""
+	return tree.match(matchers, event.PID, event.ProcessName, event.ProcessCmd)
 }
 
-// cleanup removes all forwards on shutdown
+// cleanup removes all forwards on shutdown. With a state file, forwards on
+// the host are left for the next run to adopt; those relayed from other
+// network namespaces stop working with their relays, so they're removed.
 func (m *SessionMonitor) cleanup() error {
 	m.logger.Info("Cleaning up session monitor", "session", m.sessionID)
 
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	// Remove all active forwards
-	for _, fwd := range m.activeForwards {
+	for key := range m.probes {
+		m.stopProbe(key)
+	}
+
+	kept := make(map[string]ForwardInfo)
+	for key, fwd := range m.activeForwards {
+		if m.stateFile != "" && fwd.Netns == 0 {
+			kept[key] = fwd
+			continue
+		}
 		m.removeForward(fwd)
+		m.stopRelay(key)
+	}
+	if len(kept) > 0 {
+		m.logger.Info("Leaving forwards in place for the next run", "count", len(kept), "stateFile", m.stateFile)
 	}
 
+	m.activeForwards = kept
+	m.saveState()
 	m.activeForwards = make(map[string]ForwardInfo)
 	m.pendingRemovals = make(map[string]time.Time)
 
 	return nil
 }
 
+// ForwardStatus is a forward the session monitor made, and when its removal
+// was scheduled, if its port has closed
+type ForwardStatus struct {
+	ForwardInfo
+	PendingSince time.Time // Zero unless the forward is pending removal
+}
+
+// Forwards returns the session's forwards, sorted by port, then by socket
+func (m *SessionMonitor) Forwards() []ForwardStatus {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	forwards := make([]ForwardStatus, 0, len(m.activeForwards))
+	for key, fwd := range m.activeForwards {
+		forwards = append(forwards, ForwardStatus{ForwardInfo: fwd, PendingSince: m.pendingRemovals[key]})
+	}
+	sort.Slice(forwards, func(i, j int) bool {
+		if forwards[i].Port != forwards[j].Port {
+			return forwards[i].Port < forwards[j].Port
+		}
+		return forwards[i].RemoteSocket < forwards[j].RemoteSocket
+	})
+	return forwards
+}
+
 // GetStatus returns the current status of the monitor
 func (m *SessionMonitor) GetStatus() map[string]interface{} {
 	m.mutex.RLock()
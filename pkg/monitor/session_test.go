@@ -2,11 +2,15 @@ package monitor
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
+	"net"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/phinze/bankshot/pkg/process"
 	"github.com/phinze/bankshot/pkg/protocol"
 )
 
@@ -82,19 +86,29 @@ func TestShouldForwardPort(t *testing.T) {
 		},
 		{
 			name: "explicit range includes port",
-			port: 5000, bindAddr: "0.0.0.0", portRanges: []PortRange{{3000, 9999}}, ignorePorts: nil,
+			port: 5000, bindAddr: "0.0.0.0", portRanges: []PortRange{{Start: 3000, End: 9999}}, ignorePorts: nil,
 			want: true,
 		},
 		{
 			name: "explicit range excludes port",
-			port: 37593, bindAddr: "0.0.0.0", portRanges: []PortRange{{3000, 9999}}, ignorePorts: nil,
+			port: 37593, bindAddr: "0.0.0.0", portRanges: []PortRange{{Start: 3000, End: 9999}}, ignorePorts: nil,
 			want: false,
 		},
 		{
 			name: "ignore beats explicit range",
-			port: 5000, bindAddr: "0.0.0.0", portRanges: []PortRange{{3000, 9999}}, ignorePorts: map[int]bool{5000: true},
+			port: 5000, bindAddr: "0.0.0.0", portRanges: []PortRange{{Start: 3000, End: 9999}}, ignorePorts: map[int]bool{5000: true},
 			want: false,
 		},
+		{
+			name: "no-auto-forward range excludes port",
+			port: 5000, bindAddr: "0.0.0.0", portRanges: []PortRange{{Start: 3000, End: 9999}, {Start: 5000, End: 5000, NoAutoForward: true}}, ignorePorts: nil,
+			want: false,
+		},
+		{
+			name: "no-auto-forward range alone keeps default",
+			port: 37593, bindAddr: "0.0.0.0", portRanges: []PortRange{{Start: 5000, End: 5000, NoAutoForward: true}}, ignorePorts: nil,
+			want: true,
+		},
 		// Bind address filtering
 		{
 			name: "wildcard IPv4 allowed",
@@ -182,6 +196,8 @@ func TestParseHexAddr(t *testing.T) {
 		{"IPv4 Tailscale", "48006E64", "tcp", "100.110.0.72"},
 		{"IPv6 wildcard", "00000000000000000000000000000000", "tcp6", "::"},
 		{"IPv6 loopback", "00000000000000000000000001000000", "tcp6", "::1"},
+		{"UDP IPv4 loopback", "0100007F", "udp", "127.0.0.1"},
+		{"UDP IPv6 wildcard", "00000000000000000000000000000000", "udp6", "::"},
 	}
 
 	for _, tt := range tests {
@@ -322,6 +338,122 @@ func TestHandlePortEvent_AncestorWalk_DepthLimit(t *testing.T) {
 	}
 }
 
+func TestHandlePortEvent_UDPNotForwarded(t *testing.T) {
+	client := &mockDaemonClient{}
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "test",
+		DaemonClient:    client,
+		Logger:          slog.Default(),
+		PortEventSource: &mockPortEventSource{},
+	})
+
+	sm.handlePortEvent(PortEvent{
+		Type: PortOpened, Port: 5353, Protocol: "udp",
+		BindAddr: "0.0.0.0", Timestamp: time.Now(),
+	})
+	if client.forwardCount() != 0 {
+		t.Errorf("expected no forward for a UDP port, got %d forwards", client.forwardCount())
+	}
+	if got := sm.Metrics().UDPListeners; got != 1 {
+		t.Errorf("udpListeners = %v, want 1", got)
+	}
+
+	sm.handlePortEvent(PortEvent{
+		Type: PortClosed, Port: 5353, Protocol: "udp",
+		BindAddr: "0.0.0.0", Timestamp: time.Now(),
+	})
+	if got := sm.Metrics().UDPListeners; got != 0 {
+		t.Errorf("udpListeners after close = %v, want 0", got)
+	}
+	if len(sm.pendingRemovals) != 0 {
+		t.Errorf("expected no pending removals for a UDP port, got %d", len(sm.pendingRemovals))
+	}
+}
+
+func TestSetFilters(t *testing.T) {
+	client := &mockDaemonClient{}
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "test",
+		DaemonClient:    client,
+		Logger:          slog.Default(),
+		IgnorePorts:     []int{5000},
+		PortEventSource: &mockPortEventSource{},
+	})
+	sm.resolveProcessName = func(pid int) string { return "node" }
+	sm.resolveProcessCwd = func(pid int) string { return "" }
+	sm.resolveParentPID = func(pid int) int { return 1 }
+
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 5000, BindAddr: "0.0.0.0", Timestamp: time.Now()})
+	if client.forwardCount() != 0 {
+		t.Fatalf("expected port in ignorePorts not to be forwarded, got %d forwards", client.forwardCount())
+	}
+
+	// The port is no longer ignored, but node now never forwards
+	sm.SetFilters(Filters{NeverForwardProcesses: []string{"node"}})
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 5000, BindAddr: "0.0.0.0", Timestamp: time.Now()})
+	if client.forwardCount() != 0 {
+		t.Fatalf("expected port of process in neverForwardProcesses not to be forwarded, got %d forwards", client.forwardCount())
+	}
+
+	sm.SetFilters(Filters{})
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 5000, BindAddr: "0.0.0.0", Timestamp: time.Now()})
+	if client.forwardCount() != 1 {
+		t.Errorf("expected port to be forwarded once no rule excludes it, got %d forwards", client.forwardCount())
+	}
+}
+
+func TestHandleSocketEvent(t *testing.T) {
+	client := &mockDaemonClient{}
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "test",
+		DaemonClient:    client,
+		Logger:          slog.Default(),
+		PortEventSource: &mockPortEventSource{},
+		SocketRules: []SocketRule{
+			{Pattern: "/run/user/*/docker.sock", LocalSocket: "~/.bankshot/{name}"},
+		},
+	})
+
+	// Sockets no rule covers are left alone
+	sm.handleSocketEvent(SocketEvent{Type: PortOpened, Path: "/tmp/other.sock"})
+	if client.forwardCount() != 0 {
+		t.Fatalf("expected no forward for an unmatched socket, got %d", client.forwardCount())
+	}
+
+	path := "/run/user/1000/docker.sock"
+	sm.handleSocketEvent(SocketEvent{Type: PortOpened, Path: path})
+	sm.handleSocketEvent(SocketEvent{Type: PortOpened, Path: path})
+	if client.forwardCount() != 1 {
+		t.Fatalf("expected 1 forward, got %d", client.forwardCount())
+	}
+	var req protocol.ForwardRequest
+	if err := json.Unmarshal(client.requests[0].Payload, &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.RemoteSocket != path || req.LocalSocket != "~/.bankshot/docker.sock" {
+		t.Errorf("forward request = %+v, want %s -> ~/.bankshot/docker.sock", req, path)
+	}
+
+	sm.handleSocketEvent(SocketEvent{Type: PortClosed, Path: path})
+	if _, pending := sm.pendingRemovals["unix:"+path]; !pending {
+		t.Fatal("expected socket forward to be pending removal")
+	}
+
+	sm.gracePeriod = 0
+	sm.cleanupPendingRemovals()
+	var unfwd protocol.UnforwardRequest
+	last := client.requests[len(client.requests)-1]
+	if last.Type != protocol.CommandUnforward {
+		t.Fatalf("expected an unforward request, got %s", last.Type)
+	}
+	if err := json.Unmarshal(last.Payload, &unfwd); err != nil {
+		t.Fatal(err)
+	}
+	if unfwd.RemoteSocket != path {
+		t.Errorf("unforward remote socket = %q, want %q", unfwd.RemoteSocket, path)
+	}
+}
+
 func TestHandlePortEvent_IgnoreProcesses(t *testing.T) {
 	// Stub process name resolver so tests don't touch /proc
 	stubResolver := func(pid int) string {
@@ -450,3 +582,414 @@ func TestHandlePortEvent_IgnoreProcesses(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlePortEvent_ProcessRules(t *testing.T) {
+	names := map[int]string{100: "node", 200: "python3", 300: "bash"}
+	cmdlines := map[int]string{
+		100: "node /srv/app/node_modules/.bin/vite --port 5173",
+		200: "python3 -m jupyterlab --no-browser",
+		300: "-bash",
+	}
+	parents := map[int]int{100: 300, 200: 300}
+
+	tests := []struct {
+		name            string
+		ignoreProcesses []string
+		allowProcesses  []string
+		event           PortEvent
+		wantForward     bool
+	}{
+		{
+			name:            "cmdline substring ignores",
+			ignoreProcesses: []string{"cmdline:jupyterlab"},
+			event:           PortEvent{Type: PortOpened, PID: 200, Port: 8888, BindAddr: "127.0.0.1"},
+			wantForward:     false,
+		},
+		{
+			name:            "cmdline regexp ignores",
+			ignoreProcesses: []string{`cmdline:/--port \d+/`},
+			event:           PortEvent{Type: PortOpened, PID: 100, Port: 5173, BindAddr: "127.0.0.1"},
+			wantForward:     false,
+		},
+		{
+			name:            "cmdline rule does not match the name",
+			ignoreProcesses: []string{"cmdline:python3 -m http.server"},
+			event:           PortEvent{Type: PortOpened, PID: 200, Port: 8888, BindAddr: "127.0.0.1"},
+			wantForward:     true,
+		},
+		{
+			name:            "cmdline from the event is used",
+			ignoreProcesses: []string{"cmdline:webpack"},
+			event:           PortEvent{Type: PortOpened, PID: 100, Port: 8080, BindAddr: "127.0.0.1", ProcessCmd: "node webpack serve"},
+			wantForward:     false,
+		},
+		{
+			name:           "allowed process is forwarded",
+			allowProcesses: []string{"node"},
+			event:          PortEvent{Type: PortOpened, PID: 100, Port: 5173, BindAddr: "127.0.0.1"},
+			wantForward:    true,
+		},
+		{
+			name:           "process not allowed is not forwarded",
+			allowProcesses: []string{"node"},
+			event:          PortEvent{Type: PortOpened, PID: 200, Port: 8888, BindAddr: "127.0.0.1"},
+			wantForward:    false,
+		},
+		{
+			name:           "allowed by ancestor",
+			allowProcesses: []string{"/^bash$/"},
+			event:          PortEvent{Type: PortOpened, PID: 200, Port: 8888, BindAddr: "127.0.0.1"},
+			wantForward:    true,
+		},
+		{
+			name:           "unknown owner is not forwarded in allow mode",
+			allowProcesses: []string{"node"},
+			event:          PortEvent{Type: PortOpened, PID: 0, Port: 5173, BindAddr: "127.0.0.1"},
+			wantForward:    false,
+		},
+		{
+			name:            "ignore wins over allow",
+			ignoreProcesses: []string{"cmdline:vite"},
+			allowProcesses:  []string{"node"},
+			event:           PortEvent{Type: PortOpened, PID: 100, Port: 5173, BindAddr: "127.0.0.1"},
+			wantForward:     false,
+		},
+		{
+			name:            "empty cmdline rule is skipped",
+			ignoreProcesses: []string{"cmdline:"},
+			event:           PortEvent{Type: PortOpened, PID: 100, Port: 5173, BindAddr: "127.0.0.1"},
+			wantForward:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockDaemonClient{}
+			sm, _ := NewSessionMonitor(SessionConfig{
+				SessionID:       "test",
+				DaemonClient:    client,
+				Logger:          slog.Default(),
+				IgnoreProcesses: tt.ignoreProcesses,
+				AllowProcesses:  tt.allowProcesses,
+				PortEventSource: &mockPortEventSource{},
+			})
+			sm.resolveProcessName = func(pid int) string { return names[pid] }
+			sm.resolveProcessCmd = func(pid int) string { return cmdlines[pid] }
+			sm.resolveProcessCwd = func(pid int) string { return "" }
+			sm.resolveParentPID = func(pid int) int { return parents[pid] }
+
+			tt.event.Timestamp = time.Now()
+			sm.handlePortEvent(tt.event)
+
+			got := client.forwardCount() > 0
+			if got != tt.wantForward {
+				t.Errorf("forward created = %v, want %v", got, tt.wantForward)
+			}
+		})
+	}
+}
+
+func TestHandlePortEvent_AllowProcessesPassesClose(t *testing.T) {
+	client := &mockDaemonClient{}
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "test",
+		DaemonClient:    client,
+		Logger:          slog.Default(),
+		AllowProcesses:  []string{"node"},
+		PortEventSource: &mockPortEventSource{},
+	})
+	sm.resolveProcessName = func(pid int) string { return "node" }
+	sm.resolveProcessCwd = func(pid int) string { return "" }
+	sm.resolveParentPID = func(pid int) int { return 0 }
+
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 5173, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	if client.forwardCount() != 1 {
+		t.Fatalf("forward count = %d, want 1", client.forwardCount())
+	}
+
+	// The owner is gone by the time the port closes
+	sm.handlePortEvent(PortEvent{Type: PortClosed, PID: 0, Port: 5173, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+
+	sm.mutex.RLock()
+	_, pending := sm.pendingRemovals["5173"]
+	sm.mutex.RUnlock()
+	if !pending {
+		t.Error("closed port was not scheduled for removal")
+	}
+}
+
+func TestCheckExitedProcesses(t *testing.T) {
+	client := &mockDaemonClient{}
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "test",
+		DaemonClient:    client,
+		Logger:          slog.Default(),
+		GracePeriod:     time.Minute,
+		PortEventSource: &mockPortEventSource{},
+	})
+	sm.resolveProcessName = func(pid int) string { return "node" }
+	sm.resolveProcessCwd = func(pid int) string { return "" }
+	sm.findProcess = func(pid int) (process.Handle, bool) { return process.Handle{PID: pid, Start: 1}, true }
+	// pid 100 exited and a later process took its PID
+	started := map[int]uint64{100: 2, 200: 1}
+	sm.processRunning = func(h process.Handle) bool { return started[h.PID] == h.Start }
+
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 45175, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 200, Port: 45176, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	sm.checkExitedProcesses()
+
+	sm.mutex.RLock()
+	_, exitedPending := sm.pendingRemovals["45175"]
+	_, alivePending := sm.pendingRemovals["45176"]
+	sm.mutex.RUnlock()
+	if !exitedPending {
+		t.Error("exited process's forward was not scheduled for removal")
+	}
+	if alivePending {
+		t.Error("running process's forward was scheduled for removal")
+	}
+}
+
+func TestHandlePortEvent_ProcessExited(t *testing.T) {
+	client := &mockDaemonClient{}
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "test",
+		DaemonClient:    client,
+		Logger:          slog.Default(),
+		GracePeriod:     time.Minute,
+		PortEventSource: &mockPortEventSource{},
+	})
+	sm.resolveProcessName = func(pid int) string { return "node" }
+	sm.resolveProcessCwd = func(pid int) string { return "" }
+
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 45173, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 200, Port: 45174, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	if client.forwardCount() != 2 {
+		t.Fatalf("forward count = %d, want 2", client.forwardCount())
+	}
+
+	sm.handlePortEvent(PortEvent{Type: ProcessExited, PID: 100, Timestamp: time.Now()})
+
+	sm.mutex.RLock()
+	scheduled := sm.pendingRemovals["45173"]
+	_, otherPending := sm.pendingRemovals["45174"]
+	sm.mutex.RUnlock()
+	if scheduled.IsZero() {
+		t.Fatal("exited process's forward was not scheduled for removal")
+	}
+	if otherPending {
+		t.Error("another process's forward was scheduled for removal")
+	}
+
+	// The port being seen closed afterwards doesn't restart the grace period
+	sm.handlePortEvent(PortEvent{Type: PortClosed, Port: 45173, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	sm.mutex.RLock()
+	again := sm.pendingRemovals["45173"]
+	sm.mutex.RUnlock()
+	if !again.Equal(scheduled) {
+		t.Errorf("removal rescheduled from %v to %v", scheduled, again)
+	}
+}
+
+func TestHandlePortEvent_RangeGracePeriod(t *testing.T) {
+	noGrace := time.Duration(0)
+	client := &mockDaemonClient{}
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:    "test",
+		DaemonClient: client,
+		Logger:       slog.Default(),
+		GracePeriod:  time.Minute,
+		PortRanges: []PortRange{
+			{Start: 30000, End: 65535, GracePeriod: &noGrace},
+			{Start: 1024, End: 29999},
+		},
+		PortEventSource: &mockPortEventSource{},
+	})
+	sm.resolveProcessName = func(pid int) string { return "gh" }
+	sm.resolveProcessCwd = func(pid int) string { return "" }
+
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 3000, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 45173, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	sm.handlePortEvent(PortEvent{Type: PortClosed, Port: 3000, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	sm.handlePortEvent(PortEvent{Type: PortClosed, Port: 45173, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+
+	sm.mutex.RLock()
+	_, appPending := sm.pendingRemovals["3000"]
+	_, appActive := sm.activeForwards["3000"]
+	_, callbackPending := sm.pendingRemovals["45173"]
+	_, callbackActive := sm.activeForwards["45173"]
+	sm.mutex.RUnlock()
+	if !appPending || !appActive {
+		t.Error("forward in range without its own grace period was not kept for the session's")
+	}
+	if callbackPending || callbackActive {
+		t.Error("forward in range with no grace period was not removed immediately")
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	var unforwards int
+	for _, r := range client.requests {
+		if r.Type == protocol.CommandUnforward {
+			unforwards++
+		}
+	}
+	if unforwards != 1 {
+		t.Errorf("unforward count = %d, want 1", unforwards)
+	}
+}
+
+func TestRescan(t *testing.T) {
+	opened, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = opened.Close()
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	openedPort := opened.Addr().(*net.TCPAddr).Port
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+
+	client := &mockDaemonClient{}
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:    "test",
+		DaemonClient: client,
+		Logger:       slog.Default(),
+		PortRanges: []PortRange{
+			{Start: openedPort, End: openedPort},
+			{Start: closedPort, End: closedPort},
+		},
+		PortEventSource: &mockPortEventSource{},
+	})
+	sm.resolveProcessName = func(pid int) string { return "node" }
+	sm.resolveProcessCwd = func(pid int) string { return "" }
+	sm.resolveParentPID = func(pid int) int { return 0 }
+
+	// Forwarded before the host slept, and closed while it was asleep
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: closedPort, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	_ = closed.Close()
+
+	sm.Rescan()
+
+	sm.mutex.RLock()
+	_, openedActive := sm.activeForwards[strconv.Itoa(openedPort)]
+	_, closedPending := sm.pendingRemovals[strconv.Itoa(closedPort)]
+	sm.mutex.RUnlock()
+	if !openedActive {
+		t.Error("port opened while unobserved was not forwarded")
+	}
+	if !closedPending {
+		t.Error("forward of port closed while unobserved was not scheduled for removal")
+	}
+}
+
+func TestRescanKeepsReopenedAndSettles(t *testing.T) {
+	reopened, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reopened.Close()
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopenedPort := reopened.Addr().(*net.TCPAddr).Port
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	reopenedKey := strconv.Itoa(reopenedPort)
+	closedKey := strconv.Itoa(closedPort)
+
+	client := &mockDaemonClient{}
+	sm := newCoalescingMonitor(client)
+
+	// Closed before the host slept, and back by the time it woke
+	sm.handlePortEvent(PortEvent{Type: PortOpened, Port: reopenedPort, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	settleAll(sm)
+	sm.mutex.Lock()
+	sm.pendingRemovals[reopenedKey] = time.Now()
+	sm.mutex.Unlock()
+
+	// Opened just before the host slept, and closed while it was asleep
+	sm.handlePortEvent(PortEvent{Type: PortOpened, Port: closedPort, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	_ = closed.Close()
+
+	sm.Rescan()
+
+	sm.mutex.RLock()
+	_, reopenedPending := sm.pendingRemovals[reopenedKey]
+	_, reopenedActive := sm.activeForwards[reopenedKey]
+	_, closedPending := sm.pendingRemovals[closedKey]
+	_, closedSettling := sm.settling[closedKey]
+	sm.mutex.RUnlock()
+	if reopenedPending || !reopenedActive {
+		t.Errorf("forward of port listening again: pending = %v, active = %v, want kept", reopenedPending, reopenedActive)
+	}
+	if closedPending || !closedSettling {
+		t.Errorf("port closed right after opening: pending = %v, settling = %v, want held back to settle", closedPending, closedSettling)
+	}
+}
+
+func TestHandlePortEvent_NeverForwardProcesses(t *testing.T) {
+	client := &mockDaemonClient{}
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:             "test",
+		DaemonClient:          client,
+		Logger:                slog.Default(),
+		PortRanges:            []PortRange{{Start: 3000, End: 6000}},
+		AllowProcesses:        []string{"overmind"},
+		NeverForwardProcesses: []string{"postgres"},
+		PortEventSource:       &mockPortEventSource{},
+	})
+	names := map[int]string{100: "overmind", 200: "postgres", 300: "node"}
+	sm.resolveProcessName = func(pid int) string { return names[pid] }
+	sm.resolveProcessCwd = func(pid int) string { return "" }
+	sm.resolveParentPID = func(pid int) int {
+		if pid == 100 {
+			return 0
+		}
+		return 100
+	}
+
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 200, Port: 5432, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 300, Port: 3000, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+
+	sm.mutex.RLock()
+	_, postgresForwarded := sm.activeForwards["5432"]
+	_, nodeForwarded := sm.activeForwards["3000"]
+	sm.mutex.RUnlock()
+	if postgresForwarded {
+		t.Error("port of process in neverForwardProcesses was forwarded")
+	}
+	if !nodeForwarded {
+		t.Error("port of its allowed sibling was not forwarded")
+	}
+}
+
+func TestForwards(t *testing.T) {
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "test",
+		DaemonClient:    &mockDaemonClient{},
+		Logger:          slog.Default(),
+		PortEventSource: &mockPortEventSource{},
+	})
+	closedAt := time.Now()
+	sm.activeForwards["5173"] = ForwardInfo{Port: 5173, LocalPort: 5173, ProcessName: "vite"}
+	sm.activeForwards["3000"] = ForwardInfo{Port: 3000, LocalPort: 3000, ProcessName: "node"}
+	sm.pendingRemovals["5173"] = closedAt
+
+	forwards := sm.Forwards()
+	if len(forwards) != 2 || forwards[0].Port != 3000 || forwards[1].Port != 5173 {
+		t.Fatalf("forwards = %+v, want 3000 then 5173", forwards)
+	}
+	if !forwards[0].PendingSince.IsZero() {
+		t.Errorf("forward of 3000 pending since %v, want not pending", forwards[0].PendingSince)
+	}
+	if !forwards[1].PendingSince.Equal(closedAt) {
+		t.Errorf("forward of 5173 pending since %v, want %v", forwards[1].PendingSince, closedAt)
+	}
+}
@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Application protocols detectProtocol recognizes
+const (
+	AppProtocolHTTP  = "http"
+	AppProtocolHTTPS = "https"
+	AppProtocolH2C   = "h2c" // HTTP/2 without TLS, as gRPC servers speak
+)
+
+// sniffTimeout bounds each attempt at recognizing a port's protocol, so a
+// server that never answers delays its forward by a few seconds at most
+const sniffTimeout = time.Second
+
+// http2Preface opens an HTTP/2 connection with prior knowledge: the client
+// preface followed by an empty SETTINGS frame
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n" + "\x00\x00\x00\x04\x00\x00\x00\x00\x00"
+
+// http2FrameSettings is the type of an HTTP/2 SETTINGS frame
+const http2FrameSettings = 0x4
+
+// detectProtocol works out what a newly opened port speaks, trying TLS, then
+// plain HTTP, then HTTP/2 with prior knowledge. TLS goes first since HTTPS
+// servers answer plain HTTP with an error page. It returns the
+// application protocol, or "" if none was recognized, and for HTTP servers
+// what they call themselves, e.g. "Next.js" from X-Powered-By.
+func detectProtocol(ctx context.Context, event PortEvent) (appProtocol, server string) {
+	dial := healthCheckDialer(event)
+	host := net.JoinHostPort(namespaceDialAddr(event.BindAddr), strconv.Itoa(event.Port))
+
+	if server, ok := sniffConn(ctx, dial, host, func(conn net.Conn) (string, bool) {
+		tlsConn := tls.Client(conn, &tls.Config{
+			// Dev servers use self-signed certificates; nothing is trusted
+			// from this connection beyond the handshake working
+			InsecureSkipVerify: true,
+			ServerName:         "localhost",
+			NextProtos:         []string{"http/1.1"},
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			return "", false
+		}
+		server, _ := sniffHTTP(tlsConn, host)
+		return server, true
+	}); ok {
+		return AppProtocolHTTPS, server
+	}
+
+	if server, ok := sniffConn(ctx, dial, host, func(conn net.Conn) (string, bool) {
+		return sniffHTTP(conn, host)
+	}); ok {
+		return AppProtocolHTTP, server
+	}
+
+	if _, ok := sniffConn(ctx, dial, host, sniffHTTP2); ok {
+		return AppProtocolH2C, ""
+	}
+	return "", ""
+}
+
+// sniffConn connects to addr and runs probe on the connection, giving it
+// sniffTimeout to answer
+func sniffConn(ctx context.Context, dial dialFunc, addr string, probe func(net.Conn) (string, bool)) (string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, sniffTimeout)
+	defer cancel()
+
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return "", false
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	return probe(conn)
+}
+
+// sniffHTTP sends an HTTP/1.1 request for / and reports whether an HTTP
+// response came back, and the server's self-description
+func sniffHTTP(conn net.Conn, host string) (string, bool) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+	if err != nil {
+		return "", false
+	}
+	req.Header.Set("User-Agent", "bankshot")
+	req.Close = true
+	if err := req.Write(conn); err != nil {
+		return "", false
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return "", false
+	}
+	_ = resp.Body.Close()
+	return serverLabel(resp.Header), true
+}
+
+// sniffHTTP2 opens an HTTP/2 connection without TLS and reports whether the
+// server answered with its SETTINGS, as gRPC and other h2c servers do
+func sniffHTTP2(conn net.Conn) (string, bool) {
+	if _, err := io.WriteString(conn, http2Preface); err != nil {
+		return "", false
+	}
+	// Frame header: 24-bit length, type, flags, stream ID
+	var header [9]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return "", false
+	}
+	return "", header[3] == http2FrameSettings
+}
+
+// serverLabel names the software behind an HTTP response: the framework from
+// X-Powered-By if there is one, else the Server header's first product,
+// without its version
+func serverLabel(header http.Header) string {
+	label := header.Get("X-Powered-By")
+	if label == "" {
+		label = header.Get("Server")
+	}
+	label = strings.TrimSpace(label)
+	if i := strings.IndexAny(label, " ,"); i >= 0 {
+		label = label[:i]
+	}
+	if i := strings.Index(label, "/"); i >= 0 {
+		label = label[:i]
+	}
+	return label
+}
@@ -0,0 +1,157 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+// serveRaw accepts connections on a loopback listener and hands each to
+// handle, returning a PortOpened event for the listener
+func serveRaw(t *testing.T, handle func(net.Conn)) PortEvent {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() {
+					_ = conn.Close()
+				}()
+				handle(conn)
+			}()
+		}
+	}()
+	return listenerEvent(t, ln.Addr())
+}
+
+func TestDetectProtocol(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Powered-By", "Next.js")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer httpServer.Close()
+
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.25.3")
+	}))
+	defer tlsServer.Close()
+
+	// Answers an HTTP/2 preface with its SETTINGS, and hangs up on anything
+	// else, as gRPC servers do
+	grpcServer := serveRaw(t, func(conn net.Conn) {
+		preface := make([]byte, len(http2Preface))
+		if _, err := io.ReadFull(conn, preface); err != nil || string(preface) != http2Preface {
+			return
+		}
+		_, _ = conn.Write([]byte{0, 0, 0, http2FrameSettings, 0, 0, 0, 0, 0})
+	})
+
+	// Speaks first, like a database or ssh
+	bannerServer := serveRaw(t, func(conn net.Conn) {
+		_, _ = io.WriteString(conn, "SSH-2.0-OpenSSH_9.6\r\n")
+	})
+
+	tests := []struct {
+		name         string
+		event        PortEvent
+		wantProtocol string
+		wantServer   string
+	}{
+		{"http", listenerEvent(t, httpServer.Listener.Addr()), AppProtocolHTTP, "Next.js"},
+		{"https", listenerEvent(t, tlsServer.Listener.Addr()), AppProtocolHTTPS, "nginx"},
+		{"h2c", grpcServer, AppProtocolH2C, ""},
+		{"banner", bannerServer, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protocol, server := detectProtocol(context.Background(), tt.event)
+			if protocol != tt.wantProtocol || server != tt.wantServer {
+				t.Errorf("detectProtocol() = %q, %q, want %q, %q", protocol, server, tt.wantProtocol, tt.wantServer)
+			}
+		})
+	}
+}
+
+func TestServerLabel(t *testing.T) {
+	tests := []struct {
+		poweredBy string
+		server    string
+		want      string
+	}{
+		{"Next.js", "", "Next.js"},
+		{"Express", "nginx", "Express"},
+		{"", "Werkzeug/3.0.1 Python/3.12.2", "Werkzeug"},
+		{"", "uvicorn", "uvicorn"},
+		{"PHP/8.3.1, ASP.NET", "", "PHP"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.poweredBy != "" {
+			header.Set("X-Powered-By", tt.poweredBy)
+		}
+		if tt.server != "" {
+			header.Set("Server", tt.server)
+		}
+		if got := serverLabel(header); got != tt.want {
+			t.Errorf("serverLabel(%q, %q) = %q, want %q", tt.poweredBy, tt.server, got, tt.want)
+		}
+	}
+}
+
+func TestHandlePortEvent_DetectProtocols(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Powered-By", "Express")
+	}))
+	defer server.Close()
+
+	client := &mockDaemonClient{}
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "test",
+		DaemonClient:    client,
+		Logger:          slog.Default(),
+		DetectProtocols: true,
+		PortEventSource: &mockPortEventSource{},
+	})
+	sm.resolveProcessName = func(pid int) string { return "node" }
+	sm.resolveProcessCwd = func(pid int) string { return "" }
+
+	sm.handlePortEvent(listenerEvent(t, server.Listener.Addr()))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for client.forwardCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("port was not forwarded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	client.mu.Lock()
+	var req protocol.ForwardRequest
+	err := json.Unmarshal(client.requests[0].Payload, &req)
+	client.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.AppProtocol != AppProtocolHTTP || req.Server != "Express" {
+		t.Errorf("forward request app protocol, server = %q, %q, want %q, %q", req.AppProtocol, req.Server, AppProtocolHTTP, "Express")
+	}
+}
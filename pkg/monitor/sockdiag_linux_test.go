@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// inetDiagMessage builds a netlink message carrying an inet_diag_msg for a
+// listener on addr:port
+func inetDiagMessage(family uint8, addr net.IP, port uint16, inode uint32) []byte {
+	b := make([]byte, unix.SizeofNlMsghdr+inetDiagMsgLen)
+	binary.NativeEndian.PutUint32(b[0:4], uint32(len(b)))
+	binary.NativeEndian.PutUint16(b[4:6], unix.SOCK_DIAG_BY_FAMILY)
+
+	msg := b[unix.SizeofNlMsghdr:]
+	msg[0] = family
+	msg[1] = tcpListen
+	binary.BigEndian.PutUint16(msg[4:6], port)
+	copy(msg[8:24], addr)
+	binary.NativeEndian.PutUint32(msg[68:72], inode)
+	return b
+}
+
+func TestParseSockDiagReply(t *testing.T) {
+	var reply []byte
+	reply = append(reply, inetDiagMessage(unix.AF_INET, net.IPv4(127, 0, 0, 1).To4(), 8080, 12346)...)
+	reply = append(reply, inetDiagMessage(unix.AF_INET6, net.IPv6zero, 3000, 12347)...)
+
+	ports, done, err := parseSockDiagReply(reply, "tcp")
+	if err != nil {
+		t.Fatalf("parseSockDiagReply failed: %v", err)
+	}
+	if done {
+		t.Error("expected the dump to continue without NLMSG_DONE")
+	}
+	if len(ports) != 2 {
+		t.Fatalf("expected 2 ports, got %+v", ports)
+	}
+	if ports[0].Port != 8080 || ports[0].BindAddr != "127.0.0.1" || ports[0].Inode != 12346 {
+		t.Errorf("unexpected IPv4 listener: %+v", ports[0])
+	}
+	if ports[1].Port != 3000 || ports[1].BindAddr != "::" {
+		t.Errorf("unexpected IPv6 listener: %+v", ports[1])
+	}
+
+	doneMsg := make([]byte, unix.SizeofNlMsghdr+4)
+	binary.NativeEndian.PutUint32(doneMsg[0:4], uint32(len(doneMsg)))
+	binary.NativeEndian.PutUint16(doneMsg[4:6], unix.NLMSG_DONE)
+	if _, done, err := parseSockDiagReply(doneMsg, "tcp"); err != nil || !done {
+		t.Errorf("expected NLMSG_DONE to end the dump, got done=%v err=%v", done, err)
+	}
+
+	errMsg := make([]byte, unix.SizeofNlMsghdr+4)
+	binary.NativeEndian.PutUint32(errMsg[0:4], uint32(len(errMsg)))
+	binary.NativeEndian.PutUint16(errMsg[4:6], unix.NLMSG_ERROR)
+	errno := -int32(unix.EPERM)
+	binary.NativeEndian.PutUint32(errMsg[16:20], uint32(errno))
+	if _, _, err := parseSockDiagReply(errMsg, "tcp"); err != unix.EPERM {
+		t.Errorf("expected EPERM from NLMSG_ERROR, got %v", err)
+	}
+}
+
+func TestGetListeningPortsSockDiag(t *testing.T) {
+	if err := probeSockDiag(); err != nil {
+		t.Skipf("sock_diag not available: %v", err)
+	}
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	ports, err := GetListeningPortsSockDiag()
+	if err != nil {
+		t.Fatalf("GetListeningPortsSockDiag failed: %v", err)
+	}
+	for _, p := range ports {
+		if p.Port == port && p.Protocol == "tcp" && p.BindAddr == "127.0.0.1" {
+			return
+		}
+	}
+	t.Errorf("listener on 127.0.0.1:%d not found in %+v", port, ports)
+}
@@ -1,6 +1,10 @@
 package monitor
 
-import "context"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
 // PortEventSource is implemented by any monitor that can emit port events.
 // Both polling-based monitors and eBPF monitors satisfy this interface.
@@ -8,3 +12,119 @@ type PortEventSource interface {
 	Start(ctx context.Context) error
 	Events() <-chan PortEvent
 }
+
+// Kinds of system-wide port event source, for SourceOptions.Source
+const (
+	SourceAuto    = "auto"    // The best one available
+	SourceEBPF    = "ebpf"    // eBPF tracepoint (Linux)
+	SourceNetlink = "netlink" // Polling with NETLINK_SOCK_DIAG queries (Linux)
+	SourcePoll    = "poll"    // Polling /proc/net, or the platform's equivalent
+)
+
+// SourceOptions selects the kind of system-wide PortEventSource and what it
+// reports beyond the host's TCP listeners
+type SourceOptions struct {
+	Source     string // One of the Source* kinds ("" = SourceAuto)
+	UDP        bool   // Bound UDP ports, which are reported but never forwarded
+	Namespaces bool   // Listeners inside the network namespaces of the user's processes
+
+	Debounce    time.Duration // How long a new port must stay open before it's reported (0 = DefaultDebounce)
+	EventBuffer int           // Events buffered for the consumer before new ones are dropped (0 = DefaultEventBuffer)
+}
+
+// eventBuffer returns the configured event buffer size, or the default
+func (o SourceOptions) eventBuffer() int {
+	if o.EventBuffer > 0 {
+		return o.EventBuffer
+	}
+	return DefaultEventBuffer
+}
+
+// configure applies the options to a polling monitor
+func (o SourceOptions) configure(m *SystemMonitor) *SystemMonitor {
+	m.WithEventBuffer(o.eventBuffer())
+	if o.Debounce > 0 {
+		m.WithDebounce(o.Debounce)
+	}
+	if o.UDP {
+		m.WithUDP()
+	}
+	return m
+}
+
+// pollScheduler is a polling source that can check the ports of some
+// ranges on their own schedule
+type pollScheduler interface {
+	SetPollRanges(ranges []PortRange)
+}
+
+// setPollRanges passes ranges on to source if it polls, and does nothing
+// for sources that don't
+func setPollRanges(source any, ranges []PortRange) {
+	if s, ok := source.(pollScheduler); ok {
+		s.SetPollRanges(ranges)
+	}
+}
+
+// mergedSource combines the events of several sources into one stream
+type mergedSource struct {
+	sources []PortEventSource
+	events  chan PortEvent
+}
+
+// mergeSources returns a PortEventSource emitting the events of all sources.
+// Its channel closes once every source's has.
+func mergeSources(buffer int, sources ...PortEventSource) PortEventSource {
+	return &mergedSource{
+		sources: sources,
+		events:  make(chan PortEvent, buffer),
+	}
+}
+
+// Start starts every source, forwarding their events as they arrive
+func (m *mergedSource) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, source := range m.sources {
+		// Forward before starting, since sources may emit their initial
+		// ports from Start
+		wg.Add(1)
+		go func(events <-chan PortEvent) {
+			defer wg.Done()
+			for event := range events {
+				m.events <- event
+			}
+		}(source.Events())
+	}
+	go func() {
+		wg.Wait()
+		close(m.events)
+	}()
+
+	for _, source := range m.sources {
+		if err := source.Start(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Events returns the merged channel of port events
+func (m *mergedSource) Events() <-chan PortEvent {
+	return m.events
+}
+
+// SetPollRanges passes ranges on to the sources that poll
+func (m *mergedSource) SetPollRanges(ranges []PortRange) {
+	for _, source := range m.sources {
+		setPollRanges(source, ranges)
+	}
+}
+
+// Dropped returns how many events the sources dropped, together
+func (m *mergedSource) Dropped() uint64 {
+	var dropped uint64
+	for _, source := range m.sources {
+		dropped += droppedEvents(source)
+	}
+	return dropped
+}
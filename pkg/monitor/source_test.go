@@ -1,7 +1,30 @@
 package monitor
 
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
 // Compile-time checks that our monitors satisfy PortEventSource.
 var (
 	_ PortEventSource = (*Monitor)(nil)
 	_ PortEventSource = (*SystemMonitor)(nil)
 )
+
+func TestNewSystemPortEventSourceSelection(t *testing.T) {
+	src, kind, err := NewSystemPortEventSource(slog.Default(), time.Second, SourceOptions{Source: SourcePoll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != SourcePoll {
+		t.Errorf("kind = %q, want %q", kind, SourcePoll)
+	}
+	if _, ok := src.(*SystemMonitor); !ok {
+		t.Errorf("source = %T, want *SystemMonitor", src)
+	}
+
+	if _, _, err := NewSystemPortEventSource(slog.Default(), time.Second, SourceOptions{Source: "kprobe"}); err == nil {
+		t.Error("expected error for unknown source")
+	}
+}
@@ -0,0 +1,158 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// sessionState is what a session monitor keeps in its state file, so a
+// restarted monitor picks up the forwards it made before
+type sessionState struct {
+	SessionID string                 `json:"session_id"`
+	Forwards  map[string]ForwardInfo `json:"forwards"` // As activeForwards
+	SavedAt   time.Time              `json:"saved_at"`
+}
+
+// saveState writes the session's forwards to its state file, if it has one.
+// Must be called with m.mutex held.
+func (m *SessionMonitor) saveState() {
+	if m.stateFile == "" {
+		return
+	}
+	if err := writeState(m.stateFile, sessionState{
+		SessionID: m.sessionID,
+		Forwards:  m.activeForwards,
+		SavedAt:   time.Now(),
+	}); err != nil {
+		m.logger.Warn("Failed to save monitor state", "path", m.stateFile, "error", err)
+	}
+}
+
+// writeState replaces the state file at path, so a crash mid-write leaves
+// the previous state rather than a truncated one
+func writeState(path string, state sessionState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// restoreState adopts the forwards a previous run of the monitor left in
+// its state file. Ports and sockets still there keep their forwards without
+// asking the daemon again; forwards of those gone, of those the port,
+// process, and socket rules no longer forward, and of ports in other network
+// namespaces, whose relays ended with the previous run, are removed.
+// Must be called before the port sources start, so their first events find
+// the forwards in place.
+func (m *SessionMonitor) restoreState() {
+	if m.stateFile == "" {
+		return
+	}
+	data, err := os.ReadFile(m.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		m.logger.Warn("Failed to read monitor state", "path", m.stateFile, "error", err)
+		return
+	}
+	var state sessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		m.logger.Warn("Ignoring unreadable monitor state", "path", m.stateFile, "error", err)
+		return
+	}
+	if state.SessionID != m.sessionID {
+		m.logger.Info("Ignoring monitor state of another session", "session", state.SessionID)
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var adopted, removed int
+	for key, fwd := range state.Forwards {
+		if reason := m.excludedReason(fwd); reason != "" {
+			m.logger.Info("Removing restored forward the rules now exclude",
+				"port", fwd.Port,
+				"socket", fwd.RemoteSocket,
+				"reason", reason)
+		} else if fwd.Netns == 0 && forwardStillBacked(fwd) {
+			m.activeForwards[key] = fwd
+			adopted++
+			continue
+		}
+		m.removeForward(fwd)
+		removed++
+	}
+	m.saveState()
+
+	m.logger.Info("Restored forwards from monitor state",
+		"path", m.stateFile,
+		"adopted", adopted,
+		"removed", removed,
+		"savedAt", state.SavedAt)
+}
+
+// excludedReason returns why the current rules no longer forward a restored
+// forward, or "" if they still do. The rules may have changed while the
+// monitor was down, and a port is only checked against them when it opens.
+func (m *SessionMonitor) excludedReason(fwd ForwardInfo) string {
+	if fwd.RemoteSocket != "" {
+		if _, ok := m.socketRule(fwd.RemoteSocket); !ok {
+			return "no longer matches a socket rule"
+		}
+		return ""
+	}
+
+	// Its bind address was checked when it was forwarded, and can't have
+	// changed while the port stayed open
+	if !m.shouldForwardPort(fwd.Port, "127.0.0.1") {
+		return m.filterReason(fwd.Port, "127.0.0.1")
+	}
+
+	filters := m.filters.Load()
+	event := PortEvent{PID: fwd.PID, Port: fwd.Port, ProcessName: fwd.ProcessName}
+	if fwd.PID != 0 && (needsCmdline(filters.processMatchers) || needsCmdline(filters.allowMatchers) || needsCmdline(filters.neverMatchers)) {
+		event.ProcessCmd = m.resolveProcessCmd(fwd.PID)
+	}
+	if fwd.ProcessName != "" && matchesAny(filters.neverMatchers, event.ProcessName, event.ProcessCmd) {
+		return "neverForwardProcesses matched " + fwd.ProcessName
+	}
+	if fwd.PID != 0 && len(filters.processMatchers) > 0 {
+		if ignored, matchedName := m.matchProcessTree(filters.processMatchers, event); ignored {
+			return "ignoreProcesses matched " + matchedName
+		}
+	}
+	if len(filters.allowMatchers) > 0 {
+		allowed := false
+		if fwd.PID != 0 {
+			allowed, _ = m.matchProcessTree(filters.allowMatchers, event)
+		}
+		if !allowed {
+			return "not in allowProcesses: " + fwd.ProcessName
+		}
+	}
+	return ""
+}
+
+// forwardStillBacked reports whether what a restored host forward points at
+// is still there: a listening port, or a socket file
+func forwardStillBacked(fwd ForwardInfo) bool {
+	if fwd.RemoteSocket != "" {
+		_, err := os.Stat(fwd.RemoteSocket)
+		return err == nil
+	}
+	return portStillListening(fwd.Port, 0)
+}
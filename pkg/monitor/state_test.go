@@ -0,0 +1,140 @@
+package monitor
+
+import (
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+func TestStateFile(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	openPort := listener.Addr().(*net.TCPAddr).Port
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+
+	stateFile := filepath.Join(t.TempDir(), "state", "monitor.json")
+	newMonitor := func(client DaemonClient) *SessionMonitor {
+		sm, _ := NewSessionMonitor(SessionConfig{
+			SessionID:       "test",
+			DaemonClient:    client,
+			Logger:          slog.Default(),
+			PortEventSource: &mockPortEventSource{},
+			StateFile:       stateFile,
+		})
+		sm.resolveProcessName = func(pid int) string { return "node" }
+		sm.resolveProcessCwd = func(pid int) string { return "" }
+		sm.resolveParentPID = func(pid int) int { return 0 }
+		return sm
+	}
+
+	first := newMonitor(&mockDaemonClient{})
+	first.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: openPort, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	first.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: closedPort, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	_ = first.cleanup()
+	_ = closed.Close()
+
+	client := &mockDaemonClient{}
+	second := newMonitor(client)
+	second.restoreState()
+
+	second.mutex.RLock()
+	fwd, adopted := second.activeForwards[strconv.Itoa(openPort)]
+	_, kept := second.activeForwards[strconv.Itoa(closedPort)]
+	second.mutex.RUnlock()
+	if !adopted || fwd.ProcessName != "node" {
+		t.Errorf("forward of port still listening = %+v, %v, want it adopted", fwd, adopted)
+	}
+	if kept {
+		t.Error("forward of port closed while the monitor was down was adopted")
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if len(client.requests) != 1 || client.requests[0].Type != protocol.CommandUnforward {
+		t.Errorf("requests on restore = %+v, want only the closed port's unforward", client.requests)
+	}
+}
+
+func TestRestoreStateAppliesFilters(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name        string
+		filters     Filters
+		wantAdopted bool
+	}{
+		{"unchanged", Filters{}, true},
+		{"port now ignored", Filters{IgnorePorts: []int{port}}, false},
+		{"port outside the ranges", Filters{PortRanges: []PortRange{{Start: 1, End: 1023}}}, false},
+		{"process now ignored", Filters{IgnoreProcesses: []string{"node"}}, false},
+		{"process not allowed", Filters{AllowProcesses: []string{"python"}}, false},
+		{"process allowed", Filters{AllowProcesses: []string{"node"}}, true},
+		{"process never forwarded", Filters{NeverForwardProcesses: []string{"node"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stateFile := filepath.Join(t.TempDir(), "monitor.json")
+			if err := writeState(stateFile, sessionState{
+				SessionID: "test",
+				Forwards: map[string]ForwardInfo{
+					strconv.Itoa(port): {PID: 100, Port: port, LocalPort: port, ProcessName: "node"},
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			client := &mockDaemonClient{}
+			sm, _ := NewSessionMonitor(SessionConfig{
+				SessionID:             "test",
+				DaemonClient:          client,
+				Logger:                slog.Default(),
+				PortEventSource:       &mockPortEventSource{},
+				StateFile:             stateFile,
+				PortRanges:            tt.filters.PortRanges,
+				IgnorePorts:           tt.filters.IgnorePorts,
+				IgnoreProcesses:       tt.filters.IgnoreProcesses,
+				AllowProcesses:        tt.filters.AllowProcesses,
+				NeverForwardProcesses: tt.filters.NeverForwardProcesses,
+			})
+			sm.resolveProcessName = func(pid int) string { return "node" }
+			sm.resolveProcessCmd = func(pid int) string { return "node server.js" }
+			sm.resolveParentPID = func(pid int) int { return 0 }
+			sm.restoreState()
+
+			sm.mutex.RLock()
+			_, adopted := sm.activeForwards[strconv.Itoa(port)]
+			sm.mutex.RUnlock()
+			if adopted != tt.wantAdopted {
+				t.Errorf("adopted = %v, want %v", adopted, tt.wantAdopted)
+			}
+
+			client.mu.Lock()
+			defer client.mu.Unlock()
+			if removed := len(client.requests) == 1 && client.requests[0].Type == protocol.CommandUnforward; removed == tt.wantAdopted {
+				t.Errorf("requests on restore = %+v, want an unforward only for a forward not adopted", client.requests)
+			}
+		})
+	}
+}
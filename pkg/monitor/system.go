@@ -4,49 +4,230 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Defaults for how long a new port must stay open before it's reported, and
+// how many events a source buffers for a slow consumer
+const (
+	DefaultDebounce    = 100 * time.Millisecond
+	DefaultEventBuffer = 50
+)
+
 // SystemMonitor monitors all listening ports on the system
 type SystemMonitor struct {
 	pollInterval time.Duration
 	debounceTime time.Duration
 	logger       *slog.Logger
 	events       chan PortEvent
+	listPorts    func() ([]Port, error) // defaults to GetListeningPorts
+	dropped      atomic.Uint64          // Events dropped because the consumer fell behind
+	reschedule   chan struct{}          // wakes monitorLoop when the poll ranges change
 
 	mu           sync.RWMutex
-	knownPorts   map[string]Port // key: "port:protocol"
+	knownPorts   map[string]Port // key: systemPortKey; the first socket of the port's group
 	pendingPorts map[string]time.Time
+	pollRanges   []PortRange                 // ranges whose ports are checked on their own schedule
+	lastChecked  map[time.Duration]time.Time // when the ports checked at each interval last were
 }
 
 // NewSystemMonitor creates a new system-wide port monitor
 func NewSystemMonitor(logger *slog.Logger, pollInterval time.Duration) *SystemMonitor {
 	return &SystemMonitor{
 		pollInterval: pollInterval,
-		debounceTime: 100 * time.Millisecond,
+		debounceTime: DefaultDebounce,
 		logger:       logger,
-		events:       make(chan PortEvent, 50),
+		events:       make(chan PortEvent, DefaultEventBuffer),
+		listPorts:    GetListeningPorts,
+		reschedule:   make(chan struct{}, 1),
 		knownPorts:   make(map[string]Port),
 		pendingPorts: make(map[string]time.Time),
+		lastChecked:  make(map[time.Duration]time.Time),
+	}
+}
+
+// NewUDPMonitor creates a system-wide monitor for bound UDP ports only, to
+// run alongside a TCP source that can't see UDP (like the eBPF monitor)
+func NewUDPMonitor(logger *slog.Logger, pollInterval time.Duration) *SystemMonitor {
+	m := NewSystemMonitor(logger, pollInterval)
+	m.listPorts = GetUDPPorts
+	return m
+}
+
+// WithDebounce sets how long a new port must stay open before it's reported,
+// so servers that restart in quick succession don't flap forwards
+func (m *SystemMonitor) WithDebounce(d time.Duration) *SystemMonitor {
+	m.debounceTime = d
+	return m
+}
+
+// WithEventBuffer sets how many events are buffered before new ones are
+// dropped. It replaces the event channel, so it must be called before
+// Events.
+func (m *SystemMonitor) WithEventBuffer(n int) *SystemMonitor {
+	m.events = make(chan PortEvent, n)
+	return m
+}
+
+// WithUDP makes the monitor report bound UDP ports alongside TCP listeners
+func (m *SystemMonitor) WithUDP() *SystemMonitor {
+	listTCP := m.listPorts
+	m.listPorts = func() ([]Port, error) {
+		ports, err := listTCP()
+		if err != nil {
+			return nil, err
+		}
+		udpPorts, err := GetUDPPorts()
+		if err != nil {
+			return nil, err
+		}
+		return append(ports, udpPorts...), nil
+	}
+	return m
+}
+
+// WithNamespaces makes the monitor also report listeners inside the network
+// namespaces of the user's processes, such as rootless containers
+func (m *SystemMonitor) WithNamespaces() *SystemMonitor {
+	listHost := m.listPorts
+	m.listPorts = func() ([]Port, error) {
+		ports, err := listHost()
+		if err != nil {
+			return nil, err
+		}
+		nsPorts, err := GetNamespaceListeningPorts()
+		if err != nil {
+			m.logger.Debug("failed to scan network namespaces", "error", err)
+			return ports, nil
+		}
+		return append(ports, nsPorts...), nil
+	}
+	return m
+}
+
+// SetPollRanges has the ports of ranges with a PollInterval checked that
+// often instead of at the monitor's own interval. A port in several such
+// ranges goes by the shortest. It may be called while the monitor runs.
+func (m *SystemMonitor) SetPollRanges(ranges []PortRange) {
+	var polled []PortRange
+	for _, r := range ranges {
+		if r.PollInterval > 0 {
+			polled = append(polled, r)
+		}
+	}
+
+	m.mu.Lock()
+	m.pollRanges = polled
+	m.mu.Unlock()
+
+	select {
+	case m.reschedule <- struct{}{}:
+	default:
+	}
+}
+
+// portInterval returns how often port is checked. m.mu must be held.
+func (m *SystemMonitor) portInterval(port int) time.Duration {
+	interval := time.Duration(0)
+	for _, r := range m.pollRanges {
+		if r.contains(port) && (interval == 0 || r.PollInterval < interval) {
+			interval = r.PollInterval
+		}
+	}
+	if interval == 0 {
+		return m.pollInterval
+	}
+	return interval
+}
+
+// tickInterval returns how often monitorLoop wakes, the shortest interval
+// any port is checked at. m.mu must be held.
+func (m *SystemMonitor) tickInterval() time.Duration {
+	tick := m.pollInterval
+	for _, r := range m.pollRanges {
+		tick = min(tick, r.PollInterval)
+	}
+	return tick
+}
+
+// dueIntervals returns the intervals whose ports are due to be checked at
+// now, marking them checked. A schedule may run up to half a tick early, so
+// one the tick doesn't divide is checked at the nearest tick rather than
+// the one after.
+func (m *SystemMonitor) dueIntervals(now time.Time) map[time.Duration]bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tick := m.tickInterval()
+	due := make(map[time.Duration]bool)
+	check := func(interval time.Duration) {
+		if now.Sub(m.lastChecked[interval]) >= interval-tick/2 {
+			due[interval] = true
+			m.lastChecked[interval] = now
+		}
+	}
+	check(m.pollInterval)
+	for _, r := range m.pollRanges {
+		if !due[r.PollInterval] {
+			check(r.PollInterval)
+		}
 	}
+	return due
+}
+
+// systemPortKey identifies a port across polls: "port:protocol", with the
+// namespace appended for ports outside the host's
+func systemPortKey(port Port) string {
+	if port.Netns != 0 {
+		return fmt.Sprintf("%d:%s:%d", port.Port, port.Protocol, port.Netns)
+	}
+	return fmt.Sprintf("%d:%s", port.Port, port.Protocol)
+}
+
+// groupPorts collects ports by systemPortKey, each group sorted by socket
+// inode. Servers using SO_REUSEPORT listen on one port with a socket per
+// worker, which come and go as workers restart; as a group they're one
+// logical port, open until its last socket closes.
+func groupPorts(ports []Port) map[string][]Port {
+	groups := make(map[string][]Port)
+	for _, port := range ports {
+		key := systemPortKey(port)
+		groups[key] = append(groups[key], port)
+	}
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool { return group[i].Inode < group[j].Inode })
+	}
+	return groups
+}
+
+// hasSocket reports whether group holds the socket with the given inode
+func hasSocket(group []Port, inode uint64) bool {
+	for _, port := range group {
+		if port.Inode == inode {
+			return true
+		}
+	}
+	return false
 }
 
 // Start begins monitoring system-wide ports
 func (m *SystemMonitor) Start(ctx context.Context) error {
 	// Get initial port state
-	initialPorts, err := GetListeningPorts()
+	initialPorts, err := m.listPorts()
 	if err != nil {
 		m.logger.Warn("failed to get initial ports", "error", err)
 	}
 
 	m.mu.Lock()
-	for _, port := range initialPorts {
-		key := fmt.Sprintf("%d:%s", port.Port, port.Protocol)
-		m.knownPorts[key] = port
+	for key, group := range groupPorts(initialPorts) {
+		m.knownPorts[key] = group[0]
 		m.logger.Debug("initial port detected",
-			"port", port.Port,
-			"protocol", port.Protocol)
+			"port", group[0].Port,
+			"protocol", group[0].Protocol,
+			"sockets", len(group))
 	}
 	m.mu.Unlock()
 
@@ -64,9 +245,18 @@ func (m *SystemMonitor) Events() <-chan PortEvent {
 	return m.events
 }
 
-// monitorLoop polls for port changes
+// Dropped returns how many events were dropped because the consumer fell
+// behind
+func (m *SystemMonitor) Dropped() uint64 {
+	return m.dropped.Load()
+}
+
+// monitorLoop polls for port changes, checking each port on its range's
+// schedule
 func (m *SystemMonitor) monitorLoop(ctx context.Context) {
-	ticker := time.NewTicker(m.pollInterval)
+	m.mu.RLock()
+	ticker := time.NewTicker(m.tickInterval())
+	m.mu.RUnlock()
 	defer ticker.Stop()
 
 	for {
@@ -74,57 +264,81 @@ func (m *SystemMonitor) monitorLoop(ctx context.Context) {
 		case <-ctx.Done():
 			close(m.events)
 			return
-		case <-ticker.C:
-			m.checkPorts()
+		case <-m.reschedule:
+			m.mu.RLock()
+			ticker.Reset(m.tickInterval())
+			m.mu.RUnlock()
+		case now := <-ticker.C:
+			due := m.dueIntervals(now)
+			if len(due) > 0 {
+				m.checkPortsWhere(func(port int) bool { return due[m.portInterval(port)] })
+			}
 		}
 	}
 }
 
-// checkPorts scans for port changes
+// checkPorts scans for changes to any port
 func (m *SystemMonitor) checkPorts() {
-	currentPorts, err := GetListeningPorts()
+	m.checkPortsWhere(func(int) bool { return true })
+}
+
+// checkPortsWhere scans for changes to the ports due says to check, leaving
+// the rest for a later scan. due is called with m.mu held.
+func (m *SystemMonitor) checkPortsWhere(due func(port int) bool) {
+	currentPorts, err := m.listPorts()
 	if err != nil {
 		m.logger.Debug("failed to get ports", "error", err)
 		return
 	}
 
-	// Create map of current ports for easy lookup
-	currentMap := make(map[string]Port)
-	for _, port := range currentPorts {
-		key := fmt.Sprintf("%d:%s", port.Port, port.Protocol)
-		currentMap[key] = port
-	}
+	currentMap := groupPorts(currentPorts)
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Check for new ports
-	for key, port := range currentMap {
-		if _, exists := m.knownPorts[key]; !exists {
+	for key, group := range currentMap {
+		if !due(group[0].Port) {
+			continue
+		}
+		knownPort, exists := m.knownPorts[key]
+		if !exists {
 			// New port detected - add to pending for debouncing
 			if _, pending := m.pendingPorts[key]; !pending {
 				m.pendingPorts[key] = time.Now()
-				m.logger.Debug("new port detected (pending)", "port", port.Port, "protocol", port.Protocol)
+				m.logger.Debug("new port detected (pending)", "port", group[0].Port, "protocol", group[0].Protocol)
 			}
+			continue
+		}
+		// A worker of an SO_REUSEPORT group went away, but the port is
+		// still held by the rest of the group
+		if !hasSocket(group, knownPort.Inode) {
+			m.knownPorts[key] = group[0]
+			m.logger.Debug("listener socket replaced within its port's group",
+				"port", knownPort.Port,
+				"protocol", knownPort.Protocol,
+				"sockets", len(group))
 		}
 	}
 
 	// Check for closed ports
 	for key, knownPort := range m.knownPorts {
+		if !due(knownPort.Port) {
+			continue
+		}
 		if _, exists := currentMap[key]; !exists {
 			// Port closed
 			delete(m.knownPorts, key)
 			delete(m.pendingPorts, key)
 
-			// Try to find which PID owns this port (best effort)
-			pid := m.findPortOwner(knownPort)
-
+			// The socket is gone, so its owner can't be looked up anymore
 			event := PortEvent{
 				Type:      PortClosed,
-				PID:       pid,
 				Port:      knownPort.Port,
 				Protocol:  knownPort.Protocol,
 				BindAddr:  knownPort.BindAddr,
+				Netns:     knownPort.Netns,
+				NetnsPID:  knownPort.NetnsPID,
 				Timestamp: time.Now(),
 			}
 
@@ -135,6 +349,7 @@ func (m *SystemMonitor) checkPorts() {
 					"protocol", knownPort.Protocol)
 			default:
 				m.logger.Warn("event channel full, dropping closed event")
+				m.dropped.Add(1)
 			}
 		}
 	}
@@ -165,56 +380,64 @@ func (m *SystemMonitor) processPendingPorts() {
 	for key, pendingSince := range m.pendingPorts {
 		if now.Sub(pendingSince) >= m.debounceTime {
 			// Port has been stable - check if it still exists
-			currentPorts, err := GetListeningPorts()
+			currentPorts, err := m.listPorts()
 			if err != nil {
 				continue
 			}
 
 			// Find this port in current state
-			for _, port := range currentPorts {
-				portKey := fmt.Sprintf("%d:%s", port.Port, port.Protocol)
-				if portKey == key {
-					// Port is confirmed open
-					m.knownPorts[key] = port
-					delete(m.pendingPorts, key)
-
-					// Try to find which PID owns this port (best effort)
-					pid := m.findPortOwner(port)
-
-					event := PortEvent{
-						Type:      PortOpened,
-						PID:       pid,
-						Port:      port.Port,
-						Protocol:  port.Protocol,
-						BindAddr:  port.BindAddr,
-						Timestamp: time.Now(),
-					}
-
-					select {
-					case m.events <- event:
-						m.logger.Info("port opened",
-							"port", port.Port,
-							"protocol", port.Protocol,
-							"pid", pid)
-					default:
-						m.logger.Warn("event channel full, dropping opened event")
-					}
-					break
-				}
+			group, open := groupPorts(currentPorts)[key]
+			if !open {
+				continue
+			}
+
+			// Port is confirmed open
+			port := group[0]
+			m.knownPorts[key] = port
+			delete(m.pendingPorts, key)
+
+			// Try to find which PID owns this port (best effort)
+			pid := m.findPortOwner(group)
+
+			event := PortEvent{
+				Type:      PortOpened,
+				PID:       pid,
+				Port:      port.Port,
+				Protocol:  port.Protocol,
+				BindAddr:  port.BindAddr,
+				Netns:     port.Netns,
+				NetnsPID:  port.NetnsPID,
+				Timestamp: time.Now(),
+			}
+
+			select {
+			case m.events <- event:
+				m.logger.Info("port opened",
+					"port", port.Port,
+					"protocol", port.Protocol,
+					"pid", pid,
+					"sockets", len(group))
+			default:
+				m.logger.Warn("event channel full, dropping opened event")
+				m.dropped.Add(1)
 			}
 		}
 	}
 }
 
-// findPortOwner attempts to find which process owns a port by checking socket inodes
-// This is best-effort and may return 0 if the owner can't be determined
-func (m *SystemMonitor) findPortOwner(port Port) int {
-	// This is a simplified implementation - we'd need to:
-	// 1. Get the socket inode from /proc/net/tcp for this port
-	// 2. Search /proc/*/fd/* for a socket with that inode
-	// For now, return 0 (unknown) since we don't strictly need the PID
-	// The important part is detecting the port open/close
-
-	// TODO: Implement proper inode matching if PID is needed for filtering
+// findPortOwner attempts to find which process owns a port by matching the
+// inodes of its group's sockets, in order, against open file descriptors.
+// This is best-effort and returns 0 if no owner can be determined, e.g. once
+// the port has closed.
+func (m *SystemMonitor) findPortOwner(group []Port) int {
+	if len(group) == 1 {
+		return FindSocketOwner(group[0].Inode)
+	}
+	owners := SocketOwners()
+	for _, port := range group {
+		if pid := owners[port.Inode]; pid != 0 {
+			return pid
+		}
+	}
 	return 0
 }
@@ -0,0 +1,130 @@
+package monitor
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSystemMonitorDebounce(t *testing.T) {
+	m := NewSystemMonitor(slog.Default(), time.Second).WithDebounce(time.Hour)
+	m.listPorts = func() ([]Port, error) {
+		return []Port{{Port: 3000, Protocol: "tcp", State: "LISTEN", BindAddr: "127.0.0.1"}}, nil
+	}
+
+	m.checkPorts()
+	m.processPendingPorts()
+	select {
+	case event := <-m.Events():
+		t.Fatalf("port reported before debounce elapsed: %+v", event)
+	default:
+	}
+
+	m.WithDebounce(0)
+	m.processPendingPorts()
+	select {
+	case event := <-m.Events():
+		if event.Type != PortOpened || event.Port != 3000 {
+			t.Errorf("event = %+v, want port 3000 opened", event)
+		}
+	default:
+		t.Fatal("port not reported after debounce elapsed")
+	}
+}
+
+func TestSourceOptionsConfigure(t *testing.T) {
+	m := SourceOptions{Debounce: 2 * time.Second, EventBuffer: 500}.configure(NewSystemMonitor(slog.Default(), time.Second))
+	if m.debounceTime != 2*time.Second {
+		t.Errorf("debounce = %v, want 2s", m.debounceTime)
+	}
+	if cap(m.events) != 500 {
+		t.Errorf("event buffer = %d, want 500", cap(m.events))
+	}
+
+	m = SourceOptions{}.configure(NewSystemMonitor(slog.Default(), time.Second))
+	if m.debounceTime != DefaultDebounce {
+		t.Errorf("debounce = %v, want default %v", m.debounceTime, DefaultDebounce)
+	}
+	if cap(m.events) != DefaultEventBuffer {
+		t.Errorf("event buffer = %d, want default %d", cap(m.events), DefaultEventBuffer)
+	}
+}
+
+func TestSystemMonitorReusePortGroup(t *testing.T) {
+	worker := func(inode uint64) Port {
+		return Port{Port: 8080, Protocol: "tcp", State: "LISTEN", BindAddr: "127.0.0.1", Inode: inode}
+	}
+	current := []Port{worker(11), worker(12)}
+	m := NewSystemMonitor(slog.Default(), time.Second)
+	m.listPorts = func() ([]Port, error) { return current, nil }
+	m.knownPorts[systemPortKey(worker(11))] = worker(11)
+
+	// The first worker restarts: its socket goes, and its replacement's
+	// appears a poll later
+	current = []Port{worker(12)}
+	m.checkPorts()
+	current = []Port{worker(12), worker(13)}
+	m.checkPorts()
+	select {
+	case event := <-m.Events():
+		t.Fatalf("worker restart reported as %+v", event)
+	default:
+	}
+	if known := m.knownPorts[systemPortKey(worker(12))]; known.Inode != 12 {
+		t.Errorf("known socket = %d, want 12, the first left in the group", known.Inode)
+	}
+
+	current = nil
+	m.checkPorts()
+	select {
+	case event := <-m.Events():
+		if event.Type != PortClosed || event.Port != 8080 {
+			t.Errorf("event = %+v, want port 8080 closed", event)
+		}
+	default:
+		t.Fatal("port not reported closed after its last socket went")
+	}
+}
+
+func TestSystemMonitorPollRanges(t *testing.T) {
+	m := NewSystemMonitor(slog.Default(), 10*time.Second)
+	m.listPorts = func() ([]Port, error) {
+		return []Port{
+			{Port: 3000, Protocol: "tcp", State: "LISTEN", BindAddr: "127.0.0.1"},
+			{Port: 8080, Protocol: "tcp", State: "LISTEN", BindAddr: "127.0.0.1"},
+		}, nil
+	}
+	// Set through a merged source, as with the eBPF source's UDP poller
+	mergeSources(1, m).(*mergedSource).SetPollRanges([]PortRange{
+		{Start: 3000, End: 3999, PollInterval: time.Second},
+		{Start: 8000, End: 8999},
+	})
+	if got := m.tickInterval(); got != time.Second {
+		t.Errorf("tickInterval() = %v, want the range's 1s", got)
+	}
+
+	check := func(now time.Time) {
+		due := m.dueIntervals(now)
+		m.checkPortsWhere(func(port int) bool { return due[m.portInterval(port)] })
+	}
+	pending := func() []int {
+		var ports []int
+		for _, port := range []int{3000, 8080} {
+			if _, ok := m.pendingPorts[systemPortKey(Port{Port: port, Protocol: "tcp"})]; ok {
+				ports = append(ports, port)
+			}
+		}
+		return ports
+	}
+
+	start := time.Now()
+	m.dueIntervals(start) // Both schedules start now
+	check(start.Add(time.Second))
+	if got := pending(); len(got) != 1 || got[0] != 3000 {
+		t.Errorf("pending after 1s = %v, want only 3000, polled every second", got)
+	}
+	check(start.Add(10 * time.Second))
+	if got := pending(); len(got) != 2 {
+		t.Errorf("pending after 10s = %v, want 8080 too, at the monitor's interval", got)
+	}
+}
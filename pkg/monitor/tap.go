@@ -0,0 +1,407 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+// Types of TapEvent
+const (
+	TapSnapshot    = "snapshot"    // First line a client reads: the forwards in place when it connected
+	TapForwarded   = "forwarded"   // A forward was added
+	TapUnforwarded = "unforwarded" // A forward was removed
+)
+
+// tapClientBuffer is how many events a tap client can fall behind by before
+// it's disconnected
+const tapClientBuffer = 64
+
+// TapForward describes a forward on the event tap
+type TapForward struct {
+	Name        string `json:"name,omitempty"`
+	Port        int    `json:"port,omitempty"`         // Remote port, or the first of a range
+	PortEnd     int    `json:"port_end,omitempty"`     // Last remote port of a range
+	Host        string `json:"host,omitempty"`         // Remote host, if not localhost
+	Socket      string `json:"socket,omitempty"`       // Remote Unix socket path, for socket forwards
+	LocalPort   int    `json:"local_port,omitempty"`   // Port on the local machine
+	Process     string `json:"process,omitempty"`      // Process that opened the port
+	AppProtocol string `json:"app_protocol,omitempty"` // What the port speaks, if detected
+	Queued      bool   `json:"queued,omitempty"`       // Waiting on the daemon to retry it
+}
+
+// TapEvent is a line of JSON written to event tap clients. Every event
+// carries the full list of forwarded ports, so a prompt or status line only
+// needs the latest one.
+type TapEvent struct {
+	Type     string       `json:"type"`               // TapSnapshot, TapForwarded, or TapUnforwarded
+	Forward  *TapForward  `json:"forward,omitempty"`  // The forward added or removed
+	Forwards []TapForward `json:"forwards,omitempty"` // Every forward, for snapshots
+	Ports    []int        `json:"ports"`              // Every forwarded remote port, sorted
+	Time     time.Time    `json:"time"`
+
+	Metrics *SessionMetrics `json:"metrics,omitempty"` // What the session monitor has done, for snapshots
+	Source  string          `json:"source,omitempty"`  // Port event source in use, for snapshots
+}
+
+// EventTap tracks the forwards the monitor requests and streams them as
+// JSON lines to local clients, so tooling on the remote host can show what's
+// forwarded without talking to the laptop daemon
+type EventTap struct {
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	forwards map[string]TapForward
+	addedAt  map[string]time.Time // When each forward was last added, for Sync
+	clients  map[chan TapEvent]struct{}
+	metrics  func() SessionMetrics
+	source   string
+	onChange []func(TapEvent)
+}
+
+// NewEventTap creates an event tap with no forwards
+func NewEventTap(logger *slog.Logger) *EventTap {
+	return &EventTap{
+		logger:   logger,
+		forwards: make(map[string]TapForward),
+		addedAt:  make(map[string]time.Time),
+		clients:  make(map[chan TapEvent]struct{}),
+	}
+}
+
+// WithMetrics includes what metrics returns, such as a session monitor's, in
+// the snapshots clients get
+func (t *EventTap) WithMetrics(metrics func() SessionMetrics) *EventTap {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metrics = metrics
+	return t
+}
+
+// WithSource names the port event source, such as "ebpf", in the snapshots
+// clients get
+func (t *EventTap) WithSource(source string) *EventTap {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.source = source
+	return t
+}
+
+// OnChange calls fn with each forwarded and unforwarded event, as hooks
+// run on them. fn is called with the tap locked, so it must not block.
+func (t *EventTap) OnChange(fn func(TapEvent)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onChange = append(t.onChange, fn)
+}
+
+// Wrap returns a DaemonClient that sends requests through client and
+// publishes the forwards and unforwards the daemon accepts
+func (t *EventTap) Wrap(client DaemonClient) DaemonClient {
+	return &tapDaemonClient{client: client, tap: t}
+}
+
+// tapDaemonClient is a DaemonClient that reports to an EventTap
+type tapDaemonClient struct {
+	client DaemonClient
+	tap    *EventTap
+}
+
+func (c *tapDaemonClient) SendRequest(req *protocol.Request) (*protocol.Response, error) {
+	resp, err := c.client.SendRequest(req)
+	if err == nil && resp.Success {
+		c.tap.observe(req, resp)
+	}
+	return resp, err
+}
+
+// observe records the effect of a request the daemon accepted
+func (t *EventTap) observe(req *protocol.Request, resp *protocol.Response) {
+	switch req.Type {
+	case protocol.CommandForward:
+		var fr protocol.ForwardRequest
+		if err := json.Unmarshal(req.Payload, &fr); err != nil || fr.DryRun {
+			return
+		}
+		var result protocol.ForwardResponse
+		_ = json.Unmarshal(resp.Data, &result)
+		t.add(TapForward{
+			Name:        fr.Name,
+			Port:        fr.RemotePort,
+			PortEnd:     fr.RemotePortEnd,
+			Host:        tapHost(fr.Host),
+			Socket:      fr.RemoteSocket,
+			LocalPort:   result.LocalPort,
+			Process:     fr.ProcessName,
+			AppProtocol: fr.AppProtocol,
+			Queued:      result.Queued,
+		})
+	case protocol.CommandUnforward:
+		var ur protocol.UnforwardRequest
+		if err := json.Unmarshal(req.Payload, &ur); err != nil || ur.DryRun {
+			return
+		}
+		t.remove(ur)
+	}
+}
+
+// tapHost drops the default host, so forwards of the same port match however
+// they were requested
+func tapHost(host string) string {
+	if host == "localhost" || host == "127.0.0.1" {
+		return ""
+	}
+	return host
+}
+
+// key identifies a forward the way the daemon does: by remote socket or by
+// host and port
+func (f TapForward) key() string {
+	if f.Socket != "" {
+		return f.Socket
+	}
+	return net.JoinHostPort(f.Host, strconv.Itoa(f.Port))
+}
+
+// keys returns the key of each remote port or socket a forward covers, as
+// the daemon lists them: one per port of a range
+func (f TapForward) keys() []string {
+	if f.Socket != "" || f.PortEnd <= f.Port {
+		return []string{f.key()}
+	}
+	keys := make([]string, 0, f.PortEnd-f.Port+1)
+	for port := f.Port; port <= f.PortEnd; port++ {
+		keys = append(keys, net.JoinHostPort(f.Host, strconv.Itoa(port)))
+	}
+	return keys
+}
+
+// add records a forward and tells clients, unless it's already recorded as is
+func (t *EventTap) add(fwd TapForward) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := fwd.key()
+	if existing, ok := t.forwards[key]; ok && existing == fwd {
+		return
+	}
+	t.forwards[key] = fwd
+	t.addedAt[key] = time.Now()
+	t.broadcast(TapForwarded, &fwd)
+}
+
+// Sync brings the tap in line with the daemon's forwards over
+// connectionInfo, as listed at listedAt, to catch those made or removed
+// other than through the tap: by bankshot wrap or forward, or by the daemon
+// giving up on a connection. Forwards added since the list was taken, and
+// queued ones, which the daemon doesn't list, are kept.
+func (t *EventTap) Sync(connectionInfo string, forwards []protocol.ForwardInfo, listedAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	listed := make(map[string]protocol.ForwardInfo)
+	for _, fi := range forwards {
+		if fi.ConnectionInfo != connectionInfo {
+			continue
+		}
+		listed[TapForward{Port: fi.RemotePort, Host: tapHost(fi.Host), Socket: fi.RemoteSocket}.key()] = fi
+	}
+
+	for key, fwd := range t.forwards {
+		found := false
+		for _, k := range fwd.keys() {
+			if _, ok := listed[k]; ok {
+				found = true
+				delete(listed, k)
+			}
+		}
+		switch {
+		case found && fwd.Queued:
+			fwd.Queued = false
+			t.forwards[key] = fwd
+			t.broadcast(TapForwarded, &fwd)
+		case found, fwd.Queued, t.addedAt[key].After(listedAt):
+		default:
+			delete(t.forwards, key)
+			delete(t.addedAt, key)
+			t.broadcast(TapUnforwarded, &fwd)
+		}
+	}
+
+	keys := make([]string, 0, len(listed))
+	for key := range listed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fi := listed[key]
+		fwd := TapForward{
+			Name:        fi.Name,
+			Port:        fi.RemotePort,
+			Host:        tapHost(fi.Host),
+			Socket:      fi.RemoteSocket,
+			LocalPort:   fi.LocalPort,
+			AppProtocol: fi.AppProtocol,
+		}
+		t.forwards[key] = fwd
+		t.addedAt[key] = time.Now()
+		t.broadcast(TapForwarded, &fwd)
+	}
+}
+
+// remove drops the forward an unforward request names and tells clients
+func (t *EventTap) remove(ur protocol.UnforwardRequest) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := TapForward{Port: ur.RemotePort, Host: tapHost(ur.Host), Socket: ur.RemoteSocket}.key()
+	if ur.Name != "" {
+		key = ""
+		for k, fwd := range t.forwards {
+			if fwd.Name == ur.Name {
+				key = k
+				break
+			}
+		}
+	}
+	fwd, ok := t.forwards[key]
+	if !ok {
+		return
+	}
+	delete(t.forwards, key)
+	delete(t.addedAt, key)
+	t.broadcast(TapUnforwarded, &fwd)
+}
+
+// broadcast sends an event to every client, disconnecting those that have
+// fallen too far behind. Must be called with t.mu held.
+func (t *EventTap) broadcast(eventType string, fwd *TapForward) {
+	event := TapEvent{Type: eventType, Forward: fwd, Ports: t.ports(), Time: time.Now()}
+	for _, fn := range t.onChange {
+		fn(event)
+	}
+	for events := range t.clients {
+		select {
+		case events <- event:
+		default:
+			t.logger.Warn("Event tap client fell behind, disconnecting")
+			delete(t.clients, events)
+			close(events)
+		}
+	}
+}
+
+// ports returns every forwarded remote port, sorted. Must be called with
+// t.mu held.
+func (t *EventTap) ports() []int {
+	ports := []int{}
+	for _, fwd := range t.forwards {
+		if fwd.Socket != "" {
+			continue
+		}
+		for port := fwd.Port; port <= max(fwd.Port, fwd.PortEnd); port++ {
+			ports = append(ports, port)
+		}
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// subscribe registers a client, returning its event channel and a snapshot
+// of the current forwards
+func (t *EventTap) subscribe() (chan TapEvent, TapEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	events := make(chan TapEvent, tapClientBuffer)
+	t.clients[events] = struct{}{}
+
+	snapshot := TapEvent{Type: TapSnapshot, Ports: t.ports(), Time: time.Now(), Source: t.source}
+	if t.metrics != nil {
+		metrics := t.metrics()
+		snapshot.Metrics = &metrics
+	}
+	for _, fwd := range t.forwards {
+		snapshot.Forwards = append(snapshot.Forwards, fwd)
+	}
+	sort.Slice(snapshot.Forwards, func(i, j int) bool {
+		return snapshot.Forwards[i].key() < snapshot.Forwards[j].key()
+	})
+	return events, snapshot
+}
+
+// unsubscribe removes a client, unless broadcast already has
+func (t *EventTap) unsubscribe(events chan TapEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.clients[events]; ok {
+		delete(t.clients, events)
+		close(events)
+	}
+}
+
+// Serve streams events to the clients that connect to listener until ctx is
+// done, then closes the listener
+func (t *EventTap) Serve(ctx context.Context, listener net.Listener) {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				t.logger.Error("Event tap stopped accepting clients", "error", err)
+			}
+			return
+		}
+		go t.serveClient(ctx, conn)
+	}
+}
+
+// serveClient writes a snapshot to conn, then each event, until the client
+// hangs up or ctx is done
+func (t *EventTap) serveClient(ctx context.Context, conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// Clients only read; their side closing ends the connection
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		cancel()
+	}()
+
+	events, snapshot := t.subscribe()
+	defer t.unsubscribe(events)
+
+	encoder := json.NewEncoder(conn)
+	if err := encoder.Encode(snapshot); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := encoder.Encode(event); err != nil {
+				return
+			}
+		}
+	}
+}
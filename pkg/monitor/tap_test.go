@@ -0,0 +1,140 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
+)
+
+func TestEventTap(t *testing.T) {
+	// Unix socket paths are short, so stay out of t.TempDir()
+	dir, err := os.MkdirTemp("", "tap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "events.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tap := NewEventTap(slog.Default()).WithSource("polling")
+	go tap.Serve(ctx, listener)
+
+	client := tap.Wrap(&mockDaemonClient{})
+	sm, _ := NewSessionMonitor(SessionConfig{
+		SessionID:       "test",
+		DaemonClient:    client,
+		Logger:          slog.Default(),
+		PortEventSource: &mockPortEventSource{},
+	})
+	sm.resolveProcessName = func(pid int) string { return "vite" }
+	sm.resolveProcessCwd = func(pid int) string { return "" }
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 3000, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	lines := bufio.NewScanner(conn)
+	next := func() TapEvent {
+		t.Helper()
+		if !lines.Scan() {
+			t.Fatalf("no event: %v", lines.Err())
+		}
+		var event TapEvent
+		if err := json.Unmarshal(lines.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+
+	snapshot := next()
+	if snapshot.Type != TapSnapshot || !slices.Equal(snapshot.Ports, []int{3000}) {
+		t.Fatalf("snapshot = %+v, want ports [3000]", snapshot)
+	}
+	if len(snapshot.Forwards) != 1 || snapshot.Forwards[0].Process != "vite" {
+		t.Errorf("snapshot forwards = %+v, want one of vite's", snapshot.Forwards)
+	}
+	if snapshot.Source != "polling" {
+		t.Errorf("snapshot source = %q, want polling", snapshot.Source)
+	}
+
+	sm.handlePortEvent(PortEvent{Type: PortOpened, PID: 100, Port: 5173, BindAddr: "127.0.0.1", Timestamp: time.Now()})
+	forwarded := next()
+	if forwarded.Type != TapForwarded || forwarded.Forward.Port != 5173 || !slices.Equal(forwarded.Ports, []int{3000, 5173}) {
+		t.Errorf("forwarded event = %+v, want 5173 added to ports [3000 5173]", forwarded)
+	}
+
+	payload, _ := json.Marshal(protocol.UnforwardRequest{RemotePort: 3000, Host: "localhost", ConnectionInfo: "test"})
+	if _, err := client.SendRequest(&protocol.Request{Type: protocol.CommandUnforward, Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+	unforwarded := next()
+	if unforwarded.Type != TapUnforwarded || unforwarded.Forward.Port != 3000 || !slices.Equal(unforwarded.Ports, []int{5173}) {
+		t.Errorf("unforwarded event = %+v, want 3000 removed leaving ports [5173]", unforwarded)
+	}
+}
+
+func TestEventTapSync(t *testing.T) {
+	tap := NewEventTap(slog.Default())
+	var events []TapEvent
+	tap.OnChange(func(event TapEvent) {
+		events = append(events, event)
+	})
+
+	tap.add(TapForward{Port: 3000, LocalPort: 3000})
+	tap.add(TapForward{Port: 4000, PortEnd: 4001, LocalPort: 4000})
+	tap.add(TapForward{Port: 5000, Queued: true})
+	listedAt := time.Now()
+	tap.add(TapForward{Port: 6000, LocalPort: 6000})
+	events = nil
+
+	// 3000 went away without the tap seeing it, 8080 came from bankshot
+	// wrap, and the range and the queued forward are in place
+	tap.Sync("devbox", []protocol.ForwardInfo{
+		{ConnectionInfo: "devbox", RemotePort: 4000, LocalPort: 4000, Host: "localhost"},
+		{ConnectionInfo: "devbox", RemotePort: 4001, LocalPort: 4001, Host: "localhost"},
+		{ConnectionInfo: "devbox", RemotePort: 5000, LocalPort: 5000, Host: "localhost"},
+		{ConnectionInfo: "devbox", RemotePort: 8080, LocalPort: 8080, Host: "localhost", Name: "api"},
+		{ConnectionInfo: "other", RemotePort: 9000, LocalPort: 9000, Host: "localhost"},
+	}, listedAt)
+
+	var got []string
+	for _, event := range events {
+		got = append(got, fmt.Sprintf("%s %d", event.Type, event.Forward.Port))
+	}
+	slices.Sort(got)
+	want := []string{"forwarded 5000", "forwarded 8080", "unforwarded 3000"}
+	if !slices.Equal(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+
+	tap.mu.Lock()
+	defer tap.mu.Unlock()
+	if ports := tap.ports(); !slices.Equal(ports, []int{4000, 4001, 5000, 6000, 8080}) {
+		t.Errorf("ports = %v after Sync, want the listed ones and the one added since", ports)
+	}
+	if tap.forwards[":5000"].Queued {
+		t.Error("5000 is still queued after the daemon listed it")
+	}
+}
@@ -0,0 +1,229 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// soAcceptCon is the /proc/net/unix flag (__SO_ACCEPTCON) marking a socket
+// that has called listen()
+const soAcceptCon = 0x10000
+
+// sockStream is the /proc/net/unix type of SOCK_STREAM sockets, the only
+// kind ssh can forward
+const sockStream = "0001"
+
+// SocketRule auto-forwards the remote Unix sockets whose path matches
+// Pattern (a filepath.Match glob) to LocalSocket or LocalPort on the local
+// machine. "{name}" in LocalSocket is replaced with the socket's file name,
+// so one rule can cover several sockets.
+type SocketRule struct {
+	Pattern     string
+	LocalSocket string
+	LocalPort   int
+}
+
+// matches reports whether path matches the rule's pattern
+func (r SocketRule) matches(path string) bool {
+	ok, _ := filepath.Match(r.Pattern, path)
+	return ok
+}
+
+// localSocket returns the local socket path to forward path to, if any
+func (r SocketRule) localSocket(path string) string {
+	return strings.ReplaceAll(r.LocalSocket, "{name}", filepath.Base(path))
+}
+
+// SocketEvent represents a listening Unix socket appearing or going away
+type SocketEvent struct {
+	Type      EventType
+	Path      string
+	Timestamp time.Time
+}
+
+// SocketEventSource is implemented by monitors that emit socket events
+type SocketEventSource interface {
+	Start(ctx context.Context) error
+	Events() <-chan SocketEvent
+}
+
+// parseProcNetUnix parses /proc/net/unix, returning the paths of listening
+// stream sockets. Abstract sockets (which have no path) are skipped.
+func parseProcNetUnix(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var paths []string
+	scanner := bufio.NewScanner(file)
+
+	// Skip header line
+	// Header: Num       RefCount Protocol Flags    Type St Inode Path
+	scanner.Scan()
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&soAcceptCon == 0 || fields[4] != sockStream {
+			continue
+		}
+
+		socketPath := strings.Join(fields[7:], " ")
+		if !strings.HasPrefix(socketPath, "/") {
+			continue
+		}
+		paths = append(paths, socketPath)
+	}
+
+	return paths, scanner.Err()
+}
+
+// GetListeningUnixSockets returns the paths of listening Unix stream sockets
+func GetListeningUnixSockets() ([]string, error) {
+	return parseProcNetUnix("/proc/net/unix")
+}
+
+// isUnixSocketListening reports whether a Unix socket is listening at path
+func isUnixSocketListening(path string) bool {
+	paths, err := GetListeningUnixSockets()
+	if err != nil {
+		return false
+	}
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// SocketMonitor polls /proc/net/unix for listening sockets matching the
+// configured rules
+type SocketMonitor struct {
+	pollInterval time.Duration
+	rules        []SocketRule
+	logger       *slog.Logger
+	events       chan SocketEvent
+	listSockets  func() ([]string, error) // defaults to GetListeningUnixSockets
+	dropped      atomic.Uint64            // Events dropped because the consumer fell behind
+
+	mu         sync.Mutex
+	knownPaths map[string]bool
+}
+
+// NewSocketMonitor creates a monitor for listening Unix sockets matching rules
+func NewSocketMonitor(logger *slog.Logger, pollInterval time.Duration, rules []SocketRule) *SocketMonitor {
+	return &SocketMonitor{
+		pollInterval: pollInterval,
+		rules:        rules,
+		logger:       logger,
+		events:       make(chan SocketEvent, 50),
+		listSockets:  GetListeningUnixSockets,
+		knownPaths:   make(map[string]bool),
+	}
+}
+
+// Start begins polling. Sockets already listening are reported as opened,
+// like the port monitors' initial ports.
+func (m *SocketMonitor) Start(ctx context.Context) error {
+	go func() {
+		defer close(m.events)
+
+		m.checkSockets()
+
+		ticker := time.NewTicker(m.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.checkSockets()
+			}
+		}
+	}()
+	return nil
+}
+
+// Events returns the channel of socket events
+func (m *SocketMonitor) Events() <-chan SocketEvent {
+	return m.events
+}
+
+// Dropped returns how many events were dropped because the consumer fell
+// behind
+func (m *SocketMonitor) Dropped() uint64 {
+	return m.dropped.Load()
+}
+
+// checkSockets scans for matching sockets appearing or going away
+func (m *SocketMonitor) checkSockets() {
+	paths, err := m.listSockets()
+	if err != nil {
+		m.logger.Debug("failed to list unix sockets", "error", err)
+		return
+	}
+
+	current := make(map[string]bool)
+	for _, path := range paths {
+		if m.matches(path) {
+			current[path] = true
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A dropped event leaves the socket's known state alone, so the next
+	// poll tries again
+	for path := range current {
+		if !m.knownPaths[path] && m.send(SocketEvent{Type: PortOpened, Path: path, Timestamp: time.Now()}) {
+			m.knownPaths[path] = true
+		}
+	}
+	for path := range m.knownPaths {
+		if !current[path] && m.send(SocketEvent{Type: PortClosed, Path: path, Timestamp: time.Now()}) {
+			delete(m.knownPaths, path)
+		}
+	}
+}
+
+// matches reports whether any rule matches path
+func (m *SocketMonitor) matches(path string) bool {
+	for _, rule := range m.rules {
+		if rule.matches(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// send emits an event, reporting false if it was dropped because the
+// channel is full
+func (m *SocketMonitor) send(event SocketEvent) bool {
+	select {
+	case m.events <- event:
+		m.logger.Info("unix socket "+string(event.Type), "path", event.Path)
+		return true
+	default:
+		m.logger.Warn("event channel full, dropping socket event", "path", event.Path)
+		m.dropped.Add(1)
+		return false
+	}
+}
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseProcNetUnix(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "unix")
+
+	// A listening stream socket, a connected one, a listening datagram
+	// socket, an abstract listener, and a listener with a space in its path
+	testData := `Num       RefCount Protocol Flags    Type St Inode Path
+0000000000000000: 00000002 00000000 00010000 0001 01 20001 /run/user/1000/docker.sock
+0000000000000000: 00000003 00000000 00000000 0001 03 20002 /run/user/1000/docker.sock
+0000000000000000: 00000002 00000000 00010000 0002 01 20003 /run/systemd/notify
+0000000000000000: 00000002 00000000 00010000 0001 01 20004 @/tmp/.X11-unix/X0
+0000000000000000: 00000002 00000000 00010000 0001 01 20005 /tmp/my app.sock
+0000000000000000: 00000002 00000000 00000000 0001 01 20006`
+
+	if err := os.WriteFile(testFile, []byte(testData), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	paths, err := parseProcNetUnix(testFile)
+	if err != nil {
+		t.Fatalf("parseProcNetUnix failed: %v", err)
+	}
+
+	want := []string{"/run/user/1000/docker.sock", "/tmp/my app.sock"}
+	if len(paths) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, paths)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("paths[%d] = %q, want %q", i, paths[i], want[i])
+		}
+	}
+}
+
+func TestSocketRule(t *testing.T) {
+	rule := SocketRule{Pattern: "/tmp/lsp-*.sock", LocalSocket: "~/.bankshot/{name}"}
+
+	if !rule.matches("/tmp/lsp-gopls.sock") {
+		t.Error("expected /tmp/lsp-gopls.sock to match")
+	}
+	if rule.matches("/tmp/sub/lsp-gopls.sock") {
+		t.Error("expected * not to match across directories")
+	}
+	if got := rule.localSocket("/tmp/lsp-gopls.sock"); got != "~/.bankshot/lsp-gopls.sock" {
+		t.Errorf("localSocket = %q, want ~/.bankshot/lsp-gopls.sock", got)
+	}
+}
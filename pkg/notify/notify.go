@@ -1,15 +1,37 @@
 package notify
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
 )
 
+// remotePerMinute is how many notifications each connection may post
+// through NotifyRemote in a rolling minute
+const remotePerMinute = 10
+
+// ErrRateLimited is returned by NotifyRemote once a connection has posted
+// remotePerMinute notifications in the last minute
+var ErrRateLimited = errors.New("too many notifications in the last minute")
+
 // Notifier sends native desktop notifications for port forwarding events.
 type Notifier struct {
 	logger     *slog.Logger
 	helperPath string
+
+	mu     sync.Mutex
+	remote map[string][]time.Time // When each connection's NotifyRemote calls in the last minute were made
+	now    func() time.Time       // defaults to time.Now
 }
 
 // shortPath returns the last two segments of a path for compact display.
@@ -22,3 +44,105 @@ func shortPath(p string) string {
 	}
 	return filepath.Join(parts[len(parts)-2], parts[len(parts)-1])
 }
+
+// Forward is a newly made port forward, as NotifyForward announces it
+type Forward struct {
+	protocol.ForwardInfo
+	ProcessName string // Process listening on the remote port, if known
+	ProcessCwd  string // Its working directory, if known
+}
+
+// forwardBody describes fwd for its notification: where it goes, and the
+// process behind it when known
+func forwardBody(fwd Forward) string {
+	body := fmt.Sprintf("%s → %s", net.JoinHostPort(fwd.Host, strconv.Itoa(fwd.RemotePort)), fwd.LocalTarget())
+	if fwd.ProcessName != "" {
+		context := fwd.ProcessName
+		if fwd.ProcessCwd != "" {
+			context += " in " + shortPath(fwd.ProcessCwd)
+		}
+		body += "\n" + context
+	}
+	return body
+}
+
+// Enabled reports whether a helper is configured to post notifications.
+func (n *Notifier) Enabled() bool {
+	return n.helperPath != ""
+}
+
+// NotifyLink posts a notification that opens url when clicked, or a plain
+// one when url is empty.
+func (n *Notifier) NotifyLink(title, body, url string) {
+	if url == "" {
+		n.NotifyMessage(title, body)
+		return
+	}
+	n.runHelper("--title", title, "--body", body, "--url", url)
+}
+
+// NotifyMessage posts a plain notification with the given title and body.
+// It shells out to the helper app in a goroutine so it never blocks the caller.
+func (n *Notifier) NotifyMessage(title, body string) {
+	n.runHelper("--title", title, "--body", body)
+}
+
+// NotifyRemote posts a notification a remote host asked for, as NotifyLink
+// does, unless connectionInfo has posted remotePerMinute of them in the last
+// minute, so a runaway script on the host can't flood the desktop.
+func (n *Notifier) NotifyRemote(connectionInfo, title, body, url string) error {
+	if err := n.allowRemote(connectionInfo); err != nil {
+		return err
+	}
+	n.NotifyLink(title, body, url)
+	return nil
+}
+
+// allowRemote counts a notification from connectionInfo, or returns
+// ErrRateLimited without counting it if the connection is over the limit
+func (n *Notifier) allowRemote(connectionInfo string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	if n.now != nil {
+		now = n.now()
+	}
+	if n.remote == nil {
+		n.remote = make(map[string][]time.Time)
+	}
+	cutoff := now.Add(-time.Minute)
+	for conn, posted := range n.remote {
+		posted = slices.DeleteFunc(posted, func(at time.Time) bool {
+			return !at.After(cutoff)
+		})
+		if len(posted) == 0 {
+			delete(n.remote, conn)
+		} else {
+			n.remote[conn] = posted
+		}
+	}
+	if len(n.remote[connectionInfo]) >= remotePerMinute {
+		return fmt.Errorf("%w (%d per connection)", ErrRateLimited, remotePerMinute)
+	}
+	n.remote[connectionInfo] = append(n.remote[connectionInfo], now)
+	return nil
+}
+
+// runHelper runs the helper with args in a goroutine, logging its failure
+func (n *Notifier) runHelper(args ...string) {
+	if n.helperPath == "" {
+		return
+	}
+
+	go func() {
+		cmd := exec.Command(n.helperPath, args...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			n.logger.Warn("notification helper failed",
+				"error", err,
+				"output", string(out),
+				"helper", n.helperPath,
+			)
+		}
+	}()
+}
@@ -50,30 +50,20 @@ func (n *Notifier) NotifyOpProxy(args []string) {
 
 // NotifyForward posts a macOS notification for a newly-forwarded port.
 // It shells out to the helper app in a goroutine so it never blocks the caller.
-func (n *Notifier) NotifyForward(remotePort, localPort int, host, processName, processCwd string) {
+func (n *Notifier) NotifyForward(fwd Forward) {
 	if n.helperPath == "" {
 		n.logger.Debug("Skipping notification, no helper configured")
 		return
 	}
 
-	title := fmt.Sprintf("Port %d forwarded", remotePort)
-	body := fmt.Sprintf("%s:%d → localhost:%d", host, remotePort, localPort)
-
-	// Add process context if available
-	if processName != "" {
-		context := processName
-		if processCwd != "" {
-			context += " in " + shortPath(processCwd)
-		}
-		body += "\n" + context
-	}
-
-	url := fmt.Sprintf("http://localhost:%d", localPort)
+	title := fmt.Sprintf("Port %d forwarded", fwd.RemotePort)
+	body := forwardBody(fwd)
+	url := fwd.LocalURL()
 
 	n.logger.Info("Sending notification",
 		"title", title,
-		"remotePort", remotePort,
-		"localPort", localPort,
+		"remotePort", fwd.RemotePort,
+		"localPort", fwd.LocalPort,
 		"helper", n.helperPath,
 	)
 
@@ -1,9 +1,13 @@
 package notify
 
 import (
+	"errors"
 	"log/slog"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/protocol"
 )
 
 func TestEmptyHelperPath(t *testing.T) {
@@ -11,7 +15,16 @@ func TestEmptyHelperPath(t *testing.T) {
 	n := New(logger, "")
 
 	// Should be a graceful no-op (no panic, no error)
-	n.NotifyForward(3000, 3000, "localhost", "python3", "/home/user/projects/myapp")
+	n.NotifyForward(Forward{
+		ForwardInfo: protocol.ForwardInfo{RemotePort: 3000, LocalPort: 3000, Host: "localhost", AppProtocol: "http", Server: "Next.js"},
+		ProcessName: "python3",
+		ProcessCwd:  "/home/user/projects/myapp",
+	})
+	n.NotifyLink("build", "finished", "http://localhost:3000")
+
+	if n.Enabled() {
+		t.Error("Enabled() = true without a helper")
+	}
 }
 
 func TestShortPath(t *testing.T) {
@@ -33,10 +46,56 @@ func TestShortPath(t *testing.T) {
 	}
 }
 
+func TestForwardBody(t *testing.T) {
+	tests := []struct {
+		name string
+		fwd  Forward
+		want string
+	}{
+		{"port", Forward{ForwardInfo: protocol.ForwardInfo{RemotePort: 3000, LocalPort: 3000, Host: "localhost"}}, "localhost:3000 → localhost:3000"},
+		{"HTTP server", Forward{ForwardInfo: protocol.ForwardInfo{RemotePort: 3000, LocalPort: 3001, Host: "localhost", AppProtocol: "http", Server: "Next.js"}}, "localhost:3000 → http://localhost:3001 (Next.js)"},
+		{"process", Forward{
+			ForwardInfo: protocol.ForwardInfo{RemotePort: 8080, LocalPort: 8080, Host: "localhost"},
+			ProcessName: "python3",
+			ProcessCwd:  "/home/user/projects/myapp",
+		}, "localhost:8080 → localhost:8080\npython3 in projects/myapp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardBody(tt.fwd); got != tt.want {
+				t.Errorf("forwardBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotifyRemoteRateLimit(t *testing.T) {
+	n := New(slog.New(slog.NewTextHandler(os.Stderr, nil)), "")
+	now := time.Now()
+	n.now = func() time.Time { return now }
+
+	for i := 0; i < remotePerMinute; i++ {
+		if err := n.NotifyRemote("devbox", "build", "finished", ""); err != nil {
+			t.Fatalf("notification %d: %v", i+1, err)
+		}
+	}
+	if err := n.NotifyRemote("devbox", "build", "finished", ""); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("NotifyRemote() over the limit = %v, want ErrRateLimited", err)
+	}
+	if err := n.NotifyRemote("other", "build", "finished", ""); err != nil {
+		t.Errorf("NotifyRemote() for another connection = %v, want it posted", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := n.NotifyRemote("devbox", "build", "finished", ""); err != nil {
+		t.Errorf("NotifyRemote() a minute later = %v, want it posted", err)
+	}
+}
+
 func TestNonexistentBinary(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
 	n := New(logger, "/nonexistent/bankshot-notify")
 
 	// Should not panic; the goroutine logs a warning but doesn't block.
-	n.NotifyForward(8080, 8080, "localhost", "", "")
+	n.NotifyForward(Forward{ForwardInfo: protocol.ForwardInfo{RemotePort: 8080, LocalPort: 8080, Host: "localhost"}})
 }
@@ -0,0 +1,83 @@
+package opener
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// browserApp is how a browser named in config.BrowserNames is launched
+type browserApp struct {
+	macApp     string // Application open -a starts on macOS
+	macBundle  string // Bundle identifier, as open -b takes
+	macCommand string // Executable run instead of open -a on macOS, if set
+	command    string // Executable on Linux and other Unixes
+	windows    string // Executable on Windows, found on PATH
+	firefox    bool   // Takes Firefox's flags rather than Chromium's
+	private    string // Flag for a private window
+}
+
+var browserApps = map[string]browserApp{
+	"brave":    {macApp: "Brave Browser", macBundle: "com.brave.Browser", command: "brave-browser", windows: "brave", private: "--incognito"},
+	"chrome":   {macApp: "Google Chrome", macBundle: "com.google.Chrome", command: "google-chrome", windows: "chrome", private: "--incognito"},
+	"chromium": {macApp: "Chromium", macBundle: "org.chromium.Chromium", command: "chromium", windows: "chromium", private: "--incognito"},
+	"edge":     {macApp: "Microsoft Edge", macBundle: "com.microsoft.edgemac", command: "microsoft-edge", windows: "msedge", private: "--inprivate"},
+	// Firefox started with open -n refuses a profile that's already open,
+	// where its own executable hands the URL to the running instance
+	"firefox": {
+		macApp:     "Firefox",
+		macBundle:  "org.mozilla.firefox",
+		macCommand: "/Applications/Firefox.app/Contents/MacOS/firefox",
+		command:    "firefox",
+		windows:    "firefox",
+		firefox:    true,
+		private:    "--private-window",
+	},
+}
+
+// BrowserNamed returns the config.BrowserNames name of the browser called
+// name, as given to opener.browser or to macOS's open -a ("Google Chrome",
+// "/Applications/Firefox.app") or -b ("com.google.Chrome"), ignoring case
+func BrowserNamed(name string) (string, bool) {
+	name = strings.TrimSuffix(strings.ToLower(path.Base(name)), ".app")
+	for browser, app := range browserApps {
+		if name == browser || strings.EqualFold(name, app.macApp) || strings.EqualFold(name, app.macBundle) {
+			return browser, true
+		}
+	}
+	return "", false
+}
+
+// browserLaunch returns the command opening rawURL in the named browser on
+// goos, in profile if it's set and a private window if private is. The URL
+// is always its own argument: nothing here goes through a shell, since a
+// remote host picks the URL.
+func browserLaunch(goos, name, profile string, private bool, rawURL string) ([]string, error) {
+	app, ok := browserApps[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown browser %q", name)
+	}
+
+	var args []string
+	if profile != "" {
+		if app.firefox {
+			args = append(args, "-P", profile)
+		} else {
+			args = append(args, "--profile-directory="+profile)
+		}
+	}
+	if private {
+		args = append(args, app.private)
+	}
+	args = append(args, rawURL)
+
+	switch {
+	case goos == "darwin" && app.macCommand != "":
+		return append([]string{app.macCommand}, args...), nil
+	case goos == "darwin":
+		return append([]string{"open", "-na", app.macApp, "--args"}, args...), nil
+	case goos == "windows":
+		return append([]string{app.windows}, args...), nil
+	}
+	return append([]string{app.command}, args...), nil
+}
@@ -0,0 +1,274 @@
+package opener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotConfirmed is returned for a URL on a host no URL was opened on
+// before that wasn't confirmed, or whose host was refused before
+var ErrNotConfirmed = errors.New("not confirmed")
+
+// confirmTimeout is how long a confirmation dialog waits for an answer
+const confirmTimeout = 2 * time.Minute
+
+// answer is what asking about a new host came to
+type answer int
+
+const (
+	answerNone  answer = iota // No answer, as when the dialog timed out; ask again next time
+	answerAllow               // Open it, and remember the host as allowed
+	answerDeny                // Don't, and remember the host as denied
+)
+
+// domainList is the domains file: the hosts allowed and denied so far
+type domainList struct {
+	Allowed []string `json:"allowed"`
+	Denied  []string `json:"denied"`
+}
+
+// domainGuard asks before opening a URL on a host no URL was opened on
+// before, and remembers the answer in its file. The file is read on every
+// check, so hand edits apply right away. There's one dialog open per host
+// at most; more URLs on it while it's open are refused rather than stacking
+// up dialogs.
+type domainGuard struct {
+	path   string
+	ask    func(host, rawURL string) (answer, error)
+	logger *slog.Logger
+
+	mu     sync.Mutex      // Guards asking and updates to the file
+	asking map[string]bool // Hosts with a dialog open
+}
+
+func newDomainGuard(path string, command []string, goos string, logger *slog.Logger) *domainGuard {
+	g := &domainGuard{path: path, logger: logger, asking: make(map[string]bool)}
+	g.ask = func(host, rawURL string) (answer, error) {
+		return askDialog(command, goos, host, rawURL)
+	}
+	return g
+}
+
+// check returns nil if rawURL's host was allowed before or is allowed now,
+// and otherwise an ErrNotConfirmed. Loopback hosts, the remote host's own
+// forwarded ports, are never asked about. URLs other than http and https
+// open an app rather than a site, so they're asked about by their scheme,
+// as "vscode:", rather than a host.
+func (g *domainGuard) check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	host := strings.ToLower(u.Scheme) + ":"
+	if isWebURL(rawURL) {
+		host = strings.ToLower(u.Hostname())
+		if host == "" || isLoopbackHost(host) {
+			return nil
+		}
+	}
+	return g.confirm(host, rawURL)
+}
+
+// checkFile is check for a file sent to be opened, asked about by its
+// extension, as ".pdf", since that's what picks the app it opens in
+func (g *domainGuard) checkFile(name string) error {
+	return g.confirm(strings.ToLower(filepath.Ext(name)), name)
+}
+
+// confirm returns nil if key was allowed before or is allowed now, asking
+// about it with subject, the URL or file to open
+func (g *domainGuard) confirm(key, subject string) error {
+	list, err := readDomainList(g.path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case slices.Contains(list.Allowed, key):
+		return nil
+	case slices.Contains(list.Denied, key):
+		return fmt.Errorf("%w: %s was refused before (see %s)", ErrNotConfirmed, key, g.path)
+	}
+
+	g.mu.Lock()
+	if g.asking[key] {
+		g.mu.Unlock()
+		return fmt.Errorf("%w: %s is new, and already being asked about", ErrNotConfirmed, key)
+	}
+	g.asking[key] = true
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.asking, key)
+		g.mu.Unlock()
+	}()
+
+	g.logger.Info("Asking before opening on a new host", "host", key, "url", subject)
+	result, err := g.ask(key, subject)
+	if err != nil {
+		return fmt.Errorf("%w: %s is new, and asking about it failed: %v", ErrNotConfirmed, key, err)
+	}
+	if result == answerNone {
+		return fmt.Errorf("%w: %s is new, and opening it wasn't confirmed", ErrNotConfirmed, key)
+	}
+	g.remember(key, result)
+	if result == answerDeny {
+		return fmt.Errorf("%w: opening %s was refused", ErrNotConfirmed, key)
+	}
+	return nil
+}
+
+// remember adds the answer about key to the file, read again as another
+// host's answer may have been saved while the dialog was open
+func (g *domainGuard) remember(key string, result answer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	list, err := readDomainList(g.path)
+	if err != nil {
+		g.logger.Warn("Failed to read domains file", "path", g.path, "error", err)
+		return
+	}
+	if result == answerAllow {
+		list.Allowed = append(list.Allowed, key)
+	} else {
+		list.Denied = append(list.Denied, key)
+	}
+	if err := writeDomainList(g.path, list); err != nil {
+		g.logger.Warn("Failed to save domains file", "path", g.path, "error", err)
+	}
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback address
+func isLoopbackHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// readDomainList reads the domains file at path; a missing one is empty
+func readDomainList(path string) (domainList, error) {
+	var list domainList
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return list, nil
+	}
+	if err != nil {
+		return list, err
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return list, fmt.Errorf("invalid domains file %s: %w", path, err)
+	}
+	return list, nil
+}
+
+// writeDomainList replaces the domains file at path
+func writeDomainList(path string, list domainList) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create domains directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// confirmMessage is the question the dialogs ask, about a host or, for
+// URLs that open an app, a scheme like "vscode:", or for a file, its
+// extension like ".pdf"
+func confirmMessage(host, rawURL string) string {
+	if strings.HasPrefix(host, ".") {
+		return fmt.Sprintf("A remote host sent %s to open, and no %s file was opened before.\n\nOpen it?", rawURL, host)
+	}
+	if strings.HasSuffix(host, ":") {
+		return fmt.Sprintf("A remote host asked to open a %s link, which opens an app, and none was opened before:\n\n%s\n\nOpen it?", host, rawURL)
+	}
+	return fmt.Sprintf("A remote host asked to open a URL on %s, where no URL was opened before:\n\n%s\n\nOpen it?", host, rawURL)
+}
+
+// askDialog asks whether to open rawURL with command, if set, or the
+// platform's dialog. The URL is only ever passed as an argument of its
+// own, never spliced into a script.
+func askDialog(command []string, goos, host, rawURL string) (answer, error) {
+	if len(command) > 0 {
+		fill := strings.NewReplacer("{url}", rawURL, "{host}", host)
+		args := make([]string, len(command))
+		for i, arg := range command {
+			args[i] = fill.Replace(arg)
+		}
+		return runDialog(args)
+	}
+
+	message := confirmMessage(host, rawURL)
+	if goos == "darwin" {
+		ctx, cancel := context.WithTimeout(context.Background(), confirmTimeout)
+		defer cancel()
+
+		// Without a cancel button, either button exits 0 and says which it was
+		output, err := exec.CommandContext(ctx, "osascript",
+			"-e", "on run argv",
+			"-e", `display dialog (item 1 of argv) with title "bankshot" buttons {"Don't Open", "Open"} default button "Open" with icon caution`,
+			"-e", "end run",
+			message).Output()
+		switch {
+		case ctx.Err() != nil:
+			return answerNone, nil
+		case err != nil:
+			return answerNone, err
+		case strings.Contains(string(output), "button returned:Open"):
+			return answerAllow, nil
+		case strings.Contains(string(output), "button returned:Don't Open"):
+			return answerDeny, nil
+		}
+		return answerNone, nil
+	}
+
+	if _, err := exec.LookPath("zenity"); err == nil {
+		return runDialog([]string{"zenity", "--question", "--no-markup", "--title=bankshot",
+			"--ok-label=Open", "--cancel-label=Don't Open", "--text=" + message})
+	}
+	if _, err := exec.LookPath("kdialog"); err == nil {
+		return runDialog([]string{"kdialog", "--title", "bankshot",
+			"--yes-label", "Open", "--no-label", "Don't Open", "--yesno", message})
+	}
+	return answerNone, errors.New("no confirmation dialog found; install zenity or kdialog, or set opener.confirm_command")
+}
+
+// runDialog runs a dialog command that exits 0 to allow, 1 to deny, and
+// with anything else gives no answer. One left unanswered for
+// confirmTimeout is closed.
+func runDialog(command []string) (answer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), confirmTimeout)
+	defer cancel()
+
+	err := exec.CommandContext(ctx, command[0], command[1:]...).Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return answerAllow, nil
+	case ctx.Err() != nil:
+		return answerNone, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return answerDeny, nil
+	case errors.As(err, &exitErr):
+		return answerNone, nil
+	}
+	return answerNone, err
+}
@@ -0,0 +1,57 @@
+package opener
+
+import (
+	"net/url"
+	"strings"
+)
+
+// editorSchemes are the URL schemes of the editors bankshot knows, by
+// whether they take VS Code's vscode-remote links to files over SSH
+var editorSchemes = map[string]bool{
+	"vscode":          true,
+	"vscode-insiders": true,
+	"vscodium":        true,
+	"cursor":          true,
+	"windsurf":        true,
+	"jetbrains":       false,
+	"idea":            false,
+	"goland":          false,
+	"pycharm":         false,
+	"webstorm":        false,
+	"rubymine":        false,
+	"clion":           false,
+	"rider":           false,
+}
+
+// editorFileLink reports whether u is a link opening a file in an editor
+// bankshot knows: vscode://file/<path> for the VS Code family, or
+// idea://open?file=<path> for JetBrains IDEs. Their schemes' other links,
+// such as to extensions' handlers or other hosts' files over Remote-SSH,
+// aren't.
+func editorFileLink(u *url.URL) bool {
+	remote, ok := editorSchemes[strings.ToLower(u.Scheme)]
+	switch {
+	case !ok || u.Opaque != "":
+		return false
+	case remote:
+		return u.Host == "file" && len(u.Path) > 1
+	}
+	return u.Host == "open" && (u.Path == "" || u.Path == "/") && u.Query().Get("file") != ""
+}
+
+// RemoteEditorURL rewrites a VS Code-style link to a file on the remote
+// host, like vscode://file/home/me/app/main.go:12, to open the file there
+// over the editor's Remote-SSH, rather than look for it on this machine:
+// vscode://vscode-remote/ssh-remote+sshHost/home/me/app/main.go:12. Other
+// URLs come back unchanged, with false.
+func RemoteEditorURL(rawURL, sshHost string) (string, bool) {
+	scheme, rest, ok := strings.Cut(rawURL, "://")
+	if !ok || sshHost == "" || !editorSchemes[strings.ToLower(scheme)] {
+		return rawURL, false
+	}
+	path, ok := strings.CutPrefix(rest, "file/")
+	if !ok || path == "" {
+		return rawURL, false
+	}
+	return scheme + "://vscode-remote/ssh-remote+" + sshHost + "/" + path, true
+}
@@ -0,0 +1,116 @@
+package opener
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileLifetime is how long a file sent to be opened is kept, long enough for
+// the application opening it to have read it
+const fileLifetime = time.Hour
+
+// filePrefix starts the name of each file's directory under the temp
+// directory, so leftovers from a daemon that didn't exit cleanly are found
+const filePrefix = "bankshot-open-"
+
+// Files keeps the files sent from remote hosts to be opened, each in a
+// directory of its own so it keeps its name, and removes them once they've
+// been open a while, or when the daemon exits
+type Files struct {
+	dir      string // Where the directories go; empty for the temp directory
+	lifetime time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer // Each file's directory, to its removal once opened
+}
+
+// NewFiles creates a Files keeping its files under dir, or the temp
+// directory if dir is empty
+func NewFiles(dir string) *Files {
+	return &Files{
+		dir:      dir,
+		lifetime: fileLifetime,
+		pending:  make(map[string]*time.Timer),
+	}
+}
+
+// Create makes a new directory for a file named name and returns the path
+// to write it at
+func (f *Files) Create(name string) (string, error) {
+	dir, err := os.MkdirTemp(f.dir, filePrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	f.mu.Lock()
+	f.pending[dir] = nil
+	f.mu.Unlock()
+	return filepath.Join(dir, name), nil
+}
+
+// Opened has the file at path, from Create, removed once the lifetime is up
+func (f *Files) Opened(path string) {
+	dir := filepath.Dir(path)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.pending[dir]; !ok {
+		return
+	}
+	f.pending[dir] = time.AfterFunc(f.lifetime, func() {
+		f.Remove(path)
+	})
+}
+
+// Remove removes the file at path, from Create, now
+func (f *Files) Remove(path string) {
+	dir := filepath.Dir(path)
+	f.mu.Lock()
+	timer, ok := f.pending[dir]
+	delete(f.pending, dir)
+	f.mu.Unlock()
+	if !ok {
+		return
+	}
+	if timer != nil {
+		timer.Stop()
+	}
+	_ = os.RemoveAll(dir)
+}
+
+// Close removes every file kept
+func (f *Files) Close() {
+	f.mu.Lock()
+	dirs := make([]string, 0, len(f.pending))
+	for dir, timer := range f.pending {
+		if timer != nil {
+			timer.Stop()
+		}
+		dirs = append(dirs, dir)
+	}
+	clear(f.pending)
+	f.mu.Unlock()
+
+	for _, dir := range dirs {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// Clean removes the files a daemon before this one left behind, once
+// they're older than the lifetime. Another user's can't be removed, as a
+// shared temp directory is sticky.
+func (f *Files) Clean() {
+	dir := f.dir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, filePrefix+"*"))
+	for _, match := range matches {
+		info, err := os.Lstat(match)
+		if err != nil || !info.IsDir() || time.Since(info.ModTime()) < f.lifetime {
+			continue
+		}
+		_ = os.RemoveAll(match)
+	}
+}
@@ -1,33 +1,226 @@
 package opener
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/phinze/bankshot/pkg/config"
 	"github.com/pkg/browser"
 )
 
+// DefaultSchemes are the URL schemes opened whatever else is allowed
+var DefaultSchemes = []string{"http", "https"}
+
 // Opener handles opening URLs in the browser
 type Opener struct {
-	logger *slog.Logger
-	mu     sync.Mutex
+	logger   *slog.Logger
+	goos     string // Platform to launch browsers for
+	throttle *throttle
+	mu       sync.Mutex // Serializes launches, and guards throttle
+
+	rulesMu sync.RWMutex
+	rules   *openerRules // Replaced whole by Configure
+}
+
+// openerRules are what an Opener's config lets it open and how, never
+// changed once built
+type openerRules struct {
+	schemes        map[string]bool // Lowercase schemes OpenURL accepts
+	editors        bool            // Whether links to files in editors are accepted
+	browsers       []config.BrowserRule
+	browser        string            // Browser for URLs no rule picks one for
+	profiles       map[string]string // Profile names to the browser's own
+	guard          *domainGuard      // Asks about new hosts; nil unless confirm_new_domains
+	confirmCommand []string          // What guard asks with
+	files          map[string]bool   // Lowercase extensions OpenFile opens; nil unless open_files
 }
 
-// New creates a new Opener
-func New(logger *slog.Logger) *Opener {
-	return &Opener{
-		logger: logger,
+// LaunchOptions are how to open a URL beyond what the config says
+type LaunchOptions struct {
+	Browser   string // Browser to use, by opener.browser name, whatever the config picks
+	Profile   string // Browser profile, by opener.profiles name or the browser's own
+	Incognito bool   // Open in a private window
+}
+
+// New creates a new Opener that opens URLs with the DefaultSchemes and
+// those cfg allows, and links to files in editors if cfg allows them, in
+// the browsers cfg picks, as often as cfg lets it
+func New(cfg *config.OpenerConfig, logger *slog.Logger) *Opener {
+	o := &Opener{
+		logger:   logger,
+		goos:     runtime.GOOS,
+		throttle: newThrottle(0, 0),
 	}
+	o.Configure(cfg)
+	return o
 }
 
-// OpenURL opens a URL in the default browser
+// Configure replaces what o opens and how with cfg's rules, as when the
+// config file changes. Opens made so far still count toward the duplicate
+// window and per-minute cap, and the hosts confirm_new_domains is asking
+// about stay asked about while its file and command are unchanged.
+func (o *Opener) Configure(cfg *config.OpenerConfig) {
+	rules := &openerRules{
+		schemes:  make(map[string]bool),
+		editors:  cfg.EditorLinks != "",
+		browsers: cfg.Browsers,
+		browser:  cfg.Browser,
+		profiles: cfg.Profiles,
+	}
+	for _, scheme := range append(DefaultSchemes, cfg.AllowedSchemes...) {
+		rules.schemes[strings.ToLower(scheme)] = true
+	}
+	if cfg.OpenFiles {
+		extensions := cfg.FileExtensions
+		if len(extensions) == 0 {
+			extensions = config.DefaultFileExtensions
+		}
+		rules.files = make(map[string]bool)
+		for _, ext := range extensions {
+			rules.files[strings.ToLower(ext)] = true
+		}
+	}
+
+	o.rulesMu.Lock()
+	if cfg.ConfirmNewDomains {
+		rules.confirmCommand = cfg.ConfirmCommand
+		if prev := o.rules; prev != nil && prev.guard != nil && prev.guard.path == cfg.DomainsFile && slices.Equal(prev.confirmCommand, cfg.ConfirmCommand) {
+			rules.guard = prev.guard
+		} else {
+			rules.guard = newDomainGuard(cfg.DomainsFile, cfg.ConfirmCommand, o.goos, o.logger)
+		}
+	}
+	o.rules = rules
+	o.rulesMu.Unlock()
+
+	// Validated with the rest of the config; empty means no window
+	window, _ := time.ParseDuration(cfg.DuplicateWindow)
+	o.mu.Lock()
+	o.throttle.window = window
+	o.throttle.perMinute = cfg.MaxOpensPerMinute
+	o.mu.Unlock()
+}
+
+// currentRules returns o's rules, as last configured
+func (o *Opener) currentRules() *openerRules {
+	o.rulesMu.RLock()
+	defer o.rulesMu.RUnlock()
+	return o.rules
+}
+
+// CheckURL returns an error unless rawURL has a scheme the Opener accepts.
+// A compromised remote host could otherwise have the browser open local
+// files, run javascript: URLs, or launch whatever app handles a custom
+// scheme.
+func (o *Opener) CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "" {
+		return fmt.Errorf("URL has no scheme")
+	}
+	rules := o.currentRules()
+	if rules.schemes[scheme] || (rules.editors && editorFileLink(u)) {
+		return nil
+	}
+	if _, editor := editorSchemes[scheme]; editor && rules.editors {
+		return fmt.Errorf("%s: only links to files are opened in editors", scheme)
+	}
+	return fmt.Errorf("%s: URLs are not in opener.allowed_schemes", scheme)
+}
+
+// ConfirmURL returns an error unless rawURL passes CheckURL and, with
+// confirm_new_domains, its host was allowed before or is allowed now, as for
+// a URL the user may open later, like a notification's
+func (o *Opener) ConfirmURL(rawURL string) error {
+	if err := o.CheckURL(rawURL); err != nil {
+		return err
+	}
+	if guard := o.currentRules().guard; guard != nil {
+		if err := guard.check(rawURL); err != nil {
+			o.logger.Info("Not opening URL", "url", rawURL, "reason", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenURL opens a URL in the browser configured for it, or the default
+// browser
 func (o *Opener) OpenURL(url string) error {
-	// Serialize browser operations to avoid race conditions
+	return o.OpenURLWith(url, LaunchOptions{})
+}
+
+// OpenURLWith opens a URL like OpenURL, in the profile or private window
+// opts asks for. Those need a browser set in the config, since there's no
+// telling the system's default browser about them. A URL opened the same
+// way within the duplicate window returns ErrDuplicate, one over the
+// per-minute cap ErrRateLimited, and one on a new host that wasn't
+// confirmed ErrNotConfirmed.
+func (o *Opener) OpenURLWith(url string, opts LaunchOptions) error {
+	return o.OpenURLVia(url, nil, opts)
+}
+
+// OpenURLVia opens rawURL like OpenURLWith, at the URL resolve returns for
+// it. resolve runs only once rawURL has passed the checks and isn't held
+// back as a duplicate or over the cap, so what it sets up for the URL, like
+// a forward, isn't for an open that won't happen. A nil resolve opens
+// rawURL itself.
+func (o *Opener) OpenURLVia(rawURL string, resolve func() string, opts LaunchOptions) error {
+	if err := o.ConfirmURL(rawURL); err != nil {
+		return err
+	}
+	key := openKey{url: rawURL, opts: opts}
+	o.mu.Lock()
+	err := o.throttle.check(key)
+	o.mu.Unlock()
+	if err != nil {
+		o.logger.Info("Not opening URL", "url", rawURL, "reason", err)
+		return err
+	}
+
+	url := rawURL
+	if resolve != nil {
+		url = resolve()
+	}
+	command, err := o.browserCommand(url, opts)
+	if err != nil {
+		return err
+	}
+
+	// Serialize browser operations to avoid race conditions. The dialog
+	// asking about a new host and resolving the URL are left out, so they
+	// hold up no other opens.
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
+	if err := o.throttle.check(key); err != nil {
+		o.logger.Info("Not opening URL", "url", rawURL, "reason", err)
+		return err
+	}
+	if err := o.launchURL(url, command); err != nil {
+		return err
+	}
+	o.throttle.record(key)
+	return nil
+}
+
+// launchURL opens url with command, or in the default browser if command is
+// nil. Must be called with o.mu held.
+func (o *Opener) launchURL(url string, command []string) error {
 	o.logger.Info("Opening URL", "url", url)
 
 	// Check if we're in test mode - if so, skip actual browser opening
@@ -36,6 +229,15 @@ func (o *Opener) OpenURL(url string) error {
 		return nil
 	}
 
+	if command != nil {
+		if err := o.runBrowser(command); err != nil {
+			o.logger.Error("Failed to open URL", "url", url, "command", command[0], "error", err)
+			return fmt.Errorf("failed to open URL: %w", err)
+		}
+		o.logger.Debug("Opened URL with configured browser", "url", url, "command", command[0])
+		return nil
+	}
+
 	// Use the browser package to open the URL
 	if err := browser.OpenURL(url); err != nil {
 		o.logger.Error("Failed to open URL", "url", url, "error", err)
@@ -45,3 +247,169 @@ func (o *Opener) OpenURL(url string) error {
 	o.logger.Debug("Successfully opened URL", "url", url)
 	return nil
 }
+
+// browserCommand returns the command opening rawURL as the first browser
+// rule matching its host says, or in the configured browser, or nil for the
+// default browser. A rule's command can't take opts, so with any set, those
+// rules are passed over. URLs other than http and https are left to the app
+// the system has for their scheme, such as an editor.
+func (o *Opener) browserCommand(rawURL string, opts LaunchOptions) ([]string, error) {
+	if !isWebURL(rawURL) {
+		if opts != (LaunchOptions{}) {
+			return nil, errors.New("a browser profile or private window only applies to http and https URLs")
+		}
+		return nil, nil
+	}
+
+	rules := o.currentRules()
+	name, profile := rules.browser, ""
+	if rule := rules.browserRule(rawURL, opts == LaunchOptions{}); rule != nil {
+		if len(rule.Command) > 0 {
+			return ruleCommand(rule.Command, rawURL), nil
+		}
+		name, profile = rule.Browser, rule.Profile
+	}
+	if opts.Browser != "" {
+		name, profile = opts.Browser, ""
+	}
+
+	if opts.Profile != "" {
+		profile = opts.Profile
+		if mapped, ok := rules.profiles[opts.Profile]; ok {
+			profile = mapped
+		}
+	}
+	if name == "" {
+		if opts != (LaunchOptions{}) {
+			return nil, errors.New("opening in a browser profile or private window needs opener.browser set in the daemon's config")
+		}
+		return nil, nil
+	}
+	return browserLaunch(o.goos, name, profile, opts.Incognito, rawURL)
+}
+
+// isWebURL reports whether rawURL is an http or https URL
+func isWebURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "http" || scheme == "https"
+}
+
+// browserRule returns the first browser rule matching rawURL's host, or
+// nil if none does, skipping those with a command unless withCommand
+func (r *openerRules) browserRule(rawURL string, withCommand bool) *config.BrowserRule {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	for i, rule := range r.browsers {
+		if len(rule.Command) > 0 && !withCommand {
+			continue
+		}
+		if ok, _ := path.Match(strings.ToLower(rule.Match), host); ok {
+			return &r.browsers[i]
+		}
+	}
+	return nil
+}
+
+// ruleCommand returns a rule's command with rawURL filled in for "{url}",
+// or appended when no argument has it
+func ruleCommand(args []string, rawURL string) []string {
+	command := make([]string, 0, len(args)+1)
+	substituted := false
+	for _, arg := range args {
+		if strings.Contains(arg, "{url}") {
+			arg = strings.ReplaceAll(arg, "{url}", rawURL)
+			substituted = true
+		}
+		command = append(command, arg)
+	}
+	if !substituted {
+		command = append(command, rawURL)
+	}
+	return command
+}
+
+// runBrowser starts a browser command without waiting for it, since a
+// browser started fresh keeps running; a failure after it starts is only
+// logged
+func (o *Opener) runBrowser(command []string) error {
+	cmd := exec.Command(command[0], command[1:]...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			o.logger.Warn("Browser command failed", "command", command[0], "error", err)
+		}
+	}()
+	return nil
+}
+
+// CheckFile returns an error unless files named name may be opened: the
+// config has to allow opening files, and name's extension has to be one it
+// lists. The application a file opens in may run what's in it, as with a
+// .command, .jar, or .app in a zip, which a compromised remote host could
+// otherwise send.
+func (o *Opener) CheckFile(name string) error {
+	files := o.currentRules().files
+	if files == nil {
+		return errors.New("opening files isn't enabled (set opener.open_files in the daemon's config)")
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	if ext == "" {
+		return fmt.Errorf("%s has no extension to tell what it opens in", name)
+	}
+	if !files[ext] {
+		return fmt.Errorf(".%s files are not in opener.file_extensions", ext)
+	}
+	return nil
+}
+
+// OpenFile opens a file with its default application, once CheckFile allows
+// it and, with confirm_new_domains, its extension was allowed before or is
+// allowed now, marked as downloaded so the system warns before running it.
+// Files count toward the duplicate window and per-minute cap like URLs.
+func (o *Opener) OpenFile(path string) error {
+	if err := o.CheckFile(filepath.Base(path)); err != nil {
+		return err
+	}
+	if guard := o.currentRules().guard; guard != nil {
+		if err := guard.checkFile(filepath.Base(path)); err != nil {
+			o.logger.Info("Not opening file", "path", path, "reason", err)
+			return err
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	key := openKey{url: path}
+	if err := o.throttle.check(key); err != nil {
+		o.logger.Info("Not opening file", "path", path, "reason", err)
+		return err
+	}
+
+	o.logger.Info("Opening file", "path", path)
+	if err := quarantine(path); err != nil {
+		return fmt.Errorf("failed to mark %s as downloaded: %w", filepath.Base(path), err)
+	}
+
+	if os.Getenv("BANKSHOT_TEST_NO_BROWSER") == "1" {
+		o.logger.Debug("Test mode: skipping file open", "path", path)
+		o.throttle.record(key)
+		return nil
+	}
+
+	if err := browser.OpenFile(path); err != nil {
+		o.logger.Error("Failed to open file", "path", path, "error", err)
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	o.throttle.record(key)
+	return nil
+}
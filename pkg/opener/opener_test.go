@@ -1,14 +1,21 @@
 package opener
 
 import (
+	"errors"
 	"log/slog"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/config"
 )
 
 func TestNew(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
-	o := New(logger)
+	o := New(&config.OpenerConfig{}, logger)
 
 	if o == nil {
 		t.Fatal("New() returned nil")
@@ -23,7 +30,7 @@ func TestOpenURL(t *testing.T) {
 	t.Setenv("BANKSHOT_TEST_NO_BROWSER", "1")
 
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
-	o := New(logger)
+	o := New(&config.OpenerConfig{}, logger)
 
 	tests := []struct {
 		name    string
@@ -48,7 +55,22 @@ func TestOpenURL(t *testing.T) {
 		{
 			name:    "file url",
 			url:     "file:///tmp/test.txt",
-			wantErr: false,
+			wantErr: true,
+		},
+		{
+			name:    "javascript url",
+			url:     "javascript:alert(1)",
+			wantErr: true,
+		},
+		{
+			name:    "custom scheme",
+			url:     "vscode://file/etc/passwd",
+			wantErr: true,
+		},
+		{
+			name:    "no scheme",
+			url:     "example.com",
+			wantErr: true,
 		},
 	}
 
@@ -56,19 +78,36 @@ func TestOpenURL(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Browser opening is disabled by BANKSHOT_TEST_NO_BROWSER env var
 			err := o.OpenURL(tt.url)
-			if err != nil {
+			if (err != nil) != tt.wantErr {
 				t.Errorf("OpenURL() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
+func TestOpenURLAllowedSchemes(t *testing.T) {
+	t.Setenv("BANKSHOT_TEST_NO_BROWSER", "1")
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	o := New(&config.OpenerConfig{AllowedSchemes: []string{"VSCode"}}, logger)
+
+	if err := o.OpenURL("vscode://file/home/me/project"); err != nil {
+		t.Errorf("OpenURL() of an allowed scheme error = %v", err)
+	}
+	if err := o.OpenURL("HTTPS://example.com"); err != nil {
+		t.Errorf("OpenURL() of an uppercase default scheme error = %v", err)
+	}
+	if err := o.OpenURL("zoommtg://zoom.us/join"); err == nil {
+		t.Error("OpenURL() of a scheme not allowed succeeded")
+	}
+}
+
 func TestOpenURLConcurrency(t *testing.T) {
 	// Set environment variable to prevent browser opening in tests
 	t.Setenv("BANKSHOT_TEST_NO_BROWSER", "1")
 
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
-	o := New(logger)
+	o := New(&config.OpenerConfig{}, logger)
 
 	// Test concurrent access to ensure mutex works correctly
 	done := make(chan bool, 10)
@@ -85,3 +124,583 @@ func TestOpenURLConcurrency(t *testing.T) {
 		<-done
 	}
 }
+
+func TestBrowserCommand(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	o := New(&config.OpenerConfig{Browsers: []config.BrowserRule{
+		{Match: "*.corp.example.com", Command: []string{"open", "-na", "Google Chrome", "--args", "--profile-directory=Profile 1"}},
+		{Match: "localhost", Command: []string{"firefox", "-P", "dev", "--new-tab", "{url}"}},
+	}}, logger)
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"https://wiki.corp.example.com/page", []string{"open", "-na", "Google Chrome", "--args", "--profile-directory=Profile 1", "https://wiki.corp.example.com/page"}},
+		{"https://WIKI.Corp.Example.com/", []string{"open", "-na", "Google Chrome", "--args", "--profile-directory=Profile 1", "https://WIKI.Corp.Example.com/"}},
+		{"http://localhost:3000/", []string{"firefox", "-P", "dev", "--new-tab", "http://localhost:3000/"}},
+		{"https://corp.example.com/", nil},
+		{"https://example.com/", nil},
+	}
+	for _, tt := range tests {
+		if got, err := o.browserCommand(tt.url, LaunchOptions{}); err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("browserCommand(%q) = %q, %v, want %q", tt.url, got, err, tt.want)
+		}
+	}
+}
+
+func TestBrowserCommandOptions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	o := New(&config.OpenerConfig{
+		Browser:  "firefox",
+		Profiles: map[string]string{"work": "Profile 1"},
+		Browsers: []config.BrowserRule{
+			{Match: "*.corp.example.com", Browser: "chrome", Profile: "Profile 2"},
+			{Match: "localhost", Command: []string{"firefox", "-P", "dev"}},
+		},
+	}, logger)
+	o.goos = "linux"
+
+	tests := []struct {
+		name string
+		url  string
+		opts LaunchOptions
+		want []string
+	}{
+		{"configured browser", "https://example.com/", LaunchOptions{},
+			[]string{"firefox", "https://example.com/"}},
+		{"rule profile", "https://wiki.corp.example.com/", LaunchOptions{},
+			[]string{"google-chrome", "--profile-directory=Profile 2", "https://wiki.corp.example.com/"}},
+		{"mapped profile", "https://wiki.corp.example.com/", LaunchOptions{Profile: "work"},
+			[]string{"google-chrome", "--profile-directory=Profile 1", "https://wiki.corp.example.com/"}},
+		{"unmapped profile", "https://example.com/", LaunchOptions{Profile: "default-release"},
+			[]string{"firefox", "-P", "default-release", "https://example.com/"}},
+		{"incognito", "https://wiki.corp.example.com/", LaunchOptions{Incognito: true},
+			[]string{"google-chrome", "--profile-directory=Profile 2", "--incognito", "https://wiki.corp.example.com/"}},
+		{"command rule", "http://localhost:3000/", LaunchOptions{},
+			[]string{"firefox", "-P", "dev", "http://localhost:3000/"}},
+		{"command rule passed over", "http://localhost:3000/", LaunchOptions{Incognito: true},
+			[]string{"firefox", "--private-window", "http://localhost:3000/"}},
+		{"browser option", "https://wiki.corp.example.com/", LaunchOptions{Browser: "brave"},
+			[]string{"brave-browser", "https://wiki.corp.example.com/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := o.browserCommand(tt.url, tt.opts)
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("browserCommand(%q, %+v) = %q, %v, want %q", tt.url, tt.opts, got, err, tt.want)
+			}
+		})
+	}
+
+	// Without a configured browser, options have nothing to apply to
+	o = New(&config.OpenerConfig{}, logger)
+	if _, err := o.browserCommand("https://example.com/", LaunchOptions{Profile: "work"}); err == nil {
+		t.Error("browserCommand() with a profile and no browser succeeded, want error")
+	}
+}
+
+func TestBrowserLaunch(t *testing.T) {
+	tests := []struct {
+		goos    string
+		browser string
+		profile string
+		private bool
+		want    []string
+	}{
+		{"darwin", "chrome", "Profile 1", false,
+			[]string{"open", "-na", "Google Chrome", "--args", "--profile-directory=Profile 1", "https://example.com/"}},
+		{"darwin", "firefox", "work", true,
+			[]string{"/Applications/Firefox.app/Contents/MacOS/firefox", "-P", "work", "--private-window", "https://example.com/"}},
+		{"linux", "brave", "", true,
+			[]string{"brave-browser", "--incognito", "https://example.com/"}},
+		{"windows", "edge", "Default", true,
+			[]string{"msedge", "--profile-directory=Default", "--inprivate", "https://example.com/"}},
+	}
+	for _, tt := range tests {
+		got, err := browserLaunch(tt.goos, tt.browser, tt.profile, tt.private, "https://example.com/")
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("browserLaunch(%q, %q) = %q, %v, want %q", tt.goos, tt.browser, got, err, tt.want)
+		}
+	}
+
+	for name, want := range map[string]string{
+		"firefox":                         "firefox",
+		"Google Chrome":                   "chrome",
+		"/Applications/Brave Browser.app": "brave",
+		"Firefox.app":                     "firefox",
+		"com.google.Chrome":               "chrome",
+		"Safari":                          "",
+	} {
+		if got, ok := BrowserNamed(name); got != want || ok != (want != "") {
+			t.Errorf("BrowserNamed(%q) = %q, %v, want %q", name, got, ok, want)
+		}
+	}
+
+	// Every browser the config accepts must be launchable
+	for _, name := range config.BrowserNames {
+		if _, err := browserLaunch("linux", name, "", false, "https://example.com/"); err != nil {
+			t.Errorf("browserLaunch(%q) error = %v", name, err)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	th := newThrottle(2*time.Second, 3)
+	th.now = func() time.Time { return now }
+
+	a := openKey{url: "https://example.com/a"}
+	b := openKey{url: "https://example.com/b"}
+	private := openKey{url: "https://example.com/a", opts: LaunchOptions{Incognito: true}}
+	allow := func(key openKey) error {
+		if err := th.check(key); err != nil {
+			return err
+		}
+		th.record(key)
+		return nil
+	}
+
+	if err := allow(a); err != nil {
+		t.Fatalf("first open of a: %v", err)
+	}
+	if err := allow(a); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("second open of a = %v, want ErrDuplicate", err)
+	}
+	if err := allow(private); err != nil {
+		t.Errorf("private open of a: %v", err)
+	}
+
+	now = now.Add(2 * time.Second)
+	if err := allow(a); err != nil {
+		t.Errorf("open of a after the window: %v", err)
+	}
+	if err := allow(b); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("fourth open in a minute = %v, want ErrRateLimited", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := allow(b); err != nil {
+		t.Errorf("open of b a minute later: %v", err)
+	}
+}
+
+func TestOpenURLDuplicate(t *testing.T) {
+	t.Setenv("BANKSHOT_TEST_NO_BROWSER", "1")
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	o := New(&config.OpenerConfig{DuplicateWindow: "1m"}, logger)
+
+	if err := o.OpenURL("https://example.com/"); err != nil {
+		t.Fatalf("OpenURL() error = %v", err)
+	}
+	if err := o.OpenURL("https://example.com/"); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("OpenURL() again error = %v, want ErrDuplicate", err)
+	}
+	if err := o.OpenURL("https://example.com/other"); err != nil {
+		t.Errorf("OpenURL() of another URL error = %v", err)
+	}
+}
+
+func TestOpenURLFailureNotCounted(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+	o := New(&config.OpenerConfig{
+		DuplicateWindow:   "1m",
+		MaxOpensPerMinute: 1,
+		Browsers: []config.BrowserRule{
+			{Match: "*", Command: []string{filepath.Join(t.TempDir(), "no-such-browser")}},
+		},
+	}, logger)
+
+	for i := 0; i < 2; i++ {
+		err := o.OpenURL("https://example.com/")
+		if err == nil || errors.Is(err, ErrDuplicate) || errors.Is(err, ErrRateLimited) {
+			t.Errorf("OpenURL() attempt %d error = %v, want the launch's failure", i+1, err)
+		}
+	}
+}
+
+func TestOpenFileDuplicate(t *testing.T) {
+	t.Setenv("BANKSHOT_TEST_NO_BROWSER", "1")
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	o := New(&config.OpenerConfig{OpenFiles: true, DuplicateWindow: "1m", MaxOpensPerMinute: 2}, logger)
+
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.pdf")
+	other := filepath.Join(dir, "other.pdf")
+	for _, path := range []string{report, other} {
+		if err := os.WriteFile(path, []byte("%PDF"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := o.OpenFile(report); err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	if err := o.OpenFile(report); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("OpenFile() again error = %v, want ErrDuplicate", err)
+	}
+	if err := o.OpenURL("https://example.com/"); err != nil {
+		t.Errorf("OpenURL() error = %v", err)
+	}
+	if err := o.OpenFile(other); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("OpenFile() over the cap error = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestOpenURLViaResolvesOnlyWhatOpens(t *testing.T) {
+	t.Setenv("BANKSHOT_TEST_NO_BROWSER", "1")
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	o := New(&config.OpenerConfig{DuplicateWindow: "1m"}, logger)
+
+	resolved := 0
+	resolve := func() string {
+		resolved++
+		return "http://localhost:3001/"
+	}
+	if err := o.OpenURLVia("http://localhost:3000/", resolve, LaunchOptions{}); err != nil {
+		t.Fatalf("OpenURLVia() error = %v", err)
+	}
+	if err := o.OpenURLVia("http://localhost:3000/", resolve, LaunchOptions{}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("OpenURLVia() again error = %v, want ErrDuplicate", err)
+	}
+	if err := o.OpenURLVia("javascript:alert(1)", resolve, LaunchOptions{}); err == nil {
+		t.Error("OpenURLVia() of a javascript: URL should error")
+	}
+	if resolved != 1 {
+		t.Errorf("resolve ran %d times, want once for the URL that opened", resolved)
+	}
+}
+
+func TestDomainGuard(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	path := filepath.Join(t.TempDir(), "domains.json")
+	g := newDomainGuard(path, nil, "linux", logger)
+
+	var asked []string
+	answers := map[string]answer{"good.example": answerAllow, "evil.example": answerDeny, "vscode:": answerAllow}
+	g.ask = func(host, rawURL string) (answer, error) {
+		asked = append(asked, host)
+		return answers[host], nil
+	}
+
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"https://good.example/login", false},
+		{"https://GOOD.example/again", false},
+		{"https://evil.example/login", true},
+		{"https://evil.example/again", true},
+		{"https://quiet.example/", true},
+		{"https://quiet.example/", true},
+		{"http://localhost:3000/", false},
+		{"http://127.0.0.1:8080/", false},
+		{"vscode://file/home/me/main.go", false},
+		{"VSCODE://file/home/me/other.go", false},
+	}
+	for _, tt := range tests {
+		err := g.check(tt.url)
+		if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrNotConfirmed)) {
+			t.Errorf("check(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+	}
+
+	// Answered hosts are asked about once; unanswered ones every time
+	wantAsked := []string{"good.example", "evil.example", "quiet.example", "quiet.example", "vscode:"}
+	if !slices.Equal(asked, wantAsked) {
+		t.Errorf("asked about %q, want %q", asked, wantAsked)
+	}
+	list, err := readDomainList(path)
+	if err != nil {
+		t.Fatalf("readDomainList() error = %v", err)
+	}
+	if !slices.Equal(list.Allowed, []string{"good.example", "vscode:"}) || !slices.Equal(list.Denied, []string{"evil.example"}) {
+		t.Errorf("domains file = %+v, want good.example and vscode: allowed and evil.example denied", list)
+	}
+}
+
+func TestDomainGuardOneDialogPerHost(t *testing.T) {
+	t.Setenv("BANKSHOT_TEST_NO_BROWSER", "1")
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	o := New(&config.OpenerConfig{}, logger)
+	o.rules.guard = newDomainGuard(filepath.Join(t.TempDir(), "domains.json"), nil, "linux", logger)
+
+	asking := make(chan struct{})
+	answerIt := make(chan struct{})
+	o.rules.guard.ask = func(host, rawURL string) (answer, error) {
+		if host == "slow.example" {
+			close(asking)
+			<-answerIt
+		}
+		return answerAllow, nil
+	}
+
+	first := make(chan error, 1)
+	go func() {
+		first <- o.OpenURL("https://slow.example/one")
+	}()
+	<-asking
+
+	// While the dialog is open, the host's other URLs are refused, and
+	// other hosts still open
+	if err := o.OpenURL("https://slow.example/two"); !errors.Is(err, ErrNotConfirmed) {
+		t.Errorf("OpenURL() while asking error = %v, want ErrNotConfirmed", err)
+	}
+	if err := o.OpenURL("https://other.example/"); err != nil {
+		t.Errorf("OpenURL() of another host while asking error = %v", err)
+	}
+
+	close(answerIt)
+	if err := <-first; err != nil {
+		t.Errorf("OpenURL() once allowed error = %v", err)
+	}
+	if err := o.OpenURL("https://slow.example/two"); err != nil {
+		t.Errorf("OpenURL() after allowing error = %v", err)
+	}
+}
+
+func TestAskDialogCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	tests := []struct {
+		command []string
+		want    answer
+	}{
+		{[]string{"sh", "-c", `test "$1" = good.example`, "sh", "{host}"}, answerAllow},
+		{[]string{"sh", "-c", "exit 1"}, answerDeny},
+		{[]string{"sh", "-c", "exit 5"}, answerNone},
+	}
+	for _, tt := range tests {
+		got, err := askDialog(tt.command, "linux", "good.example", "https://good.example/")
+		if err != nil || got != tt.want {
+			t.Errorf("askDialog(%q) = %v, %v, want %v", tt.command, got, err, tt.want)
+		}
+	}
+}
+
+func TestRemoteEditorURL(t *testing.T) {
+	tests := []struct {
+		url    string
+		host   string
+		want   string
+		wantOK bool
+	}{
+		{"vscode://file/home/me/app/main.go:12:3", "devbox",
+			"vscode://vscode-remote/ssh-remote+devbox/home/me/app/main.go:12:3", true},
+		{"cursor://file/srv/app/README.md", "me@devbox",
+			"cursor://vscode-remote/ssh-remote+me@devbox/srv/app/README.md", true},
+		{"vscode://vscode-remote/ssh-remote+devbox/home/me/main.go", "devbox",
+			"vscode://vscode-remote/ssh-remote+devbox/home/me/main.go", false},
+		{"vscode://ms-vscode.remote-server/extension", "devbox",
+			"vscode://ms-vscode.remote-server/extension", false},
+		{"jetbrains://idea/navigate/reference?project=app&path=main.go", "devbox",
+			"jetbrains://idea/navigate/reference?project=app&path=main.go", false},
+		{"https://file/home/me", "devbox", "https://file/home/me", false},
+		{"vscode://file/home/me/main.go", "", "vscode://file/home/me/main.go", false},
+	}
+	for _, tt := range tests {
+		got, ok := RemoteEditorURL(tt.url, tt.host)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("RemoteEditorURL(%q, %q) = %q, %v, want %q, %v", tt.url, tt.host, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestEditorLinks(t *testing.T) {
+	t.Setenv("BANKSHOT_TEST_NO_BROWSER", "1")
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	o := New(&config.OpenerConfig{
+		EditorLinks: "open",
+		Browsers:    []config.BrowserRule{{Match: "*", Command: []string{"firefox"}}},
+	}, logger)
+
+	for _, rawURL := range []string{"vscode://file/home/me/main.go:3", "cursor://file/srv/app/README.md", "idea://open?file=/home/me/Main.java&line=3"} {
+		if err := o.CheckURL(rawURL); err != nil {
+			t.Errorf("CheckURL(%q) error = %v", rawURL, err)
+		}
+		// Editor links go to the editor, whatever the browser rules say
+		if command, err := o.browserCommand(rawURL, LaunchOptions{}); err != nil || command != nil {
+			t.Errorf("browserCommand(%q) = %q, %v, want nil", rawURL, command, err)
+		}
+	}
+	// Only links to files; not extensions' handlers, or other hosts' files
+	for _, rawURL := range []string{
+		"vscode://ms-vscode.remote-server/extension",
+		"vscode://vscode-remote/ssh-remote+evil.example/home/me/main.go",
+		"vscode://file",
+		"vscode:file/home/me/main.go",
+		"jetbrains://idea/navigate/reference?project=app",
+		"idea://settings?name=plugins",
+	} {
+		if err := o.CheckURL(rawURL); err == nil {
+			t.Errorf("CheckURL(%q) succeeded, want only links to files accepted", rawURL)
+		}
+	}
+	if err := New(&config.OpenerConfig{}, logger).CheckURL("vscode://file/home/me/main.go"); err == nil {
+		t.Error("CheckURL() of an editor link without editor_links succeeded")
+	}
+}
+
+func TestCheckFile(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	off := New(&config.OpenerConfig{}, logger)
+	if err := off.CheckFile("report.pdf"); err == nil {
+		t.Error("CheckFile() with open_files off = nil, want an error")
+	}
+
+	o := New(&config.OpenerConfig{OpenFiles: true}, logger)
+	for _, name := range []string{"report.pdf", "Chart.PNG", "index.html"} {
+		if err := o.CheckFile(name); err != nil {
+			t.Errorf("CheckFile(%q) error = %v", name, err)
+		}
+	}
+	for _, name := range []string{"run.command", "app.jar", "App.app.zip", "report.pdf.terminal", "Makefile"} {
+		if err := o.CheckFile(name); err == nil {
+			t.Errorf("CheckFile(%q) = nil, want an error", name)
+		}
+	}
+
+	custom := New(&config.OpenerConfig{OpenFiles: true, FileExtensions: []string{"xlsx"}}, logger)
+	if err := custom.CheckFile("sheet.xlsx"); err != nil {
+		t.Errorf("CheckFile(sheet.xlsx) error = %v", err)
+	}
+	if err := custom.CheckFile("report.pdf"); err == nil {
+		t.Error("CheckFile(report.pdf) = nil with only xlsx allowed, want an error")
+	}
+}
+
+func TestOpenFileChecks(t *testing.T) {
+	t.Setenv("BANKSHOT_TEST_NO_BROWSER", "1")
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	o := New(&config.OpenerConfig{}, logger)
+
+	path := filepath.Join(t.TempDir(), "report.pdf")
+	if err := os.WriteFile(path, []byte("%PDF"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.OpenFile(path); err == nil {
+		t.Error("OpenFile() with open_files off = nil, want an error")
+	}
+
+	// New extensions are asked about like new hosts
+	o = New(&config.OpenerConfig{OpenFiles: true}, logger)
+	o.rules.guard = newDomainGuard(filepath.Join(t.TempDir(), "domains.json"), nil, "linux", logger)
+	var asked []string
+	o.rules.guard.ask = func(host, rawURL string) (answer, error) {
+		asked = append(asked, host+" "+rawURL)
+		return answerDeny, nil
+	}
+	if err := o.OpenFile(path); !errors.Is(err, ErrNotConfirmed) {
+		t.Errorf("OpenFile() refused error = %v, want ErrNotConfirmed", err)
+	}
+	if !slices.Equal(asked, []string{".pdf report.pdf"}) {
+		t.Errorf("asked about %q, want .pdf for report.pdf", asked)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	f := NewFiles(dir)
+	f.lifetime = 50 * time.Millisecond
+
+	kept, err := f.Create("report.pdf")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if filepath.Base(kept) != "report.pdf" {
+		t.Errorf("Create() = %s, want the file's own name", kept)
+	}
+	if err := os.WriteFile(kept, []byte("%PDF"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	failed, err := f.Create("report.pdf")
+	if err != nil {
+		t.Fatalf("Create() again error = %v", err)
+	}
+	if filepath.Dir(failed) == filepath.Dir(kept) {
+		t.Error("Create() twice gave the same directory")
+	}
+
+	f.Remove(failed)
+	if _, err := os.Stat(filepath.Dir(failed)); !os.IsNotExist(err) {
+		t.Errorf("Remove() left %s", filepath.Dir(failed))
+	}
+
+	f.Opened(kept)
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("Opened() removed the file at once: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Dir(kept)); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Opened() file wasn't removed after its lifetime")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	open, err := f.Create("notes.txt")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	f.Close()
+	if _, err := os.Stat(filepath.Dir(open)); !os.IsNotExist(err) {
+		t.Errorf("Close() left %s", filepath.Dir(open))
+	}
+}
+
+func TestFilesClean(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, filePrefix+"stale")
+	recent := filepath.Join(dir, filePrefix+"recent")
+	other := filepath.Join(dir, "other")
+	for _, d := range []string{stale, recent, other} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * fileLifetime)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(other, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	NewFiles(dir).Clean()
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Clean() left a stale directory")
+	}
+	for _, d := range []string{recent, other} {
+		if _, err := os.Stat(d); err != nil {
+			t.Errorf("Clean() removed %s", d)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	t.Setenv("BANKSHOT_TEST_NO_BROWSER", "1")
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	o := New(&config.OpenerConfig{MaxOpensPerMinute: 1}, logger)
+	if err := o.OpenURL("https://example.com/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.CheckURL("vscode://file/tmp/x"); err == nil {
+		t.Fatal("CheckURL() = nil for a scheme not yet allowed")
+	}
+
+	o.Configure(&config.OpenerConfig{MaxOpensPerMinute: 1, AllowedSchemes: []string{"vscode"}})
+	if err := o.CheckURL("vscode://file/tmp/x"); err != nil {
+		t.Errorf("CheckURL() = %v once the scheme is allowed", err)
+	}
+	if err := o.OpenURL("https://example.org/"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("OpenURL() after reconfiguring = %v, want ErrRateLimited from the open before", err)
+	}
+}
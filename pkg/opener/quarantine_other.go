@@ -0,0 +1,8 @@
+//go:build !darwin
+
+package opener
+
+// quarantine does nothing where the system has no mark for downloaded files
+func quarantine(path string) error {
+	return nil
+}
@@ -0,0 +1,82 @@
+package opener
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var (
+	// ErrDuplicate is returned for a URL opened the same way moments ago, as
+	// by a tool that runs $BROWSER more than once. The URL is already open,
+	// so it's not a failure.
+	ErrDuplicate = errors.New("URL was just opened")
+
+	// ErrRateLimited is returned once opener.max_opens_per_minute URLs have
+	// been opened in the last minute
+	ErrRateLimited = errors.New("too many URLs opened in the last minute")
+)
+
+// throttle holds back URLs and files opened twice in quick succession, and
+// any over the per-minute cap
+type throttle struct {
+	window    time.Duration // How long a URL counts as just opened; zero disables
+	perMinute int           // Opens allowed in a rolling minute; zero is unlimited
+	now       func() time.Time
+
+	recent map[openKey]time.Time // When each URL opened within window was opened
+	opens  []time.Time           // When each URL in the last minute was opened
+}
+
+// openKey tells opens apart for duplicate suppression: the same URL in
+// another profile or a private window is a different open
+type openKey struct {
+	url  string // The URL, or the path of a file
+	opts LaunchOptions
+}
+
+func newThrottle(window time.Duration, perMinute int) *throttle {
+	return &throttle{
+		window:    window,
+		perMinute: perMinute,
+		now:       time.Now,
+		recent:    make(map[openKey]time.Time),
+	}
+}
+
+// record counts key as opened now
+func (t *throttle) record(key openKey) {
+	now := t.now()
+	if t.window > 0 {
+		t.recent[key] = now
+	}
+	if t.perMinute > 0 {
+		t.opens = append(t.opens, now)
+	}
+}
+
+// check returns ErrDuplicate or ErrRateLimited if key shouldn't be opened
+// now. Opens count once recorded, after they've launched, so one that
+// failed can be retried right away.
+func (t *throttle) check(key openKey) error {
+	now := t.now()
+
+	for k, at := range t.recent {
+		if now.Sub(at) >= t.window {
+			delete(t.recent, k)
+		}
+	}
+	if _, ok := t.recent[key]; ok {
+		return ErrDuplicate
+	}
+
+	cutoff := now.Add(-time.Minute)
+	t.opens = slices.DeleteFunc(t.opens, func(at time.Time) bool {
+		return !at.After(cutoff)
+	})
+	if t.perMinute > 0 && len(t.opens) >= t.perMinute {
+		return fmt.Errorf("%w (opener.max_opens_per_minute is %d)", ErrRateLimited, t.perMinute)
+	}
+	return nil
+}
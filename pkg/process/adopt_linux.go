@@ -0,0 +1,107 @@
+package process
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// reapInterval is how often the descendants left behind are checked for
+// having exited, once the process has
+const reapInterval = 100 * time.Millisecond
+
+// adoptOrphans makes bankshot the subreaper of the processes it starts, so
+// descendants whose parent exits (a package manager that launched the real
+// server, say) are reparented to bankshot instead of init and stay part of
+// the tree
+func adoptOrphans() {
+	_ = unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+}
+
+// orphans are the descendants a process left behind, which bankshot adopted
+type orphans struct {
+	child   int // The process itself, which isn't one of them
+	session int // Its session; a descendant that started one of its own daemonized
+}
+
+// newOrphans returns the descendants the process child leaves behind
+func newOrphans(child int) *orphans {
+	session, err := unix.Getsid(child)
+	if err != nil {
+		session = -1
+	}
+	return &orphans{child: child, session: session}
+}
+
+// pids returns the PIDs of bankshot's children other than the process,
+// which once it has exited are the descendants it left behind. Those in
+// another session daemonized and are left to themselves.
+func (o *orphans) pids() []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	self := strconv.Itoa(os.Getpid())
+	session := strconv.Itoa(o.session)
+
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == o.child {
+			continue
+		}
+		data, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// The parent PID and session are the second and fourth fields after
+		// the command name, which is in parentheses and may itself contain
+		// spaces or parentheses
+		i := strings.LastIndexByte(string(data), ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(data[i+1:]))
+		if len(fields) > 3 && fields[1] == self && fields[3] == session {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// signal sends sig to the descendants left behind
+func (o *orphans) signal(sig os.Signal) {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return
+	}
+	for _, pid := range o.pids() {
+		_ = unix.Kill(pid, s)
+	}
+}
+
+// reap waits for the descendants left behind to exit, reaping each one.
+// It only waits on them by PID, without blocking, so it neither takes the
+// exit of another of bankshot's children nor hangs on one that isn't
+// reparented until later.
+func (o *orphans) reap() {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+	for {
+		running := 0
+		for _, pid := range o.pids() {
+			var status unix.WaitStatus
+			if reaped, err := unix.Wait4(pid, &status, unix.WNOHANG, nil); reaped == 0 && err == nil {
+				running++
+			}
+		}
+		if running == 0 {
+			return
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,131 @@
+package process
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startScript starts script in sh under a Manager, with $DIR a directory
+// for it to leave files in, and env
+func startScript(t *testing.T, script string, env map[string]string) (*Manager, string) {
+	t.Helper()
+	dir := t.TempDir()
+	env["DIR"] = dir
+	m := New("sh", []string{"-c", script}, env)
+	m.cmd.Stdin, m.cmd.Stdout = nil, nil
+	if err := m.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = m.Stop(ctx)
+	})
+	return m, dir
+}
+
+// waitForFile returns the contents of the file at path once it has any
+func waitForFile(t *testing.T, path string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			return strings.TrimSpace(string(data))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s wasn't written", path)
+	return ""
+}
+
+// waitResult runs Wait, failing the test if it takes longer than timeout
+func waitResult(t *testing.T, m *Manager, timeout time.Duration) int {
+	t.Helper()
+	done := make(chan int, 1)
+	go func() {
+		code, _ := m.Wait()
+		done <- code
+	}()
+	select {
+	case code := <-done:
+		return code
+	case <-time.After(timeout):
+		t.Fatalf("Wait() still blocked after %v", timeout)
+		return 0
+	}
+}
+
+func TestWaitForLeftBehind(t *testing.T) {
+	m, _ := startScript(t, `sleep 0.5 & exit 3`, map[string]string{})
+
+	start := time.Now()
+	if code := waitResult(t, m, 5*time.Second); code != 3 {
+		t.Errorf("Wait() = %d, want the process's exit code 3", code)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Wait() returned after %v, before the sleep it left behind exited", elapsed)
+	}
+	if pids := m.orphans.pids(); len(pids) != 0 {
+		t.Errorf("pids() = %v after Wait, want none", pids)
+	}
+}
+
+func TestWaitSkipsDaemons(t *testing.T) {
+	m, dir := startScript(t, `setsid sleep 30 & echo $! > "$DIR/daemon"`, map[string]string{})
+	pidFile := filepath.Join(dir, "daemon")
+
+	waitResult(t, m, 5*time.Second)
+	pid, err := strconv.Atoi(waitForFile(t, pidFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+	}()
+	if err := syscall.Kill(pid, 0); err != nil {
+		t.Errorf("daemonized sleep isn't running: %v", err)
+	}
+}
+
+func TestSignalReachesEachProcessOnce(t *testing.T) {
+	// The process counts the signals it gets, and has a shell in between
+	// leave behind a descendant that does the same
+	counter := `trap 'echo >> "$DIR/$1"' USR1; trap 'exit 0' TERM; echo > "$DIR/$1.ready"; while :; do sleep 0.05; done`
+	m, dir := startScript(t, `sh -c 'sh -c "$COUNTER" sh orphan &'; exec sh -c "$COUNTER" sh child`,
+		map[string]string{"COUNTER": counter})
+	waitForFile(t, filepath.Join(dir, "child.ready"))
+	waitForFile(t, filepath.Join(dir, "orphan.ready"))
+
+	if pids := m.orphans.pids(); len(pids) != 1 {
+		t.Fatalf("pids() = %v, want the orphan alone", pids)
+	}
+	if err := m.Signal(syscall.SIGUSR1); err != nil {
+		t.Fatalf("Signal() error = %v", err)
+	}
+	for _, name := range []string{"child", "orphan"} {
+		waitForFile(t, filepath.Join(dir, name))
+	}
+	// Give a second signal time to arrive, were one sent
+	time.Sleep(200 * time.Millisecond)
+	for _, name := range []string{"child", "orphan"} {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		if n := strings.Count(string(data), "\n"); n != 1 {
+			t.Errorf("%s got %d signals, want 1", name, n)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Stop(ctx); err != nil {
+		t.Errorf("Stop() error = %v", err)
+	}
+	if pids := m.orphans.pids(); len(pids) != 0 {
+		t.Errorf("pids() = %v after Stop, want the orphan reaped", pids)
+	}
+}
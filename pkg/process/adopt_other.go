@@ -0,0 +1,23 @@
+//go:build !linux
+
+package process
+
+import "os"
+
+// adoptOrphans does nothing: only Linux lets a process adopt its orphaned
+// descendants, so elsewhere they leave the tree when their parent exits
+func adoptOrphans() {}
+
+// orphans are the descendants a process left behind, of which there are
+// none
+type orphans struct{}
+
+func newOrphans(int) *orphans {
+	return &orphans{}
+}
+
+// signal does nothing, as there are no descendants left behind
+func (*orphans) signal(os.Signal) {}
+
+// reap does nothing, as there are no descendants left behind
+func (*orphans) reap() {}
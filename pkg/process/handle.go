@@ -0,0 +1,35 @@
+package process
+
+// Handle identifies a running process by its PID and when it started, so a
+// process that later reuses the PID isn't mistaken for it
+type Handle struct {
+	PID   int
+	Start uint64 // Start time in the platform's own units (0 = unknown)
+}
+
+// Find returns a handle on the process running with the given PID, and false
+// if there is none
+func Find(pid int) (Handle, bool) {
+	if pid <= 0 || !alive(pid) {
+		return Handle{}, false
+	}
+	start, err := startTime(pid)
+	if err != nil {
+		// It exited in between, or the platform can't tell
+		return Handle{PID: pid}, alive(pid)
+	}
+	return Handle{PID: pid, Start: start}, true
+}
+
+// Running reports whether the process is still running. Without a start
+// time that's whether any process has its PID.
+func (h Handle) Running() bool {
+	if h.PID <= 0 || !alive(h.PID) {
+		return false
+	}
+	if h.Start == 0 {
+		return true
+	}
+	start, err := startTime(h.PID)
+	return err == nil && start == h.Start
+}
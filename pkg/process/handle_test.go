@@ -0,0 +1,35 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestHandleRunning(t *testing.T) {
+	self, ok := Find(os.Getpid())
+	if !ok {
+		t.Fatal("Find(own PID) found no process")
+	}
+	if !self.Running() {
+		t.Error("Running() = false for this process")
+	}
+	if self.Start != 0 {
+		earlier := Handle{PID: self.PID, Start: self.Start + 1}
+		if earlier.Running() {
+			t.Error("Running() = true for a handle on another process that had the same PID")
+		}
+	}
+	if (Handle{}).Running() {
+		t.Error("Running() = true for the zero Handle")
+	}
+
+	// The test binary, running no tests, exits straight away
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("failed to run child: %v", err)
+	}
+	if _, ok := Find(cmd.Process.Pid); ok {
+		t.Errorf("Find(%d) found the exited child", cmd.Process.Pid)
+	}
+}
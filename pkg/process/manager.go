@@ -2,16 +2,31 @@ package process
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 )
 
+// closeTimeout is how long Close waits for the process to exit before
+// killing it
+const closeTimeout = 5 * time.Second
+
 // Manager handles the lifecycle of the child process
 type Manager struct {
 	cmd  *exec.Cmd
 	done chan struct{}
+
+	waitOnce sync.Once
+	exitCode int
+	waitErr  error
+
+	tty      bool
+	terminal *terminal // Set while the process runs on a pseudo-terminal
+	orphans  *orphans  // What the process leaves behind; set once it's started
 }
 
 // New creates a new process manager
@@ -35,22 +50,59 @@ func New(command string, args []string, extraEnv map[string]string) *Manager {
 	}
 }
 
-// Start begins execution of the child process
+// WithTTY runs the process on a pseudo-terminal relayed to bankshot's own
+// stdio, sized like bankshot's terminal and resized with it, so programs
+// that check for a terminal keep their colors and interactive prompts
+func (m *Manager) WithTTY() *Manager {
+	m.tty = true
+	return m
+}
+
+// Start begins execution of the child process. On Linux, descendants the
+// process leaves behind when it exits are adopted and remain part of its
+// tree until they exit too, unless they daemonized into a session of their
+// own.
 func (m *Manager) Start() error {
-	if err := m.cmd.Start(); err != nil {
+	adoptOrphans()
+
+	if m.tty {
+		t, err := startTerminal(m.cmd)
+		if err != nil {
+			return err
+		}
+		m.terminal = t
+	} else if err := m.cmd.Start(); err != nil {
 		return err
 	}
+	m.orphans = newOrphans(m.cmd.Process.Pid)
 
-	// Set up signal forwarding
-	go m.forwardSignals()
+	// Set up signal forwarding, where the platform has signals to forward
+	if len(forwardedSignals) > 0 {
+		go m.forwardSignals()
+	}
 
 	return nil
 }
 
-// Wait blocks until the process exits and returns its exit code
+// Wait blocks until the process and any descendants it left behind, other
+// than daemons, have exited, and returns the process's exit code. It may be called more than
+// once.
 func (m *Manager) Wait() (int, error) {
+	m.waitOnce.Do(func() {
+		m.exitCode, m.waitErr = m.wait()
+		close(m.done)
+	})
+	return m.exitCode, m.waitErr
+}
+
+func (m *Manager) wait() (int, error) {
 	err := m.cmd.Wait()
-	close(m.done)
+	if m.orphans != nil {
+		m.orphans.reap()
+	}
+	if m.terminal != nil {
+		m.terminal.close()
+	}
 
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -75,20 +127,12 @@ func (m *Manager) PID() int {
 // forwardSignals forwards common signals to the child process
 func (m *Manager) forwardSignals() {
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan,
-		syscall.SIGTERM,
-		syscall.SIGINT,
-		syscall.SIGHUP,
-		syscall.SIGUSR1,
-		syscall.SIGUSR2,
-	)
+	signal.Notify(sigChan, forwardedSignals...)
 
 	for {
 		select {
 		case sig := <-sigChan:
-			if m.cmd.Process != nil {
-				_ = m.cmd.Process.Signal(sig)
-			}
+			_ = m.Signal(sig)
 		case <-m.done:
 			signal.Stop(sigChan)
 			return
@@ -96,12 +140,38 @@ func (m *Manager) forwardSignals() {
 	}
 }
 
-// Signal sends a signal to the process
+// Signal sends a signal to the process and any descendants it left behind.
+// It's not an error for the process itself to have exited.
 func (m *Manager) Signal(sig os.Signal) error {
 	if m.cmd.Process == nil {
 		return nil
 	}
-	return m.cmd.Process.Signal(sig)
+	m.orphans.signal(sig)
+	if err := m.cmd.Process.Signal(sig); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
+
+// Close stops the process if it's still running and gives bankshot's
+// terminal back, for a caller that gives up on the process before it exits.
+// It does nothing once Wait has returned.
+func (m *Manager) Close() {
+	if m.cmd.Process == nil {
+		return
+	}
+	select {
+	case <-m.done:
+		return
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	_ = m.Stop(ctx)
+	if m.terminal != nil {
+		m.terminal.close()
+	}
 }
 
 // Stop attempts to gracefully stop the process
@@ -110,8 +180,9 @@ func (m *Manager) Stop(ctx context.Context) error {
 		return nil
 	}
 
-	// Send SIGTERM first
-	if err := m.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+	// Ask nicely first
+	m.orphans.signal(syscall.SIGTERM)
+	if err := terminate(m.cmd.Process); err != nil && !errors.Is(err, os.ErrProcessDone) {
 		return err
 	}
 
@@ -125,7 +196,11 @@ func (m *Manager) Stop(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
 		// Force kill if context times out
-		return m.cmd.Process.Kill()
+		m.orphans.signal(syscall.SIGKILL)
+		if err := m.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return err
+		}
+		return nil
 	case err := <-done:
 		return err
 	}
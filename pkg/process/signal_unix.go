@@ -0,0 +1,31 @@
+//go:build !windows
+
+package process
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are relayed from bankshot to the child process
+var forwardedSignals = []os.Signal{
+	syscall.SIGTERM,
+	syscall.SIGINT,
+	syscall.SIGHUP,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// terminate asks a process to exit with SIGTERM
+func terminate(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
+
+// alive reports whether any process has the given PID, which may since have
+// been reused; Handle tells processes apart
+func alive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// EPERM means the process exists but belongs to someone else
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,41 @@
+package process
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// forwardedSignals is empty: a child attached to the same console gets
+// Ctrl+C and Ctrl+Break itself, and Windows has no other signals to relay
+var forwardedSignals []os.Signal
+
+// terminate ends a process. Windows can't deliver SIGTERM, so there's no
+// gentler option than killing it.
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
+
+// stillActive is the exit code GetExitCodeProcess reports for a process
+// that hasn't exited (STILL_ACTIVE)
+const stillActive = 259
+
+// alive reports whether any process has the given PID, which may since have
+// been reused; Handle tells processes apart
+func alive(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// Access denied means the process exists but belongs to someone else
+		return errors.Is(err, windows.ERROR_ACCESS_DENIED)
+	}
+	defer func() {
+		_ = windows.CloseHandle(h)
+	}()
+
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
@@ -0,0 +1,14 @@
+package process
+
+import "golang.org/x/sys/unix"
+
+// startTime returns when the process started, in microseconds since the
+// epoch
+func startTime(pid int) (uint64, error) {
+	info, err := unix.SysctlKinfoProc("kern.proc.pid", pid)
+	if err != nil {
+		return 0, err
+	}
+	start := info.Proc.P_starttime
+	return uint64(start.Sec)*1e6 + uint64(start.Usec), nil
+}
@@ -0,0 +1,27 @@
+package process
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// startTime returns when the process started, in clock ticks since boot
+func startTime(pid int) (uint64, error) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, err
+	}
+	// The start time is the 20th field after the command name, which is in
+	// parentheses and may itself contain spaces or parentheses
+	i := strings.LastIndexByte(string(data), ')')
+	if i < 0 {
+		return 0, errors.New("malformed process stat")
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 20 {
+		return 0, errors.New("malformed process stat")
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !windows
+
+package process
+
+// startTime isn't known here, so handles fall back to the PID alone
+func startTime(int) (uint64, error) {
+	return 0, nil
+}
@@ -0,0 +1,21 @@
+package process
+
+import "golang.org/x/sys/windows"
+
+// startTime returns when the process was created, in 100ns intervals since
+// 1601
+func startTime(pid int) (uint64, error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = windows.CloseHandle(h)
+	}()
+
+	var created, exited, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(h, &created, &exited, &kernel, &user); err != nil {
+		return 0, err
+	}
+	return uint64(created.HighDateTime)<<32 | uint64(created.LowDateTime), nil
+}
@@ -0,0 +1,150 @@
+//go:build !windows
+
+package process
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// outputDrainTimeout bounds how long close waits for the last of the
+// process's output, which descendants still holding the terminal can delay
+// forever
+const outputDrainTimeout = time.Second
+
+// inputPollInterval is how often the input relay checks whether to stop
+// while nothing is typed
+const inputPollInterval = 100 * time.Millisecond
+
+// terminal is the pseudo-terminal a process runs on, and the state of
+// bankshot's own terminal to restore once it's done
+type terminal struct {
+	ptmx      *os.File
+	restore   *term.State // nil when stdin isn't a terminal
+	output    chan struct{}
+	input     chan struct{} // Closed once the input relay has stopped
+	stop      chan struct{} // Closed to stop relaying input and resizes
+	closeOnce sync.Once
+}
+
+// startTerminal starts cmd on a new pseudo-terminal and relays it to
+// bankshot's stdio, putting bankshot's terminal in raw mode so keys such as
+// Ctrl+C reach the process as typed
+func startTerminal(cmd *exec.Cmd) (*terminal, error) {
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, nil, nil
+
+	var size *pty.Winsize
+	if s, err := pty.GetsizeFull(os.Stdin); err == nil {
+		size = s
+	}
+	ptmx, err := pty.StartWithSize(cmd, size)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &terminal{
+		ptmx:   ptmx,
+		output: make(chan struct{}),
+		input:  make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		if state, err := term.MakeRaw(int(os.Stdin.Fd())); err == nil {
+			t.restore = state
+		}
+	}
+
+	go t.forwardSize()
+	go t.forwardInput()
+	go func() {
+		_, _ = io.Copy(os.Stdout, ptmx)
+		close(t.output)
+	}()
+
+	return t, nil
+}
+
+// forwardSize resizes the pseudo-terminal along with bankshot's terminal
+func (t *terminal) forwardSize() {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+
+	for {
+		select {
+		case <-winch:
+			_ = pty.InheritSize(os.Stdin, t.ptmx)
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// forwardInput relays bankshot's stdin to the pseudo-terminal until stopped.
+// It reads only once select says input is waiting, so no read is left
+// pending on stdin to swallow what's typed after the process is done.
+func (t *terminal) forwardInput() {
+	defer close(t.input)
+
+	fd := int(os.Stdin.Fd())
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+
+		var readable unix.FdSet
+		readable.Set(fd)
+		timeout := unix.NsecToTimeval(inputPollInterval.Nanoseconds())
+		n, err := unix.Select(fd+1, &readable, nil, nil, &timeout)
+		if errors.Is(err, unix.EINTR) || (err == nil && n == 0) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		n, err = unix.Read(fd, buf)
+		if n > 0 {
+			if _, err := t.ptmx.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+		if errors.Is(err, unix.EINTR) || errors.Is(err, unix.EAGAIN) {
+			continue
+		}
+		if err != nil || n == 0 {
+			return
+		}
+	}
+}
+
+// close waits for the process's remaining output, then stops relaying
+// input, releases the pseudo-terminal and restores bankshot's terminal. It
+// may be called more than once.
+func (t *terminal) close() {
+	t.closeOnce.Do(func() {
+		select {
+		case <-t.output:
+		case <-time.After(outputDrainTimeout):
+		}
+		close(t.stop)
+		<-t.input
+		_ = t.ptmx.Close()
+		if t.restore != nil {
+			_ = term.Restore(int(os.Stdin.Fd()), t.restore)
+		}
+	})
+}
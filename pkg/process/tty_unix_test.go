@@ -0,0 +1,51 @@
+//go:build !windows
+
+package process
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCloseStopsTerminal(t *testing.T) {
+	// Input that never comes, as from a user who's stopped typing
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = r.Close()
+		_ = w.Close()
+	}()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+	}()
+
+	m := New("sleep", []string{"60"}, nil).WithTTY()
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close() didn't return")
+	}
+
+	select {
+	case <-m.terminal.input:
+	default:
+		t.Error("input relay still running after Close()")
+	}
+	if _, ok := Find(m.PID()); ok {
+		t.Errorf("process %d still running after Close()", m.PID())
+	}
+}
@@ -0,0 +1,16 @@
+package process
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// terminal is unused on Windows, which has no pseudo-terminals to run on
+type terminal struct{}
+
+// startTerminal fails: Windows consoles aren't pseudo-terminals
+func startTerminal(*exec.Cmd) (*terminal, error) {
+	return nil, errors.New("running on a pseudo-terminal is not supported on Windows")
+}
+
+func (t *terminal) close() {}
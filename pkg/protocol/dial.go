@@ -0,0 +1,200 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProxyCommandPrefix marks a daemon address that is really a command to
+// run, as from --socket "exec:ssh laptop bankshot proxy" or proxy_command
+const ProxyCommandPrefix = "exec:"
+
+// DaemonAddress returns the address to reach the daemon at: the command
+// after ProxyCommandPrefix when proxyCommand is set, and address otherwise
+func DaemonAddress(address, proxyCommand string) string {
+	if proxyCommand != "" {
+		return ProxyCommandPrefix + proxyCommand
+	}
+	return address
+}
+
+// Dial connects to the daemon at address, a TCP address if it has a colon,
+// a Unix socket otherwise, or runs the command after ProxyCommandPrefix to
+// reach it. A timeout of zero waits as long as connecting takes.
+func Dial(address string, timeout time.Duration) (net.Conn, error) {
+	if command, ok := strings.CutPrefix(address, ProxyCommandPrefix); ok {
+		return dialCommand(command)
+	}
+	network := "unix"
+	if strings.Contains(address, ":") {
+		network = "tcp"
+	}
+	return net.DialTimeout(network, address, timeout)
+}
+
+// dialCommand runs command through the platform's shell and returns a
+// connection over its stdin and stdout. Its stderr is passed through, so
+// ssh can still ask for a password.
+func dialCommand(command string) (net.Conn, error) {
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run %q: %w", command, err)
+	}
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+// commandConn is a net.Conn over a command's stdin and stdout. Deadlines
+// are the pipes' own where the platform has them; elsewhere one passing
+// kills the command, which ends the connection.
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+
+	waitOnce sync.Once
+	waitErr  error
+
+	timersMu   sync.Mutex
+	readTimer  *time.Timer
+	writeTimer *time.Timer
+	timedOut   atomic.Bool
+}
+
+// commandConnCloseTimeout is how long Close waits for the command to exit
+const commandConnCloseTimeout = 2 * time.Second
+
+// wait waits for the command to exit, once, returning why it failed
+func (c *commandConn) wait() error {
+	c.waitOnce.Do(func() {
+		c.waitErr = c.cmd.Wait()
+	})
+	return c.waitErr
+}
+
+// Read reads what the daemon sends. The end of it from a command that
+// failed, as when ssh couldn't connect, is reported as that failure.
+func (c *commandConn) Read(b []byte) (int, error) {
+	n, err := c.stdout.Read(b)
+	if err != nil && c.timedOut.Load() {
+		return n, os.ErrDeadlineExceeded
+	}
+	if err == io.EOF {
+		if waitErr := c.wait(); waitErr != nil {
+			return n, fmt.Errorf("%s: %w", c.cmd.Args[len(c.cmd.Args)-1], waitErr)
+		}
+	}
+	return n, err
+}
+
+func (c *commandConn) Write(b []byte) (int, error) {
+	n, err := c.stdin.Write(b)
+	if err != nil && c.timedOut.Load() {
+		return n, os.ErrDeadlineExceeded
+	}
+	return n, err
+}
+
+// CloseWrite closes the command's stdin, telling it the request is done
+func (c *commandConn) CloseWrite() error { return c.stdin.Close() }
+
+// Close closes stdin and waits for the command, which exits once the daemon
+// has closed its end; one that doesn't is killed
+func (c *commandConn) Close() error {
+	c.timersMu.Lock()
+	stopTimer(&c.readTimer)
+	stopTimer(&c.writeTimer)
+	c.timersMu.Unlock()
+
+	_ = c.stdin.Close()
+	done := make(chan struct{})
+	go func() {
+		_ = c.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(commandConnCloseTimeout):
+		_ = c.cmd.Process.Kill()
+		<-done
+	}
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return commandAddr(c.cmd.String()) }
+func (c *commandConn) RemoteAddr() net.Addr { return commandAddr(c.cmd.String()) }
+
+func (c *commandConn) SetDeadline(t time.Time) error {
+	_ = c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error {
+	if f, ok := c.stdout.(*os.File); ok && f.SetReadDeadline(t) == nil {
+		return nil
+	}
+	c.timersMu.Lock()
+	defer c.timersMu.Unlock()
+	c.setTimer(&c.readTimer, t)
+	return nil
+}
+
+func (c *commandConn) SetWriteDeadline(t time.Time) error {
+	if f, ok := c.stdin.(*os.File); ok && f.SetWriteDeadline(t) == nil {
+		return nil
+	}
+	c.timersMu.Lock()
+	defer c.timersMu.Unlock()
+	c.setTimer(&c.writeTimer, t)
+	return nil
+}
+
+// setTimer replaces timer with one ending the connection at t, or none for
+// a zero t, for pipes without deadlines of their own. The caller holds
+// timersMu.
+func (c *commandConn) setTimer(timer **time.Timer, t time.Time) {
+	stopTimer(timer)
+	if t.IsZero() {
+		return
+	}
+	*timer = time.AfterFunc(time.Until(t), func() {
+		c.timedOut.Store(true)
+		_ = c.cmd.Process.Kill()
+		// What the command started may still hold the pipes open
+		_ = c.stdout.Close()
+		_ = c.stdin.Close()
+	})
+}
+
+func stopTimer(timer **time.Timer) {
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+}
+
+// commandAddr names a command connection's ends
+type commandAddr string
+
+func (a commandAddr) Network() string { return "exec" }
+func (a commandAddr) String() string  { return string(a) }
@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestDialCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+
+	conn, err := Dial(ProxyCommandPrefix+"cat", 0)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping\n" {
+		t.Errorf("Read() = %q, %v, want the echo", buf, err)
+	}
+	_ = conn.Close()
+}
+
+func TestDialCommandDeadline(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+
+	conn, err := Dial(ProxyCommandPrefix+"exec sleep 30", 0)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read() error = %v, want os.ErrDeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Read() returned after %v, long past the deadline", elapsed)
+	}
+}
@@ -3,6 +3,11 @@ package protocol
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 // CommandType represents the type of command
@@ -23,6 +28,34 @@ const (
 	CommandReconcile CommandType = "reconcile"
 	// CommandOpProxy proxies 1Password CLI requests to the local machine
 	CommandOpProxy CommandType = "op-proxy"
+	// CommandHistory lists recent open requests and their sources
+	CommandHistory CommandType = "history"
+	// CommandExport returns the active forwards as a re-appliable set
+	CommandExport CommandType = "export"
+	// CommandImport establishes every forward in a set
+	CommandImport CommandType = "import"
+	// CommandMonitorStatus gets the status of the remote monitor, from its
+	// control socket rather than the daemon's
+	CommandMonitorStatus CommandType = "monitor-status"
+	// CommandOpenFile sends a file for the daemon to open with its default
+	// application. The request is followed by the file's contents as
+	// FileChunk lines.
+	CommandOpenFile CommandType = "open-file"
+	// CommandLogs returns the daemon's recent log records and, when
+	// following, streams new ones as JSON lines after the response
+	CommandLogs CommandType = "logs"
+	// CommandCopy puts text on the local clipboard
+	CommandCopy CommandType = "copy"
+	// CommandPaste returns the text on the local clipboard
+	CommandPaste CommandType = "paste"
+	// CommandForwardBatch requests several port forwards at once
+	CommandForwardBatch CommandType = "forward-batch"
+	// CommandNotify posts a desktop notification on the local machine
+	CommandNotify CommandType = "notify"
+	// CommandConnections lists the SSH control masters on the local machine
+	CommandConnections CommandType = "connections"
+	// CommandReopen opens a URL from the open history again
+	CommandReopen CommandType = "reopen"
 )
 
 // Request represents a command request from client to daemon
@@ -42,34 +75,292 @@ type Response struct {
 
 // OpenRequest represents a request to open a URL
 type OpenRequest struct {
-	URL string `json:"url"`
+	URL            string `json:"url"`
+	ConnectionInfo string `json:"connection_info,omitempty"` // SSH connection identifier of the requester
+	ProcessName    string `json:"process_name,omitempty"`    // Name of the process that asked to open the URL
+	ProcessCwd     string `json:"process_cwd,omitempty"`     // Working directory of the process
+	Hostname       string `json:"hostname,omitempty"`        // The remote host's own name, which URLs for its ports may use
+	Browser        string `json:"browser,omitempty"`         // Browser to open the URL in, by opener.browser name, instead of the configured one
+	Profile        string `json:"profile,omitempty"`         // Browser profile to open the URL in, by opener.profiles name
+	Incognito      bool   `json:"incognito,omitempty"`       // Open the URL in a private window
+}
+
+// OpenFileRequest represents a request to open a file from the remote host
+// on the local machine. The file is sent in chunks after the request, or
+// with Path set, copied by the daemon over the requester's SSH connection.
+type OpenFileRequest struct {
+	Name           string `json:"name"`                      // File name, without its directory
+	Size           int64  `json:"size"`                      // Bytes the chunks that follow add up to, or the file's size
+	Path           string `json:"path,omitempty"`            // Absolute path on the remote host for the daemon to copy; no chunks follow
+	ConnectionInfo string `json:"connection_info,omitempty"` // SSH connection identifier of the requester
+	ProcessName    string `json:"process_name,omitempty"`    // Name of the process that asked to open the file
+	ProcessCwd     string `json:"process_cwd,omitempty"`     // Working directory of the process
+}
+
+// FileChunkSize is how many bytes of a file each FileChunk carries
+const FileChunkSize = 64 * 1024
+
+// FileChunk is one piece of a file sent after an OpenFileRequest. The last
+// chunk has Last set, and may carry no data.
+type FileChunk struct {
+	Data []byte `json:"data,omitempty"` // Base64 in JSON
+	Last bool   `json:"last,omitempty"`
+}
+
+// ClipboardRequest represents a request to put text on the local clipboard
+type ClipboardRequest struct {
+	Text string `json:"text"`
+}
+
+// ClipboardResponse carries the text on the local clipboard
+type ClipboardResponse struct {
+	Text string `json:"text"`
+}
+
+// NotifyRequest represents a request to post a desktop notification
+type NotifyRequest struct {
+	Title          string `json:"title,omitempty"`           // Defaults to the requester's connection
+	Body           string `json:"body"`                      // Message to show
+	URL            string `json:"url,omitempty"`             // Opened when the notification is clicked
+	ConnectionInfo string `json:"connection_info,omitempty"` // SSH connection identifier of the requester
 }
 
 // ForwardRequest represents a request to forward a port
 type ForwardRequest struct {
-	RemotePort     int    `json:"remote_port"`              // Port on remote machine
-	LocalPort      int    `json:"local_port,omitempty"`     // Port on local machine (0 = same as remote)
-	Host           string `json:"host,omitempty"`           // Remote host (default: localhost)
-	ConnectionInfo string `json:"connection_info"`          // SSH connection identifier (hostname, user@host, etc.)
-	SocketPath     string `json:"socket_path,omitempty"`    // Optional: specific socket path
-	ProcessName    string `json:"process_name,omitempty"`   // Name of the process that opened the port
-	ProcessCwd     string `json:"process_cwd,omitempty"`    // Working directory of the process
+	Name           string `json:"name,omitempty"`            // Optional alias for the forward
+	RemotePort     int    `json:"remote_port"`               // Port on remote machine
+	RemotePortEnd  int    `json:"remote_port_end,omitempty"` // Last port of a range starting at RemotePort (0 = single port)
+	LocalPort      int    `json:"local_port,omitempty"`      // Port on local machine (0 = same as remote); first local port of a range
+	Host           string `json:"host,omitempty"`            // Remote host (default: localhost)
+	RemoteSocket   string `json:"remote_socket,omitempty"`   // Remote Unix socket path to forward instead of a port (requires LocalPort or LocalSocket)
+	LocalSocket    string `json:"local_socket,omitempty"`    // Local Unix socket path to listen on instead of a port
+	BindAddress    string `json:"bind_address,omitempty"`    // Local address to listen on (default: loopback; others need allow_lan_bind)
+	ConnectionInfo string `json:"connection_info"`           // SSH connection identifier (hostname, user@host, etc.)
+	SocketPath     string `json:"socket_path,omitempty"`     // Optional: specific control socket; pins the forward to that master
+	ProcessName    string `json:"process_name,omitempty"`    // Name of the process that opened the port
+	ProcessCwd     string `json:"process_cwd,omitempty"`     // Working directory of the process
+	AppProtocol    string `json:"app_protocol,omitempty"`    // What the remote port speaks (http, https, h2c), if detected
+	Server         string `json:"server,omitempty"`          // What the remote HTTP server calls itself (e.g. "Next.js"), if detected
+	Owner          string `json:"owner,omitempty"`           // Who asked for the forward: OwnerCLI, OwnerMonitor, OwnerOpen, WrapOwner(pid), or ProfileOwner(connectionInfo, dir, profile)
+	Conflict       string `json:"conflict,omitempty"`        // Policy when the local port is busy: fail, next, random, or steal ("" = daemon default)
+	DryRun         bool   `json:"dry_run,omitempty"`         // Report the ssh commands that would run instead of running them
+}
+
+// ConflictPolicies are the policies for a local port that's already in use,
+// as ForwardRequest.Conflict and forwarder.port_conflict take them
+var ConflictPolicies = []string{"fail", "next", "random", "steal"}
+
+// ValidConflictPolicy reports whether policy is one of ConflictPolicies, or
+// "" for the daemon's default
+func ValidConflictPolicy(policy string) bool {
+	return policy == "" || slices.Contains(ConflictPolicies, policy)
+}
+
+// ConflictPolicyNames lists ConflictPolicies for messages: "fail, next,
+// random, or steal"
+func ConflictPolicyNames() string {
+	last := len(ConflictPolicies) - 1
+	return strings.Join(ConflictPolicies[:last], ", ") + ", or " + ConflictPolicies[last]
+}
+
+// ConflictDecision reports how a forward request's busy local port was
+// handled
+type ConflictDecision struct {
+	Policy        string `json:"policy"`           // Policy that applied: next, random, or steal
+	RequestedPort int    `json:"requested_port"`   // Local port that was asked for
+	LocalPort     int    `json:"local_port"`       // Local port the forward got
+	Stolen        string `json:"stolen,omitempty"` // Forward cancelled to free the port ("connection:remote"), for steal
+}
+
+// ForwardResponse represents the result of a forward request
+type ForwardResponse struct {
+	Message     string `json:"message"`
+	SocketPath  string `json:"socket_path,omitempty"`
+	LocalPort   int    `json:"local_port"`             // Actual local port (may differ from the requested one)
+	LocalSocket string `json:"local_socket,omitempty"` // Local Unix socket path, for local socket forwards
+	Queued      bool   `json:"queued,omitempty"`       // SSH rejected the forward; the daemon will retry it
+	Existing    bool   `json:"existing,omitempty"`     // The forward was already there, so nothing new was set up
+	LocalPorts  []int  `json:"local_ports,omitempty"`  // Local port per remote port of a range (0 = queued for retry)
+
+	Conflict *ConflictDecision `json:"conflict,omitempty"` // Set when the requested local port was busy
 }
 
 // UnforwardRequest represents a request to remove a port forward
 type UnforwardRequest struct {
-	RemotePort     int    `json:"remote_port"`     // Port on remote machine
-	Host           string `json:"host,omitempty"`  // Remote host (default: localhost)
-	ConnectionInfo string `json:"connection_info"` // SSH connection identifier
+	Name           string `json:"name,omitempty"`            // Name of the forward to remove; other fields are ignored when set
+	RemotePort     int    `json:"remote_port"`               // Port on remote machine
+	RemotePortEnd  int    `json:"remote_port_end,omitempty"` // Last port of a range forwarded as a group
+	Host           string `json:"host,omitempty"`            // Remote host (default: localhost)
+	RemoteSocket   string `json:"remote_socket,omitempty"`   // Remote Unix socket path, for socket forwards
+	ConnectionInfo string `json:"connection_info"`           // SSH connection identifier
+	SocketPath     string `json:"socket_path,omitempty"`     // Control socket, when the connection has forwards through several
+	DryRun         bool   `json:"dry_run,omitempty"`         // Report the ssh commands that would run instead of running them
+}
+
+// DryRunResponse lists the ssh commands a forward or unforward request
+// would run, in order
+type DryRunResponse struct {
+	Message  string   `json:"message"`
+	Commands []string `json:"commands"`
 }
 
 // ForwardInfo represents information about an active forward
 type ForwardInfo struct {
-	RemotePort     int    `json:"remote_port"`
-	LocalPort      int    `json:"local_port"`
-	Host           string `json:"host"`
-	ConnectionInfo string `json:"connection_info"`
-	CreatedAt      string `json:"created_at"`
+	Name           string        `json:"name,omitempty"`
+	RemotePort     int           `json:"remote_port"`
+	LocalPort      int           `json:"local_port"`
+	SSHPort        int           `json:"ssh_port,omitempty"` // Port ssh listens on when a relay fronts LocalPort
+	Host           string        `json:"host"`
+	RemoteSocket   string        `json:"remote_socket,omitempty"`
+	LocalSocket    string        `json:"local_socket,omitempty"`
+	Group          string        `json:"group,omitempty"` // Port range this forward belongs to
+	ConnectionInfo string        `json:"connection_info"`
+	SocketPath     string        `json:"socket_path,omitempty"` // Control socket the forward goes through
+	BindAddress    string        `json:"bind_address,omitempty"`
+	Owner          string        `json:"owner,omitempty"`
+	AppProtocol    string        `json:"app_protocol,omitempty"` // What the remote port speaks, if detected
+	Server         string        `json:"server,omitempty"`       // What the remote HTTP server calls itself, if detected
+	CreatedAt      string        `json:"created_at"`
+	Stats          *ForwardStats `json:"stats,omitempty"`   // Set when accounting is enabled
+	Healthy        *bool         `json:"healthy,omitempty"` // Whether the local end accepts connections; set when the list request asks
+}
+
+// localHost is the host a forward bound to bindAddr is reached at locally:
+// the address itself, unless it's ssh's default or a wildcard, which
+// localhost reaches
+func localHost(bindAddr string) string {
+	switch bindAddr {
+	case "", "localhost", "*", "0.0.0.0", "::":
+		return "localhost"
+	}
+	return bindAddr
+}
+
+// IsLoopbackAddress reports whether a bind address only listens on
+// loopback: localhost or a loopback IP, bracketed or not
+func IsLoopbackAddress(addr string) bool {
+	if addr == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(NormalizeHost(addr))
+	return ip != nil && ip.IsLoopback()
+}
+
+// LocalURL is the URL a forward's local end is opened at, by the protocol
+// detected on it ("" = assume HTTP)
+func (fw ForwardInfo) LocalURL() string {
+	scheme := "http"
+	if fw.AppProtocol == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(localHost(fw.BindAddress), strconv.Itoa(fw.LocalPort))
+}
+
+// LocalTarget describes where a forward is reached locally, as a URL when
+// the remote port was detected speaking HTTP, followed by what its server
+// calls itself, e.g. "http://localhost:3000 (Next.js)"
+func (fw ForwardInfo) LocalTarget() string {
+	if fw.LocalSocket != "" {
+		return fw.LocalSocket
+	}
+	target := net.JoinHostPort(localHost(fw.BindAddress), strconv.Itoa(fw.LocalPort))
+	switch fw.AppProtocol {
+	case "http", "https":
+		target = fw.LocalURL()
+	case "h2c":
+		target += " (HTTP/2)"
+	}
+	if fw.Server != "" {
+		target += " (" + fw.Server + ")"
+	}
+	return target
+}
+
+// ForwardSpec describes a forward to establish, without any of its runtime
+// state, so it can be saved and applied again later
+type ForwardSpec struct {
+	Name           string `json:"name,omitempty" yaml:"name,omitempty"`
+	RemotePort     int    `json:"remote_port,omitempty" yaml:"remote_port,omitempty"`
+	RemotePortEnd  int    `json:"remote_port_end,omitempty" yaml:"remote_port_end,omitempty"`
+	LocalPort      int    `json:"local_port,omitempty" yaml:"local_port,omitempty"`
+	Host           string `json:"host,omitempty" yaml:"host,omitempty"`
+	RemoteSocket   string `json:"remote_socket,omitempty" yaml:"remote_socket,omitempty"`
+	LocalSocket    string `json:"local_socket,omitempty" yaml:"local_socket,omitempty"`
+	BindAddress    string `json:"bind_address,omitempty" yaml:"bind_address,omitempty"`
+	ConnectionInfo string `json:"connection_info" yaml:"connection_info"`
+	SocketPath     string `json:"socket_path,omitempty" yaml:"socket_path,omitempty"` // Only for forwards pinned to a control socket
+}
+
+// ForwardRequest returns the request that establishes the forward
+func (s ForwardSpec) ForwardRequest() ForwardRequest {
+	return ForwardRequest{
+		Name:           s.Name,
+		RemotePort:     s.RemotePort,
+		RemotePortEnd:  s.RemotePortEnd,
+		LocalPort:      s.LocalPort,
+		Host:           s.Host,
+		RemoteSocket:   s.RemoteSocket,
+		LocalSocket:    s.LocalSocket,
+		BindAddress:    s.BindAddress,
+		ConnectionInfo: s.ConnectionInfo,
+		SocketPath:     s.SocketPath,
+	}
+}
+
+// ForwardSet is a saved set of forwards. It is the response to an export
+// request, the payload of an import request, and the format of the files
+// `bankshot export` writes.
+type ForwardSet struct {
+	Forwards []ForwardSpec `json:"forwards" yaml:"forwards"`
+}
+
+// ExportRequest represents a request to export the active forwards
+type ExportRequest struct {
+	ConnectionInfo string `json:"connection_info,omitempty"` // Only export forwards of this connection
+}
+
+// ImportRequest represents a request to establish a set of forwards
+type ImportRequest struct {
+	ForwardSet
+	ConnectionInfo string `json:"connection_info,omitempty"` // Apply every forward to this connection instead of the saved one
+	Owner          string `json:"owner,omitempty"`           // Recorded as the owner of each forward
+}
+
+// ImportResult reports the outcome of one forward of an import
+type ImportResult struct {
+	Forward ForwardSpec `json:"forward"`
+	ForwardBatchResult
+}
+
+// ImportResponse reports the outcome of each forward of an import, in order
+type ImportResponse struct {
+	Results []ImportResult `json:"results"`
+}
+
+// ForwardBatchRequest represents a request to establish several forwards,
+// each succeeding or failing on its own
+type ForwardBatchRequest struct {
+	Forwards []ForwardRequest `json:"forwards"`
+}
+
+// ForwardBatchResult reports the outcome of one forward of a batch
+type ForwardBatchResult struct {
+	Result *ForwardResponse `json:"result,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+// ForwardBatchResponse reports the outcome of each forward of a batch, in
+// the order requested
+type ForwardBatchResponse struct {
+	Results []ForwardBatchResult `json:"results"`
+}
+
+// ForwardStats holds traffic counters for a forward
+type ForwardStats struct {
+	BytesSent         uint64 `json:"bytes_sent"`     // Local client -> remote
+	BytesReceived     uint64 `json:"bytes_received"` // Remote -> local client
+	Connections       uint64 `json:"connections"`
+	ActiveConnections int64  `json:"active_connections"`
 }
 
 // StatusResponse represents daemon status
@@ -78,13 +369,86 @@ type StatusResponse struct {
 	Uptime         string             `json:"uptime"`
 	ActiveForwards int                `json:"active_forwards"`
 	Connections    []ConnectionStatus `json:"connections,omitempty"`
+	PendingRetries []PendingRetryInfo `json:"pending_retries,omitempty"`
+	Groups         []ForwardGroupInfo `json:"groups,omitempty"`
+	NamedForwards  []ForwardInfo      `json:"named_forwards,omitempty"`
+	Environment    *DaemonEnvironment `json:"environment,omitempty"` // Set when the request asks
+}
+
+// DaemonEnvironment describes the daemon process and what it's set up to
+// use, for bug reports
+type DaemonEnvironment struct {
+	PID            int             `json:"pid"`
+	Platform       string          `json:"platform"` // GOOS/GOARCH
+	GoVersion      string          `json:"go_version"`
+	MemoryBytes    uint64          `json:"memory_bytes"` // Obtained from the OS by the Go runtime
+	HeapBytes      uint64          `json:"heap_bytes"`   // Allocated and in use
+	Goroutines     int             `json:"goroutines"`
+	ConfigPath     string          `json:"config_path,omitempty"` // Empty when running on the defaults
+	Network        string          `json:"network"`
+	Address        string          `json:"address"` // Socket path or TCP address listened on
+	SSHCommand     string          `json:"ssh_command"`
+	SSHCommandPath string          `json:"ssh_command_path,omitempty"` // Empty when not found on PATH
+	ControlSockets []SSHConnection `json:"control_sockets,omitempty"`
+}
+
+// ForwardGroupInfo describes a port range forwarded as a group
+type ForwardGroupInfo struct {
+	Group          string `json:"group"`
+	ConnectionInfo string `json:"connection_info"`
+	Ports          int    `json:"ports"`
+	Active         int    `json:"active"`
+	Pending        int    `json:"pending"`
+}
+
+// PendingRetryInfo describes a forward the daemon is waiting to retry
+type PendingRetryInfo struct {
+	RemotePort     int    `json:"remote_port"`
+	LocalPort      int    `json:"local_port"`
+	Host           string `json:"host"`
+	RemoteSocket   string `json:"remote_socket,omitempty"`
+	LocalSocket    string `json:"local_socket,omitempty"`
+	Name           string `json:"name,omitempty"`
+	ConnectionInfo string `json:"connection_info"`
+	Attempts       int    `json:"attempts"`
+	NextAttempt    string `json:"next_attempt"`
+	LastError      string `json:"last_error"`
 }
 
 // ConnectionStatus represents status of a single SSH connection
 type ConnectionStatus struct {
-	ConnectionInfo string `json:"connection_info"`
-	ForwardCount   int    `json:"forward_count"`
-	LastActivity   string `json:"last_activity"`
+	ConnectionInfo string        `json:"connection_info"`
+	ForwardCount   int           `json:"forward_count"`
+	LastActivity   string        `json:"last_activity"`
+	Stats          *ForwardStats `json:"stats,omitempty"` // Totals across accounted forwards
+}
+
+// ConnectionsResponse lists the SSH control masters running on the local
+// machine, which forwards can go through. A remote host is only told of
+// the one its request came through, as Caller.
+type ConnectionsResponse struct {
+	Connections []SSHConnection `json:"connections"`
+	Caller      *SSHConnection  `json:"caller,omitempty"` // The master the request came through, if any
+}
+
+// SSHConnection is an SSH control master on the local machine
+type SSHConnection struct {
+	ConnectionInfo string `json:"connection_info"` // Empty when no host resolves to its socket
+	SocketPath     string `json:"socket_path"`
+	LocalPorts     []int  `json:"local_ports,omitempty"` // Of its TCP connections, when listed for the laptop
+}
+
+// StatusRequest represents a request for the daemon's status; its payload
+// is optional
+type StatusRequest struct {
+	Environment bool `json:"environment,omitempty"` // Describe the daemon process and its setup too
+}
+
+// ListRequest represents a request to list the active forwards; its
+// payload is optional
+type ListRequest struct {
+	CheckHealth    bool `json:"check_health,omitempty"`    // Check that each forward's local end accepts connections
+	CheckReachable bool `json:"check_reachable,omitempty"` // Check that each forward reaches its remote end instead
 }
 
 // ListResponse represents list of active forwards
@@ -92,6 +456,105 @@ type ListResponse struct {
 	Forwards []ForwardInfo `json:"forwards"`
 }
 
+// ReconcileAction is one forward or unforward request a monitor
+// reconciliation sent to the daemon
+type ReconcileAction struct {
+	Port      int    `json:"port"`
+	Action    string `json:"action"`               // "forward" or "unforward"
+	LocalPort int    `json:"local_port,omitempty"` // Local port the daemon forwarded the port to
+	Queued    bool   `json:"queued,omitempty"`     // SSH rejected the forward; the daemon will retry it
+	Error     string `json:"error,omitempty"`      // Why the request failed
+}
+
+// ReconcileReport summarizes a monitor reconciliation. Failed holds the
+// actions of either kind that didn't succeed.
+type ReconcileReport struct {
+	Forwarded   []ReconcileAction `json:"forwarded"`
+	Unforwarded []ReconcileAction `json:"unforwarded"`
+	Failed      []ReconcileAction `json:"failed"`
+	Unchanged   int               `json:"unchanged"` // Ports already forwarded as they should be
+}
+
+// LogsRequest represents a request for the daemon's log records
+type LogsRequest struct {
+	Level  string `json:"level,omitempty"`  // Least severe level to include (default: debug)
+	Lines  int    `json:"lines,omitempty"`  // How many recent records to return (0 = all kept)
+	Follow bool   `json:"follow,omitempty"` // Keep the connection open and stream new records
+}
+
+// LogsResponse carries the daemon's recent log records, oldest first
+type LogsResponse struct {
+	Records []LogRecord `json:"records"`
+}
+
+// LogRecord is one record of the daemon's log
+type LogRecord struct {
+	Time    string    `json:"time"` // RFC 3339, with fractional seconds
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	Attrs   []LogAttr `json:"attrs,omitempty"`
+}
+
+// LogAttr is one key/value pair of a log record, with group names joined to
+// the key by dots
+type LogAttr struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// MonitorStatusResponse represents the status of the monitor on a remote host
+type MonitorStatusResponse struct {
+	SessionID          string                 `json:"session_id"`
+	Source             string                 `json:"source"` // Port event source in use
+	Uptime             string                 `json:"uptime"`
+	Forwards           []MonitorForwardStatus `json:"forwards"`
+	PendingRemovals    int                    `json:"pending_removals"`
+	SettlingPorts      int                    `json:"settling_ports"`                 // Ports waiting for their state to settle
+	ProbingPorts       int                    `json:"probing_ports"`                  // Ports waiting on health checks or protocol detection
+	UDPListeners       int                    `json:"udp_listeners"`                  // Bound UDP ports, which aren't forwarded
+	LastReconcile      string                 `json:"last_reconcile,omitempty"`       // When the monitor last reconciled, if it has
+	LastReconcileError string                 `json:"last_reconcile_error,omitempty"` // Why that reconcile failed, if it did
+}
+
+// MonitorForwardStatus describes a forward the remote monitor made
+type MonitorForwardStatus struct {
+	RemotePort     int    `json:"remote_port,omitempty"`
+	LocalPort      int    `json:"local_port,omitempty"`
+	RemoteSocket   string `json:"remote_socket,omitempty"`
+	LocalSocket    string `json:"local_socket,omitempty"`
+	PID            int    `json:"pid,omitempty"`
+	ProcessName    string `json:"process_name,omitempty"`
+	AppProtocol    string `json:"app_protocol,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	RemovalPending string `json:"removal_pending,omitempty"` // When the removal was scheduled, for forwards of closed ports
+}
+
+// HistoryEntry represents a single recorded open request
+type HistoryEntry struct {
+	URL            string `json:"url"`
+	ConnectionInfo string `json:"connection_info,omitempty"`
+	ProcessName    string `json:"process_name,omitempty"`
+	ProcessCwd     string `json:"process_cwd,omitempty"`
+	OpenedAt       string `json:"opened_at"`
+	Denied         bool   `json:"denied,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// HistoryResponse represents recent open requests and per-connection usage
+type HistoryResponse struct {
+	Entries     []HistoryEntry `json:"entries"`
+	HourlyCount map[string]int `json:"hourly_count,omitempty"` // connection -> opens in the last hour
+	HourlyLimit int            `json:"hourly_limit,omitempty"` // 0 = unlimited
+}
+
+// ReopenRequest picks the open history entry to open again: the Index-th
+// most recent, as `bankshot history` numbers them, or the most recent whose
+// URL contains Match. With neither, it's the most recent open.
+type ReopenRequest struct {
+	Index int    `json:"index,omitempty"`
+	Match string `json:"match,omitempty"`
+}
+
 // OpProxyRequest represents a request to proxy an op CLI invocation
 type OpProxyRequest struct {
 	Args []string `json:"args"`
@@ -104,6 +567,207 @@ type OpProxyResponse struct {
 	ExitCode int    `json:"exit_code"`
 }
 
+const (
+	// OwnerCLI marks forwards requested with `bankshot forward`
+	OwnerCLI = "cli"
+	// OwnerMonitor marks forwards requested by the remote port monitor
+	OwnerMonitor = "monitor"
+	// OwnerOpen marks forwards the daemon made so a URL it was asked to open
+	// reaches the remote port it names
+	OwnerOpen = "open"
+
+	// wrapOwnerPrefix starts the owner of forwards requested by `bankshot wrap`
+	wrapOwnerPrefix = "wrap:"
+	// profileOwnerPrefix starts the owner of forwards brought up by `bankshot up`
+	profileOwnerPrefix = "profile:"
+)
+
+// ProfileOwner returns the owner of forwards brought up by `bankshot up` on
+// the host with the given connection info for the named profile of the
+// project in dir, e.g. "profile:devbox:/src/app#default". Hosts may share a
+// project path, so each brings its own forwards down.
+func ProfileOwner(connectionInfo, dir, profile string) string {
+	return profileOwnerPrefix + connectionInfo + ":" + dir + "#" + profile
+}
+
+// WrapOwner returns the owner of forwards requested by the `bankshot wrap`
+// process with the given PID, e.g. "wrap:1234"
+func WrapOwner(pid int) string {
+	return wrapOwnerPrefix + strconv.Itoa(pid)
+}
+
+// ParseWrapOwner returns the PID of the wrap process named by owner, and
+// false if owner isn't a wrap process
+func ParseWrapOwner(owner string) (int, bool) {
+	if !strings.HasPrefix(owner, wrapOwnerPrefix) {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimPrefix(owner, wrapOwnerPrefix))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, true
+}
+
+// OwnerMatches reports whether owner matches filter, which is either an
+// exact owner or just its kind, e.g. "wrap" for every wrap process
+func OwnerMatches(owner, filter string) bool {
+	if owner == filter {
+		return true
+	}
+	kind, _, found := strings.Cut(owner, ":")
+	return found && kind == filter
+}
+
+// NormalizeHost strips the brackets from an IPv6 literal such as "[::1]",
+// leaving other hosts unchanged
+func NormalizeHost(host string) string {
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host[1 : len(host)-1]
+	}
+	return host
+}
+
+// LocalURL rewrites rawURL, a URL for a port on the remote host such as
+// http://localhost:3000, to the local port that port is forwarded to,
+// preferring connectionInfo's forwards and otherwise taking the only forward
+// of the port there is. It reports whether a forward was found. Besides
+// loopback and wildcard addresses like 0.0.0.0, which servers often print,
+// URLs naming any of remoteHosts count as the remote host's; all of them
+// become localhost.
+func LocalURL(rawURL, connectionInfo string, forwards []ForwardInfo, remoteHosts ...string) (string, bool) {
+	u, remotePort, ok := remoteURL(rawURL, remoteHosts)
+	if !ok {
+		return rawURL, false
+	}
+
+	var match *ForwardInfo
+	count := 0
+	for i, fw := range forwards {
+		if fw.RemotePort != remotePort || fw.RemoteSocket != "" || fw.LocalSocket != "" {
+			continue
+		}
+		if h := NormalizeHost(fw.Host); h != "" && h != "localhost" && h != "127.0.0.1" && h != "::1" {
+			continue
+		}
+		if fw.ConnectionInfo == connectionInfo {
+			match, count = &forwards[i], 1
+			break
+		}
+		match = &forwards[i]
+		count++
+	}
+	if count != 1 {
+		return rawURL, false
+	}
+
+	u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(match.LocalPort))
+	return u.String(), true
+}
+
+// RemoteURLPort returns the port rawURL is for when it names the remote host,
+// as LocalURL decides, and false otherwise
+func RemoteURLPort(rawURL string, remoteHosts ...string) (int, bool) {
+	_, port, ok := remoteURL(rawURL, remoteHosts)
+	return port, ok
+}
+
+// remoteURL parses rawURL if it's for a loopback or wildcard address or one
+// of remoteHosts, returning it with the host made localhost where it isn't
+// loopback already, and the port it names
+func remoteURL(rawURL string, remoteHosts []string) (*url.URL, int, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, 0, false
+	}
+
+	host := u.Hostname()
+	ip := net.ParseIP(host)
+	switch {
+	case ip != nil && ip.IsUnspecified():
+		host = "localhost"
+	case host == "localhost" || ip != nil && ip.IsLoopback():
+	case slices.ContainsFunc(remoteHosts, func(h string) bool { return h != "" && strings.EqualFold(h, host) }):
+		host = "localhost"
+	default:
+		return nil, 0, false
+	}
+
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "http", "ws":
+			port = "80"
+		case "https", "wss":
+			port = "443"
+		default:
+			return nil, 0, false
+		}
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, 0, false
+	}
+	u.Host = net.JoinHostPort(host, port)
+	return u, n, true
+}
+
+// ValidateHost checks that host is usable as the remote end of a forward: a
+// hostname, an IPv4 address, or an IPv6 literal with or without brackets.
+// An empty host is valid and means localhost.
+func ValidateHost(host string) error {
+	if host == "" {
+		return nil
+	}
+	bare := NormalizeHost(host)
+	if strings.ContainsAny(bare, ":[]") {
+		if net.ParseIP(bare) == nil {
+			return fmt.Errorf("invalid host %q: not an IPv6 address", host)
+		}
+		return nil
+	}
+	if bare == "" || strings.ContainsAny(bare, " \t/@") {
+		return fmt.Errorf("invalid host %q", host)
+	}
+	return nil
+}
+
+// validatePort checks a port field, where 0 means unset
+func validatePort(name string, port int) error {
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("invalid %s: %d", name, port)
+	}
+	return nil
+}
+
+// Validate checks the request's host and ports
+func (r *ForwardRequest) Validate() error {
+	if err := ValidateHost(r.Host); err != nil {
+		return err
+	}
+	if err := validatePort("remote port", r.RemotePort); err != nil {
+		return err
+	}
+	if err := validatePort("remote port end", r.RemotePortEnd); err != nil {
+		return err
+	}
+	if !ValidConflictPolicy(r.Conflict) {
+		return fmt.Errorf("invalid conflict policy %q (must be %s)", r.Conflict, ConflictPolicyNames())
+	}
+	return validatePort("local port", r.LocalPort)
+}
+
+// Validate checks the request's host and ports
+func (r *UnforwardRequest) Validate() error {
+	if err := ValidateHost(r.Host); err != nil {
+		return err
+	}
+	if err := validatePort("remote port", r.RemotePort); err != nil {
+		return err
+	}
+	return validatePort("remote port end", r.RemotePortEnd)
+}
+
 // ParseRequest parses a JSON request
 func ParseRequest(data []byte) (*Request, error) {
 	var req Request
@@ -270,3 +270,224 @@ func TestPayloadParsing(t *testing.T) {
 		}
 	})
 }
+
+func TestValidateHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr bool
+	}{
+		{"", false},
+		{"localhost", false},
+		{"db.internal", false},
+		{"10.0.0.5", false},
+		{"::1", false},
+		{"[::1]", false},
+		{"fe80::1%eth0", true},
+		{"[fe80::1", true},
+		{"::ffff:10.0.0.5", false},
+		{"host:8080", true},
+		{"user@host", true},
+		{"[]", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			err := ValidateHost(tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateHost(%q) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestForwardRequestValidate(t *testing.T) {
+	valid := ForwardRequest{RemotePort: 8080, Host: "[::1]", ConnectionInfo: "devbox"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+	if got := NormalizeHost(valid.Host); got != "::1" {
+		t.Errorf("NormalizeHost(%q) = %q, want %q", valid.Host, got, "::1")
+	}
+
+	badPort := ForwardRequest{RemotePort: 70000, ConnectionInfo: "devbox"}
+	if err := badPort.Validate(); err == nil {
+		t.Error("Validate() with out-of-range port should error")
+	}
+
+	badConflict := ForwardRequest{RemotePort: 8080, ConnectionInfo: "devbox", Conflict: "borrow"}
+	if err := badConflict.Validate(); err == nil {
+		t.Error("Validate() with unknown conflict policy should error")
+	}
+
+	badHost := UnforwardRequest{RemotePort: 8080, Host: "::1:8080:", ConnectionInfo: "devbox"}
+	if err := badHost.Validate(); err == nil {
+		t.Error("Validate() with malformed IPv6 host should error")
+	}
+}
+
+func TestOwner(t *testing.T) {
+	owner := WrapOwner(1234)
+	if pid, ok := ParseWrapOwner(owner); !ok || pid != 1234 {
+		t.Errorf("ParseWrapOwner(%q) = (%d, %v), want (1234, true)", owner, pid, ok)
+	}
+	for _, other := range []string{OwnerCLI, OwnerMonitor, "wrap:", "wrap:abc", ""} {
+		if _, ok := ParseWrapOwner(other); ok {
+			t.Errorf("ParseWrapOwner(%q) should not parse", other)
+		}
+	}
+
+	tests := []struct {
+		owner, filter string
+		want          bool
+	}{
+		{"wrap:1234", "wrap", true},
+		{"wrap:1234", "wrap:1234", true},
+		{"wrap:1234", "wrap:99", false},
+		{"cli", "cli", true},
+		{"cli", "wrap", false},
+		{"", "cli", false},
+		{ProfileOwner("devbox", "/src/app", "default"), "profile", true},
+		{ProfileOwner("devbox", "/src/app", "default"), ProfileOwner("devbox", "/src/app", "db"), false},
+		{ProfileOwner("devbox", "/src/app", "default"), ProfileOwner("buildbox", "/src/app", "default"), false},
+	}
+	for _, tt := range tests {
+		if got := OwnerMatches(tt.owner, tt.filter); got != tt.want {
+			t.Errorf("OwnerMatches(%q, %q) = %v, want %v", tt.owner, tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestLocalURL(t *testing.T) {
+	forwards := []ForwardInfo{
+		{RemotePort: 3000, LocalPort: 3001, Host: "localhost", ConnectionInfo: "devbox"},
+		{RemotePort: 8080, LocalPort: 9090, Host: "localhost", ConnectionInfo: "devbox"},
+		{RemotePort: 8080, LocalPort: 8080, Host: "localhost", ConnectionInfo: "other"},
+		{RemotePort: 5000, LocalPort: 5001, Host: "localhost", ConnectionInfo: "other"},
+		{RemotePort: 80, LocalPort: 8000, Host: "localhost", ConnectionInfo: "devbox"},
+	}
+
+	tests := []struct {
+		url       string
+		want      string
+		forwarded bool
+	}{
+		{"http://localhost:3000/app?x=1", "http://localhost:3001/app?x=1", true},
+		{"http://127.0.0.1:8080/", "http://127.0.0.1:9090/", true},
+		{"http://0.0.0.0:3000", "http://localhost:3001", true},
+		{"http://[::1]:3000/", "http://[::1]:3001/", true},
+		{"http://localhost:5000", "http://localhost:5001", true}, // Only forward of the port
+		{"http://localhost/", "http://localhost:8000/", true},
+		{"http://localhost:4000", "http://localhost:4000", false},
+		{"https://example.com:3000", "https://example.com:3000", false},
+		{"not a url", "not a url", false},
+	}
+	for _, tt := range tests {
+		got, forwarded := LocalURL(tt.url, "devbox", forwards)
+		if got != tt.want || forwarded != tt.forwarded {
+			t.Errorf("LocalURL(%q) = (%q, %v), want (%q, %v)", tt.url, got, forwarded, tt.want, tt.forwarded)
+		}
+	}
+
+	// Ambiguous without the requester's connection
+	if got, forwarded := LocalURL("http://localhost:8080", "elsewhere", forwards); forwarded {
+		t.Errorf("LocalURL with two forwards of the port = %q, want it left alone", got)
+	}
+
+	// The remote host's own name counts as it, whatever its case
+	if got, forwarded := LocalURL("http://DevBox:3000/cb", "devbox", forwards, "devbox"); !forwarded || got != "http://localhost:3001/cb" {
+		t.Errorf("LocalURL by host name = (%q, %v), want http://localhost:3001/cb", got, forwarded)
+	}
+	if got, forwarded := LocalURL("http://devbox:3000/cb", "devbox", forwards, ""); forwarded {
+		t.Errorf("LocalURL by an unknown host name = %q, want it left alone", got)
+	}
+}
+
+func TestRemoteURLPort(t *testing.T) {
+	tests := []struct {
+		url  string
+		port int
+		ok   bool
+	}{
+		{"http://localhost:3000/", 3000, true},
+		{"https://127.0.0.1/", 443, true},
+		{"http://0.0.0.0:8080", 8080, true},
+		{"http://devbox.lan:5173/", 5173, true},
+		{"http://example.com:3000/", 0, false},
+		{"vscode://localhost/file", 0, false},
+		{"localhost:3000", 0, false},
+	}
+	for _, tt := range tests {
+		port, ok := RemoteURLPort(tt.url, "devbox.lan")
+		if port != tt.port || ok != tt.ok {
+			t.Errorf("RemoteURLPort(%q) = (%d, %v), want (%d, %v)", tt.url, port, ok, tt.port, tt.ok)
+		}
+	}
+}
+
+func TestForwardInfoLocalURL(t *testing.T) {
+	tests := []struct {
+		name string
+		fw   ForwardInfo
+		want string
+	}{
+		{"ssh's default", ForwardInfo{LocalPort: 3000}, "http://localhost:3000"},
+		{"https", ForwardInfo{LocalPort: 3000, AppProtocol: "https"}, "https://localhost:3000"},
+		{"wildcard", ForwardInfo{LocalPort: 3000, BindAddress: "0.0.0.0"}, "http://localhost:3000"},
+		{"another loopback address", ForwardInfo{LocalPort: 3000, BindAddress: "127.0.0.2"}, "http://127.0.0.2:3000"},
+		{"IPv6", ForwardInfo{LocalPort: 3000, BindAddress: "::1"}, "http://[::1]:3000"},
+		{"LAN address", ForwardInfo{LocalPort: 3000, BindAddress: "192.168.1.5"}, "http://192.168.1.5:3000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fw.LocalURL(); got != tt.want {
+				t.Errorf("LocalURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardInfoLocalTarget(t *testing.T) {
+	tests := []struct {
+		name string
+		fw   ForwardInfo
+		want string
+	}{
+		{"port", ForwardInfo{LocalPort: 3000}, "localhost:3000"},
+		{"bound address", ForwardInfo{LocalPort: 3000, BindAddress: "127.0.0.2"}, "127.0.0.2:3000"},
+		{"HTTP", ForwardInfo{LocalPort: 3000, BindAddress: "127.0.0.2", AppProtocol: "http", Server: "Next.js"}, "http://127.0.0.2:3000 (Next.js)"},
+		{"HTTP/2", ForwardInfo{LocalPort: 50051, AppProtocol: "h2c"}, "localhost:50051 (HTTP/2)"},
+		{"Unix socket", ForwardInfo{LocalSocket: "/tmp/app.sock", BindAddress: "127.0.0.2"}, "/tmp/app.sock"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fw.LocalTarget(); got != tt.want {
+				t.Errorf("LocalTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsLoopbackAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"localhost", true},
+		{"127.0.0.1", true},
+		{"127.0.0.2", true},
+		{"::1", true},
+		{"[::1]", true},
+		{"", false},
+		{"0.0.0.0", false},
+		{"192.168.1.10", false},
+		{"devbox", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsLoopbackAddress(tt.addr); got != tt.want {
+			t.Errorf("IsLoopbackAddress(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
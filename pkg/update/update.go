@@ -0,0 +1,325 @@
+package update
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Binaries are the executables a release archive carries
+var Binaries = []string{"bankshot", "bankshotd"}
+
+// ErrNoAsset is returned when a release has no archive for a platform
+var ErrNoAsset = errors.New("no release archive for this platform")
+
+// ErrNoSigningKey is returned by Download in builds without a SigningKey to
+// check releases with
+var ErrNoSigningKey = errors.New("this build has no release signing key to check downloads with")
+
+// SigningKey is the base64 ed25519 public key release checksums.txt files
+// are signed with. Release builds set it through -ldflags.
+var SigningKey string
+
+// Release is a published bankshot release
+type Release struct {
+	Version string            // Without the tag's leading "v"
+	URL     string            // The release's page
+	Assets  map[string]string // Download URLs by file name
+}
+
+// Client looks up and downloads releases from GitHub
+type Client struct {
+	baseURL    string
+	repo       string
+	httpClient *http.Client
+	publicKey  ed25519.PublicKey // Checks checksums.txt.sig; nil refuses downloads
+}
+
+// New creates a Client for the phinze/bankshot releases, checking them with
+// SigningKey
+func New() *Client {
+	c := &Client{
+		baseURL:    "https://api.github.com",
+		repo:       "phinze/bankshot",
+		httpClient: &http.Client{Timeout: 2 * time.Minute},
+	}
+	if key, err := base64.StdEncoding.DecodeString(SigningKey); err == nil && len(key) == ed25519.PublicKeySize {
+		c.publicKey = key
+	}
+	return c
+}
+
+// WithPublicKey checks releases with key instead of SigningKey
+func (c *Client) WithPublicKey(key ed25519.PublicKey) *Client {
+	c.publicKey = key
+	return c
+}
+
+// WithBaseURL points the client at another GitHub API endpoint
+func (c *Client) WithBaseURL(baseURL string) *Client {
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+	return c
+}
+
+// Latest returns the most recent release
+func (c *Client) Latest(ctx context.Context) (*Release, error) {
+	body, err := c.get(ctx, fmt.Sprintf("%s/repos/%s/releases/latest", c.baseURL, c.repo))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the latest release: %w", err)
+	}
+
+	var payload struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+		Assets  []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse the latest release: %w", err)
+	}
+
+	rel := &Release{
+		Version: strings.TrimPrefix(payload.TagName, "v"),
+		URL:     payload.HTMLURL,
+		Assets:  make(map[string]string, len(payload.Assets)),
+	}
+	for _, asset := range payload.Assets {
+		rel.Assets[asset.Name] = asset.URL
+	}
+	return rel, nil
+}
+
+// Download fetches the release archive for goos and goarch, checks it
+// against the release's checksums and their signature, and returns the
+// binaries in it by name. The checksums only show the archive is the one
+// they list; the signature shows the release was made by whoever holds the
+// signing key, not just by someone able to publish a release.
+func (c *Client) Download(ctx context.Context, rel *Release, goos, goarch string) (map[string][]byte, error) {
+	if c.publicKey == nil {
+		return nil, ErrNoSigningKey
+	}
+	name := ArchiveName(goos, goarch)
+	archiveURL, ok := rel.Assets[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNoAsset, goos, goarch)
+	}
+	checksumsURL, ok := rel.Assets["checksums.txt"]
+	if !ok {
+		return nil, fmt.Errorf("release %s has no checksums.txt", rel.Version)
+	}
+	signatureURL, ok := rel.Assets["checksums.txt.sig"]
+	if !ok {
+		return nil, fmt.Errorf("release %s has no checksums.txt.sig", rel.Version)
+	}
+
+	checksums, err := c.get(ctx, checksumsURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download checksums: %w", err)
+	}
+	signature, err := c.get(ctx, signatureURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the checksums' signature: %w", err)
+	}
+	if !ed25519.Verify(c.publicKey, checksums, signature) {
+		return nil, fmt.Errorf("checksums.txt of release %s isn't signed by the release signing key", rel.Version)
+	}
+	archive, err := c.get(ctx, archiveURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	if err := verifyChecksum(name, archive, checksums); err != nil {
+		return nil, err
+	}
+
+	return extractBinaries(archive)
+}
+
+func (c *Client) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// ArchiveName is the name goreleaser gives the archive for goos and goarch
+func ArchiveName(goos, goarch string) string {
+	if goarch == "amd64" {
+		goarch = "x86_64"
+	}
+	return fmt.Sprintf("bankshot_%s_%s.tar.gz", goos, goarch)
+}
+
+// verifyChecksum checks data against name's entry in a checksums.txt
+func verifyChecksum(name string, data, checksums []byte) error {
+	sum := sha256.Sum256(data)
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[1] != name {
+			continue
+		}
+		if fields[0] != hex.EncodeToString(sum[:]) {
+			return fmt.Errorf("checksum mismatch for %s", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("no checksum for %s", name)
+}
+
+// extractBinaries returns the Binaries found in a .tar.gz archive
+func extractBinaries(archive []byte) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	binaries := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Base(hdr.Name)
+		for _, b := range Binaries {
+			if name == b {
+				if binaries[name], err = io.ReadAll(tr); err != nil {
+					return nil, fmt.Errorf("failed to read %s from archive: %w", name, err)
+				}
+			}
+		}
+	}
+
+	if _, ok := binaries["bankshot"]; !ok {
+		return nil, fmt.Errorf("archive has no bankshot binary")
+	}
+	return binaries, nil
+}
+
+// Replace atomically replaces the executable at path with data, keeping its
+// permissions
+func Replace(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".new-*")
+	if err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// Newer reports whether version latest comes after current. Versions that
+// aren't releases, like "dev", are older than any release.
+func Newer(latest, current string) bool {
+	l, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	c, ok := parseVersion(current)
+	if !ok {
+		return true
+	}
+
+	for i := range l.numbers {
+		if l.numbers[i] != c.numbers[i] {
+			return l.numbers[i] > c.numbers[i]
+		}
+	}
+	// A prerelease comes before its release
+	switch {
+	case l.prerelease == "" || c.prerelease == "":
+		return l.prerelease == "" && c.prerelease != ""
+	default:
+		return l.prerelease > c.prerelease
+	}
+}
+
+// semver is a parsed MAJOR.MINOR.PATCH[-PRERELEASE] version
+type semver struct {
+	numbers    [3]int
+	prerelease string
+}
+
+// parseVersion parses a version with or without a leading "v"; build
+// metadata is ignored
+func parseVersion(s string) (semver, bool) {
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+
+	var v semver
+	s, v.prerelease, _ = strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return semver{}, false
+		}
+		v.numbers[i] = n
+	}
+	return v, true
+}
+
+// IsRelease reports whether version names a release rather than a
+// development build
+func IsRelease(version string) bool {
+	_, ok := parseVersion(version)
+	return ok
+}
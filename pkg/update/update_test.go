@@ -0,0 +1,212 @@
+package update
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"1.2.0", "1.1.9", true},
+		{"1.2.0", "v1.2.0", false},
+		{"1.10.0", "1.9.3", true},
+		{"1.2.0", "1.3.0", false},
+		{"1.2.0", "1.2.0-rc.1", true},
+		{"1.2.0-rc.2", "1.2.0-rc.1", true},
+		{"1.2.0-rc.1", "1.2.0", false},
+		{"1.2.0", "dev", true},
+		{"1.2.0", "1.1.9-next", true},
+		{"garbage", "1.0.0", false},
+	}
+
+	for _, tt := range tests {
+		if got := Newer(tt.latest, tt.current); got != tt.want {
+			t.Errorf("Newer(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	if got := ArchiveName("linux", "amd64"); got != "bankshot_linux_x86_64.tar.gz" {
+		t.Errorf("ArchiveName(linux, amd64) = %q", got)
+	}
+	if got := ArchiveName("darwin", "arm64"); got != "bankshot_darwin_arm64.tar.gz" {
+		t.Errorf("ArchiveName(darwin, arm64) = %q", got)
+	}
+}
+
+// releaseServer serves a fake GitHub release with an archive for linux/amd64,
+// its checksums signed with key
+func releaseServer(t *testing.T, key ed25519.PrivateKey, checksum func(archive []byte) string) *httptest.Server {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range map[string]string{"bankshot": "new bankshot", "bankshotd": "new bankshotd", "README.md": "readme"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/repos/phinze/bankshot/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"tag_name": "v1.2.0", "html_url": "https://example.com/v1.2.0", "assets": [
+			{"name": "bankshot_linux_x86_64.tar.gz", "browser_download_url": "%[1]s/archive"},
+			{"name": "checksums.txt", "browser_download_url": "%[1]s/checksums"},
+			{"name": "checksums.txt.sig", "browser_download_url": "%[1]s/checksums.sig"}
+		]}`, server.URL)
+	})
+	mux.HandleFunc("/archive", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive)
+	})
+	checksums := []byte(fmt.Sprintf("%s  bankshot_linux_x86_64.tar.gz\n", checksum(archive)))
+	mux.HandleFunc("/checksums", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(checksums)
+	})
+	mux.HandleFunc("/checksums.sig", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(ed25519.Sign(key, checksums))
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// signingKey returns a new release signing key pair
+func signingKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub, priv
+}
+
+// archiveChecksum is the checksum releaseServer's archive really has
+func archiveChecksum(archive []byte) string {
+	sum := sha256.Sum256(archive)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestLatestAndDownload(t *testing.T) {
+	pub, priv := signingKey(t)
+	server := releaseServer(t, priv, archiveChecksum)
+	c := New().WithBaseURL(server.URL).WithPublicKey(pub)
+
+	rel, err := c.Latest(context.Background())
+	if err != nil {
+		t.Fatalf("Latest() error = %v", err)
+	}
+	if rel.Version != "1.2.0" {
+		t.Errorf("Version = %q, want 1.2.0", rel.Version)
+	}
+
+	binaries, err := c.Download(context.Background(), rel, "linux", "amd64")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if string(binaries["bankshot"]) != "new bankshot" || string(binaries["bankshotd"]) != "new bankshotd" {
+		t.Errorf("Download() = %q", binaries)
+	}
+	if _, ok := binaries["README.md"]; ok {
+		t.Error("Download() returned README.md, want only binaries")
+	}
+
+	if _, err := c.Download(context.Background(), rel, "darwin", "arm64"); !errors.Is(err, ErrNoAsset) {
+		t.Errorf("Download(darwin/arm64) error = %v, want ErrNoAsset", err)
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	pub, priv := signingKey(t)
+	server := releaseServer(t, priv, func([]byte) string {
+		return archiveChecksum([]byte("something else"))
+	})
+	c := New().WithBaseURL(server.URL).WithPublicKey(pub)
+
+	rel, err := c.Latest(context.Background())
+	if err != nil {
+		t.Fatalf("Latest() error = %v", err)
+	}
+	if _, err := c.Download(context.Background(), rel, "linux", "amd64"); err == nil {
+		t.Error("Download() succeeded despite a checksum mismatch")
+	}
+}
+
+func TestDownloadSignature(t *testing.T) {
+	pub, _ := signingKey(t)
+	_, otherPriv := signingKey(t)
+	// Checksums that match, but signed by someone else
+	server := releaseServer(t, otherPriv, archiveChecksum)
+
+	rel, err := New().WithBaseURL(server.URL).Latest(context.Background())
+	if err != nil {
+		t.Fatalf("Latest() error = %v", err)
+	}
+	if _, err := New().WithBaseURL(server.URL).WithPublicKey(pub).Download(context.Background(), rel, "linux", "amd64"); err == nil {
+		t.Error("Download() succeeded with checksums signed by another key")
+	}
+	if _, err := New().WithBaseURL(server.URL).WithPublicKey(nil).Download(context.Background(), rel, "linux", "amd64"); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("Download() error = %v without a signing key, want ErrNoSigningKey", err)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bankshot")
+	if err := os.WriteFile(path, []byte("old"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Replace(path, []byte("new")); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new" {
+		t.Errorf("contents = %q, want new", data)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o750 {
+		t.Errorf("mode = %v, want 0750", info.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want just the binary", len(entries))
+	}
+}
@@ -0,0 +1,315 @@
+package vhost
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phinze/bankshot/pkg/config"
+)
+
+const (
+	// sniffTimeout bounds how long a client may take to send the TLS
+	// ClientHello or HTTP request headers that name its host
+	sniffTimeout = 5 * time.Second
+
+	// maxSniffBytes caps how much of a connection is buffered while looking
+	// for the hostname
+	maxSniffBytes = 64 * 1024
+)
+
+// errHelloRead stops the TLS handshake once the ClientHello has been seen
+var errHelloRead = errors.New("client hello read")
+
+// LookupFunc returns the local port of the forward with the given name
+type LookupFunc func(name string) (int, bool)
+
+// Proxy listens on shared local ports (typically 80 and 443) and hands each
+// connection to the forward its hostname maps to. The hostname comes from the
+// TLS SNI extension or the HTTP Host header; TLS is passed through untouched.
+// Routing happens once per connection, which matches how browsers pool
+// connections by host.
+type Proxy struct {
+	config *config.VHostConfig
+	logger *slog.Logger
+	lookup LookupFunc
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// New creates a new Proxy. lookup resolves forward names to local ports.
+func New(cfg *config.VHostConfig, logger *slog.Logger, lookup LookupFunc) *Proxy {
+	return &Proxy{
+		config: cfg,
+		logger: logger,
+		lookup: lookup,
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// Start listens on every configured address. If any address can't be bound,
+// the ones already bound are closed again.
+func (p *Proxy) Start() error {
+	for _, addr := range p.config.Listen {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			p.Close()
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+
+		p.mu.Lock()
+		p.listeners = append(p.listeners, ln)
+		p.mu.Unlock()
+
+		p.logger.Info("VHost proxy listening", "address", ln.Addr().String(), "domain", p.config.Domain)
+
+		p.wg.Add(1)
+		go p.serve(ln)
+	}
+	return nil
+}
+
+// Addrs returns the addresses the proxy is listening on
+func (p *Proxy) Addrs() []net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	addrs := make([]net.Addr, 0, len(p.listeners))
+	for _, ln := range p.listeners {
+		addrs = append(addrs, ln.Addr())
+	}
+	return addrs
+}
+
+// Close stops the listeners, tears down open connections, and waits for all
+// proxy goroutines to exit
+func (p *Proxy) Close() {
+	p.mu.Lock()
+	p.closed = true
+	for _, ln := range p.listeners {
+		_ = ln.Close()
+	}
+	for c := range p.conns {
+		_ = c.Close()
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// Resolve returns the local port a hostname routes to. Explicit routes win;
+// otherwise the label just before the configured domain names a forward, so
+// api.myapp.vm.localhost reaches the forward named myapp too.
+func (p *Proxy) Resolve(host string) (int, bool) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for route, port := range p.config.Routes {
+		if strings.EqualFold(route, host) {
+			return port, true
+		}
+	}
+
+	domain := strings.Trim(strings.ToLower(p.config.Domain), ".")
+	if domain == "" {
+		domain = "localhost"
+	}
+	prefix, ok := strings.CutSuffix(host, "."+domain)
+	if !ok || prefix == "" {
+		return 0, false
+	}
+	if dot := strings.LastIndex(prefix, "."); dot >= 0 {
+		prefix = prefix[dot+1:]
+	}
+	return p.lookup(prefix)
+}
+
+func (p *Proxy) serve(ln net.Listener) {
+	defer p.wg.Done()
+
+	for {
+		client, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				p.logger.Error("VHost proxy accept failed", "address", ln.Addr().String(), "error", err)
+			}
+			return
+		}
+
+		p.wg.Add(1)
+		go p.handle(client)
+	}
+}
+
+func (p *Proxy) handle(client net.Conn) {
+	defer p.wg.Done()
+
+	if !p.track(client) {
+		_ = client.Close()
+		return
+	}
+	defer p.untrack(client)
+	defer func() { _ = client.Close() }()
+
+	// Everything read while sniffing is replayed to the upstream
+	var sniffed bytes.Buffer
+	reader := io.TeeReader(io.LimitReader(client, maxSniffBytes), &sniffed)
+
+	_ = client.SetReadDeadline(time.Now().Add(sniffTimeout))
+	br := bufio.NewReader(reader)
+	first, err := br.Peek(1)
+	if err != nil {
+		return
+	}
+
+	isTLS := first[0] == 0x16 // TLS handshake record
+	var host string
+	if isTLS {
+		host, err = readServerName(br)
+	} else {
+		host, err = readHTTPHost(br)
+	}
+	_ = client.SetReadDeadline(time.Time{})
+	if err != nil {
+		p.logger.Debug("VHost proxy could not determine hostname", "tls", isTLS, "error", err)
+		return
+	}
+
+	port, ok := p.Resolve(host)
+	if !ok {
+		p.logger.Debug("VHost proxy has no forward for host", "host", host)
+		if !isTLS {
+			writeHTTPError(client, http.StatusBadGateway, fmt.Sprintf("bankshot: no forward for %s\n", host))
+		}
+		return
+	}
+
+	upstream, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		p.logger.Warn("VHost proxy failed to reach forward", "host", host, "port", port, "error", err)
+		if !isTLS {
+			writeHTTPError(client, http.StatusBadGateway, fmt.Sprintf("bankshot: forward for %s is not reachable\n", host))
+		}
+		return
+	}
+	if !p.track(upstream) {
+		_ = upstream.Close()
+		return
+	}
+	defer p.untrack(upstream)
+	defer func() { _ = upstream.Close() }()
+
+	if _, err := upstream.Write(sniffed.Bytes()); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(upstream, client)
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, upstream)
+		closeWrite(client)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// readServerName reads a TLS ClientHello and returns its SNI hostname. The
+// handshake is driven by crypto/tls over a connection that can't be written
+// to and is abandoned as soon as the hello has been parsed.
+func readServerName(r io.Reader) (string, error) {
+	var hello *tls.ClientHelloInfo
+	err := tls.Server(sniffConn{r: r}, &tls.Config{
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = info
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	if hello == nil {
+		return "", fmt.Errorf("failed to read TLS client hello: %w", err)
+	}
+	if hello.ServerName == "" {
+		return "", fmt.Errorf("TLS client hello has no server name")
+	}
+	return hello.ServerName, nil
+}
+
+// readHTTPHost reads HTTP request headers and returns the Host header
+func readHTTPHost(r *bufio.Reader) (string, error) {
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read HTTP request: %w", err)
+	}
+	if req.Host == "" {
+		return "", fmt.Errorf("HTTP request has no Host header")
+	}
+	return req.Host, nil
+}
+
+// writeHTTPError answers an HTTP client the proxy can't route
+func writeHTTPError(conn net.Conn, status int, body string) {
+	_, _ = fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\nContent-Type: text/plain\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+		status, http.StatusText(status), len(body), body)
+}
+
+// closeWrite half-closes a TCP connection so the peer sees EOF while replies
+// can still flow back
+func closeWrite(conn net.Conn) {
+	if tc, ok := conn.(*net.TCPConn); ok {
+		_ = tc.CloseWrite()
+		return
+	}
+	_ = conn.Close()
+}
+
+// track registers open connections so Close can tear them down. Returns
+// false if the proxy is already closing.
+func (p *Proxy) track(conn net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.conns[conn] = struct{}{}
+	return true
+}
+
+func (p *Proxy) untrack(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.conns, conn)
+}
+
+// sniffConn is a read-only net.Conn for parsing a ClientHello
+type sniffConn struct {
+	r io.Reader
+}
+
+func (c sniffConn) Read(b []byte) (int, error)         { return c.r.Read(b) }
+func (c sniffConn) Write(b []byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (c sniffConn) Close() error                       { return nil }
+func (c sniffConn) LocalAddr() net.Addr                { return nil }
+func (c sniffConn) RemoteAddr() net.Addr               { return nil }
+func (c sniffConn) SetDeadline(t time.Time) error      { return nil }
+func (c sniffConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c sniffConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,151 @@
+package vhost
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/phinze/bankshot/pkg/config"
+)
+
+func newTestProxy(t *testing.T, cfg *config.VHostConfig, names map[string]int) *Proxy {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	p := New(cfg, logger, func(name string) (int, bool) {
+		port, ok := names[name]
+		return port, ok
+	})
+	if err := p.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func serverPort(t *testing.T, srv *httptest.Server) int {
+	t.Helper()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to parse server address: %v", err)
+	}
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+func TestResolve(t *testing.T) {
+	p := New(&config.VHostConfig{
+		Domain: "vm.localhost",
+		Routes: map[string]int{"legacy.localhost": 9000},
+	}, slog.Default(), func(name string) (int, bool) {
+		if name == "myapp" {
+			return 3000, true
+		}
+		return 0, false
+	})
+
+	tests := []struct {
+		host   string
+		want   int
+		wantOK bool
+	}{
+		{"myapp.vm.localhost", 3000, true},
+		{"MyApp.VM.localhost:443", 3000, true},
+		{"api.myapp.vm.localhost", 3000, true},
+		{"myapp.vm.localhost.", 3000, true},
+		{"legacy.localhost:8080", 9000, true},
+		{"other.vm.localhost", 0, false},
+		{"vm.localhost", 0, false},
+		{"myapp.localhost", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got, ok := p.Resolve(tt.host)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Resolve(%q) = %d, %v, want %d, %v", tt.host, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestProxyRoutesHTTPByHost(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "myapp %s", r.Host)
+	}))
+	defer app.Close()
+
+	p := newTestProxy(t, &config.VHostConfig{
+		Listen: []string{"127.0.0.1:0"},
+		Domain: "vm.localhost",
+	}, map[string]int{"myapp": serverPort(t, app)})
+	addr := p.Addrs()[0].String()
+
+	// Routing is per connection, so each request needs its own
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func(host string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest("GET", "http://"+addr+"/", nil)
+		if err != nil {
+			t.Fatalf("failed to build request: %v", err)
+		}
+		req.Host = host
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request for %s failed: %v", host, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get("myapp.vm.localhost")
+	if resp.StatusCode != http.StatusOK || body != "myapp myapp.vm.localhost" {
+		t.Errorf("myapp.vm.localhost = %d %q", resp.StatusCode, body)
+	}
+
+	resp, body = get("missing.vm.localhost")
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(body, "no forward for missing.vm.localhost") {
+		t.Errorf("missing.vm.localhost = %d %q, want 502", resp.StatusCode, body)
+	}
+}
+
+func TestProxyRoutesTLSBySNI(t *testing.T) {
+	app := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "secure myapp")
+	}))
+	defer app.Close()
+
+	p := newTestProxy(t, &config.VHostConfig{
+		Listen: []string{"127.0.0.1:0"},
+		Domain: "vm.localhost",
+	}, map[string]int{"myapp": serverPort(t, app)})
+	addr := p.Addrs()[0].String()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{ServerName: "myapp.vm.localhost", InsecureSkipVerify: true},
+	}}
+	resp, err := client.Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatalf("TLS request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "secure myapp" {
+		t.Errorf("body = %q, want %q", body, "secure myapp")
+	}
+
+	// Without a matching name the connection is simply closed
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: "missing.vm.localhost", InsecureSkipVerify: true})
+	if err == nil {
+		_ = conn.Close()
+		t.Error("TLS dial for an unknown host should fail")
+	}
+}